@@ -0,0 +1,42 @@
+package compiler
+
+import (
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+)
+
+// Analyze the compiled material trees and flag scenes whose surfaces only use
+// diffuse or emissive bxdfs so that tracers can select a faster shading path.
+// This pass must run after the scene geometry has been partitioned.
+func (sc *sceneCompiler) analyzeMaterials() {
+	sc.optimizedScene.AllDiffuse = allDiffuseMaterials(sc.optimizedScene)
+	if sc.optimizedScene.AllDiffuse {
+		sc.logger.Info("all scene materials are diffuse; enabling the diffuse shading fast-path")
+	}
+}
+
+// Check whether all bxdf nodes in the scene material node list are either
+// diffuse or emissive. Operator nodes are ignored as they only select or
+// modify their bxdf operands. Scenes with per-primitive opacity values are
+// never considered all-diffuse as the tracer may replace the bxdf of any
+// primitive that is not fully opaque with a transparent bxdf.
+func allDiffuseMaterials(optimizedScene *scene.Scene) bool {
+	if len(optimizedScene.PrimitiveOpacity) != 0 {
+		return false
+	}
+
+	for _, node := range optimizedScene.MaterialNodeList {
+		nodeType := uint32(node.Union1[0])
+		if !material.IsBxdfType(nodeType) {
+			continue
+		}
+
+		switch material.BxdfType(nodeType) {
+		case material.BxdfDiffuse, material.BxdfEmissive:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+)
+
+func TestAllDiffuseSceneDetection(t *testing.T) {
+	specs := []struct {
+		expressions   []string
+		expAllDiffuse bool
+	}{
+		{
+			[]string{
+				"diffuse(reflectance: {0.5, 0.5, 0.5})",
+				"mix(diffuse(reflectance: {0.1, 0.2, 0.3}), diffuse(), 0.5)",
+				"emissive(radiance: {1, 1, 1})",
+			},
+			true,
+		},
+		{
+			[]string{
+				"diffuse(reflectance: {0.5, 0.5, 0.5})",
+				"dielectric(intIOR: \"glass\")",
+				"emissive(radiance: {1, 1, 1})",
+			},
+			false,
+		},
+	}
+
+	for specIndex, spec := range specs {
+		ps := input.NewScene()
+		mesh := genTestMesh("mesh", len(spec.expressions), 0)
+		for matIndex, expr := range spec.expressions {
+			ps.Materials = append(ps.Materials, &input.Material{
+				Name:       expr,
+				Expression: expr,
+				Used:       true,
+			})
+			mesh.Primitives[matIndex].MaterialIndex = matIndex
+		}
+		ps.Meshes = []*input.Mesh{mesh}
+		ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+		sc, _, err := Compile(ps, DefaultOptions())
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		if sc.AllDiffuse != spec.expAllDiffuse {
+			t.Fatalf("[spec %d] expected AllDiffuse to be %t; got %t", specIndex, spec.expAllDiffuse, sc.AllDiffuse)
+		}
+	}
+}
+
+func TestAllDiffuseSceneDetectionWithPrimitiveOpacity(t *testing.T) {
+	mesh := genTestMesh("mesh", 2, 0)
+	mesh.Primitives[1].Transparency = 0.5
+
+	sc, _, err := Compile(genOpacityTestScene(mesh), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Primitives that are not fully opaque may be replaced by a
+	// transparent bxdf so the diffuse fast-path cannot be used
+	if len(sc.PrimitiveOpacity) == 0 {
+		t.Fatal("expected compiled scene to contain per-primitive opacity values")
+	}
+	if sc.AllDiffuse {
+		t.Fatal("expected scene with per-primitive opacity values not to be flagged as all-diffuse")
+	}
+}
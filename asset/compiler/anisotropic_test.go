@@ -0,0 +1,41 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+)
+
+func TestAnisotropicConductorRoughness(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "brushed",
+		Expression: "anisotropicConductor(specularity: {0.9, 0.9, 0.9}, roughnessU: 0.05, roughnessV: 0.6)",
+		Used:       true,
+	})
+	mesh := genTestMesh("mesh", 1, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, diagnostics, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := sc.MaterialNodeList[sc.MaterialRoots[0]]
+	if got := material.BxdfType(node.Union1[0]); got != material.BxdfAnisotropicConductor {
+		t.Fatalf("expected BxDF type to be %s; got %s", material.BxdfAnisotropicConductor, got)
+	}
+
+	// The tangent roughness is clamped to the min supported roughness
+	if node.Union4[2] != material.MinRoughness {
+		t.Fatalf("expected tangent roughness to be clamped to %v; got %v", material.MinRoughness, node.Union4[2])
+	}
+	if node.Union3[0] != 0.6 {
+		t.Fatalf("expected bi-tangent roughness to be 0.6; got %v", node.Union3[0])
+	}
+	if count := len(diagnostics.ForStage(StageMaterials)); count != 1 {
+		t.Fatalf("expected 1 roughness clamp warning; got %d", count)
+	}
+}
@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+const (
+	// The offset applied to AO ray origins along the vertex normal relative
+	// to the length of the mesh bbox diagonal.
+	vertexAORayOffset float32 = 1e-4
+)
+
+// A unique mesh vertex for the AO baking pass.
+type aoVertexKey struct {
+	position types.Vec3
+	normal   types.Vec3
+}
+
+// Bake the ambient occlusion of each vertex of the compiled scene meshes and
+// store it in the w coordinate of the vertex list entries. For each unique
+// vertex (position and normal pair) the pass shoots samples cosine-weighted
+// rays over the hemisphere around the vertex normal and records the fraction
+// of rays that hit the mesh within maxDist (0 for unbounded rays). A value of 0
+// indicates an unoccluded vertex. Occlusion is calculated against the mesh's
+// own geometry so it remains valid for every instance of the mesh.
+func (sc *sceneCompiler) bakeVertexAO(samples uint32, maxDist float32) {
+	if samples == 0 {
+		return
+	}
+
+	sc.logger.Noticef("baking vertex ambient occlusion using %d samples", samples)
+	directions := cosineHemisphereSamples(samples)
+	for meshIndex := range sc.optimizedScene.MeshRanges {
+		bakeMeshVertexAO(sc.optimizedScene, meshIndex, directions, maxDist)
+	}
+}
+
+// Bake the ambient occlusion of each vertex of a single compiled mesh using
+// the supplied set of hemisphere sample directions.
+func bakeMeshVertexAO(optimizedScene *scene.Scene, meshIndex int, directions []types.Vec3, maxDist float32) {
+	if maxDist <= 0 {
+		maxDist = math.MaxFloat32
+	}
+
+	meshRange := optimizedScene.MeshRanges[meshIndex]
+	root := optimizedScene.BvhNodeList[meshRange.BvhRoot]
+	rayOffset := root.Max.Sub(root.Min).Len() * vertexAORayOffset
+
+	first := 3 * meshRange.FirstPrimitive
+	last := 3 * (meshRange.FirstPrimitive + meshRange.PrimitiveCount)
+	occlusionCache := make(map[aoVertexKey]float32, 0)
+	for vertexIndex := first; vertexIndex < last; vertexIndex++ {
+		key := aoVertexKey{
+			position: optimizedScene.VertexList[vertexIndex].Vec3(),
+			normal:   optimizedScene.NormalList[vertexIndex].Vec3(),
+		}
+
+		occlusion, exists := occlusionCache[key]
+		if !exists {
+			normal := key.normal.Normalize()
+			if key.normal.Len() == 0 {
+				normal = optimizedScene.GeometricNormal(vertexIndex / 3).Normalize()
+			}
+			origin := key.position.Add(normal.Mul(rayOffset))
+			tangent, bitangent := tangentFrame(normal)
+
+			var hits int
+			for _, dir := range directions {
+				rayDir := tangent.Mul(dir[0]).Add(bitangent.Mul(dir[1])).Add(normal.Mul(dir[2]))
+				if optimizedScene.MeshOccluded(meshIndex, origin, rayDir, maxDist) {
+					hits++
+				}
+			}
+			occlusion = float32(hits) / float32(len(directions))
+			occlusionCache[key] = occlusion
+		}
+
+		optimizedScene.VertexList[vertexIndex][3] = occlusion
+	}
+}
+
+// Generate a set of cosine-weighted directions over the +Z hemisphere using a
+// Hammersley point set so that the baked occlusion is deterministic.
+func cosineHemisphereSamples(count uint32) []types.Vec3 {
+	directions := make([]types.Vec3, count)
+	for index := uint32(0); index < count; index++ {
+		u1 := (float64(index) + 0.5) / float64(count)
+		u2 := radicalInverse(index)
+
+		r := math.Sqrt(u1)
+		phi := 2 * math.Pi * u2
+		directions[index] = types.Vec3{
+			float32(r * math.Cos(phi)),
+			float32(r * math.Sin(phi)),
+			float32(math.Sqrt(math.Max(0, 1-u1))),
+		}
+	}
+	return directions
+}
+
+// Calculate the base-2 radical inverse of a value.
+func radicalInverse(value uint32) float64 {
+	value = (value << 16) | (value >> 16)
+	value = ((value & 0x55555555) << 1) | ((value & 0xAAAAAAAA) >> 1)
+	value = ((value & 0x33333333) << 2) | ((value & 0xCCCCCCCC) >> 2)
+	value = ((value & 0x0F0F0F0F) << 4) | ((value & 0xF0F0F0F0) >> 4)
+	value = ((value & 0x00FF00FF) << 8) | ((value & 0xFF00FF00) >> 8)
+	return float64(value) / (1 << 32)
+}
+
+// Build an orthonormal tangent frame around a normal vector.
+func tangentFrame(normal types.Vec3) (types.Vec3, types.Vec3) {
+	up := types.Vec3{0, 0, 1}
+	if math.Abs(float64(normal[2])) >= 0.999 {
+		up = types.Vec3{1, 0, 0}
+	}
+	tangent := up.Cross(normal).Normalize()
+	return tangent, normal.Cross(tangent)
+}
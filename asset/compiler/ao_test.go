@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestBakeVertexAO(t *testing.T) {
+	// An open box whose floor center lies deep inside the box and an
+	// exposed triangle floating above it.
+	floorCenter := types.Vec3{0, 0, 0}
+	exposedVertex := types.Vec3{0, 3, 0}
+
+	up := types.Vec3{0, 1, 0}
+	corners := []types.Vec3{{-1, 0, -1}, {1, 0, -1}, {1, 0, 1}, {-1, 0, 1}}
+	wallHeight := types.Vec3{0, 2, 0}
+
+	mesh := input.NewMesh("box")
+	addPrim := func(v0, v1, v2, normal types.Vec3) {
+		prim := &input.Primitive{
+			Vertices: [3]types.Vec3{v0, v1, v2},
+			Normals:  [3]types.Vec3{normal, normal, normal},
+		}
+		prim.SetBBox([2]types.Vec3{
+			types.MinVec3(v0, types.MinVec3(v1, v2)),
+			types.MaxVec3(v0, types.MaxVec3(v1, v2)),
+		})
+		prim.SetCenter(v0.Add(v1).Add(v2).Mul(1.0 / 3.0))
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+	for index, corner := range corners {
+		next := corners[(index+1)%len(corners)]
+		inward := floorCenter.Sub(corner.Add(next).Mul(0.5)).Normalize()
+
+		addPrim(floorCenter, corner, next, up)
+		addPrim(corner, next, next.Add(wallHeight), inward)
+		addPrim(corner, next.Add(wallHeight), corner.Add(wallHeight), inward)
+	}
+	addPrim(exposedVertex, exposedVertex.Add(types.Vec3{1, 0, 0}), exposedVertex.Add(types.Vec3{0, 0, 1}), up)
+	mesh.MarkBBoxDirty()
+
+	opts := DefaultOptions()
+	opts.VertexAOSamples = 64
+	sc, _, err := Compile(genOpacityTestScene(mesh), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vertexAO := func(position types.Vec3) float32 {
+		for _, vertex := range sc.VertexList {
+			if vertex.Vec3() == position {
+				return 1 - vertex[3]
+			}
+		}
+		t.Fatalf("vertex %v not found in compiled scene", position)
+		return 0
+	}
+
+	if ao := vertexAO(exposedVertex); ao != 1 {
+		t.Fatalf("expected exposed vertex AO to be 1; got %f", ao)
+	}
+	if ao := vertexAO(floorCenter); ao >= 0.5 {
+		t.Fatalf("expected vertex inside the box to be mostly occluded; got AO %f", ao)
+	}
+
+	// All copies of a vertex should share the same AO value
+	for _, vertex := range sc.VertexList {
+		if vertex.Vec3() == floorCenter && 1-vertex[3] != vertexAO(floorCenter) {
+			t.Fatalf("expected all copies of vertex %v to share the same AO", floorCenter)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package compiler
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMeshInstanceAttributes(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+
+	mesh := genTestMesh("mesh", 2, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+
+	attributes := [][]float32{
+		{12.5, 0.75},
+		// No attributes
+		nil,
+		{42},
+	}
+	for index, attrs := range attributes {
+		translation := types.Vec3{float32(2 * index), 0, 0}
+		mi := &input.MeshInstance{
+			MeshIndex:  0,
+			Transform:  types.Translate4(translation),
+			Attributes: attrs,
+		}
+		bbox := mesh.BBox()
+		mi.SetBBox([2]types.Vec3{bbox[0].Add(translation), bbox[1].Add(translation)})
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5).Add(translation))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = sc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := scene.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*scene.Scene{sc, loaded} {
+		if len(s.InstanceAttributeList) != 3 {
+			t.Fatalf("expected instance attribute list to contain 3 entries; got %d", len(s.InstanceAttributeList))
+		}
+		for index, expAttrs := range attributes {
+			if attrs := s.InstanceAttributes(uint32(index)); !reflect.DeepEqual(attrs, expAttrs) {
+				t.Fatalf("[instance %d] expected attributes to be %v; got %v", index, expAttrs, attrs)
+			}
+		}
+	}
+}
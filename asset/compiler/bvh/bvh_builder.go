@@ -2,6 +2,7 @@ package bvh
 
 import (
 	"math"
+	"sort"
 	"time"
 
 	"github.com/achilleasa/polaris/asset/scene"
@@ -24,11 +25,82 @@ const (
 	// is less than this threshold the BVH builder will not evaluate
 	// split candidates.
 	minSplitStep float32 = 1e-5
+
+	// The number of bins used by the SplitSAH strategy along each axis.
+	sahBinCount = 12
+)
+
+// The strategy used by the BVH builder for selecting the split plane of a node.
+type SplitStrategy uint8
+
+const (
+	// Sweep a set of split planes along each axis and pick the one with
+	// the best score as calculated by the build ScoreStrategy.
+	SplitSweep SplitStrategy = iota
+
+	// Split items at the median of their centers along the axis with the
+	// largest center extent. Nodes are split until they contain at most
+	// minLeafItems items.
+	SplitMedian
+
+	// Bin items along each axis by their centers and pick the bin boundary
+	// with the lowest surface area heuristic cost. A leaf is created if no
+	// split costs less than intersecting all node items.
+	SplitSAH
+)
+
+func (s SplitStrategy) String() string {
+	switch s {
+	case SplitSweep:
+		return "sweep"
+	case SplitMedian:
+		return "median"
+	case SplitSAH:
+		return "sah"
+	}
+
+	return "unknown"
+}
+
+// Options for tuning the BVH builder.
+type BuildOptions struct {
+	// The strategy for selecting node split planes.
+	SplitStrategy SplitStrategy
+
+	// The strategy for scoring split candidates when using SplitSweep. If
+	// not specified, SurfaceAreaHeuristic is used.
+	ScoreStrategy ScoreStrategy
+
+	// The SAH costs for traversing a node and intersecting a primitive
+	// used by SplitSAH.
+	TraversalCost    float32
+	IntersectionCost float32
+
+	// An optional collector for per-level tree metrics. The node costs
+	// reported by the collector are calculated using the SAH costs above.
+	Metrics *BuildMetrics
+}
+
+// Get the default BVH build options.
+func DefaultBuildOptions() BuildOptions {
+	return BuildOptions{
+		SplitStrategy:    SplitSweep,
+		ScoreStrategy:    SurfaceAreaHeuristic,
+		TraversalCost:    DefaultTraversalCost,
+		IntersectionCost: DefaultIntersectionCost,
+	}
+}
+
+const (
+	// Default SAH costs for traversing a node and intersecting a primitive.
+	DefaultTraversalCost    float32 = 1.0
+	DefaultIntersectionCost float32 = 1.0
 )
 
 var (
-	// A split scoring strategy that uses the surface area heuristic (SAH).
-	SurfaceAreaHeuristic = surfaceAreaHeuristic{}
+	// A split scoring strategy that uses the surface area heuristic (SAH)
+	// with the default traversal and intersection costs.
+	SurfaceAreaHeuristic = NewSurfaceAreaHeuristic(DefaultTraversalCost, DefaultIntersectionCost)
 )
 
 // The BoundedVolume interface is implemented by all meshes/primitives that can
@@ -58,12 +130,89 @@ type splitScore struct {
 	score                 float32
 }
 
-type stats struct {
-	partitionedItems int
-	totalItems       int
-	nodes            int
-	leafs            int
-	maxDepth         int
+// Check whether a split candidate precedes another candidate with the same
+// score in axis and split point order.
+func (s *splitScore) precedes(other *splitScore) bool {
+	if s.axis != other.axis {
+		return s.axis < other.axis
+	}
+	return s.splitPoint < other.splitPoint
+}
+
+// Statistics about a generated BVH tree.
+type Stats struct {
+	// The total number of tree nodes (including leafs) and the number of leafs.
+	Nodes int `json:"nodes"`
+	Leafs int `json:"leafs"`
+
+	// The depth of the deepest tree node. The root node has depth 0.
+	MaxDepth int `json:"max_depth"`
+
+	// The total number of items stored in the tree leafs.
+	Items int `json:"items"`
+
+	// The min, max and average number of items per leaf.
+	MinLeafItems int     `json:"min_leaf_items"`
+	MaxLeafItems int     `json:"max_leaf_items"`
+	AvgLeafItems float32 `json:"avg_leaf_items"`
+}
+
+// Collect statistics for an existing BVH tree rooted at the given node. If
+// topLevel is set, the tree leafs are expected to reference mesh instances
+// instead of primitives.
+func TreeStats(nodes []scene.BvhNode, root uint32, topLevel bool) Stats {
+	var stats Stats
+	stats.collect(nodes, root, 0, topLevel)
+	stats.finalize()
+	return stats
+}
+
+// Recursively visit a BVH tree and collect its statistics.
+func (s *Stats) collect(nodes []scene.BvhNode, nodeIndex uint32, depth int, topLevel bool) {
+	node := nodes[nodeIndex]
+	s.addNode(depth)
+
+	if node.LData <= 0 {
+		var count uint32
+		if topLevel {
+			_, count = node.GetMeshInstances()
+		} else {
+			_, count = node.GetPrimitives()
+		}
+		s.addLeaf(int(count))
+		return
+	}
+
+	s.collect(nodes, uint32(node.LData), depth+1, topLevel)
+	s.collect(nodes, uint32(node.RData), depth+1, topLevel)
+}
+
+// Record a tree node at the given depth.
+func (s *Stats) addNode(depth int) {
+	s.Nodes++
+	if depth > s.MaxDepth {
+		s.MaxDepth = depth
+	}
+}
+
+// Record a leaf containing the given number of items. Leafs must also be
+// recorded as nodes via addNode.
+func (s *Stats) addLeaf(items int) {
+	s.Leafs++
+	s.Items += items
+	if s.Leafs == 1 || items < s.MinLeafItems {
+		s.MinLeafItems = items
+	}
+	if items > s.MaxLeafItems {
+		s.MaxLeafItems = items
+	}
+}
+
+// Calculate the derived statistics once all tree nodes have been recorded.
+func (s *Stats) finalize() {
+	if s.Leafs != 0 {
+		s.AvgLeafItems = float32(s.Items) / float32(s.Leafs)
+	}
 }
 
 type builder struct {
@@ -82,11 +231,11 @@ type builder struct {
 	// A channel for receiving score results.
 	scoreChan chan splitScore
 
-	// The split scoring strategy to use.
-	scoreStrategy ScoreStrategy
+	// The build options.
+	opts BuildOptions
 
 	// Stats
-	stats stats
+	stats Stats
 }
 
 // Construct a BVH from a set of bounded volumes.
@@ -96,36 +245,49 @@ type builder struct {
 //
 // The minLeafItems param should be used to specified the minimum number of
 // items that can form a leaf. The BVH builder will automatically generate leafs
-// if the incoming work length is <= minLeafItems.
+// if the incoming work length is <= minLeafItems without scoring any splits.
 func Build(workList []BoundedVolume, minLeafItems int, leafCb LeafCallback, scoreStrategy ScoreStrategy) []scene.BvhNode {
+	opts := DefaultBuildOptions()
+	opts.ScoreStrategy = scoreStrategy
+	return BuildWithOptions(workList, minLeafItems, opts, leafCb)
+}
+
+// Construct a BVH from a set of bounded volumes using the split strategy
+// specified by the supplied build options.
+func BuildWithOptions(workList []BoundedVolume, minLeafItems int, opts BuildOptions, leafCb LeafCallback) []scene.BvhNode {
+	nodes, _ := BuildWithStats(workList, minLeafItems, opts, leafCb)
+	return nodes
+}
+
+// Construct a BVH from a set of bounded volumes using the supplied build
+// options and return the generated nodes together with the tree statistics.
+func BuildWithStats(workList []BoundedVolume, minLeafItems int, opts BuildOptions, leafCb LeafCallback) ([]scene.BvhNode, Stats) {
+	if opts.ScoreStrategy == nil {
+		opts.ScoreStrategy = SurfaceAreaHeuristic
+	}
+
 	b := &builder{
-		logger:        log.New("builder"),
-		nodes:         make([]scene.BvhNode, 0),
-		leafCb:        leafCb,
-		minLeafItems:  minLeafItems,
-		scoreChan:     make(chan splitScore, 0),
-		scoreStrategy: scoreStrategy,
-		stats: stats{
-			totalItems: len(workList),
-		},
+		logger:       log.New("builder"),
+		nodes:        make([]scene.BvhNode, 0),
+		leafCb:       leafCb,
+		minLeafItems: minLeafItems,
+		scoreChan:    make(chan splitScore, 0),
+		opts:         opts,
 	}
 
 	start := time.Now()
 	b.partition(workList, 0)
 	b.logger.Debugf(
-		"BVH tree build time: %d ms, maxDepth: %d, nodes: %d, leafs: %d\n",
-		time.Since(start).Nanoseconds()/1e6,
-		b.stats.maxDepth, b.stats.nodes, b.stats.leafs,
+		"BVH tree build time: %d ms, strategy: %s, maxDepth: %d, nodes: %d, leafs: %d\n",
+		time.Since(start).Nanoseconds()/1e6, opts.SplitStrategy,
+		b.stats.MaxDepth, b.stats.Nodes, b.stats.Leafs,
 	)
-	return b.nodes
+	b.stats.finalize()
+	return b.nodes, b.stats
 }
 
 // Partition worklist and return node index.
 func (b *builder) partition(workList []BoundedVolume, depth int) uint32 {
-	if depth > b.stats.maxDepth {
-		b.stats.maxDepth = depth
-	}
-
 	node := scene.BvhNode{
 		Min: types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
 		Max: types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
@@ -139,12 +301,63 @@ func (b *builder) partition(workList []BoundedVolume, depth int) uint32 {
 	}
 
 	// Do we have enough items for partitioning? If not create a leaf
+	// right away without evaluating any split candidates.
 	if len(workList) <= b.minLeafItems {
-		return b.createLeaf(&node, workList)
+		return b.createLeaf(&node, workList, depth)
+	}
+
+	var bestSplit *splitScore
+	switch b.opts.SplitStrategy {
+	case SplitMedian:
+		bestSplit = medianSplit(workList)
+	case SplitSAH:
+		bestSplit = b.binnedSAHSplit(workList, &node)
+	default:
+		bestSplit = b.sweepSplit(workList, &node, depth)
+	}
+
+	// If we can't find a split that improves the current node score create a leaf
+	if bestSplit == nil {
+		return b.createLeaf(&node, workList, depth)
+	}
+
+	// split work list into two sets
+	leftWorkList := make([]BoundedVolume, 0, bestSplit.leftCount)
+	rightWorkList := make([]BoundedVolume, 0, bestSplit.rightCount)
+	for _, item := range workList {
+		center := item.Center()
+		if center[bestSplit.axis] < bestSplit.splitPoint {
+			leftWorkList = append(leftWorkList, item)
+		} else {
+			rightWorkList = append(rightWorkList, item)
+		}
+	}
+	if len(leftWorkList) == 0 || len(rightWorkList) == 0 {
+		return b.createLeaf(&node, workList, depth)
+	}
+
+	// Add node to list
+	nodeIndex := len(b.nodes)
+	b.nodes = append(b.nodes, node)
+	b.stats.addNode(depth)
+	if b.opts.Metrics != nil {
+		b.opts.Metrics.recordInnerNode(depth, &node, bestSplit.axis, &b.opts)
 	}
 
+	// Partition children and update node indices
+	leftNodeIndex := b.partition(leftWorkList, depth+1)
+	rightNodeIndex := b.partition(rightWorkList, depth+1)
+	b.nodes[nodeIndex].SetChildNodes(leftNodeIndex, rightNodeIndex)
+
+	return uint32(nodeIndex)
+}
+
+// Evaluate split planes along each axis using the build score strategy and
+// return the split with the best score or nil if no split improves the score
+// of the node.
+func (b *builder) sweepSplit(workList []BoundedVolume, node *scene.BvhNode, depth int) *splitScore {
 	// Calc current node score
-	var bestScore float32 = b.scoreStrategy.ScorePartition(workList)
+	var bestScore float32 = b.opts.ScoreStrategy.ScorePartition(workList)
 	var bestSplit *splitScore = nil
 
 	// Try partioning along each axis and select the split with best score
@@ -167,7 +380,7 @@ func (b *builder) partition(workList []BoundedVolume, depth int) uint32 {
 		for splitPoint := node.Min[axis]; splitPoint < node.Max[axis]; splitPoint += splitStep {
 			pendingScores++
 			go func(axis Axis, splitPoint float32) {
-				lCount, rCount, score := b.scoreStrategy.ScoreSplit(workList, axis, splitPoint)
+				lCount, rCount, score := b.opts.ScoreStrategy.ScoreSplit(workList, axis, splitPoint)
 				b.scoreChan <- splitScore{
 					axis:       axis,
 					splitPoint: splitPoint,
@@ -180,52 +393,183 @@ func (b *builder) partition(workList []BoundedVolume, depth int) uint32 {
 		}
 	}
 
-	// Process all scores and pick the best split
+	// Process all scores and pick the best split. Scores arrive in
+	// arbitrary order so ties are broken by axis and split point to
+	// ensure that the generated tree is deterministic.
 	for ; pendingScores > 0; pendingScores-- {
 		candidate := <-b.scoreChan
-		if candidate.score < bestScore {
+		if candidate.score < bestScore || (bestSplit != nil && candidate.score == bestScore && candidate.precedes(bestSplit)) {
 			bestScore = candidate.score
 			bestSplit = &candidate
 		}
 	}
 
-	// If we can't find a split that improves the current node score create a leaf
-	if bestSplit == nil {
-		return b.createLeaf(&node, workList)
+	return bestSplit
+}
+
+// Split work list items at the median of their centers along the axis with
+// the largest center extent. Returns nil if the item centers coincide.
+func medianSplit(workList []BoundedVolume) *splitScore {
+	cmin, cmax := centerBounds(workList)
+	extent := cmax.Sub(cmin)
+	axis := XAxis
+	if extent[YAxis] > extent[axis] {
+		axis = YAxis
+	}
+	if extent[ZAxis] > extent[axis] {
+		axis = ZAxis
+	}
+	if extent[axis] <= 0 {
+		return nil
 	}
 
-	// split work list into two sets
-	leftWorkList := make([]BoundedVolume, bestSplit.leftCount)
-	rightWorkList := make([]BoundedVolume, bestSplit.rightCount)
-	leftIndex := 0
-	rightIndex := 0
-	for _, item := range workList {
-		center := item.Center()
-		if center[bestSplit.axis] < bestSplit.splitPoint {
-			leftWorkList[leftIndex] = item
-			leftIndex++
+	centers := make([]float64, len(workList))
+	for index, item := range workList {
+		centers[index] = float64(item.Center()[axis])
+	}
+	sort.Float64s(centers)
+
+	// Items with a center less than the split point are placed on the
+	// left. If the median equals the smallest center the left partition
+	// would be empty so split at the next larger center instead.
+	splitPoint := float32(centers[len(centers)/2])
+	if splitPoint == float32(centers[0]) {
+		for _, center := range centers {
+			if float32(center) > splitPoint {
+				splitPoint = float32(center)
+				break
+			}
+		}
+	}
+
+	split := &splitScore{axis: axis, splitPoint: splitPoint}
+	for _, center := range centers {
+		if float32(center) < splitPoint {
+			split.leftCount++
 		} else {
-			rightWorkList[rightIndex] = item
-			rightIndex++
+			split.rightCount++
 		}
 	}
+	return split
+}
 
-	// Add node to list
-	nodeIndex := len(b.nodes)
-	b.nodes = append(b.nodes, node)
-	b.stats.nodes++
+// Bin work list items by their centers along each axis and evaluate the SAH
+// cost of splitting at each bin boundary:
+//
+// cost = traversal cost +
+// intersection cost * (left area * left count + right area * right count) / node area
+//
+// Returns the cheapest split or nil if no split costs less than creating a
+// leaf (intersection cost * item count).
+func (b *builder) binnedSAHSplit(workList []BoundedVolume, node *scene.BvhNode) *splitScore {
+	nodeArea := surfaceArea(node.Min, node.Max)
+	if nodeArea <= 0 {
+		// Degenerate node; SAH costs are undefined so fall back to a
+		// median split.
+		return medianSplit(workList)
+	}
 
-	// Partition children and update node indices
-	leftNodeIndex := b.partition(leftWorkList, depth+1)
-	rightNodeIndex := b.partition(rightWorkList, depth+1)
-	b.nodes[nodeIndex].SetChildNodes(leftNodeIndex, rightNodeIndex)
+	type bin struct {
+		count    int
+		min, max types.Vec3
+	}
 
-	return uint32(nodeIndex)
+	cmin, cmax := centerBounds(workList)
+	extent := cmax.Sub(cmin)
+
+	bestCost := b.opts.IntersectionCost * float32(len(workList))
+	var bestSplit *splitScore
+	for axis := XAxis; axis <= ZAxis; axis++ {
+		if extent[axis] < minSideLength {
+			continue
+		}
+
+		var bins [sahBinCount]bin
+		for index := range bins {
+			bins[index].min = types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+			bins[index].max = types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+		}
+
+		scale := float32(sahBinCount) / extent[axis]
+		for _, item := range workList {
+			binIndex := int((item.Center()[axis] - cmin[axis]) * scale)
+			if binIndex >= sahBinCount {
+				binIndex = sahBinCount - 1
+			}
+			itemBBox := item.BBox()
+			bins[binIndex].count++
+			bins[binIndex].min = types.MinVec3(bins[binIndex].min, itemBBox[0])
+			bins[binIndex].max = types.MaxVec3(bins[binIndex].max, itemBBox[1])
+		}
+
+		// Sweep bins from the right to calculate the area and item count
+		// to the right of each bin boundary.
+		var rightArea [sahBinCount - 1]float32
+		var rightCount [sahBinCount - 1]int
+		acc := bin{
+			min: types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+			max: types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+		}
+		for index := sahBinCount - 1; index > 0; index-- {
+			acc.count += bins[index].count
+			acc.min = types.MinVec3(acc.min, bins[index].min)
+			acc.max = types.MaxVec3(acc.max, bins[index].max)
+			rightCount[index-1] = acc.count
+			rightArea[index-1] = surfaceArea(acc.min, acc.max)
+		}
+
+		// Sweep bins from the left and score each boundary
+		acc = bin{
+			min: types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+			max: types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+		}
+		for index := 0; index < sahBinCount-1; index++ {
+			acc.count += bins[index].count
+			acc.min = types.MinVec3(acc.min, bins[index].min)
+			acc.max = types.MaxVec3(acc.max, bins[index].max)
+			if acc.count == 0 || rightCount[index] == 0 {
+				continue
+			}
+
+			cost := b.opts.TraversalCost +
+				b.opts.IntersectionCost*(surfaceArea(acc.min, acc.max)*float32(acc.count)+rightArea[index]*float32(rightCount[index]))/nodeArea
+			if cost < bestCost {
+				bestCost = cost
+				bestSplit = &splitScore{
+					axis:       axis,
+					splitPoint: cmin[axis] + float32(index+1)/scale,
+					leftCount:  acc.count,
+					rightCount: rightCount[index],
+					score:      cost,
+				}
+			}
+		}
+	}
+
+	return bestSplit
+}
+
+// Calculate the bounds of the centers of the work list items.
+func centerBounds(workList []BoundedVolume) (min, max types.Vec3) {
+	min = types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	max = types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	for _, item := range workList {
+		center := item.Center()
+		min = types.MinVec3(min, center)
+		max = types.MaxVec3(max, center)
+	}
+	return min, max
+}
+
+// Calculate half the surface area of a bounding box.
+func surfaceArea(min, max types.Vec3) float32 {
+	side := max.Sub(min)
+	return side[0]*side[1] + side[1]*side[2] + side[0]*side[2]
 }
 
 // Setup the given node item as a leaf node containing all items in the work list.
 // Returns the index to the node in the bvh node array.
-func (b *builder) createLeaf(node *scene.BvhNode, workList []BoundedVolume) uint32 {
+func (b *builder) createLeaf(node *scene.BvhNode, workList []BoundedVolume, depth int) uint32 {
 	b.leafCb(node, workList)
 
 	// append node to list
@@ -233,19 +577,39 @@ func (b *builder) createLeaf(node *scene.BvhNode, workList []BoundedVolume) uint
 	b.nodes = append(b.nodes, *node)
 
 	// update stats
-	b.stats.leafs++
-	b.stats.partitionedItems += len(workList)
+	b.stats.addNode(depth)
+	b.stats.addLeaf(len(workList))
+	if b.opts.Metrics != nil {
+		b.opts.Metrics.recordLeaf(depth, node, len(workList), &b.opts)
+	}
 
 	return uint32(nodeIndex)
 }
 
 // A score implementation that uses surface area heuristic for calculating split scores.
-type surfaceAreaHeuristic struct{}
+type surfaceAreaHeuristic struct {
+	// The cost of traversing a BVH node.
+	traversalCost float32
+
+	// The cost of intersecting a primitive.
+	intersectionCost float32
+}
+
+// Create a SAH split scoring strategy using the supplied cost model. The ratio
+// of traversal to intersection cost controls the tree shape; a higher
+// intersection cost favors splitting and produces smaller leafs.
+func NewSurfaceAreaHeuristic(traversalCost, intersectionCost float32) ScoreStrategy {
+	return surfaceAreaHeuristic{
+		traversalCost:    traversalCost,
+		intersectionCost: intersectionCost,
+	}
+}
 
 // Score a BVH split based on the surface area heuristic. The SAH calculates
 // the split score using the formula (lower score is better):
 //
-// left count * left BBOX area + rightCount * right BBOX area.
+// traversal cost * node BBOX area +
+// intersection cost * (left count * left BBOX area + rightCount * right BBOX area).
 //
 // SAH avoids splits that generate empty partitions by assigning the worst
 // possible score (MaxFloat32) when it enounters such cases.
@@ -278,14 +642,16 @@ func (h surfaceAreaHeuristic) ScoreSplit(workList []BoundedVolume, axis Axis, sp
 
 	lside := lmax.Sub(lmin)
 	rside := rmax.Sub(rmin)
-	score = (float32(leftCount) * (lside[0]*lside[1] + lside[1]*lside[2] + lside[0]*lside[2])) +
-		(float32(rightCount) * (rside[0]*rside[1] + rside[1]*rside[2] + rside[0]*rside[2]))
+	side := types.MaxVec3(lmax, rmax).Sub(types.MinVec3(lmin, rmin))
+	score = h.traversalCost*(side[0]*side[1]+side[1]*side[2]+side[0]*side[2]) +
+		h.intersectionCost*((float32(leftCount)*(lside[0]*lside[1]+lside[1]*lside[2]+lside[0]*lside[2]))+
+			(float32(rightCount)*(rside[0]*rside[1]+rside[1]*rside[2]+rside[0]*rside[2])))
 
 	return leftCount, rightCount, score
 }
 
 // Calculate score for a partitioned workList using formula:
-// count * BBOX area
+// intersection cost * count * BBOX area
 //
 // If the workList is empty, then this method returns the worst possible
 // score (MaxFloat32).
@@ -304,5 +670,5 @@ func (h surfaceAreaHeuristic) ScorePartition(workList []BoundedVolume) (score fl
 	}
 
 	side := max.Sub(min)
-	return float32(len(workList)) * (side[0]*side[1] + side[1]*side[2] + side[0]*side[2])
+	return h.intersectionCost * float32(len(workList)) * (side[0]*side[1] + side[1]*side[2] + side[0]*side[2])
 }
@@ -1,9 +1,13 @@
 package bvh
 
 import (
+	"math"
+	"reflect"
+	"sync/atomic"
 	"testing"
 
-	"github.com/achilleasa/polaris/scene"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
 	"github.com/achilleasa/polaris/types"
 )
 
@@ -22,7 +26,7 @@ func TestLeafCallback(t *testing.T) {
 
 	itemList := make([]BoundedVolume, len(primSpecs))
 	for idx, ps := range primSpecs {
-		inst := &scene.ParsedMeshInstance{}
+		inst := &input.MeshInstance{}
 		inst.SetBBox([2]types.Vec3{ps.min, ps.max})
 		inst.SetCenter(ps.min.Add(ps.max).Mul(0.5))
 		itemList[idx] = inst
@@ -67,3 +71,279 @@ func TestLeafCallback(t *testing.T) {
 		t.Fatalf("expected bvh tree to have %d nodes; got %d", expCount, len(treeNodes))
 	}
 }
+
+type testVolume struct {
+	bbox [2]types.Vec3
+}
+
+func (v *testVolume) BBox() [2]types.Vec3 {
+	return v.bbox
+}
+
+func (v *testVolume) Center() types.Vec3 {
+	return v.bbox[0].Add(v.bbox[1]).Mul(0.5)
+}
+
+// A score strategy that counts the number of evaluated splits.
+type countingScoreStrategy struct {
+	splits     int32
+	partitions int32
+}
+
+func (s *countingScoreStrategy) ScoreSplit(workList []BoundedVolume, splitAxis Axis, splitPoint float32) (leftCount, rightCount int, score float32) {
+	atomic.AddInt32(&s.splits, 1)
+	return SurfaceAreaHeuristic.ScoreSplit(workList, splitAxis, splitPoint)
+}
+
+func (s *countingScoreStrategy) ScorePartition(workList []BoundedVolume) (score float32) {
+	atomic.AddInt32(&s.partitions, 1)
+	return SurfaceAreaHeuristic.ScorePartition(workList)
+}
+
+func TestMinLeafItemsShortCircuit(t *testing.T) {
+	itemList := make([]BoundedVolume, 5)
+	for index := range itemList {
+		x := float32(index) * 2
+		itemList[index] = &testVolume{
+			bbox: [2]types.Vec3{{x, 0, 0}, {x + 1, 1, 1}},
+		}
+	}
+
+	var leafCount, leafItems int
+	cb := func(leaf *scene.BvhNode, workList []BoundedVolume) {
+		leafCount++
+		leafItems = len(workList)
+	}
+
+	strategy := &countingScoreStrategy{}
+	nodes := Build(itemList, 10, cb, strategy)
+
+	if len(nodes) != 1 {
+		t.Fatalf("expected BVH to contain a single node; got %d", len(nodes))
+	}
+	if leafCount != 1 || leafItems != len(itemList) {
+		t.Fatalf("expected a single leaf with %d items; got %d leafs with %d items", len(itemList), leafCount, leafItems)
+	}
+	if strategy.splits != 0 || strategy.partitions != 0 {
+		t.Fatalf("expected no split evaluations; got %d split and %d partition evaluations", strategy.splits, strategy.partitions)
+	}
+
+	expBBox := [2]types.Vec3{{0, 0, 0}, {9, 1, 1}}
+	if nodes[0].Min != expBBox[0] || nodes[0].Max != expBBox[1] {
+		t.Fatalf("expected leaf bbox to be %v; got [%v, %v]", expBBox, nodes[0].Min, nodes[0].Max)
+	}
+
+	// Items above the threshold should still be partitioned
+	strategy = &countingScoreStrategy{}
+	Build(itemList, 1, cb, strategy)
+	if strategy.splits == 0 {
+		t.Fatal("expected split candidates to be evaluated when the item count exceeds the leaf threshold")
+	}
+}
+
+func TestSurfaceAreaHeuristicCosts(t *testing.T) {
+	itemList := make([]BoundedVolume, 16)
+	for index := range itemList {
+		x := float32(index)
+		itemList[index] = &testVolume{
+			bbox: [2]types.Vec3{{x, 0, 0}, {x + 1, 1, 1}},
+		}
+	}
+
+	avgLeafSize := func(strategy ScoreStrategy) float32 {
+		var leafCount, leafItems int
+		Build(itemList, 1, func(leaf *scene.BvhNode, workList []BoundedVolume) {
+			leafCount++
+			leafItems += len(workList)
+		}, strategy)
+		return float32(leafItems) / float32(leafCount)
+	}
+
+	defaultSize := avgLeafSize(SurfaceAreaHeuristic)
+	expensiveIntersectionSize := avgLeafSize(NewSurfaceAreaHeuristic(1, 10))
+	if expensiveIntersectionSize >= defaultSize {
+		t.Fatalf("expected raising the intersection cost to yield smaller leafs; got avg leaf size %f (default: %f)", expensiveIntersectionSize, defaultSize)
+	}
+	if expensiveIntersectionSize != 1 {
+		t.Fatalf("expected each item to be placed in its own leaf; got avg leaf size %f", expensiveIntersectionSize)
+	}
+}
+
+func TestSplitStrategies(t *testing.T) {
+	// A dense cluster of overlapping items and a few distant outliers
+	itemList := make([]BoundedVolume, 0)
+	for index := 0; index < 48; index++ {
+		x := float32(index%4) * 0.1
+		y := float32(index/4%4) * 0.1
+		z := float32(index/16) * 0.1
+		itemList = append(itemList, &testVolume{
+			bbox: [2]types.Vec3{{x, y, z}, {x + 1, y + 1, z + 1}},
+		})
+	}
+	for index := 0; index < 4; index++ {
+		x := 100 + float32(index)*50
+		itemList = append(itemList, &testVolume{
+			bbox: [2]types.Vec3{{x, 0, 0}, {x + 1, 1, 1}},
+		})
+	}
+
+	build := func(strategy SplitStrategy) (nodes []scene.BvhNode, leafItems int) {
+		opts := DefaultBuildOptions()
+		opts.SplitStrategy = strategy
+		nodes = BuildWithOptions(itemList, 1, opts, func(leaf *scene.BvhNode, workList []BoundedVolume) {
+			leafItems += len(workList)
+		})
+		return nodes, leafItems
+	}
+
+	medianNodes, medianItems := build(SplitMedian)
+	sahNodes, sahItems := build(SplitSAH)
+
+	for _, count := range []int{medianItems, sahItems} {
+		if count != len(itemList) {
+			t.Fatalf("expected leafs to contain %d items; got %d", len(itemList), count)
+		}
+	}
+	if expCount := 2*len(itemList) - 1; len(medianNodes) != expCount {
+		t.Fatalf("expected median split to generate %d nodes; got %d", expCount, len(medianNodes))
+	}
+	if len(sahNodes) >= len(medianNodes) {
+		t.Fatalf("expected SAH split to generate fewer nodes than median split; got %d (median: %d)", len(sahNodes), len(medianNodes))
+	}
+	if sahDepth, medianDepth := treeDepth(sahNodes, 0), treeDepth(medianNodes, 0); sahDepth >= medianDepth {
+		t.Fatalf("expected SAH tree to be shallower than median tree; got depth %d (median: %d)", sahDepth, medianDepth)
+	}
+}
+
+func TestBinnedSAHLeafFallback(t *testing.T) {
+	// Fully overlapping items cannot be split into cheaper partitions
+	itemList := make([]BoundedVolume, 8)
+	for index := range itemList {
+		offset := float32(index) * 0.01
+		itemList[index] = &testVolume{
+			bbox: [2]types.Vec3{{offset, 0, 0}, {offset + 1, 1, 1}},
+		}
+	}
+
+	opts := DefaultBuildOptions()
+	opts.SplitStrategy = SplitSAH
+	nodes := BuildWithOptions(itemList, 1, opts, func(leaf *scene.BvhNode, workList []BoundedVolume) {})
+	if len(nodes) != 1 {
+		t.Fatalf("expected SAH split to create a single leaf; got %d nodes", len(nodes))
+	}
+}
+
+func treeDepth(nodes []scene.BvhNode, nodeIndex int32) int {
+	node := nodes[nodeIndex]
+	if node.LData <= 0 {
+		return 1
+	}
+
+	leftDepth := treeDepth(nodes, node.LData)
+	rightDepth := treeDepth(nodes, node.RData)
+	if leftDepth > rightDepth {
+		return leftDepth + 1
+	}
+	return rightDepth + 1
+}
+
+func TestBuildStats(t *testing.T) {
+	itemList := make([]BoundedVolume, 4)
+	for index := range itemList {
+		x := float32(index) * 4
+		itemList[index] = &testVolume{
+			bbox: [2]types.Vec3{{x, 0, 0}, {x + 1, 1, 1}},
+		}
+	}
+
+	nodes, stats := BuildWithStats(itemList, 1, DefaultBuildOptions(), func(leaf *scene.BvhNode, workList []BoundedVolume) {})
+	expStats := Stats{
+		Nodes:        7,
+		Leafs:        4,
+		MaxDepth:     2,
+		Items:        4,
+		MinLeafItems: 1,
+		MaxLeafItems: 1,
+		AvgLeafItems: 1,
+	}
+	if stats != expStats {
+		t.Fatalf("expected build stats to be %+v; got %+v", expStats, stats)
+	}
+	if len(nodes) != stats.Nodes {
+		t.Fatalf("expected stats node count to match the %d generated nodes", len(nodes))
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	itemList := make([]BoundedVolume, 9)
+	for index := range itemList {
+		x := float32(index*index) * 4
+		itemList[index] = &testVolume{
+			bbox: [2]types.Vec3{{x, 0, 0}, {x + 1, 1, 1}},
+		}
+	}
+
+	leafCb := func(leaf *scene.BvhNode, workList []BoundedVolume) {
+		leaf.SetPrimitives(0, uint32(len(workList)))
+	}
+	nodes, expStats := BuildWithStats(itemList, 2, DefaultBuildOptions(), leafCb)
+
+	stats := TreeStats(nodes, 0, false)
+	if stats != expStats {
+		t.Fatalf("expected tree stats to match the build stats %+v; got %+v", expStats, stats)
+	}
+}
+
+func TestBuildMetrics(t *testing.T) {
+	itemList := make([]BoundedVolume, 4)
+	for index := range itemList {
+		x := float32(index) * 4
+		itemList[index] = &testVolume{
+			bbox: [2]types.Vec3{{x, 0, 0}, {x + 1, 1, 1}},
+		}
+	}
+
+	noopCb := func(leaf *scene.BvhNode, workList []BoundedVolume) {}
+	opts := DefaultBuildOptions()
+	expNodes := BuildWithOptions(itemList, 1, opts, noopCb)
+
+	opts.Metrics = NewBuildMetrics()
+	nodes := BuildWithOptions(itemList, 1, opts, noopCb)
+	if !reflect.DeepEqual(nodes, expNodes) {
+		t.Fatal("expected collecting build metrics to not affect the generated tree")
+	}
+
+	// Items are spread along the X axis so the builder should generate a
+	// balanced tree by splitting along X
+	expLevels := []struct {
+		nodes, leafs int
+		splitAxes    [3]int
+	}{
+		{1, 0, [3]int{1, 0, 0}},
+		{2, 0, [3]int{2, 0, 0}},
+		{4, 4, [3]int{0, 0, 0}},
+	}
+	metrics := opts.Metrics
+	if len(metrics.Levels) != len(expLevels) {
+		t.Fatalf("expected metrics for %d levels; got %d", len(expLevels), len(metrics.Levels))
+	}
+	for depth, exp := range expLevels {
+		level := metrics.Levels[depth]
+		if level.Nodes != exp.nodes || level.Leafs != exp.leafs || level.SplitAxes != exp.splitAxes {
+			t.Errorf("[level %d] expected %d nodes, %d leafs and split axes %v; got %d nodes, %d leafs and split axes %v", depth, exp.nodes, exp.leafs, exp.splitAxes, level.Nodes, level.Leafs, level.SplitAxes)
+		}
+	}
+
+	// The root node cost is the traversal cost as node costs are weighted
+	// by their area relative to the root area
+	if cost := metrics.Levels[0].AvgSAHCost; cost != DefaultTraversalCost {
+		t.Fatalf("expected root level SAH cost to be %f; got %f", DefaultTraversalCost, cost)
+	}
+	var expCost float32
+	for _, level := range metrics.Levels {
+		expCost += level.AvgSAHCost * float32(level.Nodes)
+	}
+	if cost := metrics.SAHCost(); math.Abs(float64(cost-expCost)) > 1e-5 {
+		t.Fatalf("expected tree SAH cost to be %f; got %f", expCost, cost)
+	}
+}
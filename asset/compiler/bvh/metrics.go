@@ -0,0 +1,119 @@
+package bvh
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Statistics about the nodes at a particular BVH tree level.
+type LevelMetrics struct {
+	// The number of nodes (including leafs) and the number of leafs at
+	// this level.
+	Nodes int
+	Leafs int
+
+	// The average SAH cost of the level nodes. The cost of each node is
+	// weighted by the ratio of its surface area to the surface area of the
+	// root node so the sum of the costs of all tree nodes yields the SAH
+	// cost of the tree.
+	AvgSAHCost float32
+
+	// The number of inner nodes that were split along each axis.
+	SplitAxes [3]int
+
+	// The sum of the weighted SAH costs of the level nodes.
+	sahCost float64
+}
+
+// A collector for per-level statistics about a BVH tree while it is being
+// built. Collecting metrics does not affect the generated tree. A collector
+// may be reused for multiple builds in which case the metrics of each build
+// are merged; it must not be shared between concurrent builds.
+type BuildMetrics struct {
+	// Metrics for each tree level. The root node is at level 0.
+	Levels []LevelMetrics
+
+	// The surface area of the root node of the last build.
+	rootArea float32
+}
+
+// Create a new build metrics collector.
+func NewBuildMetrics() *BuildMetrics {
+	return &BuildMetrics{
+		Levels: make([]LevelMetrics, 0),
+	}
+}
+
+// Get the SAH cost of the built trees.
+func (m *BuildMetrics) SAHCost() float32 {
+	var cost float64
+	for _, level := range m.Levels {
+		cost += level.sahCost
+	}
+	return float32(cost)
+}
+
+// Record an inner node that was split along the given axis.
+func (m *BuildMetrics) recordInnerNode(depth int, node *scene.BvhNode, axis Axis, opts *BuildOptions) {
+	level := m.level(depth, node)
+	level.SplitAxes[axis]++
+	m.addNodeCost(level, opts.TraversalCost*surfaceArea(node.Min, node.Max))
+}
+
+// Record a leaf node containing the given number of items.
+func (m *BuildMetrics) recordLeaf(depth int, node *scene.BvhNode, items int, opts *BuildOptions) {
+	level := m.level(depth, node)
+	level.Leafs++
+	m.addNodeCost(level, opts.IntersectionCost*float32(items)*surfaceArea(node.Min, node.Max))
+}
+
+// Get the metrics for the level at the given depth and increment its node
+// count. Nodes at depth 0 are root nodes and define the surface area used
+// for weighting the node costs.
+func (m *BuildMetrics) level(depth int, node *scene.BvhNode) *LevelMetrics {
+	if depth == 0 {
+		m.rootArea = surfaceArea(node.Min, node.Max)
+	}
+	for len(m.Levels) <= depth {
+		m.Levels = append(m.Levels, LevelMetrics{})
+	}
+
+	level := &m.Levels[depth]
+	level.Nodes++
+	return level
+}
+
+// Add the cost of a node to a level and update its average cost.
+func (m *BuildMetrics) addNodeCost(level *LevelMetrics, cost float32) {
+	if m.rootArea > 0 {
+		cost /= m.rootArea
+	}
+	level.sahCost += float64(cost)
+	level.AvgSAHCost = float32(level.sahCost / float64(level.Nodes))
+}
+
+// Generate a table with the collected per-level metrics.
+func (m *BuildMetrics) Report() string {
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Level", "Nodes", "Leafs", "Avg. SAH cost", "X splits", "Y splits", "Z splits"})
+	for depth, level := range m.Levels {
+		table.Append([]string{
+			fmt.Sprintf("%d", depth),
+			fmt.Sprintf("%d", level.Nodes),
+			fmt.Sprintf("%d", level.Leafs),
+			fmt.Sprintf("%.4f", level.AvgSAHCost),
+			fmt.Sprintf("%d", level.SplitAxes[XAxis]),
+			fmt.Sprintf("%d", level.SplitAxes[YAxis]),
+			fmt.Sprintf("%d", level.SplitAxes[ZAxis]),
+		})
+	}
+	table.SetFooter([]string{"Total", "", "", fmt.Sprintf("%.4f", m.SAHCost()), "", "", ""})
+	table.Render()
+
+	return buf.String()
+}
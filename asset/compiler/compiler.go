@@ -1,8 +1,12 @@
 package compiler
 
 import (
+	"encoding/binary"
 	"fmt"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/achilleasa/polaris/asset"
@@ -16,9 +20,19 @@ import (
 )
 
 const (
-	minPrimitivesPerLeaf      = 10
 	SceneDiffuseMaterialName  = "scene_diffuse_material"
 	SceneEmissiveMaterialName = "scene_emissive_material"
+	SceneDefaultMaterialName  = "scene_default_material"
+
+	// The expression for the built-in default material which is used when
+	// the scene does not define a SceneDefaultMaterialName material.
+	defaultMaterialExpression = "diffuse(reflectance: {0.7, 0.7, 0.7})"
+
+	// Texture paths containing this token refer to a set of UDIM tiles.
+	udimToken       = "<UDIM>"
+	udimFirstTile   = 1001
+	udimMaxTiles    = 100
+	udimTileColumns = 10
 )
 
 type sceneCompiler struct {
@@ -26,6 +40,27 @@ type sceneCompiler struct {
 	optimizedScene *scene.Scene
 	logger         log.Logger
 
+	// Structured diagnostics emitted while compiling the scene.
+	diagnostics *CompileDiagnostics
+
+	// The BVH build options.
+	bvhOptions bvh.BuildOptions
+
+	// The minimum number of primitives required for creating a mesh BVH leaf.
+	minPrimitivesPerLeaf int
+
+	// The number of mesh instances that may share a top-level BVH leaf.
+	maxInstancesPerLeaf int
+
+	// The number of workers used for building the mesh BVH trees.
+	buildThreads int
+
+	// The vertex winding order of front-facing primitives.
+	frontFaceWinding Winding
+
+	// If set, a mipmap pyramid is generated for each baked texture.
+	generateMipmaps bool
+
 	// A map of material indices to their layered material tree roots.
 	matIndexToMatRoot map[int]int32
 
@@ -36,20 +71,45 @@ type sceneCompiler struct {
 	// A map of material indices to an emissive layered material tree node.
 	emissiveIndexCache map[int]int32
 
+	// The material tree root and emissive node index for the material that
+	// is assigned to primitives referencing a missing material.
+	defaultMatRoot      int32
+	defaultEmissiveNode int32
+
 	// A list of material references for detecting circular loops.
 	matRefList []string
 }
 
 // Compile a scene representation parsed by a scene reader into a GPU-friendly
-// optimized scene format.
-func Compile(parsedScene *input.Scene) (*scene.Scene, error) {
+// optimized scene format. The parsed scene is validated before compiling it
+// and the validation error is returned if the scene is malformed. Any
+// diagnostics emitted while compiling the scene are also returned; the
+// returned diagnostics are always valid, even if compilation fails.
+func Compile(parsedScene *input.Scene, opts Options) (*scene.Scene, *CompileDiagnostics, error) {
+	logger := log.New("scene compiler")
+	diagnostics := newCompileDiagnostics(logger)
+	if err := opts.validate(); err != nil {
+		return nil, diagnostics, err
+	}
+	if err := parsedScene.Validate(); err != nil {
+		return nil, diagnostics, err
+	}
+
 	compiler := &sceneCompiler{
-		parsedScene: parsedScene,
+		parsedScene:          parsedScene,
+		bvhOptions:           opts.bvhOptions(),
+		minPrimitivesPerLeaf: opts.MinPrimitivesPerLeaf,
+		maxInstancesPerLeaf:  opts.MaxInstancesPerLeaf,
+		buildThreads:         opts.BuildThreads,
+		frontFaceWinding:     opts.FrontFaceWinding,
+		generateMipmaps:      opts.GenerateMipmaps,
 		optimizedScene: &scene.Scene{
-			SceneDiffuseMatIndex:  -1,
-			SceneEmissiveMatIndex: -1,
+			SceneDiffuseMatIndex:        -1,
+			SceneEmissiveMatIndex:       -1,
+			IntersectionEpsilonOverride: opts.IntersectionEpsilon,
 		},
-		logger: log.New("scene compiler"),
+		logger:      logger,
+		diagnostics: diagnostics,
 	}
 
 	start := time.Now()
@@ -58,21 +118,55 @@ func Compile(parsedScene *input.Scene) (*scene.Scene, error) {
 	var err error
 	err = compiler.createLayeredMaterialTrees()
 	if err != nil {
-		return nil, err
+		return nil, compiler.diagnostics, err
+	}
+
+	err = compiler.setupDefaultMaterial()
+	if err != nil {
+		return nil, compiler.diagnostics, err
 	}
 
+	compiler.checkDegeneratePrimitives()
+	compiler.repairWinding(opts.WindingRepair)
+	compiler.smoothNormals(opts.NormalSmoothing)
+	compiler.setupProxyInstances()
+
 	err = compiler.partitionGeometry()
 	if err != nil {
-		return nil, err
+		return nil, compiler.diagnostics, err
+	}
+	compiler.analyzeMaterials()
+	compiler.bakeVertexAO(opts.VertexAOSamples, opts.VertexAODistance)
+	if opts.IndexVertices {
+		compiler.indexVertices(opts.VertexWeldEpsilon)
+	}
+
+	if opts.StrictChecks {
+		err = validateBvh(compiler.optimizedScene)
+		if err != nil {
+			return nil, compiler.diagnostics, err
+		}
 	}
 
 	err = compiler.setupCamera()
 	if err != nil {
-		return nil, err
+		return nil, compiler.diagnostics, err
 	}
 
+	err = compiler.setupMedium()
+	if err != nil {
+		return nil, compiler.diagnostics, err
+	}
+
+	err = compiler.setupDome()
+	if err != nil {
+		return nil, compiler.diagnostics, err
+	}
+
+	compiler.setupMetadata()
+
 	compiler.logger.Noticef("compiled scene in %d ms", time.Since(start).Nanoseconds()/1e6)
-	return compiler.optimizedScene, nil
+	return compiler.optimizedScene, compiler.diagnostics, nil
 }
 
 // Generate a two-level BVH tree for the scene. The top level BVH tree partitions
@@ -82,123 +176,149 @@ func (sc *sceneCompiler) partitionGeometry() error {
 	start := time.Now()
 	sc.logger.Notice("partitioning geometry")
 
-	// Partition mesh instances so that each instance ends up in its own BVH leaf.
+	// Partition mesh instances into the top-level BVH. If leafs may contain
+	// multiple instances, the compiled instances are stored in leaf order so
+	// that each leaf references a contiguous range of instances. Otherwise,
+	// each instance ends up in its own leaf and the instance order is preserved.
 	sc.logger.Infof("building scene BVH tree (%d meshes, %d mesh instances)", len(sc.parsedScene.Meshes), len(sc.parsedScene.MeshInstances))
 	volList := make([]bvh.BoundedVolume, len(sc.parsedScene.MeshInstances))
 	for index, mi := range sc.parsedScene.MeshInstances {
 		volList[index] = mi
 	}
-	sc.optimizedScene.BvhNodeList = bvh.Build(volList, 1, func(node *scene.BvhNode, workList []bvh.BoundedVolume) {
-		pmi := workList[0].(*input.MeshInstance)
+	instances := sc.parsedScene.MeshInstances
+	if sc.maxInstancesPerLeaf > 1 {
+		instances = make([]*input.MeshInstance, 0, len(sc.parsedScene.MeshInstances))
+	}
+	sc.optimizedScene.BvhNodeList, sc.diagnostics.instanceBvhStats = bvh.BuildWithStats(volList, sc.maxInstancesPerLeaf, sc.bvhOptions, func(node *scene.BvhNode, workList []bvh.BoundedVolume) {
+		if sc.maxInstancesPerLeaf > 1 {
+			node.SetMeshInstances(uint32(len(instances)), uint32(len(workList)))
+			for _, item := range workList {
+				instances = append(instances, item.(*input.MeshInstance))
+			}
+			return
+		}
 
 		// Assign mesh instance index to node
+		pmi := workList[0].(*input.MeshInstance)
 		for index, mi := range sc.parsedScene.MeshInstances {
 			if pmi == mi {
 				node.SetMeshIndex(uint32(index))
 				break
 			}
 		}
-	}, bvh.SurfaceAreaHeuristic)
+	})
 
 	// Scan all meshes and calculate the size of material, vertex, normal
 	// and uv lists; then pre-allocate them.
 	totalVertices := 0
-	for _, pm := range sc.parsedScene.Meshes {
+	hasTransparency := false
+	for _, pm := range sc.meshesWithLODs() {
 		totalVertices += 3 * len(pm.Primitives)
+		hasTransparency = hasTransparency || hasTransparentPrimitives(pm.Primitives)
 	}
 
 	sc.optimizedScene.VertexList = make([]types.Vec4, totalVertices)
 	sc.optimizedScene.NormalList = make([]types.Vec4, totalVertices)
 	sc.optimizedScene.UvList = make([]types.Vec2, totalVertices)
+	sc.optimizedScene.TangentList = make([]types.Vec4, totalVertices)
 	sc.optimizedScene.MaterialIndex = make([]uint32, totalVertices/3)
+	if hasTransparency {
+		sc.optimizedScene.PrimitiveOpacity = make([]uint8, totalVertices/3)
+	}
 
-	// Partition each mesh into its own BVH. Update all instances to point to this mesh BVH.
-	var vertexOffset uint32 = 0
+	// Partition each mesh into its own BVH. The base mesh ranges share the
+	// parsed mesh indices; LOD ranges are appended after them.
+	jobs := make([]meshPartitionJob, 0, len(sc.parsedScene.Meshes))
 	var primOffset uint32 = 0
-	meshBvhRoots := make([]uint32, len(sc.parsedScene.Meshes))
-	meshEmissivePrimitives := make([]*scene.EmissivePrimitive, 0)
-	emissiveIndexToMeshIndexMap := make(map[int]uint32, 0)
 	for mIndex, pm := range sc.parsedScene.Meshes {
-		volList := make([]bvh.BoundedVolume, len(pm.Primitives))
-		for index, prim := range pm.Primitives {
-			volList[index] = prim
-		}
-
-		sc.logger.Infof(`building BVH tree for "%s" (%d primitives)`, pm.Name, len(pm.Primitives))
-		bvhNodes := bvh.Build(volList, minPrimitivesPerLeaf, func(node *scene.BvhNode, workList []bvh.BoundedVolume) {
-			node.SetPrimitives(primOffset, uint32(len(workList)))
-
-			// Copy primitive data to flat arrays
-			for _, workItem := range workList {
-				prim := workItem.(*input.Primitive)
-
-				// Convert Vec3 to Vec4 which is required for proper alignment inside opencl kernels
-				sc.optimizedScene.VertexList[vertexOffset+0] = prim.Vertices[0].Vec4(0)
-				sc.optimizedScene.VertexList[vertexOffset+1] = prim.Vertices[1].Vec4(0)
-				sc.optimizedScene.VertexList[vertexOffset+2] = prim.Vertices[2].Vec4(0)
-
-				sc.optimizedScene.NormalList[vertexOffset+0] = prim.Normals[0].Vec4(0)
-				sc.optimizedScene.NormalList[vertexOffset+1] = prim.Normals[1].Vec4(0)
-				sc.optimizedScene.NormalList[vertexOffset+2] = prim.Normals[2].Vec4(0)
-
-				sc.optimizedScene.UvList[vertexOffset+0] = prim.UVs[0]
-				sc.optimizedScene.UvList[vertexOffset+1] = prim.UVs[1]
-				sc.optimizedScene.UvList[vertexOffset+2] = prim.UVs[2]
-
-				// Lookup root material node for primitive material index
-				matNodeIndex := sc.matIndexToMatRoot[prim.MaterialIndex]
-				sc.optimizedScene.MaterialIndex[primOffset] = uint32(matNodeIndex)
-
-				// Check if this an emissive primitive and keep track of it
-				// Since we may use multiple instances of this mesh we need a
-				// separate pass to generate a primitive for each mesh instance
-				if emissiveNodeIndex := sc.emissiveIndexCache[prim.MaterialIndex]; emissiveNodeIndex != -1 {
-					meshEmissivePrimitives = append(meshEmissivePrimitives, &scene.EmissivePrimitive{
-						// area = 0.5 * len(cross(v2-v0, v2-v1))
-						Area:              0.5 * prim.Vertices[2].Sub(prim.Vertices[0]).Cross(prim.Vertices[2].Sub(prim.Vertices[1])).Len(),
-						PrimitiveIndex:    primOffset,
-						MaterialNodeIndex: uint32(emissiveNodeIndex),
-						Type:              scene.AreaLight,
-					})
-
-					emissiveIndexToMeshIndexMap[len(meshEmissivePrimitives)-1] = uint32(mIndex)
-				}
+		jobs = append(jobs, meshPartitionJob{mesh: pm, baseMesh: uint32(mIndex), primOffset: primOffset})
+		primOffset += uint32(len(pm.Primitives))
+	}
+	for mIndex, pm := range sc.parsedScene.Meshes {
+		for lodIndex, lodMesh := range pm.LODs {
+			jobs = append(jobs, meshPartitionJob{mesh: lodMesh, baseMesh: uint32(mIndex), lod: uint32(lodIndex + 1), primOffset: primOffset})
+			primOffset += uint32(len(lodMesh.Primitives))
+		}
+	}
+	workers := sc.buildThreads
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+	sc.partitionMeshes(jobs, workers)
 
-				vertexOffset += 3
-				primOffset++
-			}
-		}, bvh.SurfaceAreaHeuristic)
+	// Append the mesh BVH nodes to the scene BVH list in job order so the
+	// output does not depend on the order in which the jobs completed.
+	meshEmissivePrimitives := make([]*scene.EmissivePrimitive, 0)
+	emissiveIndexToMeshIndex := make([]uint32, 0)
+	sc.optimizedScene.MeshRanges = make([]scene.MeshRange, 0, len(jobs))
+	sc.diagnostics.meshBvhStats = make([]bvh.Stats, len(jobs))
+	for rangeIndex, job := range jobs {
+		sc.diagnostics.meshBvhStats[rangeIndex] = job.bvhStats
+
+		for _, emissive := range job.emissives {
+			meshEmissivePrimitives = append(meshEmissivePrimitives, emissive)
+			emissiveIndexToMeshIndex = append(emissiveIndexToMeshIndex, uint32(rangeIndex))
+		}
 
 		// Apply offset to bvh nodes and append them to the scene bvh list
 		offset := int32(len(sc.optimizedScene.BvhNodeList))
-		meshBvhRoots[mIndex] = uint32(offset)
-		for index, _ := range bvhNodes {
-			bvhNodes[index].OffsetChildNodes(offset)
+		for index, _ := range job.bvhNodes {
+			job.bvhNodes[index].OffsetChildNodes(offset)
 		}
-		sc.optimizedScene.BvhNodeList = append(sc.optimizedScene.BvhNodeList, bvhNodes...)
+		sc.optimizedScene.BvhNodeList = append(sc.optimizedScene.BvhNodeList, job.bvhNodes...)
+
+		sc.optimizedScene.MeshRanges = append(sc.optimizedScene.MeshRanges, scene.MeshRange{
+			BvhRoot:        uint32(offset),
+			BvhNodeCount:   uint32(len(job.bvhNodes)),
+			FirstPrimitive: job.primOffset,
+			PrimitiveCount: uint32(len(job.mesh.Primitives)),
+			FlatShading:    job.mesh.ShadingMode == input.FlatShading,
+			BaseMesh:       job.baseMesh,
+			LOD:            job.lod,
+		})
 	}
 
-	sc.logger.Infof("processing %d mesh instances", len(sc.parsedScene.MeshInstances))
+	sc.logger.Infof("processing %d mesh instances", len(instances))
 
 	// Process each mesh instance
-	sc.optimizedScene.MeshInstanceList = make([]scene.MeshInstance, len(sc.parsedScene.MeshInstances))
-	for index, pmi := range sc.parsedScene.MeshInstances {
+	sc.optimizedScene.MeshInstanceList = make([]scene.MeshInstance, len(instances))
+	for index, pmi := range instances {
+		lod := pmi.LOD
+		if numLODs := uint32(len(sc.parsedScene.Meshes[pmi.MeshIndex].LODs)); lod > numLODs {
+			sc.diagnostics.warnf(StageGeometry, int(pmi.MeshIndex), "mesh instance %d requests LOD %d but mesh %q only defines %d LOD(s); using LOD %d", index, lod, sc.parsedScene.Meshes[pmi.MeshIndex].Name, numLODs, numLODs)
+			lod = numLODs
+		}
+
 		mi := &sc.optimizedScene.MeshInstanceList[index]
-		mi.MeshIndex = pmi.MeshIndex
-		mi.BvhRoot = meshBvhRoots[pmi.MeshIndex]
+		mi.MeshIndex = uint32(sc.optimizedScene.MeshLOD(pmi.MeshIndex, lod))
+		mi.BvhRoot = sc.optimizedScene.MeshRanges[mi.MeshIndex].BvhRoot
 
 		// We need to invert the transformation matrix when performing ray traversal
 		mi.Transform = pmi.Transform.Inv()
+
+		// Instances without a tint default to white
+		tint := pmi.Tint
+		if tint == (types.Vec3{}) {
+			tint = types.Vec3{1, 1, 1}
+		}
+		mi.Tint = tint.Vec4(0)
+
+		if len(pmi.Attributes) != 0 {
+			mi.AttributeOffset = uint32(len(sc.optimizedScene.InstanceAttributeList))
+			mi.AttributeCount = uint32(len(pmi.Attributes))
+			sc.optimizedScene.InstanceAttributeList = append(sc.optimizedScene.InstanceAttributeList, pmi.Attributes...)
+		}
 	}
 
 	sc.logger.Info("creating emissive primitive copies for mesh instances")
 
 	// For each unique emissive primitive for the scene's meshes we need to
 	// create a clone for each one of the mesh instances and fill in the
-	// appropriate transformation matrix.
+	// appropriate transformation matrix. The emissives are visited in index
+	// order so the emissive list does not depend on map iteration order.
 	sc.optimizedScene.EmissivePrimitives = make([]scene.EmissivePrimitive, 0)
 	for _, mi := range sc.optimizedScene.MeshInstanceList {
-		for emissiveIndex, meshIndex := range emissiveIndexToMeshIndexMap {
+		for emissiveIndex, meshIndex := range emissiveIndexToMeshIndex {
 			if mi.MeshIndex != meshIndex {
 				continue
 			}
@@ -210,6 +330,15 @@ func (sc *sceneCompiler) partitionGeometry() error {
 		}
 	}
 
+	// Create a sphere light for each analytic point light
+	for lightIndex, light := range sc.parsedScene.PointLights {
+		emp, err := sc.generatePointLight(lightIndex, light)
+		if err != nil {
+			return err
+		}
+		sc.optimizedScene.EmissivePrimitives = append(sc.optimizedScene.EmissivePrimitives, emp)
+	}
+
 	// If a global emission map is defined for the scene create an emissive for it
 	if sc.optimizedScene.SceneEmissiveMatIndex != -1 && sc.emissiveIndexCache[int(sc.optimizedScene.SceneEmissiveMatIndex)] != -1 {
 		emp := scene.EmissivePrimitive{
@@ -222,7 +351,12 @@ func (sc *sceneCompiler) partitionGeometry() error {
 	if len(sc.optimizedScene.EmissivePrimitives) > 0 {
 		sc.logger.Infof("emitted %d emissive primitives for all mesh instances (%d unique mesh emissives)", len(sc.optimizedScene.EmissivePrimitives), len(meshEmissivePrimitives))
 	} else {
-		sc.logger.Warning("the scene contains no emissive primitives or a global environment light; output will appear black!")
+		sc.diagnostics.warnf(StageLights, -1, "the scene contains no emissive primitives or a global environment light; output will appear black!")
+	}
+
+	// Ensure that leaf primitives are stored contiguously in traversal order
+	if reorderLeafPrimitives(sc.optimizedScene) {
+		sc.logger.Infof("reordered leaf primitives to match the BVH traversal order")
 	}
 
 	sc.logger.Noticef("partitioned geometry in %d ms", time.Since(start).Nanoseconds()/1e6)
@@ -230,16 +364,320 @@ func (sc *sceneCompiler) partitionGeometry() error {
 	return nil
 }
 
+// Get the list of parsed meshes followed by the LOD meshes for each one.
+func (sc *sceneCompiler) meshesWithLODs() []*input.Mesh {
+	meshes := append([]*input.Mesh{}, sc.parsedScene.Meshes...)
+	for _, pm := range sc.parsedScene.Meshes {
+		meshes = append(meshes, pm.LODs...)
+	}
+	return meshes
+}
+
+// A mesh whose BVH is built by partitionMeshes.
+type meshPartitionJob struct {
+	mesh     *input.Mesh
+	baseMesh uint32
+	lod      uint32
+
+	// The offset of the first mesh primitive in the flat geometry lists.
+	primOffset uint32
+
+	// The (non-offsetted) mesh BVH nodes, their build statistics and the
+	// mesh emissive primitives.
+	bvhNodes  []scene.BvhNode
+	bvhStats  bvh.Stats
+	emissives []*scene.EmissivePrimitive
+}
+
+// Build the BVH trees for a list of meshes using a pool of workers. Each job
+// writes its primitive data into a disjoint region of the flat geometry lists
+// that starts at the job's primOffset; the results are stored in the job list.
+func (sc *sceneCompiler) partitionMeshes(jobs []meshPartitionJob, workers int) {
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	jobChan := make(chan int, len(jobs))
+	for index := range jobs {
+		jobChan <- index
+	}
+	close(jobChan)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			defer wg.Done()
+			for index := range jobChan {
+				job := &jobs[index]
+				sc.logger.Infof(`building BVH tree for "%s" (LOD %d, %d primitives)`, job.mesh.Name, job.lod, len(job.mesh.Primitives))
+				job.bvhNodes, job.bvhStats, job.emissives = sc.partitionMesh(job.mesh.Primitives, job.primOffset, job.mesh.ShadingMode == input.FlatShading)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Build a BVH tree for a list of mesh primitives and copy the primitive data
+// into the optimized scene's flat geometry lists starting at primOffset. The
+// geometry lists must be large enough to fit the primitive data. If flatShading
+// is true, the geometric normal is used for all primitive vertices. Returns the
+// (non-offsetted) BVH node list, the BVH build statistics and a list of
+// emissive primitives that need to be cloned for each mesh instance. It is safe to call this method
+// concurrently for disjoint primitive ranges.
+func (sc *sceneCompiler) partitionMesh(primitives []*input.Primitive, primOffset uint32, flatShading bool) ([]scene.BvhNode, bvh.Stats, []*scene.EmissivePrimitive) {
+	emissives := make([]*scene.EmissivePrimitive, 0)
+
+	volList := make([]bvh.BoundedVolume, len(primitives))
+	for index, prim := range primitives {
+		volList[index] = prim
+	}
+
+	bvhNodes, stats := bvh.BuildWithStats(volList, sc.minPrimitivesPerLeaf, sc.bvhOptions, func(node *scene.BvhNode, workList []bvh.BoundedVolume) {
+		node.SetPrimitives(primOffset, uint32(len(workList)))
+		emissives = sc.copyLeafPrimitives(workList, primOffset, flatShading, emissives)
+		primOffset += uint32(len(workList))
+	})
+
+	return bvhNodes, stats, emissives
+}
+
+// Copy the data for a BVH leaf's primitives into the optimized scene's flat
+// geometry lists starting at primOffset. The leaf data is written in bulk to
+// slices covering the entire leaf range of each list. Any emissive primitives
+// are appended to the supplied emissive list which is then returned.
+func (sc *sceneCompiler) copyLeafPrimitives(workList []bvh.BoundedVolume, primOffset uint32, flatShading bool, emissives []*scene.EmissivePrimitive) []*scene.EmissivePrimitive {
+	count := uint32(len(workList))
+	vertices := sc.optimizedScene.VertexList[3*primOffset : 3*(primOffset+count)]
+	normals := sc.optimizedScene.NormalList[3*primOffset : 3*(primOffset+count)]
+	uvs := sc.optimizedScene.UvList[3*primOffset : 3*(primOffset+count)]
+	matIndices := sc.optimizedScene.MaterialIndex[primOffset : primOffset+count]
+	var tangents []types.Vec4
+	if len(sc.optimizedScene.TangentList) != 0 {
+		tangents = sc.optimizedScene.TangentList[3*primOffset : 3*(primOffset+count)]
+	}
+	var opacities []uint8
+	if len(sc.optimizedScene.PrimitiveOpacity) != 0 {
+		opacities = sc.optimizedScene.PrimitiveOpacity[primOffset : primOffset+count]
+	}
+
+	for index, workItem := range workList {
+		prim := workItem.(*input.Primitive)
+		leafVertices := vertices[3*index : 3*index+3]
+		leafNormals := normals[3*index : 3*index+3]
+
+		// Convert Vec3 to Vec4 which is required for proper alignment inside opencl kernels
+		leafVertices[0] = prim.Vertices[0].Vec4(0)
+		leafVertices[1] = prim.Vertices[1].Vec4(0)
+		leafVertices[2] = prim.Vertices[2].Vec4(0)
+
+		// The geometric normal components are packed into the w
+		// coordinate of the three vertex normals
+		geomNormal := geometricNormal(prim, sc.frontFaceWinding)
+		if flatShading {
+			leafNormals[0] = geomNormal.Vec4(geomNormal[0])
+			leafNormals[1] = geomNormal.Vec4(geomNormal[1])
+			leafNormals[2] = geomNormal.Vec4(geomNormal[2])
+		} else {
+			leafNormals[0] = prim.Normals[0].Vec4(geomNormal[0])
+			leafNormals[1] = prim.Normals[1].Vec4(geomNormal[1])
+			leafNormals[2] = prim.Normals[2].Vec4(geomNormal[2])
+		}
+
+		copy(uvs[3*index:3*index+3], prim.UVs[:])
+
+		// Use the tangents provided by the scene reader as-is. Otherwise,
+		// orthonormalize the primitive tangent against the copied vertex
+		// normals so flat-shaded primitives use the geometric normal
+		if tangents != nil && prim.HasTangents {
+			copy(tangents[3*index:3*index+3], prim.Tangents[:])
+		} else if tangents != nil {
+			vertexNormals := [3]types.Vec3{leafNormals[0].Vec3(), leafNormals[1].Vec3(), leafNormals[2].Vec3()}
+			primTangents := vertexTangents(prim, vertexNormals)
+			copy(tangents[3*index:3*index+3], primTangents[:])
+		}
+
+		// Lookup root material node for primitive material index and
+		// fall back to the default material if it is missing
+		matRoot, exists := sc.matIndexToMatRoot[prim.MaterialIndex]
+		emissiveNodeIndex := sc.emissiveIndexCache[prim.MaterialIndex]
+		if !exists {
+			matRoot, emissiveNodeIndex = sc.defaultMatRoot, sc.defaultEmissiveNode
+		}
+		matIndices[index] = uint32(matRoot)
+		if opacities != nil {
+			opacities[index] = quantizeOpacity(prim.Transparency)
+		}
+
+		// Check if this an emissive primitive and keep track of it
+		// Since we may use multiple instances of this mesh we need a
+		// separate pass to generate a primitive for each mesh instance
+		if emissiveNodeIndex != -1 {
+			emissives = append(emissives, &scene.EmissivePrimitive{
+				Area:              triangleArea(leafVertices),
+				PrimitiveIndex:    primOffset + uint32(index),
+				MaterialNodeIndex: uint32(emissiveNodeIndex),
+				Type:              scene.AreaLight,
+			})
+		}
+	}
+
+	return emissives
+}
+
+// Calculate the area of a triangle using the vertices copied to the scene
+// vertex list: area = 0.5 * len(cross(v2-v0, v2-v1)).
+func triangleArea(vertices []types.Vec4) float32 {
+	v0, v1, v2 := vertices[0].Vec3(), vertices[1].Vec3(), vertices[2].Vec3()
+	return 0.5 * v2.Sub(v0).Cross(v2.Sub(v1)).Len()
+}
+
 // Initialize and position the camera for the scene.
 func (sc *sceneCompiler) setupCamera() error {
 	sc.optimizedScene.Camera = scene.NewCamera(sc.parsedScene.Camera.FOV)
 	sc.optimizedScene.Camera.Position = sc.parsedScene.Camera.Eye
 	sc.optimizedScene.Camera.LookAt = sc.parsedScene.Camera.Look
 	sc.optimizedScene.Camera.Up = sc.parsedScene.Camera.Up
+	sc.optimizedScene.Camera.Roll = sc.parsedScene.Camera.Roll
+	sc.optimizedScene.Camera.Shutter = scene.Shutter{
+		OpenRamp:  sc.parsedScene.Camera.ShutterOpen,
+		CloseRamp: sc.parsedScene.Camera.ShutterClose,
+	}
+
+	if err := sc.optimizedScene.Camera.Shutter.Validate(); err != nil {
+		return fmt.Errorf("scene compiler: %v", err)
+	}
+
+	pc := sc.parsedScene.Camera
+	if pc.ApertureRadius < 0 || pc.FocalDistance < 0 {
+		return fmt.Errorf("scene compiler: camera aperture radius and focal distance must be >= 0; got %f and %f", pc.ApertureRadius, pc.FocalDistance)
+	}
+	sc.optimizedScene.Camera.ApertureRadius = pc.ApertureRadius
+	sc.optimizedScene.Camera.FocalDistance = pc.FocalDistance
+
+	// Unless a focal distance is specified, focus the lens on the look point
+	if pc.FocalDistance == 0 {
+		sc.optimizedScene.Camera.FocalDistance = pc.Look.Sub(pc.Eye).Len()
+	}
+
+	projection, err := scene.ParseProjection(pc.Projection)
+	if err != nil {
+		return fmt.Errorf("scene compiler: %v", err)
+	}
+	if pc.OrthoScale < 0 {
+		return fmt.Errorf("scene compiler: camera ortho scale must be >= 0; got %f", pc.OrthoScale)
+	}
+	switch projection {
+	case scene.ProjectionFisheye:
+		if pc.FOV <= 0 || pc.FOV > 360 {
+			return fmt.Errorf("scene compiler: fisheye camera fov must be in the (0, 360] range; got %f", pc.FOV)
+		}
+	case scene.ProjectionPanini:
+		if pc.FOV <= 0 || pc.FOV >= 360 {
+			return fmt.Errorf("scene compiler: panini camera fov must be in the (0, 360) range; got %f", pc.FOV)
+		}
+	}
+	sc.optimizedScene.Camera.Projection = projection
+	if pc.OrthoScale > 0 {
+		sc.optimizedScene.Camera.OrthoScale = pc.OrthoScale
+	}
+
+	return nil
+}
+
+// Setup scene participating medium.
+func (sc *sceneCompiler) setupMedium() error {
+	pm := sc.parsedScene.Medium
+	if pm == nil || pm.Extinction == 0 {
+		return nil
+	}
+
+	if pm.Extinction < 0 {
+		return fmt.Errorf("scene compiler: medium extinction must be >= 0; got %f", pm.Extinction)
+	}
+	if pm.G <= -1 || pm.G >= 1 {
+		return fmt.Errorf("scene compiler: medium phase asymmetry must be in the (-1, 1) range; got %f", pm.G)
+	}
+
+	sc.optimizedScene.Medium = scene.Medium{
+		Extinction: pm.Extinction,
+		Albedo:     pm.Albedo,
+		G:          pm.G,
+	}
+	sc.logger.Infof("enabling homogeneous medium (extinction: %f, albedo: %v, g: %f)", pm.Extinction, pm.Albedo, pm.G)
 
 	return nil
 }
 
+// Setup scene background dome projection.
+func (sc *sceneCompiler) setupDome() error {
+	pd := sc.parsedScene.Dome
+	if pd == nil || pd.Radius == 0 {
+		return nil
+	}
+
+	if pd.Radius < 0 {
+		return fmt.Errorf("scene compiler: dome radius must be > 0; got %f", pd.Radius)
+	}
+	if pd.GroundHeight <= -pd.Radius || pd.GroundHeight >= pd.Radius {
+		return fmt.Errorf("scene compiler: dome ground height must be in the (%f, %f) range; got %f", -pd.Radius, pd.Radius, pd.GroundHeight)
+	}
+
+	sc.optimizedScene.Dome = scene.Dome{
+		Radius:       pd.Radius,
+		GroundHeight: pd.GroundHeight,
+	}
+	sc.logger.Infof("enabling background dome projection (radius: %f, ground height: %f)", pd.Radius, pd.GroundHeight)
+
+	return nil
+}
+
+// Generate a sphere light emissive for a parsed point light. The light
+// intensity is stored in an emissive material node which is generated for
+// each light.
+func (sc *sceneCompiler) generatePointLight(lightIndex int, light *input.PointLight) (scene.EmissivePrimitive, error) {
+	if light.Radius < 0 {
+		return scene.EmissivePrimitive{}, fmt.Errorf("scene compiler: point light %d radius must be >= 0; got %f", lightIndex, light.Radius)
+	}
+
+	fmtFloat := func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	sc.matRefList = make([]string, 0)
+	matRoot, err := sc.generateMaterial(&input.Material{
+		Name:       fmt.Sprintf("point-light-%d", lightIndex),
+		Expression: fmt.Sprintf("emissive(radiance: {%s, %s, %s})", fmtFloat(light.Intensity[0]), fmtFloat(light.Intensity[1]), fmtFloat(light.Intensity[2])),
+	})
+	if err != nil {
+		return scene.EmissivePrimitive{}, err
+	}
+
+	r, pos := light.Radius, light.Position
+	transform := types.Mat4{r, 0, 0, 0, 0, r, 0, 0, 0, 0, r, 0, pos[0], pos[1], pos[2], 1}
+	sc.logger.Infof("adding point light %d (position: %v, radius: %f)", lightIndex, light.Position, light.Radius)
+
+	return scene.EmissivePrimitive{
+		Transform:         transform,
+		MaterialNodeIndex: uint32(sc.findMaterialNodeByBxdf(uint32(matRoot), material.BxdfEmissive)),
+		Type:              scene.SphereLight,
+	}, nil
+}
+
+// Copy the parsed scene metadata to the optimized scene.
+func (sc *sceneCompiler) setupMetadata() {
+	pm := sc.parsedScene.Metadata
+	if pm == nil {
+		return
+	}
+
+	sc.optimizedScene.Metadata = scene.Metadata{
+		Name:    pm.Name,
+		Author:  pm.Author,
+		Units:   pm.Units,
+		Created: pm.Created,
+	}
+}
+
 // Perform a DFS in a layered material tree trying to locate anode with a particular BXDF.
 func (sc *sceneCompiler) findMaterialNodeByBxdf(nodeIndex uint32, bxdf material.BxdfType) int32 {
 	node := sc.optimizedScene.MaterialNodeList[nodeIndex]
@@ -259,8 +697,8 @@ func (sc *sceneCompiler) findMaterialNodeByBxdf(nodeIndex uint32, bxdf material.
 		return out
 	}
 
-	// If this is a mix node descend into the right child
-	if nodeType == uint32(material.OpMix) {
+	// If this is a mix or fresnel blend node descend into the right child
+	if nodeType == uint32(material.OpMix) || nodeType == uint32(material.OpFresnelBlend) {
 		out = sc.findMaterialNodeByBxdf(uint32(node.Union1[2]), bxdf)
 	}
 
@@ -278,6 +716,10 @@ func (sc *sceneCompiler) createLayeredMaterialTrees() error {
 	sc.optimizedScene.MaterialNodeList = make([]scene.MaterialNode, 0)
 	sc.optimizedScene.TextureData = make([]byte, 0)
 	sc.optimizedScene.TextureMetadata = make([]scene.TextureMetadata, 0)
+	sc.optimizedScene.MaterialRoots = make([]int32, len(sc.parsedScene.Materials))
+	for index := range sc.optimizedScene.MaterialRoots {
+		sc.optimizedScene.MaterialRoots[index] = -1
+	}
 
 	var err error
 	for matIndex, mat := range sc.parsedScene.Materials {
@@ -297,6 +739,7 @@ func (sc *sceneCompiler) createLayeredMaterialTrees() error {
 		}
 
 		sc.emissiveIndexCache[matIndex] = sc.findMaterialNodeByBxdf(uint32(sc.matIndexToMatRoot[matIndex]), material.BxdfEmissive)
+		sc.optimizedScene.MaterialRoots[matIndex] = sc.matIndexToMatRoot[matIndex]
 
 		if mat.Name == SceneDiffuseMaterialName {
 			sc.optimizedScene.SceneDiffuseMatIndex = sc.matIndexToMatRoot[matIndex]
@@ -309,6 +752,67 @@ func (sc *sceneCompiler) createLayeredMaterialTrees() error {
 	return nil
 }
 
+// Setup the material that is assigned to primitives whose material index is
+// out of range or references a material that was not compiled. If the scene
+// defines a material named SceneDefaultMaterialName it is used as the default
+// material; otherwise a built-in grey diffuse material is generated. The
+// built-in material is only generated if the scene contains primitives with
+// missing materials.
+func (sc *sceneCompiler) setupDefaultMaterial() error {
+	sc.defaultMatRoot, sc.defaultEmissiveNode = -1, -1
+
+	missing := 0
+	for _, pm := range sc.meshesWithLODs() {
+		for _, prim := range pm.Primitives {
+			if _, exists := sc.matIndexToMatRoot[prim.MaterialIndex]; !exists {
+				missing++
+			}
+		}
+	}
+	if missing == 0 {
+		return nil
+	}
+
+	sc.diagnostics.warnf(StageMaterials, -1, "%d primitives reference a missing material; assigning the default material", missing)
+
+	for matIndex, mat := range sc.parsedScene.Materials {
+		if matRoot, exists := sc.matIndexToMatRoot[matIndex]; exists && mat.Name == SceneDefaultMaterialName {
+			sc.defaultMatRoot = matRoot
+			sc.defaultEmissiveNode = sc.emissiveIndexCache[matIndex]
+			return nil
+		}
+	}
+
+	var err error
+	sc.matRefList = make([]string, 0)
+	sc.defaultMatRoot, err = sc.generateMaterial(&input.Material{
+		Name:       SceneDefaultMaterialName,
+		Expression: defaultMaterialExpression,
+	})
+	if err != nil {
+		return err
+	}
+	sc.defaultEmissiveNode = sc.findMaterialNodeByBxdf(uint32(sc.defaultMatRoot), material.BxdfEmissive)
+	return nil
+}
+
+// Emit a diagnostic for each mesh that contains degenerate primitives. The
+// surface area of such primitives is zero so they can never be hit by rays.
+func (sc *sceneCompiler) checkDegeneratePrimitives() {
+	for meshIndex, pm := range sc.parsedScene.Meshes {
+		degenerate := 0
+		for _, prim := range pm.Primitives {
+			if prim.Vertices[1].Sub(prim.Vertices[0]).Cross(prim.Vertices[2].Sub(prim.Vertices[0])).Len() == 0 {
+				degenerate++
+			}
+		}
+
+		if degenerate > 0 {
+			sc.diagnostics.warnf(StageGeometry, meshIndex, "mesh %q contains %d degenerate primitive(s) with zero area", pm.Name, degenerate)
+		}
+	}
+}
+
 // Compile material expression and generate a layered material tree from it. This
 // method returns back the root material tree node index.
 func (sc *sceneCompiler) generateMaterial(mat *input.Material) (int32, error) {
@@ -322,6 +826,23 @@ func (sc *sceneCompiler) generateMaterial(mat *input.Material) (int32, error) {
 		return -1, fmt.Errorf("material %q: %v", mat.Name, err)
 	}
 
+	// Blend with a transparent bxdf using the material opacity as the weight
+	// (prefer alpha textures to transparency values)
+	switch {
+	case mat.Transparency < 0 || mat.Transparency > 1:
+		return -1, fmt.Errorf("material %q: transparency should be in the [0, 1] range; got %v", mat.Name, mat.Transparency)
+	case mat.AlphaTex != "":
+		exprNode = material.MixMapNode{
+			Expressions: [2]material.ExprNode{exprNode, material.BxdfNode{Type: material.BxdfTransparent}},
+			Texture:     material.TextureNode(mat.AlphaTex),
+		}
+	case mat.Transparency > 0:
+		exprNode = material.MixNode{
+			Expressions: [2]material.ExprNode{exprNode, material.BxdfNode{Type: material.BxdfTransparent}},
+			Weight:      1.0 - mat.Transparency,
+		}
+	}
+
 	// Create material node tree and store its root index
 	sc.matRefList = append(sc.matRefList, mat.Name)
 	return sc.generateMaterialTree(mat, exprNode)
@@ -336,6 +857,7 @@ func (sc *sceneCompiler) generateMaterialTree(mat *input.Material, exprNode mate
 	node := scene.MaterialNode{
 		Union1: [4]int32{0, -1, -1, -1},
 		Union5: [1]int32{-1},
+		Union6: [4]int32{-1, -1, 0, 0},
 		// Default IORs
 		Union4: types.Vec3{material.DefaultIntIOR, material.DefaultExtIOR, 0.0},
 	}
@@ -380,6 +902,19 @@ func (sc *sceneCompiler) generateMaterialTree(mat *input.Material, exprNode mate
 			node.Union2 = material.DefaultSpecularity
 			node.Union3 = material.DefaultTransmittance
 			node.Union4[2] = material.DefaultRoughness
+		case material.BxdfAnisotropicConductor:
+			// Default specularity and tangent/bi-tangent roughness
+			node.Union2 = material.DefaultSpecularity
+			node.Union4[2] = material.DefaultRoughness
+			node.Union3[0] = material.DefaultRoughness
+		case material.BxdfTransparent:
+			// Default transmittance
+			node.Union3 = material.DefaultTransmittance
+		case material.BxdfSubsurface:
+			// Default scatter color, radius and isotropic scattering
+			node.Union2 = material.DefaultScatterColor
+			node.Union3 = material.DefaultScatterRadius
+			node.Union4[2] = 0.0
 		case material.BxdfEmissive:
 			// Default radiance and scaler
 			node.Union2 = material.DefaultRadiance
@@ -387,24 +922,52 @@ func (sc *sceneCompiler) generateMaterialTree(mat *input.Material, exprNode mate
 		}
 
 		// Apply parameters
+		hasIndirectReflectance := false
 		for _, paramNode := range t.Parameters {
 			err = sc.setMaterialNodeParameter(mat, &node, paramNode)
 			if err != nil {
 				return -1, err
 			}
+			hasIndirectReflectance = hasIndirectReflectance || paramNode.Name == material.ParamIndirectReflectance
+		}
+
+		// Unless overridden, indirect bounces use the primary reflectance
+		if t.Type == material.BxdfDiffuse && !hasIndirectReflectance {
+			node.Union3 = node.Union2
+			node.Union6[2] = node.Union1[3]
 		}
 	case material.MixNode:
-		node.Union1[0] = int32(material.OpMix)
-		node.Union1[1], err = sc.generateMaterialTree(mat, t.Expressions[0])
+		var left, right int32
+		left, err = sc.generateMaterialTree(mat, t.Expressions[0])
 		if err != nil {
 			return -1, err
 		}
-		node.Union1[2], err = sc.generateMaterialTree(mat, t.Expressions[1])
+		right, err = sc.generateMaterialTree(mat, t.Expressions[1])
+		if err != nil {
+			return -1, err
+		}
+
+		weightTex := int32(-1)
+		if t.Texture != "" {
+			weightTex, err = sc.bakeTexture(mat, t.Texture)
+			if err != nil {
+				return -1, err
+			}
+		}
+
+		node = scene.NewMixNode(uint32(left), uint32(right), t.Weight, weightTex)
+	case material.FresnelBlendNode:
+		var left, right int32
+		left, err = sc.generateMaterialTree(mat, t.Expressions[0])
+		if err != nil {
+			return -1, err
+		}
+		right, err = sc.generateMaterialTree(mat, t.Expressions[1])
 		if err != nil {
 			return -1, err
 		}
 
-		node.Union2[0] = t.Weight
+		node = scene.NewFresnelBlendNode(uint32(left), uint32(right), t.IOR)
 	case material.MixMapNode:
 		node.Union1[0] = int32(material.OpMixMap)
 		node.Union1[1], err = sc.generateMaterialTree(mat, t.Expressions[0])
@@ -437,6 +1000,9 @@ func (sc *sceneCompiler) generateMaterialTree(mat *input.Material, exprNode mate
 		if err != nil {
 			return -1, err
 		}
+		if mat.FlatNormalMap {
+			node.Union1[2] = scene.NormalMapFlatBase
+		}
 
 		node.Union1[3], err = sc.bakeTexture(mat, t.Texture)
 		if err != nil {
@@ -462,19 +1028,27 @@ func (sc *sceneCompiler) generateMaterialTree(mat *input.Material, exprNode mate
 func (sc *sceneCompiler) setMaterialNodeParameter(mat *input.Material, node *scene.MaterialNode, param material.BxdfParamNode) error {
 	var err error
 	switch param.Name {
-	case material.ParamReflectance, material.ParamSpecularity, material.ParamRadiance:
+	case material.ParamReflectance, material.ParamSpecularity, material.ParamRadiance, material.ParamScatterColor:
 		switch t := param.Value.(type) {
 		case material.Vec3Node:
 			node.Union2 = types.Vec3(t).Vec4(0.0)
 		case material.TextureNode:
-			node.Union1[3], err = sc.bakeTexture(mat, t)
+			node.Union1[3], err = sc.bakeColorTexture(mat, t)
+		}
+	case material.ParamIndirectReflectance:
+		switch t := param.Value.(type) {
+		case material.Vec3Node:
+			node.Union3 = types.Vec3(t).Vec4(0.0)
+			node.Union6[2] = -1
+		case material.TextureNode:
+			node.Union6[2], err = sc.bakeColorTexture(mat, t)
 		}
 	case material.ParamTransmittance:
 		switch t := param.Value.(type) {
 		case material.Vec3Node:
 			node.Union3 = types.Vec3(t).Vec4(0.0)
 		case material.TextureNode:
-			node.Union1[2], err = sc.bakeTexture(mat, t)
+			node.Union1[2], err = sc.bakeColorTexture(mat, t)
 		}
 	case material.ParamIntIOR, material.ParamExtIOR:
 		index := 0
@@ -487,34 +1061,110 @@ func (sc *sceneCompiler) setMaterialNodeParameter(mat *input.Material, node *sce
 			node.Union4[index] = float32(t)
 		case material.MaterialNameNode:
 			node.Union4[index], err = material.IOR(t)
+		case material.TextureNode:
+			node.Union6[index], err = sc.bakeIORTexture(mat, param.Name, t)
 		}
 	case material.ParamScale:
 		node.Union4[2] = float32(param.Value.(material.FloatNode))
 	case material.ParamRoughness:
 		switch t := param.Value.(type) {
 		case material.FloatNode:
-			node.Union4[2] = float32(t)
+			node.Union4[2] = sc.clampRoughness(mat, param.Name, float32(t))
+			if node.Union1[0] == int32(material.BxdfAnisotropicConductor) {
+				node.Union3[0] = node.Union4[2]
+			}
 		case material.TextureNode:
 			node.Union5[0], err = sc.bakeTexture(mat, t)
 		}
+	case material.ParamRoughnessU:
+		node.Union4[2] = sc.clampRoughness(mat, param.Name, float32(param.Value.(material.FloatNode)))
+	case material.ParamRoughnessV:
+		node.Union3[0] = sc.clampRoughness(mat, param.Name, float32(param.Value.(material.FloatNode)))
+	case material.ParamScatterRadius:
+		node.Union3 = types.Vec3(param.Value.(material.Vec3Node)).Vec4(0.0)
+	case material.ParamAnisotropy:
+		node.Union4[2] = float32(param.Value.(material.FloatNode))
 	}
 
 	return err
 }
 
-// Load a texture resource and store its metadata/data into the optimized scene.
-// Texture data is always aligned on a dword boundary.
+// Load a texture that encodes spatially varying IOR values. UDIM and texture
+// array references are rejected as the IOR lookup performed by the bxdfs
+// only supports regular and cube map textures. If the texture is missing, the
+// bxdf falls back to the default IOR value.
+func (sc *sceneCompiler) bakeIORTexture(mat *input.Material, paramName string, texNode material.TextureNode) (int32, error) {
+	texPath := string(texNode)
+	if _, isArray := mat.TextureArrays[texPath]; isArray || strings.Contains(texPath, udimToken) {
+		return -1, fmt.Errorf("%q: %s texture %q must reference a single texture image", mat.Name, paramName, texPath)
+	}
+	if _, _, isLayerRef := parseTextureLayerRef(texPath); isLayerRef {
+		return -1, fmt.Errorf("%q: %s texture %q must reference a single texture image", mat.Name, paramName, texPath)
+	}
+
+	return sc.bakeTexture(mat, texNode)
+}
+
+// Clamp a roughness parameter value to the minimum roughness supported by the
+// microfacet bxdfs and emit a diagnostic if the value was modified. The
+// diagnostic refers to the index of the material node being generated.
+func (sc *sceneCompiler) clampRoughness(mat *input.Material, paramName string, roughness float32) float32 {
+	if roughness >= material.MinRoughness {
+		return roughness
+	}
+
+	sc.diagnostics.warnf(StageMaterials, len(sc.optimizedScene.MaterialNodeList), "%q: clamping %s value %v to %v", mat.Name, paramName, roughness, material.MinRoughness)
+	return material.MinRoughness
+}
+
+// Load a texture resource whose data is used as-is and store its
+// metadata/data into the optimized scene.
 func (sc *sceneCompiler) bakeTexture(mat *input.Material, texNode material.TextureNode) (int32, error) {
+	return sc.bakeTextureInColorSpace(mat, texNode, false)
+}
+
+// Load a texture resource that encodes color values and store its
+// metadata/data into the optimized scene. If the material color textures are
+// sRGB encoded, the texture data is converted to linear space.
+func (sc *sceneCompiler) bakeColorTexture(mat *input.Material, texNode material.TextureNode) (int32, error) {
+	return sc.bakeTextureInColorSpace(mat, texNode, mat.SRGBTextures)
+}
+
+// Load a texture resource and store its metadata/data into the optimized scene.
+// If srgb is true, the texture color channels are converted from sRGB to linear
+// space. Texture data is always aligned on a dword boundary.
+func (sc *sceneCompiler) bakeTextureInColorSpace(mat *input.Material, texNode material.TextureNode, srgb bool) (int32, error) {
 	texPath := string(texNode)
+	if faces, isCubeMap := mat.CubeMaps[texPath]; isCubeMap {
+		return sc.bakeCubeMapTexture(mat, texPath, faces, srgb)
+	}
+	if layerPaths, isArray := mat.TextureArrays[texPath]; isArray {
+		return sc.bakeTextureArray(mat, texPath, layerPaths, srgb)
+	}
+	if strings.Contains(texPath, udimToken) {
+		return sc.bakeUdimTexture(mat, texPath, srgb)
+	}
+	if arrayName, layer, isLayerRef := parseTextureLayerRef(texPath); isLayerRef {
+		if layerPaths, isArray := mat.TextureArrays[arrayName]; isArray {
+			return sc.bakeTextureArrayLayer(mat, arrayName, layerPaths, layer, srgb)
+		}
+	}
+
 	res, err := asset.NewResource(texPath, mat.AssetRelPath)
 	if err != nil {
-		sc.logger.Warningf("%q: skipping missing texture %q", mat.Name, texPath)
+		sc.diagnostics.warnf(StageTextures, -1, "%q: skipping missing texture %q", mat.Name, texPath)
 		return -1, nil
 	}
 
-	// Check if texture is already loaded
-	if texIndex, exists := sc.texIndexCache[res.Path()]; exists {
+	// Check if texture is already loaded. If the texture is shared between
+	// materials use the max requested anisotropy level.
+	cacheKey := textureCacheKey(res.Path(), srgb, mat.PremultipliedAlpha)
+	if texIndex, exists := sc.texIndexCache[cacheKey]; exists {
 		sc.logger.Infof("%q: re-using already loaded texture %q", mat.Name, texPath)
+		meta := &sc.optimizedScene.TextureMetadata[texIndex]
+		if anisotropy := textureAnisotropy(mat, texPath); anisotropy > meta.Anisotropy {
+			meta.Anisotropy = anisotropy
+		}
 		return texIndex, nil
 	}
 
@@ -525,39 +1175,422 @@ func (sc *sceneCompiler) bakeTexture(mat *input.Material, texNode material.Textu
 		return -1, fmt.Errorf("%q: %v", mat.Name, err)
 	}
 
-	dataOffset := len(sc.optimizedScene.TextureData)
-	realLen := len(tex.Data)
-	alignedLen := align4(realLen)
+	// Convert premultiplied alpha to straight alpha so texture filtering
+	// does not produce dark fringes around transparent edges.
+	if mat.PremultipliedAlpha {
+		tex.PremultipliedAlpha = true
+	}
+	if tex.PremultipliedAlpha {
+		sc.logger.Infof("%q: converting premultiplied alpha for texture %q", mat.Name, texPath)
+		tex.Unpremultiply()
+	}
 
-	// Copy data and add alignment padding
-	sc.optimizedScene.TextureData = append(sc.optimizedScene.TextureData, tex.Data...)
-	if alignedLen > realLen {
-		pad := make([]byte, alignedLen-realLen)
-		sc.optimizedScene.TextureData = append(sc.optimizedScene.TextureData, pad...)
+	// Convert sRGB color data to linear space before it is filtered
+	tex.SRGB = srgb
+	if tex.SRGB {
+		sc.logger.Infof("%q: converting texture %q to linear space", mat.Name, texPath)
+		tex.Linearize()
+	}
+	tex.Anisotropy = textureAnisotropy(mat, texPath)
+
+	texIndex := sc.appendTexture(mat, tex)
+	sc.texIndexCache[cacheKey] = texIndex
+	return texIndex, nil
+}
+
+// Load a set of cube map face textures and convert them into a lat/lng
+// texture which can be sampled by the tracer's environment lookups.
+func (sc *sceneCompiler) bakeCubeMapTexture(mat *input.Material, texName string, facePaths [6]string, srgb bool) (int32, error) {
+	var faceRes [6]*asset.Resource
+	var resPaths [6]string
+	for index, facePath := range facePaths {
+		res, err := asset.NewResource(facePath, mat.AssetRelPath)
+		if err != nil {
+			sc.diagnostics.warnf(StageTextures, -1, "%q: skipping cube map %q with missing face texture %q", mat.Name, texName, facePath)
+			return -1, nil
+		}
+		faceRes[index] = res
+		resPaths[index] = res.Path()
+	}
+
+	// Check if the cube map is already loaded
+	cacheKey := textureCacheKey(cubeMapCacheKey(resPaths), srgb, mat.PremultipliedAlpha)
+	if texIndex, exists := sc.texIndexCache[cacheKey]; exists {
+		sc.logger.Infof("%q: re-using already loaded cube map %q", mat.Name, texName)
+		meta := &sc.optimizedScene.TextureMetadata[texIndex]
+		if anisotropy := textureAnisotropy(mat, texName); anisotropy > meta.Anisotropy {
+			meta.Anisotropy = anisotropy
+		}
+		return texIndex, nil
+	}
+
+	sc.logger.Infof("%q: converting cube map %q to lat/lng texture", mat.Name, texName)
+
+	var err error
+	var faces [6]*texture.Texture
+	for index, res := range faceRes {
+		faces[index], err = texture.New(res)
+		if err != nil {
+			return -1, fmt.Errorf("%q: %v", mat.Name, err)
+		}
+	}
+
+	tex, err := texture.NewFromCubeFaces(faces)
+	if err != nil {
+		return -1, fmt.Errorf("%q: %v", mat.Name, err)
+	}
+	if mat.PremultipliedAlpha {
+		tex.PremultipliedAlpha = true
+	}
+	tex.Unpremultiply()
+	tex.SRGB = srgb
+	tex.Linearize()
+	tex.Anisotropy = textureAnisotropy(mat, texName)
+
+	texIndex := sc.appendTexture(mat, tex)
+	sc.texIndexCache[cacheKey] = texIndex
+	return texIndex, nil
+}
+
+// Generate a texture cache key for a set of cube map face resource paths.
+func cubeMapCacheKey(resPaths [6]string) string {
+	return "cubemap:" + strings.Join(resPaths[:], ";")
+}
+
+// Load a set of layer textures and store them as a texture array. All layers
+// must share the same format and dimensions.
+func (sc *sceneCompiler) bakeTextureArray(mat *input.Material, texName string, layerPaths []string, srgb bool) (int32, error) {
+	layerRes := make([]*asset.Resource, len(layerPaths))
+	resPaths := make([]string, len(layerPaths))
+	for index, layerPath := range layerPaths {
+		res, err := asset.NewResource(layerPath, mat.AssetRelPath)
+		if err != nil {
+			sc.diagnostics.warnf(StageTextures, -1, "%q: skipping texture array %q with missing layer texture %q", mat.Name, texName, layerPath)
+			return -1, nil
+		}
+		layerRes[index] = res
+		resPaths[index] = res.Path()
+	}
+
+	// Check if the texture array is already loaded
+	cacheKey := textureCacheKey(textureArrayCacheKey(resPaths), srgb, mat.PremultipliedAlpha)
+	if texIndex, exists := sc.texIndexCache[cacheKey]; exists {
+		sc.logger.Infof("%q: re-using already loaded texture array %q", mat.Name, texName)
+		meta := &sc.optimizedScene.TextureMetadata[texIndex]
+		if anisotropy := textureAnisotropy(mat, texName); anisotropy > meta.Anisotropy {
+			meta.Anisotropy = anisotropy
+		}
+		return texIndex, nil
+	}
+
+	sc.logger.Infof("%q: processing texture array %q with %d layers", mat.Name, texName, len(layerPaths))
+
+	var err error
+	layers := make([]*texture.Texture, len(layerRes))
+	for index, res := range layerRes {
+		layers[index], err = texture.New(res)
+		if err != nil {
+			return -1, fmt.Errorf("%q: %v", mat.Name, err)
+		}
+		if mat.PremultipliedAlpha {
+			layers[index].PremultipliedAlpha = true
+		}
+		if layers[index].PremultipliedAlpha {
+			layers[index].Unpremultiply()
+		}
+		layers[index].SRGB = srgb
+		layers[index].Linearize()
+		layers[index].Anisotropy = textureAnisotropy(mat, texName)
+	}
+
+	err = checkTextureLayers(layers)
+	if err != nil {
+		return -1, fmt.Errorf("%q: texture array %q: %v", mat.Name, texName, err)
+	}
+
+	texIndex := sc.appendTextureLayers(mat, layers)
+	sc.texIndexCache[cacheKey] = texIndex
+	return texIndex, nil
+}
+
+// Load a texture array and return a texture that references one of its layers.
+// The layer texture shares its data with the texture array so materials can
+// sample and blend individual layers without duplicating texture data.
+func (sc *sceneCompiler) bakeTextureArrayLayer(mat *input.Material, arrayName string, layerPaths []string, layer uint32, srgb bool) (int32, error) {
+	arrayIndex, err := sc.bakeTextureArray(mat, arrayName, layerPaths, srgb)
+	if err != nil || arrayIndex < 0 {
+		return arrayIndex, err
+	}
+
+	arrayMeta := sc.optimizedScene.TextureMetadata[arrayIndex]
+	if layer >= arrayMeta.Layers {
+		return -1, fmt.Errorf("%q: texture array %q has %d layers; layer %d is out of range", mat.Name, arrayName, arrayMeta.Layers, layer)
+	}
+
+	cacheKey := fmt.Sprintf("texarray-layer:%d[%d]", arrayIndex, layer)
+	if texIndex, exists := sc.texIndexCache[cacheKey]; exists {
+		meta := &sc.optimizedScene.TextureMetadata[texIndex]
+		if anisotropy := textureAnisotropy(mat, arrayName); anisotropy > meta.Anisotropy {
+			meta.Anisotropy = anisotropy
+		}
+		return texIndex, nil
+	}
+
+	layerMeta := arrayMeta
+	layerMeta.DataOffset = arrayMeta.LayerOffset(layer)
+	layerMeta.Layers = 1
+	sc.optimizedScene.TextureMetadata = append(sc.optimizedScene.TextureMetadata, layerMeta)
+
+	texIndex := int32(len(sc.optimizedScene.TextureMetadata) - 1)
+	sc.texIndexCache[cacheKey] = texIndex
+	return texIndex, nil
+}
+
+// Load the tiles of a UDIM texture and generate a tile lookup table for them.
+// The texture path must contain the <UDIM> token which is replaced by the
+// tile numbers in the [udimFirstTile, udimFirstTile + udimMaxTiles) range.
+// Missing tiles are skipped.
+func (sc *sceneCompiler) bakeUdimTexture(mat *input.Material, texPath string, srgb bool) (int32, error) {
+	cacheKey := textureCacheKey("udim:"+texPath, srgb, mat.PremultipliedAlpha)
+	if texIndex, exists := sc.texIndexCache[cacheKey]; exists {
+		sc.logger.Infof("%q: re-using already loaded UDIM texture %q", mat.Name, texPath)
+		return texIndex, nil
+	}
+
+	tiles := make(map[uint32]int32, 0)
+	for tile := uint32(udimFirstTile); tile < udimFirstTile+udimMaxTiles; tile++ {
+		tilePath := strings.Replace(texPath, udimToken, strconv.Itoa(int(tile)), -1)
+		if _, err := asset.NewResource(tilePath, mat.AssetRelPath); err != nil {
+			continue
+		}
+
+		texIndex, err := sc.bakeTextureInColorSpace(mat, material.TextureNode(tilePath), srgb)
+		if err != nil {
+			return -1, err
+		}
+
+		// Tiles inherit the anisotropy hint of the UDIM texture
+		if texIndex >= 0 {
+			meta := &sc.optimizedScene.TextureMetadata[texIndex]
+			if anisotropy := textureAnisotropy(mat, texPath); anisotropy > meta.Anisotropy {
+				meta.Anisotropy = anisotropy
+			}
+		}
+		tiles[tile] = texIndex
+	}
+
+	if len(tiles) == 0 {
+		sc.diagnostics.warnf(StageTextures, -1, "%q: skipping UDIM texture %q with no tiles", mat.Name, texPath)
+		return -1, nil
+	}
+
+	sc.logger.Infof("%q: processed UDIM texture %q with %d tiles", mat.Name, texPath, len(tiles))
+	texIndex, err := sc.appendUdimTexture(tiles)
+	if err != nil {
+		return -1, fmt.Errorf("%q: UDIM texture %q: %v", mat.Name, texPath, err)
+	}
+	sc.texIndexCache[cacheKey] = texIndex
+	return texIndex, nil
+}
+
+// Append a UDIM tile lookup table that maps UDIM tile numbers to texture
+// indices and return the texture index for it. The table is stored in the
+// texture data as a row-major grid of int32 values with udimTileColumns
+// columns and as many rows as needed to fit the highest tile number.
+func (sc *sceneCompiler) appendUdimTexture(tiles map[uint32]int32) (int32, error) {
+	var maxTile uint32
+	for tile := range tiles {
+		if tile < udimFirstTile || tile >= udimFirstTile+udimMaxTiles {
+			return -1, fmt.Errorf("tile %d is out of the supported [%d, %d) range", tile, udimFirstTile, udimFirstTile+udimMaxTiles)
+		}
+		if tile > maxTile {
+			maxTile = tile
+		}
+	}
+
+	rows := (maxTile-udimFirstTile)/udimTileColumns + 1
+	table := make([]int32, rows*udimTileColumns)
+	for index := range table {
+		table[index] = -1
+	}
+	for tile, texIndex := range tiles {
+		table[tile-udimFirstTile] = texIndex
+	}
+
+	dataOffset := len(sc.optimizedScene.TextureData)
+	for _, texIndex := range table {
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], uint32(texIndex))
+		sc.optimizedScene.TextureData = append(sc.optimizedScene.TextureData, buf[:]...)
 	}
 
-	// Setup metadata
 	sc.optimizedScene.TextureMetadata = append(
 		sc.optimizedScene.TextureMetadata,
 		scene.TextureMetadata{
-			Format:     tex.Format,
-			Width:      tex.Width,
-			Height:     tex.Height,
-			DataOffset: uint32(dataOffset),
+			Format:        texture.Udim,
+			Width:         udimTileColumns,
+			Height:        rows,
+			DataOffset:    uint32(dataOffset),
+			Layers:        1,
+			LayerStride:   uint32(4 * len(table)),
+			Anisotropy:    1,
+			MipLevelCount: 1,
+			MipLevels:     [scene.MaxMipLevels]scene.MipLevel{{Width: udimTileColumns, Height: rows}},
 		},
 	)
 
-	texIndex := int32(len(sc.optimizedScene.TextureMetadata) - 1)
-	sc.texIndexCache[res.Path()] = texIndex
-	return texIndex, nil
+	return int32(len(sc.optimizedScene.TextureMetadata) - 1), nil
+}
+
+// Generate a texture cache key for a texture that is baked in the requested
+// color space. Textures shared between color and data inputs are baked once
+// for each color space. Likewise, textures shared between materials that
+// treat their alpha channel as premultiplied and straight alpha are baked
+// once for each alpha mode.
+func textureCacheKey(key string, srgb, premultipliedAlpha bool) string {
+	if premultipliedAlpha {
+		key = "premultiplied:" + key
+	}
+	if srgb {
+		return "srgb:" + key
+	}
+	return key
+}
+
+// Generate a texture cache key for a set of texture array layer resource paths.
+func textureArrayCacheKey(resPaths []string) string {
+	return "texarray:" + strings.Join(resPaths, ";")
+}
+
+// Parse a texture array layer reference in "name[layer]" format.
+func parseTextureLayerRef(texPath string) (string, uint32, bool) {
+	open := strings.LastIndex(texPath, "[")
+	if open < 1 || !strings.HasSuffix(texPath, "]") {
+		return "", 0, false
+	}
+
+	layer, err := strconv.ParseUint(texPath[open+1:len(texPath)-1], 10, 32)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return texPath[:open], uint32(layer), true
+}
+
+// Ensure that a set of texture array layers share the same format and dimensions.
+func checkTextureLayers(layers []*texture.Texture) error {
+	if len(layers) == 0 {
+		return fmt.Errorf("no layers defined")
+	}
+
+	for index, layer := range layers[1:] {
+		if layer.Format != layers[0].Format || layer.Width != layers[0].Width || layer.Height != layers[0].Height {
+			return fmt.Errorf(
+				"layer %d (%s %dx%d) does not match the format and dimensions of layer 0 (%s %dx%d)",
+				index+1, layer.Format, layer.Width, layer.Height,
+				layers[0].Format, layers[0].Width, layers[0].Height,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Append texture data and metadata to the optimized scene and return the
+// new texture index.
+func (sc *sceneCompiler) appendTexture(mat *input.Material, tex *texture.Texture) int32 {
+	return sc.appendTextureLayers(mat, []*texture.Texture{tex})
+}
+
+// Append the data for a set of texture layers and a single metadata entry
+// describing them to the optimized scene and return the new texture index.
+// Layers are stored contiguously. The texture data offset and the length of
+// each layer mip level are padded to the alignment of the texture format so
+// that byte and float textures can be mixed in the same scene. Callers must
+// ensure that all layers share the same format and dimensions.
+func (sc *sceneCompiler) appendTextureLayers(mat *input.Material, layers []*texture.Texture) int32 {
+	alignment := layers[0].Format.Alignment()
+	sc.padTextureData(alignment)
+
+	meta := scene.TextureMetadata{
+		Format:     layers[0].Format,
+		Width:      layers[0].Width,
+		Height:     layers[0].Height,
+		DataOffset: uint32(len(sc.optimizedScene.TextureData)),
+		Layers:     uint32(len(layers)),
+		Anisotropy: layers[0].Anisotropy,
+		WrapMode:   layers[0].WrapMode,
+	}
+	if meta.Anisotropy < 1 {
+		meta.Anisotropy = 1
+	}
+	if layers[0].SRGB {
+		meta.SRGB = 1
+	}
+
+	// Copy the data for each layer mip level and add alignment padding
+	for layerIndex, layer := range layers {
+		levels := []*texture.Texture{layer}
+		if sc.generateMipmaps {
+			levels = layer.MipChain(scene.MaxMipLevels)
+		}
+
+		var layerLen int
+		for levelIndex, level := range levels {
+			realLen := level.Format.DataLen(level.Width, level.Height)
+			alignedLen := alignTo(realLen, alignment)
+
+			// Copy the level data and zero-pad any missing texels
+			levelData := make([]byte, alignedLen)
+			copy(levelData[:realLen], level.Data)
+			sc.optimizedScene.TextureData = append(sc.optimizedScene.TextureData, levelData...)
+
+			// All layers share the same level layout
+			if layerIndex == 0 {
+				meta.MipLevels[levelIndex] = scene.MipLevel{
+					Offset: uint32(layerLen),
+					Width:  level.Width,
+					Height: level.Height,
+				}
+			}
+			layerLen += alignedLen
+		}
+
+		meta.MipLevelCount = uint32(len(levels))
+		meta.LayerStride = uint32(layerLen)
+	}
+
+	sc.optimizedScene.TextureMetadata = append(sc.optimizedScene.TextureMetadata, meta)
+	return int32(len(sc.optimizedScene.TextureMetadata) - 1)
+}
+
+// Get the anisotropic filtering level hint for a texture referenced by a
+// material.
+func textureAnisotropy(mat *input.Material, texName string) uint32 {
+	if anisotropy := mat.TextureAnisotropy[texName]; anisotropy > 1 {
+		return anisotropy
+	}
+	return 1
+}
+
+// Pad the optimized scene texture data with zeroes so that its length is a
+// multiple of alignment.
+func (sc *sceneCompiler) padTextureData(alignment int) {
+	dataLen := len(sc.optimizedScene.TextureData)
+	if alignedLen := alignTo(dataLen, alignment); alignedLen > dataLen {
+		sc.optimizedScene.TextureData = append(sc.optimizedScene.TextureData, make([]byte, alignedLen-dataLen)...)
+	}
 }
 
 // Adjust value so its divisible by 4.
 func align4(value int) int {
-	for {
-		if value%4 == 0 {
-			return value
-		}
-		value++
+	return alignTo(value, 4)
+}
+
+// Adjust value so its divisible by alignment.
+func alignTo(value, alignment int) int {
+	if rem := value % alignment; rem != 0 {
+		return value + alignment - rem
 	}
+	return value
 }
@@ -2,53 +2,53 @@ package compiler
 
 import (
 	"bytes"
-	"reflect"
 	"testing"
 
-	"github.com/achilleasa/polaris/scene"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/texure"
+	"github.com/achilleasa/polaris/log"
 	"github.com/achilleasa/polaris/types"
 )
 
 func TestAlign16(t *testing.T) {
 	for i := 1; i <= 16; i++ {
 		if align4(i)%4 != 0 {
-			t.Fatalf("expected align4(%d) % 4 to be 0; got %d", i, align4(i)%4)
+			t.Fatalf("expected align4(%d) %% 4 to be 0; got %d", i, align4(i)%4)
+		}
+		if aligned := alignTo(i, 16); aligned%16 != 0 || aligned < i {
+			t.Fatalf("expected alignTo(%d, 16) to be the next multiple of 16; got %d", i, aligned)
 		}
 	}
 }
 
 func TestBakeTexture(t *testing.T) {
-	ps := &scene.ParsedScene{
-		Textures: make([]*scene.ParsedTexture, 0),
-	}
-
-	ps.Textures = append(ps.Textures, &scene.ParsedTexture{
-		Width:  2,
-		Height: 1,
-		Format: scene.Rgba8,
-		Data: []byte{
-			0xBA, 0xDF, 0x00, 0x0D,
-			0xBA, 0xDC, 0x00, 0xEE,
+	textures := []*texture.Texture{
+		{
+			Width:  2,
+			Height: 1,
+			Format: texture.Rgba8,
+			Data: []byte{
+				0xBA, 0xDF, 0x00, 0x0D,
+				0xBA, 0xDC, 0x00, 0xEE,
+			},
 		},
-	})
-
-	ps.Textures = append(ps.Textures, &scene.ParsedTexture{
-		Width:  1,
-		Height: 2,
-		Format: scene.Rgba8,
-		Data: []byte{
-			0xDE, 0xAD, 0xBE, 0xEF,
-			0xF0, 0x0B, 0xAF, 0x00,
+		{
+			Width:  1,
+			Height: 3,
+			Format: texture.Luminance8,
+			Data:   []byte{0xDE, 0xAD, 0xBE},
 		},
-	})
+	}
 
 	sc := &sceneCompiler{
-		parsedScene:    ps,
 		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
 	}
-	err := sc.bakeTextures()
-	if err != nil {
-		t.Fatal(err)
+	mat := &input.Material{Name: "default"}
+	for _, tex := range textures {
+		sc.appendTexture(mat, tex)
 	}
 	os := sc.optimizedScene
 
@@ -56,100 +56,60 @@ func TestBakeTexture(t *testing.T) {
 	if len(os.TextureMetadata) != expCount {
 		t.Fatalf("expected optimized scene to contain %d texture meta entries; got %d", expCount, len(os.TextureMetadata))
 	}
-	expCount = int(align4(len(ps.Textures[0].Data)) + align4(len(ps.Textures[1].Data)))
-	if len(os.TextureData) != expCount {
-		t.Fatalf("expected optimized texture data len to be %d; got %d", expCount, len(os.TextureData))
-	}
 
 	var expOffset uint32 = 0
-	for index, psTex := range ps.Textures {
+	for index, tex := range textures {
 		osTex := os.TextureMetadata[index]
 
-		if osTex.Width != psTex.Width {
-			t.Fatalf("[tex %d] expected texture width to be %d; got %d", index, psTex.Width, osTex.Width)
+		if osTex.Width != tex.Width {
+			t.Fatalf("[tex %d] expected texture width to be %d; got %d", index, tex.Width, osTex.Width)
 		}
-		if osTex.Height != psTex.Height {
-			t.Fatalf("[tex %d] expected texture height to be %d; got %d", index, psTex.Height, osTex.Height)
+		if osTex.Height != tex.Height {
+			t.Fatalf("[tex %d] expected texture height to be %d; got %d", index, tex.Height, osTex.Height)
 		}
-		if osTex.Format != psTex.Format {
-			t.Fatalf("[tex %d] expected texture format to be %d; got %d", index, psTex.Format, osTex.Format)
+		if osTex.Format != tex.Format {
+			t.Fatalf("[tex %d] expected texture format to be %d; got %d", index, tex.Format, osTex.Format)
 		}
 		if osTex.DataOffset != expOffset {
 			t.Fatalf("[tex %d] expected data offset to be %d; got %d", index, expOffset, osTex.DataOffset)
 		}
-		osData := os.TextureData[expOffset : expOffset+uint32(len(psTex.Data))]
-		if !bytes.Equal(osData, psTex.Data) {
+		osData := os.TextureData[expOffset : expOffset+uint32(len(tex.Data))]
+		if !bytes.Equal(osData, tex.Data) {
 			t.Fatalf("[tex %d] expected copied data to be equal to original texture data", index)
 		}
-		expOffset += align4(len(psTex.Data))
+		expOffset += uint32(align4(len(tex.Data)))
 	}
-}
 
-func TestPartitionGeometry(t *testing.T) {
-	ps := &scene.ParsedScene{
-		Meshes: []*scene.ParsedMesh{
-			&scene.ParsedMesh{
-				Name: "triangle",
-				Primitives: []*scene.ParsedPrimitive{
-					&scene.ParsedPrimitive{
-						Vertices: [3]types.Vec3{
-							{0, 0, 0},
-							{1.0, 0, 0},
-							{0.5, 1.0, 0},
-						},
-						Normals: [3]types.Vec3{
-							{0, 0, -1},
-							{0, 0, -1},
-							{0, 0, -1},
-						},
-						UVs: [3]types.Vec2{
-							{0, 0},
-							{1.0, 0},
-							{0.5, 1.0},
-						},
-					},
-				},
-			},
-		},
-		MeshInstances: []*scene.ParsedMeshInstance{
-			&scene.ParsedMeshInstance{
-				MeshIndex: 0,
-				Transform: types.Translate4(types.Vec3{0, 0, -2}),
-			},
-			&scene.ParsedMeshInstance{
-				MeshIndex: 0,
-				Transform: types.Ident4(),
-			},
-		},
+	if len(os.TextureData) != int(expOffset) {
+		t.Fatalf("expected optimized texture data len to be %d; got %d", expOffset, len(os.TextureData))
 	}
+}
 
-	bbox := [2]types.Vec3{
-		{0, 0, 0},
-		{1.0, 1.0, 0},
-	}
-	center := types.Vec3{0.5, 0.5, 0}
-	ps.Meshes[0].Primitives[0].SetBBox(bbox)
-	ps.Meshes[0].Primitives[0].SetCenter(center)
-	ps.Meshes[0].SetBBox(bbox)
+func TestPartitionGeometry(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "default",
+		Expression: "diffuse()",
+		Used:       true,
+	})
+	mesh := genTestMesh("triangle", 1, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{
+		genTestMeshInstance(mesh),
+		genTestMeshInstance(mesh),
+	}
+	ps.MeshInstances[0].Transform = types.Translate4(types.Vec3{0, 0, -2})
+	bbox := mesh.BBox()
 	ps.MeshInstances[0].SetBBox([2]types.Vec3{
 		ps.MeshInstances[0].Transform.Mul4x1(bbox[0].Vec4(1)).Vec3(),
 		ps.MeshInstances[0].Transform.Mul4x1(bbox[1].Vec4(1)).Vec3(),
 	})
-	ps.MeshInstances[0].SetCenter(ps.MeshInstances[0].Transform.Mul4x1(center.Vec4(1.0)).Vec3())
-	ps.MeshInstances[1].SetBBox(bbox)
-	ps.MeshInstances[1].SetCenter(center)
+	ps.MeshInstances[0].SetCenter(ps.MeshInstances[0].Transform.Mul4x1(ps.MeshInstances[1].Center().Vec4(1)).Vec3())
 
-	sc := &sceneCompiler{
-		parsedScene: ps,
-		optimizedScene: &scene.Scene{
-			MaterialNodeRoots: []uint32{0},
-		},
-	}
-	err := sc.partitionGeometry()
+	os, _, err := Compile(ps, DefaultOptions())
 	if err != nil {
 		t.Fatal(err)
 	}
-	os := sc.optimizedScene
 
 	expCount := 3
 	if len(os.VertexList) != expCount {
@@ -166,83 +126,39 @@ func TestPartitionGeometry(t *testing.T) {
 		t.Fatalf("expected optimized material index count to be %d; got %d", expCount, len(os.MaterialIndex))
 	}
 
-	expCount = 4
-	if len(os.BvhNodeList) != expCount {
-		t.Fatalf("expected bvh node count to be %d; got %d", expCount, len(os.BvhNodeList))
-	}
-
 	expCount = 2
 	if len(os.MeshInstanceList) != expCount {
 		t.Fatalf("expected optimized mesh instance count to be %d; got %d", expCount, len(os.MeshInstanceList))
 	}
 
-	leaf0 := os.BvhNodeList[1]
-	leaf1 := os.BvhNodeList[2]
-	if meshIndex := leaf0.GetMeshIndex(); meshIndex != 0 {
-		t.Fatalf("expected bvh top leaf 0 to point to mesh 0; got %d", meshIndex)
-	}
-	if meshIndex := leaf1.GetMeshIndex(); meshIndex != 1 {
-		t.Fatalf("expected bvh top leaf 1 to point to mesh 1; got %d", meshIndex)
+	// Both instances should share the BVH of the instanced mesh
+	if os.MeshInstanceList[0].BvhRoot != os.MeshInstanceList[1].BvhRoot {
+		t.Fatalf("expected mesh instances to share the same bottom bvh root; got %d and %d", os.MeshInstanceList[0].BvhRoot, os.MeshInstanceList[1].BvhRoot)
 	}
-
-	if os.MeshInstanceList[0].BvhRoot != 3 {
-		t.Fatalf("expected bvh bottom root for mesh instance 0 to be 3; got %d", os.MeshInstanceList[0].BvhRoot)
-	}
-	if os.MeshInstanceList[1].BvhRoot != 3 {
-		t.Fatalf("expected bvh bottom root for mesh instance 1 to be 3; got %d", os.MeshInstanceList[1].BvhRoot)
+	meshRoot := os.BvhNodeList[os.MeshInstanceList[0].BvhRoot]
+	if firstPrim, count := meshRoot.GetPrimitives(); firstPrim != 0 || count != 1 {
+		t.Fatalf("expected bottom bvh root to be a leaf with primitive 0; got first primitive %d and count %d", firstPrim, count)
 	}
 }
 
 func TestCreateLayeredMaterialTrees(t *testing.T) {
-	ps := &scene.ParsedScene{
-		Materials: []*scene.ParsedMaterial{
-			&scene.ParsedMaterial{
-				Kd:        types.Vec3{1, 1, 1},
-				KdTex:     1,
-				NormalTex: 2,
-			},
-			&scene.ParsedMaterial{
-				Ks:        types.Vec3{1, 1, 1},
-				KsTex:     1,
-				NormalTex: 2,
-				//
-				KdTex: -1,
-				KeTex: -1,
-				NiTex: -1,
-			},
-			&scene.ParsedMaterial{
-				NormalTex: 2,
-				Ni:        1.333,
-				NiTex:     1,
-				//
-				KdTex: -1,
-				KsTex: -1,
-				KeTex: -1,
-			},
-			&scene.ParsedMaterial{
-				Ks:        types.Vec3{1, 1, 1},
-				KsTex:     1,
-				NormalTex: 2,
-				Ni:        1.333,
-				NiTex:     3,
-				//
-				KdTex: -1,
-				KeTex: -1,
-			},
-			&scene.ParsedMaterial{
-				Ke:    types.Vec3{10, 10, 10},
-				KeTex: 1,
-				//
-				KdTex: -1,
-				KsTex: -1,
-				NiTex: -1,
-			},
-		},
-	}
-
+	ps := input.NewScene()
+	for _, expr := range []string{
+		"diffuse(reflectance: {0.8, 0.5, 0.2})",
+		"conductor(specularity: {0.9, 0.8, 0.7})",
+		"dielectric(intIOR: 1.333)",
+		"mix(conductor(specularity: {1, 1, 1}), dielectric(intIOR: 1.333), 0.25)",
+		"emissive(radiance: {10, 10, 10})",
+	} {
+		ps.Materials = append(ps.Materials, &input.Material{Expression: expr, Used: true})
+	}
+
+	logger := log.New("scene compiler")
 	sc := &sceneCompiler{
 		parsedScene:    ps,
 		optimizedScene: &scene.Scene{},
+		logger:         logger,
+		diagnostics:    newCompileDiagnostics(logger),
 	}
 
 	err := sc.createLayeredMaterialTrees()
@@ -250,152 +166,58 @@ func TestCreateLayeredMaterialTrees(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if len(sc.optimizedScene.MaterialNodeRoots) != len(ps.Materials) {
-		t.Fatalf("expected len(MaterialNodeRoots) to be %d; got %d", len(ps.Materials), len(sc.optimizedScene.MaterialNodeRoots))
+	if len(sc.optimizedScene.MaterialRoots) != len(ps.Materials) {
+		t.Fatalf("expected len(MaterialRoots) to be %d; got %d", len(ps.Materials), len(sc.optimizedScene.MaterialRoots))
 	}
 
-	var node scene.MaterialNode
-	var expValue int32
-	var matIndex int
-
-	// First material should be diffuse
-	matIndex = 0
-	node = sc.optimizedScene.MaterialNodeList[sc.optimizedScene.MaterialNodeRoots[matIndex]]
-
-	if !reflect.DeepEqual(node.Kval, ps.Materials[matIndex].Kd.Vec4(0)) {
-		t.Fatalf("[mat %d] expected Kval to be %#+v; got %#+v", matIndex, ps.Materials[matIndex].Kd, node.Kval)
+	nodeFor := func(matIndex int) scene.MaterialNode {
+		return sc.optimizedScene.MaterialNodeList[sc.optimizedScene.MaterialRoots[matIndex]]
 	}
-
-	expValue = ps.Materials[matIndex].KdTex
-	if node.UnionData[0] != expValue {
-		t.Fatalf("[mat %d] expected Kval tex index to be %d; got %d", matIndex, expValue, node.UnionData[matIndex])
+	expectBxdf := func(label string, node scene.MaterialNode, exp material.BxdfType) {
+		if got := material.BxdfType(node.Union1[0]); got != exp {
+			t.Fatalf("[%s] expected BxDF type to be %s; got %s", label, exp, got)
+		}
 	}
 
-	expValue = ps.Materials[matIndex].NormalTex
-	if node.UnionData[1] != expValue {
-		t.Fatalf("[mat %d] expected Normal tex index to be %d; got %d", matIndex, expValue, node.UnionData[1])
+	// First material should be diffuse
+	node := nodeFor(0)
+	expectBxdf("mat 0", node, material.BxdfDiffuse)
+	if exp := (types.Vec4{0.8, 0.5, 0.2, 0}); node.Union2 != exp {
+		t.Fatalf("[mat 0] expected reflectance to be %v; got %v", exp, node.Union2)
 	}
-
-	if node.UnionData[3] != int32(scene.Diffuse) {
-		t.Fatalf("[mat %d] expected BRDF type to be Diffuse; got %d", matIndex, node.UnionData[3])
+	if node.Union1[3] != -1 {
+		t.Fatalf("[mat 0] expected reflectance tex index to be -1; got %d", node.Union1[3])
 	}
 
 	// Second material should be specular
-	matIndex = 1
-	node = sc.optimizedScene.MaterialNodeList[sc.optimizedScene.MaterialNodeRoots[matIndex]]
-
-	if !reflect.DeepEqual(node.Kval, ps.Materials[matIndex].Ks.Vec4(0)) {
-		t.Fatalf("[mat %d] expected Kval to be %#+v; got %#+v", matIndex, ps.Materials[matIndex].Ks, node.Kval)
-	}
-
-	expValue = ps.Materials[matIndex].KsTex
-	if node.UnionData[0] != expValue {
-		t.Fatalf("[mat %d] expected Kval tex index to be %d; got %d", matIndex, expValue, node.UnionData[matIndex])
-	}
-
-	expValue = ps.Materials[matIndex].NormalTex
-	if node.UnionData[1] != expValue {
-		t.Fatalf("[mat %d] expected Normal tex index to be %d; got %d", matIndex, expValue, node.UnionData[1])
-	}
-
-	if node.UnionData[3] != int32(scene.SpecularReflection) {
-		t.Fatalf("[mat %d] expected BRDF type to be Specular; got %d", matIndex, node.UnionData[3])
+	node = nodeFor(1)
+	expectBxdf("mat 1", node, material.BxdfConductor)
+	if exp := (types.Vec4{0.9, 0.8, 0.7, 0}); node.Union2 != exp {
+		t.Fatalf("[mat 1] expected specularity to be %v; got %v", exp, node.Union2)
 	}
 
 	// Third material should be refractive
-	matIndex = 2
-	node = sc.optimizedScene.MaterialNodeList[sc.optimizedScene.MaterialNodeRoots[matIndex]]
-
-	if node.Nval != ps.Materials[matIndex].Ni {
-		t.Fatalf("[mat %d] expected Nval to be %f; got %f", matIndex, ps.Materials[matIndex].Ni, node.Nval)
-	}
-
-	expValue = ps.Materials[matIndex].NiTex
-	if node.UnionData[2] != expValue {
-		t.Fatalf("[mat %d] expected Ni tex index to be %d; got %d", matIndex, expValue, node.UnionData[2])
-	}
-
-	expValue = ps.Materials[matIndex].NormalTex
-	if node.UnionData[1] != expValue {
-		t.Fatalf("[mat %d] expected Normal tex index to be %d; got %d", matIndex, expValue, node.UnionData[1])
-	}
-
-	if node.UnionData[3] != int32(scene.SpecularTransmission) {
-		t.Fatalf("[mat %d] expected BRDF type to be Refractive; got %d", matIndex, node.UnionData[3])
+	node = nodeFor(2)
+	expectBxdf("mat 2", node, material.BxdfDielectric)
+	if node.Union4[0] != 1.333 {
+		t.Fatalf("[mat 2] expected intIOR to be 1.333; got %f", node.Union4[0])
 	}
 
 	// Fourth material should be a 2-level specular/refractive material
-	matIndex = 3
-	node = sc.optimizedScene.MaterialNodeList[sc.optimizedScene.MaterialNodeRoots[matIndex]]
-
-	if node.IsNode != 1 {
-		t.Fatalf("[mat %d] expected to find an intermediate node; got leaf", matIndex)
-	}
-
-	if node.UnionData[3] != int32(scene.Fresnel) {
-		t.Fatalf("[mat %d] expected material node to specify a Fresnel blend func; got %d", matIndex, node.UnionData[2])
-	}
-
-	// Expect left node to be specular
-	{
-		leftNode := sc.optimizedScene.MaterialNodeList[node.UnionData[0]]
-
-		if !reflect.DeepEqual(leftNode.Kval, ps.Materials[matIndex].Ks.Vec4(0)) {
-			t.Fatalf("[mat %d - left child] expected Kval to be %#+v; got %#+v", matIndex, ps.Materials[matIndex].Ks, leftNode.Kval)
-		}
-
-		expValue = ps.Materials[matIndex].KsTex
-		if leftNode.UnionData[0] != expValue {
-			t.Fatalf("[mat %d - left child] expected Kval tex index to be %d; got %d", matIndex, expValue, leftNode.UnionData[matIndex])
-		}
-
-		expValue = ps.Materials[matIndex].NormalTex
-		if leftNode.UnionData[1] != expValue {
-			t.Fatalf("[mat %d - left child] expected Normal tex index to be %d; got %d", matIndex, expValue, leftNode.UnionData[1])
-		}
-
-		if leftNode.UnionData[3] != int32(scene.SpecularReflection) {
-			t.Fatalf("[mat %d - left child] expected BRDF type to be Specular; got %d", matIndex, leftNode.UnionData[3])
-		}
+	node = nodeFor(3)
+	if op := material.OpType(node.Union1[0]); op != material.OpMix {
+		t.Fatalf("[mat 3] expected root node to be a mix operator; got %d", node.Union1[0])
 	}
-
-	// Expect right node to be refractive
-	{
-		rightNode := sc.optimizedScene.MaterialNodeList[node.UnionData[1]]
-
-		if rightNode.Nval != ps.Materials[matIndex].Ni {
-			t.Fatalf("[mat %d - right child] expected Nval to be %f; got %f", matIndex, ps.Materials[matIndex].Ni, rightNode.Nval)
-		}
-
-		expValue = ps.Materials[matIndex].NiTex
-		if rightNode.UnionData[2] != expValue {
-			t.Fatalf("[mat %d - right child] expected Ni tex index to be %d; got %d", matIndex, expValue, rightNode.UnionData[2])
-		}
-
-		expValue = ps.Materials[matIndex].NormalTex
-		if rightNode.UnionData[1] != expValue {
-			t.Fatalf("[mat %d - right child] expected Normal tex index to be %d; got %d", matIndex, expValue, rightNode.UnionData[1])
-		}
-
-		if rightNode.UnionData[3] != int32(scene.SpecularTransmission) {
-			t.Fatalf("[mat %d - right child] expected BRDF type to be Refractive; got %d", matIndex, rightNode.UnionData[3])
-		}
+	if node.Union2[0] != 0.25 {
+		t.Fatalf("[mat 3] expected mix weight to be 0.25; got %f", node.Union2[0])
 	}
+	expectBxdf("mat 3 - left child", sc.optimizedScene.MaterialNodeList[node.Union1[1]], material.BxdfConductor)
+	expectBxdf("mat 3 - right child", sc.optimizedScene.MaterialNodeList[node.Union1[2]], material.BxdfDielectric)
 
 	// Fifth material should be emissive
-	matIndex = 4
-	node = sc.optimizedScene.MaterialNodeList[sc.optimizedScene.MaterialNodeRoots[matIndex]]
-
-	if !reflect.DeepEqual(node.Kval, ps.Materials[matIndex].Ke.Vec4(0)) {
-		t.Fatalf("[mat %d] expected Kval to be %#+v; got %#+v", matIndex, ps.Materials[matIndex].Ke, node.Kval)
-	}
-
-	expValue = ps.Materials[matIndex].NormalTex
-	if node.UnionData[1] != expValue {
-		t.Fatalf("[mat %d] expected Normal tex index to be %d; got %d", matIndex, expValue, node.UnionData[1])
-	}
-
-	if node.UnionData[3] != int32(scene.Emissive) {
-		t.Fatalf("[mat %d] expected BRDF type to be Emissive; got %d", matIndex, node.UnionData[3])
+	node = nodeFor(4)
+	expectBxdf("mat 4", node, material.BxdfEmissive)
+	if exp := (types.Vec4{10, 10, 10, 0}); node.Union2 != exp {
+		t.Fatalf("[mat 4] expected radiance to be %v; got %v", exp, node.Union2)
 	}
 }
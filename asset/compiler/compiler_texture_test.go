@@ -0,0 +1,470 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/texure"
+	"github.com/achilleasa/polaris/log"
+)
+
+func TestTextureAnisotropy(t *testing.T) {
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
+	}
+
+	tex := &texture.Texture{
+		Format: texture.Rgba8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
+	}
+
+	mat := &input.Material{Name: "default"}
+	specs := []struct {
+		anisotropy    uint32
+		expAnisotropy uint32
+	}{
+		{0, 1},
+		{16, 16},
+	}
+
+	for specIndex, spec := range specs {
+		tex.Anisotropy = spec.anisotropy
+		texIndex := sc.appendTexture(mat, tex)
+		if texIndex != int32(specIndex) {
+			t.Fatalf("[spec %d] expected texture index to be %d; got %d", specIndex, specIndex, texIndex)
+		}
+
+		meta := sc.optimizedScene.TextureMetadata[texIndex]
+		if meta.Anisotropy != spec.expAnisotropy {
+			t.Fatalf("[spec %d] expected texture anisotropy to be %d; got %d", specIndex, spec.expAnisotropy, meta.Anisotropy)
+		}
+		if meta.Width != tex.Width || meta.Height != tex.Height || meta.Format != tex.Format {
+			t.Fatalf("[spec %d] expected texture metadata to match texture properties", specIndex)
+		}
+	}
+}
+
+func TestCompileTextureAnisotropy(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"road.png", "wall.png"} {
+		writeTestPNG(t, filepath.Join(dir, name))
+	}
+	texRes, err := asset.NewResource(filepath.Join(dir, "road.png"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texRes.Close()
+
+	// Both materials share the road texture using different hints while
+	// the wall texture does not define a hint.
+	ps := input.NewScene()
+	ps.Materials = []*input.Material{
+		{
+			Name:              "road",
+			Expression:        `diffuse(reflectance: "road.png")`,
+			AssetRelPath:      texRes,
+			TextureAnisotropy: map[string]uint32{"road.png": 4, "wall.png": 8},
+			Used:              true,
+		},
+		{
+			Name:              "road-wall",
+			Expression:        `mix(diffuse(reflectance: "road.png"), diffuse(reflectance: "wall.png"), 0.5)`,
+			AssetRelPath:      texRes,
+			TextureAnisotropy: map[string]uint32{"road.png": 16},
+			Used:              true,
+		},
+	}
+	mesh := genTestMesh("mesh", 2, 0)
+	mesh.Primitives[1].MaterialIndex = 1
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.TextureMetadata) != 2 {
+		t.Fatalf("expected compiled scene to contain 2 textures; got %d", len(sc.TextureMetadata))
+	}
+
+	// The road texture is baked first and uses the max hint of the
+	// materials sharing it. The wall hint of the road material does not
+	// apply to the road-wall material.
+	expAnisotropy := []uint32{16, 1}
+	for texIndex, meta := range sc.TextureMetadata {
+		if meta.Anisotropy != expAnisotropy[texIndex] {
+			t.Errorf("[texture %d] expected texture anisotropy to be %d; got %d", texIndex, expAnisotropy[texIndex], meta.Anisotropy)
+		}
+	}
+}
+
+// Write a 2x2 RGBA PNG image to the specified path.
+func writeTestPNG(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = png.Encode(f, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTextureWrapMode(t *testing.T) {
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
+	}
+	mat := &input.Material{Name: "default"}
+
+	for _, wrapMode := range []texture.WrapMode{texture.WrapRepeat, texture.WrapClamp, texture.WrapMirror} {
+		texIndex := sc.appendTexture(mat, &texture.Texture{
+			Format:   texture.Luminance8,
+			Width:    1,
+			Height:   1,
+			WrapMode: wrapMode,
+			Data:     []byte{0xFF},
+		})
+
+		if got := sc.optimizedScene.TextureMetadata[texIndex].WrapMode; got != wrapMode {
+			t.Fatalf("expected texture wrap mode to be %s; got %s", wrapMode, got)
+		}
+	}
+}
+
+func TestTextureArrayLayerOffsets(t *testing.T) {
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
+	}
+	mat := &input.Material{Name: "terrain"}
+
+	// Append a regular texture first so the array does not start at offset 0
+	sc.appendTexture(mat, &texture.Texture{
+		Format: texture.Luminance8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{0xFF},
+	})
+
+	// 3x1 luminance layers need a byte of padding each to stay dword-aligned
+	layers := []*texture.Texture{
+		{Format: texture.Luminance8, Width: 3, Height: 1, Data: []byte{1, 2, 3}},
+		{Format: texture.Luminance8, Width: 3, Height: 1, Data: []byte{4, 5, 6}},
+		{Format: texture.Luminance8, Width: 3, Height: 1, Data: []byte{7, 8, 9}},
+	}
+	if err := checkTextureLayers(layers); err != nil {
+		t.Fatal(err)
+	}
+
+	texIndex := sc.appendTextureLayers(mat, layers)
+	if texIndex != 1 {
+		t.Fatalf("expected texture array index to be 1; got %d", texIndex)
+	}
+
+	meta := sc.optimizedScene.TextureMetadata[texIndex]
+	if meta.Layers != 3 {
+		t.Fatalf("expected texture array to have 3 layers; got %d", meta.Layers)
+	}
+	if meta.LayerStride != 4 {
+		t.Fatalf("expected layer stride to be 4; got %d", meta.LayerStride)
+	}
+
+	expOffsets := []uint32{4, 8, 12}
+	for layer, expOffset := range expOffsets {
+		offset := meta.LayerOffset(uint32(layer))
+		if offset != expOffset {
+			t.Fatalf("[layer %d] expected data offset to be %d; got %d", layer, expOffset, offset)
+		}
+		layerData := sc.optimizedScene.TextureData[offset : offset+3]
+		if !bytes.Equal(layerData, layers[layer].Data) {
+			t.Fatalf("[layer %d] expected layer data to be %v; got %v", layer, layers[layer].Data, layerData)
+		}
+	}
+	if expLen := 16; len(sc.optimizedScene.TextureData) != expLen {
+		t.Fatalf("expected texture data length to be %d; got %d", expLen, len(sc.optimizedScene.TextureData))
+	}
+}
+
+func TestTextureArrayLayerMismatch(t *testing.T) {
+	layers := []*texture.Texture{
+		{Format: texture.Rgba8, Width: 2, Height: 2},
+		{Format: texture.Rgba8, Width: 4, Height: 2},
+	}
+
+	expError := "layer 1 (Rgba8 4x2) does not match the format and dimensions of layer 0 (Rgba8 2x2)"
+	err := checkTextureLayers(layers)
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestParseTextureLayerRef(t *testing.T) {
+	specs := []struct {
+		in       string
+		expName  string
+		expLayer uint32
+		expOk    bool
+	}{
+		{"terrain[2]", "terrain", 2, true},
+		{"textures/rock.png", "", 0, false},
+		{"terrain[x]", "", 0, false},
+		{"[1]", "", 0, false},
+	}
+
+	for specIndex, spec := range specs {
+		name, layer, ok := parseTextureLayerRef(spec.in)
+		if name != spec.expName || layer != spec.expLayer || ok != spec.expOk {
+			t.Fatalf("[spec %d] expected (%q, %d, %t); got (%q, %d, %t)", specIndex, spec.expName, spec.expLayer, spec.expOk, name, layer, ok)
+		}
+	}
+}
+
+func TestUdimTextureTiles(t *testing.T) {
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
+	}
+	mat := &input.Material{Name: "skin"}
+
+	tile1001 := sc.appendTexture(mat, &texture.Texture{
+		Format: texture.Rgba8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{0xFF, 0x00, 0x00, 0xFF},
+	})
+	tile1002 := sc.appendTexture(mat, &texture.Texture{
+		Format: texture.Rgba8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{0x00, 0xFF, 0x00, 0xFF},
+	})
+
+	texIndex, err := sc.appendUdimTexture(map[uint32]int32{1001: tile1001, 1002: tile1002})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := sc.optimizedScene.TextureMetadata[texIndex]
+	if meta.Format != texture.Udim || meta.Width != udimTileColumns || meta.Height != 1 {
+		t.Fatalf("expected UDIM metadata with a %dx1 tile table; got %s %dx%d", udimTileColumns, meta.Format, meta.Width, meta.Height)
+	}
+
+	// The tile table is indexed by the (u, v) tile coordinates and stores
+	// the texture index of each tile or -1 for missing tiles
+	specs := []struct {
+		tileX, tileY uint32
+		expIndex     int32
+	}{
+		{0, 0, tile1001},
+		{1, 0, tile1002},
+		{2, 0, -1},
+		{udimTileColumns - 1, 0, -1},
+	}
+
+	for specIndex, spec := range specs {
+		offset := meta.DataOffset + 4*(spec.tileY*meta.Width+spec.tileX)
+		tileIndex := int32(binary.LittleEndian.Uint32(sc.optimizedScene.TextureData[offset : offset+4]))
+		if tileIndex != spec.expIndex {
+			t.Fatalf("[spec %d] expected tile (%d, %d) to map to texture %d; got %d", specIndex, spec.tileX, spec.tileY, spec.expIndex, tileIndex)
+		}
+	}
+
+	if _, err = sc.appendUdimTexture(map[uint32]int32{1101: tile1001}); err == nil {
+		t.Fatal("expected an error for out of range UDIM tile")
+	}
+}
+
+func TestTextureMipmaps(t *testing.T) {
+	mat := &input.Material{Name: "checker"}
+	tex := &texture.Texture{
+		Format: texture.Luminance8,
+		Width:  4,
+		Height: 4,
+		Data: []byte{
+			0, 0, 40, 40,
+			0, 0, 40, 40,
+			80, 80, 120, 120,
+			80, 80, 120, 120,
+		},
+	}
+
+	specs := []struct {
+		generateMipmaps bool
+		expLevels       []scene.MipLevel
+		expStride       uint32
+	}{
+		{false, []scene.MipLevel{{Offset: 0, Width: 4, Height: 4}}, 16},
+		// The 1x1 level is padded to a dword boundary
+		{
+			true,
+			[]scene.MipLevel{
+				{Offset: 0, Width: 4, Height: 4},
+				{Offset: 16, Width: 2, Height: 2},
+				{Offset: 20, Width: 1, Height: 1},
+			},
+			24,
+		},
+	}
+
+	for specIndex, spec := range specs {
+		sc := &sceneCompiler{
+			optimizedScene:  &scene.Scene{},
+			texIndexCache:   make(map[string]int32, 0),
+			generateMipmaps: spec.generateMipmaps,
+		}
+
+		// Use a texture array to check that each layer stores its own levels
+		texIndex := sc.appendTextureLayers(mat, []*texture.Texture{tex, tex})
+		meta := sc.optimizedScene.TextureMetadata[texIndex]
+		if int(meta.MipLevelCount) != len(spec.expLevels) {
+			t.Fatalf("[spec %d] expected %d mip levels; got %d", specIndex, len(spec.expLevels), meta.MipLevelCount)
+		}
+		for levelIndex, expLevel := range spec.expLevels {
+			if meta.MipLevels[levelIndex] != expLevel {
+				t.Fatalf("[spec %d] expected mip level %d to be %+v; got %+v", specIndex, levelIndex, expLevel, meta.MipLevels[levelIndex])
+			}
+		}
+		if meta.LayerStride != spec.expStride {
+			t.Fatalf("[spec %d] expected layer stride to be %d; got %d", specIndex, spec.expStride, meta.LayerStride)
+		}
+		if expLen := 2 * int(spec.expStride); len(sc.optimizedScene.TextureData) != expLen {
+			t.Fatalf("[spec %d] expected texture data length to be %d; got %d", specIndex, expLen, len(sc.optimizedScene.TextureData))
+		}
+
+		if !spec.generateMipmaps {
+			continue
+		}
+
+		// Each texel of the 2x2 level averages a 2x2 block of the base level
+		expLevelData := [][]byte{{0, 40, 80, 120}, {60}}
+		for layer := uint32(0); layer < 2; layer++ {
+			for levelIndex, expData := range expLevelData {
+				offset := meta.MipLevelOffset(layer, uint32(levelIndex+1))
+				data := sc.optimizedScene.TextureData[offset : offset+uint32(len(expData))]
+				if !bytes.Equal(data, expData) {
+					t.Fatalf("[spec %d] expected layer %d mip level %d data to be %v; got %v", specIndex, layer, levelIndex+1, expData, data)
+				}
+			}
+		}
+	}
+}
+
+func TestMixedTextureFormatAlignment(t *testing.T) {
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
+	}
+	mat := &input.Material{Name: "default"}
+
+	specs := []struct {
+		tex       *texture.Texture
+		expOffset uint32
+		expStride uint32
+	}{
+		// 3 bytes padded to 4
+		{&texture.Texture{Format: texture.Luminance8, Width: 3, Height: 1, Data: []byte{1, 2, 3}}, 0, 4},
+		// float textures start at a 16 byte boundary
+		{&texture.Texture{Format: texture.Rgba32F, Width: 1, Height: 1, Data: make([]byte, 16)}, 16, 16},
+		{&texture.Texture{Format: texture.Luminance8, Width: 1, Height: 1, Data: []byte{4}}, 32, 4},
+		// 3 floats padded to 16 bytes
+		{&texture.Texture{Format: texture.Luminance32F, Width: 3, Height: 1, Data: make([]byte, 12)}, 48, 16},
+	}
+
+	for specIndex, spec := range specs {
+		texIndex := sc.appendTexture(mat, spec.tex)
+		meta := sc.optimizedScene.TextureMetadata[texIndex]
+		if meta.DataOffset != spec.expOffset {
+			t.Fatalf("[spec %d] expected data offset to be %d; got %d", specIndex, spec.expOffset, meta.DataOffset)
+		}
+		if meta.LayerStride != spec.expStride {
+			t.Fatalf("[spec %d] expected layer stride to be %d; got %d", specIndex, spec.expStride, meta.LayerStride)
+		}
+	}
+
+	if dataLen := len(sc.optimizedScene.TextureData); dataLen != 64 {
+		t.Fatalf("expected texture data length to be 64; got %d", dataLen)
+	}
+	if !bytes.Equal(sc.optimizedScene.TextureData[:4], []byte{1, 2, 3, 0}) {
+		t.Fatalf("expected first texture data to be zero-padded; got %v", sc.optimizedScene.TextureData[:4])
+	}
+}
+
+func TestTextureSRGBMetadata(t *testing.T) {
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		texIndexCache:  make(map[string]int32, 0),
+	}
+	mat := &input.Material{Name: "albedo", SRGBTextures: true}
+
+	tex := &texture.Texture{
+		Format: texture.Rgba8,
+		Width:  1,
+		Height: 1,
+		SRGB:   true,
+		Data:   []byte{128, 128, 128, 255},
+	}
+	if texIndex := sc.appendTexture(mat, tex); sc.optimizedScene.TextureMetadata[texIndex].SRGB != 1 {
+		t.Fatal("expected metadata of sRGB encoded texture to be flagged as sRGB")
+	}
+
+	// Linearized textures store linear data
+	tex.Linearize()
+	texIndex := sc.appendTexture(mat, tex)
+	meta := sc.optimizedScene.TextureMetadata[texIndex]
+	if meta.SRGB != 0 {
+		t.Fatal("expected metadata of linearized texture to not be flagged as sRGB")
+	}
+	expData := []byte{55, 55, 55, 255}
+	if data := sc.optimizedScene.TextureData[meta.DataOffset : meta.DataOffset+4]; !bytes.Equal(data, expData) {
+		t.Fatalf("expected linearized texture data to be %v; got %v", expData, data)
+	}
+
+	// Color and data inputs referencing the same texture use separate cache entries
+	if textureCacheKey("albedo.png", true, false) == textureCacheKey("albedo.png", false, false) {
+		t.Fatal("expected sRGB and linear textures to use different cache keys")
+	}
+}
+
+func TestTexturePremultipliedAlphaCacheKey(t *testing.T) {
+	logger := log.New("premultiplied alpha test")
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{},
+		logger:         logger,
+		diagnostics:    newCompileDiagnostics(logger),
+		texIndexCache:  make(map[string]int32, 0),
+	}
+	texPath, texIndex := cacheTestTexture(t, sc, "decal.png", &texture.Texture{
+		Format: texture.Rgba8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{64, 64, 64, 128},
+	})
+
+	straight := &input.Material{Name: "straight"}
+	if index, err := sc.bakeTextureInColorSpace(straight, material.TextureNode(texPath), false); err != nil || index != texIndex {
+		t.Fatalf("expected straight alpha material to re-use cached texture %d; got %d (err: %v)", texIndex, index, err)
+	}
+
+	// The cached texture data was not converted from premultiplied alpha so
+	// it must not be shared with materials that request the conversion.
+	premultiplied := &input.Material{Name: "premultiplied", PremultipliedAlpha: true}
+	if index, _ := sc.bakeTextureInColorSpace(premultiplied, material.TextureNode(texPath), false); index == texIndex {
+		t.Fatal("expected premultiplied alpha material to not re-use the texture baked with straight alpha")
+	}
+}
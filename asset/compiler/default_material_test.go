@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMissingMaterialFallsBackToDefault(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "light",
+		Expression: "emissive(radiance: {1, 1, 1})",
+		Used:       true,
+	})
+
+	mesh := genTestMesh("mesh", 4, 0)
+	mesh.Primitives[1].MaterialIndex = 5
+	mesh.Primitives[3].MaterialIndex = -1
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lightRoot := uint32(sc.MaterialRoots[0])
+	defaultCount := 0
+	for primIndex, matRoot := range sc.MaterialIndex {
+		if matRoot == lightRoot {
+			continue
+		}
+		defaultCount++
+
+		node := sc.MaterialNodeList[matRoot]
+		if bxdf := material.BxdfType(node.Union1[0]); bxdf != material.BxdfDiffuse {
+			t.Fatalf("[prim %d] expected default material to use a diffuse bxdf; got %s", primIndex, bxdf)
+		}
+		if expRefl := (types.Vec4{0.7, 0.7, 0.7, 0}); node.Union2 != expRefl {
+			t.Fatalf("[prim %d] expected default material reflectance to be %v; got %v", primIndex, expRefl, node.Union2)
+		}
+	}
+	if defaultCount != 2 {
+		t.Fatalf("expected 2 primitives to be assigned the default material; got %d", defaultCount)
+	}
+
+	// Primitives using the default material should not be treated as emissives
+	if len(sc.EmissivePrimitives) != 2 {
+		t.Fatalf("expected 2 emissive primitives; got %d", len(sc.EmissivePrimitives))
+	}
+}
+
+func TestMissingMaterialUsesSceneDefaultMaterial(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials,
+		&input.Material{
+			Name:       "diffuse",
+			Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+			Used:       true,
+		},
+		&input.Material{
+			Name:       SceneDefaultMaterialName,
+			Expression: "diffuse(reflectance: {0.1, 0.2, 0.3})",
+			Used:       true,
+		},
+	)
+
+	mesh := genTestMesh("mesh", 2, 0)
+	mesh.Primitives[1].MaterialIndex = 42
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expRoots := map[uint32]int{
+		uint32(sc.MaterialRoots[0]): 1,
+		uint32(sc.MaterialRoots[1]): 1,
+	}
+	for _, matRoot := range sc.MaterialIndex {
+		expRoots[matRoot]--
+	}
+	for matRoot, count := range expRoots {
+		if count != 0 {
+			t.Fatalf("unexpected primitive count for material root %d; off by %d", matRoot, count)
+		}
+	}
+}
+
+func genTestMeshInstance(mesh *input.Mesh) *input.MeshInstance {
+	mi := &input.MeshInstance{
+		MeshIndex: 0,
+		Transform: types.Ident4(),
+	}
+	bbox := mesh.BBox()
+	mi.SetBBox(bbox)
+	mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+	return mi
+}
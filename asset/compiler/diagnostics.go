@@ -0,0 +1,147 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/achilleasa/polaris/asset/compiler/bvh"
+	"github.com/achilleasa/polaris/log"
+)
+
+// The severity of a compiler diagnostic.
+type Severity uint8
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	}
+
+	return "unknown"
+}
+
+// The compilation stage that emitted a diagnostic.
+type Stage uint8
+
+const (
+	StageMaterials Stage = iota
+	StageTextures
+	StageGeometry
+	StageLights
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageMaterials:
+		return "materials"
+	case StageTextures:
+		return "textures"
+	case StageGeometry:
+		return "geometry"
+	case StageLights:
+		return "lights"
+	}
+
+	return "unknown"
+}
+
+// A structured diagnostic emitted while compiling a scene.
+type Diagnostic struct {
+	Severity Severity
+	Stage    Stage
+	Message  string
+
+	// The index of the item that the diagnostic refers to or -1 if the
+	// diagnostic is not related to a particular item. Depending on the
+	// stage, this is either a material node index or a mesh index.
+	Index int
+}
+
+func (d Diagnostic) String() string {
+	if d.Index < 0 {
+		return fmt.Sprintf("[%s] %s: %s", d.Severity, d.Stage, d.Message)
+	}
+	return fmt.Sprintf("[%s] %s (index %d): %s", d.Severity, d.Stage, d.Index, d.Message)
+}
+
+// CompileDiagnostics aggregates the diagnostics emitted while compiling a
+// scene so that tools can present them to the user. Diagnostics are also
+// forwarded to the compiler logger as they are emitted.
+type CompileDiagnostics struct {
+	logger  log.Logger
+	entries []Diagnostic
+
+	// The build statistics for the top-level instance BVH and the BVH of
+	// each compiled mesh range.
+	instanceBvhStats bvh.Stats
+	meshBvhStats     []bvh.Stats
+}
+
+func newCompileDiagnostics(logger log.Logger) *CompileDiagnostics {
+	return &CompileDiagnostics{
+		logger:  logger,
+		entries: make([]Diagnostic, 0),
+	}
+}
+
+// Get the list of emitted diagnostics in emission order.
+func (cd *CompileDiagnostics) Entries() []Diagnostic {
+	return cd.entries
+}
+
+// Get the diagnostics emitted by a particular compilation stage.
+func (cd *CompileDiagnostics) ForStage(stage Stage) []Diagnostic {
+	out := make([]Diagnostic, 0)
+	for _, d := range cd.entries {
+		if d.Stage == stage {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Get the number of diagnostics with the given severity.
+func (cd *CompileDiagnostics) Count(severity Severity) int {
+	count := 0
+	for _, d := range cd.entries {
+		if d.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// Get the build statistics for the top-level BVH that partitions the scene
+// mesh instances.
+func (cd *CompileDiagnostics) InstanceBvhStats() bvh.Stats {
+	return cd.instanceBvhStats
+}
+
+// Get the build statistics for each mesh BVH. The returned list is indexed
+// by the MeshRanges index of each mesh in the compiled scene.
+func (cd *CompileDiagnostics) MeshBvhStats() []bvh.Stats {
+	return cd.meshBvhStats
+}
+
+// Record a warning diagnostic.
+func (cd *CompileDiagnostics) warnf(stage Stage, index int, format string, args ...interface{}) {
+	d := cd.add(SeverityWarning, stage, index, format, args...)
+	cd.logger.Warning(d.Message)
+}
+
+func (cd *CompileDiagnostics) add(severity Severity, stage Stage, index int, format string, args ...interface{}) Diagnostic {
+	d := Diagnostic{
+		Severity: severity,
+		Stage:    stage,
+		Message:  fmt.Sprintf(format, args...),
+		Index:    index,
+	}
+	cd.entries = append(cd.entries, d)
+	return d
+}
@@ -0,0 +1,95 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestCompileDiagnostics(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials,
+		&input.Material{
+			Name:       "rough",
+			Expression: "roughConductor(roughness: 0.01)",
+			Used:       true,
+		},
+		&input.Material{
+			Name:       "light",
+			Expression: "emissive(radiance: {1, 1, 1})",
+			Used:       true,
+		},
+	)
+
+	mesh := genTestMesh("mesh", 3, 0)
+	mesh.Primitives[1].MaterialIndex = 1
+	// Collapse the last primitive into a line
+	mesh.Primitives[2].Vertices[2] = types.Vec3{2, 2, 0}
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, diagnostics, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := diagnostics.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 diagnostics; got %d: %v", len(entries), entries)
+	}
+	if got := diagnostics.Count(SeverityWarning); got != 2 {
+		t.Fatalf("expected 2 warnings; got %d", got)
+	}
+
+	matDiags := diagnostics.ForStage(StageMaterials)
+	if len(matDiags) != 1 {
+		t.Fatalf("expected 1 material diagnostic; got %d", len(matDiags))
+	}
+	roughNode := sc.MaterialNodeList[matDiags[0].Index]
+	if roughNode.Union1[0] != int32(material.BxdfRoughtConductor) {
+		t.Fatalf("expected material diagnostic to refer to the rough conductor node; got node type %d", roughNode.Union1[0])
+	}
+	if roughNode.Union4[2] != material.MinRoughness {
+		t.Fatalf("expected roughness to be clamped to %v; got %v", material.MinRoughness, roughNode.Union4[2])
+	}
+
+	geomDiags := diagnostics.ForStage(StageGeometry)
+	if len(geomDiags) != 1 {
+		t.Fatalf("expected 1 geometry diagnostic; got %d", len(geomDiags))
+	}
+	if geomDiags[0].Index != 0 {
+		t.Fatalf("expected geometry diagnostic to refer to mesh 0; got %d", geomDiags[0].Index)
+	}
+}
+
+func TestCompileBvhStats(t *testing.T) {
+	mesh := genTestMesh("mesh", 32, 0)
+	ps := genOpacityTestScene(mesh)
+
+	sc, diagnostics, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instanceStats := diagnostics.InstanceBvhStats()
+	if instanceStats.Nodes != 1 || instanceStats.Leafs != 1 || instanceStats.Items != 1 {
+		t.Fatalf("expected instance BVH to contain a single leaf; got %+v", instanceStats)
+	}
+
+	meshStats := diagnostics.MeshBvhStats()
+	if len(meshStats) != len(sc.MeshRanges) {
+		t.Fatalf("expected stats for %d mesh BVHs; got %d", len(sc.MeshRanges), len(meshStats))
+	}
+	stats := meshStats[0]
+	if uint32(stats.Nodes) != sc.MeshRanges[0].BvhNodeCount {
+		t.Fatalf("expected mesh BVH node count to be %d; got %d", sc.MeshRanges[0].BvhNodeCount, stats.Nodes)
+	}
+	if stats.Items != len(mesh.Primitives) {
+		t.Fatalf("expected mesh BVH leafs to contain %d primitives; got %d", len(mesh.Primitives), stats.Items)
+	}
+	if stats.MinLeafItems > stats.MaxLeafItems || stats.AvgLeafItems != float32(stats.Items)/float32(stats.Leafs) {
+		t.Fatalf("inconsistent mesh BVH leaf stats: %+v", stats)
+	}
+}
@@ -0,0 +1,104 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+// Move a compiled scene mesh instance by replacing its local to world
+// transformation matrix. The emissive primitives of the instance are updated
+// to use the new transform and the bounding boxes of the top-level BVH nodes
+// that contain the instance are refitted.
+//
+// The top-level BVH topology is not rebuilt so moving instances far away
+// from their original location degrades the traversal performance until the
+// scene is recompiled.
+func UpdateMeshInstanceTransform(optimizedScene *scene.Scene, instanceIndex uint32, transform types.Mat4) error {
+	if int(instanceIndex) >= len(optimizedScene.MeshInstanceList) {
+		return fmt.Errorf("scene compiler: unknown mesh instance index %d", instanceIndex)
+	}
+	if optimizedScene.HasMotion() {
+		return fmt.Errorf("scene compiler: moving instances of scenes with motion-blurred instances is not supported")
+	}
+
+	mi := &optimizedScene.MeshInstanceList[instanceIndex]
+	mr := optimizedScene.MeshRanges[mi.MeshIndex]
+	oldTransform := mi.Transform
+
+	// We need to invert the transformation matrix when performing ray traversal
+	mi.Transform = transform.Inv()
+
+	// Each instance gets a copy of the emissive primitives of its mesh that
+	// shares the instance transform. If other instances of the same mesh
+	// use the same transform, only a single copy of each primitive is moved.
+	moved := make(map[uint32]bool)
+	for index := range optimizedScene.EmissivePrimitives {
+		emp := &optimizedScene.EmissivePrimitives[index]
+		if emp.Type != scene.AreaLight || emp.Transform != oldTransform ||
+			emp.PrimitiveIndex < mr.FirstPrimitive || emp.PrimitiveIndex >= mr.FirstPrimitive+mr.PrimitiveCount ||
+			moved[emp.PrimitiveIndex] {
+			continue
+		}
+
+		emp.Transform = mi.Transform
+		moved[emp.PrimitiveIndex] = true
+	}
+
+	// Refit the top-level BVH if the scene contains one
+	if len(optimizedScene.MeshRanges) > 0 && optimizedScene.MeshRanges[0].BvhRoot > 0 {
+		refitInstanceBvh(optimizedScene, 0, instanceIndex)
+	}
+
+	return nil
+}
+
+// Replace a node of the compiled scene material node list. As the new node
+// may use a different bxdf, the scene material analysis is repeated.
+func UpdateMaterialNode(optimizedScene *scene.Scene, nodeIndex uint32, node scene.MaterialNode) error {
+	if int(nodeIndex) >= len(optimizedScene.MaterialNodeList) {
+		return fmt.Errorf("scene compiler: unknown material node index %d", nodeIndex)
+	}
+
+	optimizedScene.MaterialNodeList[nodeIndex] = node
+	optimizedScene.AllDiffuse = allDiffuseMaterials(optimizedScene)
+	return nil
+}
+
+// Recursively update the bounding boxes of the top-level BVH nodes that
+// contain the given mesh instance.
+func refitInstanceBvh(optimizedScene *scene.Scene, nodeIndex uint32, instanceIndex uint32) [2]types.Vec3 {
+	node := &optimizedScene.BvhNodeList[nodeIndex]
+
+	// Leaf node; recalculate the leaf bbox from the root node of the mesh
+	// BVH of each leaf instance if the leaf contains the moved instance.
+	if node.LData <= 0 {
+		first, count := node.GetMeshInstances()
+		if instanceIndex < first || instanceIndex >= first+count {
+			return [2]types.Vec3{node.Min, node.Max}
+		}
+
+		leafBBox := [2]types.Vec3{
+			types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+			types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+		}
+		for _, mi := range optimizedScene.MeshInstanceList[first : first+count] {
+			root := optimizedScene.BvhNodeList[mi.BvhRoot]
+			instBBox := transformBBox(mi.Transform.Inv(), [2]types.Vec3{root.Min, root.Max})
+			leafBBox[0] = types.MinVec3(leafBBox[0], instBBox[0])
+			leafBBox[1] = types.MaxVec3(leafBBox[1], instBBox[1])
+		}
+		node.SetBBox(leafBBox)
+		return [2]types.Vec3{node.Min, node.Max}
+	}
+
+	left := refitInstanceBvh(optimizedScene, uint32(node.LData), instanceIndex)
+	right := refitInstanceBvh(optimizedScene, uint32(node.RData), instanceIndex)
+	node.SetBBox([2]types.Vec3{
+		types.MinVec3(left[0], right[0]),
+		types.MaxVec3(left[1], right[1]),
+	})
+	return [2]types.Vec3{node.Min, node.Max}
+}
@@ -0,0 +1,140 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestUpdateMeshInstanceTransform(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "light",
+		Expression: "emissive(radiance: {1, 1, 1})",
+		Used:       true,
+	})
+	ps.Meshes = []*input.Mesh{
+		genTestMesh("diffuse", 4, 0),
+		genTestMesh("light", 2, 1),
+	}
+	instances := []struct {
+		meshIndex uint32
+		x         float32
+	}{
+		{0, 0},
+		{1, 5},
+		{1, 10},
+	}
+	for _, spec := range instances {
+		transform := types.Translate4(types.Vec3{spec.x, 0, 0})
+		mi := &input.MeshInstance{
+			MeshIndex: spec.meshIndex,
+			Transform: transform,
+		}
+		bbox := transformBBox(transform, ps.Meshes[mi.MeshIndex].BBox())
+		mi.SetBBox(bbox)
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Locate the moved instance as the compiler may reorder instances
+	var movedIndex uint32
+	oldTransform := types.Translate4(types.Vec3{10, 0, 0}).Inv()
+	for index, mi := range sc.MeshInstanceList {
+		if mi.Transform == oldTransform {
+			movedIndex = uint32(index)
+		}
+	}
+	otherTransform := types.Translate4(types.Vec3{5, 0, 0}).Inv()
+
+	err = UpdateMeshInstanceTransform(sc, movedIndex, types.Translate4(types.Vec3{20, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newTransform := types.Translate4(types.Vec3{20, 0, 0}).Inv()
+	if sc.MeshInstanceList[movedIndex].Transform != newTransform {
+		t.Fatalf("expected instance transform to be updated")
+	}
+
+	// Each light instance owns a copy of the 2 mesh emissives
+	var moved, untouched int
+	for index, emp := range sc.EmissivePrimitives {
+		switch emp.Transform {
+		case newTransform:
+			moved++
+		case otherTransform:
+			untouched++
+		default:
+			t.Fatalf("[emissive %d] unexpected emissive transform", index)
+		}
+	}
+	if moved != 2 || untouched != 2 {
+		t.Fatalf("expected 2 moved and 2 untouched emissives; got %d and %d", moved, untouched)
+	}
+
+	if err = validateBvh(sc); err != nil {
+		t.Fatal(err)
+	}
+	if rootMax := sc.BvhNodeList[0].Max; rootMax[0] < 21 {
+		t.Fatalf("expected top-level BVH root bbox to be refitted; got max %v", rootMax)
+	}
+	if _, max := sc.Bounds(); max[0] < 21 {
+		t.Fatalf("expected scene bounds to be refitted; got max %v", max)
+	}
+
+	if err = UpdateMeshInstanceTransform(sc, uint32(len(sc.MeshInstanceList)), types.Ident4()); err == nil {
+		t.Fatal("expected an error for an unknown instance index")
+	}
+}
+
+func TestUpdateMaterialNode(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+	mesh := genTestMesh("mesh", 1, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sc.AllDiffuse {
+		t.Fatal("expected scene to be flagged as all diffuse")
+	}
+
+	nodeIndex := uint32(sc.MaterialRoots[0])
+	node := sc.MaterialNodeList[nodeIndex]
+	node.Union1[0] = int32(material.BxdfConductor)
+	if err = UpdateMaterialNode(sc, nodeIndex, node); err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.MaterialNodeList[nodeIndex] != node {
+		t.Fatal("expected material node to be replaced")
+	}
+	if sc.AllDiffuse {
+		t.Fatal("expected scene to no longer be flagged as all diffuse")
+	}
+
+	if err = UpdateMaterialNode(sc, uint32(len(sc.MaterialNodeList)), scene.MaterialNode{}); err == nil {
+		t.Fatal("expected an error for an unknown material node index")
+	}
+}
@@ -0,0 +1,106 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestCompileAreaLights(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials,
+		&input.Material{
+			Name:       "diffuse",
+			Expression: "diffuse()",
+			Used:       true,
+		},
+		&input.Material{
+			Name:       "light",
+			Expression: "emissive(radiance: {1, 0.5, 0.25}, scale: 4)",
+			Used:       true,
+		},
+	)
+
+	mesh := genTestMesh("mesh", 3, 0)
+	mesh.Primitives[1].MaterialIndex = 1
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.EmissivePrimitives) != 1 {
+		t.Fatalf("expected 1 emissive primitive; got %d", len(sc.EmissivePrimitives))
+	}
+
+	emp := sc.EmissivePrimitives[0]
+	if sc.MaterialIndex[emp.PrimitiveIndex] != uint32(sc.MaterialRoots[1]) {
+		t.Fatalf("expected emissive primitive %d to use the emissive material", emp.PrimitiveIndex)
+	}
+	if emp.Area != 0.5 {
+		t.Fatalf("expected emissive primitive area to be 0.5; got %f", emp.Area)
+	}
+	if expRadiance := (types.Vec3{4, 2, 1}); sc.EmissiveRadiance(0) != expRadiance {
+		t.Fatalf("expected emitted radiance to be %v; got %v", expRadiance, sc.EmissiveRadiance(0))
+	}
+}
+
+func TestCompileWithoutAreaLights(t *testing.T) {
+	sc, _, err := Compile(genOpacityTestScene(genTestMesh("mesh", 2, 0)), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.EmissivePrimitives == nil || len(sc.EmissivePrimitives) != 0 {
+		t.Fatalf("expected an empty emissive primitive list; got %v", sc.EmissivePrimitives)
+	}
+}
+
+func TestCompilePointLights(t *testing.T) {
+	ps := genOpacityTestScene(genTestMesh("mesh", 2, 0))
+	ps.PointLights = []*input.PointLight{
+		{Position: types.Vec3{1, 2, 3}, Intensity: types.Vec3{10, 5, 2.5}, Radius: 0.5},
+		{Position: types.Vec3{-1, 0, 0}, Intensity: types.Vec3{1, 1, 1}},
+	}
+
+	sc, diag, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.EmissivePrimitives) != 2 {
+		t.Fatalf("expected 2 emissive primitives; got %d", len(sc.EmissivePrimitives))
+	}
+	if warnings := diag.ForStage(StageLights); len(warnings) != 0 {
+		t.Fatalf("expected point lights to count as scene lights; got warnings %v", warnings)
+	}
+
+	for lightIndex, light := range ps.PointLights {
+		emp := sc.EmissivePrimitives[lightIndex]
+		if emp.Type != scene.SphereLight {
+			t.Fatalf("[light %d] expected emissive type to be %d; got %d", lightIndex, scene.SphereLight, emp.Type)
+		}
+
+		// The transform should map the unit sphere to the light sphere
+		center := emp.Transform.Mul4x1(types.Vec4{0, 0, 0, 1}).Vec3()
+		if center != light.Position {
+			t.Fatalf("[light %d] expected light center to be %v; got %v", lightIndex, light.Position, center)
+		}
+		if radius := emp.Transform.Mul4x1(types.Vec4{1, 0, 0, 0}).Vec3().Len(); radius != light.Radius {
+			t.Fatalf("[light %d] expected light radius to be %f; got %f", lightIndex, light.Radius, radius)
+		}
+		if got := sc.EmissiveRadiance(uint32(lightIndex)); got != light.Intensity {
+			t.Fatalf("[light %d] expected light intensity to be %v; got %v", lightIndex, light.Intensity, got)
+		}
+	}
+
+	// Lights with a negative radius should be rejected
+	ps.PointLights[1].Radius = -1
+	if _, _, err = Compile(ps, DefaultOptions()); err == nil {
+		t.Fatal("expected an error for a point light with a negative radius")
+	}
+}
@@ -0,0 +1,130 @@
+package compiler
+
+import (
+	"math"
+	"time"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+// A vertex deduplication key. It contains the quantized position (including
+// the baked vertex AO stored in the w coordinate), normal and uv components
+// of a vertex as well as the handedness of its tangent frame.
+type vertexKey [10]int64
+
+// Convert the non-indexed primitive data of the compiled scene into an indexed
+// layout where vertices with identical position, normal and uv values are only
+// stored once. Vertex components are quantized using the supplied epsilon so
+// that vertices whose components differ by tiny amounts are also merged; a
+// zero epsilon only merges vertices whose components are bitwise identical.
+//
+// The tangents of merged vertices are averaged and orthonormalized against
+// the merged vertex normal. As the indexed layout cannot pack the geometric
+// normals into the vertex normals, the vertices of primitives using clockwise
+// front face winding are swapped so that the geometric normal of all
+// primitives is given by cross(v1-v0, v2-v0).
+func (sc *sceneCompiler) indexVertices(epsilon float32) {
+	start := time.Now()
+	numVertices := len(sc.optimizedScene.VertexList)
+	indexVertices(sc.optimizedScene, epsilon, sc.frontFaceWinding)
+	sc.logger.Infof(
+		"indexed %d vertices into %d unique vertices in %d ms",
+		numVertices, len(sc.optimizedScene.VertexList), time.Since(start).Nanoseconds()/1e6,
+	)
+}
+
+// Deduplicate the vertices of a non-indexed scene; see sceneCompiler.indexVertices.
+func indexVertices(optimizedScene *scene.Scene, epsilon float32, winding Winding) {
+	numVertices := len(optimizedScene.VertexList)
+	hasTangents := len(optimizedScene.TangentList) != 0
+
+	vertices := make([]types.Vec4, 0)
+	normals := make([]types.Vec4, 0)
+	uvs := make([]types.Vec2, 0)
+	var tangents []types.Vec4
+	if hasTangents {
+		tangents = make([]types.Vec4, 0)
+	}
+
+	indices := make([]uint32, numVertices)
+	uniqueIndex := make(map[vertexKey]uint32, numVertices/2)
+	for vertexIndex := 0; vertexIndex < numVertices; vertexIndex++ {
+		var tangent types.Vec4
+		if hasTangents {
+			tangent = optimizedScene.TangentList[vertexIndex]
+		}
+		key := newVertexKey(optimizedScene.VertexList[vertexIndex], optimizedScene.NormalList[vertexIndex], optimizedScene.UvList[vertexIndex], tangent[3], epsilon)
+
+		index, exists := uniqueIndex[key]
+		if !exists {
+			index = uint32(len(vertices))
+			uniqueIndex[key] = index
+
+			// The geometric normal components are not used by indexed scenes
+			vertices = append(vertices, optimizedScene.VertexList[vertexIndex])
+			normals = append(normals, optimizedScene.NormalList[vertexIndex].Vec3().Vec4(0))
+			uvs = append(uvs, optimizedScene.UvList[vertexIndex])
+			if hasTangents {
+				tangents = append(tangents, types.Vec4{})
+			}
+		}
+
+		// Accumulate the tangents of merged vertices
+		if hasTangents {
+			tangents[index] = tangents[index].Vec3().Add(tangent.Vec3()).Vec4(tangent[3])
+		}
+
+		indices[vertexIndex] = index
+	}
+
+	if hasTangents {
+		for index, tangent := range tangents {
+			normal := normals[index].Vec3().Normalize()
+			t := tangent.Vec3().Sub(normal.Mul(normal.Dot(tangent.Vec3())))
+			if tLen := t.Len(); tLen > degenerateUVEpsilon && !math.IsNaN(float64(tLen)) {
+				tangents[index] = t.Mul(1.0 / tLen).Vec4(tangent[3])
+			} else {
+				tangents[index] = arbitraryTangent(normal).Vec4(tangent[3])
+			}
+		}
+	}
+
+	if winding == Clockwise {
+		for offset := 0; offset < len(indices); offset += 3 {
+			indices[offset+1], indices[offset+2] = indices[offset+2], indices[offset+1]
+		}
+	}
+
+	optimizedScene.VertexList = vertices
+	optimizedScene.NormalList = normals
+	optimizedScene.UvList = uvs
+	optimizedScene.TangentList = tangents
+	optimizedScene.IndexList = indices
+}
+
+// Create a deduplication key for a vertex.
+func newVertexKey(vertex, normal types.Vec4, uv types.Vec2, handedness, epsilon float32) vertexKey {
+	return vertexKey{
+		quantize(vertex[0], epsilon),
+		quantize(vertex[1], epsilon),
+		quantize(vertex[2], epsilon),
+		quantize(vertex[3], epsilon),
+		quantize(normal[0], epsilon),
+		quantize(normal[1], epsilon),
+		quantize(normal[2], epsilon),
+		quantize(uv[0], epsilon),
+		quantize(uv[1], epsilon),
+		quantize(handedness, 0),
+	}
+}
+
+// Quantize a vertex component to a multiple of epsilon. If epsilon is zero,
+// the bit pattern of the component is returned instead.
+func quantize(v, epsilon float32) int64 {
+	if epsilon == 0 {
+		// Map negative zero to zero
+		return int64(math.Float32bits(v + 0))
+	}
+	return int64(math.Floor(float64(v)/float64(epsilon) + 0.5))
+}
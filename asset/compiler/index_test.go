@@ -0,0 +1,139 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestIndexVertices(t *testing.T) {
+	for _, winding := range []Winding{CounterClockwise, Clockwise} {
+		opts := DefaultOptions()
+		opts.FrontFaceWinding = winding
+		opts.StrictChecks = true
+		flat, _, err := Compile(genQuadScene(0), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts.IndexVertices = true
+		indexed, _, err := Compile(genQuadScene(0), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !indexed.IsIndexed() {
+			t.Fatalf("[winding %d] expected compiled scene to be indexed", winding)
+		}
+		if exp := 4; len(indexed.VertexList) != exp {
+			t.Fatalf("[winding %d] expected %d unique vertices; got %d", winding, exp, len(indexed.VertexList))
+		}
+		if exp := len(flat.VertexList); len(indexed.IndexList) != exp {
+			t.Fatalf("[winding %d] expected index list to contain %d entries; got %d", winding, exp, len(indexed.IndexList))
+		}
+
+		for primIndex := uint32(0); primIndex < uint32(len(flat.MaterialIndex)); primIndex++ {
+			if flatNormal, indexedNormal := flat.GeometricNormal(primIndex), indexed.GeometricNormal(primIndex); !vec3ApproxEqual(flatNormal, indexedNormal) {
+				t.Fatalf("[winding %d, prim %d] expected geometric normal to be %v; got %v", winding, primIndex, flatNormal, indexedNormal)
+			}
+
+			// Indexed primitives may list their vertices in a different order
+			for corner := uint32(0); corner < 3; corner++ {
+				flatIndex := flat.VertexIndex(primIndex, corner)
+				if !hasIndexedVertex(indexed, primIndex, flat.VertexList[flatIndex], flat.NormalList[flatIndex], flat.UvList[flatIndex]) {
+					t.Fatalf("[winding %d, prim %d] indexed primitive is missing vertex %v", winding, primIndex, flat.VertexList[flatIndex])
+				}
+			}
+		}
+	}
+}
+
+func TestIndexVerticesWeldEpsilon(t *testing.T) {
+	specs := []struct {
+		epsilon     float32
+		expVertices int
+	}{
+		{0, 6},
+		{1e-3, 4},
+	}
+
+	for specIndex, spec := range specs {
+		opts := DefaultOptions()
+		opts.IndexVertices = true
+		opts.VertexWeldEpsilon = spec.epsilon
+		sc, _, err := Compile(genQuadScene(1e-5), opts)
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		if len(sc.VertexList) != spec.expVertices {
+			t.Errorf("[spec %d] expected %d unique vertices; got %d", specIndex, spec.expVertices, len(sc.VertexList))
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.VertexWeldEpsilon = -1
+	if _, _, err := Compile(genQuadScene(0), opts); err == nil {
+		t.Fatal("expected a negative weld epsilon to be rejected")
+	}
+}
+
+func TestRebuildMeshBvhRejectsIndexedScenes(t *testing.T) {
+	opts := DefaultOptions()
+	opts.IndexVertices = true
+	sc, _, err := Compile(genQuadScene(0), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RebuildMeshBvh(sc, 0, genTestMesh("mesh", 1, 0).Primitives, opts)
+	if err == nil {
+		t.Fatal("expected rebuilding a mesh of an indexed scene to fail")
+	}
+}
+
+// Generate a scene containing a unit quad made up of two primitives. The
+// shared vertices of the second primitive are offset by jitter along the Z axis.
+func genQuadScene(jitter float32) *input.Scene {
+	quad := [4]types.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}}
+	quadUVs := [4]types.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	normals := [3]types.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}}
+
+	mesh := input.NewMesh("quad")
+	for primIndex, corners := range [2][3]int{{0, 1, 2}, {0, 2, 3}} {
+		prim := &input.Primitive{Normals: normals}
+		for corner, quadIndex := range corners {
+			prim.Vertices[corner] = quad[quadIndex]
+			prim.UVs[corner] = quadUVs[quadIndex]
+			if primIndex == 1 && quadIndex != 3 {
+				prim.Vertices[corner][2] += jitter
+			}
+		}
+		prim.SetBBox([2]types.Vec3{
+			types.MinVec3(prim.Vertices[0], types.MinVec3(prim.Vertices[1], prim.Vertices[2])),
+			types.MaxVec3(prim.Vertices[0], types.MaxVec3(prim.Vertices[1], prim.Vertices[2])),
+		})
+		prim.SetCenter(prim.Vertices[0].Add(prim.Vertices[1]).Add(prim.Vertices[2]).Mul(1.0 / 3.0))
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+	mesh.MarkBBoxDirty()
+
+	ps := input.NewScene()
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+	return ps
+}
+
+// Check whether any of the vertices of an indexed primitive matches the
+// supplied vertex attributes.
+func hasIndexedVertex(sc *scene.Scene, primIndex uint32, vertex, normal types.Vec4, uv types.Vec2) bool {
+	for corner := uint32(0); corner < 3; corner++ {
+		index := sc.VertexIndex(primIndex, corner)
+		if sc.VertexList[index] == vertex && sc.NormalList[index].Vec3() == normal.Vec3() && sc.UvList[index] == uv {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestIndirectReflectance(t *testing.T) {
+	specs := []struct {
+		expr        string
+		expPrimary  types.Vec3
+		expIndirect types.Vec3
+	}{
+		// Indirect bounces default to the primary reflectance
+		{
+			"diffuse(reflectance: {0.8, 0.2, 0.1})",
+			types.Vec3{0.8, 0.2, 0.1},
+			types.Vec3{0.8, 0.2, 0.1},
+		},
+		{
+			"diffuse(reflectance: {0.8, 0.2, 0.1}, indirectReflectance: {0.5, 0.5, 0.5})",
+			types.Vec3{0.8, 0.2, 0.1},
+			types.Vec3{0.5, 0.5, 0.5},
+		},
+		// Parameter order should not matter
+		{
+			"diffuse(indirectReflectance: {0.5, 0.5, 0.5}, reflectance: {0.8, 0.2, 0.1})",
+			types.Vec3{0.8, 0.2, 0.1},
+			types.Vec3{0.5, 0.5, 0.5},
+		},
+	}
+
+	for specIndex, spec := range specs {
+		ps := input.NewScene()
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       "wall",
+			Expression: spec.expr,
+			Used:       true,
+		})
+		mesh := genTestMesh("mesh", 1, 0)
+		ps.Meshes = []*input.Mesh{mesh}
+		ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+		sc, _, err := Compile(ps, DefaultOptions())
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		// Primary hits read the node reflectance while deeper bounces
+		// read the indirect reflectance
+		node := sc.MaterialNodeList[sc.MaterialRoots[0]]
+		if refl := node.Union2.Vec3(); refl != spec.expPrimary {
+			t.Fatalf("[spec %d] expected primary reflectance to be %v; got %v", specIndex, spec.expPrimary, refl)
+		}
+		if refl := node.Union3.Vec3(); refl != spec.expIndirect {
+			t.Fatalf("[spec %d] expected indirect reflectance to be %v; got %v", specIndex, spec.expIndirect, refl)
+		}
+		if node.Union1[3] != -1 || node.Union6[2] != -1 {
+			t.Fatalf("[spec %d] expected reflectance to not be textured; got textures %d and %d", specIndex, node.Union1[3], node.Union6[2])
+		}
+	}
+}
+
+func TestIndirectReflectanceEnergyConservation(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "wall",
+		Expression: "diffuse(indirectReflectance: {1.0, 0.5, 0.5})",
+		Used:       true,
+	})
+	mesh := genTestMesh("mesh", 1, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	_, _, err := Compile(ps, DefaultOptions())
+	if err == nil {
+		t.Fatal("expected an energy conservation error")
+	}
+}
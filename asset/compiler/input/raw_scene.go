@@ -16,6 +16,40 @@ type Material struct {
 	// Relative path for textures.
 	AssetRelPath *asset.Resource
 
+	// True if the material textures use premultiplied alpha.
+	PremultipliedAlpha bool
+
+	// True if the material color textures (reflectance, specularity,
+	// radiance and transmittance) are sRGB encoded and must be linearized
+	// while baking. Data textures such as normal, bump or roughness maps
+	// are always treated as linear.
+	SRGBTextures bool
+
+	// Anisotropic filtering level hints for textures referenced by the
+	// material expression. Each entry maps a texture name to its hint.
+	TextureAnisotropy map[string]uint32
+
+	// True if normal maps perturb the geometric normal instead of the
+	// interpolated vertex normals. This avoids smoothing artifacts on
+	// faceted models without authored vertex normals.
+	FlatNormalMap bool
+
+	// Cube map textures referenced by the material expression. Each entry
+	// maps a texture name to the +X, -X, +Y, -Y, +Z and -Z face images.
+	CubeMaps map[string][6]string
+
+	// Texture arrays referenced by the material expression. Each entry maps
+	// a texture name to the list of layer images.
+	TextureArrays map[string][]string
+
+	// Fraction of light that passes straight through surfaces using this
+	// material without being refracted. Values must be in the [0, 1] range.
+	Transparency float32
+
+	// An optional texture with the material opacity (alpha). If specified,
+	// it takes precedence over Transparency.
+	AlphaTex string
+
 	// True if material is referenced by scene geometry.
 	Used bool
 }
@@ -27,6 +61,22 @@ type Primitive struct {
 	UVs           [3]types.Vec2
 	MaterialIndex int
 
+	// Optional per-vertex tangents provided by the scene reader. The w
+	// coordinate of each tangent stores the handedness of the tangent frame.
+	// If HasTangents is false, the compiler calculates the tangents from the
+	// primitive uvs.
+	Tangents    [3]types.Vec4
+	HasTangents bool
+
+	// The smoothing group of the primitive. Vertex normals are only smoothed
+	// across primitives that belong to the same smoothing group. Group 0
+	// indicates that the primitive does not belong to a smoothing group.
+	SmoothingGroup uint32
+
+	// The transparency of the primitive in the [0, 1] range. A value of 0
+	// (the default) indicates a fully opaque primitive.
+	Transparency float32
+
 	bbox   [2]types.Vec3
 	center types.Vec3
 }
@@ -51,11 +101,52 @@ func (prim *Primitive) Center() types.Vec3 {
 	return prim.center
 }
 
+// Get the geometric normal of the primitive which is calculated from the
+// cross product of its edges. The normal is flipped if needed so that it
+// lies in the same hemisphere as the primitive's vertex normals. For
+// degenerate primitives, the average of the vertex normals is returned.
+func (prim *Primitive) GeometricNormal() types.Vec3 {
+	avgNormal := prim.Normals[0].Add(prim.Normals[1]).Add(prim.Normals[2])
+	faceNormal := prim.Vertices[1].Sub(prim.Vertices[0]).Cross(prim.Vertices[2].Sub(prim.Vertices[0]))
+	if faceNormal.Len() == 0 {
+		if avgNormal.Len() == 0 {
+			return avgNormal
+		}
+		return avgNormal.Normalize()
+	}
+
+	faceNormal = faceNormal.Normalize()
+	if faceNormal.Dot(avgNormal) < 0 {
+		return faceNormal.Mul(-1)
+	}
+	return faceNormal
+}
+
+// The shading mode for a mesh.
+type ShadingMode uint8
+
+const (
+	// Interpolate the vertex normals across each primitive.
+	SmoothShading ShadingMode = iota
+
+	// Use the geometric normal for all primitive vertices.
+	FlatShading
+)
+
 // A mesh is constructed by a list of primitive.
 type Mesh struct {
 	Name       string
 	Primitives []*Primitive
 
+	// The shading mode for the mesh primitives. Defaults to smooth shading.
+	ShadingMode ShadingMode
+
+	// Optional lower-detail versions of the mesh ordered from the most to
+	// the least detailed one. Mesh instances select a version via their
+	// LOD field where LOD 0 refers to the mesh itself. The LOD meshes are
+	// expected to fit within the bounds of the base mesh.
+	LODs []*Mesh
+
 	bbox            [2]types.Vec3
 	bboxNeedsUpdate bool
 }
@@ -65,6 +156,23 @@ type MeshInstance struct {
 	MeshIndex uint32
 	Transform types.Mat4
 
+	// A color multiplied into the base albedo of the instance surfaces.
+	// A zero value is treated as white (no tint).
+	Tint types.Vec3
+
+	// Optional custom scalar attributes (e.g. age or a random seed) that
+	// can be used for driving procedural material variations.
+	Attributes []float32
+
+	// The level of detail used by this instance. LOD 0 selects the base
+	// mesh while LOD N selects the Nth entry of the mesh LOD list.
+	LOD uint32
+
+	// If set, the compiler replaces the instance geometry with a box that
+	// spans the mesh bounds. Proxies are useful for cheaply rendering
+	// distant background objects.
+	Proxy bool
+
 	bbox   [2]types.Vec3
 	center types.Vec3
 }
@@ -134,6 +242,59 @@ type Camera struct {
 	Eye  types.Vec3
 	Look types.Vec3
 	Up   types.Vec3
+
+	// Roll angle in degrees around the view direction.
+	Roll float32
+
+	// The fraction of the shutter interval spent opening and closing the
+	// shutter. Zero values describe a box shutter.
+	ShutterOpen  float32
+	ShutterClose float32
+
+	// Thin lens settings. A zero aperture radius describes a pinhole
+	// camera. A zero focal distance focuses the lens on the look point.
+	ApertureRadius float32
+	FocalDistance  float32
+
+	// The camera projection name. An empty value selects a perspective
+	// projection. The ortho scale is the half-height of the image plane
+	// for orthographic projections; a zero value selects the default scale.
+	Projection string
+	OrthoScale float32
+}
+
+// Homogeneous participating medium settings.
+type Medium struct {
+	Extinction float32
+	Albedo     types.Vec3
+	G          float32
+}
+
+// Background dome projection settings.
+type Dome struct {
+	Radius       float32
+	GroundHeight float32
+}
+
+// An analytic point light. Lights with a non-zero radius are sampled as
+// spheres which produces soft shadows.
+type PointLight struct {
+	Position types.Vec3
+
+	// The radiant intensity of the light. The radiance emitted by the
+	// surface of a sphere light is scaled so that the light emits the
+	// same power regardless of its radius.
+	Intensity types.Vec3
+
+	Radius float32
+}
+
+// Scene metadata that does not affect rendering.
+type Metadata struct {
+	Name    string
+	Author  string
+	Units   string
+	Created string
 }
 
 // The scene contains all elements that are processed and optimized by the scene compiler.
@@ -142,7 +303,11 @@ type Scene struct {
 	Meshes        []*Mesh
 	MeshInstances []*MeshInstance
 	Materials     []*Material
+	PointLights   []*PointLight
 	Camera        *Camera
+	Medium        *Medium
+	Dome          *Dome
+	Metadata      *Metadata
 }
 
 // Create a new scene.
@@ -151,11 +316,17 @@ func NewScene() *Scene {
 		Meshes:        make([]*Mesh, 0),
 		MeshInstances: make([]*MeshInstance, 0),
 		Materials:     make([]*Material, 0),
+		PointLights:   make([]*PointLight, 0),
 		Camera: &Camera{
 			FOV:  45.0,
 			Eye:  types.Vec3{0, 0, 0},
 			Look: types.Vec3{0, 0, -1},
 			Up:   types.Vec3{0, 1, 0},
 		},
+		Medium: &Medium{
+			Albedo: types.Vec3{1, 1, 1},
+		},
+		Dome:     &Dome{},
+		Metadata: &Metadata{},
 	}
 }
@@ -0,0 +1,159 @@
+package input
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/achilleasa/polaris/asset/material"
+)
+
+// Check the scene for malformed references that would otherwise crash the
+// scene compiler. The scene must contain at least one mesh instance, mesh
+// instances must reference existing meshes and each mesh and mesh LOD must
+// contain at least one primitive. Cube maps and texture arrays defined by
+// materials must not contain empty texture paths and texture array layers
+// referenced by material expressions must exist. Primitives that reference
+// missing materials are not treated as problems as the compiler assigns the
+// default material to them. All detected problems are reported using a single
+// error.
+func (s *Scene) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(s.MeshInstances) == 0 {
+		addProblem("scene does not contain any mesh instances")
+	}
+	for index, mi := range s.MeshInstances {
+		if mi == nil {
+			addProblem("mesh instance %d is nil", index)
+		} else if int(mi.MeshIndex) >= len(s.Meshes) {
+			addProblem("mesh instance %d references mesh %d; scene contains %d meshes", index, mi.MeshIndex, len(s.Meshes))
+		}
+	}
+
+	for meshIndex, mesh := range s.Meshes {
+		if mesh == nil {
+			addProblem("mesh %d is nil", meshIndex)
+			continue
+		}
+
+		s.validateMesh(fmt.Sprintf("mesh %q", mesh.Name), mesh, addProblem)
+		for lod, lodMesh := range mesh.LODs {
+			if lodMesh == nil {
+				addProblem("mesh %q: LOD %d is nil", mesh.Name, lod+1)
+				continue
+			}
+			s.validateMesh(fmt.Sprintf("mesh %q: LOD %d", mesh.Name, lod+1), lodMesh, addProblem)
+		}
+	}
+
+	for matIndex, mat := range s.Materials {
+		if mat == nil {
+			addProblem("material %d is nil", matIndex)
+			continue
+		}
+
+		s.validateMaterialTextures(mat, addProblem)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid scene: found %d problem(s):\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+}
+
+// Check that a mesh contains at least one primitive.
+func (s *Scene) validateMesh(label string, mesh *Mesh, addProblem func(string, ...interface{})) {
+	if len(mesh.Primitives) == 0 {
+		addProblem("%s does not contain any primitives", label)
+	}
+
+	for primIndex, prim := range mesh.Primitives {
+		if prim == nil {
+			addProblem("%s: primitive %d is nil", label, primIndex)
+		}
+	}
+}
+
+// Check the cube maps and texture arrays defined by a material as well as the
+// textures referenced by its expression. Expressions that cannot be parsed
+// are skipped as the compiler reports parse errors when building the material
+// trees.
+func (s *Scene) validateMaterialTextures(mat *Material, addProblem func(string, ...interface{})) {
+	for name, facePaths := range mat.CubeMaps {
+		for face, facePath := range facePaths {
+			if facePath == "" {
+				addProblem("material %q: cube map %q does not define a texture for face %d", mat.Name, name, face)
+			}
+		}
+	}
+	for name, layerPaths := range mat.TextureArrays {
+		if len(layerPaths) == 0 {
+			addProblem("material %q: texture array %q does not define any layers", mat.Name, name)
+		}
+		for layer, layerPath := range layerPaths {
+			if layerPath == "" {
+				addProblem("material %q: texture array %q does not define a texture for layer %d", mat.Name, name, layer)
+			}
+		}
+	}
+
+	expr, err := material.ParseExpression(mat.Expression)
+	if err != nil {
+		return
+	}
+	for _, texNode := range textureNodes(expr, nil) {
+		texPath := string(texNode)
+		open := strings.LastIndex(texPath, "[")
+		if open < 1 || !strings.HasSuffix(texPath, "]") {
+			continue
+		}
+		layerPaths, isArray := mat.TextureArrays[texPath[:open]]
+		if !isArray {
+			continue
+		}
+
+		layerRef := texPath[open+1 : len(texPath)-1]
+		if layer, err := strconv.ParseUint(layerRef, 10, 32); err != nil || layer >= uint64(len(layerPaths)) {
+			addProblem("material %q: texture array %q has %d layers; layer %s is out of range", mat.Name, texPath[:open], len(layerPaths), layerRef)
+		}
+	}
+}
+
+// Append the texture nodes referenced by a material expression to the
+// supplied list and return it.
+func textureNodes(expr material.ExprNode, list []material.TextureNode) []material.TextureNode {
+	switch t := expr.(type) {
+	case material.TextureNode:
+		list = append(list, t)
+	case material.BxdfNode:
+		for _, param := range t.Parameters {
+			list = textureNodes(param.Value, list)
+		}
+	case material.MixNode:
+		list = textureNodes(t.Expressions[0], list)
+		list = textureNodes(t.Expressions[1], list)
+		if t.Texture != "" {
+			list = append(list, t.Texture)
+		}
+	case material.MixMapNode:
+		list = textureNodes(t.Expressions[0], list)
+		list = textureNodes(t.Expressions[1], list)
+		list = append(list, t.Texture)
+	case material.FresnelBlendNode:
+		list = textureNodes(t.Expressions[0], list)
+		list = textureNodes(t.Expressions[1], list)
+	case material.BumpMapNode:
+		list = textureNodes(t.Expression, list)
+		list = append(list, t.Texture)
+	case material.NormalMapNode:
+		list = textureNodes(t.Expression, list)
+		list = append(list, t.Texture)
+	case material.DisperseNode:
+		list = textureNodes(t.Expression, list)
+	}
+	return list
+}
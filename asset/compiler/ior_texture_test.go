@@ -0,0 +1,100 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/texure"
+	"github.com/achilleasa/polaris/log"
+)
+
+func TestIORTexture(t *testing.T) {
+	logger := log.New("ior texture test")
+	sc := &sceneCompiler{
+		parsedScene:    input.NewScene(),
+		optimizedScene: &scene.Scene{},
+		logger:         logger,
+		diagnostics:    newCompileDiagnostics(logger),
+		texIndexCache:  make(map[string]int32, 0),
+	}
+
+	tex := &texture.Texture{
+		Format: texture.Luminance8,
+		Width:  2,
+		Height: 1,
+		Data:   []byte{0x00, 0xFF},
+	}
+	texPath, texIndex := cacheTestTexture(t, sc, "varnish.png", tex)
+	mat := &input.Material{
+		Name:       "varnish",
+		Expression: `dielectric(intIOR: "` + texPath + `", extIOR: 1.2)`,
+	}
+
+	nodeIndex, err := sc.generateMaterial(mat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := sc.optimizedScene.MaterialNodeList[nodeIndex]
+	if node.Union6[0] != texIndex {
+		t.Fatalf("expected intIOR texture binding to be %d; got %d", texIndex, node.Union6[0])
+	}
+	if node.Union6[1] != -1 {
+		t.Fatalf("expected extIOR to not be bound to a texture; got texture %d", node.Union6[1])
+	}
+
+	if node.Union4[1] != 1.2 {
+		t.Fatalf("expected extIOR to be 1.2; got %f", node.Union4[1])
+	}
+}
+
+func TestIORTextureValidation(t *testing.T) {
+	logger := log.New("ior texture test")
+	sc := &sceneCompiler{
+		parsedScene:    input.NewScene(),
+		optimizedScene: &scene.Scene{},
+		logger:         logger,
+		diagnostics:    newCompileDiagnostics(logger),
+		texIndexCache:  make(map[string]int32, 0),
+	}
+
+	invalidMats := []*input.Material{
+		{Name: "udim", Expression: `dielectric(intIOR: "varnish_<UDIM>.png")`},
+		{
+			Name:          "array",
+			Expression:    `conductor(extIOR: "layers.png")`,
+			TextureArrays: map[string][]string{"layers.png": {"layer0.png", "layer1.png"}},
+		},
+	}
+
+	for index, mat := range invalidMats {
+		_, err := sc.generateMaterial(mat)
+		if err == nil {
+			t.Errorf("[mat %d] expected an error for IOR texture reference in %q", index, mat.Expression)
+		}
+	}
+}
+
+// Append a texture to the compiled scene and register it with the compiler's
+// texture cache under a placeholder file so that material expressions can
+// reference it without decoding an image file. Returns the placeholder path
+// and the texture index.
+func cacheTestTexture(t *testing.T, sc *sceneCompiler, name string, tex *texture.Texture) (string, int32) {
+	texPath := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(texPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := asset.NewResource(texPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Close()
+
+	texIndex := sc.appendTexture(&input.Material{Name: name}, tex)
+	sc.texIndexCache[res.Path()] = texIndex
+	return texPath, texIndex
+}
@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/bvh"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestCopyLeafPrimitivesMatchesPerPrimitiveCopy(t *testing.T) {
+	workList := genLeafWorkList(37)
+	primOffset := uint32(5)
+
+	bulk := newLeafCopyCompiler(len(workList) + int(primOffset))
+	bulkEmissives := bulk.copyLeafPrimitives(workList, primOffset, false, nil)
+
+	ref := newLeafCopyCompiler(len(workList) + int(primOffset))
+	refEmissives := copyLeafPrimitivesPerItem(ref, workList, primOffset, nil)
+
+	if !reflect.DeepEqual(bulk.optimizedScene, ref.optimizedScene) {
+		t.Fatal("expected bulk leaf copy to generate the same geometry lists as the per-primitive copy")
+	}
+	if len(bulkEmissives) == 0 || !reflect.DeepEqual(bulkEmissives, refEmissives) {
+		t.Fatalf("expected bulk leaf copy to generate the same emissive list as the per-primitive copy; got %v, expected %v", bulkEmissives, refEmissives)
+	}
+}
+
+func BenchmarkCopyLeafPrimitivesBulk(b *testing.B) {
+	workList := genLeafWorkList(DefaultMinPrimitivesPerLeaf)
+	sc := newLeafCopyCompiler(len(workList))
+	emissives := make([]*scene.EmissivePrimitive, 0, len(workList))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		emissives = sc.copyLeafPrimitives(workList, 0, false, emissives[:0])
+	}
+}
+
+func BenchmarkCopyLeafPrimitivesPerItem(b *testing.B) {
+	workList := genLeafWorkList(DefaultMinPrimitivesPerLeaf)
+	sc := newLeafCopyCompiler(len(workList))
+	emissives := make([]*scene.EmissivePrimitive, 0, len(workList))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		emissives = copyLeafPrimitivesPerItem(sc, workList, 0, emissives[:0])
+	}
+}
+
+// The per-primitive leaf copy implementation that copyLeafPrimitives replaced.
+func copyLeafPrimitivesPerItem(sc *sceneCompiler, workList []bvh.BoundedVolume, primOffset uint32, emissives []*scene.EmissivePrimitive) []*scene.EmissivePrimitive {
+	vertexOffset := 3 * primOffset
+	for _, workItem := range workList {
+		prim := workItem.(*input.Primitive)
+
+		sc.optimizedScene.VertexList[vertexOffset+0] = prim.Vertices[0].Vec4(0)
+		sc.optimizedScene.VertexList[vertexOffset+1] = prim.Vertices[1].Vec4(0)
+		sc.optimizedScene.VertexList[vertexOffset+2] = prim.Vertices[2].Vec4(0)
+
+		geomNormal := geometricNormal(prim, sc.frontFaceWinding)
+		sc.optimizedScene.NormalList[vertexOffset+0] = prim.Normals[0].Vec4(geomNormal[0])
+		sc.optimizedScene.NormalList[vertexOffset+1] = prim.Normals[1].Vec4(geomNormal[1])
+		sc.optimizedScene.NormalList[vertexOffset+2] = prim.Normals[2].Vec4(geomNormal[2])
+
+		sc.optimizedScene.UvList[vertexOffset+0] = prim.UVs[0]
+		sc.optimizedScene.UvList[vertexOffset+1] = prim.UVs[1]
+		sc.optimizedScene.UvList[vertexOffset+2] = prim.UVs[2]
+
+		matNodeIndex := sc.matIndexToMatRoot[prim.MaterialIndex]
+		sc.optimizedScene.MaterialIndex[primOffset] = uint32(matNodeIndex)
+
+		if emissiveNodeIndex := sc.emissiveIndexCache[prim.MaterialIndex]; emissiveNodeIndex != -1 {
+			emissives = append(emissives, &scene.EmissivePrimitive{
+				Area:              0.5 * prim.Vertices[2].Sub(prim.Vertices[0]).Cross(prim.Vertices[2].Sub(prim.Vertices[1])).Len(),
+				PrimitiveIndex:    primOffset,
+				MaterialNodeIndex: uint32(emissiveNodeIndex),
+				Type:              scene.AreaLight,
+			})
+		}
+
+		vertexOffset += 3
+		primOffset++
+	}
+
+	return emissives
+}
+
+// Create a compiler with pre-allocated geometry lists for numPrims primitives
+// and two materials where the second one is emissive.
+func newLeafCopyCompiler(numPrims int) *sceneCompiler {
+	return &sceneCompiler{
+		optimizedScene: &scene.Scene{
+			VertexList:    make([]types.Vec4, 3*numPrims),
+			NormalList:    make([]types.Vec4, 3*numPrims),
+			UvList:        make([]types.Vec2, 3*numPrims),
+			MaterialIndex: make([]uint32, numPrims),
+		},
+		matIndexToMatRoot:  map[int]int32{0: 3, 1: 7},
+		emissiveIndexCache: map[int]int32{0: -1, 1: 6},
+	}
+}
+
+// Generate a list of primitives with distinct vertex data, alternating
+// between the diffuse and emissive test materials.
+func genLeafWorkList(numPrims int) []bvh.BoundedVolume {
+	workList := make([]bvh.BoundedVolume, numPrims)
+	for index := range workList {
+		f := float32(index)
+		workList[index] = &input.Primitive{
+			Vertices: [3]types.Vec3{
+				{f, 0, 0},
+				{f + 1, 0, 0},
+				{f, 1, f},
+			},
+			Normals: [3]types.Vec3{
+				{0, 0, 1},
+				{0, f, 1},
+				{f, 0, 1},
+			},
+			UVs: [3]types.Vec2{
+				{0, f},
+				{1, f},
+				{f, 1},
+			},
+			MaterialIndex: index % 2,
+		}
+	}
+	return workList
+}
@@ -0,0 +1,67 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMeshInstanceLODs(t *testing.T) {
+	mesh := genTestMesh("tree", 16, 0)
+	mesh.LODs = []*input.Mesh{
+		genTestMesh("tree-lod1", 4, 0),
+		genTestMesh("tree-lod2", 1, 0),
+	}
+
+	ps := genOpacityTestScene(mesh)
+	for _, lod := range []uint32{1, 2, 5} {
+		mi := genTestMeshInstance(mesh)
+		mi.Transform = types.Translate4(types.Vec3{float32(10 * lod), 0, 0})
+		mi.LOD = lod
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, diagnostics, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.MeshRanges) != 3 {
+		t.Fatalf("expected 3 mesh ranges; got %d", len(sc.MeshRanges))
+	}
+
+	// Each LOD should be stored in a separate range with its own BVH
+	expPrims := []uint32{16, 4, 1}
+	lodRoots := make([]uint32, len(expPrims))
+	for lod, exp := range expPrims {
+		rangeIndex := sc.MeshLOD(0, uint32(lod))
+		if rangeIndex == -1 {
+			t.Fatalf("missing mesh range for LOD %d", lod)
+		}
+
+		mr := sc.MeshRanges[rangeIndex]
+		if mr.BaseMesh != 0 || mr.LOD != uint32(lod) {
+			t.Fatalf("expected range %d to belong to mesh 0 LOD %d; got mesh %d LOD %d", rangeIndex, lod, mr.BaseMesh, mr.LOD)
+		}
+		if mr.PrimitiveCount != exp {
+			t.Fatalf("expected LOD %d range to contain %d primitives; got %d", lod, exp, mr.PrimitiveCount)
+		}
+		lodRoots[lod] = mr.BvhRoot
+	}
+	if lodRoots[0] == lodRoots[1] || lodRoots[1] == lodRoots[2] {
+		t.Fatalf("expected each LOD to use a distinct BVH root; got %v", lodRoots)
+	}
+
+	// Requests for missing LODs are clamped to the coarsest LOD
+	expRoots := []uint32{lodRoots[0], lodRoots[1], lodRoots[2], lodRoots[2]}
+	for index, exp := range expRoots {
+		if got := sc.MeshInstanceList[index].BvhRoot; got != exp {
+			t.Errorf("expected instance %d to reference BVH root %d; got %d", index, exp, got)
+		}
+	}
+
+	if warnings := diagnostics.ForStage(StageGeometry); len(warnings) != 1 {
+		t.Fatalf("expected a warning for the instance requesting a missing LOD; got %v", warnings)
+	}
+}
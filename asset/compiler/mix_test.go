@@ -0,0 +1,55 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/texure"
+	"github.com/achilleasa/polaris/log"
+)
+
+func TestMixWeightTexture(t *testing.T) {
+	logger := log.New("mix test")
+	sc := &sceneCompiler{
+		parsedScene:    input.NewScene(),
+		optimizedScene: &scene.Scene{},
+		logger:         logger,
+		diagnostics:    newCompileDiagnostics(logger),
+		texIndexCache:  make(map[string]int32, 0),
+	}
+
+	texPath, texIndex := cacheTestTexture(t, sc, "mask.png", &texture.Texture{
+		Format: texture.Luminance8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{0x80},
+	})
+
+	specs := []struct {
+		expr         string
+		expWeightTex int32
+	}{
+		{`mix(diffuse(), transparent(), 0.5)`, -1},
+		{`mix(diffuse(), transparent(), 0.5, "` + texPath + `")`, texIndex},
+	}
+
+	for specIndex, spec := range specs {
+		rootIndex, err := sc.generateMaterial(&input.Material{Name: "leaf", Expression: spec.expr})
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		root := sc.optimizedScene.MaterialNodeList[rootIndex]
+		if material.OpType(root.Union1[0]) != material.OpMix {
+			t.Fatalf("[spec %d] expected root node to be a mix node; got type %d", specIndex, root.Union1[0])
+		}
+		if root.Union2[0] != 0.5 {
+			t.Fatalf("[spec %d] expected mix weight to be 0.5; got %f", specIndex, root.Union2[0])
+		}
+		if root.Union1[3] != spec.expWeightTex {
+			t.Fatalf("[spec %d] expected mix weight texture to be %d; got %d", specIndex, spec.expWeightTex, root.Union1[3])
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+// Recompute the vertex normals of all smooth-shaded scene meshes using the
+// specified weighting strategy.
+func (sc *sceneCompiler) smoothNormals(weighting NormalSmoothing) {
+	if weighting == NoNormalSmoothing {
+		return
+	}
+
+	for _, pm := range sc.meshesWithLODs() {
+		if pm.ShadingMode == input.FlatShading {
+			continue
+		}
+		SmoothPrimitiveNormals(pm.Primitives, weighting, sc.frontFaceWinding)
+	}
+}
+
+// A vertex position within a smoothing group.
+type smoothingKey struct {
+	group  uint32
+	vertex types.Vec3
+}
+
+// Replace the vertex normals of a list of primitives with the weighted average
+// of the face normals of all primitives in the same smoothing group sharing the
+// same vertex position. Face normals are oriented using the front-face vertex
+// winding. Primitives that do not belong to a smoothing group (group 0) are
+// flat shaded so their normals are left untouched. Vertices whose weighted
+// normal sum is zero (e.g. only shared by degenerate primitives) keep their
+// original normal.
+func SmoothPrimitiveNormals(primitives []*input.Primitive, weighting NormalSmoothing, winding Winding) {
+	normalSums := make(map[smoothingKey]types.Vec3, 3*len(primitives))
+	for _, prim := range primitives {
+		if prim.SmoothingGroup == 0 {
+			continue
+		}
+
+		// The cross product length equals twice the primitive area
+		faceNormal := winding.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2])
+		if faceNormal.Len() == 0 {
+			continue
+		}
+
+		for corner, vertex := range prim.Vertices {
+			var weightedNormal types.Vec3
+			switch weighting {
+			case AreaWeightedNormals:
+				weightedNormal = faceNormal.Mul(0.5)
+			case AngleWeightedNormals:
+				e1 := prim.Vertices[(corner+1)%3].Sub(vertex).Normalize()
+				e2 := prim.Vertices[(corner+2)%3].Sub(vertex).Normalize()
+				cosAngle := math.Max(-1, math.Min(1, float64(e1.Dot(e2))))
+				weightedNormal = faceNormal.Normalize().Mul(float32(math.Acos(cosAngle)))
+			}
+			key := smoothingKey{prim.SmoothingGroup, vertex}
+			normalSums[key] = normalSums[key].Add(weightedNormal)
+		}
+	}
+
+	for _, prim := range primitives {
+		if prim.SmoothingGroup == 0 {
+			continue
+		}
+
+		for corner, vertex := range prim.Vertices {
+			if sum := normalSums[smoothingKey{prim.SmoothingGroup, vertex}]; sum.Len() != 0 {
+				prim.Normals[corner] = sum.Normalize()
+			}
+		}
+	}
+}
+
+// Get the geometric normal of a primitive. The normal points out of the
+// primitive's front face as determined by the front-face winding. For
+// degenerate primitives, the average of the vertex normals is returned.
+func geometricNormal(prim *input.Primitive, winding Winding) types.Vec3 {
+	faceNormal := winding.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2])
+	if faceNormal.Len() == 0 {
+		return prim.GeometricNormal()
+	}
+	return faceNormal.Normalize()
+}
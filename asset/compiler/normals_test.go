@@ -0,0 +1,382 @@
+package compiler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/texure"
+	"github.com/achilleasa/polaris/log"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestGeometricAndShadingNormals(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+
+	// A smooth-shaded triangle on the XY plane whose vertex normals
+	// are tilted away from the face normal
+	prim := &input.Primitive{
+		Vertices: [3]types.Vec3{
+			{0, 0, 0},
+			{1, 0, 0},
+			{0, 1, 0},
+		},
+		Normals: [3]types.Vec3{
+			types.Vec3{-1, -1, 2}.Normalize(),
+			types.Vec3{1, 0, 1}.Normalize(),
+			types.Vec3{0, 1, 1}.Normalize(),
+		},
+	}
+	prim.SetBBox([2]types.Vec3{{0, 0, 0}, {1, 1, 0}})
+	prim.SetCenter(types.Vec3{0.5, 0.5, 0})
+
+	mesh := input.NewMesh("triangle")
+	mesh.Primitives = append(mesh.Primitives, prim)
+	mesh.MarkBBoxDirty()
+	ps.Meshes = []*input.Mesh{mesh}
+
+	mi := &input.MeshInstance{
+		MeshIndex: 0,
+		Transform: types.Ident4(),
+	}
+	mi.SetBBox(mesh.BBox())
+	mi.SetCenter(types.Vec3{0.5, 0.5, 0})
+	ps.MeshInstances = append(ps.MeshInstances, mi)
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expGeomNormal := types.Vec3{0, 0, 1}
+	geomNormal := sc.GeometricNormal(0)
+	if !vec3ApproxEqual(geomNormal, expGeomNormal) {
+		t.Fatalf("expected geometric normal to be %v; got %v", expGeomNormal, geomNormal)
+	}
+
+	// Interpolate shading normals at different points of the triangle
+	barycentrics := []types.Vec3{
+		{1, 0, 0},
+		{0, 1, 0},
+		{0, 0, 1},
+		{1.0 / 3.0, 1.0 / 3.0, 1.0 / 3.0},
+	}
+	shadingNormals := make([]types.Vec3, len(barycentrics))
+	for index, wuv := range barycentrics {
+		shadingNormals[index] = sc.NormalList[0].Vec3().Mul(wuv[0]).
+			Add(sc.NormalList[1].Vec3().Mul(wuv[1])).
+			Add(sc.NormalList[2].Vec3().Mul(wuv[2])).
+			Normalize()
+
+		if vec3ApproxEqual(shadingNormals[index], geomNormal) {
+			t.Fatalf("[point %d] expected shading normal to differ from the geometric normal %v", index, geomNormal)
+		}
+	}
+	for index := 1; index < len(shadingNormals); index++ {
+		if vec3ApproxEqual(shadingNormals[index], shadingNormals[0]) {
+			t.Fatalf("[point %d] expected shading normal %v to differ from the shading normal at point 0", index, shadingNormals[index])
+		}
+	}
+
+	// The geometric normal is stored per primitive so it stays constant
+	if got := sc.GeometricNormal(0); got != geomNormal {
+		t.Fatalf("expected geometric normal to remain %v; got %v", geomNormal, got)
+	}
+}
+
+func TestGeometricNormalOrientation(t *testing.T) {
+	prim := &input.Primitive{
+		Vertices: [3]types.Vec3{
+			{0, 0, 0},
+			{1, 0, 0},
+			{0, 1, 0},
+		},
+		Normals: [3]types.Vec3{
+			{0, 0, -1},
+			{0, 0, -1},
+			{0, 0, -1},
+		},
+	}
+
+	// The edge cross product points to +Z but the normal should be
+	// flipped to agree with the vertex normals
+	expNormal := types.Vec3{0, 0, -1}
+	if got := prim.GeometricNormal(); !vec3ApproxEqual(got, expNormal) {
+		t.Fatalf("expected geometric normal to be %v; got %v", expNormal, got)
+	}
+
+	// Degenerate triangles fall back to the average vertex normal
+	prim.Vertices[2] = types.Vec3{2, 0, 0}
+	if got := prim.GeometricNormal(); !vec3ApproxEqual(got, expNormal) {
+		t.Fatalf("expected degenerate triangle geometric normal to be %v; got %v", expNormal, got)
+	}
+}
+
+func vec3ApproxEqual(v1, v2 types.Vec3) bool {
+	for index := 0; index < 3; index++ {
+		if math.Abs(float64(v1[index]-v2[index])) > 1e-5 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFlatShadedMeshNormals(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+
+	// A triangle on the XY plane whose vertex normals are tilted
+	// away from the face normal
+	prim := &input.Primitive{
+		Vertices: [3]types.Vec3{
+			{0, 0, 0},
+			{1, 0, 0},
+			{0, 1, 0},
+		},
+		Normals: [3]types.Vec3{
+			types.Vec3{-1, -1, 2}.Normalize(),
+			types.Vec3{1, 0, 1}.Normalize(),
+			types.Vec3{0, 1, 1}.Normalize(),
+		},
+	}
+	prim.SetBBox([2]types.Vec3{{0, 0, 0}, {1, 1, 0}})
+	prim.SetCenter(types.Vec3{0.5, 0.5, 0})
+
+	mesh := input.NewMesh("triangle")
+	mesh.ShadingMode = input.FlatShading
+	mesh.Primitives = append(mesh.Primitives, prim)
+	mesh.MarkBBoxDirty()
+	ps.Meshes = []*input.Mesh{mesh}
+
+	mi := &input.MeshInstance{
+		MeshIndex: 0,
+		Transform: types.Ident4(),
+	}
+	mi.SetBBox(mesh.BBox())
+	mi.SetCenter(types.Vec3{0.5, 0.5, 0})
+	ps.MeshInstances = append(ps.MeshInstances, mi)
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expNormal := types.Vec3{0, 0, 1}
+	for vertex := 0; vertex < 3; vertex++ {
+		if normal := sc.NormalList[vertex].Vec3(); !vec3ApproxEqual(normal, expNormal) {
+			t.Fatalf("[vertex %d] expected flat shaded normal to be %v; got %v", vertex, expNormal, normal)
+		}
+	}
+	if geomNormal := sc.GeometricNormal(0); !vec3ApproxEqual(geomNormal, expNormal) {
+		t.Fatalf("expected geometric normal to be %v; got %v", expNormal, geomNormal)
+	}
+	if !sc.MeshRanges[0].FlatShading {
+		t.Fatal("expected mesh range to be flagged as flat shaded")
+	}
+}
+
+func TestAngleWeightedSmoothNormals(t *testing.T) {
+	// Both triangles share the vertex at the origin. The large triangle
+	// lies on the XY plane and forms a narrow corner at the shared vertex
+	// while the small triangle lies on the YZ plane and forms a right angle.
+	genMesh := func() *input.Mesh {
+		mesh := input.NewMesh("mesh")
+		mesh.Primitives = []*input.Primitive{
+			{Vertices: [3]types.Vec3{{0, 0, 0}, {10, 0, 0}, {10, 1, 0}}, SmoothingGroup: 1},
+			{Vertices: [3]types.Vec3{{0, 0, 0}, {0, 0.5, 0}, {0, 0, 0.5}}, SmoothingGroup: 1},
+		}
+		return mesh
+	}
+	largeNormal := types.Vec3{0, 0, 1}
+	smallNormal := types.Vec3{1, 0, 0}
+
+	areaMesh := genMesh()
+	SmoothPrimitiveNormals(areaMesh.Primitives, AreaWeightedNormals, CounterClockwise)
+	angleMesh := genMesh()
+	SmoothPrimitiveNormals(angleMesh.Primitives, AngleWeightedNormals, CounterClockwise)
+
+	// Both primitives should get the same normal at the shared vertex
+	areaNormal := areaMesh.Primitives[0].Normals[0]
+	angleNormal := angleMesh.Primitives[0].Normals[0]
+	if !vec3ApproxEqual(areaNormal, areaMesh.Primitives[1].Normals[0]) || !vec3ApproxEqual(angleNormal, angleMesh.Primitives[1].Normals[0]) {
+		t.Fatal("expected primitives to share the smoothed normal at the common vertex")
+	}
+
+	expAreaNormal := types.Vec3{0.125, 0, 5}.Normalize()
+	if !vec3ApproxEqual(areaNormal, expAreaNormal) {
+		t.Fatalf("expected area-weighted normal to be %v; got %v", expAreaNormal, areaNormal)
+	}
+	expAngleNormal := types.Vec3{math.Pi / 2, 0, float32(math.Atan(0.1))}.Normalize()
+	if !vec3ApproxEqual(angleNormal, expAngleNormal) {
+		t.Fatalf("expected angle-weighted normal to be %v; got %v", expAngleNormal, angleNormal)
+	}
+
+	// The area-weighted normal is biased towards the large face while the
+	// angle-weighted normal leans towards the face with the wider corner
+	if areaNormal.Dot(largeNormal) <= angleNormal.Dot(largeNormal) {
+		t.Fatalf("expected area-weighted normal %v to be closer to the large face normal than %v", areaNormal, angleNormal)
+	}
+	if angleNormal.Dot(smallNormal) <= areaNormal.Dot(smallNormal) {
+		t.Fatalf("expected angle-weighted normal %v to be closer to the small face normal than %v", angleNormal, areaNormal)
+	}
+
+	// Vertices that are not shared keep the normal of their own face
+	if normal := angleMesh.Primitives[0].Normals[1]; !vec3ApproxEqual(normal, largeNormal) {
+		t.Fatalf("expected unshared vertex normal to be %v; got %v", largeNormal, normal)
+	}
+}
+
+func TestSmoothNormalsSkipUngroupedPrimitives(t *testing.T) {
+	// Two faces meeting at a right angle along the edge between the
+	// origin and {1, 0, 0}. Only the first face belongs to a smoothing
+	// group.
+	floorNormal := types.Vec3{0, 0, 1}
+	wallNormal := types.Vec3{0, -1, 0}
+	prims := []*input.Primitive{
+		{
+			Vertices:       [3]types.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+			Normals:        [3]types.Vec3{floorNormal, floorNormal, floorNormal},
+			SmoothingGroup: 1,
+		},
+		{
+			Vertices: [3]types.Vec3{{1, 0, 0}, {0, 0, 0}, {0, 0, -1}},
+			Normals:  [3]types.Vec3{wallNormal, wallNormal, wallNormal},
+		},
+	}
+	SmoothPrimitiveNormals(prims, AreaWeightedNormals, CounterClockwise)
+
+	for corner := 0; corner < 3; corner++ {
+		if normal := prims[0].Normals[corner]; !vec3ApproxEqual(normal, floorNormal) {
+			t.Fatalf("[corner %d] expected normal of grouped primitive to be %v; got %v", corner, floorNormal, normal)
+		}
+		if normal := prims[1].Normals[corner]; !vec3ApproxEqual(normal, wallNormal) {
+			t.Fatalf("[corner %d] expected normal of ungrouped primitive to be %v; got %v", corner, wallNormal, normal)
+		}
+	}
+}
+
+func TestFrontFaceWinding(t *testing.T) {
+	genScene := func() *input.Scene {
+		ps := input.NewScene()
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       "diffuse",
+			Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+			Used:       true,
+		})
+
+		// A triangle on the XY plane listing its vertices in
+		// counter-clockwise order when viewed from +Z
+		prim := &input.Primitive{
+			Vertices: [3]types.Vec3{
+				{0, 0, 0},
+				{1, 0, 0},
+				{0, 1, 0},
+			},
+			Normals: [3]types.Vec3{
+				{0, 0, 1},
+				{0, 0, 1},
+				{0, 0, 1},
+			},
+		}
+		prim.SetBBox([2]types.Vec3{{0, 0, 0}, {1, 1, 0}})
+		prim.SetCenter(types.Vec3{0.5, 0.5, 0})
+
+		mesh := input.NewMesh("triangle")
+		mesh.Primitives = append(mesh.Primitives, prim)
+		mesh.MarkBBoxDirty()
+		ps.Meshes = []*input.Mesh{mesh}
+		ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+		return ps
+	}
+
+	// A ray travelling from +Z towards the triangle
+	rayDir := types.Vec3{0, 0, -1}
+
+	specs := []struct {
+		winding       Winding
+		expGeomNormal types.Vec3
+		expFrontFace  bool
+	}{
+		{CounterClockwise, types.Vec3{0, 0, 1}, true},
+		{Clockwise, types.Vec3{0, 0, -1}, false},
+	}
+
+	for specIndex, spec := range specs {
+		opts := DefaultOptions()
+		opts.FrontFaceWinding = spec.winding
+		sc, _, err := Compile(genScene(), opts)
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		if geomNormal := sc.GeometricNormal(0); !vec3ApproxEqual(geomNormal, spec.expGeomNormal) {
+			t.Fatalf("[spec %d] expected geometric normal to be %v; got %v", specIndex, spec.expGeomNormal, geomNormal)
+		}
+		if frontFace := sc.IsFrontFace(0, rayDir); frontFace != spec.expFrontFace {
+			t.Fatalf("[spec %d] expected ray hitting the +Z side to hit the front face: %t; got %t", specIndex, spec.expFrontFace, frontFace)
+		}
+		if frontFace := sc.IsFrontFace(0, rayDir.Mul(-1)); frontFace == spec.expFrontFace {
+			t.Fatalf("[spec %d] expected ray hitting the -Z side to hit the front face: %t; got %t", specIndex, !spec.expFrontFace, frontFace)
+		}
+	}
+}
+
+func TestFlatNormalMap(t *testing.T) {
+	logger := log.New("normals test")
+	sc := &sceneCompiler{
+		parsedScene:    input.NewScene(),
+		optimizedScene: &scene.Scene{},
+		logger:         logger,
+		diagnostics:    newCompileDiagnostics(logger),
+		texIndexCache:  make(map[string]int32, 0),
+	}
+
+	texPath, texIndex := cacheTestTexture(t, sc, "bumps.png", &texture.Texture{
+		Format: texture.Rgba8,
+		Width:  1,
+		Height: 1,
+		Data:   []byte{0x80, 0x80, 0xFF, 0xFF},
+	})
+
+	specs := []struct {
+		flat       bool
+		expBaseArg int32
+	}{
+		{false, -1},
+		{true, scene.NormalMapFlatBase},
+	}
+
+	for specIndex, spec := range specs {
+		mat := &input.Material{
+			Name:          "bumpy",
+			Expression:    `normalMap(diffuse(), "` + texPath + `")`,
+			FlatNormalMap: spec.flat,
+		}
+		rootIndex, err := sc.generateMaterial(mat)
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		root := sc.optimizedScene.MaterialNodeList[rootIndex]
+		if material.OpType(root.Union1[0]) != material.OpNormalMap {
+			t.Fatalf("[spec %d] expected root node to be a normal map node; got type %d", specIndex, root.Union1[0])
+		}
+		if root.Union1[2] != spec.expBaseArg {
+			t.Fatalf("[spec %d] expected normal map base flag to be %d; got %d", specIndex, spec.expBaseArg, root.Union1[2])
+		}
+		if root.Union1[3] != texIndex {
+			t.Fatalf("[spec %d] expected normal map texture to be %d; got %d", specIndex, texIndex, root.Union1[3])
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package compiler
+
+import "github.com/achilleasa/polaris/asset/compiler/input"
+
+// The quantized opacity value for fully opaque primitives.
+const opaquePrimitive uint8 = 255
+
+// Check whether any primitive in the supplied list is not fully opaque. The
+// compiler only emits per-primitive opacity values for such scenes.
+func hasTransparentPrimitives(primitives []*input.Primitive) bool {
+	for _, prim := range primitives {
+		if prim.Transparency > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Convert a primitive transparency value into a quantized opacity value.
+func quantizeOpacity(transparency float32) uint8 {
+	if transparency <= 0 {
+		return opaquePrimitive
+	} else if transparency >= 1 {
+		return 0
+	}
+
+	return uint8((1-transparency)*255 + 0.5)
+}
@@ -0,0 +1,63 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+)
+
+func TestPrimitiveOpacity(t *testing.T) {
+	transparency := []float32{0, 0.5, 1, 0.25}
+	expOpacity := []uint8{255, 128, 0, 191}
+
+	mesh := genTestMesh("mesh", len(transparency), 0)
+	for primIndex, value := range transparency {
+		mesh.Primitives[primIndex].Transparency = value
+	}
+
+	sc, _, err := Compile(genOpacityTestScene(mesh), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.PrimitiveOpacity) != len(sc.MaterialIndex) {
+		t.Fatalf("expected opacity list to contain %d entries; got %d", len(sc.MaterialIndex), len(sc.PrimitiveOpacity))
+	}
+
+	// Primitives may be reordered by the compiler; use the y coordinate of
+	// the first vertex to map them back to the input primitives.
+	for primIndex := range sc.MaterialIndex {
+		srcIndex := int(sc.VertexList[3*primIndex][1])
+		if got := sc.PrimitiveOpacity[primIndex]; got != expOpacity[srcIndex] {
+			t.Fatalf("expected primitive %d opacity to be %d; got %d", srcIndex, expOpacity[srcIndex], got)
+		}
+	}
+}
+
+func TestPrimitiveOpacityOmittedForOpaqueScenes(t *testing.T) {
+	mesh := genTestMesh("mesh", 4, 0)
+
+	sc, _, err := Compile(genOpacityTestScene(mesh), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.PrimitiveOpacity) != 0 {
+		t.Fatalf("expected opacity list to be omitted for an opaque scene; got %d entries", len(sc.PrimitiveOpacity))
+	}
+	if got := sc.Opacity(0); got != 1 {
+		t.Fatalf("expected primitives of an opaque scene to have opacity 1; got %v", got)
+	}
+}
+
+func genOpacityTestScene(mesh *input.Mesh) *input.Scene {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse()",
+		Used:       true,
+	})
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+	return ps
+}
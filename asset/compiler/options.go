@@ -0,0 +1,186 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/achilleasa/polaris/asset/compiler/bvh"
+	"github.com/achilleasa/polaris/types"
+)
+
+// The default minimum number of primitives required for creating a mesh BVH leaf.
+const DefaultMinPrimitivesPerLeaf = 10
+
+// The default number of mesh instances that may share a top-level BVH leaf.
+const DefaultMaxInstancesPerLeaf = 1
+
+// Options for tuning the scene compiler.
+type Options struct {
+	// The SAH cost for traversing a BVH node.
+	TraversalCost float32
+
+	// The SAH cost for intersecting a primitive.
+	IntersectionCost float32
+
+	// The strategy used by the BVH builder for selecting node split planes.
+	SplitStrategy bvh.SplitStrategy
+
+	// The minimum number of primitives required for creating a mesh BVH
+	// leaf. Mesh BVH nodes with this many primitives or less are always
+	// turned into leafs. Must be at least 1.
+	MinPrimitivesPerLeaf int
+
+	// The number of mesh instances that may share a top-level BVH leaf.
+	// Top-level BVH nodes with this many instances or less are always
+	// turned into leafs. If greater than 1, the compiled mesh instances
+	// are stored in leaf order instead of the parsed scene order. Must be
+	// at least 1.
+	MaxInstancesPerLeaf int
+
+	// The number of workers used for building the mesh BVH trees in
+	// parallel. A zero value uses one worker per CPU.
+	BuildThreads int
+
+	// If enabled, the compiler verifies that all BVH child node offsets
+	// and leaf primitive ranges point inside the compiled scene lists.
+	StrictChecks bool
+
+	// The strategy for recomputing the vertex normals of smooth-shaded meshes.
+	NormalSmoothing NormalSmoothing
+
+	// The vertex winding order of front-facing primitives. It controls the
+	// orientation of the geometric normals which point out of the front face.
+	FrontFaceWinding Winding
+
+	// The strategy for repairing meshes whose adjacent primitives use
+	// inconsistent vertex winding.
+	WindingRepair WindingRepair
+
+	// If enabled, the compiler generates a full mipmap pyramid for each
+	// baked texture using a box filter. Disabling mipmap generation
+	// reduces the memory used by textures at the cost of aliasing for
+	// minified textures.
+	GenerateMipmaps bool
+
+	// The number of hemisphere rays used for baking the ambient occlusion
+	// of each mesh vertex. A zero value disables the vertex AO pass.
+	VertexAOSamples uint32
+
+	// The max distance of the vertex AO rays. A zero value allows rays of
+	// unbounded length.
+	VertexAODistance float32
+
+	// If non-zero, this value overrides the intersection epsilon that the
+	// tracers derive from the scene bounds.
+	IntersectionEpsilon float32
+
+	// If enabled, the compiler deduplicates vertices that share the same
+	// position, normal and uv and emits an index list that references the
+	// unique vertices. This reduces the size of the vertex buffers for
+	// meshes with many shared vertices.
+	IndexVertices bool
+
+	// The quantization step used for detecting duplicate vertices when
+	// vertex indexing is enabled. A zero value only merges vertices whose
+	// components are bitwise identical.
+	VertexWeldEpsilon float32
+}
+
+// The strategy used by the smooth-normals pass for averaging the face normals
+// of the primitives that share a vertex.
+type NormalSmoothing uint8
+
+const (
+	// Keep the vertex normals supplied by the scene reader.
+	NoNormalSmoothing NormalSmoothing = iota
+
+	// Weight each face normal by the area of its primitive.
+	AreaWeightedNormals
+
+	// Weight each face normal by the angle of the primitive corner at the
+	// shared vertex. This avoids biasing the normals towards large faces
+	// for meshes with irregular triangulation.
+	AngleWeightedNormals
+)
+
+// The vertex winding order of a primitive when viewed from its front side.
+type Winding uint8
+
+const (
+	// Front faces list their vertices in counter-clockwise order.
+	CounterClockwise Winding = iota
+
+	// Front faces list their vertices in clockwise order.
+	Clockwise
+)
+
+// Get the normal of the front face of the triangle defined by v0, v1 and v2.
+// The returned vector is not normalized; its length equals twice the
+// triangle area.
+func (w Winding) FaceNormal(v0, v1, v2 types.Vec3) types.Vec3 {
+	faceNormal := v1.Sub(v0).Cross(v2.Sub(v0))
+	if w == Clockwise {
+		return faceNormal.Mul(-1)
+	}
+	return faceNormal
+}
+
+// The strategy used by the winding repair pass for flipping primitives whose
+// vertex winding is inconsistent with their neighbors.
+type WindingRepair uint8
+
+const (
+	// Keep the vertex winding supplied by the scene reader.
+	NoWindingRepair WindingRepair = iota
+
+	// Flip primitives so that the winding is consistent across each
+	// connected mesh region. The winding of the first primitive in each
+	// region is preserved.
+	ConsistentWinding
+
+	// Like ConsistentWinding but also flip each region as a whole so that
+	// its front faces point away from the region centroid.
+	OutwardWinding
+)
+
+// Get the default compiler options.
+func DefaultOptions() Options {
+	return Options{
+		TraversalCost:        bvh.DefaultTraversalCost,
+		IntersectionCost:     bvh.DefaultIntersectionCost,
+		SplitStrategy:        bvh.SplitSweep,
+		MinPrimitivesPerLeaf: DefaultMinPrimitivesPerLeaf,
+		MaxInstancesPerLeaf:  DefaultMaxInstancesPerLeaf,
+		FrontFaceWinding:     CounterClockwise,
+		GenerateMipmaps:      true,
+	}
+}
+
+// Check that the options contain valid values.
+func (opts Options) validate() error {
+	if opts.MinPrimitivesPerLeaf < 1 {
+		return fmt.Errorf("scene compiler: min primitives per BVH leaf must be >= 1; got %d", opts.MinPrimitivesPerLeaf)
+	}
+	if opts.MaxInstancesPerLeaf < 1 {
+		return fmt.Errorf("scene compiler: max instances per top-level BVH leaf must be >= 1; got %d", opts.MaxInstancesPerLeaf)
+	}
+	if opts.BuildThreads < 0 {
+		return fmt.Errorf("scene compiler: BVH build threads must be >= 0; got %d", opts.BuildThreads)
+	}
+	if opts.IntersectionEpsilon < 0 {
+		return fmt.Errorf("scene compiler: intersection epsilon must be >= 0; got %g", opts.IntersectionEpsilon)
+	}
+	if opts.VertexWeldEpsilon < 0 {
+		return fmt.Errorf("scene compiler: vertex weld epsilon must be >= 0; got %g", opts.VertexWeldEpsilon)
+	}
+	return nil
+}
+
+// Get the BVH build options for these options.
+func (opts Options) bvhOptions() bvh.BuildOptions {
+	return bvh.BuildOptions{
+		SplitStrategy:    opts.SplitStrategy,
+		ScoreStrategy:    bvh.NewSurfaceAreaHeuristic(opts.TraversalCost, opts.IntersectionCost),
+		TraversalCost:    opts.TraversalCost,
+		IntersectionCost: opts.IntersectionCost,
+	}
+}
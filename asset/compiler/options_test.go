@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMinPrimitivesPerLeaf(t *testing.T) {
+	mesh := genTestMesh("mesh", 32, 0)
+
+	meshNodes := func(minPrims int) uint32 {
+		opts := DefaultOptions()
+		opts.MinPrimitivesPerLeaf = minPrims
+		sc, _, err := Compile(genOpacityTestScene(mesh), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sc.MeshRanges[0].BvhNodeCount
+	}
+
+	if got := meshNodes(64); got != 1 {
+		t.Fatalf("expected mesh BVH to contain a single leaf; got %d nodes", got)
+	}
+	if coarse, fine := meshNodes(DefaultMinPrimitivesPerLeaf), meshNodes(1); fine <= coarse {
+		t.Fatalf("expected a smaller leaf size to generate more BVH nodes; got %d (min 1) and %d (min %d)", fine, coarse, DefaultMinPrimitivesPerLeaf)
+	}
+
+	for _, minPrims := range []int{0, -1} {
+		opts := DefaultOptions()
+		opts.MinPrimitivesPerLeaf = minPrims
+		_, _, err := Compile(genOpacityTestScene(mesh), opts)
+		if err == nil || !strings.Contains(err.Error(), "min primitives per BVH leaf must be >= 1") {
+			t.Fatalf("expected an error for min primitives per leaf %d; got %v", minPrims, err)
+		}
+	}
+}
+
+func TestMaxInstancesPerLeaf(t *testing.T) {
+	mesh := genTestMesh("mesh", 2, 0)
+	ps := genOpacityTestScene(mesh)
+	ps.MeshInstances = nil
+	for index := 0; index < 16; index++ {
+		translation := types.Vec3{float32(2 * index), 0, 0}
+		mi := &input.MeshInstance{
+			MeshIndex: 0,
+			Transform: types.Translate4(translation),
+		}
+		bbox := mesh.BBox()
+		mi.SetBBox([2]types.Vec3{bbox[0].Add(translation), bbox[1].Add(translation)})
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5).Add(translation))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	topLevelNodes := func(maxInstances int) int {
+		opts := DefaultOptions()
+		opts.MaxInstancesPerLeaf = maxInstances
+		sc, _, err := Compile(ps, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Top-level nodes precede the mesh BVH nodes
+		numNodes := int(sc.MeshRanges[0].BvhRoot)
+		seen := make([]int, len(sc.MeshInstanceList))
+		for nodeIndex := 0; nodeIndex < numNodes; nodeIndex++ {
+			node := sc.BvhNodeList[nodeIndex]
+			if node.RData > 0 {
+				continue
+			}
+			first, count := node.GetMeshInstances()
+			if int(count) > maxInstances {
+				t.Fatalf("[max %d] expected leaf %d to contain at most %d instances; got %d", maxInstances, nodeIndex, maxInstances, count)
+			}
+			for index := first; index < first+count; index++ {
+				seen[index]++
+			}
+		}
+		for index, refs := range seen {
+			if refs != 1 {
+				t.Fatalf("[max %d] expected instance %d to be referenced by exactly 1 leaf; got %d", maxInstances, index, refs)
+			}
+		}
+		return numNodes
+	}
+
+	if coarse, fine := topLevelNodes(4), topLevelNodes(DefaultMaxInstancesPerLeaf); coarse >= fine {
+		t.Fatalf("expected a larger leaf size to generate fewer top-level BVH nodes; got %d (max 4) and %d (max %d)", coarse, fine, DefaultMaxInstancesPerLeaf)
+	}
+
+	opts := DefaultOptions()
+	opts.MaxInstancesPerLeaf = 0
+	_, _, err := Compile(ps, opts)
+	if err == nil || !strings.Contains(err.Error(), "max instances per top-level BVH leaf must be >= 1") {
+		t.Fatalf("expected an error for max instances per leaf 0; got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package compiler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/log"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestParallelMeshPartitioning(t *testing.T) {
+	// Odd meshes use an emissive material
+	meshes := make([]*input.Mesh, 0)
+	for index := 0; index < 8; index++ {
+		meshes = append(meshes, genTestMesh("mesh", 8+index*16, index%2))
+	}
+
+	partition := func(workers int) ([]meshPartitionJob, *scene.Scene) {
+		ps := genOpacityTestScene(meshes[0])
+		ps.Meshes = meshes
+
+		sc := &sceneCompiler{
+			parsedScene:          ps,
+			logger:               log.New("partition test"),
+			bvhOptions:           DefaultOptions().bvhOptions(),
+			minPrimitivesPerLeaf: DefaultMinPrimitivesPerLeaf,
+			optimizedScene:       &scene.Scene{},
+			matIndexToMatRoot:    map[int]int32{0: 0, 1: 1},
+			emissiveIndexCache:   map[int]int32{0: -1, 1: 1},
+		}
+
+		var totalVertices int
+		for _, mesh := range meshes {
+			totalVertices += 3 * len(mesh.Primitives)
+		}
+		sc.optimizedScene.VertexList = make([]types.Vec4, totalVertices)
+		sc.optimizedScene.NormalList = make([]types.Vec4, totalVertices)
+		sc.optimizedScene.UvList = make([]types.Vec2, totalVertices)
+		sc.optimizedScene.MaterialIndex = make([]uint32, totalVertices/3)
+
+		jobs := make([]meshPartitionJob, len(meshes))
+		var primOffset uint32
+		for index, mesh := range meshes {
+			jobs[index] = meshPartitionJob{mesh: mesh, baseMesh: uint32(index), primOffset: primOffset}
+			primOffset += uint32(len(mesh.Primitives))
+		}
+		sc.partitionMeshes(jobs, workers)
+
+		for _, job := range jobs {
+			sc.optimizedScene.BvhNodeList = append(sc.optimizedScene.BvhNodeList, job.bvhNodes...)
+		}
+		return jobs, sc.optimizedScene
+	}
+
+	expJobs, expScene := partition(1)
+	var numEmissives int
+	for _, job := range expJobs {
+		numEmissives += len(job.emissives)
+	}
+	if numEmissives == 0 {
+		t.Fatal("expected partitioning to generate emissive primitives")
+	}
+
+	for _, workers := range []int{2, 4, 16} {
+		jobs, sc := partition(workers)
+		for index, job := range jobs {
+			if !reflect.DeepEqual(job.emissives, expJobs[index].emissives) {
+				t.Fatalf("[workers %d] expected emissives of mesh %d to match the serial build", workers, index)
+			}
+		}
+		if !reflect.DeepEqual(sc.BvhNodeList, expScene.BvhNodeList) {
+			t.Fatalf("[workers %d] expected BVH nodes to match the serial build", workers)
+		}
+		if !reflect.DeepEqual(sc.VertexList, expScene.VertexList) || !reflect.DeepEqual(sc.NormalList, expScene.NormalList) || !reflect.DeepEqual(sc.UvList, expScene.UvList) {
+			t.Fatalf("[workers %d] expected geometry lists to match the serial build", workers)
+		}
+	}
+}
+
+func TestBuildThreads(t *testing.T) {
+	compile := func(buildThreads int) (*scene.Scene, error) {
+		// Odd meshes use an emissive material
+		meshes := make([]*input.Mesh, 0)
+		for index := 0; index < 8; index++ {
+			meshes = append(meshes, genTestMesh("mesh", 8+index*16, index%2))
+		}
+
+		ps := genOpacityTestScene(meshes[0])
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       "light",
+			Expression: "emissive(radiance: {1, 1, 1})",
+			Used:       true,
+		})
+		ps.Meshes = meshes
+		ps.MeshInstances = nil
+		for index, mesh := range meshes {
+			mi := genTestMeshInstance(mesh)
+			mi.MeshIndex = uint32(index)
+			ps.MeshInstances = append(ps.MeshInstances, mi)
+		}
+
+		opts := DefaultOptions()
+		opts.BuildThreads = buildThreads
+		sc, _, err := Compile(ps, opts)
+		return sc, err
+	}
+
+	expScene, err := compile(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expScene.EmissivePrimitives) == 0 {
+		t.Fatal("expected compiled scene to contain emissive primitives")
+	}
+	for _, buildThreads := range []int{0, 4} {
+		sc, err := compile(buildThreads)
+		if err != nil {
+			t.Fatalf("[threads %d] %v", buildThreads, err)
+		}
+		if !reflect.DeepEqual(sc, expScene) {
+			t.Fatalf("[threads %d] expected compiled scene to match the serial build", buildThreads)
+		}
+	}
+
+	_, err = compile(-1)
+	expError := "scene compiler: BVH build threads must be >= 0; got -1"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,90 @@
+package compiler
+
+import (
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+// The outward normal and the unit cube corners (in counter-clockwise order
+// when viewed from outside the cube) for each face of the proxy box.
+var proxyBoxFaces = [6]struct {
+	normal  types.Vec3
+	corners [4]types.Vec3
+}{
+	{types.Vec3{-1, 0, 0}, [4]types.Vec3{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}}},
+	{types.Vec3{1, 0, 0}, [4]types.Vec3{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}}},
+	{types.Vec3{0, -1, 0}, [4]types.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}}},
+	{types.Vec3{0, 1, 0}, [4]types.Vec3{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}}},
+	{types.Vec3{0, 0, -1}, [4]types.Vec3{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}}},
+	{types.Vec3{0, 0, 1}, [4]types.Vec3{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}},
+}
+
+// Replace the mesh references of proxied mesh instances with a box mesh that
+// spans the bounds of the referenced mesh. A single proxy mesh is generated
+// for each mesh referenced by proxied instances and is appended to the parsed
+// mesh list. Proxies ignore the instance LOD as the box is always cheaper to
+// trace than any mesh LOD.
+func (sc *sceneCompiler) setupProxyInstances() {
+	proxyMeshes := make(map[uint32]uint32)
+	for _, pmi := range sc.parsedScene.MeshInstances {
+		if !pmi.Proxy {
+			continue
+		}
+
+		proxyIndex, exists := proxyMeshes[pmi.MeshIndex]
+		if !exists {
+			proxyIndex = uint32(len(sc.parsedScene.Meshes))
+			proxyMeshes[pmi.MeshIndex] = proxyIndex
+			sc.parsedScene.Meshes = append(sc.parsedScene.Meshes, genProxyMesh(sc.parsedScene.Meshes[pmi.MeshIndex], sc.frontFaceWinding))
+		}
+
+		pmi.MeshIndex = proxyIndex
+		pmi.LOD = 0
+	}
+
+	if len(proxyMeshes) > 0 {
+		sc.logger.Infof("generated %d proxy mesh(es) for proxied mesh instances", len(proxyMeshes))
+	}
+}
+
+// Generate a flat-shaded box mesh by scaling a unit cube to the bounds of the
+// supplied mesh. The box primitives use the material of the first mesh
+// primitive and are wound so that they face outwards.
+func genProxyMesh(mesh *input.Mesh, winding Winding) *input.Mesh {
+	bbox := mesh.BBox()
+	extent := bbox[1].Sub(bbox[0])
+	matIndex := 0
+	if len(mesh.Primitives) > 0 {
+		matIndex = mesh.Primitives[0].MaterialIndex
+	}
+
+	proxy := input.NewMesh(mesh.Name + "_proxy")
+	proxy.ShadingMode = input.FlatShading
+	for _, face := range proxyBoxFaces {
+		var corners [4]types.Vec3
+		for index, unitCorner := range face.corners {
+			corners[index] = bbox[0].Add(types.Vec3{unitCorner[0] * extent[0], unitCorner[1] * extent[1], unitCorner[2] * extent[2]})
+		}
+
+		for _, tri := range [2][3]int{{0, 1, 2}, {0, 2, 3}} {
+			prim := &input.Primitive{
+				Vertices:      [3]types.Vec3{corners[tri[0]], corners[tri[1]], corners[tri[2]]},
+				Normals:       [3]types.Vec3{face.normal, face.normal, face.normal},
+				MaterialIndex: matIndex,
+			}
+			if winding.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2]).Dot(face.normal) < 0 {
+				prim.Vertices[1], prim.Vertices[2] = prim.Vertices[2], prim.Vertices[1]
+			}
+
+			prim.SetBBox([2]types.Vec3{
+				types.MinVec3(prim.Vertices[0], types.MinVec3(prim.Vertices[1], prim.Vertices[2])),
+				types.MaxVec3(prim.Vertices[0], types.MaxVec3(prim.Vertices[1], prim.Vertices[2])),
+			})
+			prim.SetCenter(prim.Vertices[0].Add(prim.Vertices[1]).Add(prim.Vertices[2]).Mul(1.0 / 3.0))
+			proxy.Primitives = append(proxy.Primitives, prim)
+		}
+	}
+
+	proxy.MarkBBoxDirty()
+	return proxy
+}
@@ -0,0 +1,53 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestProxyMeshInstances(t *testing.T) {
+	mesh := genTestMesh("tree", 16, 0)
+	ps := genOpacityTestScene(mesh)
+	for index := 0; index < 2; index++ {
+		mi := genTestMeshInstance(mesh)
+		mi.Transform = types.Translate4(types.Vec3{float32(10 * (index + 1)), 0, 0})
+		mi.Proxy = true
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.MeshRanges) != 2 {
+		t.Fatalf("expected 2 mesh ranges; got %d", len(sc.MeshRanges))
+	}
+	proxyRange := sc.MeshRanges[1]
+	if proxyRange.PrimitiveCount != 12 {
+		t.Fatalf("expected proxy mesh to contain 12 primitives; got %d", proxyRange.PrimitiveCount)
+	}
+	if !proxyRange.FlatShading {
+		t.Fatal("expected proxy mesh to use flat shading")
+	}
+
+	// The proxy box should span the original mesh bounds
+	proxyRoot := sc.BvhNodeList[proxyRange.BvhRoot]
+	expMin, expMax := types.Vec3{0, 0, 0}, types.Vec3{1, 16, 0}
+	if proxyRoot.Min != expMin || proxyRoot.Max != expMax {
+		t.Fatalf("expected proxy BVH root bounds to be %v - %v; got %v - %v", expMin, expMax, proxyRoot.Min, proxyRoot.Max)
+	}
+
+	// Proxied instances share the box mesh and not the original mesh
+	expMeshes := []uint32{0, 1, 1}
+	for index, exp := range expMeshes {
+		mi := sc.MeshInstanceList[index]
+		if mi.MeshIndex != exp {
+			t.Errorf("expected instance %d to reference mesh %d; got %d", index, exp, mi.MeshIndex)
+		}
+		if mi.BvhRoot != sc.MeshRanges[exp].BvhRoot {
+			t.Errorf("expected instance %d to reference BVH root %d; got %d", index, sc.MeshRanges[exp].BvhRoot, mi.BvhRoot)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/log"
+	"github.com/achilleasa/polaris/types"
+)
+
+// Replace the primitives of a compiled scene mesh and rebuild its BVH tree.
+// The primitive material indices must refer to materials that were compiled
+// as part of the scene. The compiler options should match the ones used for
+// compiling the scene.
+//
+// As all mesh BVH nodes and primitives are stored in shared flat lists, this
+// function splices the new mesh data into the scene lists and then patches the
+// node and primitive offsets of all meshes that follow the rebuilt mesh, the
+// mesh instance BVH roots and the emissive primitive list. Finally, the
+// top-level BVH bounding boxes are refitted to the new mesh bounds.
+func RebuildMeshBvh(optimizedScene *scene.Scene, meshIndex uint32, newPrimitives []*input.Primitive, opts Options) error {
+	if int(meshIndex) >= len(optimizedScene.MeshRanges) {
+		return fmt.Errorf("scene compiler: unknown mesh index %d", meshIndex)
+	}
+	if len(newPrimitives) == 0 {
+		return fmt.Errorf("scene compiler: mesh %d must contain at least one primitive", meshIndex)
+	}
+	if optimizedScene.IsIndexed() {
+		return fmt.Errorf("scene compiler: rebuilding meshes of indexed scenes is not supported")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	logger := log.New("scene compiler")
+	logger.Noticef("rebuilding BVH tree for mesh %d (%d primitives)", meshIndex, len(newPrimitives))
+
+	// Partition primitives into a temporary scene using a compiler that
+	// maps material indices to the material roots of the compiled scene.
+	sc := &sceneCompiler{
+		optimizedScene: &scene.Scene{
+			MaterialNodeList: optimizedScene.MaterialNodeList,
+			VertexList:       make([]types.Vec4, 3*len(newPrimitives)),
+			NormalList:       make([]types.Vec4, 3*len(newPrimitives)),
+			UvList:           make([]types.Vec2, 3*len(newPrimitives)),
+			MaterialIndex:    make([]uint32, len(newPrimitives)),
+		},
+		logger:               logger,
+		diagnostics:          newCompileDiagnostics(logger),
+		bvhOptions:           opts.bvhOptions(),
+		minPrimitivesPerLeaf: opts.MinPrimitivesPerLeaf,
+		matIndexToMatRoot:    make(map[int]int32, 0),
+		emissiveIndexCache:   make(map[int]int32, 0),
+	}
+
+	meshBBox := [2]types.Vec3{
+		types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+		types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+	}
+	for primIndex, prim := range newPrimitives {
+		if prim.MaterialIndex < 0 || prim.MaterialIndex >= len(optimizedScene.MaterialRoots) || optimizedScene.MaterialRoots[prim.MaterialIndex] == -1 {
+			return fmt.Errorf("scene compiler: primitive %d references material index %d which is not part of the compiled scene", primIndex, prim.MaterialIndex)
+		}
+
+		if _, exists := sc.matIndexToMatRoot[prim.MaterialIndex]; !exists {
+			root := optimizedScene.MaterialRoots[prim.MaterialIndex]
+			sc.matIndexToMatRoot[prim.MaterialIndex] = root
+			sc.emissiveIndexCache[prim.MaterialIndex] = sc.findMaterialNodeByBxdf(uint32(root), material.BxdfEmissive)
+		}
+
+		primBBox := prim.BBox()
+		meshBBox[0] = types.MinVec3(meshBBox[0], primBBox[0])
+		meshBBox[1] = types.MaxVec3(meshBBox[1], primBBox[1])
+	}
+
+	oldRange := optimizedScene.MeshRanges[meshIndex]
+	hasTransparency := hasTransparentPrimitives(newPrimitives)
+	if len(optimizedScene.TangentList) != 0 {
+		sc.optimizedScene.TangentList = make([]types.Vec4, 3*len(newPrimitives))
+	}
+	if hasTransparency || len(optimizedScene.PrimitiveOpacity) != 0 {
+		sc.optimizedScene.PrimitiveOpacity = make([]uint8, len(newPrimitives))
+	}
+	bvhNodes, _, emissives := sc.partitionMesh(newPrimitives, oldRange.FirstPrimitive, oldRange.FlatShading)
+	for index, _ := range bvhNodes {
+		bvhNodes[index].OffsetChildNodes(int32(oldRange.BvhRoot))
+	}
+
+	nodeDelta := int32(len(bvhNodes)) - int32(oldRange.BvhNodeCount)
+	primDelta := int32(len(newPrimitives)) - int32(oldRange.PrimitiveCount)
+
+	// Patch BVH nodes for all meshes following the rebuilt mesh
+	oldNodeEnd := oldRange.BvhRoot + oldRange.BvhNodeCount
+	for index := oldNodeEnd; index < uint32(len(optimizedScene.BvhNodeList)); index++ {
+		node := &optimizedScene.BvhNodeList[index]
+		if node.LData > 0 {
+			node.OffsetChildNodes(nodeDelta)
+			continue
+		}
+		firstPrim, count := node.GetPrimitives()
+		node.SetPrimitives(uint32(int32(firstPrim)+primDelta), count)
+	}
+
+	// Splice mesh data into the scene lists
+	optimizedScene.BvhNodeList = spliceBvhNodes(optimizedScene.BvhNodeList, oldRange.BvhRoot, oldNodeEnd, bvhNodes)
+
+	oldPrimEnd := oldRange.FirstPrimitive + oldRange.PrimitiveCount
+	optimizedScene.VertexList = spliceVec4(optimizedScene.VertexList, 3*oldRange.FirstPrimitive, 3*oldPrimEnd, sc.optimizedScene.VertexList)
+	optimizedScene.NormalList = spliceVec4(optimizedScene.NormalList, 3*oldRange.FirstPrimitive, 3*oldPrimEnd, sc.optimizedScene.NormalList)
+	optimizedScene.UvList = spliceVec2(optimizedScene.UvList, 3*oldRange.FirstPrimitive, 3*oldPrimEnd, sc.optimizedScene.UvList)
+	if len(sc.optimizedScene.TangentList) != 0 {
+		optimizedScene.TangentList = spliceVec4(optimizedScene.TangentList, 3*oldRange.FirstPrimitive, 3*oldPrimEnd, sc.optimizedScene.TangentList)
+	}
+	if len(sc.optimizedScene.PrimitiveOpacity) != 0 {
+		// Scenes without opacity values treat all primitives as opaque
+		if len(optimizedScene.PrimitiveOpacity) == 0 {
+			optimizedScene.PrimitiveOpacity = make([]uint8, len(optimizedScene.MaterialIndex))
+			for index := range optimizedScene.PrimitiveOpacity {
+				optimizedScene.PrimitiveOpacity[index] = opaquePrimitive
+			}
+		}
+		optimizedScene.PrimitiveOpacity = spliceUint8(optimizedScene.PrimitiveOpacity, oldRange.FirstPrimitive, oldPrimEnd, sc.optimizedScene.PrimitiveOpacity)
+
+		// Primitives that are not fully opaque disable the diffuse
+		// shading fast-path
+		optimizedScene.AllDiffuse = allDiffuseMaterials(optimizedScene)
+	}
+	optimizedScene.MaterialIndex = spliceUint32(optimizedScene.MaterialIndex, oldRange.FirstPrimitive, oldPrimEnd, sc.optimizedScene.MaterialIndex)
+
+	// Update mesh ranges
+	optimizedScene.MeshRanges[meshIndex].BvhNodeCount = uint32(len(bvhNodes))
+	optimizedScene.MeshRanges[meshIndex].PrimitiveCount = uint32(len(newPrimitives))
+	for index := int(meshIndex) + 1; index < len(optimizedScene.MeshRanges); index++ {
+		mr := &optimizedScene.MeshRanges[index]
+		mr.BvhRoot = uint32(int32(mr.BvhRoot) + nodeDelta)
+		mr.FirstPrimitive = uint32(int32(mr.FirstPrimitive) + primDelta)
+	}
+
+	// The spliced vertices carry no occlusion data so the vertex AO of the
+	// rebuilt mesh needs to be baked again.
+	if opts.VertexAOSamples > 0 {
+		bakeMeshVertexAO(optimizedScene, int(meshIndex), cosineHemisphereSamples(opts.VertexAOSamples), opts.VertexAODistance)
+	}
+
+	// Update mesh instances
+	for index, _ := range optimizedScene.MeshInstanceList {
+		mi := &optimizedScene.MeshInstanceList[index]
+		mi.BvhRoot = optimizedScene.MeshRanges[mi.MeshIndex].BvhRoot
+	}
+
+	// Drop the emissive primitives of the old mesh, patch the primitive
+	// indices of the following meshes and emit new emissive primitive
+	// copies for each instance of the rebuilt mesh.
+	areaLights := make([]scene.EmissivePrimitive, 0)
+	otherLights := make([]scene.EmissivePrimitive, 0)
+	for _, emp := range optimizedScene.EmissivePrimitives {
+		if emp.Type != scene.AreaLight {
+			otherLights = append(otherLights, emp)
+			continue
+		}
+
+		if emp.PrimitiveIndex >= oldRange.FirstPrimitive && emp.PrimitiveIndex < oldPrimEnd {
+			continue
+		} else if emp.PrimitiveIndex >= oldPrimEnd {
+			emp.PrimitiveIndex = uint32(int32(emp.PrimitiveIndex) + primDelta)
+		}
+		areaLights = append(areaLights, emp)
+	}
+	for _, mi := range optimizedScene.MeshInstanceList {
+		if mi.MeshIndex != meshIndex {
+			continue
+		}
+
+		for _, emissive := range emissives {
+			emp := *emissive
+			emp.Transform = mi.Transform
+			areaLights = append(areaLights, emp)
+		}
+	}
+	optimizedScene.EmissivePrimitives = append(areaLights, otherLights...)
+
+	// The mesh bounds may have changed so we need to refit the top level BVH
+	if len(optimizedScene.MeshRanges) > 0 && optimizedScene.MeshRanges[0].BvhRoot > 0 {
+		refitTopLevelBvh(optimizedScene, 0, meshIndex, meshBBox)
+	}
+
+	logger.Noticef("rebuilt BVH tree for mesh %d in %d ms", meshIndex, time.Since(start).Nanoseconds()/1e6)
+	return nil
+}
+
+// Recursively update the bounding boxes of the top-level BVH nodes that
+// contain instances of the given mesh.
+func refitTopLevelBvh(optimizedScene *scene.Scene, nodeIndex uint32, meshIndex uint32, meshBBox [2]types.Vec3) [2]types.Vec3 {
+	node := &optimizedScene.BvhNodeList[nodeIndex]
+
+	// Leaf node; recalculate the bbox of the leaf instances if any of them
+	// points to the rebuilt mesh. The bboxes of the remaining instances are
+	// calculated from the root node of their mesh BVH.
+	if node.LData <= 0 {
+		first, count := node.GetMeshInstances()
+		instances := optimizedScene.MeshInstanceList[first : first+count]
+
+		refit := false
+		for _, mi := range instances {
+			refit = refit || mi.MeshIndex == meshIndex
+		}
+		if !refit {
+			return [2]types.Vec3{node.Min, node.Max}
+		}
+
+		leafBBox := [2]types.Vec3{
+			types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+			types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+		}
+		for _, mi := range instances {
+			instMeshBBox := meshBBox
+			if mi.MeshIndex != meshIndex {
+				root := optimizedScene.BvhNodeList[optimizedScene.MeshRanges[mi.MeshIndex].BvhRoot]
+				instMeshBBox = [2]types.Vec3{root.Min, root.Max}
+			}
+			instBBox := transformBBox(mi.Transform.Inv(), instMeshBBox)
+			leafBBox[0] = types.MinVec3(leafBBox[0], instBBox[0])
+			leafBBox[1] = types.MaxVec3(leafBBox[1], instBBox[1])
+		}
+		node.SetBBox(leafBBox)
+		return [2]types.Vec3{node.Min, node.Max}
+	}
+
+	left := refitTopLevelBvh(optimizedScene, uint32(node.LData), meshIndex, meshBBox)
+	right := refitTopLevelBvh(optimizedScene, uint32(node.RData), meshIndex, meshBBox)
+	node.SetBBox([2]types.Vec3{
+		types.MinVec3(left[0], right[0]),
+		types.MaxVec3(left[1], right[1]),
+	})
+	return [2]types.Vec3{node.Min, node.Max}
+}
+
+// Transform the corners of a bbox and calculate a new AABB for them.
+func transformBBox(transform types.Mat4, bbox [2]types.Vec3) [2]types.Vec3 {
+	out := [2]types.Vec3{
+		types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+		types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+	}
+	for corner := 0; corner < 8; corner++ {
+		v := types.Vec3{
+			bbox[corner&1][0],
+			bbox[(corner>>1)&1][1],
+			bbox[(corner>>2)&1][2],
+		}
+		v = transform.Mul4x1(v.Vec4(1)).Vec3()
+		out[0] = types.MinVec3(out[0], v)
+		out[1] = types.MaxVec3(out[1], v)
+	}
+	return out
+}
+
+// Replace the [from, to) range of a slice with the contents of another slice.
+func spliceBvhNodes(list []scene.BvhNode, from, to uint32, data []scene.BvhNode) []scene.BvhNode {
+	out := make([]scene.BvhNode, 0, len(list)-int(to-from)+len(data))
+	out = append(out, list[:from]...)
+	out = append(out, data...)
+	return append(out, list[to:]...)
+}
+
+// Replace the [from, to) range of a slice with the contents of another slice.
+func spliceVec4(list []types.Vec4, from, to uint32, data []types.Vec4) []types.Vec4 {
+	out := make([]types.Vec4, 0, len(list)-int(to-from)+len(data))
+	out = append(out, list[:from]...)
+	out = append(out, data...)
+	return append(out, list[to:]...)
+}
+
+// Replace the [from, to) range of a slice with the contents of another slice.
+func spliceVec2(list []types.Vec2, from, to uint32, data []types.Vec2) []types.Vec2 {
+	out := make([]types.Vec2, 0, len(list)-int(to-from)+len(data))
+	out = append(out, list[:from]...)
+	out = append(out, data...)
+	return append(out, list[to:]...)
+}
+
+// Replace the [from, to) range of a slice with the contents of another slice.
+func spliceUint8(list []uint8, from, to uint32, data []uint8) []uint8 {
+	out := make([]uint8, 0, len(list)-int(to-from)+len(data))
+	out = append(out, list[:from]...)
+	out = append(out, data...)
+	return append(out, list[to:]...)
+}
+
+// Replace the [from, to) range of a slice with the contents of another slice.
+func spliceUint32(list []uint32, from, to uint32, data []uint32) []uint32 {
+	out := make([]uint32, 0, len(list)-int(to-from)+len(data))
+	out = append(out, list[:from]...)
+	out = append(out, data...)
+	return append(out, list[to:]...)
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestRebuildMeshBvh(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "light",
+		Expression: "emissive(radiance: {1, 1, 1})",
+		Used:       true,
+	})
+	ps.Meshes = []*input.Mesh{
+		genTestMesh("edited", 4, 0),
+		genTestMesh("untouched", 30, 1),
+	}
+	for meshIndex, x := range []float32{0, 0, 10} {
+		transform := types.Translate4(types.Vec3{x, 0, 0})
+		mi := &input.MeshInstance{
+			MeshIndex: uint32(meshIndex % 2),
+			Transform: transform,
+		}
+		bbox := transformBBox(transform, ps.Meshes[mi.MeshIndex].BBox())
+		mi.SetBBox(bbox)
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Capture the untouched mesh nodes and primitives before the edit
+	oldRange := sc.MeshRanges[1]
+	oldNodes := append([]scene.BvhNode{}, sc.BvhNodeList[oldRange.BvhRoot:oldRange.BvhRoot+oldRange.BvhNodeCount]...)
+	oldVertices := append([]types.Vec4{}, sc.VertexList[3*oldRange.FirstPrimitive:3*(oldRange.FirstPrimitive+oldRange.PrimitiveCount)]...)
+	oldEmissiveCount := len(sc.EmissivePrimitives)
+
+	// Edit mesh 0 so that it contains more primitives (and BVH nodes)
+	edited := genTestMesh("edited", 40, 0)
+	err = RebuildMeshBvh(sc, 0, edited.Primitives, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRange := sc.MeshRanges[1]
+	nodeDelta := int32(newRange.BvhRoot) - int32(oldRange.BvhRoot)
+	primDelta := int32(newRange.FirstPrimitive) - int32(oldRange.FirstPrimitive)
+	if nodeDelta <= 0 {
+		t.Fatalf("expected mesh 1 BVH root to be shifted; got delta %d", nodeDelta)
+	}
+	if primDelta != 36 {
+		t.Fatalf("expected mesh 1 primitives to be shifted by 36; got %d", primDelta)
+	}
+	if newRange.BvhNodeCount != oldRange.BvhNodeCount || newRange.PrimitiveCount != oldRange.PrimitiveCount {
+		t.Fatalf("expected mesh 1 node and primitive counts to remain unchanged")
+	}
+
+	for index, oldNode := range oldNodes {
+		node := sc.BvhNodeList[newRange.BvhRoot+uint32(index)]
+		if node.Min != oldNode.Min || node.Max != oldNode.Max {
+			t.Fatalf("[node %d] expected bbox to remain unchanged", index)
+		}
+
+		if oldNode.LData > 0 {
+			if node.LData != oldNode.LData+nodeDelta || node.RData != oldNode.RData+nodeDelta {
+				t.Fatalf("[node %d] expected child nodes to be (%d, %d); got (%d, %d)", index, oldNode.LData+nodeDelta, oldNode.RData+nodeDelta, node.LData, node.RData)
+			}
+			continue
+		}
+
+		oldFirst, oldCount := oldNode.GetPrimitives()
+		first, count := node.GetPrimitives()
+		if first != uint32(int32(oldFirst)+primDelta) || count != oldCount {
+			t.Fatalf("[node %d] expected leaf primitives to be (%d, %d); got (%d, %d)", index, int32(oldFirst)+primDelta, oldCount, first, count)
+		}
+	}
+
+	for index, v := range oldVertices {
+		if sc.VertexList[3*newRange.FirstPrimitive+uint32(index)] != v {
+			t.Fatalf("[vertex %d] expected mesh 1 vertex data to remain unchanged", index)
+		}
+	}
+
+	for index, mi := range sc.MeshInstanceList {
+		expRoot := sc.MeshRanges[mi.MeshIndex].BvhRoot
+		if mi.BvhRoot != expRoot {
+			t.Fatalf("[instance %d] expected BVH root to be %d; got %d", index, expRoot, mi.BvhRoot)
+		}
+	}
+
+	// Mesh 1 (single instance) is emissive and its emissive copies should be re-indexed
+	if len(sc.EmissivePrimitives) != oldEmissiveCount {
+		t.Fatalf("expected emissive primitive count to be %d; got %d", oldEmissiveCount, len(sc.EmissivePrimitives))
+	}
+	for index, emp := range sc.EmissivePrimitives {
+		if emp.PrimitiveIndex < newRange.FirstPrimitive || emp.PrimitiveIndex >= newRange.FirstPrimitive+newRange.PrimitiveCount {
+			t.Fatalf("[emissive %d] expected primitive index %d to belong to mesh 1", index, emp.PrimitiveIndex)
+		}
+	}
+
+	// The top-level BVH root should contain the enlarged edited mesh
+	rootMax := sc.BvhNodeList[0].Max
+	if rootMax[1] < 40 {
+		t.Fatalf("expected top-level BVH root bbox to be refitted; got max %v", rootMax)
+	}
+}
+
+func TestRebuildMeshBvhBakesVertexAO(t *testing.T) {
+	opts := DefaultOptions()
+	opts.VertexAOSamples = 32
+
+	sc, _, err := Compile(genOpacityTestScene(genTestMesh("edited", 4, 0)), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cover the mesh with a large roof triangle facing the strip
+	edited := genTestMesh("edited", 4, 0)
+	roof := &input.Primitive{
+		Vertices: [3]types.Vec3{{-10, -10, 1}, {10, -10, 1}, {0, 20, 1}},
+		Normals:  [3]types.Vec3{{0, 0, -1}, {0, 0, -1}, {0, 0, -1}},
+	}
+	roof.SetBBox([2]types.Vec3{{-10, -10, 1}, {10, 20, 1}})
+	roof.SetCenter(types.Vec3{0, 0, 1})
+	edited.Primitives = append(edited.Primitives, roof)
+	edited.MarkBBoxDirty()
+
+	err = RebuildMeshBvh(sc, 0, edited.Primitives, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expSc, _, err := Compile(genOpacityTestScene(edited), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.VertexList) != len(expSc.VertexList) {
+		t.Fatalf("expected vertex list len to be %d; got %d", len(expSc.VertexList), len(sc.VertexList))
+	}
+	var occluded int
+	for index, v := range sc.VertexList {
+		if v[3] != expSc.VertexList[index][3] {
+			t.Fatalf("[vertex %d] expected rebuilt vertex occlusion to be %f; got %f", index, expSc.VertexList[index][3], v[3])
+		}
+		if v[3] > 0 {
+			occluded++
+		}
+	}
+	if occluded == 0 {
+		t.Fatal("expected the roof to occlude the rebuilt mesh vertices")
+	}
+}
+
+// Generate a strip of triangles along the Y axis.
+func genTestMesh(name string, numPrims int, matIndex int) *input.Mesh {
+	mesh := input.NewMesh(name)
+	for index := 0; index < numPrims; index++ {
+		y := float32(index)
+		prim := &input.Primitive{
+			Vertices: [3]types.Vec3{
+				{0, y, 0},
+				{1, y, 0},
+				{0.5, y + 1, 0},
+			},
+			Normals: [3]types.Vec3{
+				{0, 0, 1},
+				{0, 0, 1},
+				{0, 0, 1},
+			},
+			MaterialIndex: matIndex,
+		}
+		prim.SetBBox([2]types.Vec3{{0, y, 0}, {1, y + 1, 0}})
+		prim.SetCenter(types.Vec3{0.5, y + 0.5, 0})
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+	mesh.MarkBBoxDirty()
+	return mesh
+}
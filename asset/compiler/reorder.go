@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+// Reorder the flat vertex, normal, uv, tangent and material index lists so
+// that the primitives of each mesh BVH leaf occupy a contiguous range and leaf
+// ranges are laid out in depth-first traversal order. Leaf primitive offsets and
+// emissive primitive indices are updated to point to the new locations.
+//
+// While the BVH builder currently emits leaf primitives in depth-first
+// order, this pass guarantees the layout regardless of the order in which
+// the builder invokes its leaf callbacks. If the leaf primitives are already
+// laid out in traversal order the scene is not modified and the function
+// returns false.
+func reorderLeafPrimitives(optimizedScene *scene.Scene) bool {
+	numPrims := len(optimizedScene.MaterialIndex)
+	if numPrims == 0 || leafPrimitivesInTraversalOrder(optimizedScene) {
+		return false
+	}
+
+	vertices := make([]types.Vec4, len(optimizedScene.VertexList))
+	normals := make([]types.Vec4, len(optimizedScene.NormalList))
+	uvs := make([]types.Vec2, len(optimizedScene.UvList))
+	var tangents []types.Vec4
+	if len(optimizedScene.TangentList) != 0 {
+		tangents = make([]types.Vec4, len(optimizedScene.TangentList))
+	}
+	matIndices := make([]uint32, numPrims)
+	var opacities []uint8
+	if len(optimizedScene.PrimitiveOpacity) != 0 {
+		opacities = make([]uint8, numPrims)
+	}
+
+	// Map old primitive indices to new ones
+	remap := make([]uint32, numPrims)
+	for index := range remap {
+		remap[index] = uint32(index)
+	}
+
+	for _, mr := range optimizedScene.MeshRanges {
+		if mr.PrimitiveCount == 0 {
+			continue
+		}
+
+		nextPrim := mr.FirstPrimitive
+		stack := []uint32{mr.BvhRoot}
+		for len(stack) > 0 {
+			nodeIndex := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			node := &optimizedScene.BvhNodeList[nodeIndex]
+
+			// Visit left child first
+			if node.LData > 0 {
+				stack = append(stack, uint32(node.RData), uint32(node.LData))
+				continue
+			}
+
+			first, count := node.GetPrimitives()
+			copy(vertices[3*nextPrim:3*(nextPrim+count)], optimizedScene.VertexList[3*first:3*(first+count)])
+			copy(normals[3*nextPrim:3*(nextPrim+count)], optimizedScene.NormalList[3*first:3*(first+count)])
+			copy(uvs[3*nextPrim:3*(nextPrim+count)], optimizedScene.UvList[3*first:3*(first+count)])
+			if tangents != nil {
+				copy(tangents[3*nextPrim:3*(nextPrim+count)], optimizedScene.TangentList[3*first:3*(first+count)])
+			}
+			copy(matIndices[nextPrim:nextPrim+count], optimizedScene.MaterialIndex[first:first+count])
+			if opacities != nil {
+				copy(opacities[nextPrim:nextPrim+count], optimizedScene.PrimitiveOpacity[first:first+count])
+			}
+			for offset := uint32(0); offset < count; offset++ {
+				remap[first+offset] = nextPrim + offset
+			}
+
+			node.SetPrimitives(nextPrim, count)
+			nextPrim += count
+		}
+	}
+
+	optimizedScene.VertexList = vertices
+	optimizedScene.NormalList = normals
+	optimizedScene.UvList = uvs
+	optimizedScene.MaterialIndex = matIndices
+	if tangents != nil {
+		optimizedScene.TangentList = tangents
+	}
+	if opacities != nil {
+		optimizedScene.PrimitiveOpacity = opacities
+	}
+
+	for index := range optimizedScene.EmissivePrimitives {
+		emp := &optimizedScene.EmissivePrimitives[index]
+		if emp.Type == scene.AreaLight {
+			emp.PrimitiveIndex = remap[emp.PrimitiveIndex]
+		}
+	}
+
+	return true
+}
+
+// Check whether the primitives of each mesh BVH leaf are stored contiguously
+// in depth-first traversal order.
+func leafPrimitivesInTraversalOrder(optimizedScene *scene.Scene) bool {
+	for _, mr := range optimizedScene.MeshRanges {
+		if mr.PrimitiveCount == 0 {
+			continue
+		}
+
+		nextPrim := mr.FirstPrimitive
+		stack := []uint32{mr.BvhRoot}
+		for len(stack) > 0 {
+			node := optimizedScene.BvhNodeList[stack[len(stack)-1]]
+			stack = stack[:len(stack)-1]
+
+			// Visit left child first
+			if node.LData > 0 {
+				stack = append(stack, uint32(node.RData), uint32(node.LData))
+				continue
+			}
+
+			first, count := node.GetPrimitives()
+			if first != nextPrim {
+				return false
+			}
+			nextPrim += count
+		}
+	}
+
+	return true
+}
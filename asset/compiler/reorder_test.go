@@ -0,0 +1,127 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestReorderLeafPrimitives(t *testing.T) {
+	// A mesh BVH whose leafs are not stored in depth-first order
+	sc := &scene.Scene{
+		BvhNodeList: make([]scene.BvhNode, 3),
+		MeshRanges: []scene.MeshRange{
+			{BvhRoot: 0, BvhNodeCount: 3, FirstPrimitive: 0, PrimitiveCount: 3},
+		},
+		VertexList:    make([]types.Vec4, 9),
+		NormalList:    make([]types.Vec4, 9),
+		UvList:        make([]types.Vec2, 9),
+		MaterialIndex: []uint32{10, 11, 12},
+		EmissivePrimitives: []scene.EmissivePrimitive{
+			{PrimitiveIndex: 0, Type: scene.AreaLight},
+			{PrimitiveIndex: 0, Type: scene.EnvironmentLight},
+		},
+	}
+	sc.BvhNodeList[0].SetChildNodes(1, 2)
+	sc.BvhNodeList[1].SetPrimitives(1, 2)
+	sc.BvhNodeList[2].SetPrimitives(0, 1)
+	for index := range sc.VertexList {
+		sc.VertexList[index] = types.Vec4{float32(index / 3), 0, 0, 0}
+		sc.NormalList[index] = types.Vec4{0, float32(index / 3), 0, 0}
+		sc.UvList[index] = types.Vec2{0, float32(index / 3)}
+	}
+
+	if !reorderLeafPrimitives(sc) {
+		t.Fatal("expected leaf primitives to be reordered")
+	}
+	assertContiguousLeafs(t, sc)
+
+	expOrder := []uint32{1, 2, 0}
+	for newIndex, oldIndex := range expOrder {
+		if sc.MaterialIndex[newIndex] != 10+oldIndex {
+			t.Fatalf("[prim %d] expected material index to be %d; got %d", newIndex, 10+oldIndex, sc.MaterialIndex[newIndex])
+		}
+		for vertex := 0; vertex < 3; vertex++ {
+			offset := 3*newIndex + vertex
+			if sc.VertexList[offset][0] != float32(oldIndex) || sc.NormalList[offset][1] != float32(oldIndex) || sc.UvList[offset][1] != float32(oldIndex) {
+				t.Fatalf("[prim %d] expected vertex %d data to be moved from primitive %d", newIndex, vertex, oldIndex)
+			}
+		}
+	}
+
+	if sc.EmissivePrimitives[0].PrimitiveIndex != 2 {
+		t.Fatalf("expected area light primitive index to be remapped to 2; got %d", sc.EmissivePrimitives[0].PrimitiveIndex)
+	}
+	if sc.EmissivePrimitives[1].PrimitiveIndex != 0 {
+		t.Fatalf("expected environment light primitive index not to be modified; got %d", sc.EmissivePrimitives[1].PrimitiveIndex)
+	}
+}
+
+func TestCompiledLeafPrimitivesAreContiguous(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+	ps.Meshes = []*input.Mesh{
+		genTestMesh("a", 50, 0),
+		genTestMesh("b", 17, 0),
+	}
+	for meshIndex := range ps.Meshes {
+		mi := &input.MeshInstance{
+			MeshIndex: uint32(meshIndex),
+			Transform: types.Ident4(),
+		}
+		bbox := ps.Meshes[meshIndex].BBox()
+		mi.SetBBox(bbox)
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertContiguousLeafs(t, sc)
+
+	// Running the pass on a scene whose leafs are already in traversal
+	// order should not touch the scene lists.
+	vertexData := &sc.VertexList[0]
+	if reorderLeafPrimitives(sc) {
+		t.Fatal("expected leaf primitives of compiled scene to already be in traversal order")
+	}
+	if &sc.VertexList[0] != vertexData {
+		t.Fatal("expected the vertex list to not be reallocated")
+	}
+}
+
+// Visit each mesh BVH in depth-first order and ensure that leaf primitive
+// ranges are contiguous and cover the entire mesh primitive range.
+func assertContiguousLeafs(t *testing.T, sc *scene.Scene) {
+	for meshIndex, mr := range sc.MeshRanges {
+		nextPrim := mr.FirstPrimitive
+		stack := []uint32{mr.BvhRoot}
+		for len(stack) > 0 {
+			node := sc.BvhNodeList[stack[len(stack)-1]]
+			stack = stack[:len(stack)-1]
+			if node.LData > 0 {
+				stack = append(stack, uint32(node.RData), uint32(node.LData))
+				continue
+			}
+
+			first, count := node.GetPrimitives()
+			if first != nextPrim {
+				t.Fatalf("[mesh %d] expected leaf to start at primitive %d; got %d", meshIndex, nextPrim, first)
+			}
+			nextPrim += count
+		}
+
+		if nextPrim != mr.FirstPrimitive+mr.PrimitiveCount {
+			t.Fatalf("[mesh %d] expected leafs to cover %d primitives; got %d", meshIndex, mr.PrimitiveCount, nextPrim-mr.FirstPrimitive)
+		}
+	}
+}
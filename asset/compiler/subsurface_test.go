@@ -0,0 +1,65 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestSubsurfaceMaterial(t *testing.T) {
+	specs := []struct {
+		expr          string
+		expColor      types.Vec3
+		expRadius     types.Vec3
+		expAnisotropy float32
+	}{
+		{
+			"subsurface()",
+			material.DefaultScatterColor.Vec3(),
+			material.DefaultScatterRadius.Vec3(),
+			0,
+		},
+		{
+			"subsurface(scatterColor: {0.9, 0.6, 0.5}, scatterRadius: {0.4, 0.15, 0.08}, anisotropy: -0.3)",
+			types.Vec3{0.9, 0.6, 0.5},
+			types.Vec3{0.4, 0.15, 0.08},
+			-0.3,
+		},
+	}
+
+	for specIndex, spec := range specs {
+		ps := input.NewScene()
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       "skin",
+			Expression: spec.expr,
+			Used:       true,
+		})
+		mesh := genTestMesh("mesh", 1, 0)
+		ps.Meshes = []*input.Mesh{mesh}
+		ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+		sc, _, err := Compile(ps, DefaultOptions())
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		node := sc.MaterialNodeList[sc.MaterialRoots[0]]
+		if nodeType := material.BxdfType(node.Union1[0]); nodeType != material.BxdfSubsurface {
+			t.Fatalf("[spec %d] expected node type to be %v; got %v", specIndex, material.BxdfSubsurface, nodeType)
+		}
+		if node.Union2.Vec3() != spec.expColor {
+			t.Errorf("[spec %d] expected scatter color to be %v; got %v", specIndex, spec.expColor, node.Union2.Vec3())
+		}
+		if node.Union3.Vec3() != spec.expRadius {
+			t.Errorf("[spec %d] expected scatter radius to be %v; got %v", specIndex, spec.expRadius, node.Union3.Vec3())
+		}
+		if node.Union4[2] != spec.expAnisotropy {
+			t.Errorf("[spec %d] expected anisotropy to be %v; got %v", specIndex, spec.expAnisotropy, node.Union4[2])
+		}
+		if sc.AllDiffuse {
+			t.Errorf("[spec %d] expected scenes with subsurface materials to not be flagged as all diffuse", specIndex)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package compiler
+
+import (
+	"math"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+// Primitives whose uv mapping determinant is smaller than this value have
+// (almost) zero area in texture space and do not define a tangent direction.
+const degenerateUVEpsilon = 1e-8
+
+// Calculate the tangents for the vertices of a primitive. The primitive
+// tangent and bitangent are derived from the uv deltas of the primitive edges
+// and then orthonormalized against each vertex normal. The w coordinate of each
+// tangent stores the handedness of the tangent frame so that the bitangent can
+// be reconstructed as w * cross(normal, tangent).
+//
+// If the uv mapping of the primitive is degenerate or the tangent is parallel
+// to a vertex normal, an arbitrary tangent that is orthonormal to the vertex
+// normal is used instead.
+func vertexTangents(prim *input.Primitive, normals [3]types.Vec3) [3]types.Vec4 {
+	var tangents [3]types.Vec4
+
+	e1 := prim.Vertices[1].Sub(prim.Vertices[0])
+	e2 := prim.Vertices[2].Sub(prim.Vertices[0])
+	duv1 := prim.UVs[1].Sub(prim.UVs[0])
+	duv2 := prim.UVs[2].Sub(prim.UVs[0])
+	det := duv1[0]*duv2[1] - duv2[0]*duv1[1]
+
+	var tangent, bitangent types.Vec3
+	validUVs := math.Abs(float64(det)) >= degenerateUVEpsilon && !math.IsInf(float64(det), 0) && !math.IsNaN(float64(det))
+	if validUVs {
+		invDet := 1.0 / det
+		tangent = e1.Mul(duv2[1]).Sub(e2.Mul(duv1[1])).Mul(invDet)
+		bitangent = e2.Mul(duv1[0]).Sub(e1.Mul(duv2[0])).Mul(invDet)
+	}
+
+	for corner, normal := range normals {
+		normal = normal.Normalize()
+		if validUVs {
+			// Gram-Schmidt orthonormalization
+			t := tangent.Sub(normal.Mul(normal.Dot(tangent)))
+			if tLen := t.Len(); tLen > degenerateUVEpsilon && !math.IsNaN(float64(tLen)) {
+				handedness := float32(1.0)
+				if normal.Cross(t).Dot(bitangent) < 0 {
+					handedness = -1.0
+				}
+				tangents[corner] = t.Mul(1.0 / tLen).Vec4(handedness)
+				continue
+			}
+		}
+
+		tangents[corner] = arbitraryTangent(normal).Vec4(1)
+	}
+
+	return tangents
+}
+
+// Get an arbitrary unit vector that is orthogonal to the given normal. This
+// mirrors the tangent frame generated by the tracer kernels when a surface
+// does not define a tangent.
+func arbitraryTangent(normal types.Vec3) types.Vec3 {
+	axis := types.Vec3{0, 0, 1}
+	if normal[2] >= 0.999 || normal[2] <= -0.999 {
+		axis = types.Vec3{1, 0, 0}
+	}
+	return axis.Cross(normal).Normalize()
+}
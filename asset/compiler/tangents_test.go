@@ -0,0 +1,140 @@
+package compiler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestVertexTangents(t *testing.T) {
+	vertices := [3]types.Vec3{
+		{0, 0, 0},
+		{1, 0, 0},
+		{0, 1, 0},
+	}
+	flatNormals := [3]types.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}}
+
+	specs := []struct {
+		uvs        [3]types.Vec2
+		expTangent types.Vec3
+		expHanded  float32
+		degenerate bool
+	}{
+		// u increases along +X and v along +Y
+		{[3]types.Vec2{{0, 0}, {1, 0}, {0, 1}}, types.Vec3{1, 0, 0}, 1, false},
+		// u increases along +Y and v along +X (mirrored mapping)
+		{[3]types.Vec2{{0, 0}, {0, 1}, {1, 0}}, types.Vec3{0, 1, 0}, -1, false},
+		// u increases along -X and v along +Y (mirrored mapping)
+		{[3]types.Vec2{{1, 0}, {0, 0}, {1, 1}}, types.Vec3{-1, 0, 0}, -1, false},
+		// zero area in texture space
+		{[3]types.Vec2{{0, 0}, {0, 0}, {0, 0}}, types.Vec3{}, 1, true},
+		{[3]types.Vec2{{0, 0}, {1, 1}, {2, 2}}, types.Vec3{}, 1, true},
+	}
+
+	for specIndex, spec := range specs {
+		prim := &input.Primitive{Vertices: vertices, UVs: spec.uvs}
+		tangents := vertexTangents(prim, flatNormals)
+
+		for corner, tangent := range tangents {
+			assertOrthonormalTangent(t, specIndex, corner, tangent, flatNormals[corner])
+			if tangent[3] != spec.expHanded {
+				t.Fatalf("[spec %d, vertex %d] expected tangent handedness to be %f; got %f", specIndex, corner, spec.expHanded, tangent[3])
+			}
+			if !spec.degenerate && !vec3ApproxEqual(tangent.Vec3(), spec.expTangent) {
+				t.Fatalf("[spec %d, vertex %d] expected tangent to be %v; got %v", specIndex, corner, spec.expTangent, tangent.Vec3())
+			}
+		}
+	}
+}
+
+func TestVertexTangentsAreOrthogonalToVertexNormals(t *testing.T) {
+	prim := &input.Primitive{
+		Vertices: [3]types.Vec3{
+			{0, 0, 0},
+			{1, 0, 0},
+			{0, 1, 0},
+		},
+		UVs: [3]types.Vec2{{0, 0}, {1, 0}, {0, 1}},
+	}
+	normals := [3]types.Vec3{
+		types.Vec3{-1, -1, 2}.Normalize(),
+		types.Vec3{1, 0, 1}.Normalize(),
+		// parallel to the primitive tangent
+		types.Vec3{1, 0, 0},
+	}
+
+	tangents := vertexTangents(prim, normals)
+	for corner, tangent := range tangents {
+		assertOrthonormalTangent(t, 0, corner, tangent, normals[corner])
+
+		// Tangents should still follow the u direction
+		if corner < 2 && tangent[0] <= 0 {
+			t.Fatalf("[vertex %d] expected tangent %v to point towards +X", corner, tangent.Vec3())
+		}
+	}
+}
+
+func TestCompiledSceneTangents(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+
+	prim := &input.Primitive{
+		Vertices: [3]types.Vec3{
+			{0, 0, 0},
+			{0, 0, -1},
+			{0, 1, 0},
+		},
+		Normals: [3]types.Vec3{{1, 0, 0}, {1, 0, 0}, {1, 0, 0}},
+		UVs:     [3]types.Vec2{{0, 0}, {1, 0}, {0, 1}},
+	}
+	prim.SetBBox([2]types.Vec3{{0, 0, -1}, {0, 1, 0}})
+	prim.SetCenter(types.Vec3{0, 0.5, -0.5})
+
+	mesh := input.NewMesh("triangle")
+	mesh.Primitives = append(mesh.Primitives, prim)
+	mesh.MarkBBoxDirty()
+	ps.Meshes = []*input.Mesh{mesh}
+
+	mi := &input.MeshInstance{
+		MeshIndex: 0,
+		Transform: types.Ident4(),
+	}
+	mi.SetBBox(mesh.BBox())
+	mi.SetCenter(types.Vec3{0, 0.5, -0.5})
+	ps.MeshInstances = append(ps.MeshInstances, mi)
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.TangentList) != len(sc.VertexList) {
+		t.Fatalf("expected the compiled scene to contain %d tangents; got %d", len(sc.VertexList), len(sc.TangentList))
+	}
+	expTangent := types.Vec4{0, 0, -1, 1}
+	for index, tangent := range sc.TangentList {
+		if !vec3ApproxEqual(tangent.Vec3(), expTangent.Vec3()) || tangent[3] != expTangent[3] {
+			t.Fatalf("[vertex %d] expected tangent to be %v; got %v", index, expTangent, tangent)
+		}
+	}
+}
+
+func assertOrthonormalTangent(t *testing.T, specIndex, corner int, tangent types.Vec4, normal types.Vec3) {
+	for _, v := range tangent {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			t.Fatalf("[spec %d, vertex %d] expected a finite tangent; got %v", specIndex, corner, tangent)
+		}
+	}
+	if tLen := tangent.Vec3().Len(); math.Abs(float64(tLen)-1) > 1e-5 {
+		t.Fatalf("[spec %d, vertex %d] expected a unit length tangent; got length %f", specIndex, corner, tLen)
+	}
+	if dot := tangent.Vec3().Dot(normal.Normalize()); math.Abs(float64(dot)) > 1e-5 {
+		t.Fatalf("[spec %d, vertex %d] expected tangent %v to be orthogonal to normal %v; got dot product %f", specIndex, corner, tangent.Vec3(), normal, dot)
+	}
+}
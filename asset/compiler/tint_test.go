@@ -0,0 +1,66 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMeshInstanceTint(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+
+	mesh := genTestMesh("mesh", 2, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+
+	tints := []types.Vec3{
+		{1, 0, 0},
+		{0, 0.5, 1},
+		// No tint
+		{},
+	}
+	for index, tint := range tints {
+		translation := types.Vec3{float32(2 * index), 0, 0}
+		mi := &input.MeshInstance{
+			MeshIndex: 0,
+			Transform: types.Translate4(translation),
+			Tint:      tint,
+		}
+		bbox := mesh.BBox()
+		mi.SetBBox([2]types.Vec3{bbox[0].Add(translation), bbox[1].Add(translation)})
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5).Add(translation))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expTints := []types.Vec3{
+		{1, 0, 0},
+		{0, 0.5, 1},
+		{1, 1, 1},
+	}
+	if len(sc.MeshInstanceList) != len(expTints) {
+		t.Fatalf("expected %d mesh instances; got %d", len(expTints), len(sc.MeshInstanceList))
+	}
+	for index, expTint := range expTints {
+		mi := sc.MeshInstanceList[index]
+		if mi.MeshIndex != 0 {
+			t.Fatalf("[instance %d] expected mesh index to be 0; got %d", index, mi.MeshIndex)
+		}
+		if tint := mi.Tint.Vec3(); tint != expTint {
+			t.Fatalf("[instance %d] expected tint to be %v; got %v", index, expTint, tint)
+		}
+	}
+
+	if sc.MeshInstanceList[0].Tint == sc.MeshInstanceList[1].Tint {
+		t.Fatal("expected instances of the same mesh to carry different tints")
+	}
+}
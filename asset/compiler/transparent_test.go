@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+)
+
+func TestTransparentMaterial(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "glass pane",
+		Expression: "mix(diffuse(reflectance: {0.5, 0.5, 0.5}), transparent(), 0.5)",
+		Used:       true,
+	})
+	mesh := genTestMesh("mesh", 2, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := sc.MaterialNodeList[sc.MaterialRoots[0]]
+	if material.OpType(root.Union1[0]) != material.OpMix {
+		t.Fatalf("expected root node to be a mix node; got type %d", root.Union1[0])
+	}
+	if root.Union2[0] != 0.5 {
+		t.Fatalf("expected mix weight to be 0.5; got %f", root.Union2[0])
+	}
+
+	left, right := sc.MaterialNodeList[root.Union1[1]], sc.MaterialNodeList[root.Union1[2]]
+	if material.BxdfType(left.Union1[0]) != material.BxdfDiffuse {
+		t.Fatalf("expected left child to be a diffuse node; got type %d", left.Union1[0])
+	}
+	if material.BxdfType(right.Union1[0]) != material.BxdfTransparent {
+		t.Fatalf("expected right child to be a transparent node; got type %d", right.Union1[0])
+	}
+	if exp := material.DefaultTransmittance.Vec3(); right.Union3.Vec3() != exp {
+		t.Fatalf("expected transparent node transmittance to be %v; got %v", exp, right.Union3.Vec3())
+	}
+}
+
+func TestMaterialTransparency(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:         "tinted glass",
+		Expression:   "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Transparency: 0.25,
+		Used:         true,
+	})
+	mesh := genTestMesh("mesh", 2, 0)
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{genTestMeshInstance(mesh)}
+
+	sc, _, err := Compile(ps, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The material should be blended with a transparent bxdf using its
+	// opacity as the mix weight
+	root := sc.MaterialNodeList[sc.MaterialRoots[0]]
+	if material.OpType(root.Union1[0]) != material.OpMix {
+		t.Fatalf("expected root node to be a mix node; got type %d", root.Union1[0])
+	}
+	if root.Union2[0] != 0.75 {
+		t.Fatalf("expected mix weight to be 0.75; got %f", root.Union2[0])
+	}
+	left, right := sc.MaterialNodeList[root.Union1[1]], sc.MaterialNodeList[root.Union1[2]]
+	if material.BxdfType(left.Union1[0]) != material.BxdfDiffuse {
+		t.Fatalf("expected left child to be a diffuse node; got type %d", left.Union1[0])
+	}
+	if material.BxdfType(right.Union1[0]) != material.BxdfTransparent {
+		t.Fatalf("expected right child to be a transparent node; got type %d", right.Union1[0])
+	}
+
+	ps.Materials[0].Transparency = 1.5
+	_, _, err = Compile(ps, DefaultOptions())
+	expError := `material "tinted glass": transparency should be in the [0, 1] range; got 1.5`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,116 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/achilleasa/polaris/asset/scene"
+)
+
+// Verify that all BVH node child indices point inside the scene BVH node list
+// and that all leaf primitive ranges and mesh instance indices point inside
+// the scene primitive and mesh instance lists. The GPU kernels do not perform
+// any bounds checking so a bogus index results in out-of-bounds reads.
+//
+// The scene BVH node list contains the top-level BVH nodes followed by the
+// nodes of each mesh BVH as described by the scene mesh ranges.
+func validateBvh(optimizedScene *scene.Scene) error {
+	numNodes := uint32(len(optimizedScene.BvhNodeList))
+	numPrims := uint32(len(optimizedScene.MaterialIndex))
+	if optimizedScene.IsIndexed() {
+		if err := validateIndices(optimizedScene, numPrims); err != nil {
+			return err
+		}
+	} else {
+		if uint32(len(optimizedScene.VertexList)) < 3*numPrims ||
+			uint32(len(optimizedScene.NormalList)) < 3*numPrims ||
+			uint32(len(optimizedScene.UvList)) < 3*numPrims {
+			return fmt.Errorf("scene compiler: vertex, normal and uv lists must contain 3 entries for each one of the %d primitives", numPrims)
+		}
+		if len(optimizedScene.TangentList) != 0 && uint32(len(optimizedScene.TangentList)) < 3*numPrims {
+			return fmt.Errorf("scene compiler: tangent list must contain 3 entries for each one of the %d primitives", numPrims)
+		}
+	}
+
+	// Top-level BVH nodes precede the mesh BVH nodes
+	topLevelNodes := numNodes
+	for _, mr := range optimizedScene.MeshRanges {
+		if mr.BvhRoot < topLevelNodes {
+			topLevelNodes = mr.BvhRoot
+		}
+	}
+
+	for nodeIndex := uint32(0); nodeIndex < topLevelNodes; nodeIndex++ {
+		node := &optimizedScene.BvhNodeList[nodeIndex]
+		if node.LData > 0 {
+			if err := validateChildNodes(nodeIndex, node, numNodes); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if first, count := node.GetMeshInstances(); first+count > uint32(len(optimizedScene.MeshInstanceList)) {
+			return fmt.Errorf("scene compiler: top-level BVH leaf %d points to mesh instance range [%d, %d); scene contains %d mesh instances", nodeIndex, first, first+count, len(optimizedScene.MeshInstanceList))
+		}
+	}
+
+	for meshIndex, mr := range optimizedScene.MeshRanges {
+		if mr.BvhRoot+mr.BvhNodeCount > numNodes {
+			return fmt.Errorf("scene compiler: BVH node range [%d, %d) for mesh %d exceeds BVH node list length %d", mr.BvhRoot, mr.BvhRoot+mr.BvhNodeCount, meshIndex, numNodes)
+		}
+
+		for nodeIndex := mr.BvhRoot; nodeIndex < mr.BvhRoot+mr.BvhNodeCount; nodeIndex++ {
+			node := &optimizedScene.BvhNodeList[nodeIndex]
+			if node.LData > 0 {
+				if err := validateChildNodes(nodeIndex, node, numNodes); err != nil {
+					return err
+				}
+				continue
+			}
+
+			first, count := node.GetPrimitives()
+			if first+count > numPrims {
+				return fmt.Errorf("scene compiler: BVH leaf %d for mesh %d points to primitive range [%d, %d); scene contains %d primitives", nodeIndex, meshIndex, first, first+count, numPrims)
+			}
+		}
+	}
+
+	for index, mi := range optimizedScene.MeshInstanceList {
+		if mi.BvhRoot >= numNodes {
+			return fmt.Errorf("scene compiler: mesh instance %d points to BVH root %d; BVH node list length is %d", index, mi.BvhRoot, numNodes)
+		}
+	}
+
+	return nil
+}
+
+// Verify that the child indices of an internal BVH node are within bounds.
+func validateChildNodes(nodeIndex uint32, node *scene.BvhNode, numNodes uint32) error {
+	if uint32(node.LData) >= numNodes || node.RData <= 0 || uint32(node.RData) >= numNodes {
+		return fmt.Errorf("scene compiler: BVH node %d has out of bounds child node indices (%d, %d); BVH node list length is %d", nodeIndex, node.LData, node.RData, numNodes)
+	}
+
+	return nil
+}
+
+// Verify that the index list of an indexed scene contains 3 entries for each
+// primitive and that all indices point inside the vertex attribute lists.
+func validateIndices(optimizedScene *scene.Scene, numPrims uint32) error {
+	if uint32(len(optimizedScene.IndexList)) != 3*numPrims {
+		return fmt.Errorf("scene compiler: index list must contain 3 entries for each one of the %d primitives; got %d", numPrims, len(optimizedScene.IndexList))
+	}
+
+	numVertices := uint32(len(optimizedScene.VertexList))
+	if uint32(len(optimizedScene.NormalList)) != numVertices || uint32(len(optimizedScene.UvList)) != numVertices {
+		return fmt.Errorf("scene compiler: vertex, normal and uv lists of indexed scenes must have the same length")
+	}
+	if len(optimizedScene.TangentList) != 0 && uint32(len(optimizedScene.TangentList)) != numVertices {
+		return fmt.Errorf("scene compiler: tangent list of indexed scenes must have the same length as the vertex list")
+	}
+
+	for offset, index := range optimizedScene.IndexList {
+		if index >= numVertices {
+			return fmt.Errorf("scene compiler: index %d of primitive %d points to vertex %d; scene contains %d vertices", offset%3, offset/3, index, numVertices)
+		}
+	}
+	return nil
+}
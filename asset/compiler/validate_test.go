@@ -0,0 +1,123 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestValidateBvh(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+	ps.Meshes = []*input.Mesh{
+		genTestMesh("a", 50, 0),
+		genTestMesh("b", 17, 0),
+	}
+	for meshIndex := range ps.Meshes {
+		mi := &input.MeshInstance{
+			MeshIndex: uint32(meshIndex),
+			Transform: types.Ident4(),
+		}
+		bbox := ps.Meshes[meshIndex].BBox()
+		mi.SetBBox(bbox)
+		mi.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+		ps.MeshInstances = append(ps.MeshInstances, mi)
+	}
+
+	opts := DefaultOptions()
+	opts.StrictChecks = true
+	sc, _, err := Compile(ps, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the right child offset of the last mesh BVH root
+	mr := sc.MeshRanges[len(sc.MeshRanges)-1]
+	root := &sc.BvhNodeList[mr.BvhRoot]
+	if root.LData <= 0 {
+		t.Fatal("expected mesh BVH root to be an internal node")
+	}
+	origRData := root.RData
+	root.RData = int32(len(sc.BvhNodeList))
+
+	err = validateBvh(sc)
+	if err == nil || !strings.Contains(err.Error(), "out of bounds child node indices") {
+		t.Fatalf("expected an out of bounds child node error; got %v", err)
+	}
+	root.RData = origRData
+
+	// Corrupt a leaf primitive range
+	for nodeIndex := mr.BvhRoot; nodeIndex < mr.BvhRoot+mr.BvhNodeCount; nodeIndex++ {
+		node := &sc.BvhNodeList[nodeIndex]
+		if node.LData > 0 {
+			continue
+		}
+
+		first, count := node.GetPrimitives()
+		node.SetPrimitives(first, count+1+uint32(len(sc.MaterialIndex)))
+		break
+	}
+
+	err = validateBvh(sc)
+	if err == nil || !strings.Contains(err.Error(), "primitive range") {
+		t.Fatalf("expected an out of bounds primitive range error; got %v", err)
+	}
+}
+
+func TestCompileRejectsInvalidScenes(t *testing.T) {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:          "layered",
+		Expression:    `mix(diffuse(reflectance: "layers[2]"), conductor(specularity: "layers[0]"), 0.5, "layers[5]")`,
+		TextureArrays: map[string][]string{"layers": {"a.png", "b.png"}},
+		CubeMaps:      map[string][6]string{"sky": {"px.png", "nx.png", "", "ny.png", "pz.png", "nz.png"}},
+		Used:          true,
+	})
+	ps.Meshes = []*input.Mesh{
+		genTestMesh("a", 3, 0),
+		input.NewMesh("empty"),
+	}
+	ps.Meshes[0].Primitives[1].MaterialIndex = 3
+	ps.Meshes[0].Primitives[2].MaterialIndex = -1
+	ps.MeshInstances = []*input.MeshInstance{
+		genTestMeshInstance(ps.Meshes[0]),
+		{MeshIndex: 7, Transform: types.Ident4()},
+	}
+
+	expError := `invalid scene: found 5 problem(s):
+  - mesh instance 1 references mesh 7; scene contains 2 meshes
+  - mesh "empty" does not contain any primitives
+  - material "layered": cube map "sky" does not define a texture for face 2
+  - material "layered": texture array "layers" has 2 layers; layer 2 is out of range
+  - material "layered": texture array "layers" has 2 layers; layer 5 is out of range`
+
+	_, diagnostics, err := Compile(ps, DefaultOptions())
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error:\n%s\ngot:\n%v", expError, err)
+	}
+	if diagnostics == nil {
+		t.Fatal("expected diagnostics to be returned when validation fails")
+	}
+
+	// Fix all problems; primitives referencing missing materials are
+	// assigned the default material by the compiler.
+	ps.Materials[0].Expression = `mix(diffuse(reflectance: "layers[1]"), conductor(specularity: "layers[0]"), 0.5, "layers[1]")`
+	ps.Materials[0].CubeMaps["sky"] = [6]string{"px.png", "nx.png", "py.png", "ny.png", "pz.png", "nz.png"}
+	ps.Meshes = ps.Meshes[:1]
+	ps.MeshInstances = ps.MeshInstances[:1]
+	if err = ps.Validate(); err != nil {
+		t.Fatalf("expected fixed scene to be valid; got %v", err)
+	}
+
+	ps.MeshInstances = nil
+	expError = "invalid scene: found 1 problem(s):\n  - scene does not contain any mesh instances"
+	if err = ps.Validate(); err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
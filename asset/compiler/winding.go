@@ -0,0 +1,160 @@
+package compiler
+
+import (
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+// An undirected mesh edge. The edge endpoints are sorted so that the two
+// primitives sharing an edge map to the same key regardless of their winding.
+type windingEdge [2]types.Vec3
+
+// Create an edge key for the directed edge from v0 to v1. The returned flag is
+// true if the endpoints were swapped while sorting them.
+func newWindingEdge(v0, v1 types.Vec3) (windingEdge, bool) {
+	for axis := 0; axis < 3; axis++ {
+		if v0[axis] < v1[axis] {
+			return windingEdge{v0, v1}, false
+		} else if v0[axis] > v1[axis] {
+			return windingEdge{v1, v0}, true
+		}
+	}
+	return windingEdge{v0, v1}, false
+}
+
+// A primitive edge reference stored in the mesh adjacency map.
+type windingEdgeRef struct {
+	primIndex int
+	reversed  bool
+}
+
+// Make the vertex winding of all primitives consistent across each connected
+// region of the scene meshes and return the total number of flipped
+// primitives. A diagnostic is emitted for each mesh with flipped primitives.
+func (sc *sceneCompiler) repairWinding(repair WindingRepair) int {
+	if repair == NoWindingRepair {
+		return 0
+	}
+
+	total := 0
+	for meshIndex, pm := range sc.parsedScene.Meshes {
+		for _, mesh := range append([]*input.Mesh{pm}, pm.LODs...) {
+			flipped := repairMeshWinding(mesh, repair, sc.frontFaceWinding)
+			if flipped > 0 {
+				sc.diagnostics.warnf(StageGeometry, meshIndex, "mesh %q: flipped %d primitive(s) with inconsistent winding", mesh.Name, flipped)
+			}
+			total += flipped
+		}
+	}
+
+	if total > 0 {
+		sc.logger.Noticef("flipped the winding of %d primitive(s)", total)
+	}
+	return total
+}
+
+// Flip the primitives of a mesh so that adjacent primitives have a consistent
+// vertex winding and return the number of flipped primitives. Two primitives
+// sharing an edge are consistently wound if they traverse the shared edge in
+// opposite directions. The first primitive of each connected region defines
+// the winding for the region. If the OutwardWinding repair mode is used, each
+// region is flipped as a whole if the signed volume enclosed by its front
+// faces relative to the region centroid is negative.
+func repairMeshWinding(mesh *input.Mesh, repair WindingRepair, winding Winding) int {
+	adjacency := make(map[windingEdge][]windingEdgeRef, 3*len(mesh.Primitives))
+	for primIndex, prim := range mesh.Primitives {
+		for corner := 0; corner < 3; corner++ {
+			edge, reversed := newWindingEdge(prim.Vertices[corner], prim.Vertices[(corner+1)%3])
+			if edge[0] == edge[1] {
+				continue
+			}
+			adjacency[edge] = append(adjacency[edge], windingEdgeRef{primIndex, reversed})
+		}
+	}
+
+	// Visit each connected region and decide which primitives to flip
+	visited := make([]bool, len(mesh.Primitives))
+	flip := make([]bool, len(mesh.Primitives))
+	for seed := range mesh.Primitives {
+		if visited[seed] {
+			continue
+		}
+
+		region := []int{seed}
+		visited[seed] = true
+		for next := 0; next < len(region); next++ {
+			primIndex := region[next]
+			prim := mesh.Primitives[primIndex]
+			for corner := 0; corner < 3; corner++ {
+				edge, reversed := newWindingEdge(prim.Vertices[corner], prim.Vertices[(corner+1)%3])
+				for _, ref := range adjacency[edge] {
+					if visited[ref.primIndex] {
+						continue
+					}
+
+					// Primitives traversing the shared edge in the same
+					// direction need opposite flip states
+					visited[ref.primIndex] = true
+					flip[ref.primIndex] = flip[primIndex] == (ref.reversed != reversed)
+					region = append(region, ref.primIndex)
+				}
+			}
+		}
+
+		if repair == OutwardWinding && regionVolume(mesh, region, flip, winding) < 0 {
+			for _, primIndex := range region {
+				flip[primIndex] = !flip[primIndex]
+			}
+		}
+	}
+
+	flipped := 0
+	for primIndex, prim := range mesh.Primitives {
+		if flip[primIndex] {
+			flipPrimitive(prim, winding)
+			flipped++
+		}
+	}
+	return flipped
+}
+
+// Calculate the signed volume (scaled by 6) enclosed by the front faces of a
+// mesh region relative to the region centroid. The flip flags are applied to
+// each primitive before calculating its contribution.
+func regionVolume(mesh *input.Mesh, region []int, flip []bool, winding Winding) float32 {
+	var centroid types.Vec3
+	for _, primIndex := range region {
+		prim := mesh.Primitives[primIndex]
+		centroid = centroid.Add(prim.Vertices[0].Add(prim.Vertices[1]).Add(prim.Vertices[2]))
+	}
+	centroid = centroid.Mul(1.0 / float32(3*len(region)))
+
+	var volume float32
+	for _, primIndex := range region {
+		prim := mesh.Primitives[primIndex]
+		contrib := winding.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2]).Dot(prim.Vertices[0].Sub(centroid))
+		if flip[primIndex] {
+			contrib = -contrib
+		}
+		volume += contrib
+	}
+	return volume
+}
+
+// Reverse the vertex winding of a primitive. Vertex normals that lie in the
+// hemisphere of the original face normal were most likely generated from the
+// incorrect winding so they are also flipped.
+func flipPrimitive(prim *input.Primitive, winding Winding) {
+	faceNormal := winding.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2])
+	avgNormal := prim.Normals[0].Add(prim.Normals[1]).Add(prim.Normals[2])
+
+	prim.Vertices[1], prim.Vertices[2] = prim.Vertices[2], prim.Vertices[1]
+	prim.Normals[1], prim.Normals[2] = prim.Normals[2], prim.Normals[1]
+	prim.UVs[1], prim.UVs[2] = prim.UVs[2], prim.UVs[1]
+
+	if faceNormal.Dot(avgNormal) > 0 {
+		for corner := range prim.Normals {
+			prim.Normals[corner] = prim.Normals[corner].Mul(-1)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestRepairWinding(t *testing.T) {
+	// A tetrahedron whose faces list their vertices in counter-clockwise
+	// order when viewed from outside. Face 2 uses the opposite winding.
+	genMesh := func(reversed ...int) *input.Mesh {
+		a, b, c, d := types.Vec3{0, 0, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 1, 0}, types.Vec3{0, 0, 1}
+		faces := [][3]types.Vec3{
+			{a, c, b},
+			{a, b, d},
+			{a, d, c},
+			{b, c, d},
+		}
+		for _, faceIndex := range reversed {
+			faces[faceIndex][1], faces[faceIndex][2] = faces[faceIndex][2], faces[faceIndex][1]
+		}
+
+		mesh := input.NewMesh("tetrahedron")
+		for _, face := range faces {
+			// Vertex normals are generated from the face winding
+			n := CounterClockwise.FaceNormal(face[0], face[1], face[2]).Normalize()
+			prim := &input.Primitive{
+				Vertices: face,
+				Normals:  [3]types.Vec3{n, n, n},
+			}
+			prim.SetBBox([2]types.Vec3{types.MinVec3(face[0], types.MinVec3(face[1], face[2])), types.MaxVec3(face[0], types.MaxVec3(face[1], face[2]))})
+			prim.SetCenter(face[0].Add(face[1]).Add(face[2]).Mul(1.0 / 3.0))
+			mesh.Primitives = append(mesh.Primitives, prim)
+		}
+		mesh.MarkBBoxDirty()
+		return mesh
+	}
+
+	assertOutward := func(specIndex int, mesh *input.Mesh) {
+		centroid := types.Vec3{0.25, 0.25, 0.25}
+		for primIndex, prim := range mesh.Primitives {
+			faceNormal := CounterClockwise.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2])
+			if faceNormal.Dot(prim.Center().Sub(centroid)) <= 0 {
+				t.Fatalf("[spec %d] expected primitive %d to face outwards; got face normal %v", specIndex, primIndex, faceNormal)
+			}
+			for corner, n := range prim.Normals {
+				if n.Dot(faceNormal) <= 0 {
+					t.Fatalf("[spec %d] expected primitive %d vertex normal %d to agree with face normal %v; got %v", specIndex, primIndex, corner, faceNormal, n)
+				}
+			}
+		}
+	}
+
+	specs := []struct {
+		repair     WindingRepair
+		reversed   []int
+		expFlipped int
+	}{
+		// Face 0 defines the winding for the mesh
+		{ConsistentWinding, []int{2}, 1},
+		{ConsistentWinding, nil, 0},
+		// All faces point inwards
+		{OutwardWinding, []int{0, 1, 2, 3}, 4},
+		// Face 0 points inwards; its neighbors get flipped first and
+		// then the whole mesh is flipped to face outwards.
+		{OutwardWinding, []int{0}, 1},
+	}
+
+	for specIndex, spec := range specs {
+		mesh := genMesh(spec.reversed...)
+		if flipped := repairMeshWinding(mesh, spec.repair, CounterClockwise); flipped != spec.expFlipped {
+			t.Fatalf("[spec %d] expected %d primitive(s) to be flipped; got %d", specIndex, spec.expFlipped, flipped)
+		}
+		assertOutward(specIndex, mesh)
+	}
+
+	// Compiling with the winding repair pass should report the flipped primitives
+	mesh := genMesh(2)
+	ps := genOpacityTestScene(mesh)
+	opts := DefaultOptions()
+	opts.WindingRepair = ConsistentWinding
+	_, diag, err := Compile(ps, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertOutward(len(specs), mesh)
+
+	expMessage := `mesh "tetrahedron": flipped 1 primitive(s) with inconsistent winding`
+	if entries := diag.ForStage(StageGeometry); len(entries) != 1 || entries[0].Message != expMessage {
+		t.Fatalf("expected a geometry diagnostic with message %q; got %v", expMessage, entries)
+	}
+}
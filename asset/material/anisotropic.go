@@ -0,0 +1,5 @@
+package material
+
+// The minimum roughness value used by the microfacet bxdfs. This matches the
+// MIN_ROUGHNESS value used by the tracer kernels.
+const MinRoughness float32 = 0.1
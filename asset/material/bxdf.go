@@ -12,6 +12,9 @@ const (
 	BxdfRoughtConductor
 	BxdfDielectric
 	BxdfRoughDielectric
+	BxdfAnisotropicConductor
+	BxdfTransparent
+	BxdfSubsurface
 	//
 	bxdfLastEntry
 )
@@ -31,6 +34,12 @@ func bxdfTypeFromName(name string) BxdfType {
 		return BxdfDielectric
 	case "roughDielectric":
 		return BxdfRoughDielectric
+	case "anisotropicConductor":
+		return BxdfAnisotropicConductor
+	case "transparent":
+		return BxdfTransparent
+	case "subsurface":
+		return BxdfSubsurface
 	}
 
 	return bxdfInvalid
@@ -50,6 +59,12 @@ func (t BxdfType) String() string {
 		return "dielectric"
 	case BxdfRoughDielectric:
 		return "roughDielectric"
+	case BxdfAnisotropicConductor:
+		return "anisotropicConductor"
+	case BxdfTransparent:
+		return "transparent"
+	case BxdfSubsurface:
+		return "subsurface"
 	}
 
 	return "invalid"
@@ -9,6 +9,8 @@ var (
 	DefaultTransmittance          = types.Vec4{1.0, 1.0, 1.0, 0.0}
 	DefaultRadiance               = types.Vec4{1.0, 1.0, 1.0, 0.0}
 	DefaultRadianceScaler float32 = 1.0
+	DefaultScatterColor           = types.Vec4{0.8, 0.8, 0.8, 0.0}
+	DefaultScatterRadius          = types.Vec4{0.1, 0.1, 0.1, 0.0}
 	DefaultIntIOR                 = KnownIORs["Glass"]
 	DefaultExtIOR                 = KnownIORs["Air"]
 )
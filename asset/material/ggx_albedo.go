@@ -0,0 +1,158 @@
+package material
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// The number of alpha and cos(theta) entries in the GGX albedo table that is
+// embedded into the tracer kernels.
+const GGXAlbedoTableSize = 32
+
+// The number of stratified samples per axis used for estimating the
+// directional albedo of each table entry.
+const ggxAlbedoSamplesPerAxis = 64
+
+// A table with the directional albedo E(mu) of a white (ks = 1, no fresnel)
+// isotropic GGX microfacet surface that only models single scattering. The
+// table is used for implementing the Kulla-Conty multiple scattering energy
+// compensation term which restores the energy that single-scatter GGX loses
+// at high roughness values.
+//
+// The table is indexed by the GGX alpha value (roughness^2) and the cosine of
+// the angle between the surface normal and the viewing direction. Both
+// parameters are uniformly sampled in the [0, 1] range.
+type GGXAlbedoTable struct {
+	Size uint32
+
+	// Directional albedo values; rows correspond to alpha values and
+	// columns to cos(theta) values.
+	Albedo []float32
+
+	// The cosine-weighted hemispherical average of the directional albedo
+	// for each alpha value.
+	Average []float32
+}
+
+// Calculate the directional albedo table using numerical integration.
+func NewGGXAlbedoTable(size uint32) *GGXAlbedoTable {
+	t := &GGXAlbedoTable{
+		Size:    size,
+		Albedo:  make([]float32, size*size),
+		Average: make([]float32, size),
+	}
+
+	step := 1.0 / float32(size-1)
+	for row := uint32(0); row < size; row++ {
+		alpha := float32(math.Max(float64(float32(row)*step), float64(MinRoughness*MinRoughness)))
+		for col := uint32(0); col < size; col++ {
+			t.Albedo[row*size+col] = ggxDirectionalAlbedo(alpha, float32(col)*step)
+		}
+
+		// Eavg = 2 * integral(E(mu) * mu * dmu)
+		var avg float64
+		for sample := 0; sample < ggxAlbedoSamplesPerAxis; sample++ {
+			mu := (float32(sample) + 0.5) / ggxAlbedoSamplesPerAxis
+			avg += float64(t.lookup(t.Albedo[row*size:(row+1)*size], mu) * mu)
+		}
+		t.Average[row] = float32(2 * avg / ggxAlbedoSamplesPerAxis)
+	}
+
+	return t
+}
+
+// Write the table as a set of opencl constant arrays.
+func (t *GGXAlbedoTable) WriteCL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "#ifndef GGX_ALBEDO_TABLE_CL\n#define GGX_ALBEDO_TABLE_CL\n\n")
+	fmt.Fprintf(bw, "// This file is generated by material.GGXAlbedoTable.WriteCL; do not edit.\n")
+	fmt.Fprintf(bw, "//\n// Directional albedo of a white single-scatter GGX surface indexed by alpha\n// (rows) and cos(theta) (columns) followed by the average albedo per alpha.\n\n")
+	fmt.Fprintf(bw, "#define GGX_ALBEDO_TABLE_SIZE %d\n\n", t.Size)
+
+	fmt.Fprintf(bw, "__constant float ggxAlbedoTable[GGX_ALBEDO_TABLE_SIZE * GGX_ALBEDO_TABLE_SIZE] = {\n")
+	for row := uint32(0); row < t.Size; row++ {
+		writeCLFloatRow(bw, t.Albedo[row*t.Size:(row+1)*t.Size])
+	}
+	fmt.Fprintf(bw, "};\n\n")
+
+	fmt.Fprintf(bw, "__constant float ggxAverageAlbedoTable[GGX_ALBEDO_TABLE_SIZE] = {\n")
+	writeCLFloatRow(bw, t.Average)
+	fmt.Fprintf(bw, "};\n\n#endif\n")
+
+	return bw.Flush()
+}
+
+// Estimate the directional albedo of a white single-scatter GGX surface by
+// importance sampling the distribution of microfacet normals.
+func ggxDirectionalAlbedo(alpha, cosTheta float32) float32 {
+	cosTheta = float32(math.Max(float64(cosTheta), 1e-3))
+	inRayDir := types.Vec3{float32(math.Sqrt(float64(1 - cosTheta*cosTheta))), 0, cosTheta}
+
+	var sum float64
+	for i := 0; i < ggxAlbedoSamplesPerAxis; i++ {
+		u := (float64(i) + 0.5) / ggxAlbedoSamplesPerAxis
+		theta := math.Atan(float64(alpha) * math.Sqrt(u/(1-u)))
+		for j := 0; j < ggxAlbedoSamplesPerAxis; j++ {
+			phi := 2 * math.Pi * (float64(j) + 0.5) / ggxAlbedoSamplesPerAxis
+			h := types.Vec3{
+				float32(math.Sin(theta) * math.Cos(phi)),
+				float32(math.Sin(theta) * math.Sin(phi)),
+				float32(math.Cos(theta)),
+			}
+
+			iDotH := inRayDir.Dot(h)
+			outRayDir := h.Mul(2 * iDotH).Sub(inRayDir)
+			if outRayDir[2] <= 0 || iDotH <= 0 {
+				continue
+			}
+
+			// f * cos(o) / pdf = G * iDotH / (iDotN * hDotN)
+			g := ggxG1(alpha, inRayDir, h) * ggxG1(alpha, outRayDir, h)
+			sum += float64(g * iDotH / (cosTheta * h[2]))
+		}
+	}
+
+	return float32(sum / (ggxAlbedoSamplesPerAxis * ggxAlbedoSamplesPerAxis))
+}
+
+// G1(v, m) = 2 / 1 + sqrt( 1 + a^2 * tanv^2 )
+func ggxG1(alpha float32, v, m types.Vec3) float32 {
+	nDotV := v[2]
+	if nDotV*v.Dot(m) <= 0 {
+		return 0
+	}
+	nDotVSq := nDotV * nDotV
+	tanSq := (1 - nDotVSq) / nDotVSq
+	return 2 / (1 + float32(math.Sqrt(float64(1+alpha*alpha*tanSq))))
+}
+
+// Linearly interpolate a list of values sampled uniformly in the [0, 1] range.
+func (t *GGXAlbedoTable) lookup(values []float32, x float32) float32 {
+	x = clamp01(x) * float32(len(values)-1)
+	index := int(x)
+	if index >= len(values)-1 {
+		return values[len(values)-1]
+	}
+	frac := x - float32(index)
+	return values[index] + (values[index+1]-values[index])*frac
+}
+
+func clamp01(v float32) float32 {
+	return float32(math.Max(0, math.Min(1, float64(v))))
+}
+
+func writeCLFloatRow(w io.Writer, values []float32) {
+	fmt.Fprintf(w, "\t")
+	for index, v := range values {
+		if index > 0 {
+			fmt.Fprintf(w, ", ")
+		}
+		fmt.Fprintf(w, "%.6ff", v)
+	}
+	fmt.Fprintf(w, ",\n")
+}
@@ -0,0 +1,49 @@
+package material
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestGGXAlbedoTable(t *testing.T) {
+	table := NewGGXAlbedoTable(GGXAlbedoTableSize)
+	size := table.Size
+
+	for index, albedo := range table.Albedo {
+		if albedo < 0 || albedo > 1 {
+			t.Fatalf("[entry %d] expected directional albedo to be in the [0, 1] range; got %f", index, albedo)
+		}
+	}
+	for row := uint32(1); row < size; row++ {
+		if table.Average[row] > table.Average[row-1] {
+			t.Fatalf("[row %d] expected average albedo to decrease with roughness; got %f > %f", row, table.Average[row], table.Average[row-1])
+		}
+	}
+
+	// A smooth white surface should reflect all incoming energy
+	if albedo := table.Albedo[size-1]; albedo < 0.99 {
+		t.Fatalf("expected smooth surface albedo at normal incidence to be close to 1; got %f", albedo)
+	}
+
+	// Energy loss for very rough surfaces should be significant
+	if avg := table.Average[size-1]; avg > 0.8 {
+		t.Fatalf("expected average albedo for roughness 1 to be < 0.8; got %f", avg)
+	}
+}
+
+func TestGGXAlbedoTableMatchesKernel(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewGGXAlbedoTable(GGXAlbedoTableSize).WriteCL(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	kernelTable, err := ioutil.ReadFile("../../tracer/opencl/CL/bxdf/ggx_albedo_table.cl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), kernelTable) {
+		t.Fatal("expected ggx_albedo_table.cl to match the table generated by GGXAlbedoTable.WriteCL; regenerate the kernel table")
+	}
+}
@@ -5,6 +5,7 @@ package material
 import (
 	"fmt"
 	"bytes"
+	"errors"
 	"strconv"
 	"unicode/utf8"
 )
@@ -54,13 +55,14 @@ import (
 %token <sVal> tokBUMP_MAP
 %token <sVal> tokNORMAL_MAP
 %token <sVal> tokDISPERSE
+%token <sVal> tokFRESNEL_BLEND
 
 /* types for non-token items */
 %type <node> material_def
 %type <node> float3
 %type <node> bxdf_parameter
 %type <node> float3_or_texture
-%type <node> float_or_name
+%type <node> float_name_or_texture
 %type <node> float_or_texture
 %type <node> op_spec
 %type <node> opt_bxdf_parameter_list
@@ -110,9 +112,9 @@ bxdf_parameter: tokREFLECTANCE tokCOLON float3_or_texture
 	      { $$ = BxdfParamNode{Name: $1, Value: $3} }
 	      | tokRADIANCE tokCOLON float3_or_texture
 	      { $$ = BxdfParamNode{Name: $1, Value: $3} }
-	      | tokINT_IOR tokCOLON float_or_name
+	      | tokINT_IOR tokCOLON float_name_or_texture
 	      { $$ = BxdfParamNode{Name: $1, Value: $3} }
-	      | tokEXT_IOR tokCOLON float_or_name
+	      | tokEXT_IOR tokCOLON float_name_or_texture
 	      { $$ = BxdfParamNode{Name: $1, Value: $3} }
 	      | tokSCALE tokCOLON tokFLOAT
 	      { $$ = BxdfParamNode{Name: $1, Value: FloatNode($3)} }
@@ -125,8 +127,9 @@ float3_or_texture: float3
 float3: tokLCURLY tokFLOAT tokCOMMA tokFLOAT tokCOMMA tokFLOAT tokRCURLY 
       	{ $$ = Vec3Node{$2, $4, $6} }
 
-float_or_name: tokFLOAT { $$ = FloatNode($1) }
- 	     | tokMATERIAL_NAME { $$ = MaterialNameNode($1) }
+float_name_or_texture: tokFLOAT { $$ = FloatNode($1) }
+ 		     | tokMATERIAL_NAME { $$ = MaterialNameNode($1) }
+ 		     | tokTEXTURE { $$ = TextureNode($1) }
 
 float_or_texture: tokFLOAT { $$ = FloatNode($1) }
 		| tokTEXTURE { $$ = TextureNode($1) }
@@ -138,6 +141,14 @@ op_spec: tokMIX tokLPAREN bxdf_or_op_spec tokCOMMA bxdf_or_op_spec tokCOMMA tokF
 			Weight: $7,
 		}
 	  }
+	  | tokMIX tokLPAREN bxdf_or_op_spec tokCOMMA bxdf_or_op_spec tokCOMMA tokFLOAT tokCOMMA tokTEXTURE tokRPAREN
+	  { 
+	  	$$ = MixNode{ 
+	  		Expressions: [2]ExprNode{$3, $5},
+			Weight: $7,
+			Texture: TextureNode($9),
+		}
+	  }
 	  | tokMIX_MAP tokLPAREN bxdf_or_op_spec tokCOMMA bxdf_or_op_spec tokCOMMA tokTEXTURE tokRPAREN
 	  { 
 	  	$$ = MixMapNode{ 
@@ -167,6 +178,13 @@ op_spec: tokMIX tokLPAREN bxdf_or_op_spec tokCOMMA bxdf_or_op_spec tokCOMMA tokF
 			ExtIOR: $11.(Vec3Node),
 		}
 	  }
+	  | tokFRESNEL_BLEND tokLPAREN bxdf_or_op_spec tokCOMMA bxdf_or_op_spec tokCOMMA tokFLOAT tokRPAREN
+	  {
+	  	$$ = FresnelBlendNode{
+			Expressions: [2]ExprNode{$3, $5},
+			IOR: $7,
+		}
+	  }
 
 bxdf_or_op_spec: bxdf_spec
 	       | op_spec
@@ -198,7 +216,7 @@ func (x *matExprLexer) Lex(yylval *exprSymType) int {
 		switch c {
 		case tokEOF:
 			return tokEOF
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '.':
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '.', '-':
 			x.tokenBuf.Reset()
 			return x.lexFloat32(c, yylval)
 		case '"':
@@ -267,7 +285,7 @@ func (x *matExprLexer) lexLiteral(c rune, yylval *exprSymType) int {
 	}
 
 	yylval.sVal = x.tokenBuf.String()
-	if supportedImageRegex.MatchString(yylval.sVal) {
+	if supportedImageRegex.MatchString(yylval.sVal) || textureLayerRefRegex.MatchString(yylval.sVal) {
 		return tokTEXTURE
 	}
 
@@ -299,6 +317,10 @@ func (x *matExprLexer) lexIdentifier(c rune, yylval *exprSymType) int {
 	case "roughConductor": return tokROUGH_CONDUCTOR
 	case "dielectric": return tokDIELECTRIC
 	case "roughDielectric": return tokROUGH_DIELECTRIC
+	// Anisotropic bxdfs share the grammar rules of their isotropic counterparts
+	case "anisotropicConductor": return tokROUGH_CONDUCTOR
+	case "transparent": return tokDIFFUSE
+	case "subsurface": return tokDIFFUSE
 	case "emissive": return tokEMISSIVE
 	// Operators
 	case "mix": return tokMIX
@@ -306,15 +328,16 @@ func (x *matExprLexer) lexIdentifier(c rune, yylval *exprSymType) int {
 	case "bumpMap": return tokBUMP_MAP
 	case "normalMap": return tokNORMAL_MAP
 	case "disperse": return tokDISPERSE
+	case "fresnelBlend": return tokFRESNEL_BLEND
 	// Parameters
-	case ParamReflectance: return tokREFLECTANCE
+	case ParamReflectance, ParamIndirectReflectance: return tokREFLECTANCE
 	case ParamSpecularity: return tokSPECULARITY
-	case ParamTransmittance: return tokTRANSMITTANCE
+	case ParamTransmittance, ParamScatterColor, ParamScatterRadius: return tokTRANSMITTANCE
 	case ParamRadiance: return tokRADIANCE
 	case ParamIntIOR: return tokINT_IOR
 	case ParamExtIOR: return tokEXT_IOR
 	case ParamScale: return tokSCALE
-	case ParamRoughness: return tokROUGHNESS
+	case ParamRoughness, ParamRoughnessU, ParamRoughnessV, ParamAnisotropy: return tokROUGHNESS
 	default:
 		x.Error(fmt.Sprintf("invalid expression %q", yylval.sVal))
 		return tokEOF
@@ -349,7 +372,7 @@ func (x *matExprLexer) next() rune {
 func (x *matExprLexer) Error(s string) {
 	// tokKeep the first error we encountered
 	if x.lastError == nil {
-		x.lastError = fmt.Errorf(s)
+		x.lastError = errors.New(s)
 	}
 }
 
@@ -1,13 +1,16 @@
-//line material_expr.y:2
+// Code generated by goyacc -o material_expr.y.go -p expr material_expr.y. DO NOT EDIT.
 
+//line material_expr.y:2
 //go:generate go tool yacc -o material_expr.y.go -p expr material_expr.y
 package material
 
 import __yyfmt__ "fmt"
 
 //line material_expr.y:3
+
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"strconv"
 	"unicode/utf8"
@@ -50,6 +53,7 @@ const tokMIX_MAP = 57370
 const tokBUMP_MAP = 57371
 const tokNORMAL_MAP = 57372
 const tokDISPERSE = 57373
+const tokFRESNEL_BLEND = 57374
 
 var exprToknames = [...]string{
 	"$end",
@@ -83,14 +87,16 @@ var exprToknames = [...]string{
 	"tokBUMP_MAP",
 	"tokNORMAL_MAP",
 	"tokDISPERSE",
+	"tokFRESNEL_BLEND",
 }
+
 var exprStatenames = [...]string{}
 
 const exprEofCode = 1
 const exprErrCode = 2
 const exprInitialStackSize = 16
 
-//line material_expr.y:177
+//line material_expr.y:194
 
 // The parser expects the lexer to return 0 on kEOF.
 const tokEOF = 0
@@ -114,7 +120,7 @@ func (x *matExprLexer) Lex(yylval *exprSymType) int {
 		switch c {
 		case tokEOF:
 			return tokEOF
-		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '.':
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9', '.', '-':
 			x.tokenBuf.Reset()
 			return x.lexFloat32(c, yylval)
 		case '"':
@@ -183,7 +189,7 @@ func (x *matExprLexer) lexLiteral(c rune, yylval *exprSymType) int {
 	}
 
 	yylval.sVal = x.tokenBuf.String()
-	if supportedImageRegex.MatchString(yylval.sVal) {
+	if supportedImageRegex.MatchString(yylval.sVal) || textureLayerRefRegex.MatchString(yylval.sVal) {
 		return tokTEXTURE
 	}
 
@@ -220,6 +226,13 @@ func (x *matExprLexer) lexIdentifier(c rune, yylval *exprSymType) int {
 		return tokDIELECTRIC
 	case "roughDielectric":
 		return tokROUGH_DIELECTRIC
+	// Anisotropic bxdfs share the grammar rules of their isotropic counterparts
+	case "anisotropicConductor":
+		return tokROUGH_CONDUCTOR
+	case "transparent":
+		return tokDIFFUSE
+	case "subsurface":
+		return tokDIFFUSE
 	case "emissive":
 		return tokEMISSIVE
 	// Operators
@@ -233,12 +246,14 @@ func (x *matExprLexer) lexIdentifier(c rune, yylval *exprSymType) int {
 		return tokNORMAL_MAP
 	case "disperse":
 		return tokDISPERSE
+	case "fresnelBlend":
+		return tokFRESNEL_BLEND
 	// Parameters
-	case ParamReflectance:
+	case ParamReflectance, ParamIndirectReflectance:
 		return tokREFLECTANCE
 	case ParamSpecularity:
 		return tokSPECULARITY
-	case ParamTransmittance:
+	case ParamTransmittance, ParamScatterColor, ParamScatterRadius:
 		return tokTRANSMITTANCE
 	case ParamRadiance:
 		return tokRADIANCE
@@ -248,7 +263,7 @@ func (x *matExprLexer) lexIdentifier(c rune, yylval *exprSymType) int {
 		return tokEXT_IOR
 	case ParamScale:
 		return tokSCALE
-	case ParamRoughness:
+	case ParamRoughness, ParamRoughnessU, ParamRoughnessV, ParamAnisotropy:
 		return tokROUGHNESS
 	default:
 		x.Error(fmt.Sprintf("invalid expression %q", yylval.sVal))
@@ -284,7 +299,7 @@ func (x *matExprLexer) next() rune {
 func (x *matExprLexer) Error(s string) {
 	// tokKeep the first error we encountered
 	if x.lastError == nil {
-		x.lastError = fmt.Errorf(s)
+		x.lastError = errors.New(s)
 	}
 }
 
@@ -300,103 +315,105 @@ func ParseExpression(input string) (ExprNode, error) {
 }
 
 //line yacctab:1
-var exprExca = [...]int{
+var exprExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
 }
 
-const exprNprod = 37
 const exprPrivate = 57344
 
-var exprTokenNames []string
-var exprStates []string
-
-const exprLast = 109
-
-var exprAct = [...]int{
-
-	58, 33, 64, 57, 24, 25, 26, 27, 28, 29,
-	30, 31, 32, 92, 36, 76, 70, 85, 71, 75,
-	37, 38, 39, 40, 10, 11, 12, 13, 14, 15,
-	5, 6, 7, 8, 9, 10, 11, 12, 13, 14,
-	15, 5, 6, 7, 8, 9, 60, 56, 61, 62,
-	63, 67, 59, 72, 73, 74, 65, 66, 93, 87,
-	84, 77, 68, 94, 82, 50, 49, 48, 47, 46,
-	45, 44, 43, 91, 90, 83, 79, 78, 55, 54,
-	53, 52, 51, 86, 42, 95, 60, 97, 89, 88,
-	81, 80, 41, 21, 20, 96, 19, 18, 17, 16,
-	34, 2, 35, 3, 4, 23, 22, 69, 1,
-}
-var exprPact = [...]int{
-
-	14, -1000, -1000, -1000, 95, 94, 93, 92, 90, 89,
-	-1000, -1000, -1000, -1000, -1000, -1000, -8, 3, 3, 3,
-	3, 3, 87, 76, -1000, 63, 62, 61, 60, 59,
-	58, 57, 56, 74, -1000, -1000, -1000, 73, 72, 71,
-	70, -1000, -8, 40, 40, 40, 40, 46, 46, 52,
-	6, 3, 3, 43, 7, -2, -1000, -1000, -1000, -1000,
-	51, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000, 69, 68, 86, 85, 55, 67, 50, 5,
-	-1000, -1000, 80, 49, 84, 83, 66, 65, -1000, -1000,
-	-5, 48, 54, 78, 80, -1000, 82, -1000,
-}
-var exprPgo = [...]int{
-
-	0, 108, 0, 4, 3, 2, 107, 102, 106, 105,
-	100, 1, 104,
-}
-var exprR1 = [...]int{
-
+const exprLast = 122
+
+var exprAct = [...]int8{
+	62, 35, 68, 61, 26, 27, 28, 29, 30, 31,
+	32, 33, 34, 103, 81, 102, 38, 69, 70, 71,
+	92, 39, 40, 41, 42, 43, 11, 12, 13, 14,
+	15, 16, 5, 6, 7, 8, 9, 10, 11, 12,
+	13, 14, 15, 16, 5, 6, 7, 8, 9, 10,
+	60, 65, 66, 67, 72, 80, 77, 78, 75, 64,
+	76, 82, 79, 101, 104, 63, 95, 94, 91, 83,
+	73, 106, 96, 88, 53, 97, 4, 52, 51, 50,
+	49, 48, 47, 46, 99, 90, 89, 85, 84, 93,
+	59, 58, 57, 56, 55, 54, 45, 107, 64, 109,
+	105, 100, 98, 87, 86, 44, 23, 108, 22, 21,
+	20, 19, 18, 17, 36, 2, 37, 3, 25, 24,
+	74, 1,
+}
+
+var exprPact = [...]int16{
+	17, -32768, -32768, -32768, 109, 108, 107, 106, 105, 104,
+	102, -32768, -32768, -32768, -32768, -32768, -32768, -8, 5, 5,
+	5, 5, 5, 5, 100, 88, -32768, 74, 73, 72,
+	71, 70, 69, 68, 65, 87, -32768, -32768, -32768, 86,
+	85, 84, 83, 82, -32768, -8, 53, 53, 53, 53,
+	7, 7, 60, 48, 5, 5, 50, 43, -3, 5,
+	-32768, -32768, -32768, -32768, 59, -32768, -32768, -32768, -32768, -32768,
+	-32768, -32768, -32768, -32768, -32768, -32768, -32768, 80, 79, 99,
+	98, 64, 78, 77, 58, 8, -32768, -32768, 92, 57,
+	56, 67, 97, 76, 96, 55, -32768, 3, -32768, -5,
+	-32768, 54, 95, 62, 90, -32768, 92, -32768, 94, -32768,
+}
+
+var exprPgo = [...]int8{
+	0, 121, 0, 4, 3, 2, 120, 116, 119, 118,
+	114, 1, 76,
+}
+
+var exprR1 = [...]int8{
 	0, 1, 1, 10, 12, 12, 12, 12, 12, 12,
 	8, 8, 9, 9, 3, 3, 3, 3, 3, 3,
-	3, 3, 4, 4, 2, 5, 5, 6, 6, 7,
-	7, 7, 7, 7, 11, 11, 11,
+	3, 3, 4, 4, 2, 5, 5, 5, 6, 6,
+	7, 7, 7, 7, 7, 7, 7, 11, 11, 11,
 }
-var exprR2 = [...]int{
 
+var exprR2 = [...]int8{
 	0, 1, 1, 4, 1, 1, 1, 1, 1, 1,
 	0, 1, 1, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 1, 1, 7, 1, 1, 1, 1, 8,
-	8, 6, 6, 12, 1, 1, 1,
+	3, 3, 1, 1, 7, 1, 1, 1, 1, 1,
+	8, 10, 8, 6, 6, 12, 8, 1, 1, 1,
 }
-var exprChk = [...]int{
 
-	-1000, -1, -10, -7, -12, 27, 28, 29, 30, 31,
-	21, 22, 23, 24, 25, 26, 4, 4, 4, 4,
-	4, 4, -8, -9, -3, 13, 14, 15, 16, 17,
-	18, 19, 20, -11, -10, -7, 11, -11, -11, -11,
-	-11, 5, 8, 9, 9, 9, 9, 9, 9, 9,
-	9, 8, 8, 8, 8, 8, -3, -4, -2, 12,
-	6, -4, -4, -4, -5, 10, 11, -5, 10, -6,
-	10, 12, -11, -11, 12, 12, 17, 10, 8, 8,
-	5, 5, 9, 8, 10, 12, -2, 10, 5, 5,
-	8, 8, 18, 10, 9, 7, -2, 5,
+var exprChk = [...]int16{
+	-32768, -1, -10, -7, -12, 27, 28, 29, 30, 31,
+	32, 21, 22, 23, 24, 25, 26, 4, 4, 4,
+	4, 4, 4, 4, -8, -9, -3, 13, 14, 15,
+	16, 17, 18, 19, 20, -11, -10, -7, 11, -11,
+	-11, -11, -11, -11, 5, 8, 9, 9, 9, 9,
+	9, 9, 9, 9, 8, 8, 8, 8, 8, 8,
+	-3, -4, -2, 12, 6, -4, -4, -4, -5, 10,
+	11, 12, -5, 10, -6, 10, 12, -11, -11, 12,
+	12, 17, -11, 10, 8, 8, 5, 5, 9, 8,
+	8, 10, 12, -2, 10, 10, 5, 8, 5, 8,
+	5, 8, 12, 18, 10, 5, 9, 7, -2, 5,
 }
-var exprDef = [...]int{
 
+var exprDef = [...]int8{
 	0, -2, 1, 2, 0, 0, 0, 0, 0, 0,
-	4, 5, 6, 7, 8, 9, 10, 0, 0, 0,
-	0, 0, 0, 11, 12, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 34, 35, 36, 0, 0, 0,
-	0, 3, 0, 0, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 13, 14, 22, 23,
-	0, 15, 16, 17, 18, 25, 26, 19, 20, 21,
-	27, 28, 0, 0, 0, 0, 0, 0, 0, 0,
-	31, 32, 0, 0, 0, 0, 0, 0, 29, 30,
-	0, 0, 0, 0, 0, 24, 0, 33,
-}
-var exprTok1 = [...]int{
-
+	0, 4, 5, 6, 7, 8, 9, 10, 0, 0,
+	0, 0, 0, 0, 0, 11, 12, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 37, 38, 39, 0,
+	0, 0, 0, 0, 3, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	13, 14, 22, 23, 0, 15, 16, 17, 18, 25,
+	26, 27, 19, 20, 21, 28, 29, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 33, 34, 0, 0,
+	0, 0, 0, 0, 0, 0, 30, 0, 32, 0,
+	36, 0, 0, 0, 0, 31, 0, 24, 0, 35,
+}
+
+var exprTok1 = [...]int8{
 	1,
 }
-var exprTok2 = [...]int{
 
+var exprTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	32,
 }
-var exprTok3 = [...]int{
+
+var exprTok3 = [...]int8{
 	0,
 }
 
@@ -439,7 +456,7 @@ func exprNewParser() exprParser {
 	return &exprParserImpl{}
 }
 
-const exprFlag = -1000
+const exprFlag = -32768
 
 func exprTokname(c int) string {
 	if c >= 1 && c-1 < len(exprToknames) {
@@ -478,9 +495,9 @@ func exprErrorMessage(state, lookAhead int) string {
 	expected := make([]int, 0, 4)
 
 	// Look for shiftable tokens.
-	base := exprPact[state]
+	base := int(exprPact[state])
 	for tok := TOKSTART; tok-1 < len(exprToknames); tok++ {
-		if n := base + tok; n >= 0 && n < exprLast && exprChk[exprAct[n]] == tok {
+		if n := base + tok; n >= 0 && n < exprLast && int(exprChk[int(exprAct[n])]) == tok {
 			if len(expected) == cap(expected) {
 				return res
 			}
@@ -490,13 +507,13 @@ func exprErrorMessage(state, lookAhead int) string {
 
 	if exprDef[state] == -2 {
 		i := 0
-		for exprExca[i] != -1 || exprExca[i+1] != state {
+		for exprExca[i] != -1 || int(exprExca[i+1]) != state {
 			i += 2
 		}
 
 		// Look for tokens that we accept or reduce.
 		for i += 2; exprExca[i] >= 0; i += 2 {
-			tok := exprExca[i]
+			tok := int(exprExca[i])
 			if tok < TOKSTART || exprExca[i+1] == 0 {
 				continue
 			}
@@ -527,30 +544,30 @@ func exprlex1(lex exprLexer, lval *exprSymType) (char, token int) {
 	token = 0
 	char = lex.Lex(lval)
 	if char <= 0 {
-		token = exprTok1[0]
+		token = int(exprTok1[0])
 		goto out
 	}
 	if char < len(exprTok1) {
-		token = exprTok1[char]
+		token = int(exprTok1[char])
 		goto out
 	}
 	if char >= exprPrivate {
 		if char < exprPrivate+len(exprTok2) {
-			token = exprTok2[char-exprPrivate]
+			token = int(exprTok2[char-exprPrivate])
 			goto out
 		}
 	}
 	for i := 0; i < len(exprTok3); i += 2 {
-		token = exprTok3[i+0]
+		token = int(exprTok3[i+0])
 		if token == char {
-			token = exprTok3[i+1]
+			token = int(exprTok3[i+1])
 			goto out
 		}
 	}
 
 out:
 	if token == 0 {
-		token = exprTok2[1] /* unknown char */
+		token = int(exprTok2[1]) /* unknown char */
 	}
 	if exprDebug >= 3 {
 		__yyfmt__.Printf("lex %s(%d)\n", exprTokname(token), uint(char))
@@ -605,7 +622,7 @@ exprstack:
 	exprS[exprp].yys = exprstate
 
 exprnewstate:
-	exprn = exprPact[exprstate]
+	exprn = int(exprPact[exprstate])
 	if exprn <= exprFlag {
 		goto exprdefault /* simple state */
 	}
@@ -616,8 +633,8 @@ exprnewstate:
 	if exprn < 0 || exprn >= exprLast {
 		goto exprdefault
 	}
-	exprn = exprAct[exprn]
-	if exprChk[exprn] == exprtoken { /* valid shift */
+	exprn = int(exprAct[exprn])
+	if int(exprChk[exprn]) == exprtoken { /* valid shift */
 		exprrcvr.char = -1
 		exprtoken = -1
 		exprVAL = exprrcvr.lval
@@ -630,7 +647,7 @@ exprnewstate:
 
 exprdefault:
 	/* default state action */
-	exprn = exprDef[exprstate]
+	exprn = int(exprDef[exprstate])
 	if exprn == -2 {
 		if exprrcvr.char < 0 {
 			exprrcvr.char, exprtoken = exprlex1(exprlex, &exprrcvr.lval)
@@ -639,18 +656,18 @@ exprdefault:
 		/* look through exception table */
 		xi := 0
 		for {
-			if exprExca[xi+0] == -1 && exprExca[xi+1] == exprstate {
+			if exprExca[xi+0] == -1 && int(exprExca[xi+1]) == exprstate {
 				break
 			}
 			xi += 2
 		}
 		for xi += 2; ; xi += 2 {
-			exprn = exprExca[xi+0]
+			exprn = int(exprExca[xi+0])
 			if exprn < 0 || exprn == exprtoken {
 				break
 			}
 		}
-		exprn = exprExca[xi+1]
+		exprn = int(exprExca[xi+1])
 		if exprn < 0 {
 			goto ret0
 		}
@@ -672,10 +689,10 @@ exprdefault:
 
 			/* find a state where "error" is a legal shift action */
 			for exprp >= 0 {
-				exprn = exprPact[exprS[exprp].yys] + exprErrCode
+				exprn = int(exprPact[exprS[exprp].yys]) + exprErrCode
 				if exprn >= 0 && exprn < exprLast {
-					exprstate = exprAct[exprn] /* simulate a shift of "error" */
-					if exprChk[exprstate] == exprErrCode {
+					exprstate = int(exprAct[exprn]) /* simulate a shift of "error" */
+					if int(exprChk[exprstate]) == exprErrCode {
 						goto exprstack
 					}
 				}
@@ -711,7 +728,7 @@ exprdefault:
 	exprpt := exprp
 	_ = exprpt // guard against "declared and not used"
 
-	exprp -= exprR2[exprn]
+	exprp -= int(exprR2[exprn])
 	// exprp is now the index of $0. Perform the default action. Iff the
 	// reduced production is ε, $1 is possibly out of range.
 	if exprp+1 >= len(exprS) {
@@ -722,16 +739,16 @@ exprdefault:
 	exprVAL = exprS[exprp+1]
 
 	/* consult goto table to find next state */
-	exprn = exprR1[exprn]
-	exprg := exprPgo[exprn]
+	exprn = int(exprR1[exprn])
+	exprg := int(exprPgo[exprn])
 	exprj := exprg + exprS[exprp].yys + 1
 
 	if exprj >= exprLast {
-		exprstate = exprAct[exprg]
+		exprstate = int(exprAct[exprg])
 	} else {
-		exprstate = exprAct[exprj]
-		if exprChk[exprstate] != -exprn {
-			exprstate = exprAct[exprg]
+		exprstate = int(exprAct[exprj])
+		if int(exprChk[exprstate]) != -exprn {
+			exprstate = int(exprAct[exprg])
 		}
 	}
 	// dummy call; replaced with literal code
@@ -739,19 +756,19 @@ exprdefault:
 
 	case 1:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:77
+//line material_expr.y:78
 		{
 			exprlex.(*matExprLexer).parsedExpression = exprDollar[1].node
 		}
 	case 2:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:79
+//line material_expr.y:80
 		{
 			exprlex.(*matExprLexer).parsedExpression = exprDollar[1].node
 		}
 	case 3:
 		exprDollar = exprS[exprpt-4 : exprpt+1]
-		//line material_expr.y:82
+//line material_expr.y:83
 		{
 			exprVAL.node = BxdfNode{
 				Type:       bxdfTypeFromName(exprDollar[1].sVal),
@@ -760,145 +777,161 @@ exprdefault:
 		}
 	case 10:
 		exprDollar = exprS[exprpt-0 : exprpt+1]
-		//line material_expr.y:97
+//line material_expr.y:98
 		{
 			exprVAL.node = make(BxdfParameterList, 0)
 		}
 	case 12:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:101
+//line material_expr.y:102
 		{
 			exprVAL.node = BxdfParameterList{exprDollar[1].node.(BxdfParamNode)}
 		}
 	case 13:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:103
+//line material_expr.y:104
 		{
 			exprVAL.node = append(exprDollar[1].node.(BxdfParameterList), exprDollar[3].node.(BxdfParamNode))
 		}
 	case 14:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:106
+//line material_expr.y:107
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 15:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:108
+//line material_expr.y:109
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 16:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:110
+//line material_expr.y:111
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 17:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:112
+//line material_expr.y:113
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 18:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:114
+//line material_expr.y:115
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 19:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:116
+//line material_expr.y:117
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 20:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:118
+//line material_expr.y:119
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: FloatNode(exprDollar[3].fVal)}
 		}
 	case 21:
 		exprDollar = exprS[exprpt-3 : exprpt+1]
-		//line material_expr.y:120
+//line material_expr.y:121
 		{
 			exprVAL.node = BxdfParamNode{Name: exprDollar[1].sVal, Value: exprDollar[3].node}
 		}
 	case 23:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:123
+//line material_expr.y:124
 		{
 			exprVAL.node = TextureNode(exprDollar[1].sVal)
 		}
 	case 24:
 		exprDollar = exprS[exprpt-7 : exprpt+1]
-		//line material_expr.y:126
+//line material_expr.y:127
 		{
 			exprVAL.node = Vec3Node{exprDollar[2].fVal, exprDollar[4].fVal, exprDollar[6].fVal}
 		}
 	case 25:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:128
+//line material_expr.y:129
 		{
 			exprVAL.node = FloatNode(exprDollar[1].fVal)
 		}
 	case 26:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:129
+//line material_expr.y:130
 		{
 			exprVAL.node = MaterialNameNode(exprDollar[1].sVal)
 		}
 	case 27:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:131
+//line material_expr.y:131
 		{
-			exprVAL.node = FloatNode(exprDollar[1].fVal)
+			exprVAL.node = TextureNode(exprDollar[1].sVal)
 		}
 	case 28:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:132
+//line material_expr.y:133
 		{
-			exprVAL.node = TextureNode(exprDollar[1].sVal)
+			exprVAL.node = FloatNode(exprDollar[1].fVal)
 		}
 	case 29:
+		exprDollar = exprS[exprpt-1 : exprpt+1]
+//line material_expr.y:134
+		{
+			exprVAL.node = TextureNode(exprDollar[1].sVal)
+		}
+	case 30:
 		exprDollar = exprS[exprpt-8 : exprpt+1]
-		//line material_expr.y:135
+//line material_expr.y:137
 		{
 			exprVAL.node = MixNode{
 				Expressions: [2]ExprNode{exprDollar[3].node, exprDollar[5].node},
 				Weight:      exprDollar[7].fVal,
 			}
 		}
-	case 30:
+	case 31:
+		exprDollar = exprS[exprpt-10 : exprpt+1]
+//line material_expr.y:144
+		{
+			exprVAL.node = MixNode{
+				Expressions: [2]ExprNode{exprDollar[3].node, exprDollar[5].node},
+				Weight:      exprDollar[7].fVal,
+				Texture:     TextureNode(exprDollar[9].sVal),
+			}
+		}
+	case 32:
 		exprDollar = exprS[exprpt-8 : exprpt+1]
-		//line material_expr.y:142
+//line material_expr.y:152
 		{
 			exprVAL.node = MixMapNode{
 				Expressions: [2]ExprNode{exprDollar[3].node, exprDollar[5].node},
 				Texture:     TextureNode(exprDollar[7].sVal),
 			}
 		}
-	case 31:
+	case 33:
 		exprDollar = exprS[exprpt-6 : exprpt+1]
-		//line material_expr.y:149
+//line material_expr.y:159
 		{
 			exprVAL.node = BumpMapNode{
 				Expression: exprDollar[3].node,
 				Texture:    TextureNode(exprDollar[5].sVal),
 			}
 		}
-	case 32:
+	case 34:
 		exprDollar = exprS[exprpt-6 : exprpt+1]
-		//line material_expr.y:156
+//line material_expr.y:166
 		{
 			exprVAL.node = NormalMapNode{
 				Expression: exprDollar[3].node,
 				Texture:    TextureNode(exprDollar[5].sVal),
 			}
 		}
-	case 33:
+	case 35:
 		exprDollar = exprS[exprpt-12 : exprpt+1]
-		//line material_expr.y:163
+//line material_expr.y:173
 		{
 			exprVAL.node = DisperseNode{
 				Expression: exprDollar[3].node,
@@ -907,8 +940,17 @@ exprdefault:
 			}
 		}
 	case 36:
+		exprDollar = exprS[exprpt-8 : exprpt+1]
+//line material_expr.y:181
+		{
+			exprVAL.node = FresnelBlendNode{
+				Expressions: [2]ExprNode{exprDollar[3].node, exprDollar[5].node},
+				IOR:         exprDollar[7].fVal,
+			}
+		}
+	case 39:
 		exprDollar = exprS[exprpt-1 : exprpt+1]
-		//line material_expr.y:174
+//line material_expr.y:191
 		{
 			exprVAL.node = MaterialRefNode(exprDollar[1].sVal)
 		}
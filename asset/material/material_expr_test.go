@@ -7,15 +7,29 @@ func TestParser(t *testing.T) {
 		`diffuse()`,
 		`diffuse(reflectance: {0.9, 0.9, 0.9})`,
 		`diffuse(reflectance: "texture.jpg")`,
+		`diffuse(reflectance: "texture.jpg", indirectReflectance: {0.5, 0.5, 0.5})`,
 		`dielectric(specularity: "texture.jpg", intIOR: "gold", extIOR: "air")`,
 		`dielectric(specularity: "texture.jpEg", transmittance: {.9,.9,.9}, intIOR: 1.33, extIOR: "air")`,
 		`roughDielectric(specularity: "texture.jpEg", transmittance: {1,1,1}, intIOR: 1.33, extIOR: "air", roughness: 0.2)`,
+		`dielectric(intIOR: "varnish.png", extIOR: "air")`,
 		`conductor(specularity: "texture.jpg")`,
+		`roughConductor(intIOR: "weathering.exr", extIOR: 1.0, roughness: 0.3)`,
 		`roughConductor(specularity: {.3,.3,.3}, intIOR: "gold", roughness: 1)`,
+		`anisotropicConductor(specularity: {.3,.3,.3}, intIOR: "gold", roughnessU: 0.1, roughnessV: 0.8)`,
+		`anisotropicConductor(roughness: "texture.jpg", roughnessV: 0.5)`,
 		`emissive(radiance: {1,1,1}, scale: 10)`,
+		`transparent()`,
+		`transparent(transmittance: "texture.jpg")`,
+		`mix(diffuse(), transparent(transmittance: {1,1,1}), 0.5)`,
+		`mix(diffuse(), transparent(), 0.8, "leaf-mask.png")`,
+		`mix(diffuse(reflectance: "terrain[0]"), diffuse(reflectance: "terrain[1]"), 0.5, "terrain.png[2]")`,
+		`subsurface()`,
+		`subsurface(scatterColor: {0.9, 0.6, 0.5}, scatterRadius: {0.4, 0.15, 0.08}, anisotropy: -0.3)`,
+		`subsurface(scatterColor: "skin.jpg", anisotropy: 0.8)`,
 		`bumpMap(conductor(specularity: "texture.jpg"), "foo.jpg")`,
 		`normalMap(conductor(specularity: "texture.jpg"), "foo.jpg")`,
-		`mix(diffuse(reflectance:{0.2, 0.2, 0.2}), conductor(specularity: "texture.jpg"), 0.2, 0.8)`,
+		`fresnelBlend(dielectric(intIOR: 1.5), diffuse(), 1.5)`,
+		`mix(diffuse(reflectance:{0.2, 0.2, 0.2}), conductor(specularity: "texture.jpg"), 0.2)`,
 	}
 
 	for index, expr := range validExpr {
@@ -37,11 +51,23 @@ func TestSemanticParseErrors(t *testing.T) {
 	invalidExpr := []string{
 		`diffuse(specularity: {0.9, 0.9, 0.9})`,
 		`diffuse(reflectance: {1.0, 0.9, 0.9})`,
+		`diffuse(indirectReflectance: {1.0, 0.9, 0.9})`,
+		`conductor(indirectReflectance: {0.5, 0.5, 0.5})`,
 		`conductor(roughness: "texture.jpg")`,
 		`roughConductor(specularity: {.3,.3,.3}, intIOR: "gold!!!", roughness: 1)`,
 		`roughConductor(specularity: {.3,.3,.3}, intIOR: 1.2, extIOR: "foo", roughness: 1)`,
 		`dielectric(transmittance: {1.3,.3,.3})`,
-		`mix(diffuse(), conductor(), 0.2, 1.0)`,
+		`roughConductor(roughnessU: 0.2)`,
+		`anisotropicConductor(roughnessU: 1.2)`,
+		`anisotropicConductor(roughnessV: "texture.jpg")`,
+		`transparent(reflectance: {.5,.5,.5})`,
+		`subsurface(scatterColor: {1.0, 0.5, 0.5})`,
+		`subsurface(scatterRadius: "texture.jpg")`,
+		`subsurface(scatterRadius: {0.1, -0.1, 0.1})`,
+		`subsurface(anisotropy: 1)`,
+		`subsurface(reflectance: {.5,.5,.5})`,
+		`mix(diffuse(), conductor(), 1.2)`,
+		`fresnelBlend(conductor(), diffuse(), 0)`,
 	}
 
 	for index, expr := range invalidExpr {
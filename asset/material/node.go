@@ -8,14 +8,20 @@ import (
 )
 
 const (
-	ParamReflectance   = "reflectance"
-	ParamSpecularity   = "specularity"
-	ParamTransmittance = "transmittance"
-	ParamRadiance      = "radiance"
-	ParamIntIOR        = "intIOR"
-	ParamExtIOR        = "extIOR"
-	ParamScale         = "scale"
-	ParamRoughness     = "roughness"
+	ParamReflectance         = "reflectance"
+	ParamIndirectReflectance = "indirectReflectance"
+	ParamSpecularity         = "specularity"
+	ParamTransmittance       = "transmittance"
+	ParamRadiance            = "radiance"
+	ParamIntIOR              = "intIOR"
+	ParamExtIOR              = "extIOR"
+	ParamScale               = "scale"
+	ParamRoughness           = "roughness"
+	ParamRoughnessU          = "roughnessU"
+	ParamRoughnessV          = "roughnessV"
+	ParamScatterColor        = "scatterColor"
+	ParamScatterRadius       = "scatterRadius"
+	ParamAnisotropy          = "anisotropy"
 )
 
 var (
@@ -25,7 +31,8 @@ var (
 			ParamScale:    struct{}{},
 		},
 		BxdfDiffuse: {
-			ParamReflectance: struct{}{},
+			ParamReflectance:         struct{}{},
+			ParamIndirectReflectance: struct{}{},
 		},
 		BxdfConductor: {
 			ParamSpecularity: struct{}{},
@@ -51,6 +58,22 @@ var (
 			ParamExtIOR:        struct{}{},
 			ParamRoughness:     struct{}{},
 		},
+		BxdfAnisotropicConductor: {
+			ParamSpecularity: struct{}{},
+			ParamIntIOR:      struct{}{},
+			ParamExtIOR:      struct{}{},
+			ParamRoughness:   struct{}{},
+			ParamRoughnessU:  struct{}{},
+			ParamRoughnessV:  struct{}{},
+		},
+		BxdfTransparent: {
+			ParamTransmittance: struct{}{},
+		},
+		BxdfSubsurface: {
+			ParamScatterColor:  struct{}{},
+			ParamScatterRadius: struct{}{},
+			ParamAnisotropy:    struct{}{},
+		},
 	}
 )
 
@@ -78,6 +101,9 @@ type BxdfParameterList []BxdfParamNode
 type MixNode struct {
 	Expressions [2]ExprNode
 	Weight      float32
+
+	// An optional texture that modulates the mix weight.
+	Texture TextureNode
 }
 
 type BumpMapNode struct {
@@ -101,6 +127,11 @@ type DisperseNode struct {
 	ExtIOR     Vec3Node
 }
 
+type FresnelBlendNode struct {
+	Expressions [2]ExprNode
+	IOR         float32
+}
+
 type BxdfNode struct {
 	Type       BxdfType
 	Parameters BxdfParameterList
@@ -138,7 +169,7 @@ func (n TextureNode) Validate() error {
 func (n BxdfParamNode) Validate() error {
 	// Ensure energy conservation
 	switch n.Name {
-	case ParamReflectance:
+	case ParamReflectance, ParamIndirectReflectance, ParamScatterColor:
 		if v, isVec := n.Value.(Vec3Node); isVec && (v[0] >= 1.0 || v[1] >= 1.0 || v[2] >= 1.0) {
 			return fmt.Errorf("energy conservation violation for Parameter %q; ensure that all vector components are < 1.0", n.Name)
 		}
@@ -150,6 +181,30 @@ func (n BxdfParamNode) Validate() error {
 		if v, isFloat := n.Value.(FloatNode); isFloat && v > 1.0 {
 			return fmt.Errorf("values for Parameter %q must be in the [0, 1] range", n.Name)
 		}
+	case ParamRoughnessU, ParamRoughnessV:
+		v, isFloat := n.Value.(FloatNode)
+		if !isFloat {
+			return fmt.Errorf("Parameter %q only supports float values", n.Name)
+		}
+		if v < 0.0 || v > 1.0 {
+			return fmt.Errorf("values for Parameter %q must be in the [0, 1] range", n.Name)
+		}
+	case ParamScatterRadius:
+		v, isVec := n.Value.(Vec3Node)
+		if !isVec {
+			return fmt.Errorf("Parameter %q only supports vector values", n.Name)
+		}
+		if v[0] < 0.0 || v[1] < 0.0 || v[2] < 0.0 {
+			return fmt.Errorf("values for Parameter %q must be >= 0", n.Name)
+		}
+	case ParamAnisotropy:
+		v, isFloat := n.Value.(FloatNode)
+		if !isFloat {
+			return fmt.Errorf("Parameter %q only supports float values", n.Name)
+		}
+		if v <= -1.0 || v >= 1.0 {
+			return fmt.Errorf("values for Parameter %q must be in the (-1, 1) range", n.Name)
+		}
 	case ParamIntIOR, ParamExtIOR:
 		if v, isMat := n.Value.(MaterialNameNode); isMat {
 			_, err := IOR(v)
@@ -233,6 +288,32 @@ func (n MixNode) Validate() error {
 		return fmt.Errorf("Mix: mix weight must be in the [0, 1] range")
 	}
 
+	if n.Texture != "" {
+		err = n.Texture.Validate()
+		if err != nil {
+			return fmt.Errorf("Mix: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (n FresnelBlendNode) Validate() error {
+	var err error
+	for argIndex, arg := range n.Expressions {
+		if arg == nil {
+			return fmt.Errorf("missing expression argument %d for %q", argIndex, "fresnelBlend")
+		}
+		err = arg.Validate()
+		if err != nil {
+			return fmt.Errorf("fresnelBlend argument %d: %v", argIndex, err)
+		}
+	}
+
+	if n.IOR <= 0.0 {
+		return fmt.Errorf("FresnelBlend: IOR must be a positive value")
+	}
+
 	return nil
 }
 
@@ -12,6 +12,7 @@ const (
 	OpBumpMap
 	OpNormalMap
 	OpDisperse
+	OpFresnelBlend
 	//
 	lastOpEntry
 )
@@ -20,3 +21,22 @@ const (
 func IsOpType(t uint32) bool {
 	return t > uint32(opInvalid) && t < uint32(lastOpEntry)
 }
+
+func (t OpType) String() string {
+	switch t {
+	case OpMix:
+		return "mix"
+	case OpMixMap:
+		return "mixMap"
+	case OpBumpMap:
+		return "bumpMap"
+	case OpNormalMap:
+		return "normalMap"
+	case OpDisperse:
+		return "disperse"
+	case OpFresnelBlend:
+		return "fresnelBlend"
+	}
+
+	return "invalid"
+}
@@ -0,0 +1,15 @@
+package material
+
+import "testing"
+
+func TestIsOpType(t *testing.T) {
+	if !IsOpType(uint32(OpFresnelBlend)) {
+		t.Fatalf("expected %q to be an op type", OpFresnelBlend)
+	}
+	if IsOpType(uint32(lastOpEntry)) {
+		t.Fatal("expected lastOpEntry not to be an op type")
+	}
+	if IsOpType(uint32(opInvalid)) {
+		t.Fatal("expected opInvalid not to be an op type")
+	}
+}
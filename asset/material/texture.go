@@ -5,4 +5,7 @@ import "regexp"
 var (
 	// supported image extensions regex
 	supportedImageRegex = regexp.MustCompile(`(?i)\.(?:jpg|jpeg|gif|png|tga|tiff|bmp|pnm|hdr|exr|webp)$`)
+
+	// texture array layer reference regex (e.g. "terrain[1]")
+	textureLayerRefRegex = regexp.MustCompile(`^[^\[]+\[\d+\]$`)
 )
@@ -0,0 +1,62 @@
+package scene
+
+import "github.com/achilleasa/polaris/types"
+
+// The relative costs of traversing a BVH node and intersecting a primitive
+// used when estimating the SAH cost of the scene BVH trees. These match the
+// default costs used by the BVH builder.
+const (
+	bvhTraversalCost    = 1.0
+	bvhIntersectionCost = 1.0
+)
+
+// Estimate the quality of the mesh BVH trees as the ratio of their surface
+// area heuristic (SAH) cost to the cost of storing all mesh primitives in a
+// single leaf. The cost of each tree is normalized by the surface area of its
+// root and the costs of all trees are combined so that each mesh contributes
+// in proportion to its primitive count. Lower values indicate better trees;
+// a value of 1 indicates that the trees perform no better than a linear scan
+// of the mesh primitives. This method returns 0 if the scene contains no
+// primitives.
+func (sc *Scene) BvhQuality() float64 {
+	var totalCost, baselineCost float64
+	for _, mr := range sc.MeshRanges {
+		if mr.PrimitiveCount == 0 {
+			continue
+		}
+
+		root := sc.BvhNodeList[mr.BvhRoot]
+		rootArea := bboxSurfaceArea(root.Min, root.Max)
+		if rootArea == 0 {
+			// Degenerate bounds; assume the tree is no better than a single leaf
+			totalCost += bvhIntersectionCost * float64(mr.PrimitiveCount)
+		} else {
+			totalCost += sc.bvhCost(mr.BvhRoot) / rootArea
+		}
+		baselineCost += bvhIntersectionCost * float64(mr.PrimitiveCount)
+	}
+
+	if baselineCost == 0 {
+		return 0
+	}
+	return totalCost / baselineCost
+}
+
+// Recursively calculate the SAH cost of a mesh BVH subtree, scaled by the
+// surface area of the subtree root.
+func (sc *Scene) bvhCost(nodeIndex uint32) float64 {
+	node := sc.BvhNodeList[nodeIndex]
+	area := bboxSurfaceArea(node.Min, node.Max)
+	if node.LData <= 0 {
+		_, count := node.GetPrimitives()
+		return bvhIntersectionCost * float64(count) * area
+	}
+
+	return bvhTraversalCost*area + sc.bvhCost(uint32(node.LData)) + sc.bvhCost(uint32(node.RData))
+}
+
+// Calculate the surface area of a bounding box.
+func bboxSurfaceArea(min, max types.Vec3) float64 {
+	side := max.Sub(min)
+	return 2.0 * (float64(side[0])*float64(side[1]) + float64(side[0])*float64(side[2]) + float64(side[1])*float64(side[2]))
+}
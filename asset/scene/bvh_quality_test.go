@@ -0,0 +1,44 @@
+package scene
+
+import (
+	"math"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestBvhQuality(t *testing.T) {
+	// A mesh with 4 primitives split into two leafs with 2 primitives each.
+	// The root has a surface area of 10 and each leaf a surface area of 6 so
+	// the normalized SAH cost is 1 + 2*6/10 + 2*6/10 = 3.4. Storing all
+	// primitives in a single leaf has a cost of 4.
+	sc := &Scene{
+		BvhNodeList: []BvhNode{
+			{Min: types.Vec3{0, 0, 0}, LData: 1, Max: types.Vec3{2, 1, 1}, RData: 2},
+			{Min: types.Vec3{0, 0, 0}, LData: 0, Max: types.Vec3{1, 1, 1}, RData: 2},
+			{Min: types.Vec3{1, 0, 0}, LData: -2, Max: types.Vec3{2, 1, 1}, RData: 2},
+		},
+		MeshRanges: []MeshRange{
+			{BvhRoot: 0, BvhNodeCount: 3, FirstPrimitive: 0, PrimitiveCount: 4},
+		},
+	}
+
+	expQuality := 3.4 / 4.0
+	if quality := sc.BvhQuality(); math.Abs(quality-expQuality) > 1e-6 {
+		t.Fatalf("expected BVH quality to be %f; got %f", expQuality, quality)
+	}
+
+	// Adding a second mesh stored as a single leaf weights each mesh by its
+	// primitive count: (3.4 + 2) / (4 + 2)
+	sc.BvhNodeList = append(sc.BvhNodeList, BvhNode{Min: types.Vec3{0, 0, 0}, LData: -4, Max: types.Vec3{1, 1, 1}, RData: 2})
+	sc.MeshRanges = append(sc.MeshRanges, MeshRange{BvhRoot: 3, BvhNodeCount: 1, FirstPrimitive: 4, PrimitiveCount: 2})
+
+	expQuality = (3.4 + 2.0) / 6.0
+	if quality := sc.BvhQuality(); math.Abs(quality-expQuality) > 1e-6 {
+		t.Fatalf("expected BVH quality to be %f; got %f", expQuality, quality)
+	}
+
+	if quality := (&Scene{}).BvhQuality(); quality != 0 {
+		t.Fatalf("expected BVH quality of an empty scene to be 0; got %f", quality)
+	}
+}
@@ -2,6 +2,7 @@ package scene
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/achilleasa/polaris/types"
 )
@@ -18,10 +19,87 @@ const (
 	Backward
 )
 
+// The projection used by a camera.
+type Projection uint8
+
+const (
+	// Rays originate from the eye position and diverge according to the
+	// camera FOV.
+	ProjectionPerspective Projection = iota
+
+	// Rays are parallel to the view direction and originate from points
+	// across the image plane. The camera FOV is ignored.
+	ProjectionOrthographic
+
+	// Rays cover the full sphere around the eye position. The horizontal
+	// screen axis maps to the longitude and the vertical axis to the
+	// latitude of the ray direction. The camera FOV is ignored.
+	ProjectionEquirectangular
+
+	// Equidistant fisheye projection. The angle between each ray and the
+	// view direction is proportional to the distance of the pixel from the
+	// frame center. The camera FOV specifies the horizontal field of view
+	// and may exceed 180 degrees.
+	ProjectionFisheye
+
+	// Panini projection. Rays are projected on a cylinder around the eye
+	// position which is then projected on the image plane from a point at
+	// unit distance behind the cylinder axis. Vertical lines remain straight
+	// while wide horizontal fields of view are compressed. The camera FOV
+	// specifies the horizontal field of view and must be less than 360
+	// degrees.
+	ProjectionPanini
+)
+
+// Parse a camera projection from its name.
+func ParseProjection(name string) (Projection, error) {
+	switch name {
+	case "perspective", "":
+		return ProjectionPerspective, nil
+	case "orthographic":
+		return ProjectionOrthographic, nil
+	case "equirectangular":
+		return ProjectionEquirectangular, nil
+	case "fisheye":
+		return ProjectionFisheye, nil
+	case "panini":
+		return ProjectionPanini, nil
+	}
+
+	return ProjectionPerspective, fmt.Errorf("unsupported camera projection %q; supported values are: perspective, orthographic, equirectangular, fisheye, panini", name)
+}
+
+func (p Projection) String() string {
+	switch p {
+	case ProjectionPerspective:
+		return "perspective"
+	case ProjectionOrthographic:
+		return "orthographic"
+	case ProjectionEquirectangular:
+		return "equirectangular"
+	case ProjectionFisheye:
+		return "fisheye"
+	case ProjectionPanini:
+		return "panini"
+	}
+
+	return "invalid"
+}
+
+// Returns true if the projection maps the screen coordinates to ray directions
+// using spherical or cylindrical coordinates instead of a planar frustrum.
+func (p Projection) IsPanoramic() bool {
+	return p == ProjectionEquirectangular || p == ProjectionFisheye || p == ProjectionPanini
+}
+
 // Stores the ray directions at the for corners of our camera frustrum. It is
 // used as a shortcut for generating per pixel rays via interpolation of the
 // corner rays. While we don't care about the W coordinate we use Vec4 since
-// opencl provides a vectorized float4 type
+// opencl provides a vectorized float4 type. For orthographic cameras, the
+// frustrum stores the offsets of the corner ray origins from the eye position.
+// For panoramic projections, the X and Y coordinates of each corner store the
+// corner position in projection space (angles for equirectangular and fisheye
+// projections and image plane coordinates for panini projections).
 type Frustrum [4]types.Vec4
 
 func (fr Frustrum) String() string {
@@ -42,6 +120,10 @@ type Camera struct {
 	Pitch    float32
 	Yaw      float32
 
+	// Roll angle in degrees. The up vector is rotated by this angle
+	// around the view direction when building the view matrix.
+	Roll float32
+
 	ViewMat  types.Mat4
 	ProjMat  types.Mat4
 	Frustrum Frustrum
@@ -49,6 +131,22 @@ type Camera struct {
 	// Camera FOV
 	FOV float32
 
+	// The camera projection. When using an orthographic projection, the
+	// ortho scale specifies the half-height of the image plane in world
+	// units. The half-width is derived from the frame aspect ratio.
+	Projection Projection
+	OrthoScale float32
+
+	// The shutter efficiency curve used for sampling motion blur times.
+	Shutter Shutter
+
+	// Thin lens model settings. Rays are emitted from a disk with the
+	// specified radius and converge on a plane perpendicular to the view
+	// direction at the specified distance from the eye. A zero aperture
+	// radius describes a pinhole camera.
+	ApertureRadius float32
+	FocalDistance  float32
+
 	// Adjust the frustrum so that Y is inverted
 	InvertY bool
 }
@@ -61,12 +159,23 @@ func NewCamera(fov float32) *Camera {
 		LookAt:   types.Vec3{0, 0, -1},
 		Up:       types.Vec3{0, 1, 0},
 		FOV:      fov,
+
+		Projection: ProjectionPerspective,
+		OrthoScale: 1,
+
+		// Pinhole camera focused on the look point
+		ApertureRadius: 0,
+		FocalDistance:  1,
 	}
 }
 
 // Setup camera projection matrix.
 func (c *Camera) SetupProjection(aspect float32) {
-	c.ProjMat = types.Perspective4(c.FOV, aspect, 1, 1000)
+	if c.Projection == ProjectionOrthographic {
+		c.ProjMat = types.Ortho4(-c.OrthoScale*aspect, c.OrthoScale*aspect, -c.OrthoScale, c.OrthoScale, 1, 1000)
+	} else {
+		c.ProjMat = types.Perspective4(c.FOV, aspect, 1, 1000)
+	}
 	c.Update()
 }
 
@@ -107,10 +216,21 @@ func (c *Camera) Update() {
 	dir = orientQuat.Rotate(dir)
 	c.LookAt = c.Position.Add(dir.Mul(1.0))
 
-	c.ViewMat = types.LookAtV(c.Position, c.LookAt, c.Up)
+	c.ViewMat = types.LookAtV(c.Position, c.LookAt, c.RolledUp())
 	c.updateFrustrum()
 }
 
+// Get the camera up vector after applying the roll angle.
+func (c *Camera) RolledUp() types.Vec3 {
+	if c.Roll == 0 {
+		return c.Up
+	}
+
+	dir := c.LookAt.Sub(c.Position).Normalize()
+	rollQuat := types.QuatFromAxisAngle(dir, c.Roll*math.Pi/180.0)
+	return rollQuat.Rotate(c.Up)
+}
+
 func (c *Camera) InvViewProjMat() types.Mat4 {
 	return c.ProjMat.Mul4(c.ViewMat).Inv()
 }
@@ -138,4 +258,155 @@ func (c *Camera) updateFrustrum() {
 
 	v = invProjViewMat.Mul4x1(types.XYZW(1, -yUp, -1, 1))
 	c.Frustrum[3] = v.Mul(1.0 / v[3]).Vec3().Sub(c.Position).Vec4(0)
+
+	if c.Projection.IsPanoramic() {
+		c.updatePanoramicFrustrum(yUp)
+		return
+	}
+
+	// For orthographic projections, project the corner points on the near
+	// plane to the plane that passes through the eye position.
+	if c.Projection == ProjectionOrthographic {
+		_, _, forward := c.LensAxes()
+		for index, corner := range c.Frustrum {
+			offset := corner.Vec3()
+			c.Frustrum[index] = offset.Sub(forward.Mul(offset.Dot(forward))).Vec4(0)
+		}
+	}
+}
+
+// Setup the frustrum corners for panoramic projections using the projection
+// space extents of the frame. As panoramic projections use a perspective
+// projection matrix, the frame aspect ratio is recovered from its scale
+// factors.
+func (c *Camera) updatePanoramicFrustrum(yUp float32) {
+	aspect := float32(1.0)
+	if c.ProjMat[0] != 0 {
+		aspect = c.ProjMat[5] / c.ProjMat[0]
+	}
+
+	halfFOV := 0.5 * c.FOV * math.Pi / 180.0
+	var halfW, halfH float32
+	switch c.Projection {
+	case ProjectionEquirectangular:
+		halfW, halfH = math.Pi, 0.5*math.Pi
+	case ProjectionFisheye:
+		halfW, halfH = halfFOV, halfFOV/aspect
+	case ProjectionPanini:
+		halfW = 2.0 * float32(math.Tan(float64(0.5*halfFOV)))
+		halfH = halfW / aspect
+	}
+
+	c.Frustrum[0] = types.XYZW(-halfW, yUp*halfH, 0, 0)
+	c.Frustrum[1] = types.XYZW(halfW, yUp*halfH, 0, 0)
+	c.Frustrum[2] = types.XYZW(-halfW, -yUp*halfH, 0, 0)
+	c.Frustrum[3] = types.XYZW(halfW, -yUp*halfH, 0, 0)
+}
+
+// Create a copy of the camera for one eye of a stereoscopic pair. The eye
+// camera is offset along the right axis of the camera by the given distance;
+// negative offsets select the left eye. Both eyes keep the view direction of
+// the camera (parallel stereo) so their frustrum corner rays are identical.
+func (c *Camera) StereoEye(offset float32) *Camera {
+	right, _, _ := c.LensAxes()
+	delta := right.Mul(offset)
+
+	eye := *c
+	eye.Position = c.Position.Add(delta)
+	eye.LookAt = c.LookAt.Add(delta)
+	eye.ViewMat = types.LookAtV(eye.Position, eye.LookAt, eye.RolledUp())
+	return &eye
+}
+
+// Create the left and right eye cameras for a stereoscopic pair whose eyes are
+// separated by the given interpupillary distance.
+func (c *Camera) StereoPair(ipd float32) (left, right *Camera) {
+	return c.StereoEye(-0.5 * ipd), c.StereoEye(0.5 * ipd)
+}
+
+// Get the orthonormal right, up and forward axes of the camera lens.
+func (c *Camera) LensAxes() (right, up, forward types.Vec3) {
+	forward = c.LookAt.Sub(c.Position).Normalize()
+	right = forward.Cross(c.RolledUp()).Normalize()
+	up = right.Cross(forward)
+	return right, up, forward
+}
+
+// Generate a primary ray for the normalized screen coordinates. Screen
+// coordinates are in the [0, 1] range with the origin at the top-left corner
+// of the frustrum. The lens sample contains two uniform random numbers in the
+// [0, 1) range that select the point on the lens aperture where the ray
+// originates from. Orthographic cameras ignore the lens sample and generate
+// rays parallel to the view direction. Panoramic projections ignore the lens
+// sample and generate rays from the eye position. The primary ray generation
+// kernel uses the same approach.
+func (c *Camera) GenerateRay(screen, lensSample types.Vec2) (origin, dir types.Vec3) {
+	dir = lerpVec3(
+		lerpVec3(c.Frustrum[0].Vec3(), c.Frustrum[2].Vec3(), screen[1]),
+		lerpVec3(c.Frustrum[1].Vec3(), c.Frustrum[3].Vec3(), screen[1]),
+		screen[0],
+	)
+
+	if c.Projection == ProjectionOrthographic {
+		_, _, forward := c.LensAxes()
+		return c.Position.Add(dir), forward
+	}
+
+	if c.Projection.IsPanoramic() {
+		return c.Position, c.panoramicRayDir(dir[0], dir[1])
+	}
+
+	dir = dir.Normalize()
+
+	if c.ApertureRadius <= 0 {
+		return c.Position, dir
+	}
+
+	// Find where the pinhole ray intersects the focal plane and aim a ray
+	// from a uniformly sampled point on the lens disk towards it.
+	right, up, forward := c.LensAxes()
+	focusDist := c.FocalDistance / dir.Dot(forward)
+
+	r := c.ApertureRadius * float32(math.Sqrt(float64(lensSample[0])))
+	phi := 2.0 * math.Pi * float64(lensSample[1])
+	lensOffset := right.Mul(r * float32(math.Cos(phi))).Add(up.Mul(r * float32(math.Sin(phi))))
+
+	return c.Position.Add(lensOffset), dir.Mul(focusDist).Sub(lensOffset).Normalize()
+}
+
+// Map a point in projection space to a ray direction for panoramic
+// projections.
+func (c *Camera) panoramicRayDir(u, v float32) types.Vec3 {
+	right, up, forward := c.LensAxes()
+
+	switch c.Projection {
+	case ProjectionEquirectangular:
+		// u is the longitude and v the latitude of the ray
+		sinU, cosU := math.Sincos(float64(u))
+		sinV, cosV := math.Sincos(float64(v))
+		return right.Mul(float32(sinU * cosV)).Add(forward.Mul(float32(cosU * cosV))).Add(up.Mul(float32(sinV))).Normalize()
+	case ProjectionFisheye:
+		// The distance from the frame center is the angle between the
+		// ray and the view direction
+		theta := float32(math.Sqrt(float64(u*u + v*v)))
+		if theta == 0 {
+			return forward
+		}
+		sinTheta, cosTheta := math.Sincos(float64(theta))
+		radial := right.Mul(u / theta).Add(up.Mul(v / theta))
+		return radial.Mul(float32(sinTheta)).Add(forward.Mul(float32(cosTheta))).Normalize()
+	case ProjectionPanini:
+		// Invert the projection of the cylinder point at longitude phi
+		// and height h: u = 2 * tan(phi/2) and v = 2 * h / (1 + cos(phi))
+		phi := 2.0 * math.Atan(float64(0.5*u))
+		sinPhi, cosPhi := math.Sincos(phi)
+		h := 0.5 * v * float32(1.0+cosPhi)
+		return right.Mul(float32(sinPhi)).Add(up.Mul(h)).Add(forward.Mul(float32(cosPhi))).Normalize()
+	}
+
+	return forward
+}
+
+func lerpVec3(v1, v2 types.Vec3, t float32) types.Vec3 {
+	return v1.Add(v2.Sub(v1).Mul(t))
 }
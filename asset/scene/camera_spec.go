@@ -0,0 +1,104 @@
+package scene
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// The field of view used by camera specs that do not define one.
+const defaultSpecFOV float32 = 45
+
+// Parse a compact camera spec and return the described camera. The spec
+// contains whitespace or semicolon-delimited key=value pairs; vector values
+// are specified as comma-delimited components. For example:
+//
+//	lookfrom=0,1,5 lookat=0,0,0 vup=0,1,0 fov=60
+//
+// Supported keys are lookfrom, lookat, vup, fov and roll. Keys that are not
+// present in the spec retain the values assigned by NewCamera.
+func ParseCameraSpec(spec string) (*Camera, error) {
+	c := NewCamera(defaultSpecFOV)
+
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ';' || r == ' ' || r == '\t'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("camera spec: empty spec")
+	}
+
+	seen := make(map[string]bool, 0)
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("camera spec: invalid entry %q; expected key=value", field)
+		}
+
+		key, value := strings.ToLower(parts[0]), parts[1]
+		if seen[key] {
+			return nil, fmt.Errorf("camera spec: duplicate key %q", key)
+		}
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "lookfrom":
+			c.Position, err = parseSpecVec3(key, value)
+		case "lookat":
+			c.LookAt, err = parseSpecVec3(key, value)
+		case "vup":
+			c.Up, err = parseSpecVec3(key, value)
+		case "fov":
+			c.FOV, err = parseSpecFloat32(key, value)
+			if err == nil && (c.FOV <= 0 || c.FOV >= 180) {
+				err = fmt.Errorf("camera spec: fov must be in the (0, 180) range; got %v", c.FOV)
+			}
+		case "roll":
+			c.Roll, err = parseSpecFloat32(key, value)
+		default:
+			err = fmt.Errorf("camera spec: unknown key %q; supported keys: lookfrom, lookat, vup, fov, roll", key)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Position == c.LookAt {
+		return nil, fmt.Errorf("camera spec: lookfrom and lookat must not coincide")
+	}
+	if c.Up.Len() == 0 {
+		return nil, fmt.Errorf("camera spec: vup must not be a zero vector")
+	}
+
+	return c, nil
+}
+
+func parseSpecFloat32(key, value string) (float32, error) {
+	v, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return 0, fmt.Errorf("camera spec: invalid value %q for %q", value, key)
+	}
+	return float32(v), nil
+}
+
+func parseSpecVec3(key, value string) (types.Vec3, error) {
+	var v types.Vec3
+
+	tokens := strings.Split(value, ",")
+	if len(tokens) != 3 {
+		return v, fmt.Errorf("camera spec: expected 3 components for %q; got %d", key, len(tokens))
+	}
+
+	for axis, token := range tokens {
+		f, err := strconv.ParseFloat(token, 32)
+		if err != nil {
+			return v, fmt.Errorf("camera spec: invalid component %q for %q", token, key)
+		}
+		v[axis] = float32(f)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,348 @@
+package scene
+
+import (
+	"math"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestCameraRoll(t *testing.T) {
+	specs := []struct {
+		roll     float32
+		expUp    types.Vec3
+		expRight types.Vec3
+	}{
+		{0, types.Vec3{0, 1, 0}, types.Vec3{1, 0, 0}},
+		{90, types.Vec3{1, 0, 0}, types.Vec3{0, -1, 0}},
+	}
+
+	for specIndex, spec := range specs {
+		c := NewCamera(45)
+		c.Roll = spec.roll
+		c.SetupProjection(1)
+
+		// Derive the effective up/right axes from the frustrum corner rays
+		up := c.Frustrum[0].Sub(c.Frustrum[2]).Vec3().Normalize()
+		right := c.Frustrum[1].Sub(c.Frustrum[0]).Vec3().Normalize()
+
+		if !approxEqual(up, spec.expUp) {
+			t.Fatalf("[spec %d] expected effective up axis to be %v; got %v", specIndex, spec.expUp, up)
+		}
+		if !approxEqual(right, spec.expRight) {
+			t.Fatalf("[spec %d] expected effective right axis to be %v; got %v", specIndex, spec.expRight, right)
+		}
+
+		// The world up vector should not be modified
+		if c.Up != (types.Vec3{0, 1, 0}) {
+			t.Fatalf("[spec %d] expected camera up vector to remain unchanged; got %v", specIndex, c.Up)
+		}
+	}
+}
+
+func TestCameraPinholeRays(t *testing.T) {
+	c := NewCamera(60)
+	c.Position = types.Vec3{1, 2, 3}
+	c.LookAt = types.Vec3{0, 0, 0}
+	c.SetupProjection(1.5)
+
+	for _, screen := range []types.Vec2{{0, 0}, {1, 1}, {0.25, 0.75}, {0.5, 0.5}} {
+		// Pinhole ray generated by interpolating the frustrum corner rays
+		tl, tr, bl, br := c.Frustrum[0].Vec3(), c.Frustrum[1].Vec3(), c.Frustrum[2].Vec3(), c.Frustrum[3].Vec3()
+		left := tl.Add(bl.Sub(tl).Mul(screen[1]))
+		right := tr.Add(br.Sub(tr).Mul(screen[1]))
+		expDir := left.Add(right.Sub(left).Mul(screen[0])).Normalize()
+
+		for _, lensSample := range []types.Vec2{{0, 0}, {0.3, 0.9}} {
+			origin, dir := c.GenerateRay(screen, lensSample)
+			if origin != c.Position {
+				t.Fatalf("[screen %v] expected pinhole ray origin to be %v; got %v", screen, c.Position, origin)
+			}
+			if dir != expDir {
+				t.Fatalf("[screen %v] expected pinhole ray direction to be %v; got %v", screen, expDir, dir)
+			}
+		}
+	}
+}
+
+func TestCameraThinLensRays(t *testing.T) {
+	c := NewCamera(45)
+	c.ApertureRadius = 0.5
+	c.FocalDistance = 4
+	c.SetupProjection(1)
+
+	screen := types.Vec2{0.3, 0.6}
+	pinhole := *c
+	pinhole.ApertureRadius = 0
+	pinholeOrigin, pinholeDir := pinhole.GenerateRay(screen, types.Vec2{})
+	_, _, forward := c.LensAxes()
+	expFocus := pinholeOrigin.Add(pinholeDir.Mul(c.FocalDistance / pinholeDir.Dot(forward)))
+
+	for _, lensSample := range []types.Vec2{{1, 0}, {0.5, 0.25}, {0.9, 0.6}} {
+		origin, dir := c.GenerateRay(screen, lensSample)
+
+		// Rays should originate from the lens disk
+		offset := origin.Sub(c.Position)
+		if offset.Len() > c.ApertureRadius+1e-5 || offset.Dot(forward) > 1e-5 {
+			t.Fatalf("[lens sample %v] expected ray origin %v to lie on the lens disk", lensSample, origin)
+		}
+
+		// and converge on the focal plane
+		focus := origin.Add(dir.Mul((c.FocalDistance - offset.Dot(forward)) / dir.Dot(forward)))
+		if !approxEqual(focus, expFocus) {
+			t.Fatalf("[lens sample %v] expected ray to intersect the focal plane at %v; got %v", lensSample, expFocus, focus)
+		}
+	}
+}
+
+func TestCameraOrthographicRays(t *testing.T) {
+	if c := NewCamera(45); c.Projection != ProjectionPerspective {
+		t.Fatalf("expected default camera projection to be %v; got %v", ProjectionPerspective, c.Projection)
+	}
+
+	var rays [2][][2]types.Vec3
+	for fovIndex, fov := range []float32{30, 90} {
+		c := NewCamera(fov)
+		c.Position = types.Vec3{0, 0, 5}
+		c.LookAt = types.Vec3{0, 0, 0}
+		c.Projection = ProjectionOrthographic
+		c.OrthoScale = 2
+		c.SetupProjection(2)
+
+		specs := []struct {
+			screen    types.Vec2
+			expOrigin types.Vec3
+		}{
+			{types.Vec2{0, 0}, types.Vec3{-4, 2, 5}},
+			{types.Vec2{1, 0}, types.Vec3{4, 2, 5}},
+			{types.Vec2{0, 1}, types.Vec3{-4, -2, 5}},
+			{types.Vec2{0.5, 0.5}, types.Vec3{0, 0, 5}},
+		}
+
+		for _, spec := range specs {
+			origin, dir := c.GenerateRay(spec.screen, types.Vec2{0.3, 0.9})
+			if !approxEqual(origin, spec.expOrigin) {
+				t.Fatalf("[fov %f, screen %v] expected ray origin to be %v; got %v", fov, spec.screen, spec.expOrigin, origin)
+			}
+			if !approxEqual(dir, types.Vec3{0, 0, -1}) {
+				t.Fatalf("[fov %f, screen %v] expected ray to be parallel to the view direction; got %v", fov, spec.screen, dir)
+			}
+			rays[fovIndex] = append(rays[fovIndex], [2]types.Vec3{origin, dir})
+		}
+	}
+
+	// The FOV should be ignored
+	for index := range rays[0] {
+		if rays[0][index] != rays[1][index] {
+			t.Fatalf("expected orthographic rays to be independent of the camera FOV; got %v and %v", rays[0][index], rays[1][index])
+		}
+	}
+
+	if _, err := ParseProjection("stereographic"); err == nil {
+		t.Fatal("expected an error for an unsupported projection")
+	}
+}
+
+func TestCameraFisheyeRays(t *testing.T) {
+	for _, fov := range []float32{90, 180, 270} {
+		c := NewCamera(fov)
+		c.Position = types.Vec3{0, 0, 5}
+		c.LookAt = types.Vec3{0, 0, 0}
+		c.Projection = ProjectionFisheye
+		c.ApertureRadius = 0.5
+		c.SetupProjection(2)
+
+		// The edge rays should span the full horizontal FOV and half the
+		// FOV vertically
+		halfFOV := 0.5 * float64(fov) * math.Pi / 180.0
+		_, _, forward := c.LensAxes()
+		specs := []struct {
+			screen   types.Vec2
+			expAngle float64
+		}{
+			{types.Vec2{0.5, 0.5}, 0},
+			{types.Vec2{0, 0.5}, halfFOV},
+			{types.Vec2{1, 0.5}, halfFOV},
+			{types.Vec2{0.5, 0}, 0.5 * halfFOV},
+			{types.Vec2{0.5, 1}, 0.5 * halfFOV},
+		}
+
+		for _, spec := range specs {
+			origin, dir := c.GenerateRay(spec.screen, types.Vec2{0.3, 0.9})
+			if origin != c.Position {
+				t.Fatalf("[fov %f, screen %v] expected fisheye ray origin to be %v; got %v", fov, spec.screen, c.Position, origin)
+			}
+			if angle := rayAngle(dir, forward); math.Abs(angle-spec.expAngle) > 1e-4 {
+				t.Fatalf("[fov %f, screen %v] expected angle between ray and view direction to be %f; got %f", fov, spec.screen, spec.expAngle, angle)
+			}
+		}
+
+		_, left := c.GenerateRay(types.Vec2{0, 0.5}, types.Vec2{})
+		_, right := c.GenerateRay(types.Vec2{1, 0.5}, types.Vec2{})
+		if left[0] >= 0 || right[0] <= 0 {
+			t.Fatalf("[fov %f] expected left and right edge rays to point towards opposite sides; got %v and %v", fov, left, right)
+		}
+		if fov <= 180 {
+			if angle := rayAngle(left, right); math.Abs(angle-2*halfFOV) > 1e-4 {
+				t.Fatalf("[fov %f] expected edge rays to span the camera FOV; got %f", fov, angle*180/math.Pi)
+			}
+		}
+	}
+}
+
+func TestCameraPanoramicRays(t *testing.T) {
+	specs := []struct {
+		projection Projection
+		screen     types.Vec2
+		expDir     types.Vec3
+	}{
+		{ProjectionEquirectangular, types.Vec2{0.5, 0.5}, types.Vec3{0, 0, -1}},
+		{ProjectionEquirectangular, types.Vec2{0.75, 0.5}, types.Vec3{1, 0, 0}},
+		{ProjectionEquirectangular, types.Vec2{0, 0.5}, types.Vec3{0, 0, 1}},
+		{ProjectionEquirectangular, types.Vec2{0.5, 0}, types.Vec3{0, 1, 0}},
+		{ProjectionEquirectangular, types.Vec2{0.5, 1}, types.Vec3{0, -1, 0}},
+		{ProjectionPanini, types.Vec2{0.5, 0.5}, types.Vec3{0, 0, -1}},
+		{ProjectionPanini, types.Vec2{1, 0.5}, types.Vec3{0.8660254, 0, 0.5}},
+		{ProjectionPanini, types.Vec2{0, 0.5}, types.Vec3{-0.8660254, 0, 0.5}},
+	}
+
+	for specIndex, spec := range specs {
+		c := NewCamera(240)
+		c.Projection = spec.projection
+		c.SetupProjection(2)
+
+		origin, dir := c.GenerateRay(spec.screen, types.Vec2{})
+		if origin != c.Position {
+			t.Fatalf("[spec %d] expected %v ray origin to be %v; got %v", specIndex, spec.projection, c.Position, origin)
+		}
+		if !approxEqual(dir, spec.expDir) {
+			t.Fatalf("[spec %d] expected %v ray direction to be %v; got %v", specIndex, spec.projection, spec.expDir, dir)
+		}
+	}
+
+	// Panini projections should keep vertical lines straight
+	c := NewCamera(120)
+	c.Projection = ProjectionPanini
+	c.SetupProjection(1)
+	_, top := c.GenerateRay(types.Vec2{0.8, 0.1}, types.Vec2{})
+	_, bottom := c.GenerateRay(types.Vec2{0.8, 0.9}, types.Vec2{})
+	if !approxEqual(types.Vec3{top[0], 0, top[2]}.Normalize(), types.Vec3{bottom[0], 0, bottom[2]}.Normalize()) {
+		t.Fatalf("expected rays for the same column to share the same longitude; got %v and %v", top, bottom)
+	}
+
+	for _, name := range []string{"equirectangular", "fisheye", "panini"} {
+		projection, err := ParseProjection(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !projection.IsPanoramic() || projection.String() != name {
+			t.Fatalf("expected %q to be parsed as a panoramic projection; got %v", name, projection)
+		}
+	}
+}
+
+func rayAngle(v1, v2 types.Vec3) float64 {
+	cos := float64(v1.Normalize().Dot(v2.Normalize()))
+	return math.Acos(math.Max(-1, math.Min(1, cos)))
+}
+
+func TestCameraStereoPair(t *testing.T) {
+	c := NewCamera(60)
+	c.Position = types.Vec3{0, 1, 5}
+	c.LookAt = types.Vec3{0, 1, 0}
+	c.SetupProjection(1.5)
+
+	ipd := float32(0.064)
+	left, right := c.StereoPair(ipd)
+
+	expOffset := types.Vec3{ipd / 2, 0, 0}
+	for eyeIndex, eye := range []struct {
+		camera *Camera
+		offset types.Vec3
+	}{
+		{left, expOffset.Mul(-1)},
+		{right, expOffset},
+	} {
+		if !approxEqual(eye.camera.Position, c.Position.Add(eye.offset)) || !approxEqual(eye.camera.LookAt, c.LookAt.Add(eye.offset)) {
+			t.Fatalf("[eye %d] expected eye camera to be offset by %v; got position %v and look at %v", eyeIndex, eye.offset, eye.camera.Position, eye.camera.LookAt)
+		}
+
+		// The view matrix should map the eye position to the origin
+		if origin := eye.camera.ViewMat.Mul4x1(eye.camera.Position.Vec4(1)).Vec3(); !approxEqual(origin, types.Vec3{}) {
+			t.Fatalf("[eye %d] expected eye view matrix to be centered at the eye position; got %v", eyeIndex, origin)
+		}
+	}
+
+	// Apart from the horizontal offset, both eyes should match the camera
+	if !approxEqual(right.Position.Sub(left.Position), types.Vec3{ipd, 0, 0}) {
+		t.Fatalf("expected eye cameras to be %f units apart; got %v", ipd, right.Position.Sub(left.Position))
+	}
+	for _, eye := range []*Camera{left, right} {
+		cmp := *eye
+		cmp.Position, cmp.LookAt, cmp.ViewMat = c.Position, c.LookAt, c.ViewMat
+		if cmp != *c {
+			t.Fatalf("expected eye camera to only differ in its position; got %+v", eye)
+		}
+	}
+}
+
+func approxEqual(v1, v2 types.Vec3) bool {
+	return v1.Sub(v2).Len() < 1e-4
+}
+
+func TestParseCameraSpec(t *testing.T) {
+	c, err := ParseCameraSpec("lookfrom=0,1,5 lookat=0,0.5,0; vup=0,0,1 fov=60 roll=15")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := (types.Vec3{0, 1, 5}); c.Position != exp {
+		t.Fatalf("expected camera position to be %v; got %v", exp, c.Position)
+	}
+	if exp := (types.Vec3{0, 0.5, 0}); c.LookAt != exp {
+		t.Fatalf("expected camera target to be %v; got %v", exp, c.LookAt)
+	}
+	if exp := (types.Vec3{0, 0, 1}); c.Up != exp {
+		t.Fatalf("expected camera up vector to be %v; got %v", exp, c.Up)
+	}
+	if c.FOV != 60 {
+		t.Fatalf("expected camera fov to be 60; got %v", c.FOV)
+	}
+	if c.Roll != 15 {
+		t.Fatalf("expected camera roll to be 15; got %v", c.Roll)
+	}
+
+	// Missing keys should use the default camera settings
+	c, err = ParseCameraSpec("lookfrom=1,2,3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.FOV != 45 || c.LookAt != (types.Vec3{0, 0, -1}) || c.Up != (types.Vec3{0, 1, 0}) {
+		t.Fatalf("expected unspecified camera fields to use the defaults; got fov %v, lookat %v, vup %v", c.FOV, c.LookAt, c.Up)
+	}
+}
+
+func TestParseCameraSpecErrors(t *testing.T) {
+	specs := []struct {
+		in       string
+		expError string
+	}{
+		{"", "camera spec: empty spec"},
+		{"lookfrom", `camera spec: invalid entry "lookfrom"; expected key=value`},
+		{"lookfrom=1,2", `camera spec: expected 3 components for "lookfrom"; got 2`},
+		{"lookat=1,foo,3", `camera spec: invalid component "foo" for "lookat"`},
+		{"fov=wide", `camera spec: invalid value "wide" for "fov"`},
+		{"fov=180", "camera spec: fov must be in the (0, 180) range; got 180"},
+		{"fov=45 fov=60", `camera spec: duplicate key "fov"`},
+		{"zoom=2", `camera spec: unknown key "zoom"; supported keys: lookfrom, lookat, vup, fov, roll`},
+		{"lookfrom=0,0,-1", "camera spec: lookfrom and lookat must not coincide"},
+		{"vup=0,0,0", "camera spec: vup must not be a zero vector"},
+	}
+
+	for specIndex, spec := range specs {
+		_, err := ParseCameraSpec(spec.in)
+		if err == nil || err.Error() != spec.expError {
+			t.Fatalf("[spec %d] expected error %q; got %v", specIndex, spec.expError, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package scene
+
+// A finite dome onto which the scene background environment is projected.
+// The dome is a sphere centered at the world origin whose lower part is
+// clipped by a horizontal ground plane. Rays that miss the scene geometry are
+// intersected with the dome and the background is sampled using the
+// direction from the dome center to the intersection point. This grounds
+// objects resting on the ground plane as the environment is projected onto
+// the ground instead of appearing infinitely far away.
+type Dome struct {
+	// The dome radius. A zero value disables the dome projection and the
+	// background is treated as an infinite sphere.
+	Radius float32
+
+	// The height of the ground plane along the Y axis relative to the
+	// dome center. This usually matches the negated height of the camera
+	// that captured the environment.
+	GroundHeight float32
+}
+
+// Check if the dome projection is enabled.
+func (d *Dome) Enabled() bool {
+	return d.Radius > 0
+}
@@ -0,0 +1,57 @@
+package scene
+
+import (
+	"math"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+const (
+	// The intersection epsilon relative to the scene scale. Scenes whose
+	// coordinates span the unit range use an epsilon of 1e-5.
+	relativeIntersectionEpsilon float32 = 1e-5
+
+	// The intersection epsilon used for scenes with empty or degenerate
+	// bounds.
+	DefaultIntersectionEpsilon float32 = relativeIntersectionEpsilon
+)
+
+// Derive an intersection epsilon from the scene bounds. The epsilon is
+// proportional to the largest absolute coordinate of the bounds so that the
+// precision of intersection tests adapts to the magnitude of the scene
+// coordinates. If the bounds are empty or inverted, DefaultIntersectionEpsilon
+// is returned.
+func DeriveIntersectionEpsilon(bounds [2]types.Vec3) float32 {
+	for axis := 0; axis < 3; axis++ {
+		if bounds[0][axis] > bounds[1][axis] {
+			return DefaultIntersectionEpsilon
+		}
+	}
+
+	var scale float32
+	for _, corner := range bounds {
+		for axis := 0; axis < 3; axis++ {
+			if v := float32(math.Abs(float64(corner[axis]))); v > scale {
+				scale = v
+			}
+		}
+	}
+
+	if scale == 0 || math.IsInf(float64(scale), 0) || math.IsNaN(float64(scale)) {
+		return DefaultIntersectionEpsilon
+	}
+	return scale * relativeIntersectionEpsilon
+}
+
+// Get the epsilon used by the ray/primitive and ray/bbox intersection tests.
+// The IntersectionEpsilonOverride value is returned if set; otherwise the
+// epsilon is derived from the scene bounds.
+//
+// Intersections closer than the epsilon to the ray origin are ignored.
+func (sc *Scene) IntersectionEpsilon() float32 {
+	if sc.IntersectionEpsilonOverride > 0 {
+		return sc.IntersectionEpsilonOverride
+	}
+	min, max := sc.Bounds()
+	return DeriveIntersectionEpsilon([2]types.Vec3{min, max})
+}
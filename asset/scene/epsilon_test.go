@@ -0,0 +1,95 @@
+package scene
+
+import (
+	"math"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestDeriveIntersectionEpsilon(t *testing.T) {
+	specs := []struct {
+		bounds [2]types.Vec3
+		expEps float32
+	}{
+		{[2]types.Vec3{}, DefaultIntersectionEpsilon},
+		{[2]types.Vec3{{-1, -1, -1}, {1, 1, 1}}, 1e-5},
+		{[2]types.Vec3{{-2000, 0, 0}, {10, 500, 10}}, 2e-2},
+		{[2]types.Vec3{{0, 0, 0}, {1e-6, 1e-6, 0}}, 1e-11},
+		// empty scene bounds
+		{[2]types.Vec3{{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}, {-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}}, DefaultIntersectionEpsilon},
+	}
+
+	for specIndex, spec := range specs {
+		eps := DeriveIntersectionEpsilon(spec.bounds)
+		if !approxEqualRel(eps, spec.expEps) {
+			t.Errorf("[spec %d] expected epsilon to be %g; got %g", specIndex, spec.expEps, eps)
+		}
+	}
+
+	sc := &Scene{
+		IntersectionEpsilonOverride: 0.5,
+	}
+	if eps := sc.IntersectionEpsilon(); eps != 0.5 {
+		t.Fatalf("expected the epsilon override to be used; got %g", eps)
+	}
+}
+
+func TestDerivedIntersectionEpsilonAdaptsToSceneScale(t *testing.T) {
+	// Tiny scenes: the ray/triangle determinant is much smaller than the
+	// default epsilon so a fixed epsilon treats the ray as parallel.
+	tiny := epsilonTestScene(1e-6)
+	origin := types.Vec3{0.25e-6, 0.25e-6, 1e-6}
+	dir := types.Vec3{0, 0, -1}
+	if !tiny.MeshOccluded(0, origin, dir, 2e-6) {
+		t.Fatal("expected ray to intersect the tiny scene using the derived epsilon")
+	}
+	tiny.IntersectionEpsilonOverride = DefaultIntersectionEpsilon
+	if tiny.MeshOccluded(0, origin, dir, 2e-6) {
+		t.Fatal("expected ray to miss the tiny scene using the default epsilon")
+	}
+
+	// Large scenes: distant intersections are still reported while
+	// intersections within the rounding error of the scene coordinates are
+	// ignored to avoid self-intersections.
+	large := epsilonTestScene(1e6)
+	origin = types.Vec3{0.25e6, 0.25e6, 1e6}
+	if !large.MeshOccluded(0, origin, dir, 2e6) {
+		t.Fatal("expected ray to intersect the large scene using the derived epsilon")
+	}
+	origin = types.Vec3{0.25e6, 0.25e6, 1}
+	if large.MeshOccluded(0, origin, dir, 2e6) {
+		t.Fatal("expected self-intersection to be ignored in the large scene using the derived epsilon")
+	}
+	large.IntersectionEpsilonOverride = DefaultIntersectionEpsilon
+	if !large.MeshOccluded(0, origin, dir, 2e6) {
+		t.Fatal("expected self-intersection to be reported in the large scene using the default epsilon")
+	}
+}
+
+// Create a scene containing a single instance of a triangle on the XY plane
+// whose legs have the given length.
+func epsilonTestScene(scale float32) *Scene {
+	bbox := [2]types.Vec3{{0, 0, 0}, {scale, scale, 0}}
+
+	var instanceLeaf, leaf BvhNode
+	instanceLeaf.SetBBox(bbox)
+	instanceLeaf.SetMeshIndex(0)
+	leaf.SetBBox(bbox)
+	leaf.SetPrimitives(0, 1)
+
+	return &Scene{
+		BvhNodeList:      []BvhNode{instanceLeaf, leaf},
+		MeshInstanceList: []MeshInstance{{MeshIndex: 0, BvhRoot: 1, Transform: types.Ident4()}},
+		VertexList:       []types.Vec4{{0, 0, 0, 1}, {scale, 0, 0, 1}, {0, scale, 0, 1}},
+		MeshRanges:       []MeshRange{{BvhRoot: 1, BvhNodeCount: 1, FirstPrimitive: 0, PrimitiveCount: 1}},
+	}
+}
+
+func approxEqualRel(v, exp float32) bool {
+	delta := v - exp
+	if delta < 0 {
+		delta = -delta
+	}
+	return delta <= exp*1e-5
+}
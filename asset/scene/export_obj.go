@@ -0,0 +1,66 @@
+package scene
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// Export the compiled scene geometry in wavefront OBJ format. Each mesh
+// instance is written as a separate object whose vertex positions and normals
+// are transformed to world space. Materials are not exported. This method is
+// intended as a debugging aid for inspecting the compiled scene geometry.
+func (sc *Scene) ExportOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# polaris compiled scene export: %d mesh instances\n", len(sc.MeshInstanceList))
+
+	// OBJ indices are 1-based and shared by all objects
+	nextIndex := 1
+	for instIndex, mi := range sc.MeshInstanceList {
+		if int(mi.MeshIndex) >= len(sc.MeshRanges) {
+			return fmt.Errorf("obj export: mesh instance %d references unknown mesh %d", instIndex, mi.MeshIndex)
+		}
+
+		// Instance transforms map world space to object space so we need
+		// their inverse for positions. Normals are transformed by the
+		// inverse transpose of the object to world transform which is
+		// the transpose of the instance transform.
+		objToWorld := mi.Transform.Inv()
+		normalMat := mi.Transform
+
+		mr := sc.MeshRanges[mi.MeshIndex]
+		fmt.Fprintf(bw, "o instance_%d_mesh_%d\n", instIndex, mi.MeshIndex)
+
+		first, last := 3*mr.FirstPrimitive, 3*(mr.FirstPrimitive+mr.PrimitiveCount)
+		for offset := first; offset < last; offset++ {
+			v := objToWorld.Mul4x1(sc.VertexList[sc.VertexIndex(offset/3, offset%3)].Vec3().Vec4(1))
+			fmt.Fprintf(bw, "v %g %g %g\n", v[0], v[1], v[2])
+		}
+		for offset := first; offset < last; offset++ {
+			n := sc.NormalList[sc.VertexIndex(offset/3, offset%3)].Vec3()
+			n = types.Vec3{
+				normalMat.Col(0).Vec3().Dot(n),
+				normalMat.Col(1).Vec3().Dot(n),
+				normalMat.Col(2).Vec3().Dot(n),
+			}.Normalize()
+			fmt.Fprintf(bw, "vn %g %g %g\n", n[0], n[1], n[2])
+		}
+		for offset := first; offset < last; offset++ {
+			uv := sc.UvList[sc.VertexIndex(offset/3, offset%3)]
+			fmt.Fprintf(bw, "vt %g %g\n", uv[0], uv[1])
+		}
+
+		for primIndex := uint32(0); primIndex < mr.PrimitiveCount; primIndex++ {
+			fmt.Fprintf(bw, "f %d/%d/%d %d/%d/%d %d/%d/%d\n",
+				nextIndex, nextIndex, nextIndex,
+				nextIndex+1, nextIndex+1, nextIndex+1,
+				nextIndex+2, nextIndex+2, nextIndex+2,
+			)
+			nextIndex += 3
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,421 @@
+package scene
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// The mapped scene format stores the flat scene arrays as raw memory images so
+// that they can be aliased directly from a memory-mapped file. The file starts
+// with a header describing the location of each array followed by the array
+// data and a gob-encoded trailer with the remaining scene properties. All
+// arrays start at an offset which is a multiple of mappedAlignment; as mmap
+// always returns page-aligned memory this guarantees that the aliased arrays
+// are suitably aligned for both the Go runtime and for direct uploads to the
+// opencl devices.
+//
+// Version 2 of the format adds a flags field to the header. Files using
+// older versions are rejected and need to be re-compiled.
+const (
+	mappedVersion   uint32 = 2
+	mappedAlignment uint64 = 16
+	mappedSections         = 15
+
+	// The index of the motion transform section.
+	mappedMotionSection = 10
+)
+
+// Flags describing the optional contents of a mapped scene file.
+const (
+	// The file contains motion transforms for each mesh instance.
+	mappedHasMotion uint32 = 1 << iota
+)
+
+var mappedMagic = [8]byte{'P', 'O', 'L', 'A', 'R', 'I', 'S', 'M'}
+
+// The location of a flat scene array inside a mapped scene file.
+type mappedSection struct {
+	Offset   uint64
+	Count    uint64
+	ElemSize uint64
+}
+
+// The mapped scene file header. The header is always encoded in little-endian
+// byte order.
+type mappedHeader struct {
+	Magic    [8]byte
+	Version  uint32
+	Flags    uint32
+	Sections [mappedSections]mappedSection
+
+	PropertiesOffset uint64
+	PropertiesLen    uint64
+}
+
+// Scene properties that are not stored as flat arrays.
+type mappedProperties struct {
+	MeshRanges            []MeshRange
+	MaterialRoots         []int32
+	SceneDiffuseMatIndex  int32
+	SceneEmissiveMatIndex int32
+	AllDiffuse            bool
+	EpsilonOverride       float32
+	Camera                *Camera
+	Medium                Medium
+	Dome                  Dome
+	Metadata              Metadata
+}
+
+// A scene whose flat arrays alias a memory-mapped scene file. The mapping is
+// private so any modifications to the scene arrays are never written back to
+// the file. The scene arrays must not be accessed after the scene is closed.
+type MappedScene struct {
+	*Scene
+
+	mapping []byte
+}
+
+// Write a scene to a file using the mapped scene format.
+func WriteMapped(filename string, sc *Scene) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = sc.Save(f)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Serialize the scene to w using the mapped scene format. Scenes written by
+// Save can be loaded back using Load or OpenMapped. All values are encoded in
+// little-endian byte order so the output can be shared between hosts.
+func (sc *Scene) Save(w io.Writer) error {
+	if !hostIsLittleEndian() {
+		return fmt.Errorf("save: mapped scenes are only supported on little-endian hosts")
+	}
+
+	var props bytes.Buffer
+	err := gob.NewEncoder(&props).Encode(&mappedProperties{
+		MeshRanges:            sc.MeshRanges,
+		MaterialRoots:         sc.MaterialRoots,
+		SceneDiffuseMatIndex:  sc.SceneDiffuseMatIndex,
+		SceneEmissiveMatIndex: sc.SceneEmissiveMatIndex,
+		AllDiffuse:            sc.AllDiffuse,
+		EpsilonOverride:       sc.IntersectionEpsilonOverride,
+		Camera:                sc.Camera,
+		Medium:                sc.Medium,
+		Dome:                  sc.Dome,
+		Metadata:              sc.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Calculate section offsets
+	header := mappedHeader{
+		Magic:   mappedMagic,
+		Version: mappedVersion,
+	}
+	if sc.HasMotion() {
+		header.Flags |= mappedHasMotion
+	}
+	sections := sc.mappedSections()
+	offset := alignMapped(uint64(binary.Size(header)))
+	for index, slicePtr := range sections {
+		v := reflect.ValueOf(slicePtr).Elem()
+		header.Sections[index] = mappedSection{
+			Offset:   offset,
+			Count:    uint64(v.Len()),
+			ElemSize: uint64(v.Type().Elem().Size()),
+		}
+		offset = alignMapped(offset + uint64(v.Len())*uint64(v.Type().Elem().Size()))
+	}
+	header.PropertiesOffset = offset
+	header.PropertiesLen = uint64(props.Len())
+
+	bw := bufio.NewWriter(w)
+	err = binary.Write(bw, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+
+	written := uint64(binary.Size(header))
+	for index, slicePtr := range sections {
+		err = writeMappedPadding(bw, header.Sections[index].Offset-written)
+		if err != nil {
+			return err
+		}
+		data := sliceBytes(reflect.ValueOf(slicePtr).Elem())
+		_, err = bw.Write(data)
+		if err != nil {
+			return err
+		}
+		written = header.Sections[index].Offset + uint64(len(data))
+	}
+
+	err = writeMappedPadding(bw, header.PropertiesOffset-written)
+	if err != nil {
+		return err
+	}
+	_, err = bw.Write(props.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Load a scene serialized by Save or WriteMapped from r. Unlike OpenMapped,
+// the scene arrays are copied into memory owned by the returned scene.
+func Load(r io.Reader) (*Scene, error) {
+	if !hostIsLittleEndian() {
+		return nil, fmt.Errorf("load: mapped scenes are only supported on little-endian hosts")
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("load: %s", err.Error())
+	}
+
+	sc := &Scene{}
+	err = decodeMapped(sc, data, false)
+	if err != nil {
+		return nil, fmt.Errorf("load: %s", err.Error())
+	}
+
+	return sc, nil
+}
+
+// Memory-map a scene file written by WriteMapped and return a scene whose
+// flat arrays alias the mapped file contents. The caller must invoke Close
+// to release the mapping once the scene is no longer needed.
+func OpenMapped(path string) (*MappedScene, error) {
+	if !hostIsLittleEndian() {
+		return nil, fmt.Errorf("openMapped: mapped scenes are only supported on little-endian hosts")
+	}
+
+	data, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := &MappedScene{
+		Scene:   &Scene{},
+		mapping: data,
+	}
+	err = ms.alias()
+	if err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("openMapped: %s: %s", path, err.Error())
+	}
+
+	return ms, nil
+}
+
+// Unmap the scene file. After a call to Close the scene arrays are reset to nil.
+func (ms *MappedScene) Close() error {
+	if ms.mapping == nil {
+		return nil
+	}
+
+	for _, slicePtr := range ms.Scene.mappedSections() {
+		v := reflect.ValueOf(slicePtr).Elem()
+		v.Set(reflect.Zero(v.Type()))
+	}
+
+	err := unmapFile(ms.mapping)
+	ms.mapping = nil
+	return err
+}
+
+// Parse the mapped file header, point the scene arrays to the mapped data and
+// decode the remaining scene properties.
+func (ms *MappedScene) alias() error {
+	return decodeMapped(ms.Scene, ms.mapping, true)
+}
+
+// Decode a scene encoded using the mapped scene format. If alias is true, the
+// scene arrays point directly to data; otherwise, the array contents are
+// copied into newly allocated slices.
+func decodeMapped(sc *Scene, data []byte, alias bool) error {
+	header, headerLen, err := readMappedHeader(data)
+	if err != nil {
+		return err
+	}
+	dataLen := uint64(len(data))
+
+	for index, slicePtr := range sc.mappedSections() {
+		if index == mappedMotionSection && header.Flags&mappedHasMotion == 0 {
+			continue
+		}
+
+		section := header.Sections[index]
+		v := reflect.ValueOf(slicePtr).Elem()
+		elemSize := uint64(v.Type().Elem().Size())
+		switch {
+		case section.ElemSize != elemSize:
+			return fmt.Errorf("section %d element size mismatch; expected %d; got %d", index, elemSize, section.ElemSize)
+		case section.Offset%mappedAlignment != 0:
+			return fmt.Errorf("section %d offset %d is not aligned on a %d byte boundary", index, section.Offset, mappedAlignment)
+		case section.Offset < headerLen || section.Offset > dataLen || section.Count > (dataLen-section.Offset)/elemSize:
+			return fmt.Errorf("section %d is out of bounds", index)
+		case section.Count == 0:
+			continue
+		}
+
+		if !alias {
+			v.Set(reflect.MakeSlice(v.Type(), int(section.Count), int(section.Count)))
+			copy(sliceBytes(v), data[section.Offset:section.Offset+section.Count*elemSize])
+			continue
+		}
+
+		sliceHeader := (*reflect.SliceHeader)(unsafe.Pointer(v.UnsafeAddr()))
+		sliceHeader.Data = uintptr(unsafe.Pointer(&data[section.Offset]))
+		sliceHeader.Len = int(section.Count)
+		sliceHeader.Cap = int(section.Count)
+	}
+
+	if header.Flags&mappedHasMotion != 0 && len(sc.InstanceMotion) != len(sc.MeshInstanceList) {
+		return fmt.Errorf("expected motion transforms for %d mesh instances; got %d", len(sc.MeshInstanceList), len(sc.InstanceMotion))
+	}
+
+	for index, mi := range sc.MeshInstanceList {
+		if uint64(mi.AttributeOffset)+uint64(mi.AttributeCount) > uint64(len(sc.InstanceAttributeList)) {
+			return fmt.Errorf("mesh instance %d attributes are out of bounds", index)
+		}
+	}
+
+	err = validateTextureMetadata(sc.TextureMetadata, len(sc.TextureData))
+	if err != nil {
+		return err
+	}
+
+	if header.PropertiesOffset > dataLen || header.PropertiesLen > dataLen-header.PropertiesOffset {
+		return fmt.Errorf("scene properties are out of bounds")
+	}
+	var props mappedProperties
+	err = gob.NewDecoder(
+		bytes.NewReader(data[header.PropertiesOffset : header.PropertiesOffset+header.PropertiesLen]),
+	).Decode(&props)
+	if err != nil {
+		return err
+	}
+
+	sc.MeshRanges = props.MeshRanges
+	sc.MaterialRoots = props.MaterialRoots
+	sc.SceneDiffuseMatIndex = props.SceneDiffuseMatIndex
+	sc.SceneEmissiveMatIndex = props.SceneEmissiveMatIndex
+	sc.AllDiffuse = props.AllDiffuse
+	sc.IntersectionEpsilonOverride = props.EpsilonOverride
+	sc.Camera = props.Camera
+	sc.Medium = props.Medium
+	sc.Dome = props.Dome
+	sc.Metadata = props.Metadata
+	return nil
+}
+
+// Ensure that the texture data referenced by each texture metadata entry lies
+// within the bounds of the texture data array.
+func validateTextureMetadata(metadata []TextureMetadata, dataLen int) error {
+	for index, meta := range metadata {
+		end := uint64(meta.DataOffset) + meta.DataSize()
+		if uint64(meta.DataOffset) > uint64(dataLen) || end > uint64(dataLen) {
+			return fmt.Errorf("texture %d data is out of bounds", index)
+		}
+		if meta.MipLevelCount > MaxMipLevels {
+			return fmt.Errorf("texture %d contains %d mip levels; expected at most %d", index, meta.MipLevelCount, MaxMipLevels)
+		}
+	}
+	return nil
+}
+
+// Parse the mapped file header and return it together with its encoded length.
+func readMappedHeader(data []byte) (mappedHeader, uint64, error) {
+	var header mappedHeader
+
+	headerLen := uint64(binary.Size(header))
+	if uint64(len(data)) < headerLen {
+		return header, 0, fmt.Errorf("truncated header")
+	}
+	if !bytes.Equal(data[:8], mappedMagic[:]) {
+		return header, 0, fmt.Errorf("not a mapped scene file")
+	}
+	if version := binary.LittleEndian.Uint32(data[8:12]); version != mappedVersion {
+		return header, 0, fmt.Errorf("unsupported mapped scene version %d; expected %d", version, mappedVersion)
+	}
+
+	err := binary.Read(bytes.NewReader(data[:headerLen]), binary.LittleEndian, &header)
+	if err != nil {
+		return header, 0, err
+	}
+
+	return header, headerLen, nil
+}
+
+// Get pointers to the flat scene arrays in the order they appear inside
+// mapped scene files.
+func (sc *Scene) mappedSections() [mappedSections]interface{} {
+	return [mappedSections]interface{}{
+		&sc.BvhNodeList,
+		&sc.MeshInstanceList,
+		&sc.MaterialNodeList,
+		&sc.EmissivePrimitives,
+		&sc.TextureData,
+		&sc.TextureMetadata,
+		&sc.VertexList,
+		&sc.NormalList,
+		&sc.UvList,
+		&sc.MaterialIndex,
+		&sc.InstanceMotion,
+		&sc.PrimitiveOpacity,
+		&sc.InstanceAttributeList,
+		&sc.TangentList,
+		&sc.IndexList,
+	}
+}
+
+// Get a byte slice that aliases the memory backing a slice value.
+func sliceBytes(v reflect.Value) []byte {
+	if v.Len() == 0 {
+		return nil
+	}
+
+	var data []byte
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&data))
+	header.Data = v.Pointer()
+	header.Len = v.Len() * int(v.Type().Elem().Size())
+	header.Cap = header.Len
+	return data
+}
+
+// Write count zero bytes.
+func writeMappedPadding(w io.Writer, count uint64) error {
+	if count == 0 {
+		return nil
+	}
+	_, err := w.Write(make([]byte, count))
+	return err
+}
+
+// Round value up to the next multiple of mappedAlignment.
+func alignMapped(value uint64) uint64 {
+	return (value + mappedAlignment - 1) &^ (mappedAlignment - 1)
+}
+
+// Check if the host uses little-endian byte order.
+func hostIsLittleEndian() bool {
+	var probe uint16 = 1
+	return *(*byte)(unsafe.Pointer(&probe)) == 1
+}
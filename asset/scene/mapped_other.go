@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package scene
+
+import "io/ioutil"
+
+// On platforms without mmap support the file contents are read into memory.
+func mapFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+// Release a buffer created by mapFile.
+func unmapFile(data []byte) error {
+	return nil
+}
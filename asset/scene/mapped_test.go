@@ -0,0 +1,322 @@
+package scene_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/scene/reader"
+	"github.com/achilleasa/polaris/asset/scene/writer"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMappedSceneMatchesLoadedScene(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-mapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zipFile := filepath.Join(dir, "scene.zip")
+	mappedFile := filepath.Join(dir, "scene.bin")
+
+	sc := mappedTestScene()
+	if err = writer.WriteScene(sc, zipFile); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.WriteMapped(mappedFile, sc); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := reader.ReadScene(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms, err := scene.OpenMapped(mappedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ms.Scene, loaded) {
+		t.Fatalf("expected mapped scene to match the loaded scene\nmapped: %+v\nloaded: %+v", ms.Scene, loaded)
+	}
+
+	// Flat arrays should be aligned for direct aliasing
+	if addr := reflect.ValueOf(ms.VertexList).Pointer(); addr%16 != 0 {
+		t.Fatalf("expected mapped vertex list to be aligned on a 16 byte boundary; got address 0x%x", addr)
+	}
+
+	if err = ms.Close(); err != nil {
+		t.Fatalf("expected Close to unmap the scene file; got %v", err)
+	}
+	if ms.VertexList != nil || ms.BvhNodeList != nil || ms.TextureData != nil {
+		t.Fatal("expected scene arrays to be reset after Close")
+	}
+	if err = ms.Close(); err != nil {
+		t.Fatalf("expected a second Close to be a no-op; got %v", err)
+	}
+}
+
+func TestMotionTransformsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-mapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zipFile := filepath.Join(dir, "scene.zip")
+	mappedFile := filepath.Join(dir, "scene.bin")
+
+	start := types.Ident4()
+	end := types.Ident4()
+	end[12], end[13], end[14] = 2, -1, 0.5
+
+	sc := mappedTestScene()
+	sc.InstanceMotion = []scene.InstanceMotion{scene.NewInstanceMotion(start, end)}
+	if err = writer.WriteScene(sc, zipFile); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.WriteMapped(mappedFile, sc); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := reader.ReadScene(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := scene.OpenMapped(mappedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ms.Close()
+
+	expMotion := sc.InstanceMotion[0]
+	for _, loadedScene := range []*scene.Scene{loaded, ms.Scene} {
+		if !loadedScene.HasMotion() || len(loadedScene.InstanceMotion) != 1 {
+			t.Fatalf("expected loaded scene to contain motion transforms for 1 instance; got %d", len(loadedScene.InstanceMotion))
+		}
+		motion := loadedScene.InstanceMotion[0]
+		if motion.Start != start || motion.End != end {
+			t.Fatalf("expected start/end transforms to be %v/%v; got %v/%v", start, end, motion.Start, motion.End)
+		}
+		if motion.InvStart != expMotion.InvStart || motion.InvEnd != expMotion.InvEnd {
+			t.Fatalf("expected inverse start/end transforms to be %v/%v; got %v/%v", expMotion.InvStart, expMotion.InvEnd, motion.InvStart, motion.InvEnd)
+		}
+	}
+
+	// Scenes without motion should not report motion transforms
+	if mappedTestScene().HasMotion() {
+		t.Fatal("expected scene without motion transforms to report no motion")
+	}
+}
+
+func TestLoadSkipsMotionSectionWithoutMotionFlag(t *testing.T) {
+	sc := mappedTestScene()
+	sc.InstanceMotion = []scene.InstanceMotion{scene.NewInstanceMotion(types.Ident4(), types.Ident4())}
+
+	var buf bytes.Buffer
+	if err := sc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flags field follows the version field
+	data := buf.Bytes()
+	if flags := binary.LittleEndian.Uint32(data[12:16]); flags != 1 {
+		t.Fatalf("expected the motion flag to be set for a scene with motion transforms; got flags 0x%x", flags)
+	}
+	binary.LittleEndian.PutUint32(data[12:16], 0)
+
+	loaded, err := scene.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.HasMotion() {
+		t.Fatalf("expected motion section to be ignored when the motion flag is not set; got %d motion transforms", len(loaded.InstanceMotion))
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-mapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	zipFile := filepath.Join(dir, "scene.zip")
+	mappedFile := filepath.Join(dir, "scene.bin")
+
+	expMetadata := scene.Metadata{
+		Name:    "test scene",
+		Author:  "polaris",
+		Units:   "meters",
+		Created: "2016-05-14",
+	}
+	sc := mappedTestScene()
+	sc.Metadata = expMetadata
+
+	if err = writer.WriteScene(sc, zipFile); err != nil {
+		t.Fatal(err)
+	}
+	if err = scene.WriteMapped(mappedFile, sc); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = sc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := reader.ReadScene(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := scene.OpenMapped(mappedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ms.Close()
+	saved, err := scene.Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, loadedScene := range []*scene.Scene{loaded, ms.Scene, saved} {
+		if loadedScene.Metadata != expMetadata {
+			t.Fatalf("[scene %d] expected loaded metadata to be %+v; got %+v", index, expMetadata, loadedScene.Metadata)
+		}
+	}
+
+	if !mappedTestScene().Metadata.IsEmpty() {
+		t.Fatal("expected scene without metadata to report empty metadata")
+	}
+}
+
+func TestOpenMappedRejectsUnknownFormat(t *testing.T) {
+	f, err := ioutil.TempFile("", "polaris-mapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(make([]byte, 512))
+	f.Close()
+
+	_, err = scene.OpenMapped(f.Name())
+	expError := "openMapped: " + f.Name() + ": not a mapped scene file"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	sc := mappedTestScene()
+
+	var buf bytes.Buffer
+	if err := sc.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := scene.Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded, sc) {
+		t.Fatalf("expected loaded scene to match the saved scene\nloaded: %+v\nsaved: %+v", loaded, sc)
+	}
+
+	// Loaded arrays must not alias the serialized data
+	data := buf.Bytes()
+	for i := range data {
+		data[i] = 0
+	}
+	if loaded.VertexList[1][0] != 1 {
+		t.Fatal("expected loaded scene arrays to be copied from the serialized data")
+	}
+}
+
+func TestLoadRejectsUnknownVersion(t *testing.T) {
+	var buf bytes.Buffer
+	if err := mappedTestScene().Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The version field follows the 8 byte magic header
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[8:12], 42)
+
+	_, err := scene.Load(bytes.NewReader(data))
+	expError := "load: unsupported mapped scene version 42; expected 2"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestLoadRejectsOutOfBoundsTextures(t *testing.T) {
+	specs := []scene.TextureMetadata{
+		{Width: 1, Height: 2, DataOffset: 12, Layers: 1, LayerStride: 8},
+		{Width: 1, Height: 2, DataOffset: 4, Layers: 1, LayerStride: 8},
+		{Width: 1, Height: 1, DataOffset: 0, Layers: 3, LayerStride: 4},
+	}
+
+	for specIndex, meta := range specs {
+		sc := mappedTestScene()
+		sc.TextureMetadata[0] = meta
+
+		var buf bytes.Buffer
+		if err := sc.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := scene.Load(&buf)
+		expError := "load: texture 0 data is out of bounds"
+		if err == nil || err.Error() != expError {
+			t.Fatalf("[spec %d] expected error %q; got %v", specIndex, expError, err)
+		}
+	}
+}
+
+func mappedTestScene() *scene.Scene {
+	sc := &scene.Scene{
+		BvhNodeList: []scene.BvhNode{
+			{Min: types.Vec3{-1, -1, -1}, LData: 0, Max: types.Vec3{1, 1, 1}, RData: 1},
+		},
+		MeshInstanceList: []scene.MeshInstance{
+			{MeshIndex: 0, BvhRoot: 0, Transform: types.Ident4(), Tint: types.Vec4{1, 0.5, 0.25, 0}},
+		},
+		MaterialNodeList: []scene.MaterialNode{
+			{Union1: [4]int32{1, -1, -1, -1}, Union2: types.Vec4{0.8, 0.8, 0.8, 0}, Union4: types.Vec3{1, 1, 0.2}},
+		},
+		EmissivePrimitives: []scene.EmissivePrimitive{
+			{Transform: types.Ident4(), Area: 0.5, PrimitiveIndex: 0, MaterialNodeIndex: 0, Type: scene.AreaLight},
+		},
+		TextureData: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		TextureMetadata: []scene.TextureMetadata{
+			{Width: 1, Height: 2, DataOffset: 0, Layers: 1, LayerStride: 8, Anisotropy: 4},
+		},
+		VertexList:    []types.Vec4{{0, 0, 0, 1}, {1, 0, 0, 1}, {0, 1, 0, 1}},
+		NormalList:    []types.Vec4{{0, 0, 1, 0}, {0, 0, 1, 0}, {0, 0, 1, 1}},
+		UvList:        []types.Vec2{{0, 0}, {1, 0}, {0, 1}},
+		TangentList:   []types.Vec4{{1, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, -1}},
+		IndexList:     []uint32{0, 1, 2},
+		MaterialIndex: []uint32{0},
+		MeshRanges: []scene.MeshRange{
+			{BvhRoot: 0, BvhNodeCount: 1, FirstPrimitive: 0, PrimitiveCount: 1, FlatShading: true},
+		},
+		MaterialRoots:               []int32{0},
+		SceneDiffuseMatIndex:        -1,
+		SceneEmissiveMatIndex:       -1,
+		IntersectionEpsilonOverride: 1e-4,
+		Camera:                      scene.NewCamera(45),
+		Medium:                      scene.Medium{Extinction: 0.1, Albedo: types.Vec3{0.9, 0.9, 0.9}, G: 0.3},
+		Dome:                        scene.Dome{Radius: 20, GroundHeight: -1.5},
+	}
+	sc.Camera.Position = types.Vec3{0, 0, 5}
+	sc.Camera.Update()
+
+	return sc
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package scene
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Map the contents of a file into memory. The mapping is private so writes to
+// the mapped memory trigger a copy-on-write and never reach the file.
+func mapFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil, fmt.Errorf("mapFile: %s is empty", path)
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("mapFile: %s is too large to be mapped", path)
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
+
+// Release a mapping created by mapFile.
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,21 @@
+package scene
+
+import "github.com/achilleasa/polaris/types"
+
+// A homogeneous participating medium (fog) that fills the scene.
+type Medium struct {
+	// The extinction coefficient (absorption + scattering) per unit of
+	// distance. A zero value disables the medium.
+	Extinction float32
+
+	// The ratio of scattering to extinction for each color channel.
+	Albedo types.Vec3
+
+	// The Henyey-Greenstein asymmetry parameter in the [-1, 1] range.
+	G float32
+}
+
+// Check if the medium affects light transport.
+func (m *Medium) Enabled() bool {
+	return m.Extinction > 0
+}
@@ -0,0 +1,23 @@
+package scene
+
+// Metadata contains non-rendering information about a scene that is used for
+// asset management and pipeline bookkeeping. Importers populate the fields
+// that are available in the source scene; all fields are otherwise empty.
+type Metadata struct {
+	// The scene name.
+	Name string `json:"name"`
+
+	// The scene author.
+	Author string `json:"author"`
+
+	// The units (e.g. meters) used by the scene source files.
+	Units string `json:"units"`
+
+	// The scene creation date as specified in the source scene.
+	Created string `json:"created"`
+}
+
+// Check if no metadata fields have been populated.
+func (m Metadata) IsEmpty() bool {
+	return m == Metadata{}
+}
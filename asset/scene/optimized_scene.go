@@ -3,9 +3,12 @@ package scene
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"strings"
 
+	"github.com/achilleasa/polaris/asset/material"
 	"github.com/achilleasa/polaris/asset/texure"
 	"github.com/achilleasa/polaris/types"
 	"github.com/olekukonko/tablewriter"
@@ -16,7 +19,9 @@ import (
 //
 // - For non-leaf nodes (top/bottom) BVH they are both >0 and point to the L/R child nodes
 // - For top BVH leafs:
-//   - left W is <= 0 and points to the mesh instance index
+//   - left W is <= 0 and points to the first mesh instance index
+//   - right W is <= 0 and contains the negated count of additional leaf
+//     mesh instances; leafs may reference a contiguous range of instances
 // - For bottom BVH leafs:
 //   - left W is <= 0 and point to the first triangle primitive index
 //   - right W is >0 and contains the count of leaf primitives
@@ -36,6 +41,11 @@ func (n *BvhNode) SetBBox(bbox [2]types.Vec3) {
 	n.Max = bbox[1]
 }
 
+// Get bounding box.
+func (n *BvhNode) GetBBox() [2]types.Vec3 {
+	return [2]types.Vec3{n.Min, n.Max}
+}
+
 // Set left and right child node indices.
 func (n *BvhNode) SetChildNodes(left, right uint32) {
 	n.LData = int32(left)
@@ -52,6 +62,18 @@ func (n *BvhNode) GetMeshIndex() (index uint32) {
 	return uint32(-n.LData)
 }
 
+// Set the first mesh instance index and count for a top BVH leaf that
+// references a contiguous range of mesh instances.
+func (n *BvhNode) SetMeshInstances(firstIndex, count uint32) {
+	n.LData = -int32(firstIndex)
+	n.RData = 1 - int32(count)
+}
+
+// Get the first mesh instance index and count for a top BVH leaf.
+func (n *BvhNode) GetMeshInstances() (firstIndex, count uint32) {
+	return uint32(-n.LData), uint32(1 - n.RData)
+}
+
 // Set primitive index and count.
 func (n *BvhNode) SetPrimitives(firstPrimIndex, count uint32) {
 	n.LData = -int32(firstPrimIndex)
@@ -83,30 +105,69 @@ type MaterialNode struct {
 	// Layout:
 	// [0] type
 	// [1] left child
-	// [2] right child or transmittance texture
-	// [3] bump map, reflectance, specularity or radiance texture
+	// [2] right child, transmittance texture or normal map base flag
+	// [3] bump map, mix weight, reflectance, specularity, radiance or scatter color texture
 	Union1 [4]int32
 
 	// Layout:
-	// [0-3] reflectance or specularity or radiance
+	// [0-3] reflectance or specularity or radiance or scatter color
 	// [0-3] RGB intIORs for dispersion
 	// [0] mix weight
 	Union2 types.Vec4
 
 	// Layout:
 	// [0-3] transmittance
+	// [0-3] indirect reflectance for diffuse bxdfs
+	// [0-3] per-channel scatter radius for subsurface bxdfs
 	// [0-3] RGB extIORs for dispersion
+	// [0] bi-tangent roughness for anisotropic bxdfs
 	Union3 types.Vec4
 
 	// Layout:
 	// [0] internal IOR
 	// [1] external IOR
-	// [2] roughness or radiance scaler
+	// [2] roughness (tangent roughness for anisotropic bxdfs), radiance scaler
+	//     or scattering anisotropy for subsurface bxdfs
 	Union4 types.Vec3
 
 	// Layout:
 	// [0] roughness texture
 	Union5 [1]int32
+
+	// Layout:
+	// [0] internal IOR texture
+	// [1] external IOR texture
+	// [2] indirect reflectance texture for diffuse bxdfs
+	// [3] padding
+	Union6 [4]int32
+}
+
+// Create a mix operator node that blends the left and right child nodes using
+// the supplied weight. If weightTex is not -1, the weight is modulated by the
+// value sampled from the weight texture.
+func NewMixNode(left, right uint32, weight float32, weightTex int32) MaterialNode {
+	return MaterialNode{
+		Union1: [4]int32{int32(material.OpMix), int32(left), int32(right), weightTex},
+		Union2: types.Vec4{weight, 0, 0, 0},
+		Union5: [1]int32{-1},
+		Union6: [4]int32{-1, -1, 0, 0},
+	}
+}
+
+// The value of the normal map base flag for normal map operator nodes that
+// perturb the geometric normal instead of the interpolated vertex normals.
+const NormalMapFlatBase int32 = 1
+
+// Create a fresnel blend operator node that selects between the left (coat)
+// and right (base) child nodes using the fresnel reflectance of a dielectric
+// interface with the supplied IOR. The external IOR is set to the IOR of air.
+func NewFresnelBlendNode(left, right uint32, ior float32) MaterialNode {
+	return MaterialNode{
+		Union1: [4]int32{int32(material.OpFresnelBlend), int32(left), int32(right), -1},
+		Union4: types.Vec3{ior, material.DefaultExtIOR, 0},
+		Union5: [1]int32{-1},
+		Union6: [4]int32{-1, -1, 0, 0},
+	}
 }
 
 // The type of an emissive primitive.
@@ -115,12 +176,18 @@ type EmissivePrimitiveType uint32
 const (
 	AreaLight EmissivePrimitiveType = iota
 	EnvironmentLight
+
+	// An analytic light that is sampled as a sphere. Sphere lights are
+	// not part of the scene geometry so they are only reachable via
+	// emissive sampling. A zero radius describes a point light.
+	SphereLight
 )
 
 // An emissive primitive.
 type EmissivePrimitive struct {
 	// A transformation matrix for converting the primitive vertices from
-	// local space to world space.
+	// local space to world space. For sphere lights, it maps the unit
+	// sphere to the light sphere in world space.
 	Transform types.Mat4
 
 	// The area of the emissive primitive.
@@ -145,13 +212,74 @@ type MeshInstance struct {
 	// instances of the same mesh.
 	BvhRoot uint32
 
-	padding [2]uint32
+	// The offset to the first instance attribute in the scene's instance
+	// attribute list and the number of instance attributes.
+	AttributeOffset uint32
+	AttributeCount  uint32
 
 	// A transformation matrix for positioning the mesh.
 	Transform types.Mat4
+
+	// A color tint (xyz) multiplied into the base albedo of the instance
+	// surfaces. The w coordinate is unused.
+	Tint types.Vec4
+}
+
+// The transforms of a motion-blurred mesh instance at the start and end of
+// the camera shutter interval together with their inverses.
+type InstanceMotion struct {
+	Start    types.Mat4
+	End      types.Mat4
+	InvStart types.Mat4
+	InvEnd   types.Mat4
+}
+
+// Create the motion transforms for a mesh instance that moves from the start
+// to the end transform while the camera shutter is open.
+func NewInstanceMotion(start, end types.Mat4) InstanceMotion {
+	return InstanceMotion{
+		Start:    start,
+		End:      end,
+		InvStart: start.Inv(),
+		InvEnd:   end.Inv(),
+	}
+}
+
+// The location of a mesh's BVH nodes and primitives inside the scene's flat
+// BVH node and primitive lists.
+type MeshRange struct {
+	// The index of the mesh BVH root and the number of BVH nodes.
+	BvhRoot      uint32
+	BvhNodeCount uint32
+
+	// The index of the first mesh primitive and the number of primitives.
+	FirstPrimitive uint32
+	PrimitiveCount uint32
+
+	// True if all primitive vertices use the geometric normal.
+	FlatShading bool
+
+	// The index of the logical mesh that this range belongs to and its
+	// level of detail. For LOD 0 ranges, BaseMesh equals the range index.
+	BaseMesh uint32
+	LOD      uint32
 }
 
 // The texture metadata. All texture data is stored as a contiguous memory block.
+// The max number of mipmap levels that can be stored for a texture.
+const MaxMipLevels = 16
+
+// The location and dimensions of a texture mipmap level.
+type MipLevel struct {
+	// Offset to the beginning of the level data relative to the beginning
+	// of the texture (array layer) data.
+	Offset uint32
+
+	// Level dimensions.
+	Width  uint32
+	Height uint32
+}
+
 type TextureMetadata struct {
 	// Texture format.
 	Format texture.Format
@@ -162,6 +290,50 @@ type TextureMetadata struct {
 
 	// Offset to the beginning of texture data
 	DataOffset uint32
+
+	// Number of layers for texture arrays (1 for regular textures). The
+	// layers of a texture array share the same format and dimensions and
+	// are stored contiguously starting at DataOffset.
+	Layers uint32
+
+	// Distance in bytes between the start of two consecutive layers.
+	LayerStride uint32
+
+	// Anisotropic filtering level hint (1 = isotropic filtering). Samplers
+	// that support anisotropic filtering may use up to this many taps.
+	Anisotropy uint32
+
+	// The addressing mode for uv coordinates outside the [0, 1] range.
+	WrapMode texture.WrapMode
+
+	// Non-zero if the color channels of the stored data are sRGB encoded
+	// and must be linearized by the samplers. The compiler linearizes sRGB
+	// textures while baking them so their stored data is already linear.
+	SRGB uint32
+
+	// The number of mipmap levels and their locations. Level 0 is the
+	// full resolution texture and always starts at offset 0. The levels
+	// of each texture array layer are stored back-to-back and are
+	// included in the layer stride.
+	MipLevelCount uint32
+	MipLevels     [MaxMipLevels]MipLevel
+}
+
+// Get the offset to the beginning of the data for a texture array layer.
+func (tm *TextureMetadata) LayerOffset(layer uint32) uint32 {
+	return tm.DataOffset + layer*tm.LayerStride
+}
+
+// Get the offset to the beginning of the data for a mipmap level of a
+// texture array layer.
+func (tm *TextureMetadata) MipLevelOffset(layer, level uint32) uint32 {
+	return tm.LayerOffset(layer) + tm.MipLevels[level].Offset
+}
+
+// Get the size in bytes of the texture data including all layers and mipmap
+// levels.
+func (tm *TextureMetadata) DataSize() uint64 {
+	return uint64(tm.Layers) * uint64(tm.LayerStride)
 }
 
 type Scene struct {
@@ -170,23 +342,222 @@ type Scene struct {
 	MaterialNodeList   []MaterialNode
 	EmissivePrimitives []EmissivePrimitive
 
+	// Optional motion transforms for each entry in MeshInstanceList. This
+	// list is empty if the scene does not contain motion-blurred instances.
+	InstanceMotion []InstanceMotion
+
+	// The custom scalar attributes of all mesh instances. Each mesh instance
+	// references a contiguous range of this list.
+	InstanceAttributeList []float32
+
 	// Texture definitions and the associated data.
 	TextureData     []byte
 	TextureMetadata []TextureMetadata
 
-	// Primitives are stored as an array of structs.
+	// Primitives are stored as an array of structs. The w coordinates of
+	// the three vertex normals of each primitive store the x, y and z
+	// components of the primitive's geometric normal. For indexed scenes,
+	// these lists only store the unique vertices; see IndexList.
 	VertexList    []types.Vec4
 	NormalList    []types.Vec4
 	UvList        []types.Vec2
 	MaterialIndex []uint32
 
+	// The tangent vector of each primitive vertex. Tangents are aligned to
+	// the direction of increasing u texture coordinates and are
+	// orthonormal to the vertex normals. The w coordinate stores the
+	// handedness (+1 or -1) of the tangent frame so the bitangent can be
+	// reconstructed as w * cross(normal, tangent). This list is parallel to
+	// the VertexList and is empty for scenes compiled without tangents.
+	TangentList []types.Vec4
+
+	// The vertex indices of each primitive for scenes compiled with vertex
+	// indexing. If non-empty, each primitive references its three vertices
+	// via the entries at 3*primIndex to 3*primIndex+2 and the vertex lists
+	// only store the unique vertices. The vertex normal w coordinates are
+	// unused; instead, the primitive vertices are ordered so that the
+	// geometric normal is given by cross(v1-v0, v2-v0). This list is
+	// empty for scenes using the non-indexed layout.
+	IndexList []uint32
+
+	// The opacity of each primitive quantized to the [0, 255] range where
+	// 255 denotes a fully opaque primitive. This list is parallel to the
+	// MaterialIndex list and is empty if all scene primitives are opaque.
+	PrimitiveOpacity []uint8
+
+	// The BVH node and primitive ranges for each mesh.
+	MeshRanges []MeshRange
+
+	// The material tree root for each parsed material index or -1 if
+	// the material was not referenced by the scene geometry.
+	MaterialRoots []int32
+
 	// Indices to material nodes used for storing the scene global
 	// properties such as diffuse and emissive colors.
 	SceneDiffuseMatIndex  int32
 	SceneEmissiveMatIndex int32
 
+	// True if all scene surfaces use pure diffuse (lambertian) or emissive
+	// bxdfs. Tracers may use this flag to select a faster shading path.
+	AllDiffuse bool
+
+	// If non-zero, this value overrides the intersection epsilon that is
+	// derived from the scene bounds. See IntersectionEpsilon.
+	IntersectionEpsilonOverride float32
+
 	// The scene camera.
 	Camera *Camera
+
+	// Scene participating medium.
+	Medium Medium
+
+	// Background dome projection.
+	Dome Dome
+
+	// Scene metadata that does not affect rendering.
+	Metadata Metadata
+}
+
+// Get the world-space bounds of the scene geometry. The bounds are given by
+// the bounding box of the top-level BVH root node. If the scene contains no
+// mesh instances, this method returns an empty box whose min corner is
+// greater than its max corner.
+func (sc *Scene) Bounds() (min, max types.Vec3) {
+	if len(sc.MeshInstanceList) == 0 || len(sc.BvhNodeList) == 0 {
+		return types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+			types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	}
+
+	bbox := sc.BvhNodeList[0].GetBBox()
+	return bbox[0], bbox[1]
+}
+
+// Check whether the scene uses the indexed vertex layout.
+func (sc *Scene) IsIndexed() bool {
+	return len(sc.IndexList) != 0
+}
+
+// Get the index of a primitive vertex in the vertex lists. The corner
+// argument selects one of the three primitive vertices.
+func (sc *Scene) VertexIndex(primIndex, corner uint32) uint32 {
+	if sc.IsIndexed() {
+		return sc.IndexList[3*primIndex+corner]
+	}
+	return 3*primIndex + corner
+}
+
+// Get the geometric normal of a primitive. Unlike the interpolated shading
+// normals, the geometric normal is constant across the primitive surface.
+func (sc *Scene) GeometricNormal(primIndex uint32) types.Vec3 {
+	if sc.IsIndexed() {
+		v0 := sc.VertexList[sc.VertexIndex(primIndex, 0)].Vec3()
+		v1 := sc.VertexList[sc.VertexIndex(primIndex, 1)].Vec3()
+		v2 := sc.VertexList[sc.VertexIndex(primIndex, 2)].Vec3()
+		return v1.Sub(v0).Cross(v2.Sub(v0)).Normalize()
+	}
+
+	offset := 3 * primIndex
+	return types.Vec3{
+		sc.NormalList[offset+0][3],
+		sc.NormalList[offset+1][3],
+		sc.NormalList[offset+2][3],
+	}
+}
+
+// Get the surface UV at a point inside a primitive given its barycentric
+// coordinates (w, u, v).
+func (sc *Scene) InterpolatedUV(primIndex uint32, barycentric types.Vec3) types.Vec2 {
+	return types.BarycentricVec2(
+		sc.UvList[sc.VertexIndex(primIndex, 0)],
+		sc.UvList[sc.VertexIndex(primIndex, 1)],
+		sc.UvList[sc.VertexIndex(primIndex, 2)],
+		barycentric[0], barycentric[1], barycentric[2],
+	)
+}
+
+// Check whether a ray travelling along rayDir hits the front face of a
+// primitive. The front face is the side that the geometric normal points to.
+func (sc *Scene) IsFrontFace(primIndex uint32, rayDir types.Vec3) bool {
+	return sc.GeometricNormal(primIndex).Dot(rayDir) < 0
+}
+
+// Get the opacity of a primitive in the [0, 1] range. Primitives are fully
+// opaque unless the scene defines per-primitive opacity values.
+func (sc *Scene) Opacity(primIndex uint32) float32 {
+	if len(sc.PrimitiveOpacity) == 0 {
+		return 1
+	}
+	return float32(sc.PrimitiveOpacity[primIndex]) / 255
+}
+
+// Get the custom scalar attributes for a mesh instance. The returned slice
+// aliases the scene's instance attribute list and is empty if the instance
+// does not define any attributes.
+func (sc *Scene) InstanceAttributes(instanceIndex uint32) []float32 {
+	mi := sc.MeshInstanceList[instanceIndex]
+	if mi.AttributeCount == 0 {
+		return nil
+	}
+	return sc.InstanceAttributeList[mi.AttributeOffset : mi.AttributeOffset+mi.AttributeCount]
+}
+
+// Get the radiance emitted by an emissive primitive. The radiance of the
+// emissive material node is multiplied by its radiance scaler. If the node
+// reads its radiance from a texture, the default radiance is scaled instead.
+func (sc *Scene) EmissiveRadiance(emissiveIndex uint32) types.Vec3 {
+	node := sc.MaterialNodeList[sc.EmissivePrimitives[emissiveIndex].MaterialNodeIndex]
+	return node.Union2.Vec3().Mul(node.Union4[2])
+}
+
+// Check whether the scene defines motion transforms for its mesh instances.
+func (sc *Scene) HasMotion() bool {
+	return len(sc.InstanceMotion) != 0
+}
+
+// Get the index of the mesh range that stores the requested level of detail
+// for a logical mesh or -1 if no such range exists. The ranges for the base
+// meshes always precede the LOD ranges and share the logical mesh index.
+func (sc *Scene) MeshLOD(meshIndex, lod uint32) int {
+	if int(meshIndex) >= len(sc.MeshRanges) {
+		return -1
+	}
+	if lod == 0 {
+		return int(meshIndex)
+	}
+
+	for index, mr := range sc.MeshRanges {
+		if mr.BaseMesh == meshIndex && mr.LOD == lod {
+			return index
+		}
+	}
+	return -1
+}
+
+// Get the distinct material tree roots referenced by the primitives of a mesh
+// in ascending order. This method returns nil if the mesh index is invalid.
+func (sc *Scene) MaterialsForMesh(meshIndex uint32) []uint32 {
+	if int(meshIndex) >= len(sc.MeshRanges) {
+		return nil
+	}
+
+	meshRange := sc.MeshRanges[meshIndex]
+	primEnd := meshRange.FirstPrimitive + meshRange.PrimitiveCount
+	if int(primEnd) > len(sc.MaterialIndex) {
+		return nil
+	}
+
+	seen := make(map[uint32]struct{}, 0)
+	materials := make([]uint32, 0)
+	for _, matIndex := range sc.MaterialIndex[meshRange.FirstPrimitive:primEnd] {
+		if _, exists := seen[matIndex]; exists {
+			continue
+		}
+		seen[matIndex] = struct{}{}
+		materials = append(materials, matIndex)
+	}
+
+	sort.Slice(materials, func(i, j int) bool { return materials[i] < materials[j] })
+	return materials
 }
 
 // Build a tabular representation of scene statistics.
@@ -196,10 +567,12 @@ func (sc *Scene) Stats() string {
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAutoFormatHeaders(false)
 	table.SetHeader([]string{"Asset Type", "Asset", "Size"})
-	table.Append([]string{"Geometry", "---", fmtSize(sc.VertexList, sc.NormalList, sc.UvList, sc.BvhNodeList)})
+	table.Append([]string{"Geometry", "---", fmtSize(sc.VertexList, sc.NormalList, sc.UvList, sc.TangentList, sc.IndexList, sc.BvhNodeList)})
 	table.Append([]string{"", "Vertices", fmtSize(sc.VertexList)})
 	table.Append([]string{"", "Normals", fmtSize(sc.NormalList)})
 	table.Append([]string{"", "UVs", fmtSize(sc.UvList)})
+	table.Append([]string{"", "Tangents", fmtSize(sc.TangentList)})
+	table.Append([]string{"", "Indices", fmtSize(sc.IndexList)})
 	table.Append([]string{"", "BVH", fmtSize(sc.BvhNodeList)})
 	table.Append([]string{" ", " ", " "})
 	table.Append([]string{"Mesh/emissives", "---", fmtSize(sc.MeshInstanceList, sc.EmissivePrimitives)})
@@ -213,7 +586,7 @@ func (sc *Scene) Stats() string {
 	table.Append([]string{"Textures", "---", fmtSize(sc.TextureMetadata, sc.TextureData)})
 	table.Append([]string{"", "Metadata", fmtSize(sc.TextureMetadata)})
 	table.Append([]string{"", "Data", fmtSize(sc.TextureData)})
-	table.SetFooter([]string{"Total", " ", strings.TrimLeft(fmtSize(sc.VertexList, sc.NormalList, sc.UvList, sc.BvhNodeList, sc.MeshInstanceList, sc.EmissivePrimitives, sc.MaterialNodeList, sc.MaterialIndex, sc.TextureMetadata, sc.TextureData), " ")})
+	table.SetFooter([]string{"Total", " ", strings.TrimLeft(fmtSize(sc.VertexList, sc.NormalList, sc.UvList, sc.TangentList, sc.IndexList, sc.BvhNodeList, sc.MeshInstanceList, sc.EmissivePrimitives, sc.MaterialNodeList, sc.MaterialIndex, sc.TextureMetadata, sc.TextureData), " ")})
 
 	table.Render()
 	return buf.String()
@@ -0,0 +1,114 @@
+package scene
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMaterialsForMesh(t *testing.T) {
+	sc := &Scene{
+		MeshRanges: []MeshRange{
+			{FirstPrimitive: 0, PrimitiveCount: 2},
+			{FirstPrimitive: 2, PrimitiveCount: 5},
+		},
+		MaterialIndex: []uint32{
+			// mesh 0
+			3, 3,
+			// mesh 1
+			7, 2, 7, 2, 2,
+		},
+	}
+
+	specs := []struct {
+		meshIndex uint32
+		exp       []uint32
+	}{
+		{0, []uint32{3}},
+		{1, []uint32{2, 7}},
+		{2, nil},
+	}
+
+	for _, spec := range specs {
+		materials := sc.MaterialsForMesh(spec.meshIndex)
+		if !reflect.DeepEqual(materials, spec.exp) {
+			t.Fatalf("[mesh %d] expected materials to be %v; got %v", spec.meshIndex, spec.exp, materials)
+		}
+	}
+}
+
+func TestNewMixNode(t *testing.T) {
+	node := NewMixNode(1, 2, 0.25, 3)
+	if material.OpType(node.Union1[0]) != material.OpMix || node.Union1[1] != 1 || node.Union1[2] != 2 || node.Union1[3] != 3 {
+		t.Fatalf("expected mix node with children 1, 2 and weight texture 3; got %v", node.Union1)
+	}
+	if node.Union2[0] != 0.25 {
+		t.Fatalf("expected mix weight to be 0.25; got %f", node.Union2[0])
+	}
+	if node.Union5[0] != -1 || node.Union6[0] != -1 || node.Union6[1] != -1 {
+		t.Fatal("expected mix node to not reference any bxdf textures")
+	}
+}
+
+func TestBvhNodeMeshInstances(t *testing.T) {
+	var node BvhNode
+
+	node.SetMeshIndex(5)
+	if first, count := node.GetMeshInstances(); first != 5 || count != 1 {
+		t.Fatalf("expected single instance leaf to reference instance 5; got %d instances starting at %d", count, first)
+	}
+
+	node.SetMeshInstances(3, 4)
+	if first, count := node.GetMeshInstances(); first != 3 || count != 4 {
+		t.Fatalf("expected leaf to reference 4 instances starting at 3; got %d instances starting at %d", count, first)
+	}
+}
+
+func TestSceneBounds(t *testing.T) {
+	// Empty scenes should report an inverted box
+	sc := &Scene{}
+	if min, max := sc.Bounds(); min[0] <= max[0] || min[1] <= max[1] || min[2] <= max[2] {
+		t.Fatalf("expected empty scene bounds to be inverted; got min %v, max %v", min, max)
+	}
+
+	var root BvhNode
+	root.SetBBox([2]types.Vec3{{-1, -2, -3}, {4, 5, 6}})
+	root.SetMeshIndex(0)
+	if bbox := root.GetBBox(); bbox != [2]types.Vec3{{-1, -2, -3}, {4, 5, 6}} {
+		t.Fatalf("expected node bbox to be [{-1, -2, -3}, {4, 5, 6}]; got %v", bbox)
+	}
+
+	sc = &Scene{
+		BvhNodeList:      []BvhNode{root, {}},
+		MeshInstanceList: []MeshInstance{{MeshIndex: 0, BvhRoot: 1, Transform: types.Ident4()}},
+	}
+	min, max := sc.Bounds()
+	if min != (types.Vec3{-1, -2, -3}) || max != (types.Vec3{4, 5, 6}) {
+		t.Fatalf("expected scene bounds to match the top-level BVH root; got min %v, max %v", min, max)
+	}
+}
+
+func TestInterpolatedUV(t *testing.T) {
+	uvs := []types.Vec2{{0, 0}, {1, 0}, {0, 1}, {1, 1}}
+	specs := []*Scene{
+		// Non-indexed scene with the second primitive at offset 3
+		{UvList: []types.Vec2{{}, {}, {}, uvs[1], uvs[3], uvs[2]}},
+		// Indexed scene sharing vertices between primitives
+		{UvList: uvs, IndexList: []uint32{0, 1, 2, 1, 3, 2}},
+	}
+
+	const third = float32(1.0 / 3.0)
+	expUV := types.Vec2{2.0 / 3.0, 2.0 / 3.0}
+	for specIndex, sc := range specs {
+		uv := sc.InterpolatedUV(1, types.Vec3{third, third, third})
+		if !types.ApproxEqual(uv.Vec3(0), expUV.Vec3(0), 1e-6) {
+			t.Errorf("[spec %d] expected centroid UV to be %v; got %v", specIndex, expUV, uv)
+		}
+
+		if uv := sc.InterpolatedUV(1, types.Vec3{0, 1, 0}); uv != uvs[3] {
+			t.Errorf("[spec %d] expected UV at second corner to be %v; got %v", specIndex, uvs[3], uv)
+		}
+	}
+}
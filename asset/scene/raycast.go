@@ -0,0 +1,103 @@
+package scene
+
+import (
+	"math"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// Check whether a ray intersects any primitive of a mesh within maxDist. The
+// ray origin and direction are specified in the mesh coordinate space.
+//
+// This method mirrors the any-hit BVH traversal that the tracer uses for
+// occlusion rays and traverses the BVH of the mesh with the given MeshRanges
+// index. Intersections are tested using the scene intersection epsilon.
+func (sc *Scene) MeshOccluded(meshIndex int, origin, dir types.Vec3, maxDist float32) bool {
+	if meshIndex < 0 || meshIndex >= len(sc.MeshRanges) {
+		return false
+	}
+
+	epsilon := sc.IntersectionEpsilon()
+
+	invDir := types.Vec3{1 / dir[0], 1 / dir[1], 1 / dir[2]}
+	nodeStack := []uint32{sc.MeshRanges[meshIndex].BvhRoot}
+	for len(nodeStack) > 0 {
+		node := &sc.BvhNodeList[nodeStack[len(nodeStack)-1]]
+		nodeStack = nodeStack[:len(nodeStack)-1]
+
+		if !rayHitsBBox(origin, invDir, node.Min, node.Max, maxDist, epsilon) {
+			continue
+		}
+
+		// Inner node
+		if node.LData > 0 {
+			nodeStack = append(nodeStack, uint32(node.LData), uint32(node.RData))
+			continue
+		}
+
+		firstPrimIndex, count := node.GetPrimitives()
+		for primIndex := firstPrimIndex; primIndex < firstPrimIndex+count; primIndex++ {
+			if t := sc.intersectPrimitive(primIndex, origin, dir, epsilon); t > epsilon && t < maxDist {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Intersect a ray with a primitive using the Moller-Trumbore algorithm and
+// return the distance to the intersection or -1 if the ray misses it or is
+// parallel to the primitive.
+func (sc *Scene) intersectPrimitive(primIndex uint32, origin, dir types.Vec3, epsilon float32) float32 {
+	v0 := sc.VertexList[sc.VertexIndex(primIndex, 0)].Vec3()
+	edge01 := sc.VertexList[sc.VertexIndex(primIndex, 1)].Vec3().Sub(v0)
+	edge02 := sc.VertexList[sc.VertexIndex(primIndex, 2)].Vec3().Sub(v0)
+
+	// As the determinant scales with the square of the scene coordinates,
+	// the parallel ray threshold is derived from the squared epsilon.
+	pVec := dir.Cross(edge02)
+	det := edge01.Dot(pVec)
+	if float32(math.Abs(float64(det))) < epsilon*epsilon/relativeIntersectionEpsilon {
+		return -1
+	}
+	invDet := 1 / det
+
+	tVec := origin.Sub(v0)
+	u := tVec.Dot(pVec) * invDet
+	if u < 0 || u > 1 {
+		return -1
+	}
+
+	qVec := tVec.Cross(edge01)
+	v := dir.Dot(qVec) * invDet
+	if v < 0 || u+v > 1 {
+		return -1
+	}
+
+	return edge02.Dot(qVec) * invDet
+}
+
+// Check whether a ray intersects a bounding box within maxDist using the slab
+// test. Rays that miss the box by less than epsilon are treated as hits so
+// that flat boxes are not missed due to rounding errors.
+func rayHitsBBox(origin, invDir, min, max types.Vec3, maxDist, epsilon float32) bool {
+	tMin, tMax := float32(0), maxDist
+	for axis := 0; axis < 3; axis++ {
+		t0 := (min[axis] - origin[axis]) * invDir[axis]
+		t1 := (max[axis] - origin[axis]) * invDir[axis]
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+		if t0 > tMin {
+			tMin = t0
+		}
+		if t1 < tMax {
+			tMax = t1
+		}
+		if tMin > tMax+epsilon {
+			return false
+		}
+	}
+	return true
+}
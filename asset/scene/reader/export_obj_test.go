@@ -0,0 +1,74 @@
+package reader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestExportOBJ(t *testing.T) {
+	translations := []types.Vec3{{0, 0, 0}, {10, -2, 5}}
+
+	sc := &scene.Scene{
+		VertexList: []types.Vec4{{0, 0, 0, 0}, {1, 0, 0, 0}, {0, 1, 0, 0}},
+		NormalList: []types.Vec4{{0, 0, 1, 0}, {0, 0, 1, 0}, {0, 0, 1, 0}},
+		UvList:     []types.Vec2{{0, 0}, {1, 0}, {0, 1}},
+		MeshRanges: []scene.MeshRange{{FirstPrimitive: 0, PrimitiveCount: 1}},
+	}
+	for _, translation := range translations {
+		sc.MeshInstanceList = append(sc.MeshInstanceList, scene.MeshInstance{
+			Transform: types.Translate4(translation).Inv(),
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "polaris-reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	objFile := filepath.Join(dir, "export.obj")
+	f, err := os.Create(objFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sc.ExportOBJ(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Parse back the exported file using the wavefront reader
+	rawScene, err := ReadRawScene(objFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rawScene.Meshes) != len(translations) {
+		t.Fatalf("expected exported file to contain %d meshes; got %d", len(translations), len(rawScene.Meshes))
+	}
+	for instIndex, translation := range translations {
+		mesh := rawScene.Meshes[instIndex]
+		if len(mesh.Primitives) != 1 {
+			t.Fatalf("[instance %d] expected mesh %q to contain 1 primitive; got %d", instIndex, mesh.Name, len(mesh.Primitives))
+		}
+
+		prim := mesh.Primitives[0]
+		for vIndex := 0; vIndex < 3; vIndex++ {
+			exp := sc.VertexList[vIndex].Vec3().Add(translation)
+			if got := prim.Vertices[vIndex]; !types.ApproxEqual(got, exp, 1e-5) {
+				t.Fatalf("[instance %d] expected vertex %d to be %v; got %v", instIndex, vIndex, exp, got)
+			}
+			if got := prim.Normals[vIndex]; !types.ApproxEqual(got, types.Vec3{0, 0, 1}, 1e-5) {
+				t.Fatalf("[instance %d] expected normal %d to be %v; got %v", instIndex, vIndex, types.Vec3{0, 0, 1}, got)
+			}
+			if got := prim.UVs[vIndex]; got != sc.UvList[vIndex] {
+				t.Fatalf("[instance %d] expected uv %d to be %v; got %v", instIndex, vIndex, sc.UvList[vIndex], got)
+			}
+		}
+	}
+}
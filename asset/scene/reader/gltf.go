@@ -0,0 +1,872 @@
+package reader
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/achilleasa/polaris/asset"
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/log"
+	"github.com/achilleasa/polaris/types"
+)
+
+const (
+	// GLB container header and chunk types.
+	glbMagic     = 0x46546C67
+	glbVersion   = 2
+	glbChunkJSON = 0x4E4F534A
+	glbChunkBIN  = 0x004E4942
+
+	// Accessor component types.
+	gltfByte          = 5120
+	gltfUnsignedByte  = 5121
+	gltfShort         = 5122
+	gltfUnsignedShort = 5123
+	gltfUnsignedInt   = 5125
+	gltfFloat         = 5126
+
+	// Primitive topologies.
+	gltfTriangles     = 4
+	gltfTriangleStrip = 5
+	gltfTriangleFan   = 6
+
+	// The max depth of the node hierarchy; guards against cyclic node graphs.
+	gltfMaxNodeDepth = 256
+
+	// The material system rejects reflectance values that are not below 1
+	// so base color factors are clamped to this value.
+	gltfMaxBaseColor = 0.999
+)
+
+// The subset of the glTF 2.0 document schema used by the reader.
+type gltfDocument struct {
+	Scene       *int              `json:"scene"`
+	Scenes      []gltfScene       `json:"scenes"`
+	Nodes       []gltfNode        `json:"nodes"`
+	Meshes      []gltfMesh        `json:"meshes"`
+	Accessors   []gltfAccessor    `json:"accessors"`
+	BufferViews []gltfBufferView  `json:"bufferViews"`
+	Buffers     []gltfBuffer      `json:"buffers"`
+	Materials   []gltfMaterial    `json:"materials"`
+	Textures    []gltfTexture     `json:"textures"`
+	Images      []gltfImage       `json:"images"`
+	Asset       gltfAssetMetadata `json:"asset"`
+}
+
+type gltfAssetMetadata struct {
+	Version string `json:"version"`
+}
+
+type gltfScene struct {
+	Name  string `json:"name"`
+	Nodes []int  `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string    `json:"name"`
+	Mesh        *int      `json:"mesh"`
+	Children    []int     `json:"children"`
+	Matrix      []float32 `json:"matrix"`
+	Translation []float32 `json:"translation"`
+	Rotation    []float32 `json:"rotation"`
+	Scale       []float32 `json:"scale"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+type gltfAccessor struct {
+	BufferView    *int            `json:"bufferView"`
+	ByteOffset    int             `json:"byteOffset"`
+	ComponentType int             `json:"componentType"`
+	Normalized    bool            `json:"normalized"`
+	Count         int             `json:"count"`
+	Type          string          `json:"type"`
+	Sparse        json.RawMessage `json:"sparse"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri"`
+	ByteLength int    `json:"byteLength"`
+}
+
+type gltfMaterial struct {
+	Name                 string                    `json:"name"`
+	PbrMetallicRoughness *gltfPbrMetallicRoughness `json:"pbrMetallicRoughness"`
+	NormalTexture        *gltfTextureRef           `json:"normalTexture"`
+	EmissiveTexture      *gltfTextureRef           `json:"emissiveTexture"`
+	EmissiveFactor       []float32                 `json:"emissiveFactor"`
+	AlphaMode            string                    `json:"alphaMode"`
+}
+
+type gltfPbrMetallicRoughness struct {
+	BaseColorFactor          []float32       `json:"baseColorFactor"`
+	BaseColorTexture         *gltfTextureRef `json:"baseColorTexture"`
+	MetallicFactor           *float32        `json:"metallicFactor"`
+	RoughnessFactor          *float32        `json:"roughnessFactor"`
+	MetallicRoughnessTexture *gltfTextureRef `json:"metallicRoughnessTexture"`
+}
+
+type gltfTextureRef struct {
+	Index    int `json:"index"`
+	TexCoord int `json:"texCoord"`
+}
+
+type gltfTexture struct {
+	Source *int `json:"source"`
+}
+
+type gltfImage struct {
+	URI        string `json:"uri"`
+	BufferView *int   `json:"bufferView"`
+}
+
+type gltfSceneReader struct {
+	logger log.Logger
+
+	// The parsed scene.
+	rawScene *input.Scene
+
+	// The parsed glTF document and the contents of its buffers.
+	doc     gltfDocument
+	buffers [][]byte
+
+	// A map of glTF mesh indices to parsed mesh indices. glTF meshes
+	// without any triangle primitives are not parsed and map to -1.
+	meshIndexMap []int
+
+	// Options for the scene compiler.
+	compilerOpts compiler.Options
+
+	// The diagnostics emitted while compiling the scene.
+	diagnostics *compiler.CompileDiagnostics
+}
+
+// Create a new glTF scene reader.
+func newGltfReader() *gltfSceneReader {
+	return &gltfSceneReader{
+		logger:       log.New("glTF scene reader"),
+		rawScene:     input.NewScene(),
+		compilerOpts: compiler.DefaultOptions(),
+	}
+}
+
+// Read scene definition.
+func (r *gltfSceneReader) Read(sceneRes *asset.Resource) (*scene.Scene, error) {
+	rawScene, err := r.ReadRaw(sceneRes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compile scene into an optimized, gpu-friendly format and keep
+	// track of the compiler diagnostics.
+	sc, diagnostics, err := compiler.Compile(rawScene, r.compilerOpts)
+	r.diagnostics = diagnostics
+	return sc, err
+}
+
+// Read scene definition without compiling it. Both the JSON (.gltf) and the
+// binary (.glb) container formats are supported.
+func (r *gltfSceneReader) ReadRaw(sceneRes *asset.Resource) (*input.Scene, error) {
+	r.logger.Noticef(`parsing scene from "%s"`, sceneRes.Path())
+	start := time.Now()
+
+	data, err := ioutil.ReadAll(sceneRes)
+	if err != nil {
+		return nil, err
+	}
+
+	var binChunk []byte
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		data, binChunk, err = parseGlbContainer(data)
+		if err != nil {
+			return nil, r.emitError(sceneRes.Path(), err)
+		}
+	}
+
+	err = json.Unmarshal(data, &r.doc)
+	if err != nil {
+		return nil, r.emitError(sceneRes.Path(), err)
+	}
+	if !strings.HasPrefix(r.doc.Asset.Version, "2.") {
+		return nil, r.emitError(sceneRes.Path(), fmt.Errorf("unsupported glTF version %q", r.doc.Asset.Version))
+	}
+
+	err = r.loadBuffers(sceneRes, binChunk)
+	if err != nil {
+		return nil, r.emitError(sceneRes.Path(), err)
+	}
+
+	r.parseMaterials(sceneRes)
+
+	err = r.parseMeshes()
+	if err != nil {
+		return nil, r.emitError(sceneRes.Path(), err)
+	}
+
+	err = r.parseNodes()
+	if err != nil {
+		return nil, r.emitError(sceneRes.Path(), err)
+	}
+
+	r.logger.Noticef("parsed scene in %d ms", time.Since(start).Nanoseconds()/1e6)
+	return r.rawScene, nil
+}
+
+// Generate an error message that includes the file path.
+func (r *gltfSceneReader) emitError(file string, err error) error {
+	return fmt.Errorf("[%s] error: %s", file, err.Error())
+}
+
+// Split a GLB container into its JSON and (optional) binary chunks.
+func parseGlbContainer(data []byte) ([]byte, []byte, error) {
+	if len(data) < 12 {
+		return nil, nil, fmt.Errorf("truncated GLB header")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != glbVersion {
+		return nil, nil, fmt.Errorf("unsupported GLB container version %d", version)
+	}
+	if length := binary.LittleEndian.Uint32(data[8:]); int(length) > len(data) {
+		return nil, nil, fmt.Errorf("GLB header length %d exceeds the file size %d", length, len(data))
+	}
+
+	var jsonChunk, binChunk []byte
+	for offset := 12; offset+8 <= len(data); {
+		chunkLen := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if offset+chunkLen > len(data) {
+			return nil, nil, fmt.Errorf("truncated GLB chunk")
+		}
+
+		switch chunkType {
+		case glbChunkJSON:
+			jsonChunk = data[offset : offset+chunkLen]
+		case glbChunkBIN:
+			binChunk = data[offset : offset+chunkLen]
+		}
+		offset += chunkLen
+	}
+
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("GLB container does not include a JSON chunk")
+	}
+	return jsonChunk, binChunk, nil
+}
+
+// Load the contents of the document buffers. Buffers may be embedded as
+// base64 data URIs, reference external files relative to the scene resource
+// or, for GLB containers, refer to the binary chunk.
+func (r *gltfSceneReader) loadBuffers(sceneRes *asset.Resource, binChunk []byte) error {
+	r.buffers = make([][]byte, len(r.doc.Buffers))
+	for index, buf := range r.doc.Buffers {
+		var data []byte
+		var err error
+		switch {
+		case buf.URI == "":
+			if index != 0 || binChunk == nil {
+				return fmt.Errorf("buffer %d does not define a URI", index)
+			}
+			data = binChunk
+		case strings.HasPrefix(buf.URI, "data:"):
+			data, err = decodeDataURI(buf.URI)
+		default:
+			var res *asset.Resource
+			res, err = asset.NewResource(buf.URI, sceneRes)
+			if err == nil {
+				data, err = ioutil.ReadAll(res)
+				res.Close()
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("could not load buffer %d: %s", index, err.Error())
+		}
+
+		if len(data) < buf.ByteLength {
+			return fmt.Errorf("buffer %d contains %d bytes; expected %d", index, len(data), buf.ByteLength)
+		}
+		r.buffers[index] = data
+	}
+
+	return nil
+}
+
+// Decode the payload of a base64 encoded data URI.
+func decodeDataURI(uri string) ([]byte, error) {
+	sepIndex := strings.Index(uri, ",")
+	if sepIndex == -1 || !strings.HasSuffix(uri[:sepIndex], ";base64") {
+		return nil, fmt.Errorf("unsupported data URI encoding")
+	}
+	return base64.StdEncoding.DecodeString(uri[sepIndex+1:])
+}
+
+// Map the PBR metallic-roughness materials of the document to material
+// expressions. Each glTF material is mapped to the parsed material with the
+// same index.
+func (r *gltfSceneReader) parseMaterials(sceneRes *asset.Resource) {
+	for matIndex, gm := range r.doc.Materials {
+		name := gm.Name
+		if name == "" {
+			name = fmt.Sprintf("material_%d", matIndex)
+		}
+
+		r.rawScene.Materials = append(r.rawScene.Materials, &input.Material{
+			Name:         name,
+			Expression:   r.materialExpression(name, gm),
+			AssetRelPath: sceneRes,
+			SRGBTextures: true,
+			Used:         true,
+		})
+	}
+}
+
+// Generate a material expression for a PBR metallic-roughness material.
+// Materials are modeled as a mix between a diffuse and a rough conductor
+// bxdf weighted by the metallic factor. Emissive materials are mapped to an
+// emissive bxdf. Base color, emissive and normal textures are supported;
+// texture values replace the corresponding factors.
+func (r *gltfSceneReader) materialExpression(name string, gm gltfMaterial) string {
+	pbr := gm.PbrMetallicRoughness
+	if pbr == nil {
+		pbr = &gltfPbrMetallicRoughness{}
+	}
+
+	baseColor := types.Vec4{1, 1, 1, 1}
+	if len(pbr.BaseColorFactor) == 4 {
+		baseColor = types.Vec4{pbr.BaseColorFactor[0], pbr.BaseColorFactor[1], pbr.BaseColorFactor[2], pbr.BaseColorFactor[3]}
+	}
+	var metallic, roughness float32 = 1, 1
+	if pbr.MetallicFactor != nil {
+		metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		roughness = *pbr.RoughnessFactor
+	}
+	if pbr.MetallicRoughnessTexture != nil {
+		r.logger.Warningf("material %q: metallic-roughness textures are not supported; using the metallic and roughness factors", name)
+	}
+
+	var emissive types.Vec3
+	if len(gm.EmissiveFactor) == 3 {
+		emissive = types.Vec3{gm.EmissiveFactor[0], gm.EmissiveFactor[1], gm.EmissiveFactor[2]}
+	}
+	emissiveTex := r.texturePath(name, gm.EmissiveTexture)
+
+	var materialExpr string
+	if emissive.MaxComponent() > 0 {
+		if emissiveTex != "" {
+			materialExpr = fmt.Sprintf("%s(%s: %q, %s: %v)", material.BxdfEmissive, material.ParamRadiance, emissiveTex, material.ParamScale, emissive.MaxComponent())
+		} else {
+			materialExpr = fmt.Sprintf("%s(%s: %v)", material.BxdfEmissive, material.ParamRadiance, emissive)
+		}
+	} else {
+		colorArg := types.MinVec3(baseColor.Vec3(), types.Vec3{gltfMaxBaseColor, gltfMaxBaseColor, gltfMaxBaseColor}).String()
+		if baseTex := r.texturePath(name, pbr.BaseColorTexture); baseTex != "" {
+			colorArg = fmt.Sprintf("%q", baseTex)
+		}
+
+		diffuseExpr := fmt.Sprintf("%s(%s: %s)", material.BxdfDiffuse, material.ParamReflectance, colorArg)
+		conductorExpr := fmt.Sprintf("%s(%s: %s, %s: %v)", material.BxdfRoughtConductor, material.ParamSpecularity, colorArg, material.ParamRoughness, roughness)
+		switch {
+		case metallic <= 0:
+			materialExpr = diffuseExpr
+		case metallic >= 1:
+			materialExpr = conductorExpr
+		default:
+			materialExpr = fmt.Sprintf("mix(%s, %s, %v)", conductorExpr, diffuseExpr, metallic)
+		}
+
+		if normalTex := r.texturePath(name, gm.NormalTexture); normalTex != "" {
+			materialExpr = fmt.Sprintf("normalMap(%s, %q)", materialExpr, normalTex)
+		}
+	}
+
+	// Blend with a transparent bxdf using the base color alpha as the weight
+	if gm.AlphaMode != "" && gm.AlphaMode != "OPAQUE" && baseColor[3] < 1 {
+		materialExpr = fmt.Sprintf("mix(%s, %s(), %v)", materialExpr, material.BxdfTransparent, baseColor[3])
+	}
+
+	return materialExpr
+}
+
+// Get the path to the image referenced by a texture. Returns an empty string
+// if the texture cannot be used by the material system.
+func (r *gltfSceneReader) texturePath(matName string, ref *gltfTextureRef) string {
+	if ref == nil {
+		return ""
+	}
+	if ref.Index < 0 || ref.Index >= len(r.doc.Textures) || r.doc.Textures[ref.Index].Source == nil ||
+		*r.doc.Textures[ref.Index].Source < 0 || *r.doc.Textures[ref.Index].Source >= len(r.doc.Images) {
+		r.logger.Warningf("material %q: ignoring invalid texture reference %d", matName, ref.Index)
+		return ""
+	}
+	if ref.TexCoord != 0 {
+		r.logger.Warningf("material %q: texture %d uses uv set %d; only the first uv set is supported", matName, ref.Index, ref.TexCoord)
+	}
+
+	image := r.doc.Images[*r.doc.Textures[ref.Index].Source]
+	if image.URI == "" || strings.HasPrefix(image.URI, "data:") {
+		r.logger.Warningf("material %q: ignoring embedded image for texture %d; only external images are supported", matName, ref.Index)
+		return ""
+	}
+	return image.URI
+}
+
+// Parse the document meshes. All triangle primitives of a glTF mesh are
+// merged into a single parsed mesh.
+func (r *gltfSceneReader) parseMeshes() error {
+	r.meshIndexMap = make([]int, len(r.doc.Meshes))
+	for meshIndex, gm := range r.doc.Meshes {
+		name := gm.Name
+		if name == "" {
+			name = fmt.Sprintf("mesh_%d", meshIndex)
+		}
+
+		mesh := input.NewMesh(name)
+		for primIndex, gp := range gm.Primitives {
+			prims, err := r.parsePrimitive(gp)
+			if err != nil {
+				return fmt.Errorf("mesh %q, primitive %d: %s", name, primIndex, err.Error())
+			}
+			mesh.Primitives = append(mesh.Primitives, prims...)
+		}
+
+		if len(mesh.Primitives) == 0 {
+			r.logger.Warningf("mesh %q does not contain any triangle primitives; skipping", name)
+			r.meshIndexMap[meshIndex] = -1
+			continue
+		}
+
+		mesh.MarkBBoxDirty()
+		r.meshIndexMap[meshIndex] = len(r.rawScene.Meshes)
+		r.rawScene.Meshes = append(r.rawScene.Meshes, mesh)
+	}
+
+	return nil
+}
+
+// Convert a glTF mesh primitive into a list of triangles. Primitives that
+// do not define vertex normals receive the normal of each triangle's face.
+func (r *gltfSceneReader) parsePrimitive(gp gltfPrimitive) ([]*input.Primitive, error) {
+	mode := gltfTriangles
+	if gp.Mode != nil {
+		mode = *gp.Mode
+	}
+	if mode != gltfTriangles && mode != gltfTriangleStrip && mode != gltfTriangleFan {
+		r.logger.Warningf("skipping primitive with unsupported topology %d", mode)
+		return nil, nil
+	}
+
+	posIndex, exists := gp.Attributes["POSITION"]
+	if !exists {
+		return nil, fmt.Errorf("missing POSITION attribute")
+	}
+	positions, err := r.readFloatAccessor(posIndex, 3)
+	if err != nil {
+		return nil, fmt.Errorf("POSITION: %s", err.Error())
+	}
+	numVertices := len(positions) / 3
+
+	var normals, uvs []float32
+	if accIndex, exists := gp.Attributes["NORMAL"]; exists {
+		if normals, err = r.readFloatAccessor(accIndex, 3); err != nil {
+			return nil, fmt.Errorf("NORMAL: %s", err.Error())
+		}
+		if len(normals)/3 != numVertices {
+			return nil, fmt.Errorf("NORMAL: expected %d elements; got %d", numVertices, len(normals)/3)
+		}
+	}
+	if accIndex, exists := gp.Attributes["TEXCOORD_0"]; exists {
+		if uvs, err = r.readFloatAccessor(accIndex, 2); err != nil {
+			return nil, fmt.Errorf("TEXCOORD_0: %s", err.Error())
+		}
+		if len(uvs)/2 != numVertices {
+			return nil, fmt.Errorf("TEXCOORD_0: expected %d elements; got %d", numVertices, len(uvs)/2)
+		}
+	}
+
+	var tangents []float32
+	if accIndex, exists := gp.Attributes["TANGENT"]; exists {
+		if tangents, err = r.readFloatAccessor(accIndex, 4); err != nil {
+			return nil, fmt.Errorf("TANGENT: %s", err.Error())
+		}
+		if len(tangents)/4 != numVertices {
+			return nil, fmt.Errorf("TANGENT: expected %d elements; got %d", numVertices, len(tangents)/4)
+		}
+	}
+
+	var indices []uint32
+	if gp.Indices != nil {
+		if indices, err = r.readIndexAccessor(*gp.Indices); err != nil {
+			return nil, fmt.Errorf("indices: %s", err.Error())
+		}
+	} else {
+		indices = make([]uint32, numVertices)
+		for index := range indices {
+			indices[index] = uint32(index)
+		}
+	}
+
+	// Assemble the triangle list for the primitive topology
+	var triangles [][3]uint32
+	switch mode {
+	case gltfTriangles:
+		for offset := 0; offset+2 < len(indices); offset += 3 {
+			triangles = append(triangles, [3]uint32{indices[offset], indices[offset+1], indices[offset+2]})
+		}
+	case gltfTriangleStrip:
+		for offset := 0; offset+2 < len(indices); offset++ {
+			// Flip every other triangle to preserve the winding order
+			if offset%2 == 0 {
+				triangles = append(triangles, [3]uint32{indices[offset], indices[offset+1], indices[offset+2]})
+			} else {
+				triangles = append(triangles, [3]uint32{indices[offset+1], indices[offset], indices[offset+2]})
+			}
+		}
+	case gltfTriangleFan:
+		for offset := 1; offset+1 < len(indices); offset++ {
+			triangles = append(triangles, [3]uint32{indices[0], indices[offset], indices[offset+1]})
+		}
+	}
+
+	matIndex := -1
+	if gp.Material != nil {
+		matIndex = *gp.Material
+	}
+
+	primitives := make([]*input.Primitive, 0, len(triangles))
+	for _, tri := range triangles {
+		// glTF has no notion of smoothing groups so all mesh primitives
+		// share the same group
+		prim := &input.Primitive{
+			MaterialIndex:  matIndex,
+			HasTangents:    tangents != nil,
+			SmoothingGroup: 1,
+		}
+		for corner, vIndex := range tri {
+			if int(vIndex) >= numVertices {
+				return nil, fmt.Errorf("vertex index %d out of bounds", vIndex)
+			}
+			prim.Vertices[corner] = types.Vec3{positions[3*vIndex], positions[3*vIndex+1], positions[3*vIndex+2]}
+			if normals != nil {
+				prim.Normals[corner] = types.Vec3{normals[3*vIndex], normals[3*vIndex+1], normals[3*vIndex+2]}
+			}
+			// glTF places the uv origin at the top-left corner of the texture
+			if uvs != nil {
+				prim.UVs[corner] = types.Vec2{uvs[2*vIndex], 1 - uvs[2*vIndex+1]}
+			}
+			// The tangent w coordinate stores the handedness of the tangent frame
+			if tangents != nil {
+				prim.Tangents[corner] = types.Vec4{tangents[4*vIndex], tangents[4*vIndex+1], tangents[4*vIndex+2], tangents[4*vIndex+3]}
+			}
+		}
+
+		// If no normals are available generate them from the vertices
+		if normals == nil {
+			faceNormal := r.compilerOpts.FrontFaceWinding.FaceNormal(prim.Vertices[0], prim.Vertices[1], prim.Vertices[2])
+			if faceNormal.Len() != 0 {
+				faceNormal = faceNormal.Normalize()
+			}
+			prim.Normals = [3]types.Vec3{faceNormal, faceNormal, faceNormal}
+		}
+
+		prim.SetBBox(
+			[2]types.Vec3{
+				types.MinVec3(prim.Vertices[0], types.MinVec3(prim.Vertices[1], prim.Vertices[2])),
+				types.MaxVec3(prim.Vertices[0], types.MaxVec3(prim.Vertices[1], prim.Vertices[2])),
+			},
+		)
+		prim.SetCenter(prim.Vertices[0].Add(prim.Vertices[1]).Add(prim.Vertices[2]).Mul(1.0 / 3.0))
+		primitives = append(primitives, prim)
+	}
+
+	return primitives, nil
+}
+
+// Get the raw data, element stride, component count and component size of
+// an accessor.
+func (r *gltfSceneReader) accessorData(accIndex int) (acc gltfAccessor, data []byte, stride, numComponents, componentSize int, err error) {
+	if accIndex < 0 || accIndex >= len(r.doc.Accessors) {
+		return acc, nil, 0, 0, 0, fmt.Errorf("accessor index %d out of bounds", accIndex)
+	}
+	acc = r.doc.Accessors[accIndex]
+	if len(acc.Sparse) != 0 {
+		return acc, nil, 0, 0, 0, fmt.Errorf("sparse accessors are not supported")
+	}
+
+	switch acc.Type {
+	case "SCALAR":
+		numComponents = 1
+	case "VEC2":
+		numComponents = 2
+	case "VEC3":
+		numComponents = 3
+	case "VEC4":
+		numComponents = 4
+	default:
+		return acc, nil, 0, 0, 0, fmt.Errorf("unsupported accessor type %q", acc.Type)
+	}
+
+	switch acc.ComponentType {
+	case gltfByte, gltfUnsignedByte:
+		componentSize = 1
+	case gltfShort, gltfUnsignedShort:
+		componentSize = 2
+	case gltfUnsignedInt, gltfFloat:
+		componentSize = 4
+	default:
+		return acc, nil, 0, 0, 0, fmt.Errorf("unsupported accessor component type %d", acc.ComponentType)
+	}
+
+	stride = numComponents * componentSize
+
+	// Accessors without a buffer view are initialized with zeros
+	if acc.BufferView == nil {
+		return acc, make([]byte, acc.Count*stride), stride, numComponents, componentSize, nil
+	}
+
+	if *acc.BufferView < 0 || *acc.BufferView >= len(r.doc.BufferViews) {
+		return acc, nil, 0, 0, 0, fmt.Errorf("buffer view index %d out of bounds", *acc.BufferView)
+	}
+	view := r.doc.BufferViews[*acc.BufferView]
+	if view.Buffer < 0 || view.Buffer >= len(r.buffers) {
+		return acc, nil, 0, 0, 0, fmt.Errorf("buffer index %d out of bounds", view.Buffer)
+	}
+	if view.ByteStride != 0 {
+		stride = view.ByteStride
+	}
+
+	start := view.ByteOffset + acc.ByteOffset
+	end := start
+	if acc.Count > 0 {
+		end += (acc.Count-1)*stride + numComponents*componentSize
+	}
+	if start < view.ByteOffset || end > view.ByteOffset+view.ByteLength || end > len(r.buffers[view.Buffer]) {
+		return acc, nil, 0, 0, 0, fmt.Errorf("accessor data exceeds the bounds of buffer view %d", *acc.BufferView)
+	}
+
+	return acc, r.buffers[view.Buffer][start:end], stride, numComponents, componentSize, nil
+}
+
+// Read an accessor with the expected number of components per element and
+// convert its elements to a flat float list. Normalized integer components
+// are mapped to the [0, 1] or [-1, 1] range.
+func (r *gltfSceneReader) readFloatAccessor(accIndex int, expComponents int) ([]float32, error) {
+	acc, data, stride, numComponents, componentSize, err := r.accessorData(accIndex)
+	if err != nil {
+		return nil, err
+	}
+	if numComponents != expComponents {
+		return nil, fmt.Errorf("expected accessor with %d components; got %q", expComponents, acc.Type)
+	}
+	if acc.ComponentType != gltfFloat && !acc.Normalized {
+		return nil, fmt.Errorf("expected float or normalized integer components")
+	}
+
+	out := make([]float32, acc.Count*numComponents)
+	for elem := 0; elem < acc.Count; elem++ {
+		for comp := 0; comp < numComponents; comp++ {
+			src := data[elem*stride+comp*componentSize:]
+			var v float32
+			switch acc.ComponentType {
+			case gltfFloat:
+				v = math.Float32frombits(binary.LittleEndian.Uint32(src))
+			case gltfByte:
+				v = float32(math.Max(float64(int8(src[0]))/127.0, -1))
+			case gltfUnsignedByte:
+				v = float32(src[0]) / 255.0
+			case gltfShort:
+				v = float32(math.Max(float64(int16(binary.LittleEndian.Uint16(src)))/32767.0, -1))
+			case gltfUnsignedShort:
+				v = float32(binary.LittleEndian.Uint16(src)) / 65535.0
+			case gltfUnsignedInt:
+				v = float32(float64(binary.LittleEndian.Uint32(src)) / 4294967295.0)
+			}
+			out[elem*numComponents+comp] = v
+		}
+	}
+
+	return out, nil
+}
+
+// Read an index accessor.
+func (r *gltfSceneReader) readIndexAccessor(accIndex int) ([]uint32, error) {
+	acc, data, stride, numComponents, _, err := r.accessorData(accIndex)
+	if err != nil {
+		return nil, err
+	}
+	if numComponents != 1 {
+		return nil, fmt.Errorf("expected a SCALAR accessor; got %q", acc.Type)
+	}
+
+	out := make([]uint32, acc.Count)
+	for elem := range out {
+		src := data[elem*stride:]
+		switch acc.ComponentType {
+		case gltfUnsignedByte:
+			out[elem] = uint32(src[0])
+		case gltfUnsignedShort:
+			out[elem] = uint32(binary.LittleEndian.Uint16(src))
+		case gltfUnsignedInt:
+			out[elem] = binary.LittleEndian.Uint32(src)
+		default:
+			return nil, fmt.Errorf("unsupported index component type %d", acc.ComponentType)
+		}
+	}
+
+	return out, nil
+}
+
+// Flatten the node hierarchy of the default scene and create a mesh instance
+// for each node that references a mesh. Nodes referencing the same mesh
+// generate instances that share the same mesh index.
+func (r *gltfSceneReader) parseNodes() error {
+	var rootNodes []int
+	switch {
+	case len(r.doc.Scenes) != 0:
+		sceneIndex := 0
+		if r.doc.Scene != nil {
+			sceneIndex = *r.doc.Scene
+		}
+		if sceneIndex < 0 || sceneIndex >= len(r.doc.Scenes) {
+			return fmt.Errorf("scene index %d out of bounds", sceneIndex)
+		}
+		rootNodes = r.doc.Scenes[sceneIndex].Nodes
+		if r.doc.Scenes[sceneIndex].Name != "" {
+			r.rawScene.Metadata.Name = r.doc.Scenes[sceneIndex].Name
+		}
+	default:
+		// Without a scene definition, use all nodes that are not children of another node
+		isChild := make(map[int]bool)
+		for _, node := range r.doc.Nodes {
+			for _, child := range node.Children {
+				isChild[child] = true
+			}
+		}
+		for nodeIndex := range r.doc.Nodes {
+			if !isChild[nodeIndex] {
+				rootNodes = append(rootNodes, nodeIndex)
+			}
+		}
+	}
+
+	for _, nodeIndex := range rootNodes {
+		err := r.parseNode(nodeIndex, types.Ident4(), 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Recursively create mesh instances for a node and its children using the
+// accumulated transformation of the node's parents.
+func (r *gltfSceneReader) parseNode(nodeIndex int, parentTransform types.Mat4, depth int) error {
+	if nodeIndex < 0 || nodeIndex >= len(r.doc.Nodes) {
+		return fmt.Errorf("node index %d out of bounds", nodeIndex)
+	}
+	if depth >= gltfMaxNodeDepth {
+		return fmt.Errorf("node hierarchy exceeds the max depth of %d; the node graph may contain a cycle", gltfMaxNodeDepth)
+	}
+
+	node := r.doc.Nodes[nodeIndex]
+	transform := parentTransform.Mul4(node.localTransform())
+
+	if node.Mesh != nil {
+		if *node.Mesh < 0 || *node.Mesh >= len(r.meshIndexMap) {
+			return fmt.Errorf("node %d: mesh index %d out of bounds", nodeIndex, *node.Mesh)
+		}
+		if meshIndex := r.meshIndexMap[*node.Mesh]; meshIndex != -1 {
+			inst := &input.MeshInstance{
+				MeshIndex: uint32(meshIndex),
+				Transform: transform,
+			}
+			instBBox := transformBBox(transform, r.rawScene.Meshes[meshIndex].BBox())
+			inst.SetBBox(instBBox)
+			inst.SetCenter(instBBox[0].Add(instBBox[1]).Mul(0.5))
+			r.rawScene.MeshInstances = append(r.rawScene.MeshInstances, inst)
+		}
+	}
+
+	for _, child := range node.Children {
+		err := r.parseNode(child, transform, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get the local transformation matrix of a node. If the node does not define
+// a matrix, the matrix is built from the node translation, rotation and
+// scale as M = T * R * S.
+func (node gltfNode) localTransform() types.Mat4 {
+	if len(node.Matrix) == 16 {
+		// glTF matrices are stored in column-major order
+		var m types.Mat4
+		copy(m[:], node.Matrix)
+		return m
+	}
+
+	transform := types.Ident4()
+	if len(node.Translation) == 3 {
+		transform = types.Translate4(types.Vec3{node.Translation[0], node.Translation[1], node.Translation[2]})
+	}
+	if len(node.Rotation) == 4 {
+		rot := types.Quat{
+			V: types.Vec3{node.Rotation[0], node.Rotation[1], node.Rotation[2]},
+			W: node.Rotation[3],
+		}
+		transform = transform.Mul4(rot.Normalize().Mat4())
+	}
+	if len(node.Scale) == 3 {
+		transform = transform.Mul4(types.Scale4(types.Vec3{node.Scale[0], node.Scale[1], node.Scale[2]}))
+	}
+	return transform
+}
+
+// Calculate the AABB of a bounding box after applying a transformation.
+func transformBBox(transform types.Mat4, bbox [2]types.Vec3) [2]types.Vec3 {
+	out := [2]types.Vec3{
+		types.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+		types.Vec3{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+	}
+	for corner := 0; corner < 8; corner++ {
+		v := types.Vec3{
+			bbox[corner&1][0],
+			bbox[(corner>>1)&1][1],
+			bbox[(corner>>2)&1][2],
+		}
+		v = transform.Mul4x1(v.Vec4(1)).Vec3()
+		out[0] = types.MinVec3(out[0], v)
+		out[1] = types.MaxVec3(out[1], v)
+	}
+	return out
+}
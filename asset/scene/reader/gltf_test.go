@@ -0,0 +1,311 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// Generate the binary buffer for a single triangle with indices, positions
+// and uvs (in this order).
+func genGltfTriangleBuffer() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint16{0, 1, 2, 0})
+	binary.Write(&buf, binary.LittleEndian, []float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+	binary.Write(&buf, binary.LittleEndian, []float32{0, 0, 1, 0, 0.25, 0.75})
+	return buf.Bytes()
+}
+
+// Generate a glTF document with a single triangle mesh that is referenced by
+// a hierarchy of 3 nodes. If bufferURI is empty, the buffer refers to the
+// binary chunk of a GLB container.
+func genGltfDocument(bufferURI string) string {
+	uriField := ""
+	if bufferURI != "" {
+		uriField = fmt.Sprintf(`"uri": %q, `, bufferURI)
+	}
+
+	return `{
+	"asset": {"version": "2.0"},
+	"scene": 0,
+	"scenes": [{"name": "test", "nodes": [0, 2]}],
+	"nodes": [
+		{"name": "parent", "mesh": 0, "translation": [1, 2, 3], "children": [1]},
+		{"name": "child", "mesh": 0, "scale": [2, 2, 2]},
+		{"name": "matrix", "mesh": 0, "matrix": [1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, -5, 0, 0, 1]}
+	],
+	"meshes": [{"name": "tri", "primitives": [{"attributes": {"POSITION": 1, "TEXCOORD_0": 2}, "indices": 0, "material": 0}]}],
+	"materials": [{"name": "red", "pbrMetallicRoughness": {"baseColorFactor": [1, 0, 0, 1], "metallicFactor": 0}}],
+	"accessors": [
+		{"bufferView": 0, "componentType": 5123, "count": 3, "type": "SCALAR"},
+		{"bufferView": 1, "componentType": 5126, "count": 3, "type": "VEC3"},
+		{"bufferView": 2, "componentType": 5126, "count": 3, "type": "VEC2"}
+	],
+	"bufferViews": [
+		{"buffer": 0, "byteOffset": 0, "byteLength": 8},
+		{"buffer": 0, "byteOffset": 8, "byteLength": 36},
+		{"buffer": 0, "byteOffset": 44, "byteLength": 24}
+	],
+	"buffers": [{` + uriField + `"byteLength": 68}]
+}`
+}
+
+// Pack a JSON document and a binary buffer into a GLB container.
+func genGlbContainer(doc string, bin []byte) []byte {
+	jsonChunk := []byte(doc)
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{glbMagic, glbVersion, uint32(12 + 8 + len(jsonChunk) + 8 + len(bin))})
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(jsonChunk)), glbChunkJSON})
+	buf.Write(jsonChunk)
+	binary.Write(&buf, binary.LittleEndian, []uint32{uint32(len(bin)), glbChunkBIN})
+	buf.Write(bin)
+	return buf.Bytes()
+}
+
+func TestGltfReader(t *testing.T) {
+	bin := genGltfTriangleBuffer()
+	payloads := map[string]string{
+		"gltf": genGltfDocument("data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)),
+		"glb":  string(genGlbContainer(genGltfDocument(""), bin)),
+	}
+
+	for format, payload := range payloads {
+		r := newGltfReader()
+		rawScene, err := r.ReadRaw(mockResource(payload))
+		if err != nil {
+			t.Fatalf("[%s] %v", format, err)
+		}
+
+		if rawScene.Metadata.Name != "test" {
+			t.Fatalf("[%s] expected scene name to be %q; got %q", format, "test", rawScene.Metadata.Name)
+		}
+
+		if len(rawScene.Meshes) != 1 || len(rawScene.Meshes[0].Primitives) != 1 {
+			t.Fatalf("[%s] expected a single mesh with 1 primitive", format)
+		}
+		prim := rawScene.Meshes[0].Primitives[0]
+		expVertices := [3]types.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+		if prim.Vertices != expVertices {
+			t.Fatalf("[%s] expected primitive vertices to be %v; got %v", format, expVertices, prim.Vertices)
+		}
+
+		// The uv origin is moved to the bottom-left corner
+		expUVs := [3]types.Vec2{{0, 1}, {1, 1}, {0.25, 0.25}}
+		if prim.UVs != expUVs {
+			t.Fatalf("[%s] expected primitive uvs to be %v; got %v", format, expUVs, prim.UVs)
+		}
+
+		// Missing normals are generated from the face geometry
+		expNormal := types.Vec3{0, 0, 1}
+		for corner, n := range prim.Normals {
+			if n != expNormal {
+				t.Fatalf("[%s] expected generated normal %d to be %v; got %v", format, corner, expNormal, n)
+			}
+		}
+
+		if len(rawScene.Materials) != 1 || prim.MaterialIndex != 0 {
+			t.Fatalf("[%s] expected primitive to reference the parsed material", format)
+		}
+
+		// The instances follow the depth-first order of the node hierarchy
+		expTransforms := []types.Mat4{
+			types.Translate4(types.Vec3{1, 2, 3}),
+			types.Translate4(types.Vec3{1, 2, 3}).Mul4(types.Scale4(types.Vec3{2, 2, 2})),
+			types.Translate4(types.Vec3{-5, 0, 0}),
+		}
+		if len(rawScene.MeshInstances) != len(expTransforms) {
+			t.Fatalf("[%s] expected %d mesh instances; got %d", format, len(expTransforms), len(rawScene.MeshInstances))
+		}
+		for index, mi := range rawScene.MeshInstances {
+			if mi.MeshIndex != 0 {
+				t.Fatalf("[%s] expected instance %d to reference mesh 0; got %d", format, index, mi.MeshIndex)
+			}
+			if mi.Transform != expTransforms[index] {
+				t.Fatalf("[%s] expected instance %d transform to be %v; got %v", format, index, expTransforms[index], mi.Transform)
+			}
+		}
+
+		expBBox := [2]types.Vec3{{1, 2, 3}, {3, 4, 3}}
+		if bbox := rawScene.MeshInstances[1].BBox(); bbox != expBBox {
+			t.Fatalf("[%s] expected instance 1 bbox to be %v; got %v", format, expBBox, bbox)
+		}
+	}
+}
+
+func TestGltfReaderCompile(t *testing.T) {
+	bin := genGltfTriangleBuffer()
+	payload := genGltfDocument("data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin))
+
+	r := newGltfReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.MeshInstanceList) != 3 {
+		t.Fatalf("expected compiled scene to contain 3 mesh instances; got %d", len(sc.MeshInstanceList))
+	}
+}
+
+func TestGltfReaderTangents(t *testing.T) {
+	// Append a TANGENT accessor whose tangents differ from the ones that
+	// would be calculated from the triangle uvs
+	var buf bytes.Buffer
+	buf.Write(genGltfTriangleBuffer())
+	binary.Write(&buf, binary.LittleEndian, []float32{0, 1, 0, -1, 0, 1, 0, -1, 0, 1, 0, -1})
+
+	doc := genGltfDocument("data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+	doc = strings.Replace(doc, `"TEXCOORD_0": 2}`, `"TEXCOORD_0": 2, "TANGENT": 3}`, 1)
+	doc = strings.Replace(doc, `"count": 3, "type": "VEC2"}`, `"count": 3, "type": "VEC2"},
+		{"bufferView": 3, "componentType": 5126, "count": 3, "type": "VEC4"}`, 1)
+	doc = strings.Replace(doc, `"byteOffset": 44, "byteLength": 24}`, `"byteOffset": 44, "byteLength": 24},
+		{"buffer": 0, "byteOffset": 68, "byteLength": 48}`, 1)
+	doc = strings.Replace(doc, `"byteLength": 68}]`, `"byteLength": 116}]`, 1)
+
+	expTangent := types.Vec4{0, 1, 0, -1}
+	rawScene, err := newGltfReader().ReadRaw(mockResource(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prim := rawScene.Meshes[0].Primitives[0]
+	if !prim.HasTangents {
+		t.Fatal("expected primitive to use the tangents defined by the TANGENT accessor")
+	}
+	for corner, tangent := range prim.Tangents {
+		if tangent != expTangent {
+			t.Fatalf("expected tangent %d to be %v; got %v", corner, expTangent, tangent)
+		}
+	}
+
+	sc, err := newGltfReader().Read(mockResource(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.TangentList) == 0 {
+		t.Fatal("expected compiled scene to contain tangents")
+	}
+	for index, tangent := range sc.TangentList {
+		if tangent != expTangent {
+			t.Fatalf("expected compiled tangent %d to be %v; got %v", index, expTangent, tangent)
+		}
+	}
+}
+
+func TestGltfReaderErrors(t *testing.T) {
+	bin := genGltfTriangleBuffer()
+	dataURI := "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(bin)
+
+	specs := []struct {
+		payload  string
+		expError string
+	}{
+		{
+			strings.Replace(genGltfDocument(dataURI), `"2.0"`, `"1.0"`, 1),
+			`[embedded] error: unsupported glTF version "1.0"`,
+		},
+		{
+			strings.Replace(genGltfDocument(dataURI), `"POSITION"`, `"COLOR_0"`, 1),
+			`[embedded] error: mesh "tri", primitive 0: missing POSITION attribute`,
+		},
+		{
+			strings.Replace(genGltfDocument(dataURI), `"byteLength": 36`, `"byteLength": 24`, 1),
+			`[embedded] error: mesh "tri", primitive 0: POSITION: accessor data exceeds the bounds of buffer view 1`,
+		},
+		{
+			strings.Replace(genGltfDocument(dataURI), `"children": [1]`, `"children": [0]`, 1),
+			`[embedded] error: node hierarchy exceeds the max depth of 256; the node graph may contain a cycle`,
+		},
+		{
+			genGltfDocument(""),
+			`[embedded] error: buffer 0 does not define a URI`,
+		},
+	}
+
+	for specIndex, spec := range specs {
+		r := newGltfReader()
+		_, err := r.ReadRaw(mockResource(spec.payload))
+		if err == nil || err.Error() != spec.expError {
+			t.Fatalf("[spec %d] expected error %q; got %v", specIndex, spec.expError, err)
+		}
+	}
+}
+
+func TestGltfMaterialExpression(t *testing.T) {
+	images := `[{"uri": "base.png"}, {"uri": "normal.png"}, {"uri": "emissive.png"}, {"uri": "data:image/png;base64,AAAA"}]`
+	textures := `[{"source": 0}, {"source": 1}, {"source": 2}, {"source": 3}]`
+
+	specs := []struct {
+		material string
+		expExpr  string
+	}{
+		{
+			`{}`,
+			`roughConductor(specularity: {0.999000, 0.999000, 0.999000}, roughness: 1)`,
+		},
+		{
+			`{"pbrMetallicRoughness": {"baseColorFactor": [0.5, 0.5, 0.5, 1], "metallicFactor": 0}}`,
+			`diffuse(reflectance: {0.500000, 0.500000, 0.500000})`,
+		},
+		{
+			`{"pbrMetallicRoughness": {"baseColorTexture": {"index": 0}, "metallicFactor": 0.25, "roughnessFactor": 0.5}, "normalTexture": {"index": 1}}`,
+			`normalMap(mix(roughConductor(specularity: "base.png", roughness: 0.5), diffuse(reflectance: "base.png"), 0.25), "normal.png")`,
+		},
+		{
+			`{"emissiveFactor": [2, 4, 1], "emissiveTexture": {"index": 2}}`,
+			`emissive(radiance: "emissive.png", scale: 4)`,
+		},
+		{
+			`{"emissiveFactor": [2, 4, 1]}`,
+			`emissive(radiance: {2.000000, 4.000000, 1.000000})`,
+		},
+		{
+			`{"pbrMetallicRoughness": {"baseColorFactor": [1, 1, 1, 0.5], "metallicFactor": 0}, "alphaMode": "BLEND"}`,
+			`mix(diffuse(reflectance: {0.999000, 0.999000, 0.999000}), transparent(), 0.5)`,
+		},
+		// Embedded images are ignored
+		{
+			`{"pbrMetallicRoughness": {"baseColorTexture": {"index": 3}, "metallicFactor": 0}}`,
+			`diffuse(reflectance: {0.999000, 0.999000, 0.999000})`,
+		},
+	}
+
+	for specIndex, spec := range specs {
+		r := newGltfReader()
+		err := json.Unmarshal([]byte(fmt.Sprintf(`{"images": %s, "textures": %s}`, images, textures)), &r.doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gm gltfMaterial
+		err = json.Unmarshal([]byte(spec.material), &gm)
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+
+		if expr := r.materialExpression("test", gm); expr != spec.expExpr {
+			t.Fatalf("[spec %d] expected expression to be:\n%s\ngot:\n%s", specIndex, spec.expExpr, expr)
+		}
+	}
+}
+
+func TestGltfNodeRotation(t *testing.T) {
+	// 90 degree rotation around the Z axis
+	s := float32(math.Sqrt(0.5))
+	node := gltfNode{Rotation: []float32{0, 0, s, s}}
+
+	v := node.localTransform().Mul4x1(types.Vec4{1, 0, 0, 1}).Vec3()
+	if exp := (types.Vec3{0, 1, 0}); v.Sub(exp).Len() > 1e-5 {
+		t.Fatalf("expected rotated vector to be %v; got %v", exp, v)
+	}
+}
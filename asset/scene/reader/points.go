@@ -0,0 +1,83 @@
+package reader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/types"
+)
+
+// Read a point file and generate a mesh instance for each row. Point files
+// are comma-separated and each row uses one of the following formats:
+// - tX, tY, tZ
+// - tX, tY, tZ, yaw, pitch, roll
+// - tX, tY, tZ, yaw, pitch, roll, s
+// - tX, tY, tZ, yaw, pitch, roll, sX, sY, sZ
+// where rotation angles are specified in degrees and s is a uniform scale.
+// Lines starting with '#' are ignored. If the first row cannot be parsed it
+// is treated as a header and skipped.
+func readInstancePoints(r io.Reader, meshIndex uint32, meshBBox [2]types.Vec3) ([]*input.MeshInstance, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.Comment = '#'
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	instances := make([]*input.MeshInstance, 0)
+	for rowNum := 1; ; rowNum++ {
+		row, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		values, err := parsePointRow(row)
+		if err != nil {
+			if rowNum == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: %s", rowNum, err.Error())
+		}
+
+		translation := types.Vec3{values[0], values[1], values[2]}
+		rotation := types.Vec3{}
+		scale := types.Vec3{1, 1, 1}
+		switch len(values) {
+		case 9:
+			scale = types.Vec3{values[6], values[7], values[8]}
+			fallthrough
+		case 6:
+			rotation = types.Vec3{values[3], values[4], values[5]}.Mul(math.Pi / 180.0)
+		case 7:
+			rotation = types.Vec3{values[3], values[4], values[5]}.Mul(math.Pi / 180.0)
+			scale = types.Vec3{values[6], values[6], values[6]}
+		}
+
+		instances = append(instances, newMeshInstance(meshIndex, meshBBox, translation, rotation, scale))
+	}
+
+	return instances, nil
+}
+
+// Parse the values of a point file row.
+func parsePointRow(row []string) ([]float32, error) {
+	switch len(row) {
+	case 3, 6, 7, 9:
+	default:
+		return nil, fmt.Errorf("expected 3, 6, 7 or 9 columns; got %d", len(row))
+	}
+
+	values := make([]float32, len(row))
+	for index, field := range row {
+		v, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, err
+		}
+		values[index] = float32(v)
+	}
+	return values, nil
+}
@@ -0,0 +1,84 @@
+package reader
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestReadInstancePoints(t *testing.T) {
+	payload := `x,y,z,yaw,pitch,roll,sx,sy,sz
+# scattered rocks
+1, 2, 3
+4, 5, 6, 0, 90, 0
+7, 8, 9, 0, 0, 45, 2, 3, 4
+10, 11, 12, 30, 45, 60, 2
+`
+	meshBBox := [2]types.Vec3{{-1, -1, -1}, {1, 1, 1}}
+	instances, err := readInstancePoints(strings.NewReader(payload), 3, meshBBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 4 {
+		t.Fatalf("expected 4 instances; got %d", len(instances))
+	}
+
+	// Instance transforms are composed as scale * roll * pitch * yaw * translation
+	rotate := func(yaw, pitch, roll float32) types.Mat4 {
+		return types.Rotate4(roll, types.Vec3{0, 0, 1}).Mul4(
+			types.Rotate4(pitch, types.Vec3{0, 1, 0}).Mul4(
+				types.Rotate4(yaw, types.Vec3{1, 0, 0}),
+			),
+		)
+	}
+	specs := []struct {
+		translation  types.Vec3
+		expTransform types.Mat4
+	}{
+		{
+			types.Vec3{1, 2, 3},
+			types.Translate4(types.Vec3{1, 2, 3}),
+		},
+		{
+			types.Vec3{4, 5, 6},
+			rotate(0, math.Pi/2, 0).Mul4(types.Translate4(types.Vec3{4, 5, 6})),
+		},
+		{
+			types.Vec3{7, 8, 9},
+			types.Scale4(types.Vec3{2, 3, 4}).Mul4(rotate(0, 0, math.Pi/4).Mul4(types.Translate4(types.Vec3{7, 8, 9}))),
+		},
+		{
+			types.Vec3{10, 11, 12},
+			types.Scale4(types.Vec3{2, 2, 2}).Mul4(rotate(math.Pi/6, math.Pi/4, math.Pi/3).Mul4(types.Translate4(types.Vec3{10, 11, 12}))),
+		},
+	}
+
+	for index, spec := range specs {
+		inst := instances[index]
+		if inst.MeshIndex != 3 {
+			t.Fatalf("[instance %d] expected mesh index to be 3; got %d", index, inst.MeshIndex)
+		}
+
+		for cell := range inst.Transform {
+			if math.Abs(float64(inst.Transform[cell]-spec.expTransform[cell])) > 1e-5 {
+				t.Fatalf("[instance %d] expected transform to be\n%v\ngot\n%v", index, spec.expTransform, inst.Transform)
+			}
+		}
+
+		if inst.Center() != spec.translation {
+			t.Fatalf("[instance %d] expected instance center to be %v; got %v", index, spec.translation, inst.Center())
+		}
+	}
+}
+
+func TestReadInstancePointsError(t *testing.T) {
+	payload := "1, 2, 3\n4, 5\n"
+	_, err := readInstancePoints(strings.NewReader(payload), 0, [2]types.Vec3{})
+	expError := "row 2: expected 3, 6, 7 or 9 columns; got 2"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error %q; got %v", expError, err)
+	}
+}
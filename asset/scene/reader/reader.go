@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/achilleasa/polaris/asset"
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/compiler/input"
 	"github.com/achilleasa/polaris/asset/scene"
 )
 
@@ -14,22 +16,73 @@ type Reader interface {
 	Read(*asset.Resource) (*scene.Scene, error)
 }
 
-// Read scene from file.
+// Read scene from file using the default scene compiler options.
 func ReadScene(filename string) (*scene.Scene, error) {
+	sc, _, err := ReadSceneWithOptions(filename, compiler.DefaultOptions())
+	return sc, err
+}
+
+// Read scene from file. The supplied compiler options are used when reading
+// scenes that need to be compiled. For such scenes, the diagnostics emitted
+// by the compiler are also returned; for precompiled scenes the returned
+// diagnostics are nil.
+func ReadSceneWithOptions(filename string, compilerOpts compiler.Options) (*scene.Scene, *compiler.CompileDiagnostics, error) {
 	res, err := asset.NewResource(filename, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer res.Close()
 
 	// Select reader based on file extension
 	var reader Reader
 	if strings.HasSuffix(filename, ".obj") {
-		reader = newWavefrontReader()
+		wfReader := newWavefrontReader()
+		wfReader.compilerOpts = compilerOpts
+		reader = wfReader
+	} else if strings.HasSuffix(filename, ".gltf") || strings.HasSuffix(filename, ".glb") {
+		gltfReader := newGltfReader()
+		gltfReader.compilerOpts = compilerOpts
+		reader = gltfReader
 	} else if strings.HasSuffix(filename, ".zip") {
 		reader = newZipSceneReader()
+	} else {
+		return nil, nil, fmt.Errorf("readScene: unsupported file format")
+	}
+
+	sc, err := reader.Read(res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var diagnostics *compiler.CompileDiagnostics
+	switch r := reader.(type) {
+	case *wavefrontSceneReader:
+		diagnostics = r.diagnostics
+	case *gltfSceneReader:
+		diagnostics = r.diagnostics
+	}
+	return sc, diagnostics, nil
+}
+
+// Read an uncompiled scene from a wavefront or glTF file. For wavefront files,
+// the returned scene contains an identity mesh instance for each parsed mesh
+// unless the file defines its own mesh instances. For glTF files, a mesh
+// instance is created for each node that references a mesh.
+func ReadRawScene(filename string) (*input.Scene, error) {
+	var readRaw func(*asset.Resource) (*input.Scene, error)
+	if strings.HasSuffix(filename, ".obj") {
+		readRaw = newWavefrontReader().ReadRaw
+	} else if strings.HasSuffix(filename, ".gltf") || strings.HasSuffix(filename, ".glb") {
+		readRaw = newGltfReader().ReadRaw
 	} else {
 		return nil, fmt.Errorf("readScene: unsupported file format")
 	}
-	return reader.Read(res)
+
+	res, err := asset.NewResource(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	return readRaw(res)
 }
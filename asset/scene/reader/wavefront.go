@@ -2,6 +2,7 @@ package reader
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"math"
 	"strconv"
@@ -36,6 +37,9 @@ type wavefrontMaterial struct {
 	// Index of refraction.
 	Ni float32
 
+	// Fraction of light that passes straight through the surface (1 - d).
+	Tr float32
+
 	// Textures for modulating above parameters.
 	KdTex     string
 	KsTex     string
@@ -43,6 +47,7 @@ type wavefrontMaterial struct {
 	TfTex     string
 	BumpTex   string
 	NormalTex string
+	DTex      string
 
 	// Layered material expression.
 	MaterialExpression string
@@ -50,6 +55,25 @@ type wavefrontMaterial struct {
 	// Relative path for textures.
 	AssetRelPath *asset.Resource
 
+	// True if the material textures use premultiplied alpha.
+	PremultipliedAlpha bool
+
+	// True if the material color textures are sRGB encoded.
+	SRGBTextures bool
+
+	// Anisotropic filtering level hints for the material textures.
+	TextureAnisotropy map[string]uint32
+
+	// True if the normal map should perturb the geometric normal instead
+	// of the interpolated vertex normals.
+	FlatNormalMap bool
+
+	// Cube map face images for textures defined via cube map directives.
+	CubeMaps map[string][6]string
+
+	// Layer images for texture arrays defined via texture array directives.
+	TextureArrays map[string][]string
+
 	// True if this material is used by at least one primitive.
 	Used bool
 }
@@ -136,6 +160,13 @@ type wavefrontSceneReader struct {
 	// Currently selected material.
 	curMaterial *wavefrontMaterial
 
+	// Currently selected smoothing group (0 = no smoothing).
+	curSmoothingGroup uint32
+
+	// Primitives without explicit vertex normals that belong to a smoothing
+	// group. Their normals are smoothed once the scene has been parsed.
+	smoothedPrimitives []smoothedPrimitive
+
 	// Parsed wavefront materials.
 	materials []*wavefrontMaterial
 
@@ -147,6 +178,18 @@ type wavefrontSceneReader struct {
 	// An error stack that provides additional error information when
 	// scene files include other files (models, mat libs e.t.c)
 	errStack []string
+
+	// Options for the scene compiler.
+	compilerOpts compiler.Options
+
+	// The diagnostics emitted while compiling the scene.
+	diagnostics *compiler.CompileDiagnostics
+}
+
+// A primitive that belongs to a smoothing group of a particular mesh.
+type smoothedPrimitive struct {
+	mesh *input.Mesh
+	prim *input.Primitive
 }
 
 // Create a new text scene reader.
@@ -159,11 +202,26 @@ func newWavefrontReader() *wavefrontSceneReader {
 		normalList:     make([]types.Vec3, 0),
 		uvList:         make([]types.Vec2, 0),
 		errStack:       make([]string, 0),
+		compilerOpts:   compiler.DefaultOptions(),
 	}
 }
 
 // Read scene definition.
 func (r *wavefrontSceneReader) Read(sceneRes *asset.Resource) (*scene.Scene, error) {
+	rawScene, err := r.ReadRaw(sceneRes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compile scene into an optimized, gpu-friendly format and keep
+	// track of the compiler diagnostics.
+	sc, diagnostics, err := compiler.Compile(rawScene, r.compilerOpts)
+	r.diagnostics = diagnostics
+	return sc, err
+}
+
+// Read scene definition without compiling it.
+func (r *wavefrontSceneReader) ReadRaw(sceneRes *asset.Resource) (*input.Scene, error) {
 	r.logger.Noticef(`parsing scene from "%s"`, sceneRes.Path())
 	start := time.Now()
 
@@ -173,6 +231,8 @@ func (r *wavefrontSceneReader) Read(sceneRes *asset.Resource) (*scene.Scene, err
 		return nil, err
 	}
 
+	r.applySmoothingGroups()
+
 	// If no mesh instances are defined, create instances for each defined mesh
 	if len(r.rawScene.MeshInstances) == 0 {
 		r.createDefaultMeshInstances()
@@ -182,9 +242,7 @@ func (r *wavefrontSceneReader) Read(sceneRes *asset.Resource) (*scene.Scene, err
 	r.processMaterials()
 
 	r.logger.Noticef("parsed scene in %d ms", time.Since(start).Nanoseconds()/1e6)
-
-	// Compile scene into an optimized, gpu-friendly format
-	return compiler.Compile(r.rawScene)
+	return r.rawScene, nil
 }
 
 // Generate scene materials for material entries that are in use and update the
@@ -195,7 +253,7 @@ func (r *wavefrontSceneReader) processMaterials() {
 	pruned := 0
 	for wfIndex, wfMat := range r.materials {
 		// Whitelist scene materials
-		if wfMat.Name == compiler.SceneDiffuseMaterialName || wfMat.Name == compiler.SceneEmissiveMaterialName {
+		if wfMat.Name == compiler.SceneDiffuseMaterialName || wfMat.Name == compiler.SceneEmissiveMaterialName || wfMat.Name == compiler.SceneDefaultMaterialName {
 			wfMat.Used = true
 		}
 
@@ -205,9 +263,17 @@ func (r *wavefrontSceneReader) processMaterials() {
 			prunedMaterials = append(
 				prunedMaterials,
 				&input.Material{
-					Name:         wfMat.Name,
-					Expression:   wfMat.GetExpression(),
-					AssetRelPath: wfMat.AssetRelPath,
+					Name:               wfMat.Name,
+					Expression:         wfMat.GetExpression(),
+					AssetRelPath:       wfMat.AssetRelPath,
+					PremultipliedAlpha: wfMat.PremultipliedAlpha,
+					SRGBTextures:       wfMat.SRGBTextures,
+					TextureAnisotropy:  wfMat.TextureAnisotropy,
+					FlatNormalMap:      wfMat.FlatNormalMap,
+					CubeMaps:           wfMat.CubeMaps,
+					TextureArrays:      wfMat.TextureArrays,
+					Transparency:       wfMat.Tr,
+					AlphaTex:           wfMat.DTex,
 				},
 			)
 			pruned++
@@ -217,10 +283,18 @@ func (r *wavefrontSceneReader) processMaterials() {
 		r.rawScene.Materials = append(
 			r.rawScene.Materials,
 			&input.Material{
-				Name:         wfMat.Name,
-				Expression:   wfMat.GetExpression(),
-				AssetRelPath: wfMat.AssetRelPath,
-				Used:         true,
+				Name:               wfMat.Name,
+				Expression:         wfMat.GetExpression(),
+				AssetRelPath:       wfMat.AssetRelPath,
+				PremultipliedAlpha: wfMat.PremultipliedAlpha,
+				SRGBTextures:       wfMat.SRGBTextures,
+				TextureAnisotropy:  wfMat.TextureAnisotropy,
+				FlatNormalMap:      wfMat.FlatNormalMap,
+				CubeMaps:           wfMat.CubeMaps,
+				TextureArrays:      wfMat.TextureArrays,
+				Transparency:       wfMat.Tr,
+				AlphaTex:           wfMat.DTex,
+				Used:               true,
 			},
 		)
 
@@ -274,7 +348,7 @@ func (r *wavefrontSceneReader) emitError(file string, line int, msgFormat string
 		)
 	}
 
-	return fmt.Errorf(errMsg)
+	return errors.New(errMsg)
 }
 
 // Push a frame to the error stack.
@@ -334,7 +408,7 @@ func (r *wavefrontSceneReader) parse(res *asset.Resource) error {
 
 			incRes, err := asset.NewResource(lineTokens[1], res)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 			defer incRes.Close()
 
@@ -366,19 +440,19 @@ func (r *wavefrontSceneReader) parse(res *asset.Resource) error {
 		case "v":
 			v, err := parseVec3(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 			r.vertexList = append(r.vertexList, v)
 		case "vn":
 			v, err := parseVec3(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 			r.normalList = append(r.normalList, v)
 		case "vt":
 			v, err := parseVec2(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 			r.uvList = append(r.uvList, v)
 		case "g", "o":
@@ -389,46 +463,199 @@ func (r *wavefrontSceneReader) parse(res *asset.Resource) error {
 			r.verifyLastParsedMesh()
 			r.rawScene.Meshes = append(r.rawScene.Meshes, input.NewMesh(lineTokens[1]))
 		case "f":
-			primList, err := r.parseFace(lineTokens, relVertexOffset, relUvOffset, relNormalOffset)
-			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
-			}
-
 			// If no object has been defined create a default one
 			if len(r.rawScene.Meshes) == 0 {
 				r.rawScene.Meshes = append(r.rawScene.Meshes, input.NewMesh("default"))
 			}
 
+			primList, err := r.parseFace(lineTokens, relVertexOffset, relUvOffset, relNormalOffset)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+
 			// Append primitive
 			meshIndex := len(r.rawScene.Meshes) - 1
 			r.rawScene.Meshes[meshIndex].MarkBBoxDirty()
 			r.rawScene.Meshes[meshIndex].Primitives = append(r.rawScene.Meshes[meshIndex].Primitives, primList...)
+		case "s":
+			if len(lineTokens) != 2 {
+				return r.emitError(res.Path(), lineNum, `unsupported syntax for "s"; expected 1 argument; got %d`, len(lineTokens)-1)
+			}
+
+			var group uint64
+			if lineTokens[1] != "off" {
+				group, err = strconv.ParseUint(lineTokens[1], 10, 32)
+				if err != nil {
+					return r.emitError(res.Path(), lineNum, `invalid smoothing group "%s"; expected a non-negative integer or "off"`, lineTokens[1])
+				}
+			}
+			r.curSmoothingGroup = uint32(group)
+		case "shading":
+			if len(lineTokens) != 2 {
+				return r.emitError(res.Path(), lineNum, `unsupported syntax for "shading"; expected 1 argument; got %d`, len(lineTokens)-1)
+			}
+			if len(r.rawScene.Meshes) == 0 {
+				return r.emitError(res.Path(), lineNum, `"shading" must follow an object definition`)
+			}
+
+			meshIndex := len(r.rawScene.Meshes) - 1
+			switch lineTokens[1] {
+			case "smooth":
+				r.rawScene.Meshes[meshIndex].ShadingMode = input.SmoothShading
+			case "flat":
+				r.rawScene.Meshes[meshIndex].ShadingMode = input.FlatShading
+			default:
+				return r.emitError(res.Path(), lineNum, `unsupported shading mode "%s"; expected "smooth" or "flat"`, lineTokens[1])
+			}
 		case "camera_fov":
 			r.rawScene.Camera.FOV, err = parseFloat32(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 		case "camera_eye":
 			r.rawScene.Camera.Eye, err = parseVec3(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 		case "camera_look":
 			r.rawScene.Camera.Look, err = parseVec3(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 		case "camera_up":
 			r.rawScene.Camera.Up, err = parseVec3(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "camera_roll":
+			r.rawScene.Camera.Roll, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "camera_shutter_open":
+			r.rawScene.Camera.ShutterOpen, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "camera_shutter_close":
+			r.rawScene.Camera.ShutterClose, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "camera_aperture":
+			r.rawScene.Camera.ApertureRadius, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "camera_focal_distance":
+			r.rawScene.Camera.FocalDistance, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "camera_projection":
+			if len(lineTokens) != 2 {
+				return r.emitError(res.Path(), lineNum, `unsupported syntax for "camera_projection"; expected 1 argument; got %d`, len(lineTokens)-1)
+			}
+			if _, err = scene.ParseProjection(lineTokens[1]); err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+			r.rawScene.Camera.Projection = lineTokens[1]
+		case "camera_ortho_scale":
+			r.rawScene.Camera.OrthoScale, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "medium_extinction":
+			r.rawScene.Medium.Extinction, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "medium_albedo":
+			r.rawScene.Medium.Albedo, err = parseVec3(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "medium_g":
+			r.rawScene.Medium.G, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "dome_radius":
+			r.rawScene.Dome.Radius, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "dome_ground_height":
+			r.rawScene.Dome.GroundHeight, err = parseFloat32(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+		case "point_light":
+			position, err := parseVec3(lineTokens)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+			r.rawScene.PointLights = append(r.rawScene.PointLights, &input.PointLight{
+				Position:  position,
+				Intensity: types.Vec3{1, 1, 1},
+			})
+		case "point_light_intensity", "point_light_radius":
+			if len(r.rawScene.PointLights) == 0 {
+				return r.emitError(res.Path(), lineNum, `"%s" must follow a "point_light" definition`, lineTokens[0])
+			}
+
+			light := r.rawScene.PointLights[len(r.rawScene.PointLights)-1]
+			if lineTokens[0] == "point_light_intensity" {
+				light.Intensity, err = parseVec3(lineTokens)
+			} else {
+				light.Radius, err = parseFloat32(lineTokens)
+			}
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
-		case "instance":
+		case "scene_name", "scene_author", "scene_units", "scene_created":
+			if len(lineTokens) < 2 {
+				return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected at least 1 argument; got %d`, lineTokens[0], len(lineTokens)-1)
+			}
+
+			value := strings.Join(lineTokens[1:], " ")
+			switch lineTokens[0] {
+			case "scene_name":
+				r.rawScene.Metadata.Name = value
+			case "scene_author":
+				r.rawScene.Metadata.Author = value
+			case "scene_units":
+				r.rawScene.Metadata.Units = value
+			case "scene_created":
+				r.rawScene.Metadata.Created = value
+			}
+		case "instance", "instance_proxy":
 			instance, err := r.parseMeshInstance(lineTokens)
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
+			instance.Proxy = lineTokens[0] == "instance_proxy"
 			r.rawScene.MeshInstances = append(r.rawScene.MeshInstances, instance)
+		case "instance_points":
+			if len(lineTokens) != 3 {
+				return r.emitError(res.Path(), lineNum, `unsupported syntax for "instance_points"; expected 2 arguments: mesh_name points_file; got %d`, len(lineTokens)-1)
+			}
+
+			meshIndex := r.meshIndexByName(lineTokens[1])
+			if meshIndex == -1 {
+				return r.emitError(res.Path(), lineNum, `unknown mesh with name "%s"`, lineTokens[1])
+			}
+
+			pointRes, err := asset.NewResource(lineTokens[2], res)
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
+			}
+			instances, err := readInstancePoints(pointRes, uint32(meshIndex), r.rawScene.Meshes[meshIndex].BBox())
+			pointRes.Close()
+			if err != nil {
+				return r.emitError(res.Path(), lineNum, "%s: %s", pointRes.Path(), err.Error())
+			}
+			r.rawScene.MeshInstances = append(r.rawScene.MeshInstances, instances...)
 		}
 	}
 
@@ -447,25 +674,19 @@ func (r *wavefrontSceneReader) verifyLastParsedMesh() {
 
 // Parse mesh instance definition. Definitions use the following format:
 // instance mesh_name tX tY tZ yaw pitch roll sX sY sZ
+// The instance_proxy directive uses the same format.
 // where:
 // - tX, tY, tZ       : translation vector
 // - yaw, pitch, roll : rotation angles in degrees
 // - sX, sY, sZ	      : scale
 func (r *wavefrontSceneReader) parseMeshInstance(lineTokens []string) (*input.MeshInstance, error) {
-	if len(lineTokens) != 11 {
-		return nil, fmt.Errorf(`unsupported syntax for "instance"; expected 10 arguments: mesh_name tX tY tZ yaw pitch roll sX sY sZ; got %d`, len(lineTokens)-1)
+	if len(lineTokens) != 11 && len(lineTokens) != 14 {
+		return nil, fmt.Errorf(`unsupported syntax for "%s"; expected 10 or 13 arguments: mesh_name tX tY tZ yaw pitch roll sX sY sZ [tintR tintG tintB]; got %d`, lineTokens[0], len(lineTokens)-1)
 	}
 
 	// Find object by name
 	meshName := lineTokens[1]
-	meshIndex := -1
-	for index, mesh := range r.rawScene.Meshes {
-		if mesh.Name == meshName {
-			meshIndex = index
-			break
-		}
-	}
-
+	meshIndex := r.meshIndexByName(meshName)
 	if meshIndex == -1 {
 		return nil, fmt.Errorf(`unknown mesh with name "%s"`, meshName)
 	}
@@ -500,6 +721,35 @@ func (r *wavefrontSceneReader) parseMeshInstance(lineTokens []string) (*input.Me
 		scale[index-8] = float32(v)
 	}
 
+	inst := newMeshInstance(uint32(meshIndex), r.rawScene.Meshes[meshIndex].BBox(), translation, rotation, scale)
+
+	// Parse optional tint
+	if len(lineTokens) == 14 {
+		for index := 11; index < 14; index++ {
+			v, err := strconv.ParseFloat(lineTokens[index], 32)
+			if err != nil {
+				return nil, err
+			}
+			inst.Tint[index-11] = float32(v)
+		}
+	}
+
+	return inst, nil
+}
+
+// Lookup a mesh by its name and return its index or -1 if no mesh matches.
+func (r *wavefrontSceneReader) meshIndexByName(meshName string) int {
+	for index, mesh := range r.rawScene.Meshes {
+		if mesh.Name == meshName {
+			return index
+		}
+	}
+	return -1
+}
+
+// Create a mesh instance for the given mesh using a translation vector,
+// yaw/pitch/roll rotation angles (in radians) and a scale vector.
+func newMeshInstance(meshIndex uint32, meshBBox [2]types.Vec3, translation, rotation, scale types.Vec3) *input.MeshInstance {
 	// Generate final matrix: M = T * R * S
 	yawQuat := types.QuatFromAxisAngle(types.Vec3{1, 0, 0}, rotation[0])
 	pitchQuat := types.QuatFromAxisAngle(types.Vec3{0, 1, 0}, rotation[1])
@@ -509,23 +759,22 @@ func (r *wavefrontSceneReader) parseMeshInstance(lineTokens []string) (*input.Me
 	transMat := types.Translate4(translation)
 
 	// Transform mesh bbox and recalculate a new AABB for the mesh instance
-	meshBBox := r.rawScene.Meshes[meshIndex].BBox()
 	min, max := transMat.Mul4x1(meshBBox[0].Vec4(1)).Vec3(), transMat.Mul4x1(meshBBox[1].Vec4(1)).Vec3()
 	instBBox := [2]types.Vec3{
 		types.MinVec3(min, max),
 		types.MaxVec3(min, max),
 	}
 	inst := &input.MeshInstance{
-		MeshIndex: uint32(meshIndex),
+		MeshIndex: meshIndex,
 		Transform: scaleMat.Mul4(rotMat.Mul4(transMat)),
 	}
 	inst.SetBBox(instBBox)
 	inst.SetCenter(instBBox[0].Add(instBBox[1]).Mul(0.5))
 
-	return inst, nil
+	return inst
 }
 
-// Parse face definition. Each face definitions consists of 3 arguments,
+// Parse face definition. Each face definitions consists of 3 or more arguments,
 // one for each vertex. Each one of the vertex arguments is comprised of
 // 1, 2 or 3 args separated by a slash character. The following formats are
 // supported:
@@ -537,21 +786,27 @@ func (r *wavefrontSceneReader) parseMeshInstance(lineTokens []string) (*input.Me
 // Indices start from 1 and may be negative to indicate
 // an offset off the end of the vertex/uv list.
 //
-// This method only works with triangular/quad faces and will return an error if a
-// face with more than 4 vertices is encountered.
+// Each face corner receives its own copy of the referenced position, uv and
+// normal. Corners that share a position but reference different uv or normal
+// indices are never merged so texture and normal seams are preserved.
+//
+// Faces with more than 3 vertices are triangulated using a triangle fan
+// around the first face vertex. This only produces correct results for
+// convex faces; concave faces should be triangulated by the exporter.
 func (r *wavefrontSceneReader) parseFace(lineTokens []string, relVertexOffset, relUvOffset, relNormalOffset int) ([]*input.Primitive, error) {
-	if len(lineTokens) < 4 || len(lineTokens) > 5 {
-		return nil, fmt.Errorf(`unsupported syntax for "f"; expected 3 arguments for triangular face or 4 arguments for a quad face; got %d. Select the triangulation option in your exporter`, len(lineTokens)-1)
+	if len(lineTokens) < 4 {
+		return nil, fmt.Errorf(`unsupported syntax for "f"; expected at least 3 arguments; got %d`, len(lineTokens)-1)
 	}
 
-	var vertices [4]types.Vec3
-	var normals [4]types.Vec3
-	var uv [4]types.Vec2
+	numVertices := len(lineTokens) - 1
+	vertices := make([]types.Vec3, numVertices)
+	normals := make([]types.Vec3, numVertices)
+	uv := make([]types.Vec2, numVertices)
 	var vOffset int
 	var err error
 	expIndices := 0
 	hasNormals := false
-	for arg := 0; arg < len(lineTokens)-1; arg++ {
+	for arg := 0; arg < numVertices; arg++ {
 		vTokens := strings.Split(lineTokens[arg+1], "/")
 
 		// The first arg defines the format for the following args
@@ -599,24 +854,29 @@ func (r *wavefrontSceneReader) parseFace(lineTokens []string, relVertexOffset, r
 	}
 	r.curMaterial.Used = true
 
-	// If no normals are available generate them from the vertices
-	if !hasNormals {
-		e01 := vertices[1].Sub(vertices[0])
-		e02 := vertices[2].Sub(vertices[0])
-		faceNormal := e01.Cross(e02).Normalize()
-		normals[0] = faceNormal
-		normals[1] = faceNormal
-		normals[2] = faceNormal
-		normals[3] = faceNormal
+	// Assemble vertices into a fan of primitives sharing the first face vertex
+	indiceList := make([][3]int, 0, numVertices-2)
+	for index := 1; index < numVertices-1; index++ {
+		indiceList = append(indiceList, [3]int{0, index, index + 1})
 	}
 
-	// Assemble vertices into one or two primitives depending on whether we are parsing a triangular or a quad face
-	primitives := make([]*input.Primitive, 0)
-	indiceList := [][3]int{{0, 1, 2}}
-	if len(lineTokens) == 5 {
-		indiceList = append(indiceList, [3]int{0, 2, 3})
+	// If no normals are available generate them from the vertices. The face
+	// normal is the area-weighted sum of the fan triangle normals.
+	if !hasNormals {
+		var faceNormal types.Vec3
+		for _, indices := range indiceList {
+			faceNormal = faceNormal.Add(r.compilerOpts.FrontFaceWinding.FaceNormal(vertices[indices[0]], vertices[indices[1]], vertices[indices[2]]))
+		}
+		if faceNormal.Len() != 0 {
+			faceNormal = faceNormal.Normalize()
+		}
+		for index := range normals {
+			normals[index] = faceNormal
+		}
 	}
 
+	primitives := make([]*input.Primitive, 0, len(indiceList))
+
 	var triVerts [3]types.Vec3
 	var triNormals [3]types.Vec3
 	var triUVs [3]types.Vec2
@@ -629,10 +889,11 @@ func (r *wavefrontSceneReader) parseFace(lineTokens []string, relVertexOffset, r
 		}
 
 		prim := &input.Primitive{
-			Vertices:      triVerts,
-			Normals:       triNormals,
-			UVs:           triUVs,
-			MaterialIndex: r.matNameToIndex[r.curMaterial.Name],
+			Vertices:       triVerts,
+			Normals:        triNormals,
+			UVs:            triUVs,
+			MaterialIndex:  r.matNameToIndex[r.curMaterial.Name],
+			SmoothingGroup: r.curSmoothingGroup,
 		}
 		prim.SetBBox(
 			[2]types.Vec3{
@@ -642,11 +903,38 @@ func (r *wavefrontSceneReader) parseFace(lineTokens []string, relVertexOffset, r
 		)
 		prim.SetCenter(triVerts[0].Add(triVerts[1]).Add(triVerts[2]).Mul(1.0 / 3.0))
 		primitives = append(primitives, prim)
+
+		// Generated normals are smoothed across the primitive smoothing group
+		if !hasNormals && r.curSmoothingGroup != 0 {
+			r.smoothedPrimitives = append(r.smoothedPrimitives, smoothedPrimitive{
+				mesh: r.rawScene.Meshes[len(r.rawScene.Meshes)-1],
+				prim: prim,
+			})
+		}
 	}
 
 	return primitives, nil
 }
 
+// Replace the generated normals of primitives that belong to a smoothing group
+// with the area-weighted average of the face normals of all primitives in the
+// same mesh and smoothing group that share the same vertex position. Normals
+// are never averaged across smoothing group boundaries.
+func (r *wavefrontSceneReader) applySmoothingGroups() {
+	meshes := make([]*input.Mesh, 0)
+	meshPrimitives := make(map[*input.Mesh][]*input.Primitive)
+	for _, sp := range r.smoothedPrimitives {
+		if _, exists := meshPrimitives[sp.mesh]; !exists {
+			meshes = append(meshes, sp.mesh)
+		}
+		meshPrimitives[sp.mesh] = append(meshPrimitives[sp.mesh], sp.prim)
+	}
+
+	for _, mesh := range meshes {
+		compiler.SmoothPrimitiveNormals(meshPrimitives[mesh], compiler.AreaWeightedNormals, r.compilerOpts.FrontFaceWinding)
+	}
+}
+
 // Parse a wavefront material library.
 func (r *wavefrontSceneReader) parseMaterials(res *asset.Resource) error {
 	var lineNum int = 0
@@ -720,7 +1008,18 @@ func (r *wavefrontSceneReader) parseMaterials(res *asset.Resource) error {
 				*target, err = parseVec3(lineTokens)
 			case "Ni":
 				curMaterial.Ni, err = parseFloat32(lineTokens)
-			case "map_Kd", "map_Ks", "map_Ke", "map_Tf", "map_bump", "map_normal":
+			case "d", "Tr":
+				var val float32
+				val, err = parseFloat32(lineTokens)
+				if err == nil && (val < 0 || val > 1) {
+					err = fmt.Errorf(`"%s" should be in the [0, 1] range; got %v`, lineTokens[0], val)
+				}
+
+				curMaterial.Tr = val
+				if lineTokens[0] == "d" {
+					curMaterial.Tr = 1.0 - val
+				}
+			case "map_Kd", "map_Ks", "map_Ke", "map_Tf", "map_bump", "map_normal", "map_d":
 				var target *string
 				switch lineTokens[0] {
 				case "map_Kd":
@@ -735,9 +1034,46 @@ func (r *wavefrontSceneReader) parseMaterials(res *asset.Resource) error {
 					target = &curMaterial.BumpTex
 				case "map_normal":
 					target = &curMaterial.NormalTex
+				case "map_d":
+					target = &curMaterial.DTex
 				}
 
 				*target = lineTokens[1]
+			case "cubemap_Kd", "cubemap_Ke":
+				if len(lineTokens) != 7 {
+					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 6 arguments; got %d`, lineTokens[0], len(lineTokens)-1)
+				}
+
+				var faces [6]string
+				copy(faces[:], lineTokens[1:])
+				texName := cubeMapTextureName(faces)
+
+				// Copy the cube map list as it may be shared with an included material
+				cubeMaps := make(map[string][6]string, len(curMaterial.CubeMaps)+1)
+				for name, entry := range curMaterial.CubeMaps {
+					cubeMaps[name] = entry
+				}
+				cubeMaps[texName] = faces
+				curMaterial.CubeMaps = cubeMaps
+
+				switch lineTokens[0] {
+				case "cubemap_Kd":
+					curMaterial.KdTex = texName
+				case "cubemap_Ke":
+					curMaterial.KeTex = texName
+				}
+			case "texture_array":
+				if len(lineTokens) < 3 {
+					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected at least 2 arguments; got %d`, lineTokens[0], len(lineTokens)-1)
+				}
+
+				// Copy the texture array list as it may be shared with an included material
+				texArrays := make(map[string][]string, len(curMaterial.TextureArrays)+1)
+				for name, entry := range curMaterial.TextureArrays {
+					texArrays[name] = entry
+				}
+				texArrays[lineTokens[1]] = append([]string(nil), lineTokens[2:]...)
+				curMaterial.TextureArrays = texArrays
 			case "mat_expr":
 				if len(lineTokens) < 2 {
 					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 1 argument; got %d`, lineTokens[0], len(lineTokens)-1)
@@ -748,11 +1084,43 @@ func (r *wavefrontSceneReader) parseMaterials(res *asset.Resource) error {
 					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 1 argument; got %d`, lineTokens[0], len(lineTokens)-1)
 				}
 				curMaterial.KeScaler, err = parseFloat32(lineTokens)
+			case "premultiplied_alpha":
+				if len(lineTokens) != 1 {
+					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 0 arguments; got %d`, lineTokens[0], len(lineTokens)-1)
+				}
+				curMaterial.PremultipliedAlpha = true
+			case "srgb_textures":
+				if len(lineTokens) != 1 {
+					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 0 arguments; got %d`, lineTokens[0], len(lineTokens)-1)
+				}
+				curMaterial.SRGBTextures = true
+			case "flat_normal_map":
+				if len(lineTokens) != 1 {
+					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 0 arguments; got %d`, lineTokens[0], len(lineTokens)-1)
+				}
+				curMaterial.FlatNormalMap = true
+			case "texture_anisotropy":
+				if len(lineTokens) != 3 {
+					return r.emitError(res.Path(), lineNum, `unsupported syntax for "%s"; expected 2 arguments; got %d`, lineTokens[0], len(lineTokens)-1)
+				}
+				var level float32
+				level, err = parseFloat32(lineTokens[1:])
+				if err == nil && (level < 1 || level != float32(int(level))) {
+					err = fmt.Errorf(`"%s" level should be an integer >= 1; got %v`, lineTokens[0], level)
+				}
+
+				// Copy the hint list as it may be shared with an included material
+				hints := make(map[string]uint32, len(curMaterial.TextureAnisotropy)+1)
+				for name, hint := range curMaterial.TextureAnisotropy {
+					hints[name] = hint
+				}
+				hints[lineTokens[1]] = uint32(level)
+				curMaterial.TextureAnisotropy = hints
 			}
 
 			// Report any errors
 			if err != nil {
-				return r.emitError(res.Path(), lineNum, err.Error())
+				return r.emitError(res.Path(), lineNum, "%s", err.Error())
 			}
 		}
 	}
@@ -760,6 +1128,11 @@ func (r *wavefrontSceneReader) parseMaterials(res *asset.Resource) error {
 	return nil
 }
 
+// Generate a texture name for a set of cube map faces.
+func cubeMapTextureName(faces [6]string) string {
+	return "cubemap:" + strings.Join(faces[:], ";")
+}
+
 // Given an index for a face coord type (vertex, normal, tex) calculate the
 // proper offset into the coord list. Wavefront format can also use negative
 // indices to reference elements from the end of the coord list.
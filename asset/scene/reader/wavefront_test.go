@@ -1,14 +1,17 @@
 package reader
 
 import (
-	"image"
-	"image/png"
-	"net/http"
-	"net/http/httptest"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/achilleasa/polaris/asset"
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/scene"
 	"github.com/achilleasa/polaris/types"
 )
 
@@ -83,20 +86,24 @@ func TestVec3Parser(t *testing.T) {
 func TestSelectFaceCoordinate(t *testing.T) {
 	expError := "index out of bounds"
 	type spec struct {
-		in       string
-		listLen  int
-		out      int
-		expError string
+		in        string
+		listLen   int
+		relOffset int
+		out       int
+		expError  string
 	}
 	specs := []spec{
-		{"2", 1, -1, expError},
-		{"-2", 1, -1, expError},
-		{"1", 10, 0, ""}, // indices are 1-based
-		{"-1", 10, 9, ""},
+		{"2", 1, 0, -1, expError},
+		{"-2", 1, 0, -1, expError},
+		{"1", 10, 0, 0, ""}, // indices are 1-based
+		{"-1", 10, 0, 9, ""},
+		// Positive indices are relative to the coords of the included file
+		{"1", 10, 5, 5, ""},
+		{"6", 10, 5, -1, expError},
 	}
 
 	for idx, s := range specs {
-		v, err := selectFaceCoordIndex(s.in, s.listLen)
+		v, err := selectFaceCoordIndex(s.in, s.listLen, s.relOffset)
 		if s.expError != "" && (err == nil || err.Error() != s.expError) {
 			t.Fatalf("[spec %d] expected error %s; got %v", idx, s.expError, err)
 		} else if v != s.out {
@@ -124,13 +131,16 @@ f 1/1/1 2/2/2 -1/-1/-1
 
 	res := mockResource(payload)
 	r := newWavefrontReader()
-	r.Read(res)
+	_, err := r.ReadRaw(res)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expMeshInstances := 1
-	if len(r.sceneGraph.MeshInstances) != expMeshInstances {
-		t.Fatalf("expected %d mesh instances to be generated; got %d", expMeshInstances, len(r.sceneGraph.MeshInstances))
+	if len(r.rawScene.MeshInstances) != expMeshInstances {
+		t.Fatalf("expected %d mesh instances to be generated; got %d", expMeshInstances, len(r.rawScene.MeshInstances))
 	}
-	inst0 := r.sceneGraph.MeshInstances[0]
+	inst0 := r.rawScene.MeshInstances[0]
 	if inst0.MeshIndex != 0 {
 		t.Fatalf("expected mesh instance to point to mesh at index 0; got %d", inst0.MeshIndex)
 	}
@@ -179,11 +189,14 @@ instance testObj 	0 1 0	90 0 0	10 10 10
 
 	res := mockResource(payload)
 	r := newWavefrontReader()
-	r.Read(res)
+	_, err := r.ReadRaw(res)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	expMeshInstances := 3
-	if len(r.sceneGraph.MeshInstances) != expMeshInstances {
-		t.Fatalf("expected %d mesh instances to be generated; got %d", expMeshInstances, len(r.sceneGraph.MeshInstances))
+	if len(r.rawScene.MeshInstances) != expMeshInstances {
+		t.Fatalf("expected %d mesh instances to be generated; got %d", expMeshInstances, len(r.rawScene.MeshInstances))
 	}
 
 	type spec struct {
@@ -198,7 +211,7 @@ instance testObj 	0 1 0	90 0 0	10 10 10
 		{2, types.Vec3{0, 1, 0}, types.Vec3{0, 0, 20}},
 	}
 	for idx, s := range specs {
-		inst := r.sceneGraph.MeshInstances[s.instance]
+		inst := r.rawScene.MeshInstances[s.instance]
 		out := inst.Transform.Mul4x1(s.in.Vec4(1.0)).Vec3()
 		if !types.ApproxEqual(out, s.expOut, 1e-3) {
 			t.Fatalf("[spec %d] expected transformed point with instance %d matrix to be %v; got %v", idx, s.instance, s.expOut, out)
@@ -209,7 +222,7 @@ instance testObj 	0 1 0	90 0 0	10 10 10
 		[2]types.Vec3{types.Vec3{1, 0, 1}, types.Vec3{2, 1, 1}},
 	}
 	for meshIndex, expBBox := range expBBoxes {
-		bbox := r.sceneGraph.MeshInstances[meshIndex].BBox()
+		bbox := r.rawScene.MeshInstances[meshIndex].BBox()
 		if !types.ApproxEqual(bbox[0], expBBox[0], 1e-3) {
 			t.Fatalf("[mesh inst. %d] expected bbox min to be %v; got %v", meshIndex, expBBox[0], bbox[0])
 		}
@@ -244,11 +257,11 @@ f 1/1/1 2/2/2 -1/-1/-1
 	}
 
 	expMeshes := 1
-	if len(r.sceneGraph.Meshes) != expMeshes {
-		t.Fatalf("expected %d meshes to be parsed; got %d", expMeshes, len(r.sceneGraph.Meshes))
+	if len(r.rawScene.Meshes) != expMeshes {
+		t.Fatalf("expected %d meshes to be parsed; got %d", expMeshes, len(r.rawScene.Meshes))
 	}
 
-	mesh0 := r.sceneGraph.Meshes[0]
+	mesh0 := r.rawScene.Meshes[0]
 	expName := "testObj"
 	if mesh0.Name != expName {
 		t.Fatalf("expected mesh[0] name to be '%s'; got %s", expName, mesh0.Name)
@@ -260,8 +273,8 @@ f 1/1/1 2/2/2 -1/-1/-1
 	}
 
 	expMaterials := 1
-	if len(r.sceneGraph.Materials) != expMaterials {
-		t.Fatalf("expected scene to contain %d material(s); got %d", expMaterials, len(r.sceneGraph.Materials))
+	if len(r.materials) != expMaterials {
+		t.Fatalf("expected scene to contain %d material(s); got %d", expMaterials, len(r.materials))
 	}
 
 	expPoints := []types.Vec3{
@@ -332,11 +345,11 @@ f 1 2 3 4
 	}
 
 	expMeshes := 1
-	if len(r.sceneGraph.Meshes) != expMeshes {
-		t.Fatalf("expected %d meshes to be parsed; got %d", expMeshes, len(r.sceneGraph.Meshes))
+	if len(r.rawScene.Meshes) != expMeshes {
+		t.Fatalf("expected %d meshes to be parsed; got %d", expMeshes, len(r.rawScene.Meshes))
 	}
 
-	mesh0 := r.sceneGraph.Meshes[0]
+	mesh0 := r.rawScene.Meshes[0]
 	expName := "testObj"
 	if mesh0.Name != expName {
 		t.Fatalf("expected mesh[0] name to be '%s'; got %s", expName, mesh0.Name)
@@ -348,8 +361,8 @@ f 1 2 3 4
 	}
 
 	expMaterials := 1
-	if len(r.sceneGraph.Materials) != expMaterials {
-		t.Fatalf("expected scene to contain %d material(s); got %d", expMaterials, len(r.sceneGraph.Materials))
+	if len(r.materials) != expMaterials {
+		t.Fatalf("expected scene to contain %d material(s); got %d", expMaterials, len(r.materials))
 	}
 
 	expPoints := []types.Vec3{
@@ -454,7 +467,7 @@ func TestMaterialLoaderSuccess(t *testing.T) {
 	Ks 0.1 0.2 0.3
 	Ke 0.4    0.5 0.6
 	Ni 2.5
-	Nr 0`
+	d 0.75`
 	res := mockResource(payload)
 	r := newWavefrontReader()
 	err := r.parseMaterials(res)
@@ -462,12 +475,12 @@ func TestMaterialLoaderSuccess(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	matLen := len(r.sceneGraph.Materials)
+	matLen := len(r.materials)
 	if matLen != 1 {
 		t.Fatalf("expected to parse 1 material; got %d", matLen)
 	}
 
-	mat := r.sceneGraph.Materials[0]
+	mat := r.materials[0]
 	if mat.Name != "foo" {
 		t.Fatalf("expected material name to be 'foo'; got %s", mat.Name)
 	}
@@ -488,92 +501,732 @@ func TestMaterialLoaderSuccess(t *testing.T) {
 	if mat.Ni != expScalar {
 		t.Fatalf("expected Ni to be %f; got %f", expScalar, mat.Ni)
 	}
-	expScalar = 0
-	if mat.Nr != expScalar {
-		t.Fatalf("expected Nr to be %f; got %f", expScalar, mat.Nr)
+	expScalar = 0.25
+	if mat.Tr != expScalar {
+		t.Fatalf("expected Tr to be %f; got %f", expScalar, mat.Tr)
 	}
-
 }
 
 func TestMaterialLoaderWithTextures(t *testing.T) {
-	serverFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		png.Encode(w, image.NewRGBA64(image.Rect(0, 0, 1, 1)))
-	})
-	server := httptest.NewServer(serverFn)
-	defer server.Close()
-
 	payload := `
 newmtl foo
-map_Kd SERVER/kd.png
-map_Ks SERVER/ks.png
-map_Ke SERVER/ke.png
-map_bump SERVER/bump.png
-map_Ni SERVER/ni.png
-map_Nr SERVER/nr.png
+map_Kd kd.png
+map_Ks ks.png
+map_Ke ke.png
+map_Tf tf.png
+map_bump bump.png
+map_normal normal.png
+map_d d.png
 `
-	res := mockResource(strings.Replace(payload, "SERVER", server.URL, -1))
+	res := mockResource(payload)
 	r := newWavefrontReader()
 	err := r.parseMaterials(res)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(r.sceneGraph.Materials) != 1 {
-		t.Fatalf("expected to parse 1 material; got %d", len(r.sceneGraph.Materials))
+	if len(r.materials) != 1 {
+		t.Fatalf("expected to parse 1 material; got %d", len(r.materials))
+	}
+
+	mat := r.materials[0]
+	specs := map[string]string{
+		"kd.png":     mat.KdTex,
+		"ks.png":     mat.KsTex,
+		"ke.png":     mat.KeTex,
+		"tf.png":     mat.TfTex,
+		"bump.png":   mat.BumpTex,
+		"normal.png": mat.NormalTex,
+		"d.png":      mat.DTex,
+	}
+	for expPath, texPath := range specs {
+		if texPath != expPath {
+			t.Fatalf("expected texture path to be %q; got %q", expPath, texPath)
+		}
+	}
+}
+
+func TestMaterialLoaderWithMissingTextures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-reader")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	expTexCount := 6
-	if len(r.sceneGraph.Textures) != expTexCount {
-		t.Fatalf("expected to load %d textures; got %d", expTexCount, len(r.sceneGraph.Textures))
+	objPayload := `
+mtllib scene.mtl
+o tri
+usemtl foo
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+`
+	mtlPayload := `
+newmtl foo
+map_Kd invalid.png
+`
+	err = ioutil.WriteFile(filepath.Join(dir, "scene.obj"), []byte(objPayload), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "scene.mtl"), []byte(mtlPayload), 0644)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	texIndices := 0
-	mat := r.sceneGraph.Materials[0]
-	if mat.KdTex != -1 {
-		texIndices++
+	rawScene, err := ReadRawScene(filepath.Join(dir, "scene.obj"))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if mat.KsTex != -1 {
-		texIndices++
+
+	// Missing textures are skipped with a warning while compiling the scene
+	_, diag, err := compiler.Compile(rawScene, compiler.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
 	}
-	if mat.KeTex != -1 {
-		texIndices++
+	warnings := diag.ForStage(compiler.StageTextures)
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "invalid.png") {
+		t.Fatalf("expected a warning about the missing texture; got %v", warnings)
 	}
-	if mat.NiTex != -1 {
-		texIndices++
+}
+
+func mockResource(payload string) *asset.Resource {
+	return asset.NewResourceFromStream("embedded", strings.NewReader(payload))
+}
+
+func TestTriangleUVInterpolation(t *testing.T) {
+	payload := `
+o testObj
+v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0.1 0.2
+vt 0.7 0.2
+vt 0.1 0.8
+f 1/1 2/2 3/3
+`
+
+	r := newWavefrontReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
 	}
-	if mat.NrTex != -1 {
-		texIndices++
+
+	expUVs := []types.Vec2{{0.1, 0.2}, {0.7, 0.2}, {0.1, 0.8}}
+	if len(sc.UvList) != len(expUVs) {
+		t.Fatalf("expected compiled scene to contain %d uvs; got %d", len(expUVs), len(sc.UvList))
 	}
-	if mat.NormalTex != -1 {
-		texIndices++
+	for index, exp := range expUVs {
+		if sc.UvList[index] != exp {
+			t.Fatalf("expected uv %d to be %v; got %v", index, exp, sc.UvList[index])
+		}
 	}
-	if texIndices != expTexCount {
-		t.Fatalf("expected %d texture indices to be assigned to mat0; got %d", expTexCount, texIndices)
+
+	// Interpolating at the triangle centroid should yield the averaged UV
+	var third float32 = 1.0 / 3.0
+	uv := sc.InterpolatedUV(0, types.Vec3{third, third, third})
+	expUV := types.Vec2{0.3, 0.4}
+	if d := uv.Sub(expUV); d.Dot(d) > 1e-10 {
+		t.Fatalf("expected interpolated uv at centroid to be %v; got %v", expUV, uv)
 	}
 }
 
-func TestMaterialLoaderWithMissingTextures(t *testing.T) {
+func TestFlatShadingDirective(t *testing.T) {
+	payload := `
+o testObj
+v 0 0 0
+v 1 0 0
+v 0 1 0
+vn 1 0 0
+vn 0 1 0
+vn 1 0 0
+shading flat
+f 1//1 2//2 3//3
+`
+
+	r := newWavefrontReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sc.MeshRanges[0].FlatShading {
+		t.Fatal("expected compiled mesh range to be flagged as flat shaded")
+	}
+
+	expNormal := types.Vec3{0, 0, 1}
+	for index, n := range sc.NormalList {
+		if n.Vec3() != expNormal {
+			t.Fatalf("expected normal %d to match the geometric normal %v; got %v", index, expNormal, n.Vec3())
+		}
+	}
+
+	payload = `
+o testObj
+shading faceted
+`
+	r = newWavefrontReader()
+	_, err = r.Read(mockResource(payload))
+	expError := `[embedded: 3] error: unsupported shading mode "faceted"; expected "smooth" or "flat"`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestMaterialLoaderCubeMap(t *testing.T) {
+	payload := `
+newmtl scene_diffuse_material
+cubemap_Kd px.png nx.png py.png ny.png pz.png nz.png
+`
+	r := newWavefrontReader()
+	err := r.parseMaterials(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mat := r.materials[0]
+	expFaces := [6]string{"px.png", "nx.png", "py.png", "ny.png", "pz.png", "nz.png"}
+	faces, exists := mat.CubeMaps[mat.KdTex]
+	if !exists {
+		t.Fatalf("expected KdTex %q to reference a cube map", mat.KdTex)
+	}
+	if faces != expFaces {
+		t.Fatalf("expected cube map faces to be %v; got %v", expFaces, faces)
+	}
+
+	payload = `
+newmtl foo
+cubemap_Ke px.png nx.png
+`
+	err = newWavefrontReader().parseMaterials(mockResource(payload))
+	expError := `[embedded: 3] error: unsupported syntax for "cubemap_Ke"; expected 6 arguments; got 2`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error: %s; got %v", expError, err)
+	}
+}
+
+func TestMaterialLoaderFlatNormalMap(t *testing.T) {
 	payload := `
 newmtl foo
-map_Kd invalid.png
+map_normal foo-n.png
+flat_normal_map
 `
-	res := mockResource(payload)
 	r := newWavefrontReader()
-	err := r.parseMaterials(res)
+	err := r.parseMaterials(mockResource(payload))
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if len(r.sceneGraph.Textures) != 0 {
-		t.Fatalf("expected texture list to be empty; got %d items", len(r.sceneGraph.Textures))
+	if !r.materials[0].FlatNormalMap {
+		t.Fatal("expected material to use the geometric normal as the normal map base")
 	}
 
-	mat := r.sceneGraph.Materials[0]
-	if mat.KdTex != -1 {
-		t.Fatalf("expected kdTex to be -1 for missing texture; got %d", mat.KdTex)
+	payload = `
+newmtl foo
+flat_normal_map yes
+`
+	err = newWavefrontReader().parseMaterials(mockResource(payload))
+	expError := `[embedded: 3] error: unsupported syntax for "flat_normal_map"; expected 0 arguments; got 1`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error: %s; got %v", expError, err)
 	}
 }
 
-func mockResource(payload string) *asset.Resource {
-	return asset.NewResourceFromStream("embedded", strings.NewReader(payload))
+func TestMaterialLoaderSRGBTextures(t *testing.T) {
+	payload := `
+newmtl foo
+map_Kd foo.png
+srgb_textures
+`
+	r := newWavefrontReader()
+	err := r.parseMaterials(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.materials[0].SRGBTextures {
+		t.Fatal("expected material color textures to be flagged as sRGB encoded")
+	}
+
+	payload = `
+newmtl foo
+srgb_textures yes
+`
+	err = newWavefrontReader().parseMaterials(mockResource(payload))
+	expError := `[embedded: 3] error: unsupported syntax for "srgb_textures"; expected 0 arguments; got 1`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error: %s; got %v", expError, err)
+	}
+}
+
+func TestMaterialLoaderTextureAnisotropy(t *testing.T) {
+	payload := `
+newmtl road
+map_Kd road.png
+texture_anisotropy road.png 16
+
+newmtl road-edge
+include road
+texture_anisotropy edge.png 4
+`
+	r := newWavefrontReader()
+	err := r.parseMaterials(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expHints := []map[string]uint32{
+		{"road.png": 16},
+		{"road.png": 16, "edge.png": 4},
+	}
+	for index, exp := range expHints {
+		if !reflect.DeepEqual(r.materials[index].TextureAnisotropy, exp) {
+			t.Fatalf("[material %d] expected texture anisotropy hints to be %v; got %v", index, exp, r.materials[index].TextureAnisotropy)
+		}
+	}
+
+	payload = `
+newmtl foo
+texture_anisotropy foo.png 0.5
+`
+	err = newWavefrontReader().parseMaterials(mockResource(payload))
+	expError := `[embedded: 3] error: "texture_anisotropy" level should be an integer >= 1; got 0.5`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error: %s; got %v", expError, err)
+	}
+}
+
+func TestSmoothingGroups(t *testing.T) {
+	// Two faces that meet at a right angle along the edge between
+	// vertices 1 and 2.
+	payloadTpl := `
+o testObj
+v 0 0 0
+v 1 0 0
+v 0.5 1 0
+v 0.5 0 1
+s %s
+f 1 2 3
+s %s
+f 2 1 4
+`
+	floorNormal := types.Vec3{0, 0, 1}
+	wallNormal := types.Vec3{0, 1, 0}
+	edgeNormal := floorNormal.Add(wallNormal).Normalize()
+
+	specs := []struct {
+		groups     [2]string
+		expNormals [2][3]types.Vec3
+	}{
+		// Different groups; normals should not be averaged across the shared edge
+		{
+			[2]string{"1", "2"},
+			[2][3]types.Vec3{
+				{floorNormal, floorNormal, floorNormal},
+				{wallNormal, wallNormal, wallNormal},
+			},
+		},
+		// Same group; the shared edge normals should be averaged
+		{
+			[2]string{"1", "1"},
+			[2][3]types.Vec3{
+				{edgeNormal, edgeNormal, floorNormal},
+				{edgeNormal, edgeNormal, wallNormal},
+			},
+		},
+		// Smoothing disabled; flat shading
+		{
+			[2]string{"off", "0"},
+			[2][3]types.Vec3{
+				{floorNormal, floorNormal, floorNormal},
+				{wallNormal, wallNormal, wallNormal},
+			},
+		},
+	}
+
+	for specIndex, spec := range specs {
+		r := newWavefrontReader()
+		err := r.parse(mockResource(fmt.Sprintf(payloadTpl, spec.groups[0], spec.groups[1])))
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+		r.applySmoothingGroups()
+
+		prims := r.rawScene.Meshes[0].Primitives
+		for primIndex, prim := range prims {
+			for corner, n := range prim.Normals {
+				exp := spec.expNormals[primIndex][corner]
+				if n.Sub(exp).Len() > 1e-5 {
+					t.Fatalf("[spec %d] expected normal %d of primitive %d to be %v; got %v", specIndex, corner, primIndex, exp, n)
+				}
+			}
+		}
+	}
+
+	r := newWavefrontReader()
+	err := r.parse(mockResource("s smooth\n"))
+	expError := `[embedded: 1] error: invalid smoothing group "smooth"; expected a non-negative integer or "off"`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestFaceSeamsAreNotWelded(t *testing.T) {
+	// A unit cube where each face maps to its own strip of the texture
+	// and uses its own normal. Each cube corner is shared by 3 faces that
+	// reference different uv and normal indices.
+	payload := `
+o cube
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+vn 0 0 -1
+vn 0 0 1
+vn 0 -1 0
+vn 0 1 0
+vn -1 0 0
+vn 1 0 0
+`
+	faces := [6][4]int{
+		{1, 4, 3, 2},
+		{5, 6, 7, 8},
+		{1, 2, 6, 5},
+		{4, 8, 7, 3},
+		{1, 5, 8, 4},
+		{2, 3, 7, 6},
+	}
+	cornerUVs := [4]types.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	for face := range faces {
+		for _, uv := range cornerUVs {
+			payload += fmt.Sprintf("vt %f %f\n", (float32(face)+uv[0])/6.0, uv[1])
+		}
+	}
+	for face, vertices := range faces {
+		payload += "f"
+		for corner, vertex := range vertices {
+			payload += fmt.Sprintf(" %d/%d/%d", vertex, 4*face+corner+1, face+1)
+		}
+		payload += "\n"
+	}
+
+	r := newWavefrontReader()
+	err := r.parse(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Quad faces are split into triangles (0, 1, 2) and (0, 2, 3)
+	prims := r.rawScene.Meshes[0].Primitives
+	if len(prims) != 12 {
+		t.Fatalf("expected 12 primitives; got %d", len(prims))
+	}
+	for primIndex, prim := range prims {
+		face := primIndex / 2
+		corners := [3]int{0, 1 + primIndex%2, 2 + primIndex%2}
+		for triIndex, corner := range corners {
+			expUV := types.Vec2{(float32(face) + cornerUVs[corner][0]) / 6.0, cornerUVs[corner][1]}
+			if d := prim.UVs[triIndex].Sub(expUV); d.Dot(d) > 1e-10 {
+				t.Fatalf("expected uv %d of primitive %d to be %v; got %v", triIndex, primIndex, expUV, prim.UVs[triIndex])
+			}
+			expNormal := r.normalList[face]
+			if prim.Normals[triIndex] != expNormal {
+				t.Fatalf("expected normal %d of primitive %d to be %v; got %v", triIndex, primIndex, expNormal, prim.Normals[triIndex])
+			}
+		}
+	}
+
+	// Indexing the compiled scene should only merge corners of the same
+	// face; each of the 8 cube positions should appear in 3 unique vertices.
+	r = newWavefrontReader()
+	r.compilerOpts.IndexVertices = true
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sc.VertexList) != 24 {
+		t.Fatalf("expected indexed scene to contain 24 unique vertices; got %d", len(sc.VertexList))
+	}
+	positionCount := make(map[types.Vec3]int)
+	for _, vertex := range sc.VertexList {
+		positionCount[vertex.Vec3()]++
+	}
+	for position, count := range positionCount {
+		if count != 3 {
+			t.Fatalf("expected position %v to appear in 3 unique vertices; got %d", position, count)
+		}
+	}
+}
+
+func TestSceneMetadata(t *testing.T) {
+	payload := `
+scene_name Cornell box
+scene_author Jane Doe
+scene_units meters
+scene_created 2016-05-14
+o testObj
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+`
+
+	r := newWavefrontReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expMetadata := scene.Metadata{
+		Name:    "Cornell box",
+		Author:  "Jane Doe",
+		Units:   "meters",
+		Created: "2016-05-14",
+	}
+	if sc.Metadata != expMetadata {
+		t.Fatalf("expected scene metadata to be %+v; got %+v", expMetadata, sc.Metadata)
+	}
+
+	r = newWavefrontReader()
+	_, err = r.Read(mockResource("scene_name"))
+	expError := `[embedded: 1] error: unsupported syntax for "scene_name"; expected at least 1 argument; got 0`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestPointLights(t *testing.T) {
+	payload := `
+point_light 1 2 3
+point_light_intensity 10 5 2.5
+point_light_radius 0.25
+point_light -1 0 0
+o testObj
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+`
+
+	r := newWavefrontReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := []struct {
+		center    types.Vec3
+		radius    float32
+		intensity types.Vec3
+	}{
+		{types.Vec3{1, 2, 3}, 0.25, types.Vec3{10, 5, 2.5}},
+		{types.Vec3{-1, 0, 0}, 0, types.Vec3{1, 1, 1}},
+	}
+	if len(sc.EmissivePrimitives) != len(specs) {
+		t.Fatalf("expected %d emissive primitives; got %d", len(specs), len(sc.EmissivePrimitives))
+	}
+	for index, spec := range specs {
+		emp := sc.EmissivePrimitives[index]
+		if emp.Type != scene.SphereLight {
+			t.Fatalf("[light %d] expected a sphere light; got type %d", index, emp.Type)
+		}
+		if center := emp.Transform.Mul4x1(types.Vec4{0, 0, 0, 1}).Vec3(); center != spec.center {
+			t.Fatalf("[light %d] expected light center to be %v; got %v", index, spec.center, center)
+		}
+		if emp.Transform[0] != spec.radius {
+			t.Fatalf("[light %d] expected light radius to be %f; got %f", index, spec.radius, emp.Transform[0])
+		}
+		if intensity := sc.EmissiveRadiance(uint32(index)); intensity != spec.intensity {
+			t.Fatalf("[light %d] expected light intensity to be %v; got %v", index, spec.intensity, intensity)
+		}
+	}
+
+	r = newWavefrontReader()
+	_, err = r.Read(mockResource("point_light_radius 1"))
+	expError := `[embedded: 1] error: "point_light_radius" must follow a "point_light" definition`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestOrthographicCamera(t *testing.T) {
+	payload := `
+camera_projection orthographic
+camera_ortho_scale 2.5
+o testObj
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+`
+
+	r := newWavefrontReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.Camera.Projection != scene.ProjectionOrthographic || sc.Camera.OrthoScale != 2.5 {
+		t.Fatalf("expected an orthographic camera with scale 2.5; got %v camera with scale %f", sc.Camera.Projection, sc.Camera.OrthoScale)
+	}
+
+	r = newWavefrontReader()
+	_, err = r.Read(mockResource("camera_projection stereographic"))
+	expError := `[embedded: 1] error: unsupported camera projection "stereographic"; supported values are: perspective, orthographic, equirectangular, fisheye, panini`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestInstanceProxyDirective(t *testing.T) {
+	payload := `
+o testObj
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+instance testObj 0 0 0 0 0 0 1 1 1
+instance_proxy testObj 5 0 0 0 0 0 1 1 1
+`
+
+	r := newWavefrontReader()
+	sc, err := r.Read(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.MeshRanges) != 2 {
+		t.Fatalf("expected a proxy mesh range to be generated; got %d mesh ranges", len(sc.MeshRanges))
+	}
+	if sc.MeshInstanceList[0].MeshIndex != 0 {
+		t.Fatalf("expected instance 0 to reference mesh 0; got %d", sc.MeshInstanceList[0].MeshIndex)
+	}
+	if sc.MeshInstanceList[1].MeshIndex != 1 {
+		t.Fatalf("expected proxied instance to reference the proxy mesh 1; got %d", sc.MeshInstanceList[1].MeshIndex)
+	}
+	if sc.MeshRanges[1].PrimitiveCount != 12 {
+		t.Fatalf("expected proxy mesh to contain 12 primitives; got %d", sc.MeshRanges[1].PrimitiveCount)
+	}
+}
+
+func TestParsePolygonFace(t *testing.T) {
+	// A convex pentagon in the XY plane without normals
+	payload := `
+o testObj
+v 0 0 0
+v 2 0 0
+v 3 1 0
+v 1 2 0
+v -1 1 0
+f 1 2 3 4 5
+`
+
+	r := newWavefrontReader()
+	err := r.parse(mockResource(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prims := r.rawScene.Meshes[0].Primitives
+	if len(prims) != 3 {
+		t.Fatalf("expected pentagon to be triangulated into 3 primitives; got %d", len(prims))
+	}
+
+	expNormal := types.Vec3{0, 0, 1}
+	for primIndex, prim := range prims {
+		expVertices := [3]types.Vec3{r.vertexList[0], r.vertexList[primIndex+1], r.vertexList[primIndex+2]}
+		if prim.Vertices != expVertices {
+			t.Fatalf("expected primitive %d vertices to be %v; got %v", primIndex, expVertices, prim.Vertices)
+		}
+		for corner, n := range prim.Normals {
+			if n.Sub(expNormal).Len() > 1e-5 {
+				t.Fatalf("expected generated normal %d of primitive %d to be %v; got %v", corner, primIndex, expNormal, n)
+			}
+		}
+	}
+
+	r = newWavefrontReader()
+	err = r.parse(mockResource("v 0 0 0\nv 1 0 0\nf 1 2\n"))
+	expError := `[embedded: 3] error: unsupported syntax for "f"; expected at least 3 arguments; got 2`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+func TestReadRawScene(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	objPayload := `
+mtllib scene.mtl
+o tri
+usemtl red
+v 0 0 0
+v 1 0 0
+v 0 1 0
+f 1 2 3
+o quad
+usemtl red
+v 0 0 1
+v 1 0 1
+v 1 1 1
+v 0 1 1
+f 4 5 6 7
+`
+	mtlPayload := `
+newmtl red
+Kd 1 0 0
+newmtl unused
+Kd 0 1 0
+`
+	err = ioutil.WriteFile(filepath.Join(dir, "scene.obj"), []byte(objPayload), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "scene.mtl"), []byte(mtlPayload), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawScene, err := ReadRawScene(filepath.Join(dir, "scene.obj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rawScene.Meshes) != 2 {
+		t.Fatalf("expected 2 meshes; got %d", len(rawScene.Meshes))
+	}
+	if len(rawScene.Meshes[1].Primitives) != 2 {
+		t.Fatalf("expected quad mesh to contain 2 primitives; got %d", len(rawScene.Meshes[1].Primitives))
+	}
+	if len(rawScene.MeshInstances) != 2 {
+		t.Fatalf("expected 2 default mesh instances; got %d", len(rawScene.MeshInstances))
+	}
+	for index, mi := range rawScene.MeshInstances {
+		if mi.MeshIndex != uint32(index) || mi.Transform != types.Ident4() {
+			t.Fatalf("expected instance %d to be an identity instance of mesh %d; got mesh %d with transform %v", index, index, mi.MeshIndex, mi.Transform)
+		}
+	}
+	if len(rawScene.Materials) == 0 || rawScene.Materials[0].Name != "red" || !rawScene.Materials[0].Used {
+		t.Fatalf("expected the first scene material to be the used \"red\" material")
+	}
+	for _, mat := range rawScene.Materials[1:] {
+		if mat.Used {
+			t.Fatalf("expected material %q to be flagged as unused", mat.Name)
+		}
+	}
+
+	_, err = ReadRawScene(filepath.Join(dir, "scene.zip"))
+	expError := "readScene: unsupported file format"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
 }
@@ -0,0 +1,136 @@
+package scene
+
+import (
+	"reflect"
+
+	"github.com/achilleasa/polaris/asset/material"
+)
+
+// A summary of the compiled scene contents.
+type ReportSummary struct {
+	Meshes             int `json:"meshes"`
+	MeshInstances      int `json:"mesh_instances"`
+	Primitives         int `json:"primitives"`
+	EmissivePrimitives int `json:"emissive_primitives"`
+	MaterialNodes      int `json:"material_nodes"`
+	Textures           int `json:"textures"`
+}
+
+// The memory used by a particular scene asset.
+type ReportMemoryEntry struct {
+	Asset string `json:"asset"`
+	Bytes int    `json:"bytes"`
+}
+
+// A material tree node entry.
+type ReportMaterialEntry struct {
+	Index int    `json:"index"`
+	Type  string `json:"type"`
+	Root  bool   `json:"root"`
+}
+
+// A texture metadata entry.
+type ReportTextureEntry struct {
+	Index      int    `json:"index"`
+	Format     string `json:"format"`
+	Width      uint32 `json:"width"`
+	Height     uint32 `json:"height"`
+	DataOffset uint32 `json:"data_offset"`
+	Layers     uint32 `json:"layers"`
+	MipLevels  uint32 `json:"mip_levels"`
+	WrapMode   string `json:"wrap_mode"`
+}
+
+// A report with introspection information about a compiled scene.
+type Report struct {
+	Metadata  Metadata              `json:"metadata"`
+	Summary   ReportSummary         `json:"summary"`
+	Memory    []ReportMemoryEntry   `json:"memory"`
+	Materials []ReportMaterialEntry `json:"materials"`
+	Textures  []ReportTextureEntry  `json:"textures"`
+}
+
+// Generate an introspection report for the scene.
+func (sc *Scene) Report() *Report {
+	r := &Report{
+		Metadata: sc.Metadata,
+		Summary: ReportSummary{
+			Meshes:             len(sc.MeshRanges),
+			MeshInstances:      len(sc.MeshInstanceList),
+			Primitives:         len(sc.MaterialIndex),
+			EmissivePrimitives: len(sc.EmissivePrimitives),
+			MaterialNodes:      len(sc.MaterialNodeList),
+			Textures:           len(sc.TextureMetadata),
+		},
+		Memory: []ReportMemoryEntry{
+			{"vertices", sizeOf(sc.VertexList)},
+			{"normals", sizeOf(sc.NormalList)},
+			{"uvs", sizeOf(sc.UvList)},
+			{"tangents", sizeOf(sc.TangentList)},
+			{"indices", sizeOf(sc.IndexList)},
+			{"bvh", sizeOf(sc.BvhNodeList)},
+			{"mesh instances", sizeOf(sc.MeshInstanceList)},
+			{"emissives", sizeOf(sc.EmissivePrimitives)},
+			{"material indices", sizeOf(sc.MaterialIndex)},
+			{"material nodes", sizeOf(sc.MaterialNodeList)},
+			{"texture metadata", sizeOf(sc.TextureMetadata)},
+			{"texture data", sizeOf(sc.TextureData)},
+		},
+		Materials: make([]ReportMaterialEntry, len(sc.MaterialNodeList)),
+		Textures:  make([]ReportTextureEntry, len(sc.TextureMetadata)),
+	}
+
+	// Flag material tree roots
+	roots := make(map[int32]bool, 0)
+	for _, root := range sc.MaterialRoots {
+		roots[root] = true
+	}
+	for index, node := range sc.MaterialNodeList {
+		nodeType := uint32(node.Union1[0])
+		typeName := "invalid"
+		if material.IsBxdfType(nodeType) {
+			typeName = material.BxdfType(nodeType).String()
+		} else if material.IsOpType(nodeType) {
+			typeName = material.OpType(nodeType).String()
+		}
+		r.Materials[index] = ReportMaterialEntry{
+			Index: index,
+			Type:  typeName,
+			Root:  roots[int32(index)],
+		}
+	}
+
+	for index, meta := range sc.TextureMetadata {
+		r.Textures[index] = ReportTextureEntry{
+			Index:      index,
+			Format:     meta.Format.String(),
+			Width:      meta.Width,
+			Height:     meta.Height,
+			DataOffset: meta.DataOffset,
+			Layers:     meta.Layers,
+			MipLevels:  meta.MipLevelCount,
+			WrapMode:   meta.WrapMode.String(),
+		}
+	}
+
+	return r
+}
+
+// Get the size in bytes of each flat scene array. Tracers upload each array
+// to a separate device buffer so the returned sizes can be used for estimating
+// the device memory footprint of the scene.
+func (sc *Scene) ArraySizes() []uint64 {
+	sections := sc.mappedSections()
+	sizes := make([]uint64, len(sections))
+	for index, slicePtr := range sections {
+		sizes[index] = uint64(sizeOf(reflect.ValueOf(slicePtr).Elem().Interface()))
+	}
+	return sizes
+}
+
+// Calculate the space used by a slice in bytes.
+func sizeOf(item interface{}) int {
+	t := reflect.TypeOf(item)
+	v := reflect.ValueOf(item)
+	return int(t.Elem().Size()) * v.Len()
+}
@@ -0,0 +1,64 @@
+package scene
+
+import (
+	"fmt"
+	"math"
+)
+
+// The efficiency curve of the camera shutter over the normalized [0, 1]
+// shutter interval. The curve is a trapezoid: the shutter efficiency rises
+// linearly from 0 to 1 while the shutter opens, stays at 1 while it is fully
+// open and falls linearly back to 0 while it closes. Times for motion blur
+// are sampled proportionally to the shutter efficiency so the leading and
+// trailing edges of moving objects receive less weight than the fully open
+// portion of the interval.
+//
+// The zero value describes a box shutter which opens and closes instantly
+// and samples times uniformly.
+type Shutter struct {
+	// The fraction of the shutter interval spent opening the shutter.
+	OpenRamp float32
+
+	// The fraction of the shutter interval spent closing the shutter.
+	CloseRamp float32
+}
+
+// Check that the ramp durations are non-negative and fit in the shutter interval.
+func (s Shutter) Validate() error {
+	if s.OpenRamp < 0 || s.CloseRamp < 0 || s.OpenRamp+s.CloseRamp > 1 {
+		return fmt.Errorf("shutter open and close ramps must be >= 0 and their sum must not exceed 1; got %f and %f", s.OpenRamp, s.CloseRamp)
+	}
+	return nil
+}
+
+// Get the normalized shutter efficiency at time t in the [0, 1] range.
+func (s Shutter) Efficiency(t float32) float32 {
+	switch {
+	case t < 0 || t > 1:
+		return 0
+	case t < s.OpenRamp:
+		return t / s.OpenRamp
+	case t > 1-s.CloseRamp:
+		return (1 - t) / s.CloseRamp
+	}
+	return 1
+}
+
+// Map a uniform random number in the [0, 1) range to a shutter time in the
+// [0, 1] range with a probability density proportional to the shutter
+// efficiency. This is done by inverting the CDF of the trapezoid curve.
+func (s Shutter) SampleTime(u float32) float32 {
+	a, b := float64(s.OpenRamp), float64(s.CloseRamp)
+	uf := float64(u)
+
+	// Scale factor that normalizes the area under the curve to 1
+	h := 1 / (1 - 0.5*(a+b))
+
+	switch {
+	case uf < 0.5*h*a:
+		return float32(math.Sqrt(2 * a * uf / h))
+	case uf < h*(1-b-0.5*a):
+		return float32(uf/h + 0.5*a)
+	}
+	return float32(1 - math.Sqrt(math.Max(0, 2*b*(1-uf)/h)))
+}
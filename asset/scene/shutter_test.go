@@ -0,0 +1,75 @@
+package scene
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShutterSampling(t *testing.T) {
+	const numSamples = 10000
+
+	// Sample times using a stratified set of random numbers and return the
+	// fraction of samples that fall in the [from, to) range.
+	sampleFraction := func(s Shutter, from, to float32) float32 {
+		var count int
+		for index := 0; index < numSamples; index++ {
+			sampleTime := s.SampleTime((float32(index) + 0.5) / numSamples)
+			if sampleTime < 0 || sampleTime > 1 {
+				t.Fatalf("expected sampled time to be in the [0, 1] range; got %f", sampleTime)
+			}
+			if sampleTime >= from && sampleTime < to {
+				count++
+			}
+		}
+		return float32(count) / numSamples
+	}
+
+	approxEqual := func(v1, v2 float32) bool {
+		return math.Abs(float64(v1-v2)) < 1e-3
+	}
+
+	// A box shutter samples times uniformly
+	box := Shutter{}
+	if got := sampleFraction(box, 0, 0.25); !approxEqual(got, 0.25) {
+		t.Fatalf("expected box shutter to place 25%% of samples in the first quarter; got %f", got)
+	}
+
+	// A shutter that spends half the interval opening should place
+	// 1/3 of the samples in the ramp and 2/3 in the open portion.
+	ramp := Shutter{OpenRamp: 0.5}
+	if got := sampleFraction(ramp, 0, 0.5); !approxEqual(got, 1.0/3.0) {
+		t.Fatalf("expected ramp shutter to place 1/3 of samples while opening; got %f", got)
+	}
+	if got := sampleFraction(ramp, 0.5, 1.01); !approxEqual(got, 2.0/3.0) {
+		t.Fatalf("expected ramp shutter to place 2/3 of samples while open; got %f", got)
+	}
+
+	// Within the ramp the sample density should follow the efficiency curve
+	if early, late := sampleFraction(ramp, 0, 0.25), sampleFraction(ramp, 0.25, 0.5); early >= late {
+		t.Fatalf("expected fewer samples at the start of the opening ramp; got %f (start) and %f (end)", early, late)
+	}
+
+	// Open and close ramps should be symmetric
+	trapezoid := Shutter{OpenRamp: 0.25, CloseRamp: 0.25}
+	if opening, closing := sampleFraction(trapezoid, 0, 0.25), sampleFraction(trapezoid, 0.75, 1.01); !approxEqual(opening, closing) {
+		t.Fatalf("expected symmetric ramps to receive the same number of samples; got %f (open) and %f (close)", opening, closing)
+	}
+}
+
+func TestShutterValidation(t *testing.T) {
+	specs := []struct {
+		shutter Shutter
+		expErr  bool
+	}{
+		{Shutter{}, false},
+		{Shutter{OpenRamp: 0.5, CloseRamp: 0.5}, false},
+		{Shutter{OpenRamp: -0.1}, true},
+		{Shutter{OpenRamp: 0.75, CloseRamp: 0.5}, true},
+	}
+
+	for specIndex, spec := range specs {
+		if err := spec.shutter.Validate(); (err != nil) != spec.expErr {
+			t.Fatalf("[spec %d] expected error: %t; got %v", specIndex, spec.expErr, err)
+		}
+	}
+}
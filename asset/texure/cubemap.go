@@ -0,0 +1,222 @@
+package texture
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+type CubeFace uint8
+
+// Cube map faces in the order expected by NewFromCubeFaces.
+const (
+	CubeFacePosX CubeFace = iota
+	CubeFaceNegX
+	CubeFacePosY
+	CubeFaceNegY
+	CubeFacePosZ
+	CubeFaceNegZ
+)
+
+func (f CubeFace) String() string {
+	switch f {
+	case CubeFacePosX:
+		return "+X"
+	case CubeFaceNegX:
+		return "-X"
+	case CubeFacePosY:
+		return "+Y"
+	case CubeFaceNegY:
+		return "-Y"
+	case CubeFacePosZ:
+		return "+Z"
+	case CubeFaceNegZ:
+		return "-Z"
+	}
+
+	return "unknown"
+}
+
+// Map a direction vector to a cube face and the uv coordinates within that
+// face. The face layout follows the OpenGL cube map conventions with the uv
+// origin at the top-left corner of each face image.
+func CubeFaceUV(dir types.Vec3) (CubeFace, types.Vec2) {
+	absX := float32(math.Abs(float64(dir[0])))
+	absY := float32(math.Abs(float64(dir[1])))
+	absZ := float32(math.Abs(float64(dir[2])))
+
+	var face CubeFace
+	var sc, tc, ma float32
+	switch {
+	case absX >= absY && absX >= absZ:
+		ma = absX
+		if dir[0] > 0 {
+			face, sc, tc = CubeFacePosX, -dir[2], -dir[1]
+		} else {
+			face, sc, tc = CubeFaceNegX, dir[2], -dir[1]
+		}
+	case absY >= absZ:
+		ma = absY
+		if dir[1] > 0 {
+			face, sc, tc = CubeFacePosY, dir[0], dir[2]
+		} else {
+			face, sc, tc = CubeFaceNegY, dir[0], -dir[2]
+		}
+	default:
+		ma = absZ
+		if dir[2] > 0 {
+			face, sc, tc = CubeFacePosZ, dir[0], -dir[1]
+		} else {
+			face, sc, tc = CubeFaceNegZ, -dir[0], -dir[1]
+		}
+	}
+
+	if ma == 0 {
+		return CubeFacePosX, types.Vec2{0.5, 0.5}
+	}
+
+	return face, types.Vec2{
+		0.5 * (sc/ma + 1.0),
+		0.5 * (tc/ma + 1.0),
+	}
+}
+
+// Convert a set of six cube map face textures into a lat/lng texture that
+// uses the same mapping as the tracer's environment lookups. The faces must
+// be supplied in +X, -X, +Y, -Y, +Z, -Z order and be square textures of the
+// same size and format. The generated texture is 4x the face size wide and
+// 2x the face size high.
+func NewFromCubeFaces(faces [6]*Texture) (*Texture, error) {
+	for index, face := range faces {
+		if face == nil {
+			return nil, fmt.Errorf("texture: missing cube map face %s", CubeFace(index))
+		}
+		if face.Width != face.Height {
+			return nil, fmt.Errorf("texture: cube map face %s is not square (%dx%d)", CubeFace(index), face.Width, face.Height)
+		}
+		if face.Width != faces[0].Width || face.Format != faces[0].Format {
+			return nil, fmt.Errorf("texture: cube map face %s should be a %dx%d %s texture; got %dx%d %s", CubeFace(index), faces[0].Width, faces[0].Height, faces[0].Format, face.Width, face.Height, face.Format)
+		}
+		if len(face.Data) < int(face.Width*face.Height)*face.Format.texelSize() {
+			return nil, fmt.Errorf("texture: cube map face %s contains insufficient data", CubeFace(index))
+		}
+	}
+
+	faceSize := faces[0].Width
+	out := &Texture{
+		Format: faces[0].Format,
+		Width:  4 * faceSize,
+		Height: 2 * faceSize,
+	}
+	out.Data = make([]byte, int(out.Width*out.Height)*out.Format.texelSize())
+
+	for y := uint32(0); y < out.Height; y++ {
+		theta := math.Pi * (float64(y) + 0.5) / float64(out.Height)
+		for x := uint32(0); x < out.Width; x++ {
+			phi := 2.0 * math.Pi * (float64(x) + 0.5) / float64(out.Width)
+			dir := types.Vec3{
+				float32(math.Sin(theta) * math.Sin(phi)),
+				float32(math.Cos(theta)),
+				float32(math.Sin(theta) * math.Cos(phi)),
+			}
+
+			face, uv := CubeFaceUV(dir)
+			out.setTexel(x, y, faces[face].sampleBilinear(uv))
+		}
+	}
+
+	// Faces with premultiplied alpha yield a premultiplied output
+	for _, face := range faces {
+		out.PremultipliedAlpha = out.PremultipliedAlpha || face.PremultipliedAlpha
+	}
+
+	return out, nil
+}
+
+// Get the size in bytes of a single texel.
+func (f Format) texelSize() int {
+	switch f {
+	case Luminance8:
+		return 1
+	case Luminance32F, Rgba8:
+		return 4
+	case Rgba32F:
+		return 16
+	}
+
+	return 0
+}
+
+// Get the number of channels in a texel.
+func (f Format) channels() int {
+	switch f {
+	case Luminance8, Luminance32F:
+		return 1
+	}
+
+	return 4
+}
+
+// Sample the texture at the given uv coordinates using bilinear filtering.
+// Texels are clamped at the texture edges.
+func (t *Texture) sampleBilinear(uv types.Vec2) [4]float32 {
+	sx := uv[0]*float32(t.Width) - 0.5
+	sy := uv[1]*float32(t.Height) - 0.5
+	fx := float32(math.Floor(float64(sx)))
+	fy := float32(math.Floor(float64(sy)))
+	coeffX, coeffY := sx-fx, sy-fy
+
+	tx, ty := clampCoord(int(fx), t.Width), clampCoord(int(fy), t.Height)
+	bx, by := clampCoord(int(fx)+1, t.Width), clampCoord(int(fy)+1, t.Height)
+
+	tl, tr := t.texel(tx, ty), t.texel(bx, ty)
+	bl, br := t.texel(tx, by), t.texel(bx, by)
+
+	var out [4]float32
+	for c := 0; c < 4; c++ {
+		top := tl[c] + (tr[c]-tl[c])*coeffX
+		bottom := bl[c] + (br[c]-bl[c])*coeffX
+		out[c] = top + (bottom-top)*coeffY
+	}
+	return out
+}
+
+// Decode the texel at the given coordinates. 8-bit channel values are
+// returned in the [0, 255] range.
+func (t *Texture) texel(x, y uint32) [4]float32 {
+	var out [4]float32
+	offset := int(y*t.Width+x) * t.Format.texelSize()
+	for c := 0; c < t.Format.channels(); c++ {
+		switch t.Format {
+		case Luminance8, Rgba8:
+			out[c] = float32(t.Data[offset+c])
+		default:
+			out[c] = getFloat32(t.Data, offset+4*c)
+		}
+	}
+	return out
+}
+
+// Encode a texel at the given coordinates.
+func (t *Texture) setTexel(x, y uint32, value [4]float32) {
+	offset := int(y*t.Width+x) * t.Format.texelSize()
+	for c := 0; c < t.Format.channels(); c++ {
+		switch t.Format {
+		case Luminance8, Rgba8:
+			t.Data[offset+c] = uint8(math.Min(255, math.Max(0, math.Floor(float64(value[c])+0.5))))
+		default:
+			putFloat32(t.Data, offset+4*c, value[c])
+		}
+	}
+}
+
+// Clamp a texel coordinate to the [0, size) range.
+func clampCoord(coord int, size uint32) uint32 {
+	if coord < 0 {
+		return 0
+	} else if coord >= int(size) {
+		return size - 1
+	}
+	return uint32(coord)
+}
@@ -0,0 +1,89 @@
+package texture
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestCubeFaceUV(t *testing.T) {
+	specs := []struct {
+		dir     types.Vec3
+		expFace CubeFace
+		expUV   types.Vec2
+	}{
+		{types.Vec3{1, 0, 0}, CubeFacePosX, types.Vec2{0.5, 0.5}},
+		{types.Vec3{-1, 0, 0}, CubeFaceNegX, types.Vec2{0.5, 0.5}},
+		{types.Vec3{0, 1, 0}, CubeFacePosY, types.Vec2{0.5, 0.5}},
+		{types.Vec3{0, -1, 0}, CubeFaceNegY, types.Vec2{0.5, 0.5}},
+		{types.Vec3{0, 0, 1}, CubeFacePosZ, types.Vec2{0.5, 0.5}},
+		{types.Vec3{0, 0, -1}, CubeFaceNegZ, types.Vec2{0.5, 0.5}},
+		// +X face; -Z maps to the right edge and +Y to the top edge
+		{types.Vec3{1, 0.5, -0.5}, CubeFacePosX, types.Vec2{0.75, 0.25}},
+	}
+
+	for index, spec := range specs {
+		face, uv := CubeFaceUV(spec.dir)
+		if face != spec.expFace {
+			t.Fatalf("[spec %d] expected direction %v to map to face %s; got %s", index, spec.dir, spec.expFace, face)
+		}
+		if uv != spec.expUV {
+			t.Fatalf("[spec %d] expected uv to be %v; got %v", index, spec.expUV, uv)
+		}
+	}
+}
+
+func TestNewFromCubeFaces(t *testing.T) {
+	var faces [6]*Texture
+	for index := range faces {
+		faces[index] = &Texture{
+			Format: Rgba8,
+			Width:  2,
+			Height: 2,
+			Data:   make([]byte, 2*2*4),
+		}
+		// Fill each face with a unique color
+		for offset := 0; offset < len(faces[index].Data); offset += 4 {
+			faces[index].Data[offset] = uint8(10 * (index + 1))
+			faces[index].Data[offset+3] = 255
+		}
+	}
+
+	tex, err := NewFromCubeFaces(faces)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tex.Width != 8 || tex.Height != 4 {
+		t.Fatalf("expected tex dims to be 8x4; got %dx%d", tex.Width, tex.Height)
+	}
+
+	// Lat/lng directions are mapped as u = atan2(x, z) / 2pi and
+	// v = acos(y) / pi so texel (2, 2) points towards +X
+	offset := 4 * (2*tex.Width + 2)
+	expValue := uint8(10 * (CubeFacePosX + 1))
+	if tex.Data[offset] != expValue {
+		t.Fatalf("expected texel (2, 2) to sample face %s (value %d); got %d", CubeFacePosX, expValue, tex.Data[offset])
+	}
+
+	// Texel (6, 2) points towards -X
+	offset = 4 * (2*tex.Width + 6)
+	expValue = uint8(10 * (CubeFaceNegX + 1))
+	if tex.Data[offset] != expValue {
+		t.Fatalf("expected texel (6, 2) to sample face %s (value %d); got %d", CubeFaceNegX, expValue, tex.Data[offset])
+	}
+}
+
+func TestNewFromCubeFacesErrors(t *testing.T) {
+	var faces [6]*Texture
+	for index := range faces {
+		faces[index] = &Texture{Format: Rgba8, Width: 2, Height: 2, Data: make([]byte, 16)}
+	}
+	faces[3] = &Texture{Format: Rgba8, Width: 4, Height: 4, Data: make([]byte, 64)}
+
+	_, err := NewFromCubeFaces(faces)
+	expError := "texture: cube map face -Y should be a 2x2 Rgba8 texture; got 4x4 Rgba8"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,62 @@
+package texture
+
+// Generate the next mipmap level for the texture by averaging each 2x2 texel
+// block (box filter). The dimensions of the generated level are half the
+// dimensions of the texture rounded down but never smaller than 1. Texels
+// are clamped at the texture edges so odd dimensions are also supported.
+func (t *Texture) Downsample() *Texture {
+	out := &Texture{
+		Format:             t.Format,
+		Width:              maxUint32(t.Width/2, 1),
+		Height:             maxUint32(t.Height/2, 1),
+		PremultipliedAlpha: t.PremultipliedAlpha,
+		SRGB:               t.SRGB,
+		WrapMode:           t.WrapMode,
+		Anisotropy:         t.Anisotropy,
+	}
+	out.Data = make([]byte, int(out.Width*out.Height)*out.Format.texelSize())
+
+	for y := uint32(0); y < out.Height; y++ {
+		for x := uint32(0); x < out.Width; x++ {
+			x0, y0 := clampCoord(int(2*x), t.Width), clampCoord(int(2*y), t.Height)
+			x1, y1 := clampCoord(int(2*x+1), t.Width), clampCoord(int(2*y+1), t.Height)
+
+			var sum [4]float32
+			for _, texel := range [][4]float32{t.texel(x0, y0), t.texel(x1, y0), t.texel(x0, y1), t.texel(x1, y1)} {
+				for c := range sum {
+					sum[c] += texel[c]
+				}
+			}
+			for c := range sum {
+				sum[c] *= 0.25
+			}
+			out.setTexel(x, y, sum)
+		}
+	}
+
+	return out
+}
+
+// Generate a mipmap pyramid for the texture. The first entry of the returned
+// list is the texture itself followed by successively downsampled levels
+// until a 1x1 level is reached or the list contains maxLevels entries.
+// Textures with an unsupported format only contain the base level.
+func (t *Texture) MipChain(maxLevels int) []*Texture {
+	levels := []*Texture{t}
+	if t.Format.texelSize() == 0 {
+		return levels
+	}
+
+	for level := t; len(levels) < maxLevels && (level.Width > 1 || level.Height > 1); {
+		level = level.Downsample()
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+func maxUint32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
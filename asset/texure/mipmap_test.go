@@ -0,0 +1,71 @@
+package texture
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDownsample(t *testing.T) {
+	tex := &Texture{
+		Format: Luminance8,
+		Width:  4,
+		Height: 2,
+		Data: []byte{
+			10, 20, 30, 50,
+			30, 40, 70, 90,
+		},
+	}
+
+	level := tex.Downsample()
+	if level.Width != 2 || level.Height != 1 || level.Format != Luminance8 {
+		t.Fatalf("expected a 2x1 Luminance8 level; got %dx%d %s", level.Width, level.Height, level.Format)
+	}
+	if exp := []byte{25, 60}; !bytes.Equal(level.Data, exp) {
+		t.Fatalf("expected level data to be %v; got %v", exp, level.Data)
+	}
+
+	// Odd dimensions clamp texels at the edges
+	tex = &Texture{Format: Luminance32F, Width: 3, Height: 1, Data: make([]byte, 12)}
+	for x, v := range []float32{1, 2, 6} {
+		putFloat32(tex.Data, 4*x, v)
+	}
+	level = tex.Downsample()
+	if level.Width != 1 || level.Height != 1 {
+		t.Fatalf("expected a 1x1 level; got %dx%d", level.Width, level.Height)
+	}
+	if v := getFloat32(level.Data, 0); v != 1.5 {
+		t.Fatalf("expected level texel to be 1.5; got %f", v)
+	}
+}
+
+func TestMipChain(t *testing.T) {
+	tex := &Texture{Format: Rgba8, Width: 5, Height: 3, Data: make([]byte, 5*3*4)}
+
+	specs := []struct {
+		maxLevels int
+		expDims   [][2]uint32
+	}{
+		{16, [][2]uint32{{5, 3}, {2, 1}, {1, 1}}},
+		{2, [][2]uint32{{5, 3}, {2, 1}}},
+		{1, [][2]uint32{{5, 3}}},
+	}
+
+	for specIndex, spec := range specs {
+		levels := tex.MipChain(spec.maxLevels)
+		if len(levels) != len(spec.expDims) {
+			t.Fatalf("[spec %d] expected %d levels; got %d", specIndex, len(spec.expDims), len(levels))
+		}
+		if levels[0] != tex {
+			t.Fatalf("[spec %d] expected first level to be the texture itself", specIndex)
+		}
+		for levelIndex, level := range levels {
+			dims := [2]uint32{level.Width, level.Height}
+			if dims != spec.expDims[levelIndex] {
+				t.Fatalf("[spec %d] expected level %d dims to be %v; got %v", specIndex, levelIndex, spec.expDims[levelIndex], dims)
+			}
+			if len(level.Data) != int(level.Width*level.Height)*4 {
+				t.Fatalf("[spec %d] expected level %d data length to be %d; got %d", specIndex, levelIndex, level.Width*level.Height*4, len(level.Data))
+			}
+		}
+	}
+}
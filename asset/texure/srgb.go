@@ -0,0 +1,45 @@
+package texture
+
+import "math"
+
+// Convert a sRGB encoded color channel value in the [0, 1] range to linear
+// space using the piecewise sRGB transfer function.
+func SRGBToLinear(v float32) float32 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return float32(math.Pow((float64(v)+0.055)/1.055, 2.4))
+}
+
+// Convert the color channels of a sRGB encoded texture to linear space. The
+// alpha channel is not modified. 8-bit textures keep their format and store
+// the linearized values quantized to 8 bits. Textures whose color channels
+// are not sRGB encoded are left untouched.
+func (t *Texture) Linearize() {
+	if !t.SRGB || t.Format.texelSize() == 0 {
+		return
+	}
+
+	// 8-bit channels store values in the [0, 255] range
+	var scale float32 = 1
+	if t.Format == Luminance8 || t.Format == Rgba8 {
+		scale = 255
+	}
+
+	colorChannels := t.Format.channels()
+	if colorChannels > 3 {
+		colorChannels = 3
+	}
+
+	for y := uint32(0); y < t.Height; y++ {
+		for x := uint32(0); x < t.Width; x++ {
+			texel := t.texel(x, y)
+			for c := 0; c < colorChannels; c++ {
+				texel[c] = SRGBToLinear(texel[c]/scale) * scale
+			}
+			t.setTexel(x, y, texel)
+		}
+	}
+
+	t.SRGB = false
+}
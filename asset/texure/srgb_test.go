@@ -0,0 +1,71 @@
+package texture
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestSRGBToLinear(t *testing.T) {
+	specs := []struct {
+		in, exp float32
+	}{
+		{0, 0},
+		{0.04045, 0.04045 / 12.92},
+		{0.5, 0.21404},
+		{1, 1},
+	}
+
+	for index, spec := range specs {
+		if got := SRGBToLinear(spec.in); math.Abs(float64(got-spec.exp)) > 1e-5 {
+			t.Errorf("[spec %d] expected SRGBToLinear(%f) to be %f; got %f", index, spec.in, spec.exp, got)
+		}
+	}
+}
+
+func TestLinearizeRamp(t *testing.T) {
+	// A 4 texel ramp; the alpha channel should not be converted
+	tex := &Texture{
+		Format: Rgba8,
+		Width:  4,
+		Height: 1,
+		SRGB:   true,
+		Data: []byte{
+			0, 0, 0, 0,
+			64, 64, 64, 64,
+			128, 128, 128, 128,
+			255, 255, 255, 255,
+		},
+	}
+
+	tex.Linearize()
+	exp := []byte{
+		0, 0, 0, 0,
+		13, 13, 13, 64,
+		55, 55, 55, 128,
+		255, 255, 255, 255,
+	}
+	if !bytes.Equal(tex.Data, exp) {
+		t.Fatalf("expected linearized ramp to be %v; got %v", exp, tex.Data)
+	}
+	if tex.SRGB {
+		t.Fatal("expected linearized texture to not be flagged as sRGB")
+	}
+
+	// Linearizing linear data should be a no-op
+	tex.Linearize()
+	if !bytes.Equal(tex.Data, exp) {
+		t.Fatalf("expected linear texture data to remain unchanged; got %v", tex.Data)
+	}
+
+	// Float textures store the linear values without quantization
+	tex = &Texture{Format: Luminance32F, Width: 2, Height: 1, SRGB: true, Data: make([]byte, 8)}
+	putFloat32(tex.Data, 0, 0.5)
+	putFloat32(tex.Data, 4, 1)
+	tex.Linearize()
+	for x, exp := range []float32{0.21404, 1} {
+		if got := getFloat32(tex.Data, 4*x); math.Abs(float64(got-exp)) > 1e-5 {
+			t.Fatalf("expected texel %d to be %f; got %f", x, exp, got)
+		}
+	}
+}
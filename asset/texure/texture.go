@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"unsafe"
 
 	"github.com/achilleasa/polaris/asset"
@@ -18,6 +19,20 @@ type Texture struct {
 	Width  uint32
 	Height uint32
 
+	// True if the RGB channels have been premultiplied by the alpha channel.
+	PremultipliedAlpha bool
+
+	// True if the color channels are sRGB encoded and must be converted to
+	// linear space before being used for lighting calculations.
+	SRGB bool
+
+	// The addressing mode for uv coordinates outside the [0, 1] range.
+	WrapMode WrapMode
+
+	// Anisotropic filtering level hint. Values less than 1 are treated as 1
+	// (isotropic filtering).
+	Anisotropy uint32
+
 	Data []byte
 }
 
@@ -93,6 +108,8 @@ func New(res *asset.Resource) (*Texture, error) {
 		Format: texFmt,
 		Width:  uint32(spec.Width()),
 		Height: uint32(spec.Height()),
+		// OpenEXR images always store premultiplied (associated) alpha
+		PremultipliedAlpha: spec.NumChannels() == 4 && strings.HasSuffix(strings.ToLower(pathToFile), ".exr"),
 	}
 
 	// Cast data to []byte
@@ -134,14 +151,65 @@ func New(res *asset.Resource) (*Texture, error) {
 			t = tData
 		}
 
-		// Fetch slice header and adjust len/capacity (1 float32 = 4 bytes)
-		header := *(*reflect.SliceHeader)(unsafe.Pointer(&t))
-		header.Len <<= 2
-		header.Cap <<= 2
-
-		// Convert to a []byte
-		texture.Data = *(*[]byte)(unsafe.Pointer(&header))
+		// Reinterpret the float data as a []byte (1 float32 = 4 bytes)
+		var data []byte
+		if len(t) > 0 {
+			header := (*reflect.SliceHeader)(unsafe.Pointer(&data))
+			header.Data = uintptr(unsafe.Pointer(&t[0]))
+			header.Len = len(t) << 2
+			header.Cap = cap(t) << 2
+		}
+		texture.Data = data
 	}
 
 	return texture, nil
 }
+
+// Convert premultiplied alpha texture data to straight alpha by dividing the
+// RGB channels with the alpha channel. Filtering premultiplied data as if it
+// were straight alpha darkens texels near transparent edges. Texels with zero
+// alpha carry no color information and are left untouched.
+func (t *Texture) Unpremultiply() {
+	if !t.PremultipliedAlpha {
+		return
+	}
+
+	switch t.Format {
+	case Rgba8:
+		for offset := 0; offset+3 < len(t.Data); offset += 4 {
+			alpha := t.Data[offset+3]
+			if alpha == 0 || alpha == 255 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				v := (uint32(t.Data[offset+c])*255 + uint32(alpha)/2) / uint32(alpha)
+				if v > 255 {
+					v = 255
+				}
+				t.Data[offset+c] = uint8(v)
+			}
+		}
+	case Rgba32F:
+		for offset := 0; offset+15 < len(t.Data); offset += 16 {
+			alpha := getFloat32(t.Data, offset+12)
+			if alpha <= 0 || alpha == 1 {
+				continue
+			}
+			for c := 0; c < 3; c++ {
+				putFloat32(t.Data, offset+4*c, getFloat32(t.Data, offset+4*c)/alpha)
+			}
+		}
+	}
+
+	t.PremultipliedAlpha = false
+}
+
+// Decode a native-endian float32 from a byte slice.
+func getFloat32(data []byte, offset int) float32 {
+	return *(*float32)(unsafe.Pointer(&data[offset]))
+}
+
+// Encode a float32 into a byte slice using native-endian order.
+func putFloat32(data []byte, offset int, v float32) {
+	*(*float32)(unsafe.Pointer(&data[offset])) = v
+}
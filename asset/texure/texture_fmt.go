@@ -7,4 +7,45 @@ const (
 	Luminance32F
 	Rgba8
 	Rgba32F
+
+	// A UDIM tile lookup table. Textures using this format do not store
+	// image data; instead their data is a table of int32 texture indices,
+	// one for each UDIM tile, with -1 denoting a missing tile.
+	Udim
 )
+
+func (f Format) String() string {
+	switch f {
+	case Luminance8:
+		return "Luminance8"
+	case Luminance32F:
+		return "Luminance32F"
+	case Rgba8:
+		return "Rgba8"
+	case Rgba32F:
+		return "Rgba32F"
+	case Udim:
+		return "Udim"
+	}
+
+	return "unknown"
+}
+
+// Get the alignment in bytes for the data of textures using this format.
+// Float textures are aligned on a 16 byte boundary so that their texels can
+// be fetched using vector loads; all other formats are aligned on a dword
+// boundary.
+func (f Format) Alignment() int {
+	switch f {
+	case Luminance32F, Rgba32F:
+		return 16
+	}
+
+	return 4
+}
+
+// Get the length in bytes of the data for a texture with the given dimensions
+// that uses this format.
+func (f Format) DataLen(width, height uint32) int {
+	return int(width) * int(height) * f.texelSize()
+}
@@ -118,3 +118,58 @@ func mockImage(img image.Image) (res *asset.Resource, err error) {
 
 	return asset.NewResource(imgFile, nil)
 }
+
+func TestUnpremultiplyRgba8(t *testing.T) {
+	tex := &Texture{
+		Format:             Rgba8,
+		Width:              3,
+		Height:             1,
+		PremultipliedAlpha: true,
+		Data: []byte{
+			// opaque pixel
+			200, 100, 50, 255,
+			// semi-transparent edge pixel: straight color (200, 100, 50) at 50% alpha
+			100, 50, 25, 128,
+			// fully transparent pixel
+			0, 0, 0, 0,
+		},
+	}
+
+	tex.Unpremultiply()
+
+	expData := []byte{
+		200, 100, 50, 255,
+		199, 100, 50, 128,
+		0, 0, 0, 0,
+	}
+	for index, exp := range expData {
+		if tex.Data[index] != exp {
+			t.Fatalf("expected byte %d to be %d; got %d", index, exp, tex.Data[index])
+		}
+	}
+
+	if tex.PremultipliedAlpha {
+		t.Fatal("expected premultiplied alpha flag to be cleared")
+	}
+}
+
+func TestUnpremultiplyRgba32F(t *testing.T) {
+	tex := &Texture{
+		Format:             Rgba32F,
+		Width:              1,
+		Height:             1,
+		PremultipliedAlpha: true,
+		Data:               make([]byte, 16),
+	}
+	for c, v := range []float32{0.25, 0.125, 0.05, 0.25} {
+		putFloat32(tex.Data, 4*c, v)
+	}
+
+	tex.Unpremultiply()
+
+	for c, exp := range []float32{1, 0.5, 0.2, 0.25} {
+		if v := getFloat32(tex.Data, 4*c); v < exp-1e-5 || v > exp+1e-5 {
+			t.Fatalf("expected channel %d to be %f; got %f", c, exp, v)
+		}
+	}
+}
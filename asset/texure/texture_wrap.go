@@ -0,0 +1,29 @@
+package texture
+
+// WrapMode controls how texture samplers address uv coordinates outside
+// the [0, 1] range.
+type WrapMode uint32
+
+const (
+	// Tile the texture by keeping the fractional part of the coordinates.
+	WrapRepeat WrapMode = iota
+
+	// Clamp the coordinates to the texture edges.
+	WrapClamp
+
+	// Tile the texture while flipping every other tile.
+	WrapMirror
+)
+
+func (m WrapMode) String() string {
+	switch m {
+	case WrapRepeat:
+		return "repeat"
+	case WrapClamp:
+		return "clamp"
+	case WrapMirror:
+		return "mirror"
+	}
+
+	return "unknown"
+}
@@ -24,11 +24,11 @@ func ListDevices(ctx *cli.Context) error {
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetAutoFormatHeaders(false)
 	table.SetAutoWrapText(false)
-	table.SetHeader([]string{"Device", "Type", "Estimated speed", "Vendor", "Version"})
+	table.SetHeader([]string{"Index", "Device", "Type", "Estimated speed", "Global memory", "Max allocation", "Vendor", "Version"})
 
-	for _, platformInfo := range clPlatforms {
-		for _, dev := range platformInfo.Devices {
-			table.Append([]string{dev.Name, dev.Type.String(), fmt.Sprintf("%d GFlops", dev.Speed), platformInfo.Name, platformInfo.Version})
+	for pIdx, platformInfo := range clPlatforms {
+		for dIdx, dev := range platformInfo.Devices {
+			table.Append([]string{fmt.Sprintf("%d:%d", pIdx, dIdx), dev.Name, dev.Type.String(), fmt.Sprintf("%d GFlops", dev.Speed), fmt.Sprintf("%d MiB", dev.GlobalMemBytes>>20), fmt.Sprintf("%d MiB", dev.MaxAllocBytes>>20), platformInfo.Name, platformInfo.Version})
 		}
 	}
 	table.Render()
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 
+	"github.com/achilleasa/polaris/asset/scene"
 	"github.com/achilleasa/polaris/asset/scene/reader"
 	"github.com/achilleasa/polaris/renderer"
 	"github.com/achilleasa/polaris/tracer"
@@ -28,15 +32,19 @@ func RenderFrame(ctx *cli.Context) error {
 	setupLogging(ctx)
 
 	opts := renderer.Options{
-		FrameW:          uint32(ctx.Int("width")),
-		FrameH:          uint32(ctx.Int("height")),
-		SamplesPerPixel: uint32(ctx.Int("spp")),
-		Exposure:        float32(ctx.Float64("exposure")),
-		NumBounces:      uint32(ctx.Int("num-bounces")),
-		MinBouncesForRR: uint32(ctx.Int("rr-bounces")),
+		FrameW:           uint32(ctx.Int("width")),
+		FrameH:           uint32(ctx.Int("height")),
+		SamplesPerPixel:  uint32(ctx.Int("spp")),
+		TimeBudget:       ctx.Duration("time-budget"),
+		Exposure:         float32(ctx.Float64("exposure")),
+		NumBounces:       uint32(ctx.Int("num-bounces")),
+		MinBouncesForRR:  uint32(ctx.Int("rr-bounces")),
+		MinBouncesForNEE: uint32(ctx.Int("nee-bounces")),
+		FrameIndex:       uint32(ctx.Int("frame-index")),
 		//
 		BlackListedDevices: ctx.StringSlice("blacklist"),
 		ForcePrimaryDevice: ctx.String("force-primary"),
+		Device:             ctx.String("device"),
 	}
 
 	if opts.MinBouncesForRR == 0 || opts.MinBouncesForRR >= opts.NumBounces {
@@ -44,12 +52,39 @@ func RenderFrame(ctx *cli.Context) error {
 		opts.MinBouncesForRR = opts.NumBounces + 1
 	}
 
+	var err error
+	opts.ThroughputClamp, err = parseThroughputClamp(ctx.String("throughput-clamp"))
+	if err != nil {
+		return err
+	}
+
+	opts.SeedPolicy, err = tracer.ParseSeedPolicy(ctx.String("seed-policy"))
+	if err != nil {
+		return err
+	}
+
+	opts.Crop, err = parseCropWindow(ctx.String("crop"))
+	if err != nil {
+		return err
+	}
+
 	// Load scene
-	if ctx.NArg() != 1 {
+	sceneFile := ctx.String("scene")
+	switch {
+	case sceneFile != "" && ctx.NArg() != 0:
+		return errors.New("the scene file must be specified either via the scene flag or as an argument")
+	case sceneFile == "" && ctx.NArg() != 1:
 		return errors.New("missing scene file argument")
+	case sceneFile == "":
+		sceneFile = ctx.Args().First()
 	}
 
-	sc, err := reader.ReadScene(ctx.Args().First())
+	sc, err := reader.ReadScene(sceneFile)
+	if err != nil {
+		return err
+	}
+
+	err = overrideCamera(sc, ctx.String("camera"))
 	if err != nil {
 		return err
 	}
@@ -57,11 +92,97 @@ func RenderFrame(ctx *cli.Context) error {
 	// Update projection matrix
 	sc.Camera.SetupProjection(float32(opts.FrameW) / float32(opts.FrameH))
 
-	// Setup tracing pipeline
-	pipeline := opencl.DefaultPipeline(opencl.NoDebug)
+	blueNoise, err := loadBlueNoise(ctx.String("blue-noise"))
+	if err != nil {
+		return err
+	}
+	colorLUT, err := loadColorLUT(ctx.String("color-lut"))
+	if err != nil {
+		return err
+	}
+	texBudget, err := textureBudget(ctx.Int("texture-budget"))
+	if err != nil {
+		return err
+	}
+
+	// When rendering a stereo pair, each eye is rendered using the same
+	// noise seed so that both images exhibit comparable noise.
+	eyes := []stereoEye{{camera: sc.Camera}}
+	if ipd := float32(ctx.Float64("stereo-ipd")); ipd != 0 {
+		if ipd < 0 {
+			return fmt.Errorf("invalid stereo interpupillary distance %v; expected a positive value", ipd)
+		}
+
+		logger.Noticef("rendering stereo pair using an interpupillary distance of %v", ipd)
+		left, right := sc.Camera.StereoPair(ipd)
+		eyes = []stereoEye{{"left", left}, {"right", right}}
+		opts.SeedPolicy = tracer.StaticSeed
+	}
+
+	for _, eye := range eyes {
+		sc.Camera = eye.camera
+
+		// Setup tracing pipeline
+		pipeline := opencl.DefaultPipeline(opencl.NoDebug)
+		pipeline.PostProcess = append(pipeline.PostProcess, opencl.SaveFrameBuffer(eye.filename(ctx.String("out"))))
+		if aovFile := ctx.String("aov-out"); aovFile != "" {
+			pipeline.CaptureAovs = true
+			pipeline.CaptureVariance = true
+			pipeline.PostProcess = append(pipeline.PostProcess, opencl.SaveAovs(eye.filename(aovFile)))
+			pipeline.FireflyThreshold = float32(ctx.Float64("firefly-threshold"))
+		}
+		pipeline.BlueNoise = blueNoise
+		pipeline.ColorLUT = colorLUT
+		pipeline.TextureBudget = texBudget
+
+		err = renderStill(sc, pipeline, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Render a procedural test pattern without loading a scene. The pattern is
+// tone-mapped and written to the output image like a rendered frame.
+func RenderTestPattern(ctx *cli.Context) error {
+	setupLogging(ctx)
+
+	opts := renderer.Options{
+		FrameW:          uint32(ctx.Int("width")),
+		FrameH:          uint32(ctx.Int("height")),
+		SamplesPerPixel: 1,
+		Exposure:        float32(ctx.Float64("exposure")),
+		//
+		BlackListedDevices: ctx.StringSlice("blacklist"),
+		ForcePrimaryDevice: ctx.String("force-primary"),
+		Device:             ctx.String("device"),
+	}
+
+	pattern, err := tracer.ParseTestPattern(ctx.String("pattern"))
+	if err != nil {
+		return err
+	}
+	logger.Noticef("rendering %q test pattern", pattern)
+
+	// The pattern pipeline does not trace any rays so an empty scene
+	// with a default camera is sufficient for initializing the tracers.
+	sc := &scene.Scene{Camera: scene.NewCamera(45)}
+	sc.Camera.SetupProjection(float32(opts.FrameW) / float32(opts.FrameH))
+
+	pipeline := opencl.TestPatternPipeline(pattern)
 	pipeline.PostProcess = append(pipeline.PostProcess, opencl.SaveFrameBuffer(ctx.String("out")))
+	pipeline.ColorLUT, err = loadColorLUT(ctx.String("color-lut"))
+	if err != nil {
+		return err
+	}
 
-	// Create renderer
+	return renderStill(sc, pipeline, opts)
+}
+
+// Render a still frame of the scene and display the frame statistics.
+func renderStill(sc *scene.Scene, pipeline *opencl.Pipeline, opts renderer.Options) error {
 	r, err := renderer.NewDefault(sc, tracer.NaiveScheduler(), pipeline, opts)
 	if err != nil {
 		return err
@@ -73,10 +194,26 @@ func RenderFrame(ctx *cli.Context) error {
 		return err
 	}
 
-	// Display stats
 	displayFrameStats(r.Stats())
+	return nil
+}
+
+// The camera for an eye of a stereo pair. The camera of mono renders uses an
+// empty eye name.
+type stereoEye struct {
+	name   string
+	camera *scene.Camera
+}
+
+// Get the output filename for the eye by appending the eye name to the base
+// name of the supplied file.
+func (e stereoEye) filename(file string) string {
+	if e.name == "" {
+		return file
+	}
 
-	return err
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "_" + e.name + ext
 }
 
 func displayFrameStats(stats renderer.FrameStats) {
@@ -97,7 +234,7 @@ func displayFrameStats(stats renderer.FrameStats) {
 	table.SetFooter([]string{"", "", "", "TOTAL", fmt.Sprintf("%s", stats.RenderTime)})
 
 	table.Render()
-	logger.Noticef("frame statistics\n%s", buf.String())
+	logger.Noticef("frame statistics (%d samples per pixel)\n%s", stats.Samples, buf.String())
 }
 
 // Render scene using an interactive opengl view.
@@ -106,15 +243,18 @@ func RenderInteractive(ctx *cli.Context) error {
 	setupLogging(ctx)
 
 	opts := renderer.Options{
-		FrameW:          uint32(ctx.Int("width")),
-		FrameH:          uint32(ctx.Int("height")),
-		SamplesPerPixel: uint32(ctx.Int("spp")),
-		Exposure:        float32(ctx.Float64("exposure")),
-		NumBounces:      uint32(ctx.Int("num-bounces")),
-		MinBouncesForRR: uint32(ctx.Int("rr-bounces")),
+		FrameW:           uint32(ctx.Int("width")),
+		FrameH:           uint32(ctx.Int("height")),
+		SamplesPerPixel:  uint32(ctx.Int("spp")),
+		Exposure:         float32(ctx.Float64("exposure")),
+		NumBounces:       uint32(ctx.Int("num-bounces")),
+		MinBouncesForRR:  uint32(ctx.Int("rr-bounces")),
+		MinBouncesForNEE: uint32(ctx.Int("nee-bounces")),
+		FrameIndex:       uint32(ctx.Int("frame-index")),
 		//
 		BlackListedDevices: ctx.StringSlice("blacklist"),
 		ForcePrimaryDevice: ctx.String("force-primary"),
+		Device:             ctx.String("device"),
 	}
 
 	if opts.MinBouncesForRR == 0 || opts.MinBouncesForRR >= opts.NumBounces {
@@ -122,6 +262,23 @@ func RenderInteractive(ctx *cli.Context) error {
 		opts.MinBouncesForRR = opts.NumBounces + 1
 	}
 
+	var err error
+	opts.ThroughputClamp, err = parseThroughputClamp(ctx.String("throughput-clamp"))
+	if err != nil {
+		return err
+	}
+
+	opts.SeedPolicy, err = tracer.ParseSeedPolicy(ctx.String("seed-policy"))
+	if err != nil {
+		return err
+	}
+
+	opts.PreviewSchedule, err = parsePreviewSchedule(ctx.String("preview-schedule"))
+	if err != nil {
+		return err
+	}
+	opts.Accumulate = ctx.Bool("accumulate")
+
 	// Setup block scheduler
 	schedulerType := ctx.String("scheduler")
 	var scheduler tracer.BlockScheduler
@@ -145,6 +302,11 @@ func RenderInteractive(ctx *cli.Context) error {
 		return err
 	}
 
+	err = overrideCamera(sc, ctx.String("camera"))
+	if err != nil {
+		return err
+	}
+
 	// Due to the way that gl.TexSubImage2D works we need to
 	// generate a mirrored image of the frame buffer.
 	sc.Camera.InvertY = true
@@ -152,6 +314,18 @@ func RenderInteractive(ctx *cli.Context) error {
 
 	// Setup tracing pipeline
 	pipeline := opencl.DefaultPipeline(opencl.NoDebug)
+	pipeline.BlueNoise, err = loadBlueNoise(ctx.String("blue-noise"))
+	if err != nil {
+		return err
+	}
+	pipeline.ColorLUT, err = loadColorLUT(ctx.String("color-lut"))
+	if err != nil {
+		return err
+	}
+	pipeline.TextureBudget, err = textureBudget(ctx.Int("texture-budget"))
+	if err != nil {
+		return err
+	}
 
 	// Create renderer
 	r, err := renderer.NewInteractive(sc, scheduler, pipeline, opts)
@@ -162,3 +336,132 @@ func RenderInteractive(ctx *cli.Context) error {
 	// enter main loop
 	return r.Render()
 }
+
+// Replace the scene camera with the camera described by a compact
+// lookfrom/lookat/vup/fov spec. If no spec is supplied, the scene camera is
+// left untouched.
+func overrideCamera(sc *scene.Scene, spec string) error {
+	if spec == "" {
+		return nil
+	}
+
+	camera, err := scene.ParseCameraSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	logger.Noticef("overriding scene camera using spec %q", spec)
+	sc.Camera = camera
+	return nil
+}
+
+// Load the blue-noise texture for rotating the primary ray sample offsets. If
+// no texture file is specified, the tracers fall back to white noise offsets.
+func loadBlueNoise(imgFile string) (*tracer.BlueNoise, error) {
+	if imgFile == "" {
+		return nil, nil
+	}
+
+	logger.Noticef("using blue-noise sample offsets from %q", imgFile)
+	return tracer.LoadBlueNoise(imgFile)
+}
+
+// Load the color lookup table for grading the tone-mapped output. If no table
+// file is specified, the output is not graded.
+func loadColorLUT(lutFile string) (*tracer.ColorLUT, error) {
+	if lutFile == "" {
+		return nil, nil
+	}
+
+	logger.Noticef("grading output using color lookup table %q", lutFile)
+	return tracer.LoadColorLUT(lutFile)
+}
+
+// Convert the texture budget from MiB to bytes. A zero budget keeps all
+// scene textures resident.
+func textureBudget(mib int) (uint64, error) {
+	if mib < 0 {
+		return 0, fmt.Errorf("invalid texture budget %d; expected a non-negative value", mib)
+	}
+	if mib > 0 {
+		logger.Noticef("limiting resident texture data to %d MiB", mib)
+	}
+
+	return uint64(mib) << 20, nil
+}
+
+// Parse a comma-delimited list of per-bounce throughput clamp values.
+func parseThroughputClamp(spec string) ([]float32, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	tokens := strings.Split(spec, ",")
+	clamp := make([]float32, len(tokens))
+	for index, token := range tokens {
+		val, err := strconv.ParseFloat(strings.TrimSpace(token), 32)
+		if err != nil || val < 0 {
+			return nil, fmt.Errorf("invalid throughput clamp value %q for bounce %d", token, index)
+		}
+		clamp[index] = float32(val)
+	}
+
+	return clamp, nil
+}
+
+// Parse a crop window specified as a comma-delimited x,y,w,h list of pixel
+// coordinates.
+func parseCropWindow(spec string) (tracer.CropWindow, error) {
+	var crop tracer.CropWindow
+	if spec == "" {
+		return crop, nil
+	}
+
+	tokens := strings.Split(spec, ",")
+	if len(tokens) != 4 {
+		return crop, fmt.Errorf("invalid crop window %q; expected x,y,w,h", spec)
+	}
+
+	var values [4]uint32
+	for index, token := range tokens {
+		val, err := strconv.ParseUint(strings.TrimSpace(token), 10, 32)
+		if err != nil {
+			return crop, fmt.Errorf("invalid crop window component %q", token)
+		}
+		values[index] = uint32(val)
+	}
+
+	crop = tracer.CropWindow{X: values[0], Y: values[1], W: values[2], H: values[3]}
+	if !crop.IsSet() {
+		return crop, fmt.Errorf("invalid crop window %q; width and height must be non-zero", spec)
+	}
+
+	return crop, nil
+}
+
+// Parse a comma-delimited list of scale:frames preview levels.
+func parsePreviewSchedule(spec string) ([]renderer.PreviewLevel, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	tokens := strings.Split(spec, ",")
+	schedule := make([]renderer.PreviewLevel, len(tokens))
+	for index, token := range tokens {
+		parts := strings.Split(strings.TrimSpace(token), ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid preview level %q; expected scale:frames", token)
+		}
+		scale, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || scale == 0 {
+			return nil, fmt.Errorf("invalid scale %q for preview level %d", parts[0], index)
+		}
+		frames, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil || frames == 0 {
+			return nil, fmt.Errorf("invalid frame count %q for preview level %d", parts[1], index)
+		}
+		schedule[index] = renderer.PreviewLevel{Scale: uint32(scale), Frames: uint32(frames)}
+	}
+
+	return schedule, nil
+}
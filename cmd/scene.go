@@ -1,11 +1,21 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/compiler/bvh"
+	"github.com/achilleasa/polaris/asset/scene"
 	"github.com/achilleasa/polaris/asset/scene/reader"
 	"github.com/achilleasa/polaris/asset/scene/writer"
+	"github.com/olekukonko/tablewriter"
 	"github.com/urfave/cli"
 )
 
@@ -13,23 +23,117 @@ import (
 func CompileScene(ctx *cli.Context) error {
 	setupLogging(ctx)
 
+	compilerOpts := compiler.DefaultOptions()
+	if ctx.IsSet("sah-traversal-cost") {
+		compilerOpts.TraversalCost = float32(ctx.Float64("sah-traversal-cost"))
+	}
+	if ctx.IsSet("sah-intersection-cost") {
+		compilerOpts.IntersectionCost = float32(ctx.Float64("sah-intersection-cost"))
+	}
+	if compilerOpts.TraversalCost < 0 || compilerOpts.IntersectionCost <= 0 {
+		return errors.New("SAH traversal cost must be >= 0 and intersection cost must be > 0")
+	}
+	compilerOpts.StrictChecks = ctx.Bool("strict-checks")
+	compilerOpts.GenerateMipmaps = !ctx.Bool("no-mipmaps")
+	if ctx.IsSet("min-leaf-primitives") {
+		compilerOpts.MinPrimitivesPerLeaf = ctx.Int("min-leaf-primitives")
+	}
+	if ctx.IsSet("max-leaf-instances") {
+		compilerOpts.MaxInstancesPerLeaf = ctx.Int("max-leaf-instances")
+	}
+	compilerOpts.BuildThreads = ctx.Int("build-threads")
+
+	switch splitStrategy := ctx.String("bvh-split"); splitStrategy {
+	case "", "sweep":
+		compilerOpts.SplitStrategy = bvh.SplitSweep
+	case "median":
+		compilerOpts.SplitStrategy = bvh.SplitMedian
+	case "sah":
+		compilerOpts.SplitStrategy = bvh.SplitSAH
+	default:
+		return fmt.Errorf("invalid BVH split strategy %q; supported strategies: sweep, median, sah", splitStrategy)
+	}
+
+	switch normalSmoothing := ctx.String("smooth-normals"); normalSmoothing {
+	case "", "none":
+		compilerOpts.NormalSmoothing = compiler.NoNormalSmoothing
+	case "area":
+		compilerOpts.NormalSmoothing = compiler.AreaWeightedNormals
+	case "angle":
+		compilerOpts.NormalSmoothing = compiler.AngleWeightedNormals
+	default:
+		return fmt.Errorf("invalid normal smoothing mode %q; supported modes: none, area, angle", normalSmoothing)
+	}
+
+	switch frontFace := ctx.String("front-face"); frontFace {
+	case "", "ccw":
+		compilerOpts.FrontFaceWinding = compiler.CounterClockwise
+	case "cw":
+		compilerOpts.FrontFaceWinding = compiler.Clockwise
+	default:
+		return fmt.Errorf("invalid front face winding %q; supported values: ccw, cw", frontFace)
+	}
+
+	switch windingRepair := ctx.String("fix-winding"); windingRepair {
+	case "", "none":
+		compilerOpts.WindingRepair = compiler.NoWindingRepair
+	case "consistent":
+		compilerOpts.WindingRepair = compiler.ConsistentWinding
+	case "outward":
+		compilerOpts.WindingRepair = compiler.OutwardWinding
+	default:
+		return fmt.Errorf("invalid winding repair mode %q; supported modes: none, consistent, outward", windingRepair)
+	}
+
+	if ctx.Int("vertex-ao-samples") < 0 || ctx.Float64("vertex-ao-distance") < 0 {
+		return errors.New("vertex AO samples and distance must be >= 0")
+	}
+	compilerOpts.VertexAOSamples = uint32(ctx.Int("vertex-ao-samples"))
+	compilerOpts.VertexAODistance = float32(ctx.Float64("vertex-ao-distance"))
+
+	if ctx.Float64("intersection-epsilon") < 0 {
+		return errors.New("intersection epsilon must be >= 0")
+	}
+	compilerOpts.IntersectionEpsilon = float32(ctx.Float64("intersection-epsilon"))
+
+	if ctx.Float64("vertex-weld-epsilon") < 0 {
+		return errors.New("vertex weld epsilon must be >= 0")
+	}
+	compilerOpts.IndexVertices = ctx.Bool("index-vertices")
+	compilerOpts.VertexWeldEpsilon = float32(ctx.Float64("vertex-weld-epsilon"))
+
 	for idx := 0; idx < ctx.NArg(); idx++ {
 		sceneFile := ctx.Args().Get(idx)
-		if !strings.HasSuffix(sceneFile, ".obj") {
+		ext := filepath.Ext(sceneFile)
+		if ext != ".obj" && ext != ".gltf" && ext != ".glb" {
 			logger.Warning("skipping unsupported file %s", sceneFile)
 			continue
 		}
 
 		logger.Noticef("parsing and compiling scene: %s", sceneFile)
-		sc, err := reader.ReadScene(sceneFile)
+		sc, diagnostics, err := reader.ReadSceneWithOptions(sceneFile, compilerOpts)
 		if err != nil {
 			return err
 		}
 
-		// Display compiled scene info
+		// Display compiled scene info and any compiler diagnostics
 		logger.Noticef("scene information:\n%s", sc.Stats())
+		if entries := diagnostics.Entries(); len(entries) > 0 {
+			rows := make([][]string, 0, len(entries))
+			for _, d := range entries {
+				rows = append(rows, []string{d.Severity.String(), d.Stage.String(), fmt.Sprint(d.Index), d.Message})
+			}
 
-		zipFile := strings.Replace(sceneFile, ".obj", ".zip", -1)
+			var buf bytes.Buffer
+			table := tablewriter.NewWriter(&buf)
+			table.SetAutoWrapText(false)
+			table.SetHeader(diagnosticsHeader)
+			table.AppendBulk(rows)
+			table.Render()
+			logger.Noticef("compiler diagnostics:\n%s", buf.String())
+		}
+
+		zipFile := strings.TrimSuffix(sceneFile, ext) + ".zip"
 		err = writer.WriteScene(sc, zipFile)
 		if err != nil {
 			return err
@@ -62,3 +166,138 @@ func ShowSceneInfo(ctx *cli.Context) error {
 
 	return nil
 }
+
+// Compile or load a scene and dump its contents.
+func InspectScene(ctx *cli.Context) error {
+	setupLogging(ctx)
+
+	sceneFile := ctx.String("scene")
+	if sceneFile == "" {
+		return errors.New("missing scene file argument")
+	}
+
+	sc, diagnostics, err := reader.ReadSceneWithOptions(sceneFile, compiler.DefaultOptions())
+	if err != nil {
+		return err
+	}
+
+	return writeSceneReport(os.Stdout, sc, diagnostics, ctx.Bool("json"))
+}
+
+// A scene introspection report augmented with statistics for the scene BVH
+// trees and the diagnostics emitted while compiling the scene.
+type sceneReport struct {
+	*scene.Report
+	Bvh         []sceneReportBvhEntry   `json:"bvh"`
+	Diagnostics []sceneReportDiagnostic `json:"diagnostics,omitempty"`
+}
+
+// BVH statistics for a (top or bottom level) BVH tree.
+type sceneReportBvhEntry struct {
+	Name string `json:"name"`
+	bvh.Stats
+}
+
+// A diagnostic emitted by the scene compiler.
+type sceneReportDiagnostic struct {
+	Severity string `json:"severity"`
+	Stage    string `json:"stage"`
+	Index    int    `json:"index"`
+	Message  string `json:"message"`
+}
+
+// The table header for compiler diagnostics.
+var diagnosticsHeader = []string{"Severity", "Stage", "Index", "Message"}
+
+// Generate an introspection report for the scene and collect the statistics
+// of the top-level BVH and each mesh BVH. If the scene was compiled, the
+// compiler diagnostics are also included in the report.
+func newSceneReport(sc *scene.Scene, diagnostics *compiler.CompileDiagnostics) *sceneReport {
+	report := &sceneReport{
+		Report: sc.Report(),
+		Bvh:    make([]sceneReportBvhEntry, 0),
+	}
+
+	if len(sc.BvhNodeList) > 0 {
+		report.Bvh = append(report.Bvh, sceneReportBvhEntry{"scene", bvh.TreeStats(sc.BvhNodeList, 0, true)})
+	}
+	for meshIndex, mr := range sc.MeshRanges {
+		report.Bvh = append(report.Bvh, sceneReportBvhEntry{fmt.Sprintf("mesh %d", meshIndex), bvh.TreeStats(sc.BvhNodeList, mr.BvhRoot, false)})
+	}
+
+	if diagnostics != nil {
+		for _, d := range diagnostics.Entries() {
+			report.Diagnostics = append(report.Diagnostics, sceneReportDiagnostic{d.Severity.String(), d.Stage.String(), d.Index, d.Message})
+		}
+	}
+
+	return report
+}
+
+// Write a scene introspection report to w either as a set of tables or as JSON.
+func writeSceneReport(w io.Writer, sc *scene.Scene, diagnostics *compiler.CompileDiagnostics, asJSON bool) error {
+	report := newSceneReport(sc, diagnostics)
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	var buf bytes.Buffer
+	writeTable := func(title string, header []string, rows [][]string) {
+		fmt.Fprintf(&buf, "%s\n", title)
+		table := tablewriter.NewWriter(&buf)
+		table.SetAutoFormatHeaders(false)
+		table.SetAutoWrapText(false)
+		table.SetHeader(header)
+		table.AppendBulk(rows)
+		table.Render()
+		buf.WriteString("\n")
+	}
+
+	if m := report.Metadata; !m.IsEmpty() {
+		writeTable("Metadata", []string{"Name", "Author", "Units", "Created"}, [][]string{
+			{m.Name, m.Author, m.Units, m.Created},
+		})
+	}
+
+	s := report.Summary
+	writeTable("Summary", []string{"Meshes", "Mesh instances", "Primitives", "Emissives", "Material nodes", "Textures"}, [][]string{
+		{fmt.Sprint(s.Meshes), fmt.Sprint(s.MeshInstances), fmt.Sprint(s.Primitives), fmt.Sprint(s.EmissivePrimitives), fmt.Sprint(s.MaterialNodes), fmt.Sprint(s.Textures)},
+	})
+
+	rows := make([][]string, 0)
+	for _, entry := range report.Memory {
+		rows = append(rows, []string{entry.Asset, fmt.Sprint(entry.Bytes)})
+	}
+	writeTable("Memory", []string{"Asset", "Bytes"}, rows)
+
+	rows = make([][]string, 0)
+	for _, entry := range report.Bvh {
+		rows = append(rows, []string{entry.Name, fmt.Sprint(entry.Nodes), fmt.Sprint(entry.Leafs), fmt.Sprint(entry.MaxDepth), fmt.Sprint(entry.Items), fmt.Sprintf("%d/%d/%.1f", entry.MinLeafItems, entry.MaxLeafItems, entry.AvgLeafItems)})
+	}
+	writeTable("BVH", []string{"Tree", "Nodes", "Leafs", "Max depth", "Primitives/instances", "Min/max/avg leaf items"}, rows)
+
+	rows = make([][]string, 0)
+	for _, entry := range report.Materials {
+		rows = append(rows, []string{fmt.Sprint(entry.Index), entry.Type, fmt.Sprint(entry.Root)})
+	}
+	writeTable("Materials", []string{"Node", "Type", "Root"}, rows)
+
+	rows = make([][]string, 0)
+	for _, entry := range report.Textures {
+		rows = append(rows, []string{fmt.Sprint(entry.Index), entry.Format, fmt.Sprintf("%dx%d", entry.Width, entry.Height), fmt.Sprint(entry.DataOffset), fmt.Sprint(entry.Layers), fmt.Sprint(entry.MipLevels), entry.WrapMode})
+	}
+	writeTable("Textures", []string{"Texture", "Format", "Dimensions", "Data offset", "Layers", "Mip levels", "Wrap mode"}, rows)
+
+	if len(report.Diagnostics) > 0 {
+		rows = make([][]string, 0)
+		for _, entry := range report.Diagnostics {
+			rows = append(rows, []string{entry.Severity, entry.Stage, fmt.Sprint(entry.Index), entry.Message})
+		}
+		writeTable("Diagnostics", diagnosticsHeader, rows)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
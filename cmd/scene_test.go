@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/scene/reader"
+)
+
+const tinyScene = `
+scene_name tiny scene
+v 0 0 0
+v 1 0 0
+v 0.5 1 0
+o triangle
+f 1 2 3
+`
+
+func TestInspectScene(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sceneFile := filepath.Join(dir, "tiny.obj")
+	err = ioutil.WriteFile(sceneFile, []byte(tinyScene), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc, diagnostics, err := reader.ReadSceneWithOptions(sceneFile, compiler.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Text output
+	var buf bytes.Buffer
+	err = writeSceneReport(&buf, sc, diagnostics, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, exp := range []string{"Metadata", "tiny scene", "Summary", "Memory", "BVH", "Materials", "Textures", "mesh 0", "diffuse"} {
+		if !strings.Contains(out, exp) {
+			t.Fatalf("expected text output to contain %q; got:\n%s", exp, out)
+		}
+	}
+
+	// JSON output
+	buf.Reset()
+	err = writeSceneReport(&buf, sc, diagnostics, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report sceneReport
+	err = json.Unmarshal(buf.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Metadata.Name != "tiny scene" {
+		t.Fatalf("expected report metadata to contain the scene name; got %q", report.Metadata.Name)
+	}
+	if report.Summary.Meshes != 1 {
+		t.Fatalf("expected report to contain 1 mesh; got %d", report.Summary.Meshes)
+	}
+	if report.Summary.Primitives != 1 {
+		t.Fatalf("expected report to contain 1 primitive; got %d", report.Summary.Primitives)
+	}
+	if report.Summary.MeshInstances != 1 {
+		t.Fatalf("expected report to contain 1 mesh instance; got %d", report.Summary.MeshInstances)
+	}
+	if len(report.Bvh) != 2 {
+		t.Fatalf("expected report to contain 2 BVH entries; got %d", len(report.Bvh))
+	}
+	for _, key := range []string{`"metadata"`, `"summary"`, `"memory"`, `"bvh"`, `"materials"`, `"textures"`} {
+		if !strings.Contains(buf.String(), key) {
+			t.Fatalf("expected JSON output to contain key %s", key)
+		}
+	}
+}
+
+func TestInspectSceneDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "polaris-inspect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The second face is degenerate and triggers a compiler warning
+	sceneFile := filepath.Join(dir, "degenerate.obj")
+	err = ioutil.WriteFile(sceneFile, []byte(tinyScene+"v 2 0 0\nf 1 2 4\n"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc, diagnostics, err := reader.ReadSceneWithOptions(sceneFile, compiler.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics == nil || len(diagnostics.ForStage(compiler.StageGeometry)) != 1 {
+		t.Fatalf("expected the compiler to emit 1 geometry diagnostic; got %v", diagnostics)
+	}
+
+	var buf bytes.Buffer
+	err = writeSceneReport(&buf, sc, diagnostics, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, exp := range []string{"Diagnostics", "warning", "geometry", "degenerate"} {
+		if !strings.Contains(out, exp) {
+			t.Fatalf("expected text output to contain %q; got:\n%s", exp, out)
+		}
+	}
+
+	buf.Reset()
+	err = writeSceneReport(&buf, sc, diagnostics, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report sceneReport
+	err = json.Unmarshal(buf.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Diagnostics) != len(diagnostics.Entries()) || report.Diagnostics[0].Stage != "geometry" {
+		t.Fatalf("expected report to contain the compiler diagnostics; got %+v", report.Diagnostics)
+	}
+}
@@ -0,0 +1,335 @@
+package exr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	magicNumber uint32 = 20000630
+
+	// Version 2 with the long attribute/channel name flag cleared.
+	version      uint32 = 2
+	longNameFlag uint32 = 0x400
+
+	// Max attribute and channel name length for files without the long name flag.
+	maxShortNameLen = 31
+
+	// Supported compression and pixel types.
+	compressionNone uint8  = 0
+	pixelTypeFloat  uint32 = 2
+)
+
+var (
+	// The default channel names for single channel layers.
+	DepthChannels = []string{"Z"}
+
+	// The default channel names for 3-channel color layers.
+	RgbChannels = []string{"R", "G", "B"}
+
+	// The default channel names for 3-channel vector layers.
+	XyzChannels = []string{"X", "Y", "Z"}
+)
+
+// A named image layer consisting of one or more float channels. Layer
+// channels are stored in the file as "<layer name>.<channel name>"; if the
+// layer name is empty the channel names are used as-is.
+type Layer struct {
+	Name     string
+	Channels []string
+
+	// Pixel data stored in row-major order with interleaved channel values.
+	Data []float32
+}
+
+// A channel entry mapping a file channel to a layer channel.
+type channel struct {
+	name    string
+	layer   int
+	channel int
+	stride  int
+}
+
+// Write a set of layers as an uncompressed single-part, scanline OpenEXR image.
+func Write(w io.Writer, width, height int, layers []Layer) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("exr: invalid image dimensions %dx%d", width, height)
+	}
+
+	channels, err := flattenChannels(width, height, layers)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	flags := version
+	for _, ch := range channels {
+		if len(ch.name) > maxShortNameLen {
+			flags |= longNameFlag
+		}
+	}
+	writeLE(&buf, magicNumber)
+	writeLE(&buf, flags)
+
+	// Encode header
+	var chList bytes.Buffer
+	for _, ch := range channels {
+		chList.WriteString(ch.name)
+		chList.WriteByte(0)
+		writeLE(&chList, pixelTypeFloat)
+		chList.Write([]byte{0, 0, 0, 0}) // pLinear + reserved
+		writeLE(&chList, int32(1))       // xSampling
+		writeLE(&chList, int32(1))       // ySampling
+	}
+	chList.WriteByte(0)
+
+	window := []int32{0, 0, int32(width - 1), int32(height - 1)}
+	writeAttribute(&buf, "channels", "chlist", chList.Bytes())
+	writeAttribute(&buf, "compression", "compression", []byte{compressionNone})
+	writeAttribute(&buf, "dataWindow", "box2i", encodeLE(window))
+	writeAttribute(&buf, "displayWindow", "box2i", encodeLE(window))
+	writeAttribute(&buf, "lineOrder", "lineOrder", []byte{0})
+	writeAttribute(&buf, "pixelAspectRatio", "float", encodeLE(float32(1)))
+	writeAttribute(&buf, "screenWindowCenter", "v2f", encodeLE([]float32{0, 0}))
+	writeAttribute(&buf, "screenWindowWidth", "float", encodeLE(float32(1)))
+	buf.WriteByte(0)
+
+	// Each scanline is stored in its own chunk: y, data size and the
+	// scanline values for each channel in channel list order.
+	lineSize := width * len(channels) * 4
+	chunkOffset := uint64(buf.Len() + 8*height)
+	for y := 0; y < height; y++ {
+		writeLE(&buf, chunkOffset+uint64(y*(8+lineSize)))
+	}
+
+	line := make([]float32, width)
+	for y := 0; y < height; y++ {
+		writeLE(&buf, int32(y))
+		writeLE(&buf, int32(lineSize))
+		for _, ch := range channels {
+			data := layers[ch.layer].Data
+			for x := 0; x < width; x++ {
+				line[x] = data[(y*width+x)*ch.stride+ch.channel]
+			}
+			writeLE(&buf, line)
+		}
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// Read the layers of an uncompressed single-part, scanline OpenEXR image
+// with float channels. Channels are grouped into layers by splitting their
+// names at the last dot.
+func Read(r io.Reader) (width, height int, layers []Layer, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	rd := &reader{data: data}
+
+	if rd.uint32() != magicNumber {
+		return 0, 0, nil, errors.New("exr: invalid magic number")
+	}
+	if flags := rd.uint32(); flags&0xff != version || flags&^(0xff|longNameFlag) != 0 {
+		return 0, 0, nil, fmt.Errorf("exr: unsupported version/flags 0x%x", flags)
+	}
+
+	// Parse header
+	var chNames []string
+	var window []int32
+	for rd.err == nil {
+		name := rd.cstring()
+		if name == "" {
+			break
+		}
+		_ = rd.cstring() // attribute type
+		value := rd.bytes(int(rd.uint32()))
+
+		switch name {
+		case "channels":
+			chNames, err = parseChannelList(value)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+		case "compression":
+			if len(value) != 1 || value[0] != compressionNone {
+				return 0, 0, nil, errors.New("exr: only uncompressed images are supported")
+			}
+		case "dataWindow":
+			window = make([]int32, 4)
+			err = binary.Read(bytes.NewReader(value), binary.LittleEndian, window)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+		}
+	}
+	if rd.err != nil {
+		return 0, 0, nil, rd.err
+	}
+	if chNames == nil || window == nil {
+		return 0, 0, nil, errors.New("exr: missing channels or dataWindow header attribute")
+	}
+
+	width = int(window[2]-window[0]) + 1
+	height = int(window[3]-window[1]) + 1
+
+	// Group channels into layers
+	channels := make([]channel, len(chNames))
+	layerIndex := make(map[string]int, 0)
+	for index, name := range chNames {
+		layerName, chName := "", name
+		if dot := strings.LastIndex(name, "."); dot != -1 {
+			layerName, chName = name[:dot], name[dot+1:]
+		}
+		li, exists := layerIndex[layerName]
+		if !exists {
+			li = len(layers)
+			layerIndex[layerName] = li
+			layers = append(layers, Layer{Name: layerName})
+		}
+		channels[index] = channel{name: name, layer: li, channel: len(layers[li].Channels)}
+		layers[li].Channels = append(layers[li].Channels, chName)
+	}
+	for index := range layers {
+		layers[index].Data = make([]float32, width*height*len(layers[index].Channels))
+	}
+
+	// Skip offset table and read scanline chunks
+	rd.bytes(8 * height)
+	line := make([]float32, width)
+	for chunk := 0; chunk < height && rd.err == nil; chunk++ {
+		y := int(int32(rd.uint32()) - window[1])
+		size := int(rd.uint32())
+		if y < 0 || y >= height || size != width*len(channels)*4 {
+			return 0, 0, nil, fmt.Errorf("exr: invalid scanline chunk %d", chunk)
+		}
+		for _, ch := range channels {
+			err = binary.Read(bytes.NewReader(rd.bytes(width*4)), binary.LittleEndian, line)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			layer := layers[ch.layer]
+			for x := 0; x < width; x++ {
+				layer.Data[(y*width+x)*len(layer.Channels)+ch.channel] = line[x]
+			}
+		}
+	}
+
+	return width, height, layers, rd.err
+}
+
+// Map layer channels to a list of file channels sorted by name.
+func flattenChannels(width, height int, layers []Layer) ([]channel, error) {
+	channels := make([]channel, 0)
+	seen := make(map[string]bool, 0)
+	for li, layer := range layers {
+		if len(layer.Channels) == 0 {
+			return nil, fmt.Errorf("exr: layer %q has no channels", layer.Name)
+		}
+		if len(layer.Data) != width*height*len(layer.Channels) {
+			return nil, fmt.Errorf("exr: layer %q should contain %d values; got %d", layer.Name, width*height*len(layer.Channels), len(layer.Data))
+		}
+
+		for ci, chName := range layer.Channels {
+			name := chName
+			if layer.Name != "" {
+				name = layer.Name + "." + chName
+			}
+			if chName == "" || seen[name] {
+				return nil, fmt.Errorf("exr: invalid or duplicate channel name %q", name)
+			}
+			seen[name] = true
+			channels = append(channels, channel{name: name, layer: li, channel: ci, stride: len(layer.Channels)})
+		}
+	}
+
+	// The EXR spec requires channels to be sorted by name
+	sort.Slice(channels, func(i, j int) bool { return channels[i].name < channels[j].name })
+	return channels, nil
+}
+
+// Parse the channel names from a chlist attribute.
+func parseChannelList(value []byte) ([]string, error) {
+	rd := &reader{data: value}
+	names := make([]string, 0)
+	for {
+		name := rd.cstring()
+		if rd.err != nil {
+			return nil, rd.err
+		}
+		if name == "" {
+			return names, nil
+		}
+		if pixelType := rd.uint32(); pixelType != pixelTypeFloat {
+			return nil, fmt.Errorf("exr: channel %q uses unsupported pixel type %d", name, pixelType)
+		}
+		rd.bytes(12) // pLinear, reserved, xSampling, ySampling
+		names = append(names, name)
+	}
+}
+
+// Write a header attribute.
+func writeAttribute(buf *bytes.Buffer, name, attrType string, value []byte) {
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	buf.WriteString(attrType)
+	buf.WriteByte(0)
+	writeLE(buf, uint32(len(value)))
+	buf.Write(value)
+}
+
+func writeLE(buf *bytes.Buffer, data interface{}) {
+	binary.Write(buf, binary.LittleEndian, data)
+}
+
+func encodeLE(data interface{}) []byte {
+	var buf bytes.Buffer
+	writeLE(&buf, data)
+	return buf.Bytes()
+}
+
+// A simple byte reader that records the first encountered error.
+type reader struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if n < 0 {
+		n = 0
+	}
+	if r.err != nil || r.offset+n > len(r.data) {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	out := r.data[r.offset : r.offset+n]
+	r.offset += n
+	return out
+}
+
+func (r *reader) uint32() uint32 {
+	return binary.LittleEndian.Uint32(r.bytes(4))
+}
+
+func (r *reader) cstring() string {
+	if r.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(r.data[r.offset:], 0)
+	if end == -1 {
+		r.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	out := string(r.data[r.offset : r.offset+end])
+	r.offset += end + 1
+	return out
+}
@@ -0,0 +1,92 @@
+package exr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMultiLayerWriteRead(t *testing.T) {
+	layers := []Layer{
+		{
+			Name:     "beauty",
+			Channels: RgbChannels,
+			Data: []float32{
+				1, 2, 3, 4, 5, 6,
+				7, 8, 9, 10, 11, 12,
+			},
+		},
+		{
+			Name:     "depth",
+			Channels: DepthChannels,
+			Data:     []float32{0.5, 1.5, 2.5, 3.5},
+		},
+		{
+			Name:     "normal",
+			Channels: XyzChannels,
+			Data: []float32{
+				0, 0, 1, 0, 1, 0,
+				1, 0, 0, 0, 0, -1,
+			},
+		},
+		{
+			Name:     "albedo",
+			Channels: RgbChannels,
+			Data: []float32{
+				0.1, 0.2, 0.3, 0.4, 0.5, 0.6,
+				0.7, 0.8, 0.9, 1.0, 1.1, 1.2,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, 2, 2, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width, height, readLayers, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 2 || height != 2 {
+		t.Fatalf("expected image dims to be 2x2; got %dx%d", width, height)
+	}
+
+	// Channels are sorted by name so layers are read back in alphabetical order
+	expNames := []string{"albedo", "beauty", "depth", "normal"}
+	if len(readLayers) != len(expNames) {
+		t.Fatalf("expected %d layers; got %d", len(expNames), len(readLayers))
+	}
+	for index, expName := range expNames {
+		if readLayers[index].Name != expName {
+			t.Fatalf("[layer %d] expected name to be %q; got %q", index, expName, readLayers[index].Name)
+		}
+	}
+
+	// Bottom-right beauty pixel
+	beauty := readLayers[1]
+	if len(beauty.Channels) != 3 || beauty.Channels[0] != "B" || beauty.Channels[2] != "R" {
+		t.Fatalf("expected beauty channels to be [B G R]; got %v", beauty.Channels)
+	}
+	if beauty.Data[3*3+0] != 12 || beauty.Data[3*3+2] != 10 {
+		t.Fatalf("expected bottom-right beauty pixel (B, R) to be (12, 10); got (%f, %f)", beauty.Data[3*3+0], beauty.Data[3*3+2])
+	}
+
+	depth := readLayers[2]
+	if depth.Data[2] != 2.5 {
+		t.Fatalf("expected depth at (0, 1) to be 2.5; got %f", depth.Data[2])
+	}
+}
+
+func TestWriteLayerSizeMismatch(t *testing.T) {
+	layers := []Layer{
+		{Name: "depth", Channels: DepthChannels, Data: []float32{1, 2, 3}},
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, 2, 2, layers)
+	expError := `exr: layer "depth" should contain 4 values; got 3`
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected to get error %q; got %v", expError, err)
+	}
+}
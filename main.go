@@ -46,8 +46,87 @@ func main() {
 					Name:        "compile",
 					Usage:       "compile text scene representation into a binary compressed format",
 					Description: sceneCompileHelp,
-					ArgsUsage:   "scene_file1.obj scene_file2.obj ...",
-					Action:      cmd.CompileScene,
+					ArgsUsage:   "scene_file1.obj scene_file2.gltf ...",
+					Flags: []cli.Flag{
+						cli.Float64Flag{
+							Name:  "sah-traversal-cost",
+							Value: 1.0,
+							Usage: "the SAH cost for traversing a BVH node",
+						},
+						cli.Float64Flag{
+							Name:  "sah-intersection-cost",
+							Value: 1.0,
+							Usage: "the SAH cost for intersecting a primitive",
+						},
+						cli.IntFlag{
+							Name:  "min-leaf-primitives",
+							Value: 10,
+							Usage: "the minimum number of primitives required for creating a mesh BVH leaf",
+						},
+						cli.IntFlag{
+							Name:  "max-leaf-instances",
+							Value: 1,
+							Usage: "the number of mesh instances that may share a top-level BVH leaf",
+						},
+						cli.IntFlag{
+							Name:  "build-threads",
+							Value: 0,
+							Usage: "the number of threads for building mesh BVH trees (0 uses one thread per CPU)",
+						},
+						cli.StringFlag{
+							Name:  "bvh-split",
+							Value: "sweep",
+							Usage: "the BVH node split strategy (sweep, median, sah)",
+						},
+						cli.BoolFlag{
+							Name:  "strict-checks",
+							Usage: "verify that compiled BVH node and primitive offsets are within bounds",
+						},
+						cli.StringFlag{
+							Name:  "smooth-normals",
+							Value: "none",
+							Usage: "recompute the vertex normals of smooth-shaded meshes by averaging face normals weighted by primitive area or corner angle (none, area, angle)",
+						},
+						cli.StringFlag{
+							Name:  "front-face",
+							Value: "ccw",
+							Usage: "the vertex winding order of front-facing primitives (ccw, cw)",
+						},
+						cli.StringFlag{
+							Name:  "fix-winding",
+							Value: "none",
+							Usage: "flip primitives whose winding is inconsistent with their neighbors and optionally orient them outwards (none, consistent, outward)",
+						},
+						cli.BoolFlag{
+							Name:  "no-mipmaps",
+							Usage: "do not generate mipmap levels for baked textures",
+						},
+						cli.IntFlag{
+							Name:  "vertex-ao-samples",
+							Value: 0,
+							Usage: "bake per-vertex ambient occlusion using the specified number of hemisphere rays (0 disables baking)",
+						},
+						cli.Float64Flag{
+							Name:  "vertex-ao-distance",
+							Value: 0,
+							Usage: "the max distance of the vertex AO rays (0 for unbounded rays)",
+						},
+						cli.Float64Flag{
+							Name:  "intersection-epsilon",
+							Value: 0,
+							Usage: "override the ray intersection epsilon (0 derives the epsilon from the scene bounds)",
+						},
+						cli.BoolFlag{
+							Name:  "index-vertices",
+							Usage: "deduplicate shared vertices and store primitives as an index list",
+						},
+						cli.Float64Flag{
+							Name:  "vertex-weld-epsilon",
+							Value: 0,
+							Usage: "the quantization step for detecting duplicate vertices when indexing (0 only merges identical vertices)",
+						},
+					},
+					Action: cmd.CompileScene,
 				},
 				{
 					Name:      "info",
@@ -57,6 +136,22 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:      "inspect",
+			Usage:     "compile or load a scene and dump its contents",
+			ArgsUsage: "--scene scene_file.obj or scene_file.zip",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "scene",
+					Usage: "the scene file to inspect",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "output report in JSON format",
+				},
+			},
+			Action: cmd.InspectScene,
+		},
 		{
 			Name:   "list-devices",
 			Usage:  "list available opencl devices",
@@ -71,7 +166,7 @@ func main() {
 					Name:        "frame",
 					Usage:       "render single frame",
 					Description: `Render a single frame.`,
-					ArgsUsage:   "scene_file.zip or scene_file.obj",
+					ArgsUsage:   "[scene_file.zip or scene_file.obj]",
 					Flags: []cli.Flag{
 						cli.IntFlag{
 							Name:  "width",
@@ -83,11 +178,21 @@ func main() {
 							Value: 1024,
 							Usage: "frame height",
 						},
+						cli.StringFlag{
+							Name:  "scene",
+							Value: "",
+							Usage: "scene file to render; alternative to passing the scene file as an argument",
+						},
 						cli.IntFlag{
-							Name:  "spp",
+							Name:  "spp, samples",
 							Value: 16,
 							Usage: "samples per pixel",
 						},
+						cli.DurationFlag{
+							Name:  "time-budget",
+							Value: 0,
+							Usage: "keep tracing samples until this wall-clock duration elapses; spp caps the number of samples if non-zero (0 disables the budget)",
+						},
 						cli.IntFlag{
 							Name:  "num-bounces, nb",
 							Value: 5,
@@ -98,6 +203,26 @@ func main() {
 							Value: 3,
 							Usage: "number of indirect ray bounces before applying RR (disabled if 0 or >= than num-bounces)",
 						},
+						cli.IntFlag{
+							Name:  "nee-bounces",
+							Value: 0,
+							Usage: "number of indirect ray bounces before sampling emissives via next-event estimation; shallower bounces only use bxdf sampling",
+						},
+						cli.StringFlag{
+							Name:  "throughput-clamp",
+							Value: "",
+							Usage: "comma-delimited list of max path throughput values indexed by bounce depth (0 disables clamping for a bounce)",
+						},
+						cli.StringFlag{
+							Name:  "seed-policy",
+							Value: "animated",
+							Usage: "the policy for selecting the noise seed of each frame; static derives the seed from the frame index while animated uses a random seed (static, animated)",
+						},
+						cli.IntFlag{
+							Name:  "frame-index",
+							Value: 0,
+							Usage: "the index of the rendered frame; used for deriving the noise seed when using the static seed policy",
+						},
 						cli.Float64Flag{
 							Name:  "exposure",
 							Value: 1.2,
@@ -113,14 +238,112 @@ func main() {
 							Value: "",
 							Usage: "force a particular device name as the primary device",
 						},
+						cli.StringFlag{
+							Name:  "device",
+							Value: "",
+							Usage: "only render using the opencl device with this platform:device index pair (e.g. 0:1) or whose name contains this value (case-insensitive)",
+						},
+						cli.StringFlag{
+							Name:  "crop",
+							Value: "",
+							Usage: "only render the pixels inside a x,y,w,h crop window; the crop lines up with the full frame render",
+						},
 						cli.StringFlag{
 							Name:  "out, o",
 							Value: "frame.png",
 							Usage: "image filename for the rendered frame",
 						},
+						cli.StringFlag{
+							Name:  "aov-out",
+							Value: "",
+							Usage: "optional filename for writing a multi-layer EXR with beauty, depth, normal, albedo and variance AOVs",
+						},
+						cli.Float64Flag{
+							Name:  "firefly-threshold",
+							Value: 0,
+							Usage: "add a firefly mask layer to the AOV output flagging pixels whose luminance exceeds this multiple of the median luminance of their neighbors (0 disables the mask)",
+						},
+						cli.StringFlag{
+							Name:  "blue-noise",
+							Value: "",
+							Usage: "optional blue-noise texture for decorrelating the sample offsets of neighboring pixels",
+						},
+						cli.StringFlag{
+							Name:  "camera",
+							Value: "",
+							Usage: "override the scene camera using a spec such as \"lookfrom=0,1,5 lookat=0,0,0 vup=0,1,0 fov=45\"",
+						},
+						cli.StringFlag{
+							Name:  "color-lut",
+							Value: "",
+							Usage: "optional 1D or 3D color lookup table in .cube format for grading the tone-mapped output",
+						},
+						cli.IntFlag{
+							Name:  "texture-budget",
+							Value: 0,
+							Usage: "max MiB of texture data to keep resident on the device; the least recently sampled textures are evicted when the budget is exceeded (0 keeps all textures resident)",
+						},
+						cli.Float64Flag{
+							Name:  "stereo-ipd",
+							Value: 0,
+							Usage: "render a stereo pair whose eye cameras are separated by this interpupillary distance in scene units; the eye name is appended to the output filenames (0 disables stereo rendering)",
+						},
 					},
 					Action: cmd.RenderFrame,
 				},
+				{
+					Name:        "pattern",
+					Usage:       "render a procedural test pattern",
+					Description: `Render a procedural test pattern without loading a scene for verifying the tone-mapping and output path.`,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "width",
+							Value: 1024,
+							Usage: "frame width",
+						},
+						cli.IntFlag{
+							Name:  "height",
+							Value: 1024,
+							Usage: "frame height",
+						},
+						cli.StringFlag{
+							Name:  "pattern",
+							Value: "bars",
+							Usage: "the test pattern to render (bars, gradient, uv)",
+						},
+						cli.Float64Flag{
+							Name:  "exposure",
+							Value: 1.0,
+							Usage: "camera exposure for tone-mapping",
+						},
+						cli.StringSliceFlag{
+							Name:  "blacklist, b",
+							Value: &cli.StringSlice{},
+							Usage: "blacklist opencl device whose names contain this value",
+						},
+						cli.StringFlag{
+							Name:  "force-primary",
+							Value: "",
+							Usage: "force a particular device name as the primary device",
+						},
+						cli.StringFlag{
+							Name:  "device",
+							Value: "",
+							Usage: "only render using the opencl device with this platform:device index pair (e.g. 0:1) or whose name contains this value (case-insensitive)",
+						},
+						cli.StringFlag{
+							Name:  "color-lut",
+							Value: "",
+							Usage: "optional 1D or 3D color lookup table in .cube format for grading the tone-mapped output",
+						},
+						cli.StringFlag{
+							Name:  "out, o",
+							Value: "pattern.png",
+							Usage: "image filename for the rendered pattern",
+						},
+					},
+					Action: cmd.RenderTestPattern,
+				},
 				{
 					Name:        "interactive",
 					Usage:       "render interactive view of the scene",
@@ -151,6 +374,26 @@ func main() {
 							Value: 3,
 							Usage: "number of indirect ray bounces before applying RR (disabled if 0 or >= than num-bounces)",
 						},
+						cli.IntFlag{
+							Name:  "nee-bounces",
+							Value: 0,
+							Usage: "number of indirect ray bounces before sampling emissives via next-event estimation; shallower bounces only use bxdf sampling",
+						},
+						cli.StringFlag{
+							Name:  "throughput-clamp",
+							Value: "",
+							Usage: "comma-delimited list of max path throughput values indexed by bounce depth (0 disables clamping for a bounce)",
+						},
+						cli.StringFlag{
+							Name:  "seed-policy",
+							Value: "animated",
+							Usage: "the policy for selecting the noise seed of each frame; static derives the seed from the frame index while animated uses a random seed (static, animated)",
+						},
+						cli.IntFlag{
+							Name:  "frame-index",
+							Value: 0,
+							Usage: "the index of the rendered frame; used for deriving the noise seed when using the static seed policy",
+						},
 						cli.Float64Flag{
 							Name:  "exposure",
 							Value: 1.2,
@@ -166,11 +409,45 @@ func main() {
 							Value: "",
 							Usage: "force a particular device name as the primary device",
 						},
+						cli.StringFlag{
+							Name:  "device",
+							Value: "",
+							Usage: "only render using the opencl device with this platform:device index pair (e.g. 0:1) or whose name contains this value (case-insensitive)",
+						},
 						cli.StringFlag{
 							Name:  "scheduler",
 							Value: "perfect",
 							Usage: "select a particular block scheduling algorithm; supported algorithms: naive, perfect",
 						},
+						cli.BoolFlag{
+							Name:  "accumulate",
+							Usage: "progressively accumulate the rendered passes into a host-side buffer and display the accumulated sample count; restarted whenever the camera moves (requires the animated seed policy)",
+						},
+						cli.StringFlag{
+							Name:  "preview-schedule",
+							Value: "4:4,2:8",
+							Usage: "comma-delimited list of scale:frames levels for rendering coarse previews after camera moves; set to empty to always render at full resolution",
+						},
+						cli.StringFlag{
+							Name:  "blue-noise",
+							Value: "",
+							Usage: "optional blue-noise texture for decorrelating the sample offsets of neighboring pixels",
+						},
+						cli.StringFlag{
+							Name:  "camera",
+							Value: "",
+							Usage: "override the scene camera using a spec such as \"lookfrom=0,1,5 lookat=0,0,0 vup=0,1,0 fov=45\"",
+						},
+						cli.StringFlag{
+							Name:  "color-lut",
+							Value: "",
+							Usage: "optional 1D or 3D color lookup table in .cube format for grading the tone-mapped output",
+						},
+						cli.IntFlag{
+							Name:  "texture-budget",
+							Value: 0,
+							Usage: "max MiB of texture data to keep resident on the device; the least recently sampled textures are evicted when the budget is exceeded (0 keeps all textures resident)",
+						},
 					},
 					Action: cmd.RenderInteractive,
 				},
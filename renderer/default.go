@@ -2,7 +2,7 @@ package renderer
 
 import (
 	"fmt"
-	"math/rand"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,6 +12,7 @@ import (
 	"github.com/achilleasa/polaris/tracer"
 	"github.com/achilleasa/polaris/tracer/opencl"
 	"github.com/achilleasa/polaris/tracer/opencl/device"
+	"github.com/achilleasa/polaris/types"
 )
 
 type defaultRenderer struct {
@@ -26,19 +27,55 @@ type defaultRenderer struct {
 	// The list of registered tracers.
 	tracers         []tracer.Tracer
 	jobChans        []chan tracer.BlockRequest
-	jobCompleteChan chan error
+	jobCompleteChan chan jobResult
+
+	// Tracers that failed while processing a block. Failed tracers are
+	// excluded from scheduling for the lifetime of the renderer.
+	failed []bool
 
 	// The selected primary tracer.
 	primary int
 
+	// True if all tracers implement the tracer.HostMerger interface. In
+	// this case, the block output of each pass is summed on the host using
+	// a tile reducer so that the merged output is identical regardless
+	// of the number of tracers and the order in which they complete.
+	hostMerge bool
+
 	// The scheduler for distributing blocks to the list of tracers.
 	scheduler tracer.BlockScheduler
 
 	// The block assignments generated by the scheduler
 	blockAssignments []uint32
 
+	// The dimensions of the frames rendered by the tracers. These
+	// may be smaller than the output frame dims when rendering previews.
+	frameW uint32
+	frameH uint32
+
+	// The index of the next rendered frame.
+	frameIndex uint32
+
+	// The block request used for syncing the last rendered frame.
+	lastSync tracer.BlockRequest
+
 	// Renderer statistics.
 	stats FrameStats
+
+	// The progressive accumulation buffer (nil if accumulation is
+	// disabled) and the scratch buffer for reading rendered frames.
+	accum        *tracer.AccumBuffer
+	accumScratch []float32
+}
+
+// The outcome of a block request processed by a tracer job worker.
+type jobResult struct {
+	trIndex  int
+	blockReq tracer.BlockRequest
+	err      error
+
+	// The trace accumulator samples of the block when merging on the host.
+	partial []types.Vec3
 }
 
 // Create a new default renderer using the specified block scheduler and tracing pipeline.
@@ -47,27 +84,52 @@ func NewDefault(sc *scene.Scene, scheduler tracer.BlockScheduler, pipeline *open
 		return nil, ErrSceneNotDefined
 	} else if sc.Camera == nil {
 		return nil, ErrCameraNotDefined
+	} else if err := opts.Crop.Validate(opts.FrameW, opts.FrameH); err != nil {
+		return nil, err
+	} else if opts.Accumulate && opts.SeedPolicy == tracer.StaticSeed {
+		// Static seeds reproduce the noise pattern of each pass so the
+		// accumulated output would not converge.
+		return nil, ErrStaticSeedAccumulation
 	}
 
 	r := &defaultRenderer{
-		logger:    log.New("renderer"),
-		scheduler: scheduler,
-		options:   opts,
+		logger:     log.New("renderer"),
+		scheduler:  scheduler,
+		options:    opts,
+		frameW:     opts.FrameW,
+		frameH:     opts.FrameH,
+		frameIndex: opts.FrameIndex,
+	}
+	if opts.Accumulate {
+		r.accum = tracer.NewAccumBuffer(opts.FrameW, opts.FrameH)
 	}
 
 	err := r.initTracers(pipeline)
 	if err != nil {
 		return nil, err
 	}
+
+	r.startWorkers(sc)
+	return r, nil
+}
+
+// Queue the scene state changes for each tracer and start a job worker per tracer.
+func (r *defaultRenderer) startWorkers(sc *scene.Scene) {
 	r.jobChans = make([]chan tracer.BlockRequest, len(r.tracers))
-	r.jobCompleteChan = make(chan error, 0)
+	r.jobCompleteChan = make(chan jobResult, 0)
+	r.failed = make([]bool, len(r.tracers))
+	r.hostMerge = true
+	for _, tr := range r.tracers {
+		if _, isHostMerger := tr.(tracer.HostMerger); !isHostMerger {
+			r.hostMerge = false
+		}
+	}
 
-	// Start workers
 	r.workerInitGroup.Add(len(r.tracers))
 	r.workerCloseGroup.Add(len(r.tracers))
 	for trIndex := 0; trIndex < len(r.tracers); trIndex++ {
 		// Queue state changes
-		r.tracers[trIndex].UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{opts.FrameW, opts.FrameH})
+		r.tracers[trIndex].UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{r.frameW, r.frameH})
 		r.tracers[trIndex].UpdateState(tracer.Synchronous, tracer.SceneData, sc)
 		r.tracers[trIndex].UpdateState(tracer.Synchronous, tracer.CameraData, sc.Camera)
 
@@ -78,8 +140,6 @@ func NewDefault(sc *scene.Scene, scheduler tracer.BlockScheduler, pipeline *open
 
 	// wait for all workers to start
 	r.workerInitGroup.Wait()
-
-	return r, nil
 }
 
 // Get last frame stats.
@@ -98,75 +158,417 @@ func (r *defaultRenderer) Close() {
 
 // Render next frame.
 func (r *defaultRenderer) Render() error {
-	return r.renderFrame(0)
+	defer func() { r.frameIndex++ }()
+
+	var err error
+	if r.options.TimeBudget > 0 {
+		err = r.renderFrameWithBudget(r.options.TimeBudget)
+	} else {
+		err = r.renderFrame(0)
+	}
+	if err != nil || r.accum == nil {
+		return err
+	}
+
+	return r.accumulateFrame(0)
+}
+
+// Get the progressive accumulation buffer or nil if accumulation is disabled.
+func (r *defaultRenderer) AccumBuffer() *tracer.AccumBuffer {
+	return r.accum
+}
+
+// Discard the samples in the progressive accumulation buffer.
+func (r *defaultRenderer) ResetAccumulation() {
+	if r.accum == nil {
+		return
+	}
+
+	r.accum.Reset()
+	r.stats.AccumulatedSamples = 0
+}
+
+// Render a progressive pass that continues from the specified number of
+// samples that the tracers have already accumulated for the current view. If
+// accumulation is enabled, the samples traced by the pass are added to the
+// accumulation buffer. Scaled-down preview frames are not accumulated.
+func (r *defaultRenderer) renderPass(accumulatedSamples uint32) error {
+	err := r.renderFrame(accumulatedSamples)
+	if err != nil || r.accum == nil || r.frameW != r.options.FrameW || r.frameH != r.options.FrameH {
+		return err
+	}
+
+	return r.accumulateFrame(accumulatedSamples)
+}
+
+// Read the last rendered frame from the primary tracer and add the samples
+// traced by the last pass to the progressive accumulation buffer. The frame
+// is averaged over all samples that the tracers accumulated for the current
+// view; prevSamples of these have already been added to the buffer by
+// previous passes and are subtracted from the frame before adding it.
+func (r *defaultRenderer) accumulateFrame(prevSamples uint32) error {
+	frameReader, isFrameReader := r.tracers[r.primary].(tracer.FrameReader)
+	if !isFrameReader {
+		return tracer.ErrFrameReadNotSupported
+	}
+
+	if r.accumScratch == nil {
+		r.accumScratch = make([]float32, 4*r.frameW*r.frameH)
+	}
+	frame, err := frameReader.ReadFrame(&r.lastSync, r.accumScratch)
+	if err != nil {
+		return err
+	}
+
+	pixels := make([]types.Vec4, len(frame)/4)
+	for index := range pixels {
+		copy(pixels[index][:], frame[4*index:4*index+4])
+	}
+
+	// Only add the samples traced by the last pass. If the buffer was reset
+	// since the previous pass, it no longer contains the earlier samples of
+	// the view and the entire frame is added instead.
+	newSamples := r.stats.Samples
+	if prevSamples > 0 && r.accum.Samples() == prevSamples {
+		prevFrame := r.accum.Resolve()
+		newSamples -= prevSamples
+		for index, pixel := range pixels {
+			pixels[index] = pixel.Mul(float32(r.stats.Samples)).
+				Sub(prevFrame[index].Mul(float32(prevSamples))).
+				Mul(1.0 / float32(newSamples))
+		}
+	}
+
+	err = r.accum.AddSamples(pixels, newSamples)
+	if err != nil {
+		return fmt.Errorf("renderer: %v", err)
+	}
+
+	r.stats.AccumulatedSamples = r.accum.Samples()
+	return nil
+}
+
+// Render the next frame into a caller-owned buffer. If accumulation is
+// enabled, the buffer receives the contents of the accumulation buffer.
+func (r *defaultRenderer) RenderInto(dst []float32) ([]float32, error) {
+	if err := tracer.ValidateFrameBuffer(dst, r.frameW, r.frameH); err != nil {
+		return nil, fmt.Errorf("renderer: %v", err)
+	}
+
+	frameReader, isFrameReader := r.tracers[r.primary].(tracer.FrameReader)
+	if !isFrameReader {
+		return nil, tracer.ErrFrameReadNotSupported
+	}
+
+	err := r.Render()
+	if err != nil {
+		return nil, err
+	}
+
+	// Return the progressively refined frame if accumulation is enabled
+	if r.accum != nil {
+		for index, pixel := range r.accum.Resolve() {
+			copy(dst[4*index:4*index+4], pixel[:])
+		}
+		return dst, nil
+	}
+
+	return frameReader.ReadFrame(&r.lastSync, dst)
 }
 
 // The actual frame implementation. This is intentionally split so it can be
 // used by the opengl renderer.
 func (r *defaultRenderer) renderFrame(accumulatedSamples uint32) error {
-	var blockReq = tracer.BlockRequest{
-		FrameW:             r.options.FrameW,
-		FrameH:             r.options.FrameH,
-		BlockW:             r.options.FrameW,
+	blockReq := r.newBlockRequest(accumulatedSamples)
+
+	// If running in progressive mode we need to capture a single sample
+	if blockReq.SamplesPerPixel == 0 {
+		blockReq.SamplesPerPixel = 1
+	}
+
+	start := time.Now()
+
+	err := r.traceBlocks(&blockReq)
+	if err != nil {
+		return err
+	}
+
+	r.syncFrame(&blockReq)
+	r.stats.RenderTime = time.Since(start)
+	r.stats.Samples = accumulatedSamples + blockReq.SamplesPerPixel
+	return nil
+}
+
+// Keep accumulating single sample passes until the time budget is exceeded
+// or the requested number of samples per pixel has been collected. The budget
+// is checked between passes so at least one sample is always traced and the
+// actual render time may exceed the budget by the duration of a single pass.
+func (r *defaultRenderer) renderFrameWithBudget(budget time.Duration) error {
+	blockReq := r.newBlockRequest(0)
+	blockReq.SamplesPerPixel = 1
+
+	start := time.Now()
+
+	for {
+		blockReq.Seed = r.options.SeedPolicy.Seed(r.frameIndex, blockReq.AccumulatedSamples)
+		err := r.traceBlocks(&blockReq)
+		if err != nil {
+			return err
+		}
+
+		// The post-process filters weight the accumulated output by the
+		// sample count of the last traced pass so we leave the request
+		// untouched when the loop terminates.
+		samples := blockReq.AccumulatedSamples + 1
+		if time.Since(start) >= budget ||
+			(r.options.SamplesPerPixel != 0 && samples >= r.options.SamplesPerPixel) {
+			break
+		}
+		blockReq.AccumulatedSamples = samples
+	}
+
+	r.syncFrame(&blockReq)
+	r.stats.RenderTime = time.Since(start)
+	r.stats.Samples = blockReq.AccumulatedSamples + 1
+	r.logger.Noticef("collected %d samples per pixel in %s (budget %s)", r.stats.Samples, r.stats.RenderTime, budget)
+	return nil
+}
+
+// Create a block request for the full frame using the renderer options.
+func (r *defaultRenderer) newBlockRequest(accumulatedSamples uint32) tracer.BlockRequest {
+	// The crop window is specified in full resolution frame coordinates
+	var crop tracer.CropWindow
+	if r.frameW == r.options.FrameW && r.frameH == r.options.FrameH {
+		crop = r.options.Crop
+	}
+
+	return tracer.BlockRequest{
+		FrameW:             r.frameW,
+		FrameH:             r.frameH,
+		BlockW:             r.frameW,
 		SamplesPerPixel:    r.options.SamplesPerPixel,
 		Exposure:           r.options.Exposure,
 		NumBounces:         r.options.NumBounces,
 		MinBouncesForRR:    r.options.MinBouncesForRR,
+		MinBouncesForNEE:   r.options.MinBouncesForNEE,
+		ThroughputClamp:    r.options.ThroughputClamp,
+		Crop:               crop,
 		AccumulatedSamples: accumulatedSamples,
-		Seed:               rand.Uint32(),
+		Seed:               r.options.SeedPolicy.Seed(r.frameIndex, accumulatedSamples),
 	}
+}
 
-	// If running in progressive mode we need to capture a single sample
-	if blockReq.SamplesPerPixel == 0 {
-		blockReq.SamplesPerPixel = 1
+// Split the frame into blocks, process them in parallel and wait for all
+// tracers to merge their output into the primary tracer's accumulator. If a
+// secondary tracer fails, it is excluded from scheduling and the rows of its
+// block are redistributed to the remaining tracers. Failures of the primary
+// tracer or of the last remaining tracer abort the frame. If all tracers
+// support host merging, the block outputs are merged using a tile reducer
+// once all blocks are complete.
+func (r *defaultRenderer) traceBlocks(req *tracer.BlockRequest) error {
+	blockReq := *req
+
+	// Only split the crop window rows between tracers if a crop window is set
+	numRows := blockReq.FrameH
+	if blockReq.Crop.IsSet() {
+		numRows = blockReq.Crop.H
+		blockReq.BlockY = blockReq.Crop.Y
 	}
 
-	start := time.Now()
-
-	// Schedule blocks and process them in parallel
-	r.blockAssignments = r.scheduler.Schedule(r.tracers, blockReq.FrameH)
-	for trIndex, blockH := range r.blockAssignments {
+	// Schedule blocks for the tracers that have not failed
+	active, activeIndices := r.activeTracers()
+	r.blockAssignments = make([]uint32, len(r.tracers))
+	queues := make([][]tracer.BlockRequest, len(r.tracers))
+	for index, blockH := range r.scheduler.Schedule(active, numRows) {
+		trIndex := activeIndices[index]
 		blockReq.BlockH = blockH
-		r.jobChans[trIndex] <- blockReq
-
-		r.stats.Tracers[trIndex].BlockH = blockH
-		r.stats.Tracers[trIndex].FramePercent = 100.0 * float32(blockH) / float32(blockReq.FrameH)
+		queues[trIndex] = append(queues[trIndex], blockReq)
+		r.blockAssignments[trIndex] = blockH
 
 		blockReq.BlockY += blockH
 	}
 
-	var tot uint32 = 0
-	for _, bh := range r.blockAssignments {
-		tot += bh
+	// Process blocks in parallel. Each tracer processes a single block at
+	// a time; any additional blocks are queued until its current block is
+	// complete.
+	busy := make([]bool, len(r.tracers))
+	pending := 0
+	dispatch := func(trIndex int) {
+		if busy[trIndex] || len(queues[trIndex]) == 0 {
+			return
+		}
+		busy[trIndex] = true
+		pending++
+		r.jobChans[trIndex] <- queues[trIndex][0]
+		queues[trIndex] = queues[trIndex][1:]
+	}
+	for _, trIndex := range activeIndices {
+		dispatch(trIndex)
 	}
 
 	// Wait for all tracers to finish
-	pending := len(r.tracers)
+	var err error
+	var completed []jobResult
 	for pending != 0 {
-		err, ok := <-r.jobCompleteChan
+		res, ok := <-r.jobCompleteChan
 		if !ok {
-			err = ErrInterrupted
+			return ErrInterrupted
+		}
+		busy[res.trIndex] = false
+		pending--
+		if res.err == nil {
+			completed = append(completed, res)
+		}
+
+		if res.err != nil && err == nil {
+			err = r.redistributeBlock(res, queues)
 		}
 
+		// On failure, wait for the pending blocks before bailing out
 		if err != nil {
+			continue
+		}
+
+		for trIndex := range r.tracers {
+			dispatch(trIndex)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if r.hostMerge {
+		// Merge the rows traced by all blocks
+		frameReq := *req
+		frameReq.BlockY = 0
+		if frameReq.Crop.IsSet() {
+			frameReq.BlockY = frameReq.Crop.Y
+		}
+		frameReq.BlockH = numRows
+		if err = r.reduceBlocks(&frameReq, completed); err != nil {
 			return err
 		}
+	}
 
-		pending--
+	for trIndex, blockH := range r.blockAssignments {
+		r.stats.Tracers[trIndex].BlockH = blockH
+		r.stats.Tracers[trIndex].FramePercent = 100.0 * float32(blockH) / float32(numRows)
 	}
 
-	// Run post-process filters on the primary tracer
+	return nil
+}
+
+// Sum the trace accumulator samples of the completed blocks in row order
+// using a tile reducer and add them to the primary tracer's frame
+// accumulator. As the block layout depends on the number of tracers and
+// their speed, blocks are ordered by their first row.
+func (r *defaultRenderer) reduceBlocks(frameReq *tracer.BlockRequest, completed []jobResult) error {
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].blockReq.BlockY < completed[j].blockReq.BlockY
+	})
+
+	numPixels := int(frameReq.FrameW * frameReq.FrameH)
+	reducer := tracer.NewTileReducer(len(completed), numPixels)
+	for tileIndex, res := range completed {
+		if err := reducer.Submit(tileIndex, res.partial); err != nil {
+			return err
+		}
+	}
+
+	merged := make([]types.Vec3, numPixels)
+	if err := reducer.Reduce(merged); err != nil {
+		return err
+	}
+
+	return r.tracers[r.primary].(tracer.HostMerger).AccumulateFrame(frameReq, merged)
+}
+
+// Get the tracers that have not failed and their indices in the tracer list.
+func (r *defaultRenderer) activeTracers() ([]tracer.Tracer, []int) {
+	active := make([]tracer.Tracer, 0, len(r.tracers))
+	activeIndices := make([]int, 0, len(r.tracers))
+	for trIndex, tr := range r.tracers {
+		if !r.failed[trIndex] {
+			active = append(active, tr)
+			activeIndices = append(activeIndices, trIndex)
+		}
+	}
+	return active, activeIndices
+}
+
+// Flag the tracer of a failed block request as failed, reset the block
+// scheduler and queue the block rows as well as any blocks queued for the
+// failed tracer to the remaining tracers in proportion to their speed. An
+// error is returned if the primary tracer failed or no tracers remain.
+func (r *defaultRenderer) redistributeBlock(res jobResult, queues [][]tracer.BlockRequest) error {
+	failedTracer := r.tracers[res.trIndex]
+	if res.trIndex == r.primary {
+		return res.err
+	}
+
+	// The scheduler feedback refers to the previous pool of tracers
+	r.failed[res.trIndex] = true
+	r.scheduler.Reset()
+	active, activeIndices := r.activeTracers()
+	if len(active) == 0 {
+		return res.err
+	}
+
+	blocks := append([]tracer.BlockRequest{res.blockReq}, queues[res.trIndex]...)
+	queues[res.trIndex] = nil
+	for _, block := range blocks {
+		r.blockAssignments[res.trIndex] -= block.BlockH
+		r.logger.Warningf("tracer %q failed: %v; redistributing %d rows to %d remaining tracer(s)", failedTracer.Id(), res.err, block.BlockH, len(active))
+
+		blockReq := block
+		for index, blockH := range tracer.SplitRowsBySpeed(active, block.BlockH) {
+			if blockH == 0 {
+				continue
+			}
+
+			trIndex := activeIndices[index]
+			blockReq.BlockH = blockH
+			queues[trIndex] = append(queues[trIndex], blockReq)
+			r.blockAssignments[trIndex] += blockH
+
+			blockReq.BlockY += blockH
+		}
+	}
+
+	return nil
+}
+
+// Run post-process filters on the primary tracer and collect tracer stats.
+func (r *defaultRenderer) syncFrame(req *tracer.BlockRequest) {
+	blockReq := *req
 	blockReq.BlockY = 0
 	blockReq.BlockH = blockReq.FrameH
 	r.tracers[r.primary].SyncFramebuffer(&blockReq)
-
-	r.stats.RenderTime = time.Since(start)
+	r.lastSync = blockReq
 
 	// Collect stats
 	for trIndex, tr := range r.tracers {
 		r.stats.Tracers[trIndex].RenderTime = tr.Stats().RenderTime
 	}
+}
+
+// Change the dimensions of the frames rendered by the tracers. Resizing the
+// tracer buffers discards their accumulated samples so callers should also
+// reset their sample counters.
+func (r *defaultRenderer) resizeFrame(frameW, frameH uint32) error {
+	if frameW == r.frameW && frameH == r.frameH {
+		return nil
+	}
+
+	for _, tr := range r.tracers {
+		_, err := tr.UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{frameW, frameH})
+		if err != nil {
+			return err
+		}
+	}
 
+	r.frameW, r.frameH = frameW, frameH
 	return nil
 }
 
@@ -185,42 +587,48 @@ func (r *defaultRenderer) jobWorker(trIndex int) {
 				return
 			}
 
-			_, err := r.tracers[trIndex].Trace(&blockReq)
-			if err == nil {
+			res := jobResult{trIndex: trIndex}
+			_, res.err = r.tracers[trIndex].Trace(&blockReq)
+			if res.err == nil && r.hostMerge {
+				// Read back the block samples so they can be reduced
+				// once all blocks for this pass are complete
+				res.partial = make([]types.Vec3, int(blockReq.FrameW*blockReq.FrameH))
+				res.err = r.tracers[trIndex].(tracer.HostMerger).ReadTraceAccumulator(&blockReq, res.partial)
+				if res.err == nil {
+					res.err = r.tracers[r.primary].(tracer.HostMerger).MergeAuxOutput(r.tracers[trIndex], &blockReq)
+				}
+			} else if res.err == nil {
 				// Merge trace accumulator output for this pass with primary tracer's frame accumulator
-				_, err = r.tracers[r.primary].MergeOutput(r.tracers[trIndex], &blockReq)
+				_, res.err = r.tracers[r.primary].MergeOutput(r.tracers[trIndex], &blockReq)
 			}
-			r.jobCompleteChan <- err
+			res.blockReq = blockReq
+			r.jobCompleteChan <- res
 		}
 	}
 }
 
-// Select and initialize opencl devices excluding the ones which match the blacklist entries.
+// Select and initialize opencl devices. If a device spec is specified, only the
+// matching device is used; otherwise all devices excluding the ones which match
+// the blacklist entries are used.
 func (r *defaultRenderer) initTracers(pipeline *opencl.Pipeline) error {
 	if len(r.options.BlackListedDevices) != 0 {
 		r.logger.Infof("blacklisted devices: %s", strings.Join(r.options.BlackListedDevices, ", "))
 	}
 
-	platforms, err := device.GetPlatformInfo()
-	if err != nil {
-		return err
-	}
-
-	selectedDevices := make([]*device.Device, 0)
-	for _, platformInfo := range platforms {
-		for _, device := range platformInfo.Devices {
-			keep := true
-			for _, text := range r.options.BlackListedDevices {
-				if text != "" && strings.Contains(device.Name, text) {
-					keep = false
-					break
-				}
-			}
-
-			if keep {
-				selectedDevices = append(selectedDevices, device)
-			}
+	var selectedDevices []*device.Device
+	if r.options.Device != "" {
+		dev, err := device.SelectDevice(r.options.Device)
+		if err != nil {
+			return err
+		}
+		selectedDevices = []*device.Device{dev}
+	} else {
+		platforms, err := device.GetPlatformInfo()
+		if err != nil {
+			return err
 		}
+
+		selectedDevices = filterBlacklistedDevices(platforms, r.options.BlackListedDevices)
 	}
 
 	// Create shared context for seleected devices
@@ -290,3 +698,26 @@ func (r *defaultRenderer) initTracers(pipeline *opencl.Pipeline) error {
 
 	return nil
 }
+
+// Select the devices from the supplied platforms whose names do not contain
+// any of the blacklist entries.
+func filterBlacklistedDevices(platforms []device.PlatformInfo, blackList []string) []*device.Device {
+	selectedDevices := make([]*device.Device, 0)
+	for _, platformInfo := range platforms {
+		for _, device := range platformInfo.Devices {
+			keep := true
+			for _, text := range blackList {
+				if text != "" && strings.Contains(device.Name, text) {
+					keep = false
+					break
+				}
+			}
+
+			if keep {
+				selectedDevices = append(selectedDevices, device)
+			}
+		}
+	}
+
+	return selectedDevices
+}
@@ -0,0 +1,608 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/log"
+	"github.com/achilleasa/polaris/tracer"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestRenderWithTimeBudget(t *testing.T) {
+	tr := &mockTracer{traceDelay: 5 * time.Millisecond}
+	r := newMockRenderer(tr, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 10000,
+		TimeBudget:      20 * time.Millisecond,
+	})
+	defer r.Close()
+
+	err := r.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := r.Stats()
+	if stats.Samples == 0 || stats.Samples >= 10000 {
+		t.Fatalf("expected renderer to stop early once the time budget was exceeded; got %d samples", stats.Samples)
+	}
+	if stats.Samples != tr.traceCount {
+		t.Fatalf("expected reported sample count %d to match the number of traced passes %d", stats.Samples, tr.traceCount)
+	}
+
+	// The framebuffer should be synced once using the final sample count
+	if tr.syncCount != 1 {
+		t.Fatalf("expected framebuffer to be synced once; got %d", tr.syncCount)
+	}
+	if total := tr.lastSync.AccumulatedSamples + tr.lastSync.SamplesPerPixel; total != stats.Samples {
+		t.Fatalf("expected framebuffer sync to use %d samples; got %d", stats.Samples, total)
+	}
+}
+
+func TestRenderWithTimeBudgetCappedBySampleCount(t *testing.T) {
+	tr := &mockTracer{}
+	r := newMockRenderer(tr, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 4,
+		TimeBudget:      time.Hour,
+	})
+	defer r.Close()
+
+	err := r.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if samples := r.Stats().Samples; samples != 4 {
+		t.Fatalf("expected renderer to stop after 4 samples; got %d", samples)
+	}
+}
+
+func TestRenderCropWindow(t *testing.T) {
+	tr := &mockTracer{}
+	crop := tracer.CropWindow{X: 4, Y: 6, W: 8, H: 5}
+	r := newMockRenderer(tr, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 1,
+		Crop:            crop,
+	})
+	defer r.Close()
+
+	err := r.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tracer should only trace the crop window rows while the frame
+	// dimensions match the full frame.
+	blockReq := tr.lastTrace
+	if blockReq.FrameW != 16 || blockReq.FrameH != 16 {
+		t.Fatalf("expected traced block to use the full 16x16 frame dimensions; got %dx%d", blockReq.FrameW, blockReq.FrameH)
+	}
+	if blockReq.BlockY != crop.Y || blockReq.BlockH != crop.H {
+		t.Fatalf("expected traced block to cover rows [%d, %d); got [%d, %d)", crop.Y, crop.Y+crop.H, blockReq.BlockY, blockReq.BlockY+blockReq.BlockH)
+	}
+	if blockReq.Crop != crop {
+		t.Fatalf("expected traced block crop window to be %v; got %v", crop, blockReq.Crop)
+	}
+
+	// Crop windows outside the frame bounds should be rejected
+	_, err = NewDefault(&scene.Scene{Camera: scene.NewCamera(45)}, tracer.NaiveScheduler(), nil, Options{
+		FrameW: 16,
+		FrameH: 16,
+		Crop:   tracer.CropWindow{X: 12, Y: 0, W: 8, H: 8},
+	})
+	if err == nil {
+		t.Fatal("expected an error for a crop window that exceeds the frame bounds")
+	}
+}
+
+func TestRenderIntoBuffer(t *testing.T) {
+	tr := &mockTracer{}
+	r := newMockRenderer(tr, Options{
+		FrameW:          4,
+		FrameH:          2,
+		SamplesPerPixel: 2,
+	})
+	defer r.Close()
+
+	buf := make([]float32, 4*4*2)
+	for frame := 0; frame < 3; frame++ {
+		out, err := r.RenderInto(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(out) != len(buf) || &out[0] != &buf[0] {
+			t.Fatalf("[frame %d] expected renderer to return the supplied buffer", frame)
+		}
+		if out[len(out)-1] != 2 {
+			t.Fatalf("[frame %d] expected buffer to contain the rendered frame", frame)
+		}
+	}
+
+	// Buffers with the wrong size should be rejected
+	if _, err := r.RenderInto(make([]float32, 4*4)); err == nil {
+		t.Fatal("expected an error for a buffer that does not match the frame dimensions")
+	}
+}
+
+func TestRenderWithAccumulation(t *testing.T) {
+	tr := &mockTracer{}
+	r := newMockRenderer(tr, Options{
+		FrameW:          4,
+		FrameH:          2,
+		SamplesPerPixel: 2,
+		Accumulate:      true,
+	})
+	defer r.Close()
+
+	buf := make([]float32, 4*4*2)
+	for frame := uint32(1); frame <= 3; frame++ {
+		out, err := r.RenderInto(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expSamples := frame * 2
+		if samples := r.AccumBuffer().Samples(); samples != expSamples {
+			t.Fatalf("[frame %d] expected accumulation buffer to contain %d samples; got %d", frame, expSamples, samples)
+		}
+		if samples := r.Stats().AccumulatedSamples; samples != expSamples {
+			t.Fatalf("[frame %d] expected stats to report %d accumulated samples; got %d", frame, expSamples, samples)
+		}
+		if out[len(out)-1] != 2 {
+			t.Fatalf("[frame %d] expected buffer to contain the accumulated frame; got %f", frame, out[len(out)-1])
+		}
+	}
+
+	r.ResetAccumulation()
+	if samples := r.Stats().AccumulatedSamples; samples != 0 {
+		t.Fatalf("expected stats to report 0 accumulated samples after a reset; got %d", samples)
+	}
+	if err := r.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if samples := r.AccumBuffer().Samples(); samples != 2 {
+		t.Fatalf("expected accumulation buffer to contain 2 samples after a reset; got %d", samples)
+	}
+
+	// Accumulation is disabled by default
+	r2 := newMockRenderer(&mockTracer{}, Options{FrameW: 4, FrameH: 2, SamplesPerPixel: 1})
+	defer r2.Close()
+	if err := r2.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if r2.AccumBuffer() != nil || r2.Stats().AccumulatedSamples != 0 {
+		t.Fatal("expected accumulation to be disabled")
+	}
+}
+
+func TestRenderPassAccumulation(t *testing.T) {
+	tr := &mockTracer{}
+	r := newMockRenderer(tr, Options{
+		FrameW:     4,
+		FrameH:     2,
+		Accumulate: true,
+	})
+	defer r.Close()
+
+	// Scaled-down preview passes should not be accumulated
+	if err := r.resizeFrame(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.renderPass(0); err != nil {
+		t.Fatal(err)
+	}
+	if samples := r.AccumBuffer().Samples(); samples != 0 {
+		t.Fatalf("expected preview pass to not be accumulated; got %d samples", samples)
+	}
+	if err := r.resizeFrame(4, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// The mock tracer averages each pixel to the number of samples traced
+	// for the view so the accumulated output should track the tracer
+	// output as the view is progressively refined.
+	for accumulatedSamples := uint32(0); accumulatedSamples < 4; accumulatedSamples++ {
+		if err := r.renderPass(accumulatedSamples); err != nil {
+			t.Fatal(err)
+		}
+
+		expSamples := accumulatedSamples + 1
+		if samples := r.AccumBuffer().Samples(); samples != expSamples {
+			t.Fatalf("[pass %d] expected accumulation buffer to contain %d samples; got %d", accumulatedSamples, expSamples, samples)
+		}
+		if samples := r.Stats().AccumulatedSamples; samples != expSamples {
+			t.Fatalf("[pass %d] expected stats to report %d accumulated samples; got %d", accumulatedSamples, expSamples, samples)
+		}
+		for index, pixel := range r.AccumBuffer().Resolve() {
+			if diff := pixel[0] - float32(expSamples); diff < -1e-4 || diff > 1e-4 {
+				t.Fatalf("[pass %d] expected pixel %d to resolve to %d; got %f", accumulatedSamples, index, expSamples, pixel[0])
+			}
+		}
+	}
+
+	// Moving the camera restarts the accumulation
+	r.ResetAccumulation()
+	if err := r.renderPass(0); err != nil {
+		t.Fatal(err)
+	}
+	if samples := r.AccumBuffer().Samples(); samples != 1 {
+		t.Fatalf("expected accumulation buffer to contain 1 sample after a reset; got %d", samples)
+	}
+}
+
+func TestAccumulationRejectsStaticSeedPolicy(t *testing.T) {
+	sc := &scene.Scene{Camera: scene.NewCamera(45)}
+	_, err := NewDefault(sc, tracer.NaiveScheduler(), nil, Options{
+		FrameW:     4,
+		FrameH:     2,
+		Accumulate: true,
+		SeedPolicy: tracer.StaticSeed,
+	})
+	if err != ErrStaticSeedAccumulation {
+		t.Fatalf("expected error %v; got %v", ErrStaticSeedAccumulation, err)
+	}
+}
+
+func TestRenderWithStaticSeedPolicy(t *testing.T) {
+	render := func(frameIndex uint32) tracer.BlockRequest {
+		tr := &mockTracer{}
+		r := newMockRenderer(tr, Options{
+			FrameW:          4,
+			FrameH:          4,
+			SamplesPerPixel: 1,
+			SeedPolicy:      tracer.StaticSeed,
+			FrameIndex:      frameIndex,
+		})
+		defer r.Close()
+
+		err := r.Render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr.lastTrace
+	}
+
+	// Rendering the same frame index twice should produce identical noise
+	first, second := render(5), render(5)
+	if first.Seed != second.Seed {
+		t.Fatalf("expected renders of the same frame index to use the same seed; got %d and %d", first.Seed, second.Seed)
+	}
+	if first.Rand().Uint32() != second.Rand().Uint32() {
+		t.Fatal("expected renders of the same frame index to generate the same random sequence")
+	}
+
+	if other := render(6); other.Seed == first.Seed {
+		t.Fatal("expected renders of different frame indices to use different seeds")
+	}
+}
+
+func TestRenderRedistributesRowsOfFailedTracer(t *testing.T) {
+	primary := &mockTracer{id: "primary", speed: 1}
+	failing := &mockTracer{id: "failing", speed: 2, traceErr: errors.New("device lost")}
+	other := &mockTracer{id: "other", speed: 1}
+	r := newMultiTracerMockRenderer([]*mockTracer{primary, failing, other}, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 1,
+	})
+	defer r.Close()
+
+	err := r.Render()
+	if err != nil {
+		t.Fatalf("expected the failed tracer rows to be redistributed; got error %v", err)
+	}
+
+	// The failed tracer was assigned rows 4-11 which should be split
+	// between the remaining tracers in proportion to their speed
+	expTraced := []struct {
+		tr     *mockTracer
+		blocks [][2]uint32
+	}{
+		{primary, [][2]uint32{{0, 4}, {4, 4}}},
+		{failing, [][2]uint32{{4, 8}}},
+		{other, [][2]uint32{{12, 4}, {8, 4}}},
+	}
+	for _, exp := range expTraced {
+		if len(exp.tr.traced) != len(exp.blocks) {
+			t.Fatalf("expected tracer %q to trace %d blocks; got %d", exp.tr.id, len(exp.blocks), len(exp.tr.traced))
+		}
+		for blockIndex, block := range exp.blocks {
+			if got := [2]uint32{exp.tr.traced[blockIndex].BlockY, exp.tr.traced[blockIndex].BlockH}; got != block {
+				t.Fatalf("expected tracer %q block %d to be (y: %d, h: %d); got (y: %d, h: %d)", exp.tr.id, blockIndex, block[0], block[1], got[0], got[1])
+			}
+		}
+	}
+
+	stats := r.Stats()
+	if stats.Tracers[0].BlockH != 8 || stats.Tracers[1].BlockH != 0 || stats.Tracers[2].BlockH != 8 {
+		t.Fatalf("expected tracer block heights to be 8, 0 and 8; got %d, %d and %d", stats.Tracers[0].BlockH, stats.Tracers[1].BlockH, stats.Tracers[2].BlockH)
+	}
+
+	// The failed tracer should not be scheduled for subsequent frames
+	if err = r.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if len(failing.traced) != 1 {
+		t.Fatalf("expected failed tracer to not be scheduled again; got %d traced blocks", len(failing.traced))
+	}
+	if last := other.traced[len(other.traced)-1]; last.BlockY != 8 || last.BlockH != 8 {
+		t.Fatalf("expected remaining tracer to be assigned rows 8-15; got (y: %d, h: %d)", last.BlockY, last.BlockH)
+	}
+}
+
+func TestRenderResetsSchedulerWhenTracerFails(t *testing.T) {
+	primary := &mockTracer{id: "primary", speed: 1}
+	failing := &mockTracer{id: "failing", speed: 1, traceErr: errors.New("device lost")}
+	other := &mockTracer{id: "other", speed: 2}
+	last := &mockTracer{id: "last", speed: 1}
+	r := newMultiTracerMockRenderer([]*mockTracer{primary, failing, other, last}, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 1,
+	})
+	defer r.Close()
+	sch := &recordingScheduler{BlockScheduler: tracer.NaiveScheduler()}
+	r.scheduler = sch
+
+	for frame := 0; frame < 2; frame++ {
+		if err := r.Render(); err != nil {
+			t.Fatalf("[frame %d] unexpected error %v", frame, err)
+		}
+	}
+
+	if sch.resets != 1 {
+		t.Fatalf("expected scheduler to be reset once after the tracer failure; got %d resets", sch.resets)
+	}
+	expPools := [][]string{
+		{"primary", "failing", "other", "last"},
+		{"primary", "other", "last"},
+	}
+	for frame, expPool := range expPools {
+		if got := sch.pools[frame]; strings.Join(got, ",") != strings.Join(expPool, ",") {
+			t.Fatalf("[frame %d] expected scheduled tracers to be %v; got %v", frame, expPool, got)
+		}
+	}
+
+	// The rows of the second frame should be assigned to the remaining
+	// tracers in proportion to their speed
+	expBlocks := []struct {
+		tr    *mockTracer
+		block [2]uint32
+	}{
+		{primary, [2]uint32{0, 4}},
+		{other, [2]uint32{4, 8}},
+		{last, [2]uint32{12, 4}},
+	}
+	for _, exp := range expBlocks {
+		if got := [2]uint32{exp.tr.lastTrace.BlockY, exp.tr.lastTrace.BlockH}; got != exp.block {
+			t.Fatalf("expected tracer %q to trace block (y: %d, h: %d); got (y: %d, h: %d)", exp.tr.id, exp.block[0], exp.block[1], got[0], got[1])
+		}
+	}
+
+	stats := r.Stats()
+	for trIndex, expBlockH := range []uint32{4, 0, 8, 4} {
+		if stats.Tracers[trIndex].BlockH != expBlockH {
+			t.Fatalf("expected tracer %d block height to be %d; got %d", trIndex, expBlockH, stats.Tracers[trIndex].BlockH)
+		}
+	}
+}
+
+func TestRenderFailsIfPrimaryTracerFails(t *testing.T) {
+	primary := &mockTracer{id: "primary", traceErr: errors.New("device lost")}
+	other := &mockTracer{id: "other"}
+	r := newMultiTracerMockRenderer([]*mockTracer{primary, other}, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 1,
+	})
+	defer r.Close()
+
+	err := r.Render()
+	if err == nil || err.Error() != "device lost" {
+		t.Fatalf("expected primary tracer failure to abort the frame; got %v", err)
+	}
+	if len(other.traced) != 1 {
+		t.Fatalf("expected secondary tracer to finish its pending block; got %d traced blocks", len(other.traced))
+	}
+}
+
+func TestRenderMergesTracerOutputDeterministically(t *testing.T) {
+	render := func(numTracers int) []types.Vec3 {
+		trs := make([]*mockTracer, numTracers)
+		for trIndex := range trs {
+			trs[trIndex] = &mockTracer{id: fmt.Sprintf("tracer-%d", trIndex), speed: uint32(trIndex + 1)}
+		}
+		r := newMultiTracerMockRenderer(trs, Options{
+			FrameW:          16,
+			FrameH:          16,
+			SamplesPerPixel: 8,
+			TimeBudget:      time.Hour,
+			SeedPolicy:      tracer.StaticSeed,
+		})
+		defer r.Close()
+
+		if err := r.Render(); err != nil {
+			t.Fatal(err)
+		}
+		for _, tr := range trs {
+			if len(tr.traced) == 0 {
+				t.Fatalf("[%d tracers] expected tracer %q to trace at least one block", numTracers, tr.id)
+			}
+		}
+		return trs[0].frameAccum
+	}
+
+	exp := render(1)
+	got := render(4)
+	if len(exp) != 16*16 || len(got) != len(exp) {
+		t.Fatalf("expected the primary frame accumulator to contain %d samples; got %d and %d", 16*16, len(exp), len(got))
+	}
+	for pixel := range exp {
+		if exp[pixel][0] == 0 {
+			t.Fatalf("expected pixel %d to receive samples", pixel)
+		}
+		if got[pixel] != exp[pixel] {
+			t.Fatalf("expected pixel %d merged from 4 tracers to match the single tracer output %v; got %v", pixel, exp[pixel], got[pixel])
+		}
+	}
+}
+
+func newMockRenderer(tr *mockTracer, opts Options) *defaultRenderer {
+	return newMultiTracerMockRenderer([]*mockTracer{tr}, opts)
+}
+
+// Create a mock renderer whose first tracer is the primary tracer.
+func newMultiTracerMockRenderer(trs []*mockTracer, opts Options) *defaultRenderer {
+	r := &defaultRenderer{
+		logger:     log.New("renderer"),
+		scheduler:  tracer.NaiveScheduler(),
+		options:    opts,
+		frameW:     opts.FrameW,
+		frameH:     opts.FrameH,
+		frameIndex: opts.FrameIndex,
+	}
+	if opts.Accumulate {
+		r.accum = tracer.NewAccumBuffer(opts.FrameW, opts.FrameH)
+	}
+	for trIndex, tr := range trs {
+		r.tracers = append(r.tracers, tr)
+		r.stats.Tracers = append(r.stats.Tracers, TracerStat{Id: tr.Id(), IsPrimary: trIndex == 0})
+	}
+	r.startWorkers(&scene.Scene{Camera: scene.NewCamera(45)})
+	return r
+}
+
+type mockTracer struct {
+	id         string
+	speed      uint32
+	traceErr   error
+	traced     []tracer.BlockRequest
+	traceDelay time.Duration
+	traceCount uint32
+	lastTrace  tracer.BlockRequest
+	syncCount  int
+	lastSync   tracer.BlockRequest
+	updates    []tracer.ChangeType
+	stats      tracer.Stats
+	frameAccum []types.Vec3
+}
+
+func (mt *mockTracer) Id() string {
+	if mt.id == "" {
+		return "mock"
+	}
+	return mt.id
+}
+
+func (mt *mockTracer) Flags() tracer.Flag {
+	return tracer.Local
+}
+
+func (mt *mockTracer) Speed() uint32 {
+	if mt.speed == 0 {
+		return 1
+	}
+	return mt.speed
+}
+
+func (mt *mockTracer) Init() error {
+	return nil
+}
+
+func (mt *mockTracer) Close() {
+}
+
+func (mt *mockTracer) Stats() *tracer.Stats {
+	return &mt.stats
+}
+
+func (mt *mockTracer) UpdateState(_ tracer.UpdateMode, change tracer.ChangeType, _ interface{}) (time.Duration, error) {
+	mt.updates = append(mt.updates, change)
+	return 0, nil
+}
+
+func (mt *mockTracer) Trace(blockReq *tracer.BlockRequest) (time.Duration, error) {
+	time.Sleep(mt.traceDelay)
+	mt.traced = append(mt.traced, *blockReq)
+	if mt.traceErr != nil {
+		return 0, mt.traceErr
+	}
+	mt.traceCount += blockReq.SamplesPerPixel
+	mt.lastTrace = *blockReq
+	return mt.traceDelay, nil
+}
+
+func (mt *mockTracer) MergeOutput(_ tracer.Tracer, _ *tracer.BlockRequest) (time.Duration, error) {
+	return 0, nil
+}
+
+// Fill the block rows with values that depend on the pixel index and the
+// pass seed so that the merged output does not depend on the tracer that
+// processed each block.
+func (mt *mockTracer) ReadTraceAccumulator(blockReq *tracer.BlockRequest, dst []types.Vec3) error {
+	for pixel := blockReq.FrameW * blockReq.BlockY; pixel < blockReq.FrameW*(blockReq.BlockY+blockReq.BlockH); pixel++ {
+		v := float32(1.0 / float64(3+pixel+blockReq.Seed%7))
+		dst[pixel] = types.Vec3{v, v / 3, v / 7}
+	}
+	return nil
+}
+
+func (mt *mockTracer) AccumulateFrame(blockReq *tracer.BlockRequest, src []types.Vec3) error {
+	if len(mt.frameAccum) != len(src) {
+		mt.frameAccum = make([]types.Vec3, len(src))
+	}
+	for pixel := blockReq.FrameW * blockReq.BlockY; pixel < blockReq.FrameW*(blockReq.BlockY+blockReq.BlockH); pixel++ {
+		mt.frameAccum[pixel] = mt.frameAccum[pixel].Add(src[pixel])
+	}
+	return nil
+}
+
+func (mt *mockTracer) MergeAuxOutput(_ tracer.Tracer, _ *tracer.BlockRequest) error {
+	return nil
+}
+
+func (mt *mockTracer) SyncFramebuffer(blockReq *tracer.BlockRequest) (time.Duration, error) {
+	mt.syncCount++
+	mt.lastSync = *blockReq
+	return 0, nil
+}
+
+func (mt *mockTracer) ReadFrame(blockReq *tracer.BlockRequest, dst []float32) ([]float32, error) {
+	for index := range dst {
+		dst[index] = float32(blockReq.AccumulatedSamples + blockReq.SamplesPerPixel)
+	}
+	return dst, nil
+}
+
+// A block scheduler that records the pool of tracers passed to each Schedule
+// call and the number of Reset calls.
+type recordingScheduler struct {
+	tracer.BlockScheduler
+	pools  [][]string
+	resets int
+}
+
+func (sch *recordingScheduler) Schedule(tracers []tracer.Tracer, frameH uint32) []uint32 {
+	var pool []string
+	for _, tr := range tracers {
+		pool = append(pool, tr.Id())
+	}
+	sch.pools = append(sch.pools, pool)
+	return sch.BlockScheduler.Schedule(tracers, frameH)
+}
+
+func (sch *recordingScheduler) Reset() {
+	sch.resets++
+	sch.BlockScheduler.Reset()
+}
@@ -7,4 +7,6 @@ var (
 	ErrSceneNotDefined  = errors.New("renderer: no scene defined")
 	ErrCameraNotDefined = errors.New("renderer: no camera defined")
 	ErrInterrupted      = errors.New("renderer: interrupted while rendering")
+
+	ErrStaticSeedAccumulation = errors.New("renderer: progressive accumulation requires the animated seed policy")
 )
@@ -36,6 +36,9 @@ type interactiveGLRenderer struct {
 
 	accumulatedSamples uint32
 
+	// Coarse-to-fine preview state
+	preview *previewState
+
 	// opengl handles
 	window *glfw.Window
 	texFbo uint32
@@ -66,6 +69,7 @@ func NewInteractive(sc *scene.Scene, scheduler tracer.BlockScheduler, pipeline *
 	r := &interactiveGLRenderer{
 		defaultRenderer: base.(*defaultRenderer),
 		camera:          sc.Camera,
+		preview:         newPreviewState(opts.PreviewSchedule),
 	}
 
 	err = r.initGL(opts)
@@ -140,9 +144,14 @@ func (r *interactiveGLRenderer) Render() error {
 		// Render next frame
 		r.Lock()
 
-		// Render frame unless we have reached our target SPP
-		if r.options.SamplesPerPixel == 0 || (r.options.SamplesPerPixel != 0 && r.accumulatedSamples < r.defaultRenderer.options.SamplesPerPixel) {
-			err := r.renderFrame(r.accumulatedSamples)
+		// Render frame unless we have reached our target SPP. While
+		// rendering coarse preview levels we always keep rendering.
+		if !r.preview.Final() || r.options.SamplesPerPixel == 0 || (r.options.SamplesPerPixel != 0 && r.accumulatedSamples < r.defaultRenderer.options.SamplesPerPixel) {
+			frameW, frameH := previewFrameDims(r.options.FrameW, r.options.FrameH, r.preview.Scale())
+			err := r.resizeFrame(frameW, frameH)
+			if err == nil {
+				err = r.renderPass(r.accumulatedSamples)
+			}
 			if r.options.SamplesPerPixel == 0 {
 				r.accumulatedSamples++
 			} else {
@@ -152,11 +161,21 @@ func (r *interactiveGLRenderer) Render() error {
 				r.Unlock()
 				return err
 			}
+
+			// Restart accumulation when switching to a finer level
+			if r.preview.Advance() {
+				r.accumulatedSamples = 0
+			}
+
+			// Display the number of progressively accumulated samples
+			if r.accum != nil {
+				r.window.SetTitle(fmt.Sprintf("polaris (%d spp)", r.stats.AccumulatedSamples))
+			}
 		}
 
-		// Copy texture data to framebuffer
+		// Copy texture data to framebuffer upscaling coarse preview frames
 		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.texFbo)
-		gl.BlitFramebuffer(0, 0, int32(r.options.FrameW), int32(r.options.FrameH), 0, 0, int32(r.options.FrameW), int32(r.options.FrameH), gl.COLOR_BUFFER_BIT, gl.LINEAR)
+		gl.BlitFramebuffer(0, 0, int32(r.frameW), int32(r.frameH), 0, 0, int32(r.options.FrameW), int32(r.options.FrameH), gl.COLOR_BUFFER_BIT, gl.LINEAR)
 		gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
 
 		// Display tracer stats
@@ -195,6 +214,8 @@ func (r *interactiveGLRenderer) renderUI() {
 	var frameW int32 = int32(r.options.FrameW) - 1
 	gl.LineWidth(2.0)
 	for seriesIndex, blockH := range r.blockAssignments {
+		// Map preview block rows to output frame rows
+		blockH = blockH * r.options.FrameH / r.frameH
 		gl.Color3fv(&r.blockAssignmentSeries.colors[seriesIndex][0])
 		gl.Begin(gl.LINE_LOOP)
 		gl.Vertex2i(0, y)
@@ -300,6 +321,8 @@ func (r *interactiveGLRenderer) updateCamera() {
 	}
 
 	r.accumulatedSamples = 0
+	r.preview.Reset()
+	r.ResetAccumulation()
 }
 
 type stackedSeries struct {
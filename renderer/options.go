@@ -1,5 +1,11 @@
 package renderer
 
+import (
+	"time"
+
+	"github.com/achilleasa/polaris/tracer"
+)
+
 type Options struct {
 	// Frame dims.
 	FrameW uint32
@@ -11,13 +17,53 @@ type Options struct {
 	// Min bounces before applying russian roulette for path elimination.
 	MinBouncesForRR uint32
 
+	// Min bounces before performing next-event estimation (0 enables it
+	// for all bounces).
+	MinBouncesForNEE uint32
+
+	// Max path throughput indexed by bounce depth (0 disables clamping).
+	ThroughputClamp []float32
+
 	// Number of samples.
 	SamplesPerPixel uint32
 
+	// Wall-clock time budget for rendering a frame (0 disables the budget).
+	// When set, the renderer keeps accumulating samples until the budget is
+	// exceeded. A non-zero SamplesPerPixel value caps the number of samples.
+	TimeBudget time.Duration
+
+	// If set, the output of each frame rendered via Render is added to a
+	// progressive accumulation buffer so that repeated renders of a static
+	// view converge. Callers must reset the accumulation buffer whenever
+	// the view changes. Render sessions ignore this option as they already
+	// accumulate samples on the device. Accumulation cannot be combined
+	// with the static seed policy.
+	Accumulate bool
+
+	// The policy for selecting the random seeds used for tracing each
+	// frame and the index of the first rendered frame. The frame index is
+	// incremented after each rendered frame.
+	SeedPolicy tracer.SeedPolicy
+	FrameIndex uint32
+
 	// Exposure for tonemapping.
 	Exposure float32
 
-	// Device selection.
+	// An optional crop window in frame pixel coordinates. If set, only the
+	// window pixels are traced; the remaining frame pixels are left black.
+	// The crop window is ignored while rendering scaled-down previews.
+	Crop tracer.CropWindow
+
+	// Coarse-to-fine resolution schedule for interactive previews. The
+	// renderer starts at the first level and switches to full resolution
+	// once all levels have been rendered. The schedule is restarted
+	// whenever the camera moves.
+	PreviewSchedule []PreviewLevel
+
+	// Device selection. If Device is specified, it is passed to
+	// device.SelectDevice and only the selected device is used for
+	// rendering; the blacklist is ignored in this case.
 	BlackListedDevices []string
 	ForcePrimaryDevice string
+	Device             string
 }
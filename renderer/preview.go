@@ -0,0 +1,86 @@
+package renderer
+
+// A resolution level for progressive preview rendering.
+type PreviewLevel struct {
+	// The frame dimensions are divided by this value when rendering at
+	// this level. A value of 1 renders at full resolution.
+	Scale uint32
+
+	// The number of frames to render at this level before switching to
+	// the next level.
+	Frames uint32
+}
+
+// Tracks the active level of a coarse-to-fine preview schedule. Once all
+// schedule levels have been rendered, the preview switches to full
+// resolution.
+type previewState struct {
+	schedule []PreviewLevel
+
+	level       int
+	levelFrames uint32
+}
+
+// Create a new preview state for the given schedule. Levels with a zero
+// scale or frame count are ignored.
+func newPreviewState(schedule []PreviewLevel) *previewState {
+	ps := &previewState{
+		schedule: make([]PreviewLevel, 0, len(schedule)),
+	}
+
+	for _, level := range schedule {
+		if level.Scale == 0 || level.Frames == 0 {
+			continue
+		}
+		ps.schedule = append(ps.schedule, level)
+	}
+
+	return ps
+}
+
+// Restart the preview from the coarsest level.
+func (ps *previewState) Reset() {
+	ps.level = 0
+	ps.levelFrames = 0
+}
+
+// Get the frame dimension divisor for the active level.
+func (ps *previewState) Scale() uint32 {
+	if ps.Final() {
+		return 1
+	}
+	return ps.schedule[ps.level].Scale
+}
+
+// Returns true if the preview has reached full resolution.
+func (ps *previewState) Final() bool {
+	return ps.level >= len(ps.schedule)
+}
+
+// Register a rendered frame and advance to the next level if required.
+// This method returns true if the frame scale changed in which case the
+// renderer needs to restart sample accumulation.
+func (ps *previewState) Advance() bool {
+	if ps.Final() {
+		return false
+	}
+
+	ps.levelFrames++
+	if ps.levelFrames < ps.schedule[ps.level].Frames {
+		return false
+	}
+
+	prevScale := ps.Scale()
+	ps.level++
+	ps.levelFrames = 0
+	return ps.Scale() != prevScale
+}
+
+// Get the frame dimensions for the given scale. Dimensions are rounded up
+// so that the scaled frame always covers the full frame.
+func previewFrameDims(frameW, frameH, scale uint32) (uint32, uint32) {
+	if scale <= 1 {
+		return frameW, frameH
+	}
+	return (frameW + scale - 1) / scale, (frameH + scale - 1) / scale
+}
@@ -0,0 +1,78 @@
+package renderer
+
+import "testing"
+
+func TestPreviewSchedule(t *testing.T) {
+	var frameW, frameH uint32 = 1024, 768
+	ps := newPreviewState([]PreviewLevel{
+		{Scale: 4, Frames: 1},
+		{Scale: 2, Frames: 2},
+	})
+
+	expScales := []uint32{4, 2, 2, 1, 1}
+	expLevelChange := []bool{true, false, true, false, false}
+	var firstPixels, lastPixels uint32
+	for frame, expScale := range expScales {
+		scale := ps.Scale()
+		if scale != expScale {
+			t.Fatalf("[frame %d] expected scale to be %d; got %d", frame, expScale, scale)
+		}
+
+		w, h := previewFrameDims(frameW, frameH, scale)
+		if frame == 0 {
+			firstPixels = w * h
+		}
+		lastPixels = w * h
+
+		if changed := ps.Advance(); changed != expLevelChange[frame] {
+			t.Fatalf("[frame %d] expected level change to be %t; got %t", frame, expLevelChange[frame], changed)
+		}
+	}
+
+	if firstPixels >= lastPixels {
+		t.Fatalf("expected first pass to render fewer pixels than the final pass; got %d vs %d", firstPixels, lastPixels)
+	}
+
+	// The final level should match the full-res render
+	if !ps.Final() {
+		t.Fatal("expected preview to reach full resolution")
+	}
+	w, h := previewFrameDims(frameW, frameH, ps.Scale())
+	if w != frameW || h != frameH {
+		t.Fatalf("expected final frame dims to be %dx%d; got %dx%d", frameW, frameH, w, h)
+	}
+
+	ps.Reset()
+	if ps.Scale() != 4 {
+		t.Fatalf("expected scale to be 4 after reset; got %d", ps.Scale())
+	}
+}
+
+func TestPreviewFrameDims(t *testing.T) {
+	specs := []struct {
+		scale      uint32
+		expW, expH uint32
+	}{
+		{0, 101, 50},
+		{1, 101, 50},
+		{2, 51, 25},
+		{4, 26, 13},
+	}
+
+	for index, spec := range specs {
+		w, h := previewFrameDims(101, 50, spec.scale)
+		if w != spec.expW || h != spec.expH {
+			t.Fatalf("[spec %d] expected dims to be %dx%d; got %dx%d", index, spec.expW, spec.expH, w, h)
+		}
+	}
+}
+
+func TestEmptyPreviewSchedule(t *testing.T) {
+	ps := newPreviewState([]PreviewLevel{{Scale: 0, Frames: 4}, {Scale: 2, Frames: 0}})
+	if !ps.Final() || ps.Scale() != 1 {
+		t.Fatalf("expected invalid levels to be ignored; got scale %d", ps.Scale())
+	}
+	if ps.Advance() {
+		t.Fatal("expected Advance to return false for an empty schedule")
+	}
+}
@@ -1,5 +1,7 @@
 package renderer
 
+import "github.com/achilleasa/polaris/tracer"
+
 type Renderer interface {
 	// Render frame.
 	Render() error
@@ -10,3 +12,27 @@ type Renderer interface {
 	// Get render statistics.
 	Stats() FrameStats
 }
+
+// A BufferRenderer can render frames into a caller-owned buffer. Reusing the
+// same buffer across frames avoids per-frame allocations in realtime loops.
+type BufferRenderer interface {
+	Renderer
+
+	// Render the next frame and copy its linear RGBA output, averaged
+	// over the accumulated samples, into the supplied buffer which must
+	// contain 4 values for each frame pixel. Returns the supplied buffer.
+	RenderInto([]float32) ([]float32, error)
+}
+
+// A ProgressiveRenderer adds the output of each rendered frame to an
+// accumulation buffer so that repeated renders of the same view converge.
+type ProgressiveRenderer interface {
+	Renderer
+
+	// Get the accumulation buffer or nil if accumulation is disabled.
+	AccumBuffer() *tracer.AccumBuffer
+
+	// Discard the accumulated samples. This must be called whenever the
+	// view changes (e.g. the camera moves).
+	ResetAccumulation()
+}
@@ -0,0 +1,196 @@
+package renderer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/tracer"
+	"github.com/achilleasa/polaris/tracer/opencl"
+	"github.com/achilleasa/polaris/types"
+)
+
+// A change to the compiled scene that is queued by a render session and
+// applied between sample passes.
+type SceneEdit interface {
+	// Apply the edit to the compiled scene and return the type of tracer
+	// state that needs to be updated.
+	Apply(*scene.Scene) (tracer.ChangeType, error)
+}
+
+// Move a mesh instance by replacing its local to world transformation matrix.
+type MoveInstance struct {
+	Instance  uint32
+	Transform types.Mat4
+}
+
+// Apply the edit to the compiled scene.
+func (e MoveInstance) Apply(sc *scene.Scene) (tracer.ChangeType, error) {
+	return tracer.SceneData, compiler.UpdateMeshInstanceTransform(sc, e.Instance, e.Transform)
+}
+
+// Replace a node of the compiled scene material node list.
+type ReplaceMaterialNode struct {
+	Node     uint32
+	Material scene.MaterialNode
+}
+
+// Apply the edit to the compiled scene.
+func (e ReplaceMaterialNode) Apply(sc *scene.Scene) (tracer.ChangeType, error) {
+	return tracer.SceneData, compiler.UpdateMaterialNode(sc, e.Node, e.Material)
+}
+
+// A render session progressively accumulates samples for a scene that can
+// be edited while rendering. Edits are queued and applied before the next
+// sample pass; the tracers then receive the updated scene state and sample
+// accumulation restarts.
+//
+// Tracers accumulate samples using a single sample count for the entire
+// frame, so applying an edit discards the samples of all frame pixels and
+// not only the ones covered by the edited scene objects.
+type Session struct {
+	*defaultRenderer
+
+	scene *scene.Scene
+
+	accumulatedSamples uint32
+
+	// mutex for synchronizing the edit queue and the pause state
+	mutex  sync.Mutex
+	paused bool
+	edits  []SceneEdit
+}
+
+// Create a new render session using the specified block scheduler and tracing pipeline.
+func NewSession(sc *scene.Scene, scheduler tracer.BlockScheduler, pipeline *opencl.Pipeline, opts Options) (*Session, error) {
+	base, err := NewDefault(sc, scheduler, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		defaultRenderer: base.(*defaultRenderer),
+		scene:           sc,
+	}, nil
+}
+
+// Pause the session. Calls to Render do not trace any samples until the
+// session is resumed. A sample pass that is already in progress is not
+// interrupted.
+func (s *Session) Pause() {
+	s.mutex.Lock()
+	s.paused = true
+	s.mutex.Unlock()
+}
+
+// Resume a paused session.
+func (s *Session) Resume() {
+	s.mutex.Lock()
+	s.paused = false
+	s.mutex.Unlock()
+}
+
+// Returns true if the session is paused.
+func (s *Session) Paused() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.paused
+}
+
+// Queue scene edits. The edits are applied in order before the next
+// rendered sample pass.
+func (s *Session) QueueEdit(edits ...SceneEdit) {
+	s.mutex.Lock()
+	s.edits = append(s.edits, edits...)
+	s.mutex.Unlock()
+}
+
+// Get the number of samples per pixel accumulated since the last edit.
+func (s *Session) AccumulatedSamples() uint32 {
+	return s.accumulatedSamples
+}
+
+// Apply any queued edits and render the next sample pass. If the session is
+// paused or the target sample count has been reached, this method returns
+// without tracing any samples.
+func (s *Session) Render() error {
+	if s.Paused() {
+		return nil
+	}
+
+	err := s.applyEdits()
+	if err != nil {
+		return err
+	}
+
+	if s.options.SamplesPerPixel != 0 && s.accumulatedSamples >= s.options.SamplesPerPixel {
+		return nil
+	}
+
+	err = s.renderFrame(s.accumulatedSamples)
+	if err != nil {
+		return err
+	}
+
+	if s.options.SamplesPerPixel == 0 {
+		s.accumulatedSamples++
+	} else {
+		s.accumulatedSamples += s.options.SamplesPerPixel
+	}
+	return nil
+}
+
+// Apply the queued edits, update the tracer state and restart sample
+// accumulation. If an edit fails, the edits that follow it remain queued.
+func (s *Session) applyEdits() error {
+	s.mutex.Lock()
+	edits := s.edits
+	s.edits = nil
+	s.mutex.Unlock()
+
+	if len(edits) == 0 {
+		return nil
+	}
+
+	var editErr error
+	changed := make(map[tracer.ChangeType]bool)
+	for editIndex, edit := range edits {
+		change, err := edit.Apply(s.scene)
+		if err != nil {
+			editErr = fmt.Errorf("renderer: could not apply scene edit: %v", err)
+
+			s.mutex.Lock()
+			s.edits = append(edits[editIndex+1:], s.edits...)
+			s.mutex.Unlock()
+			break
+		}
+		changed[change] = true
+	}
+
+	for _, change := range []tracer.ChangeType{tracer.SceneData, tracer.CameraData} {
+		if !changed[change] {
+			continue
+		}
+
+		var data interface{} = s.scene
+		if change == tracer.CameraData {
+			data = s.scene.Camera
+		}
+		for _, tr := range s.tracers {
+			_, err := tr.UpdateState(tracer.Synchronous, change, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Restart accumulation using a new frame index so that the samples
+	// traced after the edit use a different random sequence.
+	if len(changed) != 0 {
+		s.accumulatedSamples = 0
+		s.frameIndex++
+	}
+
+	return editErr
+}
@@ -0,0 +1,141 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/tracer"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestSessionPauseEditAndResume(t *testing.T) {
+	tr := &mockTracer{}
+	s := newMockSession(t, tr, Options{
+		FrameW: 16,
+		FrameH: 16,
+	})
+	defer s.Close()
+
+	for pass := 0; pass < 3; pass++ {
+		if err := s.Render(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tr.lastTrace.AccumulatedSamples != 2 || s.Stats().Samples != 3 {
+		t.Fatalf("expected 3 accumulated progressive samples; got %d", s.Stats().Samples)
+	}
+	seed := tr.lastTrace.Seed
+
+	// Paused sessions should not trace any samples or apply queued edits
+	s.Pause()
+	moveTo := types.Translate4(types.Vec3{5, 0, 0})
+	s.QueueEdit(MoveInstance{Instance: 0, Transform: moveTo})
+	if err := s.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.traceCount != 3 {
+		t.Fatalf("expected paused session to not trace any samples; got %d traced samples", tr.traceCount)
+	}
+	if s.scene.MeshInstanceList[0].Transform == moveTo.Inv() {
+		t.Fatal("expected queued edit to not be applied while the session is paused")
+	}
+
+	// Resuming should apply the edit, upload the scene and restart accumulation
+	updates := len(tr.updates)
+	s.Resume()
+	if err := s.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if s.scene.MeshInstanceList[0].Transform != moveTo.Inv() {
+		t.Fatal("expected queued edit to be applied after resuming")
+	}
+	if len(tr.updates) != updates+1 || tr.updates[updates] != tracer.SceneData {
+		t.Fatalf("expected the edited scene to be uploaded to the tracer; got updates %v", tr.updates[updates:])
+	}
+	if tr.lastTrace.AccumulatedSamples != 0 || s.Stats().Samples != 1 {
+		t.Fatalf("expected accumulation to restart after the edit; got %d accumulated samples", tr.lastTrace.AccumulatedSamples)
+	}
+	if tr.lastTrace.Seed == seed {
+		t.Fatal("expected samples traced after the edit to use a new seed")
+	}
+
+	// Accumulation should continue with the following passes
+	if err := s.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.lastTrace.AccumulatedSamples != 1 || s.AccumulatedSamples() != 2 {
+		t.Fatalf("expected accumulation to continue after the edit; got %d accumulated samples", s.AccumulatedSamples())
+	}
+	if tr.traceCount != 5 {
+		t.Fatalf("expected 5 traced samples; got %d", tr.traceCount)
+	}
+}
+
+func TestSessionKeepsEditsFollowingFailedEdit(t *testing.T) {
+	tr := &mockTracer{}
+	s := newMockSession(t, tr, Options{
+		FrameW:          16,
+		FrameH:          16,
+		SamplesPerPixel: 1,
+	})
+	defer s.Close()
+
+	moveTo := types.Translate4(types.Vec3{0, 5, 0})
+	s.QueueEdit(
+		MoveInstance{Instance: 42, Transform: types.Ident4()},
+		MoveInstance{Instance: 0, Transform: moveTo},
+	)
+	if err := s.Render(); err == nil {
+		t.Fatal("expected an error for an edit that targets an unknown instance")
+	}
+	if tr.traceCount != 0 {
+		t.Fatalf("expected failed edits to abort the sample pass; got %d traced samples", tr.traceCount)
+	}
+
+	if err := s.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if s.scene.MeshInstanceList[0].Transform != moveTo.Inv() {
+		t.Fatal("expected the edit following the failed edit to be applied")
+	}
+
+	// Sessions with a sample target stop tracing once it is reached
+	if err := s.Render(); err != nil {
+		t.Fatal(err)
+	}
+	if tr.traceCount != 1 {
+		t.Fatalf("expected session to stop tracing after reaching the sample target; got %d traced samples", tr.traceCount)
+	}
+}
+
+// Create a mock session for a compiled scene with a single mesh instance.
+func newMockSession(t *testing.T, tr *mockTracer, opts Options) *Session {
+	mesh := input.NewMesh("quad")
+	prim := &input.Primitive{
+		Vertices: [3]types.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}},
+		Normals:  [3]types.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}},
+	}
+	prim.SetBBox([2]types.Vec3{{0, 0, 0}, {1, 1, 0}})
+	prim.SetCenter(types.Vec3{1.0 / 3.0, 1.0 / 3.0, 0})
+	mesh.Primitives = append(mesh.Primitives, prim)
+	mesh.MarkBBoxDirty()
+
+	mi := &input.MeshInstance{Transform: types.Ident4()}
+	mi.SetBBox(mesh.BBox())
+	mi.SetCenter(types.Vec3{0.5, 0.5, 0})
+
+	ps := input.NewScene()
+	ps.Meshes = []*input.Mesh{mesh}
+	ps.MeshInstances = []*input.MeshInstance{mi}
+
+	sc, _, err := compiler.Compile(ps, compiler.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Session{
+		defaultRenderer: newMockRenderer(tr, opts),
+		scene:           sc,
+	}
+}
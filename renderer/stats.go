@@ -23,4 +23,11 @@ type FrameStats struct {
 
 	// Total render time for entire frame.
 	RenderTime time.Duration
+
+	// The number of samples per pixel accumulated into the frame.
+	Samples uint32
+
+	// The number of samples per pixel in the progressive accumulation
+	// buffer (0 if accumulation is disabled).
+	AccumulatedSamples uint32
 }
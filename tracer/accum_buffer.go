@@ -0,0 +1,99 @@
+package tracer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// AccumBuffer progressively accumulates the per-pixel radiance of rendered
+// frames so that repeated renders of the same view converge over time. The
+// buffer must be reset whenever the view changes (e.g. the camera moves).
+// An AccumBuffer is safe for concurrent use so a UI can query its sample
+// count while a render loop feeds it.
+type AccumBuffer struct {
+	// mutex for synchronizing access to the accumulated samples
+	mutex sync.Mutex
+
+	frameW uint32
+	frameH uint32
+
+	// The summed per-pixel radiance of all added samples.
+	sum []types.Vec4
+
+	// The number of samples per pixel added since the last reset.
+	samples uint32
+}
+
+// Create a new accumulation buffer for frames with the given dimensions.
+func NewAccumBuffer(frameW, frameH uint32) *AccumBuffer {
+	return &AccumBuffer{
+		frameW: frameW,
+		frameH: frameH,
+		sum:    make([]types.Vec4, frameW*frameH),
+	}
+}
+
+// Add a frame containing a single sample per pixel to the buffer.
+func (b *AccumBuffer) Add(frame []types.Vec4) error {
+	return b.AddSamples(frame, 1)
+}
+
+// Add a frame whose pixels contain the average radiance of the specified
+// number of samples. The frame is weighted by its sample count so that the
+// resolved output is the average of all added samples.
+func (b *AccumBuffer) AddSamples(frame []types.Vec4, samples uint32) error {
+	if len(frame) != len(b.sum) {
+		return fmt.Errorf("accumulation buffer: expected frame to contain %d pixels for a %dx%d frame; got %d", len(b.sum), b.frameW, b.frameH, len(frame))
+	} else if samples == 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	weight := float32(samples)
+	for index, pixel := range frame {
+		b.sum[index] = b.sum[index].Add(pixel.Mul(weight))
+	}
+	b.samples += samples
+	return nil
+}
+
+// Get the average radiance of the accumulated samples. If no samples have
+// been accumulated since the last reset, all returned pixels are zero.
+func (b *AccumBuffer) Resolve() []types.Vec4 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	out := make([]types.Vec4, len(b.sum))
+	if b.samples == 0 {
+		return out
+	}
+
+	invSamples := 1.0 / float32(b.samples)
+	for index, pixel := range b.sum {
+		out[index] = pixel.Mul(invSamples)
+	}
+	return out
+}
+
+// Discard all accumulated samples.
+func (b *AccumBuffer) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for index := range b.sum {
+		b.sum[index] = types.Vec4{}
+	}
+	b.samples = 0
+}
+
+// Get the number of samples per pixel accumulated since the last reset.
+func (b *AccumBuffer) Samples() uint32 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.samples
+}
@@ -0,0 +1,58 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestAccumBuffer(t *testing.T) {
+	buf := NewAccumBuffer(2, 1)
+
+	// Resolving an empty buffer should yield a black frame
+	for index, pixel := range buf.Resolve() {
+		if pixel != (types.Vec4{}) {
+			t.Fatalf("[pixel %d] expected empty buffer to resolve to black; got %v", index, pixel)
+		}
+	}
+
+	err := buf.Add([]types.Vec4{{1, 0, 0, 1}, {0, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = buf.AddSamples([]types.Vec4{{0, 0, 0, 1}, {0.5, 1, 0.5, 1}}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if samples := buf.Samples(); samples != 4 {
+		t.Fatalf("expected buffer to contain 4 samples; got %d", samples)
+	}
+
+	expFrame := []types.Vec4{{0.25, 0, 0, 1}, {0.375, 0.75, 0.375, 1}}
+	for index, pixel := range buf.Resolve() {
+		if pixel != expFrame[index] {
+			t.Fatalf("[pixel %d] expected resolved value %v; got %v", index, expFrame[index], pixel)
+		}
+	}
+
+	buf.Reset()
+	if samples := buf.Samples(); samples != 0 {
+		t.Fatalf("expected reset buffer to contain 0 samples; got %d", samples)
+	}
+	err = buf.Add([]types.Vec4{{0, 1, 0, 1}, {0, 0, 1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expFrame = []types.Vec4{{0, 1, 0, 1}, {0, 0, 1, 1}}
+	for index, pixel := range buf.Resolve() {
+		if pixel != expFrame[index] {
+			t.Fatalf("[pixel %d] expected resolved value after reset %v; got %v", index, expFrame[index], pixel)
+		}
+	}
+
+	expError := "accumulation buffer: expected frame to contain 2 pixels for a 2x1 frame; got 1"
+	if err = buf.Add([]types.Vec4{{}}); err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,298 @@
+package tracer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
+)
+
+var (
+	ErrRayBatchNotSupported  = errors.New("tracer backend does not support ray batch queries")
+	ErrFrameReadNotSupported = errors.New("tracer backend does not support reading frames into user buffers")
+	ErrHostMergeNotSupported = errors.New("tracer backend does not support merging output on the host")
+)
+
+// A Backend encapsulates the compute API specific parts of a tracer, namely
+// uploading data to a compute device, dispatching the rendering kernels and
+// reading back the rendered output. Backends are driven by a BackendTracer
+// which implements the Tracer interface on top of them.
+type Backend interface {
+	// Initialize the backend.
+	Init() error
+
+	// Shutdown the backend and release any allocated resources.
+	Close()
+
+	// Resize the backend buffers to fit a frame with the given dimensions.
+	Resize(frameW, frameH uint32) error
+
+	// Upload the optimized scene data to the compute device.
+	UploadScene(*scene.Scene) error
+
+	// Update the camera used for generating primary rays.
+	UploadCamera(*scene.Camera) error
+
+	// Trace the block request and add its samples to the backend's
+	// accumulation buffers.
+	Render(*BlockRequest) error
+
+	// Merge the accumulated output of another backend instance of the
+	// same type into this backend's buffers.
+	Merge(Backend, *BlockRequest) error
+
+	// Post-process the accumulated output and read back the rendered frame.
+	Readback(*BlockRequest) error
+}
+
+// A HostMergeBackend is implemented by backends that can exchange their
+// accumulated samples with the host. It allows BackendTracer to implement
+// the HostMerger interface.
+type HostMergeBackend interface {
+	// Copy the trace accumulator samples for the block rows into the
+	// supplied buffer.
+	ReadTraceAccumulator(*BlockRequest, []types.Vec3) error
+
+	// Add the block rows of the supplied buffer to the frame accumulator.
+	AccumulateFrame(*BlockRequest, []types.Vec3) error
+
+	// Merge the AOV and variance output of another backend instance of
+	// the same type into this backend's buffers.
+	MergeAux(Backend, *BlockRequest) error
+}
+
+// A Tracer implementation that delegates all device work to a Backend. It
+// buffers asynchronous state updates until the next call to Trace and
+// keeps track of the tracer statistics.
+type BackendTracer struct {
+	id      string
+	flags   Flag
+	speed   uint32
+	backend Backend
+
+	// A buffer for asynchronous updates. Updates are grouped by type and
+	// latest updates always overwrite the previous ones.
+	changeBuffer map[ChangeType]interface{}
+
+	// Statistics for last rendered frame.
+	stats Stats
+}
+
+// Create a new tracer that uses the supplied backend.
+func NewBackendTracer(id string, flags Flag, speed uint32, backend Backend) *BackendTracer {
+	return &BackendTracer{
+		id:           id,
+		flags:        flags,
+		speed:        speed,
+		backend:      backend,
+		changeBuffer: make(map[ChangeType]interface{}, 0),
+	}
+}
+
+// Get the backend used by this tracer.
+func (tr *BackendTracer) Backend() Backend {
+	return tr.backend
+}
+
+// Get tracer id.
+func (tr *BackendTracer) Id() string {
+	return tr.id
+}
+
+// Get tracer flags.
+func (tr *BackendTracer) Flags() Flag {
+	return tr.flags
+}
+
+// Get the computation speed estimate (in GFlops).
+func (tr *BackendTracer) Speed() uint32 {
+	return tr.speed
+}
+
+// Initialize tracer.
+func (tr *BackendTracer) Init() error {
+	return tr.backend.Init()
+}
+
+// Shutdown and cleanup tracer.
+func (tr *BackendTracer) Close() {
+	tr.backend.Close()
+}
+
+// Retrieve last frame statistics.
+func (tr *BackendTracer) Stats() *Stats {
+	return &tr.stats
+}
+
+// Update tracer state.
+func (tr *BackendTracer) UpdateState(mode UpdateMode, changeType ChangeType, data interface{}) (time.Duration, error) {
+	tr.changeBuffer[changeType] = data
+
+	if mode == Synchronous {
+		return tr.commitChanges()
+	}
+
+	return time.Duration(0), nil
+}
+
+// Commit queued state changes. Frame dimension changes are always applied
+// before scene data changes.
+func (tr *BackendTracer) commitChanges() (time.Duration, error) {
+	if len(tr.changeBuffer) == 0 {
+		return 0, nil
+	}
+
+	var err error
+	start := time.Now()
+	for _, changeType := range []ChangeType{FrameDimensions, SceneData, CameraData} {
+		data, exists := tr.changeBuffer[changeType]
+		if !exists {
+			continue
+		}
+
+		switch changeType {
+		case FrameDimensions:
+			dims := data.([2]uint32)
+			err = tr.backend.Resize(dims[0], dims[1])
+		case SceneData:
+			err = tr.backend.UploadScene(data.(*scene.Scene))
+		case CameraData:
+			err = tr.backend.UploadCamera(data.(*scene.Camera))
+		}
+
+		if err != nil {
+			return time.Since(start), err
+		}
+		delete(tr.changeBuffer, changeType)
+	}
+
+	for changeType := range tr.changeBuffer {
+		return time.Since(start), fmt.Errorf("unsupported change type %d", changeType)
+	}
+
+	return time.Since(start), nil
+}
+
+// Process block request.
+func (tr *BackendTracer) Trace(blockReq *BlockRequest) (time.Duration, error) {
+	start := time.Now()
+
+	updateTime, err := tr.commitChanges()
+	if err != nil {
+		return time.Since(start), err
+	}
+
+	err = tr.backend.Render(blockReq)
+	if err != nil {
+		return time.Since(start), err
+	}
+
+	tr.stats.BlockW = blockReq.BlockW
+	tr.stats.BlockH = blockReq.BlockH
+	tr.stats.UpdateTime = updateTime
+	tr.stats.RenderTime = time.Since(start)
+	return tr.stats.RenderTime, nil
+}
+
+// Merge accumulator output from another tracer into this tracer's buffer.
+// Both tracers must be backed by backends of the same type.
+func (tr *BackendTracer) MergeOutput(other Tracer, blockReq *BlockRequest) (time.Duration, error) {
+	start := time.Now()
+
+	src, isBackendTracer := other.(*BackendTracer)
+	if !isBackendTracer {
+		return 0, fmt.Errorf("merge failed: unsupported tracer instance")
+	}
+
+	err := tr.backend.Merge(src.backend, blockReq)
+	return time.Since(start), err
+}
+
+// Run post-process filters to the accumulated trace data and update the
+// output frame buffer.
+func (tr *BackendTracer) SyncFramebuffer(blockReq *BlockRequest) (time.Duration, error) {
+	start := time.Now()
+	err := tr.backend.Readback(blockReq)
+	return time.Since(start), err
+}
+
+// Trace a batch of user-supplied rays. This method returns an error if the
+// tracer backend does not implement the RayBatchTracer interface.
+func (tr *BackendTracer) TraceRays(rays []Ray, blockReq *BlockRequest) ([]RayResult, error) {
+	batchTracer, isBatchTracer := tr.backend.(RayBatchTracer)
+	if !isBatchTracer {
+		return nil, ErrRayBatchNotSupported
+	}
+
+	_, err := tr.commitChanges()
+	if err != nil {
+		return nil, err
+	}
+
+	return batchTracer.TraceRays(rays, blockReq)
+}
+
+// Copy the rendered frame into a caller-owned buffer. This method returns an
+// error if the tracer backend does not implement the FrameReader interface.
+func (tr *BackendTracer) ReadFrame(blockReq *BlockRequest, dst []float32) ([]float32, error) {
+	frameReader, isFrameReader := tr.backend.(FrameReader)
+	if !isFrameReader {
+		return nil, ErrFrameReadNotSupported
+	}
+
+	if err := ValidateFrameBuffer(dst, blockReq.FrameW, blockReq.FrameH); err != nil {
+		return nil, err
+	}
+
+	return frameReader.ReadFrame(blockReq, dst)
+}
+
+// Copy the trace accumulator samples for the block rows into the supplied
+// buffer. This method returns an error if the tracer backend does not
+// implement the HostMergeBackend interface.
+func (tr *BackendTracer) ReadTraceAccumulator(blockReq *BlockRequest, dst []types.Vec3) error {
+	hostMerger, isHostMerger := tr.backend.(HostMergeBackend)
+	if !isHostMerger {
+		return ErrHostMergeNotSupported
+	}
+
+	if err := ValidateAccumulatorBuffer(dst, blockReq.FrameW, blockReq.FrameH); err != nil {
+		return err
+	}
+
+	return hostMerger.ReadTraceAccumulator(blockReq, dst)
+}
+
+// Add the block rows of the supplied buffer to the frame accumulator. This
+// method returns an error if the tracer backend does not implement the
+// HostMergeBackend interface.
+func (tr *BackendTracer) AccumulateFrame(blockReq *BlockRequest, src []types.Vec3) error {
+	hostMerger, isHostMerger := tr.backend.(HostMergeBackend)
+	if !isHostMerger {
+		return ErrHostMergeNotSupported
+	}
+
+	if err := ValidateAccumulatorBuffer(src, blockReq.FrameW, blockReq.FrameH); err != nil {
+		return err
+	}
+
+	return hostMerger.AccumulateFrame(blockReq, src)
+}
+
+// Merge the AOV and variance output from another tracer into this tracer's
+// buffers. Both tracers must be backed by backends of the same type.
+func (tr *BackendTracer) MergeAuxOutput(other Tracer, blockReq *BlockRequest) error {
+	hostMerger, isHostMerger := tr.backend.(HostMergeBackend)
+	if !isHostMerger {
+		return ErrHostMergeNotSupported
+	}
+
+	src, isBackendTracer := other.(*BackendTracer)
+	if !isBackendTracer {
+		return fmt.Errorf("merge failed: unsupported tracer instance")
+	}
+
+	return hostMerger.MergeAux(src.backend, blockReq)
+}
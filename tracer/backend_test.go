@@ -0,0 +1,98 @@
+package tracer
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/scene"
+)
+
+func TestBackendTracerCallOrder(t *testing.T) {
+	backend := &mockBackend{}
+	tr := NewBackendTracer("mock", Local, 1, backend)
+
+	err := tr.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue async updates; they should be applied before rendering
+	sc := &scene.Scene{Camera: scene.NewCamera(45)}
+	tr.UpdateState(Asynchronous, SceneData, sc)
+	tr.UpdateState(Asynchronous, CameraData, sc.Camera)
+
+	blockReq := &BlockRequest{FrameW: 4, FrameH: 4, BlockW: 4, BlockH: 4, SamplesPerPixel: 1}
+	_, err = tr.Trace(blockReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tr.SyncFramebuffer(blockReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Close()
+
+	expCalls := []string{"Init", "UploadScene", "UploadCamera", "Render", "Readback", "Close"}
+	if !reflect.DeepEqual(backend.calls, expCalls) {
+		t.Fatalf("expected backend calls to be %v; got %v", expCalls, backend.calls)
+	}
+	if backend.scene != sc {
+		t.Fatal("expected backend to receive the uploaded scene")
+	}
+
+	stats := tr.Stats()
+	if stats.BlockW != 4 || stats.BlockH != 4 {
+		t.Fatalf("expected tracer stats to record a 4x4 block; got %dx%d", stats.BlockW, stats.BlockH)
+	}
+
+	// Backends without ray batch support should report an error
+	_, err = tr.TraceRays([]Ray{{}}, nil)
+	if err != ErrRayBatchNotSupported {
+		t.Fatalf("expected error %v; got %v", ErrRayBatchNotSupported, err)
+	}
+}
+
+type mockBackend struct {
+	calls []string
+	scene *scene.Scene
+}
+
+func (mb *mockBackend) Init() error {
+	mb.calls = append(mb.calls, "Init")
+	return nil
+}
+
+func (mb *mockBackend) Close() {
+	mb.calls = append(mb.calls, "Close")
+}
+
+func (mb *mockBackend) Resize(_, _ uint32) error {
+	mb.calls = append(mb.calls, "Resize")
+	return nil
+}
+
+func (mb *mockBackend) UploadScene(sc *scene.Scene) error {
+	mb.calls = append(mb.calls, "UploadScene")
+	mb.scene = sc
+	return nil
+}
+
+func (mb *mockBackend) UploadCamera(_ *scene.Camera) error {
+	mb.calls = append(mb.calls, "UploadCamera")
+	return nil
+}
+
+func (mb *mockBackend) Render(_ *BlockRequest) error {
+	mb.calls = append(mb.calls, "Render")
+	return nil
+}
+
+func (mb *mockBackend) Merge(_ Backend, _ *BlockRequest) error {
+	mb.calls = append(mb.calls, "Merge")
+	return nil
+}
+
+func (mb *mockBackend) Readback(_ *BlockRequest) error {
+	mb.calls = append(mb.calls, "Readback")
+	return nil
+}
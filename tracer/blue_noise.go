@@ -0,0 +1,65 @@
+package tracer
+
+import (
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// A tileable blue-noise texture with a pair of values in the [0, 1) range per
+// texel. It is used for decorrelating the sub-pixel sample offsets of
+// neighboring pixels (Cranley-Patterson rotation) so that any residual noise
+// is distributed at high frequencies and is less objectionable to the eye.
+type BlueNoise struct {
+	Width  uint32
+	Height uint32
+
+	// Texel values in row-major order.
+	Data []types.Vec2
+}
+
+// Create a blue-noise texture from a set of precomputed texel values.
+func NewBlueNoise(width, height uint32, data []types.Vec2) (*BlueNoise, error) {
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("blue noise: invalid texture dimensions %dx%d", width, height)
+	}
+	if len(data) != int(width*height) {
+		return nil, fmt.Errorf("blue noise: expected %d texels; got %d", width*height, len(data))
+	}
+
+	return &BlueNoise{
+		Width:  width,
+		Height: height,
+		Data:   data,
+	}, nil
+}
+
+// Load a blue-noise texture from an image file. The red and green channels
+// of each pixel are used as the texel values.
+func LoadBlueNoise(imgFile string) (*BlueNoise, error) {
+	f, err := os.Open(imgFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("blue noise: could not decode %q: %s", imgFile, err.Error())
+	}
+
+	bounds := img.Bounds()
+	data := make([]types.Vec2, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// Map 16-bit channel values to the [0, 1) range
+			r, g, _, _ := img.At(x, y).RGBA()
+			data = append(data, types.Vec2{float32(r) / 65536.0, float32(g) / 65536.0})
+		}
+	}
+
+	return NewBlueNoise(uint32(bounds.Dx()), uint32(bounds.Dy()), data)
+}
@@ -0,0 +1,59 @@
+package tracer
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestLoadBlueNoise(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{R: 0, G: 128, B: 0, A: 255})
+	img.Set(1, 0, color.NRGBA{R: 255, G: 64, B: 0, A: 255})
+
+	f, err := ioutil.TempFile("", "polaris-blue-noise")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	err = png.Encode(f, img)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bn, err := LoadBlueNoise(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bn.Width != 2 || bn.Height != 1 {
+		t.Fatalf("expected blue noise dims to be 2x1; got %dx%d", bn.Width, bn.Height)
+	}
+	expData := []types.Vec2{
+		{0, 128.0 / 255.0},
+		{1, 64.0 / 255.0},
+	}
+	for index, exp := range expData {
+		for c := 0; c < 2; c++ {
+			if math.Abs(float64(bn.Data[index][c]-exp[c])) > 1e-3 {
+				t.Fatalf("[texel %d] expected value to be %v; got %v", index, exp, bn.Data[index])
+			}
+		}
+		if bn.Data[index][0] >= 1 || bn.Data[index][1] >= 1 {
+			t.Fatalf("[texel %d] expected values to be in the [0, 1) range; got %v", index, bn.Data[index])
+		}
+	}
+
+	_, err = NewBlueNoise(2, 2, expData)
+	expError := "blue noise: expected 4 texels; got 2"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,142 @@
+package tracer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// A 1D or 3D color lookup table for grading the tone-mapped output. For 1D
+// tables each color channel is mapped independently using Size entries. For
+// 3D tables the entries form a Size x Size x Size lattice with the red
+// coordinate changing fastest followed by the green and blue coordinates.
+type ColorLUT struct {
+	Title string
+
+	// Table dimensionality (1 or 3).
+	Dimensions uint32
+
+	// Number of entries along each table dimension.
+	Size uint32
+
+	// The input color range covered by the table.
+	DomainMin types.Vec3
+	DomainMax types.Vec3
+
+	// Table entries.
+	Data []types.Vec3
+}
+
+// Load a color lookup table from a file in Adobe/Resolve .cube format.
+func LoadColorLUT(lutFile string) (*ColorLUT, error) {
+	f, err := os.Open(lutFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lut, err := ParseCubeLUT(f)
+	if err != nil {
+		return nil, fmt.Errorf("color lut: %q: %s", lutFile, err.Error())
+	}
+	return lut, nil
+}
+
+// Parse a color lookup table in Adobe/Resolve .cube format.
+func ParseCubeLUT(r io.Reader) (*ColorLUT, error) {
+	lut := &ColorLUT{
+		DomainMin: types.Vec3{0, 0, 0},
+		DomainMax: types.Vec3{1, 1, 1},
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		var err error
+		switch tokens[0] {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "TITLE")), `"`)
+		case "LUT_1D_SIZE", "LUT_3D_SIZE":
+			if lut.Dimensions != 0 {
+				return nil, fmt.Errorf("line %d: table size already defined", lineNum)
+			}
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: expected 1 argument for %s; got %d", lineNum, tokens[0], len(tokens)-1)
+			}
+			var size uint64
+			size, err = strconv.ParseUint(tokens[1], 10, 32)
+			lut.Size = uint32(size)
+			lut.Dimensions = 1
+			if tokens[0] == "LUT_3D_SIZE" {
+				lut.Dimensions = 3
+			}
+			if err == nil && (lut.Size < 2 || (lut.Dimensions == 3 && lut.Size > 256)) {
+				err = fmt.Errorf("unsupported table size %d", lut.Size)
+			}
+		case "DOMAIN_MIN":
+			lut.DomainMin, err = parseLUTVec3(tokens)
+		case "DOMAIN_MAX":
+			lut.DomainMax, err = parseLUTVec3(tokens)
+		default:
+			if lut.Dimensions == 0 {
+				return nil, fmt.Errorf("line %d: table entries defined before the table size", lineNum)
+			}
+			var entry types.Vec3
+			entry, err = parseLUTVec3(append([]string{""}, tokens...))
+			lut.Data = append(lut.Data, entry)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNum, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if lut.Dimensions == 0 {
+		return nil, fmt.Errorf("missing LUT_1D_SIZE or LUT_3D_SIZE")
+	}
+	expEntries := int(lut.Size)
+	if lut.Dimensions == 3 {
+		expEntries *= int(lut.Size * lut.Size)
+	}
+	if len(lut.Data) != expEntries {
+		return nil, fmt.Errorf("expected %d table entries; got %d", expEntries, len(lut.Data))
+	}
+	for axis := 0; axis < 3; axis++ {
+		if lut.DomainMin[axis] >= lut.DomainMax[axis] {
+			return nil, fmt.Errorf("invalid table domain %v - %v", lut.DomainMin, lut.DomainMax)
+		}
+	}
+
+	return lut, nil
+}
+
+// Parse the 3 float arguments following a .cube keyword.
+func parseLUTVec3(tokens []string) (types.Vec3, error) {
+	var v types.Vec3
+	if len(tokens) != 4 {
+		return v, fmt.Errorf("expected 3 values; got %d", len(tokens)-1)
+	}
+	for axis := 0; axis < 3; axis++ {
+		val, err := strconv.ParseFloat(tokens[axis+1], 32)
+		if err != nil {
+			return v, err
+		}
+		v[axis] = float32(val)
+	}
+	return v, nil
+}
@@ -0,0 +1,128 @@
+package tracer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestParseCubeLUT(t *testing.T) {
+	invert := func(c types.Vec3) types.Vec3 { return types.Vec3{1 - c[0], 1 - c[1], 1 - c[2]} }
+	for _, dims := range []int{1, 3} {
+		size := 3
+		lut, err := ParseCubeLUT(genCubeLUT(dims, size, invert))
+		if err != nil {
+			t.Fatalf("[%dD] %v", dims, err)
+		}
+
+		if lut.Title != "test" {
+			t.Fatalf("[%dD] expected title to be %q; got %q", dims, "test", lut.Title)
+		}
+		if lut.Dimensions != uint32(dims) || lut.Size != uint32(size) {
+			t.Fatalf("[%dD] expected a %dD table of size %d; got a %dD table of size %d", dims, dims, size, lut.Dimensions, lut.Size)
+		}
+		if lut.DomainMin != (types.Vec3{0, 0, 0}) || lut.DomainMax != (types.Vec3{1, 1, 1}) {
+			t.Fatalf("[%dD] expected default [0, 1] domain; got %v - %v", dims, lut.DomainMin, lut.DomainMax)
+		}
+
+		// 3D entries are stored with the red coordinate changing fastest
+		expEntries := []struct {
+			index int
+			value types.Vec3
+		}{
+			{0, types.Vec3{1, 1, 1}},
+			{1, types.Vec3{0.5, 0.5, 0.5}},
+			{2, types.Vec3{0, 0, 0}},
+		}
+		if dims == 3 {
+			expEntries = []struct {
+				index int
+				value types.Vec3
+			}{
+				{0, types.Vec3{1, 1, 1}},
+				{1, types.Vec3{0.5, 1, 1}},
+				{size, types.Vec3{1, 0.5, 1}},
+				{size * size, types.Vec3{1, 1, 0.5}},
+				{size*size*size - 1, types.Vec3{0, 0, 0}},
+			}
+		}
+		for _, exp := range expEntries {
+			if got := lut.Data[exp.index]; !lutColorApproxEqual(got, exp.value) {
+				t.Fatalf("[%dD] expected table entry %d to be %v; got %v", dims, exp.index, exp.value, got)
+			}
+		}
+	}
+}
+
+func TestParseCubeLUTDomain(t *testing.T) {
+	lut, err := ParseCubeLUT(strings.NewReader("LUT_1D_SIZE 2\nDOMAIN_MIN -1 0 0\nDOMAIN_MAX 2 1 4\n0 0 0\n1 1 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := (types.Vec3{-1, 0, 0}); lut.DomainMin != exp {
+		t.Fatalf("expected domain min to be %v; got %v", exp, lut.DomainMin)
+	}
+	if exp := (types.Vec3{2, 1, 4}); lut.DomainMax != exp {
+		t.Fatalf("expected domain max to be %v; got %v", exp, lut.DomainMax)
+	}
+}
+
+func TestParseCubeLUTErrors(t *testing.T) {
+	specs := []struct {
+		in       string
+		expError string
+	}{
+		{"0 0 0\n", "line 1: table entries defined before the table size"},
+		{"LUT_3D_SIZE 1\n", "line 1: unsupported table size 1"},
+		{"LUT_3D_SIZE 2\n0 0 0\n", "expected 8 table entries; got 1"},
+		{"LUT_1D_SIZE 2\n0 0\n", "line 2: expected 3 values; got 2"},
+		{"TITLE \"empty\"\n", "missing LUT_1D_SIZE or LUT_3D_SIZE"},
+	}
+
+	for specIndex, spec := range specs {
+		_, err := ParseCubeLUT(strings.NewReader(spec.in))
+		if err == nil || err.Error() != spec.expError {
+			t.Fatalf("[spec %d] expected error %q; got %v", specIndex, spec.expError, err)
+		}
+	}
+}
+
+// Generate a .cube LUT with the given dimensions and size by sampling fn at
+// the table lattice points.
+func genCubeLUT(dims, size int, fn func(types.Vec3) types.Vec3) *bytes.Buffer {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# generated test LUT\nTITLE \"test\"\nLUT_%dD_SIZE %d\n\n", dims, size)
+
+	step := 1.0 / float32(size-1)
+	if dims == 1 {
+		for i := 0; i < size; i++ {
+			v := float32(i) * step
+			out := fn(types.Vec3{v, v, v})
+			fmt.Fprintf(&buf, "%f %f %f\n", out[0], out[1], out[2])
+		}
+		return &buf
+	}
+
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				out := fn(types.Vec3{float32(r) * step, float32(g) * step, float32(b) * step})
+				fmt.Fprintf(&buf, "%f %f %f\n", out[0], out[1], out[2])
+			}
+		}
+	}
+	return &buf
+}
+
+func lutColorApproxEqual(v1, v2 types.Vec3) bool {
+	for axis := 0; axis < 3; axis++ {
+		if math.Abs(float64(v1[axis]-v2[axis])) > 1e-4 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package tracer
+
+import "fmt"
+
+// A rectangular region of the frame in pixel coordinates. When rendering a
+// crop window, primary rays are only generated for the pixels inside the
+// window while the camera still computes their directions as if the entire
+// frame was rendered so the output lines up with a full frame render.
+type CropWindow struct {
+	X uint32
+	Y uint32
+	W uint32
+	H uint32
+}
+
+// Check if the crop window is defined. A window with a zero width or height
+// indicates that the entire frame should be rendered.
+func (c CropWindow) IsSet() bool {
+	return c.W != 0 && c.H != 0
+}
+
+// Ensure that the crop window fits inside a frame with the given dimensions.
+func (c CropWindow) Validate(frameW, frameH uint32) error {
+	if !c.IsSet() {
+		return nil
+	}
+
+	if c.X+c.W > frameW || c.Y+c.H > frameH {
+		return fmt.Errorf("crop window %dx%d at (%d, %d) exceeds the %dx%d frame bounds", c.W, c.H, c.X, c.Y, frameW, frameH)
+	}
+
+	return nil
+}
+
+// Get the number of pixels in each row of the block that is traced by the
+// request. If a crop window is defined, this equals the window width.
+func (r *BlockRequest) RowWidth() uint32 {
+	if r.Crop.IsSet() {
+		return r.Crop.W
+	}
+	return r.FrameW
+}
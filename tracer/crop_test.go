@@ -0,0 +1,36 @@
+package tracer
+
+import "testing"
+
+func TestCropWindowRowWidth(t *testing.T) {
+	fullReq := &BlockRequest{FrameW: 64, FrameH: 48, BlockW: 64, BlockH: 48}
+	if got := fullReq.RowWidth(); got != 64 {
+		t.Fatalf("expected full frame row width to be 64; got %d", got)
+	}
+
+	cropReq := &BlockRequest{
+		FrameW: 64,
+		FrameH: 48,
+		BlockW: 64,
+		BlockY: 10,
+		BlockH: 7,
+		Crop:   CropWindow{X: 20, Y: 10, W: 9, H: 7},
+	}
+	if got := cropReq.RowWidth(); got != 9 {
+		t.Fatalf("expected crop row width to be 9; got %d", got)
+	}
+}
+
+func TestCropWindowValidation(t *testing.T) {
+	if err := (CropWindow{}).Validate(16, 16); err != nil {
+		t.Fatalf("expected an unset crop window to be valid; got %v", err)
+	}
+	if err := (CropWindow{X: 8, Y: 8, W: 8, H: 8}).Validate(16, 16); err != nil {
+		t.Fatalf("expected crop window to be valid; got %v", err)
+	}
+
+	expError := "crop window 8x4 at (9, 0) exceeds the 16x16 frame bounds"
+	if err := (CropWindow{X: 9, Y: 0, W: 8, H: 4}).Validate(16, 16); err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,68 @@
+package tracer
+
+import (
+	"sort"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// Pixels are never flagged as fireflies if the median luminance of their
+// neighbors is below this value. This prevents faint pixels surrounded by
+// black pixels from being flagged.
+const fireflyMinMedianLuminance float32 = 1e-2
+
+// Detect fireflies in a frame containing linear RGBA values (4 values per
+// pixel). A pixel is flagged as a firefly if its luminance exceeds threshold
+// times the median luminance of its (up to 8) neighboring pixels. Comparing
+// against the median ensures that pixels belonging to uniformly bright
+// regions are not flagged. The returned mask contains a value for each frame
+// pixel which is set to 1 for fireflies and 0 otherwise.
+func DetectFireflies(frame []float32, frameW, frameH uint32, threshold float32) ([]float32, error) {
+	if err := ValidateFrameBuffer(frame, frameW, frameH); err != nil {
+		return nil, err
+	}
+
+	luminance := make([]float32, frameW*frameH)
+	for pixel := range luminance {
+		luminance[pixel] = Luminance(types.Vec3{frame[4*pixel], frame[4*pixel+1], frame[4*pixel+2]})
+	}
+
+	mask := make([]float32, frameW*frameH)
+	neighbors := make([]float32, 0, 8)
+	for y := 0; y < int(frameH); y++ {
+		for x := 0; x < int(frameW); x++ {
+			neighbors = neighbors[:0]
+			for ny := y - 1; ny <= y+1; ny++ {
+				for nx := x - 1; nx <= x+1; nx++ {
+					if (nx == x && ny == y) || nx < 0 || ny < 0 || nx >= int(frameW) || ny >= int(frameH) {
+						continue
+					}
+					neighbors = append(neighbors, luminance[ny*int(frameW)+nx])
+				}
+			}
+			if len(neighbors) == 0 {
+				continue
+			}
+
+			median := medianFloat32(neighbors)
+			if median < fireflyMinMedianLuminance {
+				median = fireflyMinMedianLuminance
+			}
+			if pixel := y*int(frameW) + x; luminance[pixel] > threshold*median {
+				mask[pixel] = 1
+			}
+		}
+	}
+
+	return mask, nil
+}
+
+// Get the median of a list of values. The list is sorted in place.
+func medianFloat32(values []float32) float32 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return 0.5 * (values[mid-1] + values[mid])
+	}
+	return values[mid]
+}
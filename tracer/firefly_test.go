@@ -0,0 +1,55 @@
+package tracer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectFireflies(t *testing.T) {
+	// A dim 4x4 frame with an isolated bright pixel at (1, 1) and a
+	// uniformly bright 2x2 region in the bottom-right corner
+	frameW, frameH := uint32(4), uint32(4)
+	frame := make([]float32, 4*frameW*frameH)
+	setPixel := func(x, y int, v float32) {
+		offset := 4 * (y*int(frameW) + x)
+		frame[offset], frame[offset+1], frame[offset+2], frame[offset+3] = v, v, v, 1
+	}
+	for y := 0; y < int(frameH); y++ {
+		for x := 0; x < int(frameW); x++ {
+			setPixel(x, y, 0.1)
+		}
+	}
+	setPixel(1, 1, 50)
+	for _, xy := range [][2]int{{2, 2}, {3, 2}, {2, 3}, {3, 3}} {
+		setPixel(xy[0], xy[1], 20)
+	}
+
+	mask, err := DetectFireflies(frame, frameW, frameH, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expMask := []float32{
+		0, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+	}
+	if !reflect.DeepEqual(mask, expMask) {
+		t.Fatalf("expected firefly mask to be %v; got %v", expMask, mask)
+	}
+
+	// A uniformly bright frame contains no fireflies
+	for y := 0; y < int(frameH); y++ {
+		for x := 0; x < int(frameW); x++ {
+			setPixel(x, y, 50)
+		}
+	}
+	if mask, _ = DetectFireflies(frame, frameW, frameH, 10); !reflect.DeepEqual(mask, make([]float32, frameW*frameH)) {
+		t.Fatalf("expected uniformly bright frame to contain no fireflies; got %v", mask)
+	}
+
+	if _, err = DetectFireflies(frame[:4], frameW, frameH, 10); err == nil {
+		t.Fatal("expected an error for a frame buffer with invalid dimensions")
+	}
+}
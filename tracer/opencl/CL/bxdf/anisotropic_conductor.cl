@@ -0,0 +1,87 @@
+#ifndef BXDF_ANISOTROPIC_CONDUCTOR_CL
+#define BXDF_ANISOTROPIC_CONDUCTOR_CL
+
+float2 _anisotropicConductorRoughness( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData);
+float3 anisotropicConductorSample( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 inRayDir, float3 *outRayDir, float *pdf);
+float anisotropicConductorPdf( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 outRayDir);
+float3 anisotropicConductorEval( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 outRayDir);
+
+// Get the roughness along the surface tangent (x) and bi-tangent (y). If
+// a roughness texture is specified, its value is used to scale both values.
+float2 _anisotropicConductorRoughness( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData){
+	float scaler = matNode->roughnessTex != -1 ? texGetSample1f(surface->uv, matNode->roughnessTex, texMeta, texData) : 1.0f;
+
+	// Use Disney's remapping: a = roughness^2
+	float2 roughness = clamp((float2)(matNode->roughness, matNode->roughnessV) * scaler, MIN_ROUGHNESS, 1.0f);
+	return roughness * roughness;
+}
+
+// Sample anisotropic microfacet surface
+float3 anisotropicConductorSample( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 inRayDir, float3 *outRayDir, float *pdf){
+	float2 roughness = _anisotropicConductorRoughness(surface, matNode, texMeta, texData);
+	float3 ks = matGetSample3f(surface->uv, matNode->specularity, matNode->specularityTex, texMeta, texData);
+
+	float3 t, b;
+	surfaceGetTangentFrame(surface, &t, &b);
+
+	// Sample anisotropic GGX distribution to get halfway vector
+	float3 h = ggxAnisoGetSample(roughness, t, b, surface->normal, randSample);
+
+	// Reflect I over h to get O
+	*outRayDir = 2.0f * dot(inRayDir, h) * h - inRayDir;
+	*pdf = ggxAnisoGetReflectionPdf(roughness, inRayDir, *outRayDir, t, b, surface->normal, h);
+
+	// Eval sample
+	float iDotN = dot(inRayDir, surface->normal);
+	float oDotN = dot(*outRayDir, surface->normal);
+	h = normalize(inRayDir + *outRayDir);
+
+	float d = ggxAnisoGetD(roughness, t, b, surface->normal, h);
+	float g = ggxAnisoGetG(roughness, inRayDir, *outRayDir, t, b, surface->normal, h);
+
+	// Calculate fresnel unless no IOR is specified
+	float f = matNode->intIOR != 0.0f
+		? fresnelForDielectric(matNode->extIOR, matNode->intIOR, iDotN)
+		: 1.0f;
+
+	float denom = 4.0f * iDotN * oDotN;
+	return denom > 0.0f ?  ks * f * d * g / denom : 0.0f;
+}
+
+// Get PDF given an outbound ray
+float anisotropicConductorPdf( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 outRayDir){
+	float2 roughness = _anisotropicConductorRoughness(surface, matNode, texMeta, texData);
+
+	float3 t, b;
+	surfaceGetTangentFrame(surface, &t, &b);
+
+	float3 h = normalize(inRayDir + outRayDir);
+	return ggxAnisoGetReflectionPdf(roughness, inRayDir, outRayDir, t, b, surface->normal, h);
+}
+
+// Evaluate anisotropic microfacet BXDF for the selected outgoing ray.
+float3 anisotropicConductorEval( Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 outRayDir){
+	float2 roughness = _anisotropicConductorRoughness(surface, matNode, texMeta, texData);
+	float3 ks = matGetSample3f(surface->uv, matNode->specularity, matNode->specularityTex, texMeta, texData);
+
+	float3 t, b;
+	surfaceGetTangentFrame(surface, &t, &b);
+
+	float iDotN = dot(inRayDir, surface->normal);
+	float oDotN = dot(outRayDir, surface->normal);
+
+	// Calculate fresnel unless no IOR is specified
+	float f = matNode->intIOR != 0.0f
+		? fresnelForDielectric(matNode->extIOR, matNode->intIOR, iDotN)
+		: 1.0f;
+
+	float3 h = normalize(inRayDir + outRayDir);
+
+	float d = ggxAnisoGetD(roughness, t, b, surface->normal, h);
+	float g = ggxAnisoGetG(roughness, inRayDir, outRayDir, t, b, surface->normal, h);
+
+	float denom = 4.0f * iDotN * oDotN;
+	return denom > 0.0f ?  ks * f * d * g / denom : 0.0f;
+}
+
+#endif
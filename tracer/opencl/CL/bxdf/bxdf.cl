@@ -4,8 +4,12 @@
 #include "diffuse.cl"
 #include "conductor.cl"
 #include "dielectric.cl"
+#include "ggx_albedo.cl"
 #include "rough_conductor.cl"
 #include "rough_dielectric.cl"
+#include "anisotropic_conductor.cl"
+#include "transparent.cl"
+#include "subsurface.cl"
 
 #ifndef BXDF_INVALID
 	#define BXDF_INVALID 0
@@ -16,9 +20,12 @@
 #define BXDF_TYPE_ROUGHT_CONDUCTOR 1 << 4
 #define BXDF_TYPE_DIELECTRIC       1 << 5
 #define BXDF_TYPE_ROUGH_DIELECTRIC 1 << 6
+#define BXDF_TYPE_ANISOTROPIC_CONDUCTOR 1 << 7
+#define BXDF_TYPE_TRANSPARENT      1 << 8
+#define BXDF_TYPE_SUBSURFACE       1 << 9
 
 #define BXDF_IS_EMISSIVE(t) (t == BXDF_TYPE_EMISSIVE)
-#define BXDF_IS_SINGULAR(t) ((t & (BXDF_TYPE_CONDUCTOR | BXDF_TYPE_DIELECTRIC)) != 0)
+#define BXDF_IS_SINGULAR(t) ((t & (BXDF_TYPE_CONDUCTOR | BXDF_TYPE_DIELECTRIC | BXDF_TYPE_TRANSPARENT)) != 0)
 
 float3 bxdfGetSample(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 inRayDir, float3 *outRayDir, float *pdf);
 float bxdfGetPdf(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 outRayDir );
@@ -47,6 +54,12 @@ float3 bxdfGetSample(
 			return roughConductorSample(surface, matNode, texMeta, texData, randSample, inRayDir, outRayDir, pdf);
 		case BXDF_TYPE_ROUGH_DIELECTRIC:
 			return roughDielectricSample(surface, matNode, texMeta, texData, randSample, inRayDir, outRayDir, pdf);
+		case BXDF_TYPE_ANISOTROPIC_CONDUCTOR:
+			return anisotropicConductorSample(surface, matNode, texMeta, texData, randSample, inRayDir, outRayDir, pdf);
+		case BXDF_TYPE_TRANSPARENT:
+			return transparentSample(surface, matNode, texMeta, texData, inRayDir, outRayDir, pdf);
+		case BXDF_TYPE_SUBSURFACE:
+			return subsurfaceSample(surface, matNode, texMeta, texData, randSample, outRayDir, pdf);
 	}
 
 	return (float3)(0.0f, 0.0f, 0.0f);
@@ -73,6 +86,10 @@ float bxdfGetPdf(
 			return roughConductorPdf(surface, matNode, texMeta, texData, inRayDir, outRayDir);
 		case BXDF_TYPE_ROUGH_DIELECTRIC:
 			return roughDielectricPdf(surface, matNode, texMeta, texData, inRayDir, outRayDir);
+		case BXDF_TYPE_ANISOTROPIC_CONDUCTOR:
+			return anisotropicConductorPdf(surface, matNode, texMeta, texData, inRayDir, outRayDir);
+		case BXDF_TYPE_SUBSURFACE:
+			return subsurfacePdf(surface, matNode, outRayDir);
 	}
 
 	return 0.0f;
@@ -99,6 +116,10 @@ float3 bxdfEval(
 			return roughConductorEval(surface, matNode, texMeta, texData, inRayDir, outRayDir);
 		case BXDF_TYPE_ROUGH_DIELECTRIC:
 			return roughDielectricEval(surface, matNode, texMeta, texData, inRayDir, outRayDir);
+		case BXDF_TYPE_ANISOTROPIC_CONDUCTOR:
+			return anisotropicConductorEval(surface, matNode, texMeta, texData, inRayDir, outRayDir);
+		case BXDF_TYPE_SUBSURFACE:
+			return subsurfaceEval(surface, matNode, texMeta, texData, outRayDir);
 	}
 
 	return (float3)(0.0f, 0.0f, 0.0f);
@@ -0,0 +1,61 @@
+#ifndef BXDF_GGX_ALBEDO_CL
+#define BXDF_GGX_ALBEDO_CL
+
+#include "ggx_albedo_table.cl"
+
+float _ggxLookupAlbedoRow(int row, float cosTheta);
+float ggxGetAlbedo(float roughness, float cosTheta);
+float ggxGetAverageAlbedo(float roughness);
+float ggxGetMultiScatter(float roughness, float iDotN, float oDotN);
+
+// Linearly interpolate the directional albedo of a table row.
+float _ggxLookupAlbedoRow(int row, float cosTheta){
+	float x = clamp(cosTheta, 0.0f, 1.0f) * (GGX_ALBEDO_TABLE_SIZE - 1);
+	int col = (int)x;
+	if(col >= GGX_ALBEDO_TABLE_SIZE - 1){
+		return ggxAlbedoTable[row * GGX_ALBEDO_TABLE_SIZE + GGX_ALBEDO_TABLE_SIZE - 1];
+	}
+
+	float e0 = ggxAlbedoTable[row * GGX_ALBEDO_TABLE_SIZE + col];
+	float e1 = ggxAlbedoTable[row * GGX_ALBEDO_TABLE_SIZE + col + 1];
+	return mix(e0, e1, x - col);
+}
+
+// Get the directional albedo E(mu) of a single-scatter GGX surface with the
+// given (remapped) roughness using bilinear interpolation.
+float ggxGetAlbedo(float roughness, float cosTheta){
+	float x = clamp(roughness, 0.0f, 1.0f) * (GGX_ALBEDO_TABLE_SIZE - 1);
+	int row = min((int)x, GGX_ALBEDO_TABLE_SIZE - 2);
+
+	return mix(_ggxLookupAlbedoRow(row, cosTheta), _ggxLookupAlbedoRow(row + 1, cosTheta), x - row);
+}
+
+// Get the average albedo Eavg of a single-scatter GGX surface with the given
+// (remapped) roughness.
+float ggxGetAverageAlbedo(float roughness){
+	float x = clamp(roughness, 0.0f, 1.0f) * (GGX_ALBEDO_TABLE_SIZE - 1);
+	int index = (int)x;
+	if(index >= GGX_ALBEDO_TABLE_SIZE - 1){
+		return ggxAverageAlbedoTable[GGX_ALBEDO_TABLE_SIZE - 1];
+	}
+
+	return mix(ggxAverageAlbedoTable[index], ggxAverageAlbedoTable[index + 1], x - index);
+}
+
+// Evaluate the Kulla-Conty multiple scattering compensation lobe which
+// restores the energy lost by single-scatter GGX at high roughness values:
+// fms = (1 - E(i)) * (1 - E(o)) / (PI * (1 - Eavg))
+float ggxGetMultiScatter(float roughness, float iDotN, float oDotN){
+	if(iDotN <= 0.0f || oDotN <= 0.0f){
+		return 0.0f;
+	}
+
+	float avg = ggxGetAverageAlbedo(roughness);
+	if(avg >= 1.0f){
+		return 0.0f;
+	}
+
+	return (1.0f - ggxGetAlbedo(roughness, iDotN)) * (1.0f - ggxGetAlbedo(roughness, oDotN)) / (C_PI * (1.0f - avg));
+}
+
+#endif
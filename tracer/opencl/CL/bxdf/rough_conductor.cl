@@ -34,9 +34,9 @@ float3 roughConductorSample( Surface *surface, MaterialNode *matNode, __global T
 		? fresnelForDielectric(matNode->extIOR, matNode->intIOR, iDotN)
 		: 1.0f;
 
-	// Eval sample (equation 20)
+	// Eval sample (equation 20) and add the multiple scattering compensation term
 	float denom = 4.0f * iDotN * oDotN;
-	return denom > 0.0f ?  ks * f * d * g / denom : 0.0f;
+	return denom > 0.0f ?  ks * (f * d * g / denom + ggxGetMultiScatter(roughness, iDotN, oDotN)) : 0.0f;
 }
 
 // Get PDF given an outbound ray
@@ -72,9 +72,9 @@ float3 roughConductorEval( Surface *surface, MaterialNode *matNode, __global Tex
 	float d = ggxGetD(roughness, surface->normal, h);
 	float g = ggxGetG(roughness, inRayDir, outRayDir, surface->normal, h);
 
-	// Eval sample (equation 20)
+	// Eval sample (equation 20) and add the multiple scattering compensation term
 	float denom = 4.0f * iDotN * oDotN;
-	return denom > 0.0f ?  ks * f * d * g / denom : 0.0f;
+	return denom > 0.0f ?  ks * (f * d * g / denom + ggxGetMultiScatter(roughness, iDotN, oDotN)) : 0.0f;
 }
 
 #endif
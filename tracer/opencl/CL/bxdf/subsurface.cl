@@ -0,0 +1,131 @@
+#ifndef BXDF_SUBSURFACE_CL
+#define BXDF_SUBSURFACE_CL
+
+// Surfaces whose curvature magnitude is below this value are treated as planar
+// when calculating subsurface scattering exit points.
+#define SUBSURFACE_MIN_CURVATURE 1e-4f
+
+float3 subsurfaceSample(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *rayOutDir, float *pdf);
+float subsurfacePdf(Surface *surface, MaterialNode *matNode, float3 rayOutDir);
+float3 subsurfaceEval(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 rayOutDir);
+float subsurfaceProfilePdf(float d, float r);
+float subsurfaceEstimateCurvature(__global float4 *vertices, __global float4 *normals, __global uint *indices, const uint indexed, uint triIndex);
+float3 subsurfaceScatter(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float curvature, float2 randSample0, float2 randSample1);
+
+// Sample subsurface scattering surface. Light exits the surface with a lambert
+// distribution so the subsurface bxdf is evaluated like a diffuse surface
+// whose reflectance is the scatter color:
+//
+// BXDF = scatterColor / PI
+// PDF = cos(theta) / PI
+float3 subsurfaceSample(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *rayOutDir, float *pdf){
+	*rayOutDir = cosWeightedHemisphereGetSample(surface->normal, randSample);
+
+	*pdf = dot(surface->normal, *rayOutDir) * C_1_PI;
+
+	float3 ks = matGetSample3f(surface->uv, matNode->scatterColor, matNode->scatterColorTex, texMeta, texData);
+
+	return ks * C_1_PI;
+}
+
+// Get PDF for subsurface surface given a pre-calculated bounce ray.
+// PDF = cos(theta) / PI
+float subsurfacePdf(Surface *surface, MaterialNode *matNode, float3 rayOutDir){
+	return dot(surface->normal, rayOutDir) * C_1_PI;
+}
+
+// Evaluate BXDF for subsurface surface given a pre-calculated bounce ray.
+float3 subsurfaceEval(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 rayOutDir){
+	float3 ks = matGetSample3f(surface->uv, matNode->scatterColor, matNode->scatterColorTex, texMeta, texData);
+	return ks * C_1_PI;
+}
+
+// Get the probability of sampling radius r from a normalized diffusion
+// profile (Christensen-Burley) with shape parameter d. The radial PDF is
+// given by 2 * PI * r * R(r):
+//
+// PDF = (exp(-r/d) + exp(-r/3d)) / 4d
+float subsurfaceProfilePdf(float d, float r){
+	return d > 0.0f ? 0.25f * (exp(-r / d) + exp(-r / (3.0f * d))) / d : 0.0f;
+}
+
+// Estimate the signed curvature of a triangle from the change of its vertex
+// normals along its edges. Convex surfaces have a positive curvature while
+// concave surfaces have a negative curvature.
+float subsurfaceEstimateCurvature(__global float4 *vertices, __global float4 *normals, __global uint *indices, const uint indexed, uint triIndex){
+	int offset = triIndex * 3;
+	float curvature = 0.0f;
+	for(int i = 0; i < 3; i++){
+		uint vi = VERTEX_INDEX(indices, indexed, offset + i);
+		uint vj = VERTEX_INDEX(indices, indexed, offset + (i + 1) % 3);
+		float3 dp = (vertices[vj] - vertices[vi]).xyz;
+		float3 dn = (normals[vj] - normals[vi]).xyz;
+		float lenSq = dot(dp, dp);
+		curvature += lenSq > 0.0f ? dot(dn, dp) / lenSq : 0.0f;
+	}
+
+	return curvature / 3.0f;
+}
+
+// Move the surface to the point where light that entered the surface exits
+// after scattering inside it. A color channel is selected uniformly and its
+// diffusion profile is used to sample the distance between the entry and
+// exit points. The exit point is then located by walking this distance along
+// a random tangent direction on a sphere with the given signed curvature
+// that approximates the surface.
+//
+// The function returns the per-channel weights for the selected distance.
+float3 subsurfaceScatter(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float curvature, float2 randSample0, float2 randSample1){
+	if( max(matNode->scatterRadius.x, max(matNode->scatterRadius.y, matNode->scatterRadius.z)) <= 0.0f ){
+		return (float3)(1.0f, 1.0f, 1.0f);
+	}
+
+	// Calculate the profile shape parameter for each channel using the
+	// searchlight configuration fit for the scatter color. Anisotropic
+	// scattering scales the mean free path by 1 / (1 - g).
+	float3 albedo = matGetSample3f(surface->uv, matNode->scatterColor, matNode->scatterColorTex, texMeta, texData);
+	float3 a = fabs(albedo - 0.8f);
+	float3 s = 1.85f - albedo + 7.0f * a * a * a;
+	float3 d = matNode->scatterRadius / ((1.0f - matNode->scatterAnisotropy) * s);
+
+	// Select channel and sample radius using the exponential mixture
+	int channel = min(2, (int)(randSample1.x * 3.0f));
+	float dc = channel == 0 ? d.x : (channel == 1 ? d.y : d.z);
+	float r = -(randSample0.x < 0.25f ? dc : 3.0f * dc) * log(1.0f - randSample0.y);
+
+	float3 pdf = (float3)(
+			subsurfaceProfilePdf(d.x, r),
+			subsurfaceProfilePdf(d.y, r),
+			subsurfaceProfilePdf(d.z, r)
+	);
+	float avgPdf = (pdf.x + pdf.y + pdf.z) / 3.0f;
+	if( !(avgPdf > 0.0f) || !isfinite(r) ){
+		return (float3)(0.0f, 0.0f, 0.0f);
+	}
+
+	// Select a random tangent direction
+	float3 t, b;
+	surfaceGetTangentFrame(surface, &t, &b);
+	float phi = C_TWO_TIMES_PI * randSample1.y;
+	float3 dir = t * cos(phi) + b * sin(phi);
+
+	if( fabs(curvature) < SUBSURFACE_MIN_CURVATURE ){
+		surface->point += dir * r;
+	} else {
+		// Walk along the sphere and rotate the surface frame around
+		// k = n x dir so it stays aligned to the sphere
+		float angle = min(r * fabs(curvature), C_PI) * sign(curvature);
+		float sinA = sin(angle);
+		float cosA = cos(angle);
+		float3 k = cross(surface->normal, dir);
+
+		surface->point += dir * (sinA / curvature) - surface->normal * ((1.0f - cosA) / curvature);
+		surface->normal = normalize(surface->normal * cosA + cross(k, surface->normal) * sinA + k * dot(k, surface->normal) * (1.0f - cosA));
+		surface->geometricNormal = normalize(surface->geometricNormal * cosA + cross(k, surface->geometricNormal) * sinA + k * dot(k, surface->geometricNormal) * (1.0f - cosA));
+		surface->tangent = surface->tangent * cosA + cross(k, surface->tangent) * sinA + k * dot(k, surface->tangent) * (1.0f - cosA);
+	}
+
+	return pdf / avgPdf;
+}
+
+#endif
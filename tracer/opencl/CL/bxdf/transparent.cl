@@ -0,0 +1,24 @@
+#ifndef BXDF_TRANSPARENT_CL
+#define BXDF_TRANSPARENT_CL
+
+float3 transparentSample(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 *outRayDir, float *pdf);
+
+// Sample transparent bxdf. Unlike dielectrics, the transmitted ray passes 
+// straight through the surface without being refracted. Transparent surfaces
+// are typically mixed with an opaque bxdf using the material opacity as the 
+// mix weight to emulate alpha blending.
+//
+// BXDF = kt / cosI
+// PDF = 1
+float3 transparentSample(Surface *surface, MaterialNode *matNode, __global TextureMetadata *texMeta, __global uchar *texData, float3 inRayDir, float3 *outRayDir, float *pdf){
+	float iDotN = fabs(dot(inRayDir, surface->normal));
+
+	// inRayDir points *away* from the surface so we just need to flip it
+	*outRayDir = -inRayDir;
+	*pdf = 1.0f;
+
+	float3 kt = matGetSample3f(surface->uv, matNode->transmittance, matNode->transmittanceTex, texMeta, texData);
+	return iDotN != 0.0f ? kt / iDotN : 0.0f;
+}
+
+#endif
@@ -19,13 +19,21 @@
 #define C_SQRT2        1.41421356237309504880f  /* sqrt(2) */
 #define C_SQRT1_2      0.70710678118654752440f  /* 1/sqrt(2) */
 
-// Intersection constants
-#define INTERSECTION_EPSILON 0.00001f
-#define INTERSECTION_WITH_LIGHT_EPSILON (INTERSECTION_EPSILON * 1e3f)
+// Intersection constants. The intersection epsilon is derived from the scene
+// bounds by the host and passed to the kernels as an argument. As the
+// ray/triangle determinant scales with the square of the scene coordinates,
+// its threshold is derived from the squared epsilon so that scenes whose
+// coordinates span the unit range use a threshold of 1e-5.
+#define RELATIVE_INTERSECTION_EPSILON 0.00001f
+#define DETERMINANT_EPSILON(eps) ((eps) * (eps) / RELATIVE_INTERSECTION_EPSILON)
+#define INTERSECTION_WITH_LIGHT_EPSILON(eps) ((eps) * 1e3f)
 
 // GGX distribution explodes if roughness is set to 0 (microfacet bxdf)
 #define MIN_ROUGHNESS 0.1f
 
+// IOR textures encode IOR values linearly in the [1, MAX_TEXTURE_IOR] range
+#define MAX_TEXTURE_IOR 3.0f
+
 #ifndef NULL 
 #define NULL 0
 #endif
@@ -0,0 +1,65 @@
+#ifndef AOV_KERNEL_CL
+#define AOV_KERNEL_CL
+
+// Each AOV sample occupies 3 float3 slots: depth (stored in x), normal and albedo.
+#define AOV_SAMPLE_SLOTS 3
+
+// Accumulate depth, normal and albedo AOVs for primary ray intersections.
+// Misses contribute zero to all AOVs.
+__kernel void accumulateAovs(
+		__global Ray *rays,
+		__global const int *numRays,
+		__global Path *paths,
+		__global uint *hitFlags,
+		__global Intersection *intersections,
+		__global MeshInstance *meshInstances,
+		__global float4 *vertices,
+		__global float4 *normals,
+		__global float2 *uv,
+		// vertex tangents; only valid if hasTangents is set
+		__global float4 *tangents,
+		const uint hasTangents,
+		// vertex indices; only valid if indexed is set
+		__global uint *indices,
+		const uint indexed,
+		__global uint *materialIndices,
+		__global MaterialNode *materialNodes,
+		// texture data
+		__global TextureMetadata *texMeta,
+		__global uchar *texData,
+		// output
+		__global float3 *aovs
+		){
+
+	int globalId = get_global_id(0);
+	if(globalId >= *numRays){
+		return;
+	}
+
+	float hitDist = intersections[globalId].wuvt.w;
+	if(!hitFlags[globalId] || hitDist == FLT_MAX) {
+		return;
+	}
+
+	Surface surface;
+	surfaceInit(&surface, intersections + globalId, vertices, normals, uv, tangents, hasTangents, indices, indexed, materialIndices);
+
+	uint rayPathIndex;
+	float3 inRayDir = -rayGetDirAndPathIndex(rays + globalId, &rayPathIndex);
+
+	MaterialNode materialNode;
+	uint2 rndState = (uint2)(globalId, globalId);
+	float3 bxdfTint = (float3)(1.0f, 1.0f, 1.0f);
+	matSelectNode(paths + rayPathIndex, &surface, inRayDir, &materialNode, &bxdfTint, materialNodes, &rndState, texMeta, texData);
+
+	float3 albedo = BXDF_IS_EMISSIVE(materialNode.type)
+		? (float3)(0.0f, 0.0f, 0.0f)
+		: bxdfTint * meshInstances[intersections[globalId].meshInstance].tint.xyz * matGetSample3f(surface.uv, materialNode.reflectance, materialNode.reflectanceTex, texMeta, texData);
+
+	uint aovIndex = AOV_SAMPLE_SLOTS * paths[rayPathIndex].pixelIndex;
+	aovs[aovIndex] += (float3)(hitDist, 0.0f, 0.0f);
+	aovs[aovIndex + 1] += surface.normal;
+	aovs[aovIndex + 2] += albedo;
+}
+
+#endif
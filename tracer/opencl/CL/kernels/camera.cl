@@ -1,6 +1,45 @@
 #ifndef CAMERA_KERNEL_CL
 #define CAMERA_KERNEL_CL
 
+// Camera projections; these match the scene.Projection values
+#define PROJECTION_PERSPECTIVE     0
+#define PROJECTION_ORTHOGRAPHIC    1
+#define PROJECTION_EQUIRECTANGULAR 2
+#define PROJECTION_FISHEYE         3
+#define PROJECTION_PANINI          4
+
+// Map a point in projection space to a ray direction for panoramic projections.
+float3 panoramicRayDir(uint projection, float2 uv, float3 right, float3 up, float3 forward);
+
+float3 panoramicRayDir(uint projection, float2 uv, float3 right, float3 up, float3 forward){
+	switch(projection){
+		case PROJECTION_EQUIRECTANGULAR:
+			// uv contains the longitude and latitude of the ray
+			return normalize(cos(uv.y) * (sin(uv.x) * right + cos(uv.x) * forward) + sin(uv.y) * up);
+		case PROJECTION_FISHEYE:
+		{
+			// the distance from the frame center is the angle between the
+			// ray and the view direction
+			float theta = length(uv);
+			if( theta == 0.0f ){
+				return forward;
+			}
+			float3 radial = (uv.x * right + uv.y * up) / theta;
+			return normalize(sin(theta) * radial + cos(theta) * forward);
+		}
+		case PROJECTION_PANINI:
+		{
+			// invert the projection of the cylinder point at longitude phi
+			// and height h: u = 2 * tan(phi/2) and v = 2 * h / (1 + cos(phi))
+			float phi = 2.0f * atan(0.5f * uv.x);
+			float h = 0.5f * uv.y * (1.0f + cos(phi));
+			return normalize(sin(phi) * right + h * up + cos(phi) * forward);
+		}
+	}
+
+	return forward;
+}
+
 // Generate primary rays.
 __kernel void generatePrimaryRays(
 		__global Ray *rays, 
@@ -14,9 +53,31 @@ __kernel void generatePrimaryRays(
 		const float2 texelDims,
 		const uint blockY,
 		const uint blockH,
+		// the first column and width of the traced rows; these match the
+		// frame width unless a crop window is specified
+		const uint cropX,
+		const uint cropW,
 		const uint frameW,
 		const uint frameH,
-		const uint randSeed
+		const uint randSeed,
+		__global float2 *blueNoise,
+		const uint blueNoiseW,
+		const uint blueNoiseH,
+		const float2 frameSample,
+		// the lens right and up axes scaled by the aperture radius; both
+		// axes are zero for pinhole cameras
+		const float3 lensU,
+		const float3 lensV,
+		const float3 viewDir,
+		const float focalDistance,
+		// for orthographic projections, the frustrum contains the corner
+		// ray origin offsets from the eye position and all rays are parallel
+		// to the view direction. For panoramic projections, the frustrum
+		// contains the corner coordinates in projection space which are
+		// mapped to ray directions using the camera axes.
+		const uint projection,
+		const float3 cameraRight,
+		const float3 cameraUp
 		){
 
 	uint2 globalId;
@@ -24,35 +85,71 @@ __kernel void generatePrimaryRays(
 	globalId.y = get_global_id(1);
 
 	if(globalId.x == 0 && globalId.y == 0){
-		*numRays = frameW * blockH;
+		*numRays = cropW * blockH;
 	}
 
-	if( globalId.x < frameW && globalId.y < blockH ){
-		uint index = (globalId.y * frameW) + globalId.x;
-		uint pixelIndex = ((globalId.y + blockY) * frameW) + globalId.x;
+	if( globalId.x < cropW && globalId.y < blockH ){
+		// Pixel coordinates are always relative to the full frame
+		uint2 pixel = (uint2)(globalId.x + cropX, globalId.y + blockY);
+		uint index = (globalId.y * cropW) + globalId.x;
+		uint pixelIndex = (pixel.y * frameW) + pixel.x;
 
 		// Apply stratified sampling using a tent filter. This will wrap our
 		// random numbers in the [-1, 1] range. X and Y point to the top corner
 		// of the current texel so we need to add a bit of offset to get the coords
 		// into the [-0.5, 1.5] range.
-		uint2 rndState = globalId + randSeed;
-		float2 sample0 = randomGetSample2f(&rndState);
+		//
+		// If a blue-noise texture is available, the sample for each pixel is
+		// generated by rotating the per-pass frame sample by the (tiled)
+		// blue-noise texel for the pixel (Cranley-Patterson rotation).
+		float2 sample0;
+		uint2 rndState = pixel + randSeed;
+		if (blueNoiseW > 0) {
+			uint noiseIndex = (pixel.y % blueNoiseH) * blueNoiseW + (pixel.x % blueNoiseW);
+			sample0 = frameSample + blueNoise[noiseIndex];
+			sample0 -= floor(sample0);
+		} else {
+			sample0 = randomGetSample2f(&rndState);
+		}
 		float2 offset = (float2)(
 				sample0.x < 0.5f ? native_sqrt(2.0f * sample0.x) - 0.5f : 1.5f - native_sqrt(2.0f - 2.0f * sample0.x),
 				sample0.y < 0.5f ? native_sqrt(2.0f * sample0.y) - 0.5f : 1.5f - native_sqrt(2.0f - 2.0f * sample0.y)
 		);
-		float2 texel = ((float2)(globalId.x, globalId.y + blockY) + offset) * texelDims;
+		float2 texel = ((float2)(pixel.x, pixel.y) + offset) * texelDims;
 
 		// Get ray direction using trilinear interpolation
-		float4 dir = normalize(
-			mix(
-				mix(frustrumTL, frustrumBL, texel.y),
-				mix(frustrumTR, frustrumBR, texel.y),
-				texel.x
-			)
+		float4 dir = mix(
+			mix(frustrumTL, frustrumBL, texel.y),
+			mix(frustrumTR, frustrumBR, texel.y),
+			texel.x
 		);
 
-		rayNew(rays + index,  eyePos, dir.xyz, FLT_MAX, index);
+		if( projection == PROJECTION_ORTHOGRAPHIC ){
+			rayNew(rays + index, eyePos + dir.xyz, viewDir, FLT_MAX, index);
+			pathNew(paths + index, pixelIndex);
+			return;
+		} else if( projection != PROJECTION_PERSPECTIVE ){
+			rayNew(rays + index, eyePos, panoramicRayDir(projection, dir.xy, cameraRight, cameraUp, viewDir), FLT_MAX, index);
+			pathNew(paths + index, pixelIndex);
+			return;
+		}
+		dir = normalize(dir);
+
+		// Apply thin lens model: aim a ray from a uniformly sampled point
+		// on the lens disk towards the point where the pinhole ray
+		// intersects the focal plane.
+		float3 origin = eyePos;
+		if( any(lensU != 0.0f) ){
+			float2 lensSample = randomGetSample2f(&rndState);
+			float r = native_sqrt(lensSample.x);
+			float phi = 2.0f * C_PI * lensSample.y;
+			float3 lensOffset = lensU * (r * native_cos(phi)) + lensV * (r * native_sin(phi));
+
+			origin += lensOffset;
+			dir.xyz = normalize(dir.xyz * (focalDistance / dot(dir.xyz, viewDir)) - lensOffset);
+		}
+
+		rayNew(rays + index, origin, dir.xyz, FLT_MAX, index);
 		pathNew(paths + index, pixelIndex);
 	}
 }
@@ -57,6 +57,12 @@ __kernel void debugRayIntersectionNormals(
 		__global float4 *vertices,
 		__global float4 *normals,
 		__global float2 *uv,
+		// vertex tangents; only valid if hasTangents is set
+		__global float4 *tangents,
+		const uint hasTangents,
+		// vertex indices; only valid if indexed is set
+		__global uint *indices,
+		const uint indexed,
 		__global uint *materialIndices,
 		__global MaterialNode *materialNodes,
 		// texture data
@@ -81,7 +87,7 @@ __kernel void debugRayIntersectionNormals(
 	}
 
 	Surface surface;
-	surfaceInit(&surface, intersections + globalId, vertices, normals, uv, materialIndices);
+	surfaceInit(&surface, intersections + globalId, vertices, normals, uv, tangents, hasTangents, indices, indexed, materialIndices);
 
 	float3 inRayDir = -rays[globalId].dir.xyz;
 
@@ -27,4 +27,53 @@ __kernel void tonemapSimpleReinhard(
 					);
 		}
 
+// Get the LUT entry at the given lattice coordinates.
+#define LUT_ENTRY(lut, size, r, g, b) lut[((b) * (size) + (g)) * (size) + (r)].xyz
+
+// Grade the tone-mapped framebuffer using a 1D or 3D color lookup table. 1D
+// tables are linearly interpolated per channel while 3D tables are trilinearly
+// interpolated. The table entries are padded to float4.
+__kernel void applyColorLUT(
+	__global uchar4 *frameBuffer,
+	__global float4 *lut,
+	const uint lutDims,
+	const uint lutSize,
+	const float3 domainMin,
+	const float3 domainMax
+		){
+
+			int globalId = get_global_id(0);
+
+			// Map color to the [0, lutSize - 1] range
+			float3 color = convert_float3(frameBuffer[globalId].xyz) / 255.0f;
+			float maxCoord = (float)(lutSize - 1);
+			float3 coords = clamp((color - domainMin) / (domainMax - domainMin), 0.0f, 1.0f) * maxCoord;
+			uint3 i0 = min(convert_uint3(coords), (uint3)(lutSize - 1));
+			uint3 i1 = min(i0 + 1, (uint3)(lutSize - 1));
+			float3 frac = coords - convert_float3(i0);
+
+			float3 graded;
+			if (lutDims == 1) {
+				graded = (float3)(
+					mix(lut[i0.x].x, lut[i1.x].x, frac.x),
+					mix(lut[i0.y].y, lut[i1.y].y, frac.y),
+					mix(lut[i0.z].z, lut[i1.z].z, frac.z)
+				);
+			} else {
+				float3 c00 = mix(LUT_ENTRY(lut, lutSize, i0.x, i0.y, i0.z), LUT_ENTRY(lut, lutSize, i1.x, i0.y, i0.z), frac.x);
+				float3 c10 = mix(LUT_ENTRY(lut, lutSize, i0.x, i1.y, i0.z), LUT_ENTRY(lut, lutSize, i1.x, i1.y, i0.z), frac.x);
+				float3 c01 = mix(LUT_ENTRY(lut, lutSize, i0.x, i0.y, i1.z), LUT_ENTRY(lut, lutSize, i1.x, i0.y, i1.z), frac.x);
+				float3 c11 = mix(LUT_ENTRY(lut, lutSize, i0.x, i1.y, i1.z), LUT_ENTRY(lut, lutSize, i1.x, i1.y, i1.z), frac.x);
+				graded = mix(mix(c00, c10, frac.y), mix(c01, c11, frac.y), frac.z);
+			}
+
+			float3 normalizedOutput = clamp(graded, 0.0f, 1.0f) * 255.0f;
+			frameBuffer[globalId] = (uchar4)(
+					(uchar)normalizedOutput.r,
+					(uchar)normalizedOutput.g,
+					(uchar)normalizedOutput.b,
+					255 // alpha
+					);
+		}
+
 #endif
@@ -9,6 +9,7 @@
 #define BVH_TRIANGLE_INDEX(node) (-node.firstTriIndex.w)
 #define BVH_TRIANGLE_COUNT(node) (node.numTriangles.w)
 #define BVH_MESH_INSTANCE_ID(node) (-node.meshInstance.w)
+#define BVH_LAST_MESH_INSTANCE_ID(node) (-node.meshInstance.w - node.extraMeshInstances.w)
 
 #define RAY_PACKET_SIZE 64
 #define HALF_RAY_PACKET_SIZE RAY_PACKET_SIZE / 2
@@ -29,7 +30,11 @@ __kernel void rayIntersectionTest(
 		__global BvhNode* bvhNodes,
 		__global MeshInstance* meshInstances,
 		__global float4* vertexList,
-		__global int* hitFlag
+		// vertex indices; only valid if indexed is set
+		__global uint* indices,
+		const uint indexed,
+		__global int* hitFlag,
+		const float intersectionEpsilon
 		){
 
 	int globalId = get_global_id(0);
@@ -42,7 +47,7 @@ __kernel void rayIntersectionTest(
 	uint nodeStack[BVH_MAX_STACK_SIZE];
 	BvhNode curNode;
 	BvhNode childNodes[2];
-	int meshInstanceId;
+	int meshInstanceId, lastMeshInstanceId;
 	MeshInstance meshInstance;
 
 	// triangle intersection vars
@@ -71,10 +76,13 @@ __kernel void rayIntersectionTest(
 		if(BVH_IS_LEAF(curNode)){
 			numTriangles = BVH_TRIANGLE_COUNT(curNode);
 
-			// If this is a top BVH leaf we need to load the mesh instance
-			// and transform all rays using its matrix.
-			if( numTriangles == 0 ){
+			// If this is a top BVH leaf we need to load its first mesh 
+			// instance and transform all rays using its matrix. Any 
+			// remaining leaf instances are visited after exiting the
+			// bottom BVH of the current instance.
+			if( numTriangles <= 0 ){
 				meshInstanceId = BVH_MESH_INSTANCE_ID(curNode);
+				lastMeshInstanceId = BVH_LAST_MESH_INSTANCE_ID(curNode);
 				meshInstance = meshInstances[meshInstanceId];
 
 				// Push bottom BVH root to the stack and keep a record
@@ -90,14 +98,14 @@ __kernel void rayIntersectionTest(
 				// Intersect with all triangles using the Moller-Trumbore algorithm
 				triStartIndex = BVH_TRIANGLE_INDEX(curNode);
 				for(int vIndex = triStartIndex * 3; vIndex < (triStartIndex + numTriangles)*3;vIndex+=3){
-					v0 = vertexList[vIndex].xyz;
-					edge01 = vertexList[vIndex+1].xyz - v0;
-					edge02 = vertexList[vIndex+2].xyz - v0;
+					v0 = vertexList[VERTEX_INDEX(indices, indexed, vIndex)].xyz;
+					edge01 = vertexList[VERTEX_INDEX(indices, indexed, vIndex+1)].xyz - v0;
+					edge02 = vertexList[VERTEX_INDEX(indices, indexed, vIndex+2)].xyz - v0;
 
 					float3 pVec = cross(ray.dir.xyz, edge02);
 					float det = dot(edge01, pVec);
 
-					if (fabs(det) < INTERSECTION_EPSILON){
+					if (fabs(det) < DETERMINANT_EPSILON(intersectionEpsilon)){
 						continue;
 					}
 
@@ -117,7 +125,7 @@ __kernel void rayIntersectionTest(
 					}
 
 					float t = dot(edge02, qVec) * invDet;
-					if (t > INTERSECTION_EPSILON && t < ray.origin.w){
+					if (t > intersectionEpsilon && t < ray.origin.w){
 						gotHit = 1;
 						stackIndex = -1;
 						break;
@@ -140,7 +148,7 @@ __kernel void rayIntersectionTest(
 			rmax = fmax(tmin, tmax);
 			minmax = fmin( fmin(rmax.x, rmax.y), rmax.z);
 			maxmin = fmax( fmax(rmin.x, rmin.y), rmin.z);
-			float lHitDist = minmax < 0 || maxmin > minmax ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
+			float lHitDist = minmax < 0 || maxmin > minmax + intersectionEpsilon ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
 
 			// Check for intersection with second child
 			tmin = (childNodes[1].minExtent.xyz - ray.origin.xyz) * invDir;
@@ -149,7 +157,7 @@ __kernel void rayIntersectionTest(
 			rmax = fmax(tmin, tmax);
 			minmax = fmin( fmin(rmax.x, rmax.y), rmax.z);
 			maxmin = fmax( fmax(rmin.x, rmin.y), rmin.z);
-			float rHitDist = minmax < 0 || maxmin > minmax ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
+			float rHitDist = minmax < 0 || maxmin > minmax + intersectionEpsilon ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
 
 			wantLeft = lHitDist < FLT_MAX ? 1 : 0;
 			wantRight = rHitDist < FLT_MAX ? 1 : 0;
@@ -165,7 +173,17 @@ __kernel void rayIntersectionTest(
 				// If we exited from a bottom bvh tree we need to restore our ray
 				ray.origin.xyz = origRayOrigin;
 				ray.dir.xyz = origRayDir;
-				meshBvhStackStartIndex = -1;
+
+				// If the top BVH leaf contains more mesh instances, push the
+				// bottom BVH root of the next instance and transform the ray
+				if( meshInstanceId < lastMeshInstanceId ){
+					meshInstance = meshInstances[++meshInstanceId];
+					nodeStack[stackIndex++] = meshInstance.bvhRoot;
+					ray.origin.xyz = mul4x1(ray.origin.xyz, meshInstance.transformMat0, meshInstance.transformMat1, meshInstance.transformMat2, meshInstance.transformMat3);
+					ray.dir.xyz = mul3x1(ray.dir.xyz, meshInstance.transformMat0.xyz, meshInstance.transformMat1.xyz, meshInstance.transformMat2.xyz);
+				} else {
+					meshBvhStackStartIndex = -1;
+				}
 			}
 
 			// Pop the next node off the stack
@@ -187,8 +205,12 @@ __kernel void rayIntersectionQuery(
 		__global BvhNode* bvhNodes,
 		__global MeshInstance* meshInstances,
 		__global float4* vertexList,
+		// vertex indices; only valid if indexed is set
+		__global uint* indices,
+		const uint indexed,
 		__global int* hitFlag,
-		__global Intersection* intersections
+		__global Intersection* intersections,
+		const float intersectionEpsilon
 		){
 
 	int globalId = get_global_id(0);
@@ -201,7 +223,7 @@ __kernel void rayIntersectionQuery(
 	uint nodeStack[BVH_MAX_STACK_SIZE];
 	BvhNode curNode;
 	BvhNode childNodes[2];
-	int meshInstanceId;
+	int meshInstanceId, lastMeshInstanceId;
 	MeshInstance meshInstance;
 
 	// triangle intersection vars
@@ -232,10 +254,13 @@ __kernel void rayIntersectionQuery(
 		if(BVH_IS_LEAF(curNode)){
 			numTriangles = BVH_TRIANGLE_COUNT(curNode);
 
-			// If this is a top BVH leaf we need to load the mesh instance
-			// and transform all rays using its matrix.
-			if( numTriangles == 0 ){
+			// If this is a top BVH leaf we need to load its first mesh 
+			// instance and transform all rays using its matrix. Any 
+			// remaining leaf instances are visited after exiting the
+			// bottom BVH of the current instance.
+			if( numTriangles <= 0 ){
 				meshInstanceId = BVH_MESH_INSTANCE_ID(curNode);
+				lastMeshInstanceId = BVH_LAST_MESH_INSTANCE_ID(curNode);
 				meshInstance = meshInstances[meshInstanceId];
 
 				// Push bottom BVH root to the stack and keep a record
@@ -251,14 +276,14 @@ __kernel void rayIntersectionQuery(
 				// Intersect with all triangles using the Moller-Trumbore algorithm
 				triStartIndex = BVH_TRIANGLE_INDEX(curNode);
 				for(int vIndex = triStartIndex * 3; vIndex < (triStartIndex + numTriangles)*3;vIndex+=3){
-					v0 = vertexList[vIndex].xyz;
-					edge01 = vertexList[vIndex+1].xyz - v0;
-					edge02 = vertexList[vIndex+2].xyz - v0;
+					v0 = vertexList[VERTEX_INDEX(indices, indexed, vIndex)].xyz;
+					edge01 = vertexList[VERTEX_INDEX(indices, indexed, vIndex+1)].xyz - v0;
+					edge02 = vertexList[VERTEX_INDEX(indices, indexed, vIndex+2)].xyz - v0;
 
 					float3 pVec = cross(ray.dir.xyz, edge02);
 					float det = dot(edge01, pVec);
 
-					if (fabs(det) < INTERSECTION_EPSILON){
+					if (fabs(det) < DETERMINANT_EPSILON(intersectionEpsilon)){
 						continue;
 					}
 
@@ -278,7 +303,7 @@ __kernel void rayIntersectionQuery(
 					}
 
 					float t = dot(edge02, qVec) * invDet;
-					if (t > INTERSECTION_EPSILON && t < intersection.wuvt.w){
+					if (t > intersectionEpsilon && t < intersection.wuvt.w){
 						intersection.wuvt = (float4)(
 								1.0f - (u+v),
 								u,
@@ -306,7 +331,7 @@ __kernel void rayIntersectionQuery(
 			rmax = fmax(tmin, tmax);
 			minmax = fmin( fmin(rmax.x, rmax.y), rmax.z);
 			maxmin = fmax( fmax(rmin.x, rmin.y), rmin.z);
-			float lHitDist = minmax < 0 || maxmin > minmax ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
+			float lHitDist = minmax < 0 || maxmin > minmax + intersectionEpsilon ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
 
 			// Check for intersection with second child
 			tmin = (childNodes[1].minExtent.xyz - ray.origin.xyz) * invDir;
@@ -315,7 +340,7 @@ __kernel void rayIntersectionQuery(
 			rmax = fmax(tmin, tmax);
 			minmax = fmin( fmin(rmax.x, rmax.y), rmax.z);
 			maxmin = fmax( fmax(rmin.x, rmin.y), rmin.z);
-			float rHitDist = minmax < 0 || maxmin > minmax ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
+			float rHitDist = minmax < 0 || maxmin > minmax + intersectionEpsilon ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
 
 			wantLeft = lHitDist < FLT_MAX ? 1 : 0;
 			wantRight = rHitDist < FLT_MAX ? 1 : 0;
@@ -331,7 +356,17 @@ __kernel void rayIntersectionQuery(
 				// If we exited from a bottom bvh tree we need to restore our ray
 				ray.origin.xyz = origRayOrigin;
 				ray.dir.xyz = origRayDir;
-				meshBvhStackStartIndex = -1;
+
+				// If the top BVH leaf contains more mesh instances, push the
+				// bottom BVH root of the next instance and transform the ray
+				if( meshInstanceId < lastMeshInstanceId ){
+					meshInstance = meshInstances[++meshInstanceId];
+					nodeStack[stackIndex++] = meshInstance.bvhRoot;
+					ray.origin.xyz = mul4x1(ray.origin.xyz, meshInstance.transformMat0, meshInstance.transformMat1, meshInstance.transformMat2, meshInstance.transformMat3);
+					ray.dir.xyz = mul3x1(ray.dir.xyz, meshInstance.transformMat0.xyz, meshInstance.transformMat1.xyz, meshInstance.transformMat2.xyz);
+				} else {
+					meshBvhStackStartIndex = -1;
+				}
 			}
 
 			// Pop the next node off the stack
@@ -356,8 +391,12 @@ __kernel void rayPacketIntersectionQuery(
 		__global BvhNode* bvhNodes,
 		__global MeshInstance* meshInstances,
 		__global float4* vertexList,
+		// vertex indices; only valid if indexed is set
+		__global uint* indices,
+		const uint indexed,
 		__global int* hitFlag,
-		__global Intersection* intersections
+		__global Intersection* intersections,
+		const float intersectionEpsilon
 		){
 
 	int globalId = get_global_id(0);
@@ -373,9 +412,13 @@ __kernel void rayPacketIntersectionQuery(
 	__local BvhNode curNode;
 	__local  BvhNode childNodes[2];
 	__local int scratchMemory[RAY_PACKET_SIZE];
-	__local int meshInstanceId;
+	__local int meshInstanceId, lastMeshInstanceId;
 	__local MeshInstance meshInstance;
 
+	// Set by thread 0 when all threads need to transform their rays using
+	// the next mesh instance of the current top BVH leaf
+	__local int nextMeshInstance;
+
 	// Shared triangle intersection vars
 	__local float3 vert[3];
 
@@ -400,6 +443,7 @@ __kernel void rayPacketIntersectionQuery(
 	if(localId == 0){
 		stackIndex = 0;
 		meshBvhStackStartIndex = -1;
+		nextMeshInstance = 0;
 		curNode = bvhNodes[0];
 	}
 	
@@ -409,11 +453,14 @@ __kernel void rayPacketIntersectionQuery(
 		if(BVH_IS_LEAF(curNode)){
 			numTriangles = BVH_TRIANGLE_COUNT(curNode);
 
-			// If this is a top BVH leaf we need to load the mesh instance
-			// and transform all rays using its matrix.
-			if( numTriangles == 0 ){
+			// If this is a top BVH leaf we need to load its first mesh 
+			// instance and transform all rays using its matrix. Any 
+			// remaining leaf instances are visited after exiting the
+			// bottom BVH of the current instance.
+			if( numTriangles <= 0 ){
 				if( localId == 0 ){
 					meshInstanceId = BVH_MESH_INSTANCE_ID(curNode);
+					lastMeshInstanceId = BVH_LAST_MESH_INSTANCE_ID(curNode);
 					meshInstance = meshInstances[meshInstanceId];
 
 					// Push bottom BVH root to the stack and keep a record
@@ -434,7 +481,7 @@ __kernel void rayPacketIntersectionQuery(
 				for(int vIndex = triStartIndex * 3; vIndex < (triStartIndex + numTriangles)*3;vIndex+=3){
 					// Fetch vertex data in parallel
 					if(localId < 3 ){
-						vert[localId] = vertexList[vIndex + localId].xyz;
+						vert[localId] = vertexList[VERTEX_INDEX(indices, indexed, vIndex + localId)].xyz;
 					}
 					barrier(CLK_LOCAL_MEM_FENCE);
 
@@ -443,7 +490,7 @@ __kernel void rayPacketIntersectionQuery(
 					float3 pVec = cross(ray.dir.xyz, edge02);
 					float det = dot(edge01, pVec);
 
-					if (fabs(det) >= INTERSECTION_EPSILON){
+					if (fabs(det) >= DETERMINANT_EPSILON(intersectionEpsilon)){
 						float invDet = native_recip(det);
 
 						// Calculate barycentric coords
@@ -457,7 +504,7 @@ __kernel void rayPacketIntersectionQuery(
 								u <= 1.0f && 
 								v >= 0.0f && 
 								u+v <= 1.0f && 
-								t > INTERSECTION_EPSILON && 
+								t > intersectionEpsilon && 
 								t < intersection.wuvt.w){
 							intersection.wuvt = (float4)(
 									1.0f - (u+v),
@@ -496,7 +543,7 @@ __kernel void rayPacketIntersectionQuery(
 			rmax = fmax(tmin, tmax);
 			minmax = fmin( fmin(rmax.x, rmax.y), rmax.z);
 			maxmin = fmax( fmax(rmin.x, rmin.y), rmin.z);
-			float lHitDist = minmax < 0 || maxmin > minmax ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
+			float lHitDist = minmax < 0 || maxmin > minmax + intersectionEpsilon ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
 
 			// Check for intersection with second child
 			tmin = (childNodes[1].minExtent.xyz - ray.origin.xyz) * invDir;
@@ -505,7 +552,7 @@ __kernel void rayPacketIntersectionQuery(
 			rmax = fmax(tmin, tmax);
 			minmax = fmin( fmin(rmax.x, rmax.y), rmax.z);
 			maxmin = fmax( fmax(rmin.x, rmin.y), rmin.z);
-			float rHitDist = minmax < 0 || maxmin > minmax ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
+			float rHitDist = minmax < 0 || maxmin > minmax + intersectionEpsilon ? FLT_MAX : (maxmin >= ray.origin.w ? FLT_MAX : maxmin);
 
 			// If scratchMemory[i] is TRUE then at least one ray wants to:
 			// [0] visit none of the nodes
@@ -544,6 +591,7 @@ __kernel void rayPacketIntersectionQuery(
 
 		// Thread 0 handles all stack operations
 		if( localId == 0 ){
+			nextMeshInstance = 0;
 			if( packetWantsLeft && packetWantsRight ){
 				// scratchMemory[0] sign indicates which node should we visit first
 				nodeStack[stackIndex++] = scratchMemory[0] < 1 ? BVH_RIGHT_CHILD(curNode) : BVH_LEFT_CHILD(curNode);
@@ -555,7 +603,17 @@ __kernel void rayPacketIntersectionQuery(
 					// If we exited from a bottom bvh tree we need to restore our ray
 					ray.origin.xyz = origRayOrigin;
 					ray.dir.xyz = origRayDir;
-					meshBvhStackStartIndex = -1;
+
+					// If the top BVH leaf contains more mesh instances, push
+					// the bottom BVH root of the next instance and signal
+					// the other threads to transform their rays
+					if( meshInstanceId < lastMeshInstanceId ){
+						meshInstance = meshInstances[++meshInstanceId];
+						nodeStack[stackIndex++] = meshInstance.bvhRoot;
+						nextMeshInstance = 1;
+					} else {
+						meshBvhStackStartIndex = -1;
+					}
 				}
 				
 				// Pop the next node off the stack
@@ -567,6 +625,12 @@ __kernel void rayPacketIntersectionQuery(
 
 		// Sync before next iteration
 		barrier(CLK_LOCAL_MEM_FENCE);
+
+		// Transform rays using the next mesh instance of the top BVH leaf
+		if( nextMeshInstance ){
+			ray.origin.xyz = mul4x1(origRayOrigin, meshInstance.transformMat0, meshInstance.transformMat1, meshInstance.transformMat2, meshInstance.transformMat3);
+			ray.dir.xyz = mul3x1(origRayDir, meshInstance.transformMat0.xyz, meshInstance.transformMat1.xyz, meshInstance.transformMat2.xyz);
+		}
 	}
 			
 	// Update hit flag
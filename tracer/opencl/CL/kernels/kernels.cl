@@ -6,6 +6,8 @@
 #include "intersect.cl"
 #include "pt_integrator.cl"
 #include "accumulator.cl"
+#include "aov.cl"
+#include "variance.cl"
 #include "debug.cl"
 
 #endif
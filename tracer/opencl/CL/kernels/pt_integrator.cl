@@ -3,7 +3,7 @@
 
 #define MAX_VEC3_COMPONENT(v) (max(v.x,max(v.y,v.z)))
 #define MIN_VEC3_COMPONENT(v) (min(v.x,min(v.y,v.z)))
-#define DISPLACE_BY_EPSILON(v,n) (v + n * INTERSECTION_EPSILON)
+#define DISPLACE_BY_EPSILON(v,n,eps) (v + n * (eps))
 
 #define BALANCE_HEURISTIC(a,b) a/(a+b)
 #define POWER_HEURISTIC(a,b) (a*a)/(a*a+b*b)
@@ -21,20 +21,43 @@ __kernel void shadeHits(
 		__global uint *hitFlags,
 		__global Intersection *intersections,
 		// scene data
+		__global MeshInstance *meshInstances,
+		// custom mesh instance attributes; see instanceGetAttribute
+		__global float *instanceAttributes,
 		__global float4 *vertices,
 		__global float4 *normals,
 		__global float2 *uv,
+		// vertex tangents; only valid if hasTangents is set
+		__global float4 *tangents,
+		const uint hasTangents,
+		// vertex indices; only valid if indexed is set
+		__global uint *indices,
+		const uint indexed,
 		__global uint *materialIndices,
 		__global MaterialNode *materialNodes,
 		__global Emissive *emissives,
 		const uint numEmissives,
+		// quantized per-primitive opacity; only valid if hasPrimitiveOpacity is set
+		__global uchar *primitiveOpacity,
+		const uint hasPrimitiveOpacity,
 		// texture data
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
 		// state
 		const uint bounce,
 		const uint minBouncesForRR,
+		const uint minBouncesForNEE,
 		const uint randSeed,
+		const float maxThroughput,
+		// set if all scene materials are diffuse/emissive
+		const uint allDiffuse,
+		// participating medium (xyz: albedo, w: extinction)
+		const float4 medium,
+		const float mediumG,
+		// background dome (x: radius, y: ground height)
+		const float4 dome,
+		// scene-relative intersection epsilon
+		const float intersectionEpsilon,
 		// occlusion rays and samples
 		__global Ray *occlusionRays,
 		volatile __global int *numOcclusionRays,
@@ -76,6 +99,7 @@ __kernel void shadeHits(
 		if( hitFlags[globalId] ){
 			bxdfPdf = 1.0f;
 			bxdfWeight = 1.0f;
+			emissivePdf = 0.0f;
 
 			// Init PRNG and generate required samples
 			uint2 rndState = (uint2)(randSeed, globalId);
@@ -89,13 +113,52 @@ __kernel void shadeHits(
 			float3 inRayDir = -rayGetDirAndPathIndex(rays + globalId, &rayPathIndex);
 			curPathThroughput = paths[rayPathIndex].throughput;
 
+			// Clamp throughput for this bounce depth if requested
+			float maxThroughputComponent = MAX_VEC3_COMPONENT(curPathThroughput);
+			if( maxThroughput > 0.0f && maxThroughputComponent > maxThroughput ){
+				curPathThroughput *= maxThroughput / maxThroughputComponent;
+			}
+
+			// Attenuate throughput by the medium transmittance along the
+			// incoming ray segment. The unattenuated throughput is used
+			// for estimating single scattering towards the light source.
+			float3 mediumThroughput = curPathThroughput;
+			float mediumTr = mediumTransmittance(medium.w, intersections[globalId].wuvt.w);
+			curPathThroughput *= mediumTr;
+
+			// The occlusion ray either estimates light in-scattered by the
+			// medium along the incoming ray segment (selected with probability
+			// 1 - mediumTr) or direct light at the surface.
+			bool scatterInMedium = medium.w > 0.0f && numEmissives > 0 && randomGetSample2f(&rndState).x < 1.0f - mediumTr;
+
 			// Fill surface data and calculate cos(n, inRay)
-			surfaceInit(&surface, intersections + globalId, vertices, normals, uv, materialIndices);
+			surfaceInit(&surface, intersections + globalId, vertices, normals, uv, tangents, hasTangents, indices, indexed, materialIndices);
 
 			// Select material
 			MaterialNode materialNode;
 			matSelectNode(paths + rayPathIndex, &surface, inRayDir, &materialNode, &bxdfTint, materialNodes, &rndState, texMeta, texData);
 
+			// Apply the mesh instance tint to the surface albedo
+			float3 instanceTint = meshInstances[intersections[globalId].meshInstance].tint.xyz;
+			bxdfTint *= instanceTint;
+
+			// Stochastically pass through primitives that are not fully
+			// opaque by replacing the selected node with a transparent bxdf.
+			// Rays that pass through are not tinted.
+			if( hasPrimitiveOpacity && randomGetSample2f(&rndState).x * 255.0f >= primitiveOpacity[intersections[globalId].triIndex] ){
+				materialNode.type = BXDF_TYPE_TRANSPARENT;
+				materialNode.transmittance = (float3)(1.0f, 1.0f, 1.0f);
+				materialNode.transmittanceTex = -1;
+				bxdfTint = (float3)(1.0f, 1.0f, 1.0f);
+				instanceTint = (float3)(1.0f, 1.0f, 1.0f);
+			}
+
+			// Diffuse surfaces hit by indirect bounces use their indirect reflectance
+			if( bounce > 0 && materialNode.type == BXDF_TYPE_DIFFUSE ){
+				materialNode.reflectance = materialNode.indirectReflectance;
+				materialNode.reflectanceTex = materialNode.indirectReflectanceTex;
+			}
+
 			float inRayDotNormal = dot(inRayDir, surface.normal);
 
 			// Check if we hit an emissive node. If so, we need to accumulate implicit
@@ -124,46 +187,81 @@ __kernel void shadeHits(
 				}
 
 				if( !rejectSample ){
-					// Get BXDF sample and generate outgoing ray based on surface BXDF
-					bxdfSample = bxdfGetSample(&surface, &materialNode, texMeta, texData, sample0, inRayDir, &bxdfOutRayDir, &bxdfPdf);
+					// Get BXDF sample and generate outgoing ray based on surface BXDF.
+					// If all scene materials are diffuse we can bypass the bxdf dispatcher.
+					bxdfSample = allDiffuse
+						? diffuseSample(&surface, &materialNode, texMeta, texData, sample0, &bxdfOutRayDir, &bxdfPdf)
+						: bxdfGetSample(&surface, &materialNode, texMeta, texData, sample0, inRayDir, &bxdfOutRayDir, &bxdfPdf);
 
 					// To calculate the origin for occlusion/indirect rays we displace the 
-					// surface hit point by a small epsilon along the normal to ensure that 
-					// we don't register an intersection with the same surface.  If this 
-					// material is refractive and we are hitting it from the outside we 
-					// need to ensure that the outgoing ray starts inside the surface.
-					float displaceDir = sign(dot(surface.normal, bxdfOutRayDir));
-					outBxdfRayOrigin = DISPLACE_BY_EPSILON(surface.point, surface.normal * displaceDir);
+					// surface hit point by a small epsilon along the geometric normal to 
+					// ensure that we don't register an intersection with the same surface.  
+					// If this material is refractive and we are hitting it from the outside 
+					// we need to ensure that the outgoing ray starts inside the surface.
+					float displaceDir = sign(dot(surface.geometricNormal, bxdfOutRayDir));
+					outBxdfRayOrigin = DISPLACE_BY_EPSILON(surface.point, surface.geometricNormal * displaceDir, intersectionEpsilon);
 					// The emissive ray always starts away from the surface. This allows us to shade BTDFs
-					outEmissiveRayOrigin = DISPLACE_BY_EPSILON(surface.point, surface.normal);
+					outEmissiveRayOrigin = DISPLACE_BY_EPSILON(surface.point, surface.geometricNormal, intersectionEpsilon);
+
+					// Subsurface scattering materials gather direct light at the
+					// point where light entering the surface near the hit point
+					// exits. This blurs direct lighting using the material diffusion
+					// profile while indirect lighting is gathered at the hit point.
+					Surface lightSurface = surface;
+					float3 scatterWeight = (float3)(1.0f, 1.0f, 1.0f);
+					if( materialNode.type == BXDF_TYPE_SUBSURFACE ){
+						float2 scatterSample0 = randomGetSample2f(&rndState);
+						float2 scatterSample1 = randomGetSample2f(&rndState);
+						float curvature = subsurfaceEstimateCurvature(vertices, normals, indices, indexed, intersections[globalId].triIndex);
+						scatterWeight = subsurfaceScatter(&lightSurface, &materialNode, texMeta, texData, curvature, scatterSample0, scatterSample1);
+						outEmissiveRayOrigin = DISPLACE_BY_EPSILON(lightSurface.point, lightSurface.geometricNormal, intersectionEpsilon);
+					}
 
-					// Select and sample emissive source
-					int emissiveIndex = numEmissives > 0 ? emissiveSelect(numEmissives, sample1.x, &emissiveSelectionPdf) : -1;
+					// Select and sample emissive source. Singular surfaces and paths
+					// below the min NEE depth only gather light via bxdf sampling.
+					bool sampleEmissives = !scatterInMedium && numEmissives > 0 && bounce >= minBouncesForNEE && !BXDF_IS_SINGULAR(materialNode.type);
+					int emissiveIndex = sampleEmissives ? emissiveSelect(numEmissives, sample1.x, &emissiveSelectionPdf) : -1;
 					if( emissiveIndex > -1 ){
-						emissiveSample = emissiveGetSample(&surface, emissives + emissiveIndex, vertices, normals, uv, materialNodes, texMeta, texData, sample1, &emissiveOutRayDir, &emissivePdf, &distToEmissive);
+						emissiveSample = emissiveGetSample(&lightSurface, emissives + emissiveIndex, vertices, normals, uv, indices, indexed, materialNodes, texMeta, texData, sample1, &emissiveOutRayDir, &emissivePdf, &distToEmissive);
 
 						// MIS: we already have a PDF for generating emissiveOutRayDir.
 						// Calculate a PDF for the BXDF sampler generating the same ray 
 						// and generate sampling weights using the power heuristic.
-						bxdfEmissivePdf = bxdfGetPdf(&surface, &materialNode, texMeta, texData, inRayDir, emissiveOutRayDir);
+						// Emissives that bxdf rays cannot hit get the full weight.
+						if( !EMISSIVE_IS_HITTABLE(emissives[emissiveIndex].type) ){
+							bxdfEmissivePdf = 0.0f;
+						} else {
+							bxdfEmissivePdf = allDiffuse
+								? diffusePdf(&lightSurface, &materialNode, emissiveOutRayDir)
+								: bxdfGetPdf(&lightSurface, &materialNode, texMeta, texData, inRayDir, emissiveOutRayDir);
+						}
 						emissiveWeight = POWER_HEURISTIC(emissivePdf, bxdfEmissivePdf);
 
 						// We use the same approach to calculate a weight for the BXDF sample by 
 						// calculating the PDF for the emissive sampler generating bxdfOutRayDir
-						emissiveBxdfPdf = emissiveGetPdf(&surface, emissives + emissiveIndex, vertices, normals, uv, materialNodes, texMeta, texData, bxdfOutRayDir);
+						emissiveBxdfPdf = emissiveGetPdf(&surface, emissives + emissiveIndex, vertices, normals, uv, indices, indexed, materialNodes, texMeta, texData, bxdfOutRayDir, intersectionEpsilon);
 						bxdfWeight = POWER_HEURISTIC(bxdfPdf, emissiveBxdfPdf);
 					}
 
 					// If we have a valid emissive sample allocate an occlusion ray.
-					float nDotEmissiveOutRay = max(0.0f, dot(surface.normal, emissiveOutRayDir));
+					float nDotEmissiveOutRay = max(0.0f, dot(lightSurface.normal, emissiveOutRayDir));
 					if( MAX_VEC3_COMPONENT(emissiveSample) > 0.0f && emissivePdf > 0.0f && nDotEmissiveOutRay > 0.0f){
-						bxdfEmissiveSample = bxdfEval(&surface, &materialNode, texMeta, texData, inRayDir, emissiveOutRayDir);
-						emissiveSample *= emissiveWeight * bxdfEmissiveSample * curPathThroughput * nDotEmissiveOutRay / (emissivePdf * emissiveSelectionPdf);
+						bxdfEmissiveSample = allDiffuse
+							? diffuseEval(&lightSurface, &materialNode, texMeta, texData, emissiveOutRayDir)
+							: bxdfEval(&lightSurface, &materialNode, texMeta, texData, inRayDir, emissiveOutRayDir);
+						emissiveSample *= emissiveWeight * bxdfEmissiveSample * scatterWeight * instanceTint * curPathThroughput * nDotEmissiveOutRay * (1.0f - surface.occlusion) / (emissivePdf * emissiveSelectionPdf);
+
+						// Attenuate the light sample along the occlusion ray segment
+						// and account for the probability of selecting the surface
+						// sample instead of the medium one.
+						if( medium.w > 0.0f ){
+							emissiveSample *= mediumTransmittance(medium.w, domeEmissiveDistance(outEmissiveRayOrigin, emissiveOutRayDir, distToEmissive, dome)) / mediumTr;
+						}
 						wgOcclusionRayIndex = MAX_VEC3_COMPONENT(emissiveSample) > 0.0f ? atomic_inc(&wgNumOcclusionRays) : -1;
 					}
 
 					// Disable bxdfWeight for singular surfaces (ideal mirror/dielectric)
-					if( BXDF_IS_SINGULAR(materialNode.type) ){
+					if( !allDiffuse && BXDF_IS_SINGULAR(materialNode.type) ){
 						bxdfWeight = 1.0f;
 					}
 
@@ -177,6 +275,35 @@ __kernel void shadeHits(
 					} 
 				} // if(!rejectSample)
 			} // if(BXDF_IS_EMISSIVE)
+
+			// Estimate single scattering along the incoming ray segment by
+			// sampling a scattering point proportionally to the medium
+			// transmittance and connecting it to an emissive. The
+			// transmittance up to the scattering point and the selection
+			// pdfs cancel out leaving the medium albedo as the weight.
+			if( scatterInMedium ){
+				float2 scatterSample = randomGetSample2f(&rndState);
+				Surface scatterSurface = surface;
+				scatterSurface.point = rays[globalId].origin.xyz - inRayDir * mediumSampleDistance(medium.w, mediumTr, scatterSample.x);
+
+				// Environment lights are sampled over the hemisphere around
+				// the surface normal so we randomly pick one of the two
+				// hemispheres around the incoming ray.
+				scatterSurface.normal = scatterSample.y < 0.5f ? inRayDir : -inRayDir;
+
+				int emissiveIndex = emissiveSelect(numEmissives, sample1.x, &emissiveSelectionPdf);
+				emissiveSample = emissiveGetSample(&scatterSurface, emissives + emissiveIndex, vertices, normals, uv, indices, indexed, materialNodes, texMeta, texData, sample1, &emissiveOutRayDir, &emissivePdf, &distToEmissive);
+				if( emissives[emissiveIndex].type == EMISSIVE_TYPE_ENVIRONMENT_LIGHT ){
+					emissivePdf *= 0.5f;
+				}
+
+				if( MAX_VEC3_COMPONENT(emissiveSample) > 0.0f && emissivePdf > 0.0f ){
+					float phase = mediumPhase(mediumG, dot(-emissiveOutRayDir, inRayDir));
+					outEmissiveRayOrigin = scatterSurface.point;
+					emissiveSample *= medium.xyz * phase * mediumThroughput * mediumTransmittance(medium.w, domeEmissiveDistance(outEmissiveRayOrigin, emissiveOutRayDir, distToEmissive, dome)) / (emissivePdf * emissiveSelectionPdf);
+					wgOcclusionRayIndex = MAX_VEC3_COMPONENT(emissiveSample) > 0.0f ? atomic_inc(&wgNumOcclusionRays) : -1;
+				}
+			}
 		} // if(hitFlags)
 	} // if(globalId < *numRays)
 
@@ -200,7 +327,7 @@ __kernel void shadeHits(
 	if( wgOcclusionRayIndex != -1 ){
 		wgOcclusionRayIndex += wgNumOcclusionRays;
 		emissiveSamples[wgOcclusionRayIndex] = emissiveSample;
-		rayNew(occlusionRays + wgOcclusionRayIndex, outEmissiveRayOrigin, emissiveOutRayDir, distToEmissive - INTERSECTION_WITH_LIGHT_EPSILON, rayPathIndex);
+		rayNew(occlusionRays + wgOcclusionRayIndex, outEmissiveRayOrigin, emissiveOutRayDir, distToEmissive - INTERSECTION_WITH_LIGHT_EPSILON(intersectionEpsilon), rayPathIndex);
 	}
 
 	// Emit indirect ray
@@ -218,6 +345,10 @@ __kernel void shadePrimaryRayMisses(
 		__global uint *hitFlags,
 		__global MaterialNode *materialNodes,
 		const uint sceneDiffuseMatNodeIndex,
+		// background dome projection (x: radius, y: ground height)
+		const float4 dome,
+		// participating medium extinction
+		const float mediumExtinction,
 		// Texture data
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
@@ -235,10 +366,15 @@ __kernel void shadePrimaryRayMisses(
 	// Just sample global env map or use scene bg color
 	MaterialNode matNode = materialNodes[sceneDiffuseMatNodeIndex];
 	uint rayPathIndex;
-	float2 uv = rayToLatLongUV(rayGetDirAndPathIndex(rays + globalId, &rayPathIndex));
+	float3 rayDir = rayGetDirAndPathIndex(rays + globalId, &rayPathIndex);
+	float2 uv = rayToLatLongUV(domeProjectRay(rays[globalId].origin.xyz, rayDir, dome));
+
+	// Attenuate the background by the medium transmittance up to the dome.
+	// Without a dome, the background lies outside the medium.
+	float mediumTr = mediumTransmittance(mediumExtinction, domeRayDistance(rays[globalId].origin.xyz, normalize(rayDir), dome));
 
 	float3 kd = matGetSample3f(uv, matNode.reflectance, matNode.reflectanceTex, texMeta, texData);
-	accumulator[paths[rayPathIndex].pixelIndex] += kd;
+	accumulator[paths[rayPathIndex].pixelIndex] += mediumTr * kd;
 }
 
 // Shade indirect ray misses by sampling the scene background.
@@ -249,6 +385,10 @@ __kernel void shadeIndirectRayMisses(
 		__global uint *hitFlags,
 		__global MaterialNode *materialNodes,
 		const uint sceneDiffuseMatNodeIndex,
+		// background dome projection (x: radius, y: ground height)
+		const float4 dome,
+		// participating medium extinction
+		const float mediumExtinction,
 		// Texture data
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
@@ -266,12 +406,17 @@ __kernel void shadeIndirectRayMisses(
 	// Just sample global env map or use scene bg color
 	MaterialNode matNode = materialNodes[sceneDiffuseMatNodeIndex];
 	uint rayPathIndex;
-	float2 uv = rayToLatLongUV(rayGetDirAndPathIndex(rays + globalId, &rayPathIndex));
+	float3 rayDir = rayGetDirAndPathIndex(rays + globalId, &rayPathIndex);
+	float2 uv = rayToLatLongUV(domeProjectRay(rays[globalId].origin.xyz, rayDir, dome));
+
+	// Attenuate the background by the medium transmittance up to the dome.
+	// Without a dome, the background lies outside the medium.
+	float mediumTr = mediumTransmittance(mediumExtinction, domeRayDistance(rays[globalId].origin.xyz, normalize(rayDir), dome));
 
 	// As this is an indirect ray we need to multiply the path throughput with the diffuse sample
 	// and accumulate that.
 	float3 kd = matGetSample3f(uv, matNode.reflectance, matNode.reflectanceTex, texMeta, texData);
-	accumulator[paths[rayPathIndex].pixelIndex] += paths[rayPathIndex].throughput * kd;
+	accumulator[paths[rayPathIndex].pixelIndex] += mediumTr * paths[rayPathIndex].throughput * kd;
 }
 
 // Accumulate emissive samples for emissive surfaces that are not occluded.
@@ -0,0 +1,52 @@
+#ifndef VARIANCE_KERNEL_CL
+#define VARIANCE_KERNEL_CL
+
+// Update the per-pixel Welford variance estimators with the luminance of the
+// sample that was added to the trace accumulator since the last invocation.
+// The snapshot buffer keeps a copy of the accumulator contents after the
+// previous sample. The estimator state is stored as (count, mean, M2).
+__kernel void accumulateVariance(
+		__global float3 *accumulator,
+		__global float3 *snapshot,
+		__global float3 *variance
+		){
+	int globalId = get_global_id(0);
+
+	float3 acc = accumulator[globalId];
+	float3 sample = acc - snapshot[globalId];
+	snapshot[globalId] = acc;
+
+	float lum = 0.2126f * sample.x + 0.7152f * sample.y + 0.0722f * sample.z;
+
+	float3 state = variance[globalId];
+	state.x += 1.0f;
+	float delta = lum - state.y;
+	state.y += delta / state.x;
+	state.z += delta * (lum - state.y);
+	variance[globalId] = state;
+}
+
+// Combine the trace variance estimators from another tracer with the primary
+// tracer's frame variance estimators using the parallel Welford algorithm.
+__kernel void aggregateVariance(
+		__global float3 *srcVariance,
+		__global float3 *dstVariance
+		){
+	int globalId = get_global_id(0);
+
+	float3 src = srcVariance[globalId];
+	if( src.x == 0.0f ){
+		return;
+	}
+
+	float3 dst = dstVariance[globalId];
+	float count = dst.x + src.x;
+	float delta = src.y - dst.y;
+	dstVariance[globalId] = (float3)(
+		count,
+		dst.y + delta * src.x / count,
+		dst.z + src.z + delta * delta * dst.x * src.x / count
+	);
+}
+
+#endif
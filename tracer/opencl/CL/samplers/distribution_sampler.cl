@@ -8,6 +8,12 @@ float3 ggxGetSample(float roughness, float3 inRayDir, float3 n, float2 randSampl
 float ggxGetReflectionPdf(float roughness, float3 inRayDir, float3 outRayDir, float3 n, float3 h);
 float ggxGetRefractionPdf(float roughness, float etaI, float etaT, float3 inRayDir, float3 outRayDir, float3 n, float3 h);
 float3 cosWeightedHemisphereGetSample(float3 normal, float2 randSample);
+float3 uniformConeGetSample(float3 axis, float oneMinusCosThetaMax, float2 randSample);
+float _ggxAnisoGetG1(float2 roughness, float3 v, float3 t, float3 b, float3 n, float3 m);
+float ggxAnisoGetG(float2 roughness, float3 inRayDir, float3 outRayDir, float3 t, float3 b, float3 n, float3 m);
+float ggxAnisoGetD(float2 roughness, float3 t, float3 b, float3 n, float3 m);
+float3 ggxAnisoGetSample(float2 roughness, float3 t, float3 b, float3 n, float2 randSample);
+float ggxAnisoGetReflectionPdf(float2 roughness, float3 inRayDir, float3 outRayDir, float3 t, float3 b, float3 n, float3 h);
 
 // See https://www.cs.cornell.edu/~srm/publications/EGSR07-btdf.pdf
 // for GGX distribution formulas
@@ -95,6 +101,74 @@ float ggxGetRefractionPdf(float roughness, float etaI, float etaT, float3 inRayD
 	return denom > 0.0f ? ggxGetD(roughness, n, h) * hDotN * oDotH * etaT * etaT / denom : 0.0f; 
 }
 
+// See http://jcgt.org/published/0003/02/03/paper.pdf for the anisotropic
+// GGX distribution formulas. The roughness vector contains the roughness
+// along the tangent (x) and the bi-tangent (y) directions.
+
+// Lambda(v) = (-1 + sqrt(1 + (ax^2 * vt^2 + ay^2 * vb^2) / vn^2)) / 2
+// G1(v, m) = 1 / (1 + Lambda(v))
+float _ggxAnisoGetG1(float2 roughness, float3 v, float3 t, float3 b, float3 n, float3 m){
+	float nDotV = dot(n,v);
+	float mDotV = dot(m,v);
+	if( nDotV * mDotV <= 0.0f ){
+		return 0.0f;
+	}
+
+	float tDotV = dot(t, v) * roughness.x;
+	float bDotV = dot(b, v) * roughness.y;
+	float aTanSq = (tDotV * tDotV + bDotV * bDotV) / (nDotV * nDotV);
+	return 2.0f / (1.0f + sqrt(1.0f + aTanSq));
+}
+
+// Use smith approximation for G:
+// G(l, v, h) = G1(l,h) * G1(v,h)
+float ggxAnisoGetG(float2 roughness, float3 inRayDir, float3 outRayDir, float3 t, float3 b, float3 n, float3 m){
+	return _ggxAnisoGetG1(roughness, inRayDir, t, b, n, m) * _ggxAnisoGetG1(roughness, outRayDir, t, b, n, m);
+}
+
+// D(m) = 1 / PI * ax * ay * ( (mt/ax)^2 + (mb/ay)^2 + mn^2 )^2
+float ggxAnisoGetD(float2 roughness, float3 t, float3 b, float3 n, float3 m){
+	float nDotM = dot(n, m);
+	if( nDotM <= 0.0f ){
+		return 0.0f;
+	}
+
+	float tDotM = dot(t, m) / roughness.x;
+	float bDotM = dot(b, m) / roughness.y;
+	float sum = tDotM * tDotM + bDotM * bDotM + nDotM * nDotM;
+	float denom = C_PI * roughness.x * roughness.y * sum * sum;
+	return denom > 0.0f ? (1.0f / denom) : 0.0f;
+}
+
+// Sample the anisotropic GGX distribution to generate a normal that will be
+// used for microfacet calculations.
+float3 ggxAnisoGetSample(float2 roughness, float3 t, float3 b, float3 n, float2 randSample){
+	// Select phi so that it follows the elliptical roughness profile:
+	// phi = atan( ay / ax * tan(2 * pi * randSample.y) )
+	float phi = atan2(roughness.y * native_sin(C_TWO_TIMES_PI * randSample.y), roughness.x * native_cos(C_TWO_TIMES_PI * randSample.y));
+	float cosPhi = native_cos(phi);
+	float sinPhi = native_sin(phi);
+
+	// Calculate the roughness along phi and use it to sample theta:
+	// tanTheta^2 = a^2 * randSample.x / (1 - randSample.x)
+	float invASq = (cosPhi * cosPhi) / (roughness.x * roughness.x) + (sinPhi * sinPhi) / (roughness.y * roughness.y);
+	float tanThetaSq = randSample.x / ((1.0f - randSample.x) * invASq);
+	float cosTheta = 1.0f / sqrt(1.0f + tanThetaSq);
+	float sinTheta = sqrt(max(0.0f, 1.0f - cosTheta * cosTheta));
+
+    // Project and rotate to get the halfway vector
+    return normalize(t * sinTheta * cosPhi + b * sinTheta * sinPhi + n * cosTheta);
+}
+
+float ggxAnisoGetReflectionPdf(float2 roughness, float3 inRayDir, float3 outRayDir, float3 t, float3 b, float3 n, float3 h) {
+	float nDotH = fabs(dot(n, h));
+	float oDotH = fabs(dot(outRayDir, h));
+
+	// pdf = D * hDotN / 4 * oDotH
+	float denom = 4.0f * oDotH;
+	return denom == 0.0f ? 0.0f : ggxAnisoGetD(roughness, t, b, n, h) * nDotH / denom; 
+}
+
 // Sample hemisphere direction using a cosine weighted distribution
 // 
 // PDF = cos(theta) / pi
@@ -111,4 +185,20 @@ float3 cosWeightedHemisphereGetSample(float3 normal, float2 randSample) {
 	return normalize(u * rd * native_cos(phi) + v * rd * native_sin(phi) + normal * native_sqrt(1 - randSample.x));
 }
 
+// Sample a direction uniformly within a cone around axis. The cone aperture is
+// specified as 1 - cos(thetaMax) to retain precision for narrow cones.
+//
+// PDF = 1 / (2 * pi * (1 - cos(thetaMax)))
+float3 uniformConeGetSample(float3 axis, float oneMinusCosThetaMax, float2 randSample) {
+	float cosTheta = 1.0f - randSample.x * oneMinusCosThetaMax;
+	float sinTheta = native_sqrt(max(0.0f, 1.0f - cosTheta * cosTheta));
+	float phi = C_TWO_TIMES_PI*randSample.y;
+
+	// Generate tangent, bi-tangent vectors
+	float3 u,v;
+	TANGENT_VECTORS(axis, u, v);
+
+	return normalize(u * sinTheta * native_cos(phi) + v * sinTheta * native_sin(phi) + axis * cosTheta);
+}
+
 #endif
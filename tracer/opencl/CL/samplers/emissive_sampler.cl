@@ -3,14 +3,21 @@
 
 #define EMISSIVE_TYPE_AREA_LIGHT 0
 #define EMISSIVE_TYPE_ENVIRONMENT_LIGHT 1
+#define EMISSIVE_TYPE_SPHERE_LIGHT 2
+
+// Sphere lights are not part of the scene geometry so bxdf sampled rays can
+// never reach them. Their samples are only generated by the emissive sampler
+// and must not be MIS-weighted against the bxdf sampler.
+#define EMISSIVE_IS_HITTABLE(type) ((type) != EMISSIVE_TYPE_SPHERE_LIGHT)
 
 float3 environmentLightGetSample( Surface *surface, __global Emissive *emissive, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *outRayDir, float *pdf, float *distToEmissive); 
 float environmentLightGetPdf( Surface *surface, __global Emissive *emissive, float3 outRayDir);
-float3 areaLightGetSample( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *outRayDir, float *pdf, float *distToEmissive);
-float areaLightGetPdf( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float3 outRayDir);
+float3 sphereLightGetSample( Surface *surface, __global Emissive *emissive, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *outRayDir, float *pdf, float *distToEmissive);
+float3 areaLightGetSample( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global uint *indices, const uint indexed, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *outRayDir, float *pdf, float *distToEmissive);
+float areaLightGetPdf( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global uint *indices, const uint indexed, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float3 outRayDir, float intersectionEpsilon);
 
-float3 emissiveGetSample( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *outRayDir, float *pdf, float *distToEmissive);
-float emissiveGetPdf( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float3 outRayDir);
+float3 emissiveGetSample( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global uint *indices, const uint indexed, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float2 randSample, float3 *outRayDir, float *pdf, float *distToEmissive);
+float emissiveGetPdf( Surface *surface, __global Emissive *emissive, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global uint *indices, const uint indexed, __global MaterialNode *materialNodes, __global TextureMetadata *texMeta, __global uchar *texData, float3 outRayDir, float intersectionEpsilon);
 uint emissiveSelect( const int numLights, float randSample, float *pdf);
 
 float3 environmentLightGetSample(
@@ -46,6 +53,63 @@ float environmentLightGetPdf(
 	return max(0.0f, dot(surface->normal, outRayDir) * C_1_PI);
 }
 
+// Generate an out ray direction towards a sphere light and return the light
+// radiance along it. Directions are sampled uniformly within the cone that
+// the sphere subtends at the surface point. Lights with a zero radius are
+// point lights whose samples follow a delta distribution.
+float3 sphereLightGetSample(
+		Surface *surface,
+		__global Emissive *emissive,
+		__global MaterialNode *materialNodes,
+		__global TextureMetadata *texMeta,
+		__global uchar *texData,
+		float2 randSample,
+		float3 *outRayDir,
+		float *pdf,
+		float *distToEmissive
+		){
+
+	// The emissive transform maps the unit sphere to the light sphere
+	float3 center = emissive->transformMat3.xyz;
+	float radius = emissive->transformMat0.x;
+
+	MaterialNode matNode = materialNodes[emissive->matNodeIndex];
+	float3 intensity = matNode.scale * matGetSample3f((float2)(0.0f, 0.0f), matNode.radiance, matNode.radianceTex, texMeta, texData);
+
+	float3 toCenter = center - surface->point;
+	float squaredDistToCenter = dot(toCenter, toCenter);
+	float squaredRadius = radius * radius;
+	if( squaredDistToCenter <= squaredRadius ){
+		*pdf = 0.0f;
+		return (float3)(0.0f, 0.0f, 0.0f);
+	}
+
+	float distToCenter = native_sqrt(squaredDistToCenter);
+	float3 axis = toCenter / distToCenter;
+	if( radius == 0.0f ){
+		*outRayDir = axis;
+		*distToEmissive = distToCenter;
+		*pdf = 1.0f;
+		return intensity / squaredDistToCenter;
+	}
+
+	// Calculate 1 - cos(thetaMax) as sin^2(thetaMax) / (1 + cos(thetaMax))
+	// to avoid cancellation for small or distant lights.
+	float sinThetaMaxSq = squaredRadius / squaredDistToCenter;
+	float oneMinusCosThetaMax = sinThetaMaxSq / (1.0f + native_sqrt(1.0f - sinThetaMaxSq));
+
+	*outRayDir = uniformConeGetSample(axis, oneMinusCosThetaMax, randSample);
+	*pdf = native_recip(C_TWO_TIMES_PI * oneMinusCosThetaMax);
+
+	// Distance to the near intersection of the sampled ray with the sphere
+	float proj = dot(toCenter, *outRayDir);
+	*distToEmissive = proj - native_sqrt(max(0.0f, squaredRadius - (squaredDistToCenter - proj * proj)));
+
+	// The sphere surface emits uniform radiance so that the light has the
+	// same intensity as a point light when viewed from afar: I = L * pi * r^2
+	return intensity * native_recip(C_PI * squaredRadius);
+}
+
 // Generate a out ray direction towards a random point on the emissive primitive
 // and return a emission material sample from that point.
 float3 areaLightGetSample(
@@ -54,6 +118,8 @@ float3 areaLightGetSample(
 		__global float4 *vertices, 
 		__global float4 *normals,
 		__global float2 *uv,
+		__global uint *indices,
+		const uint indexed,
 		__global MaterialNode *materialNodes,
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
@@ -69,9 +135,12 @@ float3 areaLightGetSample(
 	float rv = randSample.y * r1sqrt;
 	float3 wuv = (float3)(1.0f - ru - rv, ru, rv);
 	int offset = emissive->triIndex * 3;
+	uint i0 = VERTEX_INDEX(indices, indexed, offset);
+	uint i1 = VERTEX_INDEX(indices, indexed, offset+1);
+	uint i2 = VERTEX_INDEX(indices, indexed, offset+2);
 
 	float3 emissivePoint = mul4x1(
-			(wuv.x * vertices[offset] + wuv.y * vertices[offset+1] + wuv.z * vertices[offset+2]).xyz,
+			(wuv.x * vertices[i0] + wuv.y * vertices[i1] + wuv.z * vertices[i2]).xyz,
 			emissive->transformMat0,
 			emissive->transformMat1,
 			emissive->transformMat2,
@@ -79,16 +148,16 @@ float3 areaLightGetSample(
 			);
 
 	float3 emissiveNormal = mul4x1(
-			(wuv.x * normals[offset] + wuv.y * normals[offset+1] + wuv.z * normals[offset+2]).xyz,
+			(wuv.x * normals[i0] + wuv.y * normals[i1] + wuv.z * normals[i2]).xyz,
 			emissive->transformMat0,
 			emissive->transformMat1,
 			emissive->transformMat2,
 			emissive->transformMat3
 			);
 
-	float2 emissiveUV = wuv.x * uv[offset] + 
-		wuv.y * uv[offset+1] + 
-		wuv.z * uv[offset+2];
+	float2 emissiveUV = wuv.x * uv[i0] + 
+		wuv.y * uv[i1] + 
+		wuv.z * uv[i2];
 
 
 	MaterialNode matNode = materialNodes[emissive->matNodeIndex];
@@ -120,18 +189,21 @@ float areaLightGetPdf(
 		__global float4 *vertices, 
 		__global float4 *normals,
 		__global float2 *uv,
+		__global uint *indices,
+		const uint indexed,
 		__global MaterialNode *materialNodes,
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
-		float3 outRayDir
+		float3 outRayDir,
+		float intersectionEpsilon
 		){
 
 	// Transform vertices to world space and check for ray/tri intersection
 	// using Moller-Trumbore algorithm
 	int offset = emissive->triIndex * 3;
-	float3 v0 = vertices[offset].xyz;
-	float3 edge01 = vertices[offset+1].xyz - v0;
-	float3 edge02 = vertices[offset+2].xyz - v0;
+	float3 v0 = vertices[VERTEX_INDEX(indices, indexed, offset)].xyz;
+	float3 edge01 = vertices[VERTEX_INDEX(indices, indexed, offset+1)].xyz - v0;
+	float3 edge02 = vertices[VERTEX_INDEX(indices, indexed, offset+2)].xyz - v0;
 
 	v0 = mul4x1(v0, emissive->transformMat0, emissive->transformMat1, emissive->transformMat2, emissive->transformMat3);
 	edge01 = mul4x1(edge01, emissive->transformMat0, emissive->transformMat1, emissive->transformMat2, emissive->transformMat3);
@@ -140,7 +212,7 @@ float areaLightGetPdf(
 	float3 pVec = cross(outRayDir, edge02);
 	float det = dot(edge01, pVec);
 
-	if (fabs(det) < INTERSECTION_EPSILON){
+	if (fabs(det) < DETERMINANT_EPSILON(intersectionEpsilon)){
 		return 0.0f;
 	}
 
@@ -160,7 +232,7 @@ float areaLightGetPdf(
 	}
 
 	float t = dot(edge02, qVec) * invDet;
-	if (t < INTERSECTION_EPSILON){
+	if (t < intersectionEpsilon){
 		return 0.0f;
 	}
 
@@ -181,6 +253,8 @@ float3 emissiveGetSample(
 		__global float4 *vertices, 
 		__global float4 *normals,
 		__global float2 *uv,
+		__global uint *indices,
+		const uint indexed,
 		__global MaterialNode *materialNodes,
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
@@ -192,9 +266,11 @@ float3 emissiveGetSample(
 
 	switch( emissive->type ){
 		case EMISSIVE_TYPE_AREA_LIGHT:
-			return areaLightGetSample(surface, emissive, vertices, normals, uv, materialNodes, texMeta, texData, randSample, outRayDir, pdf, distToEmissive);
+			return areaLightGetSample(surface, emissive, vertices, normals, uv, indices, indexed, materialNodes, texMeta, texData, randSample, outRayDir, pdf, distToEmissive);
 		case EMISSIVE_TYPE_ENVIRONMENT_LIGHT:
 			return environmentLightGetSample(surface, emissive, materialNodes, texMeta, texData, randSample, outRayDir, pdf, distToEmissive);
+		case EMISSIVE_TYPE_SPHERE_LIGHT:
+			return sphereLightGetSample(surface, emissive, materialNodes, texMeta, texData, randSample, outRayDir, pdf, distToEmissive);
 	}
 	return (float3)(0.0f, 0.0f, 0.0f);
 }
@@ -207,17 +283,23 @@ float emissiveGetPdf(
 		__global float4 *vertices, 
 		__global float4 *normals,
 		__global float2 *uv,
+		__global uint *indices,
+		const uint indexed,
 		__global MaterialNode *materialNodes,
 		__global TextureMetadata *texMeta,
 		__global uchar *texData,
-		float3 outRayDir
+		float3 outRayDir,
+		float intersectionEpsilon
 		){
 
 	switch( emissive->type ){
 		case EMISSIVE_TYPE_AREA_LIGHT:
-			return areaLightGetPdf(surface, emissive, vertices, normals, uv, materialNodes, texMeta, texData, outRayDir);
+			return areaLightGetPdf(surface, emissive, vertices, normals, uv, indices, indexed, materialNodes, texMeta, texData, outRayDir, intersectionEpsilon);
 		case EMISSIVE_TYPE_ENVIRONMENT_LIGHT:
 			return environmentLightGetPdf(surface, emissive, outRayDir);
+		case EMISSIVE_TYPE_SPHERE_LIGHT:
+			// Bxdf sampled rays never reach sphere lights
+			return 0.0f;
 	}
 
 	return 0.0f;
@@ -6,7 +6,9 @@
 #define MAT_OP_BUMP_MAP   10003
 #define MAT_OP_NORMAL_MAP 10004
 #define MAT_OP_DISPERSE   10005
+#define MAT_OP_FRESNEL_BLEND 10006
 #define MAT_NODE_IS_OP(node) (node->type >= MAT_OP_MIX)
+#define MAT_NORMAL_MAP_FLAT_BASE 1
 #ifndef BXDF_INVALID
 	#define BXDF_INVALID 0
 #endif
@@ -15,7 +17,7 @@ void matSelectNode(__global Path *path, Surface *surface, float3 inRayDir, Mater
 float3 matGetSample3f(float2 uv, float3 defaultValue, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData);
 float matGetSample1f(float2 uv, float defaultValue, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData);
 float3 matGetBumpSample3f(float3 normal, float2 uv, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData);
-float3 matGetNormalSample3f(float3 normal, float2 uv, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData);
+float3 matGetNormalSample3f(Surface *surface, float3 normal, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData);
 
 // Traverse the layered material tree for this surface and select a leaf node
 void matSelectNode(__global Path *path, Surface *surface, float3 inRayDir, MaterialNode *selectedMaterial, float3 *tint, __global MaterialNode* materialNodes, uint2 *rndState, __global TextureMetadata *texMeta, __global uchar *texData ){
@@ -26,9 +28,14 @@ void matSelectNode(__global Path *path, Surface *surface, float3 inRayDir, Mater
 	while(MAT_NODE_IS_OP(node)) {
 		switch(node->type){
 			case MAT_OP_MIX: 
-				// Depending on the sample, follow left or right
+				// Depending on the sample, follow left or right. If the node
+				// defines a weight texture, use it to modulate the mix weight
 				sample = randomGetSample2f(rndState);
-				node = materialNodes + (sample.x < node->mixWeight ? node->leftChild : node->rightChild);
+				sample.y = node->mixWeight;
+				if( node->mixWeightsTex != -1 ){
+					sample.y *= texGetSample1f(surface->uv, node->mixWeightsTex, texMeta, texData);
+				}
+				node = materialNodes + (sample.x < sample.y ? node->leftChild : node->rightChild);
 				break;
 			case MAT_OP_MIX_MAP: 
 				// Sample weight from texture
@@ -41,7 +48,13 @@ void matSelectNode(__global Path *path, Surface *surface, float3 inRayDir, Mater
 				node = materialNodes + node->leftChild;
 				break;
 			case MAT_OP_NORMAL_MAP:
-				surface->normal = matGetNormalSample3f(surface->normal, surface->uv, node->bumpTex, texMeta, texData);
+				// Perturb the geometric normal instead of the interpolated
+				// vertex normals if the node is flagged to use a flat base
+				surface->normal = matGetNormalSample3f(
+					surface,
+					node->normalMapBase == MAT_NORMAL_MAP_FLAT_BASE ? surface->geometricNormal : surface->normal,
+					node->bumpTex, texMeta, texData
+				);
 				node = materialNodes + node->leftChild;
 				break;
 			case MAT_OP_DISPERSE:
@@ -77,11 +90,27 @@ void matSelectNode(__global Path *path, Surface *surface, float3 inRayDir, Mater
 				}
 				node = materialNodes + node->leftChild;
 				break;
+			case MAT_OP_FRESNEL_BLEND:
+				// Select the coat (left) with a probability equal to the
+				// fresnel reflectance for the incoming ray and the base
+				// (right) otherwise
+				sample = randomGetSample2f(rndState);
+				sample.y = fresnelForDielectric(node->extIOR, node->intIOR, dot(inRayDir, surface->normal));
+				node = materialNodes + (sample.x < sample.y ? node->leftChild : node->rightChild);
+				break;
 		}
 	}
 
 	*selectedMaterial = *node;
 
+	// Sample spatially varying IORs
+	if( selectedMaterial->intIORTex != -1 ){
+		selectedMaterial->intIOR = 1.0f + texGetSample1f(surface->uv, selectedMaterial->intIORTex, texMeta, texData) * (MAX_TEXTURE_IOR - 1.0f);
+	}
+	if( selectedMaterial->extIORTex != -1 ){
+		selectedMaterial->extIOR = 1.0f + texGetSample1f(surface->uv, selectedMaterial->extIORTex, texMeta, texData) * (MAX_TEXTURE_IOR - 1.0f);
+	}
+
 	// Apply dispersion IORs
 	selectedMaterial->intIOR = max(selectedMaterial->intIOR, forceIOR.x);
 	selectedMaterial->extIOR = max(selectedMaterial->extIOR, forceIOR.y);
@@ -108,15 +137,15 @@ float matGetSample1f(float2 uv, float defaultValue, int texIndex, __global Textu
 }
 
 // Apply normal map to intersection normal.
-float3 matGetNormalSample3f(float3 normal, float2 uv, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData){
-	// Generate tangent, bi-tangent vectors
+float3 matGetNormalSample3f(Surface *surface, float3 normal, int texIndex, __global TextureMetadata *texMeta, __global uchar* texData){
+	// Get the tangent, bi-tangent vectors around the base normal
 	float3 u,v;
-	TANGENT_VECTORS(normal, u, v);
+	surfaceGetTangentFrameForNormal(surface, normal, &u, &v);
 
 	// Sample normal map and convert it into the [-1, 1] range. 
 	// R, G components encode the range [-1, 1] into a value [0, 255]
 	// B component encodes the range [0, 1] into [128, 255]
-	float3 sample = (texGetSample3f( uv, texIndex, texMeta, texData ) * 2.0f) - 1.0f;
+	float3 sample = (texGetSample3f( surface->uv, texIndex, texMeta, texData ) * 2.0f) - 1.0f;
 	return normalize(u * sample.x + v * sample.y + 0.5f * normal * sample.z);
 }
 
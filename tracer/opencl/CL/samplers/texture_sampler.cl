@@ -5,21 +5,90 @@
 #define TEX_FMT_LUMINANCE32F 1
 #define TEX_FMT_RGBA8 2
 #define TEX_FMT_RGBA32F 3
+#define TEX_FMT_UDIM 4
+#define TEX_FMT_NON_RESIDENT 5
 
+#define TEX_WRAP_REPEAT 0
+#define TEX_WRAP_CLAMP 1
+#define TEX_WRAP_MIRROR 2
+
+// The number of UDIM tile columns.
+#define UDIM_TILE_COLUMNS 10
+
+float2 texWrapUV(float2 uv, uint wrapMode);
+float3 texSRGBToLinear(float3 color);
+int texResolveUdimTile(float2 *uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data);
 float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data);
 float texGetSample1f(float2 uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data);
 float3 texGetBumpSample3f(float2 uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data);
 
+// Map uv coordinates to the [0, 1] range using the given texture wrap mode.
+float2 texWrapUV(float2 uv, uint wrapMode) {
+	switch(wrapMode){
+		case TEX_WRAP_CLAMP:
+			return clamp(uv, 0.0f, 1.0f);
+		case TEX_WRAP_MIRROR:
+		{
+			float2 period = uv - 2.0f * floor(0.5f * uv);
+			return select(period, 2.0f - period, period > 1.0f);
+		}
+	}
+
+	// Keep the fractional part of uv for repeating textures
+	return uv - floor(uv);
+}
+
+// Convert sRGB encoded color values to linear space.
+float3 texSRGBToLinear(float3 color) {
+	return select(
+		pow((color + 0.055f) / 1.055f, (float3)(2.4f)),
+		color / 12.92f,
+		isless(color, (float3)(0.04045f))
+	);
+}
+
+// If texIndex refers to a UDIM texture, select the tile texture for the integer
+// part of the uv coordinates and convert uv to tile-local coordinates. The
+// selected textures are flagged as sampled. Returns the texture index to sample
+// or -1 if the uv coordinates map to a missing or non-resident texture.
+int texResolveUdimTile(float2 *uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data) {
+	metadata[texIndex].sampled = 1;
+	if( metadata[texIndex].format == TEX_FMT_NON_RESIDENT ){
+		return -1;
+	} else if( metadata[texIndex].format != TEX_FMT_UDIM ){
+		return texIndex;
+	}
+
+	float2 tile = floor(*uv);
+	if( tile.x < 0.0f || tile.y < 0.0f || tile.x >= (float)metadata[texIndex].width || tile.y >= (float)metadata[texIndex].height ){
+		return -1;
+	}
+
+	*uv -= tile;
+	const __global int* tilePtr = (__global const int*)(data + metadata[texIndex].dataOffset);
+	int tileIndex = tilePtr[(uint)tile.y * metadata[texIndex].width + (uint)tile.x];
+	if( tileIndex < 0 ){
+		return -1;
+	}
+
+	metadata[tileIndex].sampled = 1;
+	return metadata[tileIndex].format == TEX_FMT_NON_RESIDENT ? -1 : tileIndex;
+}
+
 // Sample texture at given uv coordinates returning back a float3 vector
 float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data) {
+	texIndex = texResolveUdimTile(&uv, texIndex, metadata, data);
+	if( texIndex < 0 ){
+		return (float3)(0.0f, 0.0f, 0.0f);
+	}
+
 	uint2 texDims = (uint2)(
 			metadata[texIndex].width,
 			metadata[texIndex].height
 	);
 
-	// Handle repeating textures by keeping the fractional part of uv and
-	// scale to [0, texDims) range
-	float2 scaledUV = uv - floor(uv);
+	// Apply the texture wrap mode and scale to [0, texDims) range
+	float2 scaledUV = texWrapUV(uv, metadata[texIndex].wrapMode);
 	scaledUV.x *= (float)texDims.x;
 	scaledUV.y *= (float)texDims.y;
 
@@ -35,6 +104,7 @@ float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadat
 
 	__global uchar* basePtr = data + metadata[texIndex].dataOffset;
 
+	float3 sample = (float3)(0.0f, 0.0f, 0.0f);
 	switch(metadata[texIndex].format){
 		case TEX_FMT_RGBA8:
 		{
@@ -45,11 +115,12 @@ float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadat
 			float4 rgbBL = convert_float4(vecPtr[(by * texDims.x) + tx]);
 			float4 rgbBR = convert_float4(vecPtr[(by * texDims.x) + bx]);
 
-			return mix(
+			sample = mix(
 					mix(rgbTL, rgbBL, coeffY),
 					mix(rgbTR, rgbBR, coeffY),
 					coeffX
 			).xyz / 255.0f;
+			break;
 		}
 		case TEX_FMT_RGBA32F:
 		{
@@ -60,11 +131,12 @@ float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadat
 			float4 rgbBL = vecPtr[(by * texDims.x) + tx];
 			float4 rgbBR = vecPtr[(by * texDims.x) + bx];
 
-			return mix(
+			sample = mix(
 					mix(rgbTL, rgbBL, coeffY),
 					mix(rgbTR, rgbBR, coeffY),
 					coeffX
 			).xyz;
+			break;
 		}
 		case TEX_FMT_LUMINANCE8:
 		{
@@ -78,7 +150,8 @@ float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadat
 					coeffX
 			) / 255.0f;
 			
-			return (float3)(r,r,r);
+			sample = (float3)(r,r,r);
+			break;
 		}
 		case TEX_FMT_LUMINANCE32F:
 		{
@@ -93,24 +166,30 @@ float3 texGetSample3f(float2 uv, int texIndex, __global TextureMetadata *metadat
 					coeffX
 			);
 			
-			return (float3)(r,r,r);
+			sample = (float3)(r,r,r);
+			break;
 		}
 	}
 
-	return (float3)(0.0f, 0.0f, 0.0f);
+	// Linearize sRGB encoded textures that were not converted while baking
+	return metadata[texIndex].srgb ? texSRGBToLinear(sample) : sample;
 }
 
 // Sample texture at given uv coordinates returning back a float. For multi-channel
 // textures we only read from the red channel.
 float texGetSample1f(float2 uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data) {
+	texIndex = texResolveUdimTile(&uv, texIndex, metadata, data);
+	if( texIndex < 0 ){
+		return 0.0f;
+	}
+
 	uint2 texDims = (uint2)(
 			metadata[texIndex].width,
 			metadata[texIndex].height
 	);
 
-	// Handle repeating textures by keeping the fractional part of uv and
-	// scale to [0, texDims) range
-	float2 scaledUV = uv - floor(uv);
+	// Apply the texture wrap mode and scale to [0, texDims) range
+	float2 scaledUV = texWrapUV(uv, metadata[texIndex].wrapMode);
 	scaledUV.x *= (float)texDims.x;
 	scaledUV.y *= (float)texDims.y;
 
@@ -185,14 +264,18 @@ float texGetSample1f(float2 uv, int texIndex, __global TextureMetadata *metadata
 
 // Sample bump map texture at given uv coordinates returning back a float3 vector
 float3 texGetBumpSample3f(float2 uv, int texIndex, __global TextureMetadata *metadata, __global uchar* data) {
+	texIndex = texResolveUdimTile(&uv, texIndex, metadata, data);
+	if( texIndex < 0 ){
+		return (float3)(0.0f, 0.0f, 0.0f);
+	}
+
 	uint2 texDims = (uint2)(
 			metadata[texIndex].width,
 			metadata[texIndex].height
 	);
 
-	// Handle repeating textures by keeping the fractional part of uv and
-	// scale to [0, texDims) range
-	float2 scaledUV = uv - floor(uv);
+	// Apply the texture wrap mode and scale to [0, texDims) range
+	float2 scaledUV = texWrapUV(uv, metadata[texIndex].wrapMode);
 	scaledUV.x *= (float)texDims.x;
 	scaledUV.y *= (float)texDims.y;
 
@@ -46,6 +46,10 @@ typedef struct {
 
 		// The W coordinate points to the triangle count for this bottom-level BVH leaf
 		int4 numTriangles;
+
+		// The W coordinate contains the negated count of additional mesh
+		// instances for top-level BVH leafs
+		int4 extraMeshInstances;
 	};
 } BvhNode;
 
@@ -55,15 +59,18 @@ typedef struct {
 	// BVH root node index for mesh BVH
 	uint bvhRoot;
 
-	// padding
-	uint _reserved1;
-	uint _reserved2;
+	// offset and count of the custom instance attributes
+	uint attributeOffset;
+	uint attributeCount;
 
 	// inverted mesh transformation matrix for transforming rays to mesh space
 	float4 transformMat0;
 	float4 transformMat1;
 	float4 transformMat2;
 	float4 transformMat3;
+
+	// albedo tint (xyz)
+	float4 tint;
 } MeshInstance;
 
 typedef struct {
@@ -86,16 +93,44 @@ typedef struct {
 	// intersection point
 	float3 point;
 
-	// normal at intersection point
+	// interpolated shading normal at intersection point
 	float3 normal;
 
+	// geometric normal of the intersected triangle
+	float3 geometricNormal;
+
+	// tangent vector aligned to the direction of increasing u texture coords
+	float3 tangent;
+
+	// handedness of the tangent frame (bitangent = tangentSign * cross(normal, tangent))
+	float tangentSign;
+
 	// texture uv coords at intersection point
 	float2 uv;
 
 	// material node index
 	uint matNodeIndex;
+
+	// baked vertex ambient occlusion at intersection point (0 = unoccluded)
+	float occlusion;
 } Surface;
 
+// Get the index of a triangle vertex given its offset in the triangle vertex
+// list. Indexed scenes look up the vertex in the index list while non-indexed
+// scenes store 3 consecutive vertices per triangle.
+#define VERTEX_INDEX(indices, indexed, offset) ((indexed) ? (indices)[offset] : (offset))
+
+#define MAX_MIP_LEVELS 16
+
+typedef struct {
+	// offset relative to the start of the texture layer data
+	uint offset;
+
+	// level dimensions
+	uint width;
+	uint height;
+} MipLevel;
+
 typedef struct {
 	uint format;
 
@@ -105,6 +140,27 @@ typedef struct {
 
 	// start offset in texture data
 	uint dataOffset;
+
+	// number of texture array layers and distance in bytes between layers
+	uint layers;
+	uint layerStride;
+
+	// anisotropic filtering level hint
+	uint anisotropy;
+
+	// addressing mode for uv coordinates outside the [0, 1] range
+	uint wrapMode;
+
+	// non-zero if the color channels are sRGB encoded and must be linearized
+	uint srgb;
+
+	// mipmap level count and locations; level 0 is the full resolution texture
+	uint mipLevelCount;
+	MipLevel mipLevels[MAX_MIP_LEVELS];
+
+	// set by the samplers whenever the texture is sampled; used by the
+	// tracer for tracking texture residency
+	uint sampled;
 } TextureMetadata;
 
 typedef struct {
@@ -117,6 +173,9 @@ typedef struct {
 		uint rightChild;
 
 		int transmittanceTex;
+
+		// Normal map base flag for normal map nodes
+		int normalMapBase;
 	};
 
 	union {
@@ -127,12 +186,14 @@ typedef struct {
 		int reflectanceTex;
 		int specularityTex;
 		int radianceTex;
+		int scatterColorTex;
 	};
 
 	union {
 		float3 reflectance;
 		float3 specularity;
 		float3 radiance;
+		float3 scatterColor;
 		float3 intDispersionIORs;
 
 		// mix node
@@ -142,6 +203,15 @@ typedef struct {
 	union {
 		float3 transmittance;
 		float3 extDispersionIORs;
+
+		// reflectance for indirect bounces for diffuse bxdfs
+		float3 indirectReflectance;
+
+		// per-channel mean free path for subsurface bxdfs
+		float3 scatterRadius;
+
+		// bi-tangent roughness for anisotropic bxdfs
+		float roughnessV;
 	};
 
 	union {
@@ -156,12 +226,21 @@ typedef struct {
 		// Radiance scaler
 		float scale;
 
+		// roughness (tangent roughness for anisotropic bxdfs)
 		float roughness;
+
+		// scattering anisotropy for subsurface bxdfs
+		float scatterAnisotropy;
 	};
 
 	union {
 		int roughnessTex;
 	};
+
+	int intIORTex;
+	int extIORTex;
+	int indirectReflectanceTex;
+	int padding;
 } MaterialNode;
 
 typedef struct {
@@ -0,0 +1,54 @@
+#ifndef DOME_CL
+#define DOME_CL
+
+float domeRayDistance(float3 origin, float3 dir, float4 dome);
+float3 domeProjectRay(float3 origin, float3 dir, float4 dome);
+float domeEmissiveDistance(float3 origin, float3 dir, float distToEmissive, float4 dome);
+
+// Get the distance from the ray origin to the point where a ray with a
+// normalized direction exits the dome (dome.x: radius, dome.y: ground height).
+// If the dome is disabled or the ray origin lies outside the dome this
+// function returns 0.
+float domeRayDistance(float3 origin, float3 dir, float4 dome){
+	if( dome.x <= 0.0f ){
+		return 0.0f;
+	}
+
+	// Intersect ray with the dome sphere
+	float b = dot(origin, dir);
+	float c = dot(origin, origin) - dome.x * dome.x;
+	if( c > 0.0f ){
+		return 0.0f;
+	}
+	float t = -b + sqrt(b * b - c);
+
+	// If the sphere hit point lies below the ground, intersect the ground plane instead
+	if( dir.y < 0.0f && origin.y >= dome.y && origin.y + t * dir.y < dome.y ){
+		t = (dome.y - origin.y) / dir.y;
+	}
+
+	return t;
+}
+
+// Get the direction for sampling the scene background when the background is
+// projected onto a finite dome centered at the world origin (dome.x: radius,
+// dome.y: ground height). If the dome is disabled or the ray origin lies
+// outside the dome the ray direction is returned unchanged.
+float3 domeProjectRay(float3 origin, float3 dir, float4 dome){
+	dir = normalize(dir);
+	float t = domeRayDistance(origin, dir, dome);
+	if( t <= 0.0f ){
+		return dir;
+	}
+
+	return normalize(origin + t * dir);
+}
+
+// Get the distance to an emissive sample. Environment light samples lie at
+// infinity so the distance to the point where the ray exits the dome is
+// returned instead.
+float domeEmissiveDistance(float3 origin, float3 dir, float distToEmissive, float4 dome){
+	return distToEmissive < FLT_MAX ? distToEmissive : domeRayDistance(origin, dir, dome);
+}
+
+#endif
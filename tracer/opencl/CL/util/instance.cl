@@ -0,0 +1,13 @@
+#ifndef INSTANCE_CL
+#define INSTANCE_CL
+
+float instanceGetAttribute(__global MeshInstance *instance, __global float *instanceAttributes, uint index, float defaultValue);
+
+// Lookup a custom scalar attribute for a mesh instance. If the instance does
+// not define an attribute with the requested index, return the supplied default value.
+inline float instanceGetAttribute(__global MeshInstance *instance, __global float *instanceAttributes, uint index, float defaultValue){
+	return index < instance->attributeCount
+		? instanceAttributes[instance->attributeOffset + index]
+		: defaultValue;
+}
+#endif
@@ -0,0 +1,25 @@
+#ifndef MEDIUM_CL
+#define MEDIUM_CL
+
+float mediumTransmittance(float extinction, float dist);
+float mediumPhase(float g, float cosTheta);
+float mediumSampleDistance(float extinction, float segmentTr, float randSample);
+
+// Calculate the fraction of light transmitted through a homogeneous medium over dist.
+inline float mediumTransmittance(float extinction, float dist){
+	return extinction > 0.0f ? exp(-extinction * dist) : 1.0f;
+}
+
+// Evaluate the Henyey-Greenstein phase function.
+inline float mediumPhase(float g, float cosTheta){
+	float denom = 1.0f + g * g - 2.0f * g * cosTheta;
+	return (1.0f - g * g) / (4.0f * C_PI * denom * sqrt(denom));
+}
+
+// Sample a scattering distance along a ray segment with transmittance segmentTr
+// proportionally to the medium transmittance. The pdf of the returned distance
+// is extinction * mediumTransmittance(extinction, dist) / (1 - segmentTr).
+inline float mediumSampleDistance(float extinction, float segmentTr, float randSample){
+	return -log(1.0f - randSample * (1.0f - segmentTr)) / extinction;
+}
+#endif
@@ -5,33 +5,98 @@
 	u = normalize(cross((fabs(normal.z) < .999f ? (float3)(0.0f, 0.0f, 1.0f) : (float3)(1.0f, 0.0f, 0.0f)), normal)); \
 	v = cross(normal, u);
 
-void surfaceInit(Surface *surface, __global Intersection *intersection, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global uint *matIndices);
+void surfaceInit(Surface *surface, __global Intersection *intersection, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global float4 *tangents, const uint hasTangents, __global uint *indices, const uint indexed, __global uint *matIndices);
+void surfaceGetTangentFrame(Surface *surface, float3 *t, float3 *b);
+void surfaceGetTangentFrameForNormal(Surface *surface, float3 normal, float3 *t, float3 *b);
 void printSurface(Surface *surface);
 
 // Initialize surface parameters
-void surfaceInit(Surface *surface, __global Intersection *intersection, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global uint *matIndices){
+void surfaceInit(Surface *surface, __global Intersection *intersection, __global float4 *vertices, __global float4 *normals, __global float2 *uv, __global float4 *tangents, const uint hasTangents, __global uint *indices, const uint indexed, __global uint *matIndices){
 	float3 wuv = intersection->wuvt.xyz;
 	int offset = intersection->triIndex * 3;
+	uint i0 = VERTEX_INDEX(indices, indexed, offset);
+	uint i1 = VERTEX_INDEX(indices, indexed, offset+1);
+	uint i2 = VERTEX_INDEX(indices, indexed, offset+2);
 
-	// Lerp barycentric coords to get point/normal and uv coords
-	surface->point = (wuv.x * vertices[offset] + 
-		              wuv.y * vertices[offset+1] + 
-					  wuv.z * vertices[offset+2]).xyz;
+	// Lerp barycentric coords to get point/normal and uv coords. The
+	// baked vertex ambient occlusion is stored in the vertex w coords.
+	float4 point = wuv.x * vertices[i0] + 
+		           wuv.y * vertices[i1] + 
+				   wuv.z * vertices[i2];
+	surface->point = point.xyz;
+	surface->occlusion = point.w;
 
 	surface->normal = normalize(
-					  (wuv.x * normals[offset] + 
-		               wuv.y * normals[offset+1] + 
-					   wuv.z * normals[offset+2]).xyz
+					  (wuv.x * normals[i0] + 
+		               wuv.y * normals[i1] + 
+					   wuv.z * normals[i2]).xyz
 			);
 
-	surface->uv = wuv.x * uv[offset] + 
-		          wuv.y * uv[offset+1] + 
-				  wuv.z * uv[offset+2];
+	float3 e1 = (vertices[i1] - vertices[i0]).xyz;
+	float3 e2 = (vertices[i2] - vertices[i0]).xyz;
+
+	// The geometric normal of non-indexed scenes is packed in the w coords
+	// of the vertex normals. As indexed scenes share vertices between
+	// triangles, the compiler orders their vertices so that the geometric
+	// normal always points along the cross product of the triangle edges.
+	surface->geometricNormal = indexed
+		? normalize(cross(e1, e2))
+		: (float3)(normals[offset].w, normals[offset+1].w, normals[offset+2].w);
+
+	surface->uv = wuv.x * uv[i0] + 
+		          wuv.y * uv[i1] + 
+				  wuv.z * uv[i2];
+
+	// Lerp the compiled vertex tangents. Their w coords store the handedness
+	// of the tangent frame which is constant across the triangle.
+	if( hasTangents ){
+		surface->tangent = (wuv.x * tangents[i0] +
+				            wuv.y * tangents[i1] +
+						    wuv.z * tangents[i2]).xyz;
+		surface->tangentSign = tangents[i0].w < 0.0f ? -1.0f : 1.0f;
+	} else {
+		// Calculate the tangent vector (dp/du) from the triangle edges and
+		// the uv deltas. If the uv mapping is degenerate fall back to an
+		// arbitrary vector that is perpendicular to the shading normal.
+		float2 duv1 = uv[i1] - uv[i0];
+		float2 duv2 = uv[i2] - uv[i0];
+		float det = duv1.x * duv2.y - duv2.x * duv1.y;
+		if( fabs(det) > 1e-8f ){
+			surface->tangent = normalize((e1 * duv2.y - e2 * duv1.y) / det);
+		} else {
+			float3 u,v;
+			TANGENT_VECTORS(surface->normal, u, v);
+			surface->tangent = u;
+		}
+		surface->tangentSign = 1.0f;
+	}
 
 	// Fetch material root node index
 	surface->matNodeIndex = matIndices[intersection->triIndex];
 }
 
+// Get an orthonormal tangent frame around the surface shading normal. The
+// tangent vector is aligned to the direction of increasing u texture coords.
+void surfaceGetTangentFrame(Surface *surface, float3 *t, float3 *b){
+	surfaceGetTangentFrameForNormal(surface, surface->normal, t, b);
+}
+
+// Get an orthonormal tangent frame around the given normal using the surface
+// tangent vector and handedness.
+void surfaceGetTangentFrameForNormal(Surface *surface, float3 normal, float3 *t, float3 *b){
+	// Gram-Schmidt orthogonalization as the normal may have been perturbed
+	// by a bump or normal map.
+	float3 tangent = surface->tangent - normal * dot(normal, surface->tangent);
+	if( dot(tangent, tangent) < 1e-8f ){
+		float3 u,v;
+		TANGENT_VECTORS(normal, u, v);
+		tangent = u;
+	}
+
+	*t = normalize(tangent);
+	*b = surface->tangentSign * cross(normal, *t);
+}
+
 void printSurface(Surface *surface){
 	printf("[tid: %03d] surface (point: %2.2v3hlf, normal: %2.2v3hlf, uv: %2.2v2hlf, matRootNode: %d)\n",
 			get_global_id(0),
@@ -5,6 +5,9 @@
 #include "path.cl"
 #include "transform.cl"
 #include "surface.cl"
+#include "instance.cl"
 #include "fresnel.cl"
+#include "medium.cl"
+#include "dome.cl"
 
 #endif
@@ -5,6 +5,7 @@ import (
 
 	"github.com/achilleasa/polaris/asset/scene"
 	"github.com/achilleasa/polaris/tracer/opencl/device"
+	"github.com/achilleasa/polaris/types"
 	"github.com/achilleasa/gopencl/v1.2/cl"
 )
 
@@ -16,8 +17,36 @@ const (
 	sizeofIntersection      = 32
 	sizeofEmissiveSample    = 16 // float3 but takes same space as float4
 	sizeofAccumulatorSample = 16 // float3
+	sizeofAovSample         = 48 // depth, normal and albedo float3
+	sizeofVarianceSample    = 16 // count, mean and M2 float3
 )
 
+// Host-side representations of the ray, path and intersection kernel
+// structs. They are used for uploading/downloading ray batches.
+type hostRay struct {
+	// The w coordinate stores the max intersection distance.
+	Origin types.Vec4
+
+	// The w coordinate stores the path index.
+	Dir types.Vec4
+}
+
+type hostPath struct {
+	// float3 takes the same space as float4
+	Throughput types.Vec4
+	PixelIndex uint32
+	Flags      uint32
+	_          [2]uint32
+}
+
+type hostIntersection struct {
+	// The barycentric coords of the hit and the hit distance.
+	Wuvt         types.Vec4
+	MeshInstance uint32
+	TriIndex     uint32
+	_            [2]uint32
+}
+
 type bufferSet struct {
 	// Output frame buffer
 	FrameBuffer *device.Buffer
@@ -28,6 +57,9 @@ type bufferSet struct {
 	// Mesh instances.
 	MeshInstances *device.Buffer
 
+	// Custom mesh instance attributes.
+	InstanceAttributes *device.Buffer
+
 	// Surface materials.
 	MaterialNodes *device.Buffer
 
@@ -39,11 +71,25 @@ type bufferSet struct {
 	Vertices        *device.Buffer
 	Normals         *device.Buffer
 	UV              *device.Buffer
+	Tangents        *device.Buffer
+	Indices         *device.Buffer
 	MaterialIndices *device.Buffer
 
+	// Quantized per-primitive opacity values
+	PrimitiveOpacity *device.Buffer
+
 	// Emissive primitives
 	EmissivePrimitives *device.Buffer
 
+	// Blue-noise texels for rotating the primary ray sample offsets
+	BlueNoise *device.Buffer
+
+	// Color lookup table entries for grading the tone-mapped output
+	ColorLUT *device.Buffer
+
+	// Linear RGBA values of the procedural test pattern image
+	TestPattern *device.Buffer
+
 	// Primary/occlusion/indirect rays and paths
 	Rays  [3]*device.Buffer
 	Paths *device.Buffer
@@ -62,6 +108,21 @@ type bufferSet struct {
 	// is executed.
 	FrameAccumulator *device.Buffer
 
+	// Depth, normal and albedo AOV samples for primary ray hits. Like the
+	// accumulators, trace AOVs are cleared before each trace and
+	// aggregated into the frame AOVs.
+	TraceAovs *device.Buffer
+	FrameAovs *device.Buffer
+
+	// Per-pixel Welford variance estimators for the sample luminance.
+	// The trace snapshot stores the trace accumulator contents after the
+	// last processed sample so that individual sample values can be
+	// recovered. Trace estimators are cleared before each trace and
+	// combined into the frame estimators.
+	TraceSnapshot *device.Buffer
+	TraceVariance *device.Buffer
+	FrameVariance *device.Buffer
+
 	EmissiveSamples *device.Buffer
 	DebugOutput     *device.Buffer
 
@@ -77,14 +138,21 @@ func newBufferSet(dev *device.Device) *bufferSet {
 		// Scene data
 		BvhNodes:           dev.Buffer("bvhNodes"),
 		MeshInstances:      dev.Buffer("meshInstances"),
+		InstanceAttributes: dev.Buffer("instanceAttributes"),
 		MaterialNodes:      dev.Buffer("materialNodes"),
 		Textures:           dev.Buffer("textures"),
 		TextureMetadata:    dev.Buffer("textureMetadata"),
 		Vertices:           dev.Buffer("vertices"),
 		Normals:            dev.Buffer("normals"),
 		UV:                 dev.Buffer("uv"),
+		Tangents:           dev.Buffer("tangents"),
+		Indices:            dev.Buffer("indices"),
 		MaterialIndices:    dev.Buffer("materialIndices"),
+		PrimitiveOpacity:   dev.Buffer("primitiveOpacity"),
 		EmissivePrimitives: dev.Buffer("emissivePrimitives"),
+		BlueNoise:          dev.Buffer("blueNoise"),
+		ColorLUT:           dev.Buffer("colorLUT"),
+		TestPattern:        dev.Buffer("testPattern"),
 		// Tracer data
 		Rays: [3]*device.Buffer{
 			dev.Buffer("rays0"),
@@ -97,6 +165,11 @@ func newBufferSet(dev *device.Device) *bufferSet {
 		EmissiveSamples:  dev.Buffer("emissiveSamples"),
 		TraceAccumulator: dev.Buffer("traceAccumulator"),
 		FrameAccumulator: dev.Buffer("frameAccumulator"),
+		TraceAovs:        dev.Buffer("traceAovs"),
+		FrameAovs:        dev.Buffer("frameAovs"),
+		TraceSnapshot:    dev.Buffer("traceSnapshot"),
+		TraceVariance:    dev.Buffer("traceVariance"),
+		FrameVariance:    dev.Buffer("frameVariance"),
 		DebugOutput:      dev.Buffer("debugOutput"),
 		RayCounters: [3]*device.Buffer{
 			dev.Buffer("numRays0"),
@@ -162,6 +235,26 @@ func (bs *bufferSet) Resize(frameW, frameH uint32) error {
 	if err != nil {
 		return err
 	}
+	err = bs.TraceAovs.Allocate(int(pixels*sizeofAovSample), cl.MEM_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	err = bs.FrameAovs.Allocate(int(pixels*sizeofAovSample), cl.MEM_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	err = bs.TraceSnapshot.Allocate(int(pixels*sizeofAccumulatorSample), cl.MEM_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	err = bs.TraceVariance.Allocate(int(pixels*sizeofVarianceSample), cl.MEM_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	err = bs.FrameVariance.Allocate(int(pixels*sizeofVarianceSample), cl.MEM_READ_WRITE)
+	if err != nil {
+		return err
+	}
 	err = bs.EmissiveSamples.Allocate(int(pixels*sizeofEmissiveSample), cl.MEM_READ_WRITE)
 	if err != nil {
 		return err
@@ -173,20 +266,49 @@ func (bs *bufferSet) Resize(frameW, frameH uint32) error {
 	return nil
 }
 
-// Upload scene data to the device buffers.
+// Upload scene data to the device buffers. Texture data is uploaded separately
+// by the tracer's texture residency manager.
 func (bs *bufferSet) UploadSceneData(scene *scene.Scene) error {
 	var err error
 
+	// Opencl does not support zero-sized buffers so we upload a single
+	// opaque entry for scenes without per-primitive opacity values
+	primitiveOpacity := scene.PrimitiveOpacity
+	if len(primitiveOpacity) == 0 {
+		primitiveOpacity = []uint8{255}
+	}
+
+	// Likewise, upload a single placeholder attribute for scenes without
+	// custom mesh instance attributes
+	instanceAttributes := scene.InstanceAttributeList
+	if len(instanceAttributes) == 0 {
+		instanceAttributes = []float32{0}
+	}
+
+	// Likewise, upload a single placeholder index for non-indexed scenes
+	indices := scene.IndexList
+	if len(indices) == 0 {
+		indices = []uint32{0}
+	}
+
+	// and a single placeholder tangent for scenes compiled without tangents
+	tangents := scene.TangentList
+	if len(tangents) == 0 {
+		tangents = []types.Vec4{{}}
+	}
+
 	targets := map[*device.Buffer]interface{}{
 		bs.BvhNodes:           scene.BvhNodeList,
 		bs.MeshInstances:      scene.MeshInstanceList,
+		bs.InstanceAttributes: instanceAttributes,
 		bs.MaterialNodes:      scene.MaterialNodeList,
-		bs.Textures:           scene.TextureData,
-		bs.TextureMetadata:    scene.TextureMetadata,
 		bs.Vertices:           scene.VertexList,
 		bs.Normals:            scene.NormalList,
 		bs.UV:                 scene.UvList,
+		bs.Tangents:           tangents,
+		bs.Indices:            indices,
 		bs.MaterialIndices:    scene.MaterialIndex,
+		bs.PrimitiveOpacity:   primitiveOpacity,
 		bs.EmissivePrimitives: scene.EmissivePrimitives,
 	}
 
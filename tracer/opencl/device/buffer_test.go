@@ -279,10 +279,12 @@ func createCpuDevice() (*Device, error) {
 	devList, err := SelectDevices(CpuDevice, "CPU")
 	if err != nil {
 		return nil, err
+	} else if len(devList) == 0 {
+		return nil, fmt.Errorf("no CPU opencl devices found; check that openCL drivers are installed")
 	}
 
 	dev := devList[0]
-	err = dev.Init("test.cl")
+	err = dev.Init("test.cl", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -9,6 +9,7 @@ import (
 	"unsafe"
 
 	"github.com/achilleasa/gopencl/v1.2/cl"
+	"github.com/achilleasa/polaris/asset/scene"
 )
 
 type DeviceType uint8
@@ -49,6 +50,11 @@ type Device struct {
 	// Speed estimate in GFlops.
 	Speed uint32
 
+	// The size of the global device memory and the max size of a single
+	// memory allocation in bytes.
+	GlobalMemBytes uint64
+	MaxAllocBytes  uint64
+
 	// Opencl handles; allocated when device is initialized.
 	ctx      *cl.Context
 	cmdQueue cl.CommandQueue
@@ -61,12 +67,14 @@ type DeviceList []Device
 // Implements Stringer.
 func (d Device) String() string {
 	return fmt.Sprintf(
-		"Name: %s\nType: %s\nSpecs: %d computation units, %d Mhz clock, %d GFlops approximate speed",
+		"Name: %s\nType: %s\nSpecs: %d computation units, %d Mhz clock, %d GFlops approximate speed\nMemory: %d MiB global, %d MiB max allocation",
 		d.Name,
 		d.Type.String(),
 		d.compUnits,
 		d.clockSpeed,
 		d.Speed,
+		d.GlobalMemBytes>>20,
+		d.MaxAllocBytes>>20,
 	)
 }
 
@@ -221,6 +229,38 @@ func (d *Device) detectSpeed() error {
 	return nil
 }
 
+// Query the size of the global device memory and the max size of a single
+// memory allocation.
+func (d *Device) detectMemory() error {
+	errCode := cl.GetDeviceInfo(d.Id, cl.DEVICE_GLOBAL_MEM_SIZE, 8, unsafe.Pointer(&d.GlobalMemBytes), nil)
+	if errCode != cl.SUCCESS {
+		return fmt.Errorf("opencl device (%s): could not query GLOBAL_MEM_SIZE (error: %s; code %d)", d.Name, ErrorName(errCode), errCode)
+	}
+	errCode = cl.GetDeviceInfo(d.Id, cl.DEVICE_MAX_MEM_ALLOC_SIZE, 8, unsafe.Pointer(&d.MaxAllocBytes), nil)
+	if errCode != cl.SUCCESS {
+		return fmt.Errorf("opencl device (%s): could not query MAX_MEM_ALLOC_SIZE (error: %s; code %d)", d.Name, ErrorName(errCode), errCode)
+	}
+
+	return nil
+}
+
+// Estimate whether the device can fit the flat arrays of a scene. As each
+// scene array is uploaded to a separate device buffer, each array must not
+// exceed the max allocation size while the sum of the array sizes must not
+// exceed the global device memory. The estimate does not account for the
+// frame and ray buffers allocated by the tracers.
+func (d *Device) CanFitScene(sc *scene.Scene) bool {
+	var total uint64
+	for _, size := range sc.ArraySizes() {
+		if size > d.MaxAllocBytes {
+			return false
+		}
+		total += size
+	}
+
+	return total <= d.GlobalMemBytes
+}
+
 // Return a textual description of an opencl error code.
 func ErrorName(errCode cl.ErrorCode) string {
 	switch errCode {
@@ -1,8 +1,12 @@
 package device
 
 import (
+	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/types"
 )
 
 func TestSelectDevices(t *testing.T) {
@@ -15,6 +19,42 @@ func TestSelectDevices(t *testing.T) {
 	}
 }
 
+func TestSelectDeviceSpec(t *testing.T) {
+	platforms := []PlatformInfo{
+		{Name: "cpu", Devices: []*Device{{Name: "Intel(R) Core(TM) i7 CPU"}}},
+		{Name: "gpu", Devices: []*Device{{Name: "AMD Radeon Pro"}, {Name: "Intel Iris Pro"}}},
+	}
+
+	specs := []struct {
+		spec   string
+		expDev *Device
+	}{
+		{"0:0", platforms[0].Devices[0]},
+		{"1:1", platforms[1].Devices[1]},
+		{"radeon", platforms[1].Devices[0]},
+		{"IRIS", platforms[1].Devices[1]},
+		{"intel", platforms[0].Devices[0]},
+	}
+
+	for specIndex, spec := range specs {
+		dev, err := selectDevice(platforms, spec.spec)
+		if err != nil {
+			t.Fatalf("[spec %d] %v", specIndex, err)
+		}
+		if dev != spec.expDev {
+			t.Fatalf("[spec %d] expected spec %q to select device %q; got %q", specIndex, spec.spec, spec.expDev.Name, dev.Name)
+		}
+	}
+
+	expError := `no device matches "%s"; available devices: 0:0 (Intel(R) Core(TM) i7 CPU), 1:0 (AMD Radeon Pro), 1:1 (Intel Iris Pro)`
+	for _, spec := range []string{"1:2", "2:0", "nvidia", ""} {
+		_, err := selectDevice(platforms, spec)
+		if exp := fmt.Sprintf(expError, spec); err == nil || err.Error() != exp {
+			t.Fatalf("expected error %q; got %v", exp, err)
+		}
+	}
+}
+
 func TestDeviceInit(t *testing.T) {
 	devList, err := SelectDevices(CpuDevice, "CPU")
 	if err != nil {
@@ -25,7 +65,7 @@ func TestDeviceInit(t *testing.T) {
 	}
 
 	dev := devList[0]
-	err = dev.Init("test.cl")
+	err = dev.Init("test.cl", nil)
 	if err != nil {
 		t.Fatalf("error initializing device '%s': %v", dev.Name, err)
 	}
@@ -58,6 +98,34 @@ func createCpuTestDevice() (*Device, error) {
 
 	if err != nil {
 		return nil, err
+	} else if len(devList) == 0 {
+		return nil, fmt.Errorf("no CPU opencl devices found; check that openCL drivers are installed")
+	}
+	return devList[0], devList[0].Init("test.cl", nil)
+}
+
+func TestCanFitScene(t *testing.T) {
+	sc := &scene.Scene{
+		VertexList:  make([]types.Vec4, 64),
+		NormalList:  make([]types.Vec4, 64),
+		TextureData: make([]byte, 256),
+	}
+
+	specs := []struct {
+		globalMem, maxAlloc uint64
+		expFit              bool
+	}{
+		// 3 arrays with sizes 1024, 1024 and 256 bytes
+		{4096, 1024, true},
+		{4096, 1000, false},
+		{2000, 1024, false},
+		{2304, 2304, true},
+	}
+
+	for specIndex, spec := range specs {
+		dev := &Device{GlobalMemBytes: spec.globalMem, MaxAllocBytes: spec.maxAlloc}
+		if fit := dev.CanFitScene(sc); fit != spec.expFit {
+			t.Errorf("[spec %d] expected CanFitScene to return %t; got %t", specIndex, spec.expFit, fit)
+		}
 	}
-	return devList[0], devList[0].Init("test.cl")
 }
@@ -3,6 +3,7 @@ package device
 import (
 	"bytes"
 	"fmt"
+	"strconv"
 	"strings"
 	"unsafe"
 
@@ -110,12 +111,16 @@ func GetPlatformInfo() ([]PlatformInfo, error) {
 			)
 		}
 
-		// Enumerate speed for all platform devices
+		// Enumerate speed and memory for all platform devices
 		for _, dev := range infoList[pIdx].Devices {
 			err := dev.detectSpeed()
 			if err != nil {
 				return nil, err
 			}
+			err = dev.detectMemory()
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -146,3 +151,62 @@ func SelectDevices(typeMask DeviceType, matchName string) ([]*Device, error) {
 	}
 	return list, nil
 }
+
+// Scan all available opencl platforms and select a single device using a
+// spec. The spec is either a "platform:device" index pair (e.g. "0:1") or a
+// case-insensitive substring of the device name. If multiple devices match
+// the name, the first one is returned.
+func SelectDevice(spec string) (*Device, error) {
+	platforms, err := GetPlatformInfo()
+	if err != nil {
+		return nil, err
+	}
+	return selectDevice(platforms, spec)
+}
+
+// Select a device from a list of platforms using a device spec.
+func selectDevice(platforms []PlatformInfo, spec string) (*Device, error) {
+	if pIdx, dIdx, isIndex := parseDeviceIndex(spec); isIndex {
+		if pIdx < len(platforms) && dIdx < len(platforms[pIdx].Devices) {
+			return platforms[pIdx].Devices[dIdx], nil
+		}
+	} else if spec != "" {
+		matchName := strings.ToLower(spec)
+		for _, p := range platforms {
+			for _, d := range p.Devices {
+				if strings.Contains(strings.ToLower(d.Name), matchName) {
+					return d, nil
+				}
+			}
+		}
+	}
+
+	available := make([]string, 0)
+	for pIdx, p := range platforms {
+		for dIdx, d := range p.Devices {
+			available = append(available, fmt.Sprintf("%d:%d (%s)", pIdx, dIdx, d.Name))
+		}
+	}
+	if len(available) == 0 {
+		return nil, fmt.Errorf("no device matches %q; no opencl devices available", spec)
+	}
+	return nil, fmt.Errorf("no device matches %q; available devices: %s", spec, strings.Join(available, ", "))
+}
+
+// Parse a device spec in "platform:device" index format.
+func parseDeviceIndex(spec string) (int, int, bool) {
+	tokens := strings.Split(spec, ":")
+	if len(tokens) != 2 {
+		return 0, 0, false
+	}
+
+	pIdx, err := strconv.ParseUint(tokens[0], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	dIdx, err := strconv.ParseUint(tokens[1], 10, 32)
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(pIdx), int(dIdx), true
+}
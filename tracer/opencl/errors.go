@@ -19,4 +19,6 @@ var (
 	ErrInvalidChangeData      = errors.New("opencl tracer: invalid data type for change")
 	ErrInvalidOption          = errors.New("opencl tracer: invalid tracer option")
 	ErrNoSceneData            = errors.New("opencl tracer: no scene data uploaded")
+	ErrAovCaptureDisabled     = errors.New("opencl tracer: AOV capturing is not enabled for this pipeline")
+	ErrRayBatchTooLarge       = errors.New("opencl tracer: ray batch does not fit in the allocated frame buffers")
 )
@@ -19,9 +19,14 @@ const (
 	accumulateEmissiveSamples
 	// hdr kernels
 	tonemapSimpleReinhard
+	applyColorLUT
 	// accumulator
 	clearAccumulator
 	aggregateAccumulator
+	// aovs
+	accumulateAovs
+	accumulateVariance
+	aggregateVariance
 	// debugging
 	debugClearBuffer
 	debugRayIntersectionDepth
@@ -54,10 +59,18 @@ func (kt kernelType) String() string {
 		return "accumulateEmissiveSamples"
 	case tonemapSimpleReinhard:
 		return "tonemapSimpleReinhard"
+	case applyColorLUT:
+		return "applyColorLUT"
 	case clearAccumulator:
 		return "clearAccumulator"
 	case aggregateAccumulator:
 		return "aggregateAccumulator"
+	case accumulateAovs:
+		return "accumulateAovs"
+	case accumulateVariance:
+		return "accumulateVariance"
+	case aggregateVariance:
+		return "aggregateVariance"
 	case debugClearBuffer:
 		return "debugClearBuffer"
 	case debugRayIntersectionDepth:
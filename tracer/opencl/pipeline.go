@@ -4,13 +4,14 @@ import (
 	"fmt"
 	"image"
 	"image/png"
-	"math/rand"
 	"os"
 	"time"
 	"unsafe"
 
+	"github.com/achilleasa/polaris/image/exr"
 	"github.com/achilleasa/polaris/tracer"
 	"github.com/achilleasa/polaris/tracer/opencl/device"
+	"github.com/achilleasa/polaris/types"
 	"github.com/go-gl/gl/v2.1/gl"
 )
 
@@ -50,6 +51,36 @@ type Pipeline struct {
 	// A set of post-processing stages that are executed prior to
 	// rendering the final frame.
 	PostProcess []PipelineStage
+
+	// Capture depth, normal and albedo AOVs for primary ray hits. This
+	// must be enabled when using the SaveAovs post-processing stage.
+	CaptureAovs bool
+
+	// Track the per-pixel variance of the sample luminance. When enabled,
+	// the SaveAovs post-processing stage also emits a variance layer.
+	CaptureVariance bool
+
+	// If non-zero, the SaveAovs post-processing stage also emits a firefly
+	// mask layer that flags pixels whose luminance exceeds this multiple
+	// of the median luminance of their neighbors. The mask can be used for
+	// selectively re-rendering or filtering fireflies.
+	FireflyThreshold float32
+
+	// An optional blue-noise texture for decorrelating the sub-pixel
+	// sample offsets of neighboring pixels. If not specified, primary
+	// rays use white noise sample offsets.
+	BlueNoise *tracer.BlueNoise
+
+	// An optional color lookup table which is applied to the framebuffer
+	// after tone-mapping. If not specified, the tone-mapped output is
+	// not graded.
+	ColorLUT *tracer.ColorLUT
+
+	// The max number of bytes of texture data to keep resident on the
+	// device. If the scene textures exceed the budget, the least recently
+	// sampled textures are evicted to make room for textures sampled by
+	// each render pass. A zero value keeps all textures resident.
+	TextureBudget uint64
 }
 
 func DefaultPipeline(debugFlags DebugFlag) *Pipeline {
@@ -59,6 +90,7 @@ func DefaultPipeline(debugFlags DebugFlag) *Pipeline {
 		Integrator:          MonteCarloIntegrator(debugFlags),
 		PostProcess: []PipelineStage{
 			TonemapSimpleReinhard(),
+			ApplyColorLUT(),
 		},
 	}
 
@@ -69,9 +101,37 @@ func DefaultPipeline(debugFlags DebugFlag) *Pipeline {
 	return pipeline
 }
 
-// Clear the frame accumulator buffer.
+// Create a pipeline that renders a procedural test pattern instead of tracing
+// the scene. The pattern values are accumulated and post-processed like traced
+// samples so the pipeline can be used for verifying the tone-mapping and
+// output path independently of the rendering code.
+func TestPatternPipeline(pattern tracer.TestPattern) *Pipeline {
+	return &Pipeline{
+		Reset:      ClearAccumulator(),
+		Integrator: TestPatternIntegrator(pattern),
+		PostProcess: []PipelineStage{
+			TonemapSimpleReinhard(),
+			ApplyColorLUT(),
+		},
+	}
+}
+
+// Clear the frame accumulator buffer and, if AOV or variance capturing is
+// enabled, the frame AOV and variance buffers.
 func ClearAccumulator() PipelineStage {
 	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+		if tr.pipeline.CaptureAovs {
+			_, err := tr.resources.ClearAovs(tr.resources.buffers.FrameAovs, blockReq)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if tr.pipeline.CaptureVariance {
+			_, err := tr.resources.ClearVariance(tr.resources.buffers.FrameVariance, blockReq)
+			if err != nil {
+				return 0, err
+			}
+		}
 		return tr.resources.ClearFrameAccumulator(blockReq)
 	}
 }
@@ -79,7 +139,8 @@ func ClearAccumulator() PipelineStage {
 // Use a perspective camera for the primary ray generation stage.
 func PerspectiveCamera() PipelineStage {
 	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
-		return tr.resources.GeneratePrimaryRays(blockReq, tr.cameraPosition, tr.cameraFrustrum)
+		jitter := types.Vec2{tr.rng.Float32(), tr.rng.Float32()}
+		return tr.resources.GeneratePrimaryRays(blockReq, tr.cameraPosition, tr.cameraFrustrum, tr.cameraLens, tr.cameraProjection, jitter)
 	}
 }
 
@@ -90,13 +151,24 @@ func TonemapSimpleReinhard() PipelineStage {
 	}
 }
 
+// Grade the tone-mapped framebuffer using the pipeline's color lookup table.
+// This stage is a no-op if the pipeline does not specify a color lookup table.
+func ApplyColorLUT() PipelineStage {
+	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+		if tr.pipeline.ColorLUT == nil {
+			return 0, nil
+		}
+		return tr.resources.ApplyColorLUT(blockReq, tr.pipeline.ColorLUT)
+	}
+}
+
 // Use a montecarlo pathtracer implementation.
 func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
 		var err error
 
 		start := time.Now()
-		numPixels := int(blockReq.FrameW * blockReq.BlockH)
+		numPixels := int(blockReq.RowWidth() * blockReq.BlockH)
 		numEmissives := uint32(len(tr.sceneData.EmissivePrimitives))
 
 		var activeRayBuf uint32 = 0
@@ -105,14 +177,21 @@ func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 		// Use packet query intersector for GPUs as opencl forces CPU
 		// to use a local workgroup size equal to 1
 		if tr.device.Type == device.GpuDevice {
-			_, err = tr.resources.RayPacketIntersectionQuery(activeRayBuf, numPixels)
+			_, err = tr.resources.RayPacketIntersectionQuery(tr.sceneData.IntersectionEpsilon(), activeRayBuf, numPixels)
 		} else {
-			_, err = tr.resources.RayIntersectionQuery(activeRayBuf, numPixels)
+			_, err = tr.resources.RayIntersectionQuery(tr.sceneData.IntersectionEpsilon(), activeRayBuf, numPixels)
 		}
 		if err != nil {
 			return time.Since(start), err
 		}
 
+		if tr.pipeline.CaptureAovs {
+			_, err = tr.resources.AccumulateAovs(activeRayBuf, numPixels)
+			if err != nil {
+				return time.Since(start), err
+			}
+		}
+
 		if debugFlags&PrimaryRayIntersectionDepth == PrimaryRayIntersectionDepth {
 			_, err = tr.resources.DebugRayIntersectionDepth(blockReq, activeRayBuf)
 			err = dumpDebugBuffer(err, tr.resources, blockReq.FrameW, blockReq.FrameH, "debug-primary-intersection-depth.png")
@@ -133,9 +212,9 @@ func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 			// Shade misses
 			if tr.sceneData.SceneDiffuseMatIndex != -1 {
 				if bounce == 0 {
-					_, err = tr.resources.ShadePrimaryRayMisses(uint32(tr.sceneData.SceneDiffuseMatIndex), activeRayBuf, numPixels)
+					_, err = tr.resources.ShadePrimaryRayMisses(uint32(tr.sceneData.SceneDiffuseMatIndex), &tr.sceneData.Dome, &tr.sceneData.Medium, activeRayBuf, numPixels)
 				} else {
-					_, err = tr.resources.ShadeIndirectRayMisses(uint32(tr.sceneData.SceneDiffuseMatIndex), activeRayBuf, numPixels)
+					_, err = tr.resources.ShadeIndirectRayMisses(uint32(tr.sceneData.SceneDiffuseMatIndex), &tr.sceneData.Dome, &tr.sceneData.Medium, activeRayBuf, numPixels)
 				}
 				if err != nil {
 					return time.Since(start), err
@@ -143,7 +222,8 @@ func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 			}
 
 			// Shade hits
-			_, err = tr.resources.ShadeHits(bounce, blockReq.MinBouncesForRR, rand.Uint32(), numEmissives, activeRayBuf, numPixels)
+			hasOpacity := len(tr.sceneData.PrimitiveOpacity) != 0
+			_, err = tr.resources.ShadeHits(bounce, blockReq.MinBouncesForRR, blockReq.MinBouncesForNEE, tr.rng.Uint32(), blockReq.ThroughputClampAt(bounce), tr.sceneData.AllDiffuse, hasOpacity, &tr.sceneData.Medium, &tr.sceneData.Dome, tr.sceneData.IntersectionEpsilon(), numEmissives, activeRayBuf, numPixels)
 			if err != nil {
 				return time.Since(start), err
 			}
@@ -157,7 +237,7 @@ func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 			}
 
 			// Process intersections for occlusion rays and accumulate emissive samples for non occluded paths
-			_, err := tr.resources.RayIntersectionTest(2, numPixels)
+			_, err := tr.resources.RayIntersectionTest(tr.sceneData.IntersectionEpsilon(), 2, numPixels)
 			if err != nil {
 				return time.Since(start), err
 			}
@@ -202,7 +282,7 @@ func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 			// Process intersections for indirect rays
 			if bounce+1 < blockReq.NumBounces {
 				activeRayBuf = 1 - activeRayBuf
-				_, err = tr.resources.RayIntersectionQuery(activeRayBuf, numPixels)
+				_, err = tr.resources.RayIntersectionQuery(tr.sceneData.IntersectionEpsilon(), activeRayBuf, numPixels)
 				if err != nil {
 					return time.Since(start), err
 				}
@@ -212,6 +292,22 @@ func MonteCarloIntegrator(debugFlags DebugFlag) PipelineStage {
 	}
 }
 
+// Add the values of a procedural test pattern into the trace accumulator in
+// place of traced samples. The pattern is uploaded to the device the first
+// time the stage is executed and whenever the frame dimensions change.
+func TestPatternIntegrator(pattern tracer.TestPattern) PipelineStage {
+	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+		expSize := int(16 * blockReq.FrameW * blockReq.FrameH)
+		if tr.resources.buffers.TestPattern.Size() != expSize {
+			err := tr.resources.UploadTestPattern(pattern, blockReq.FrameW, blockReq.FrameH)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return tr.resources.AccumulateTestPattern(blockReq)
+	}
+}
+
 // Save a copy of the RGBA framebuffer.
 func SaveFrameBuffer(imgFile string) PipelineStage {
 	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
@@ -233,6 +329,95 @@ func SaveFrameBuffer(imgFile string) PipelineStage {
 	}
 }
 
+// Save the frame accumulator and the captured AOVs as a multi-layer OpenEXR
+// image with beauty, depth, normal and albedo layers. All layers contain
+// linear values averaged over the accumulated samples; the beauty layer is
+// not tone-mapped. Depth values are stored as the distance from the camera
+// with misses mapped to 0. If variance capturing is enabled, an additional
+// variance layer with the per-pixel sample luminance variance is emitted. If
+// a firefly threshold is set, a firefly mask layer is also emitted.
+func SaveAovs(imgFile string) PipelineStage {
+	return func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+		start := time.Now()
+
+		if !tr.pipeline.CaptureAovs {
+			return 0, ErrAovCaptureDisabled
+		}
+
+		numPixels := int(blockReq.FrameW * blockReq.FrameH)
+		accumulator := make([]float32, 4*numPixels)
+		err := tr.resources.buffers.FrameAccumulator.ReadData(0, 0, 0, accumulator)
+		if err != nil {
+			return 0, err
+		}
+		aovs := make([]float32, 12*numPixels)
+		err = tr.resources.buffers.FrameAovs.ReadData(0, 0, 0, aovs)
+		if err != nil {
+			return 0, err
+		}
+
+		layers := []exr.Layer{
+			{Name: "beauty", Channels: exr.RgbChannels, Data: make([]float32, 3*numPixels)},
+			{Name: "depth", Channels: exr.DepthChannels, Data: make([]float32, numPixels)},
+			{Name: "normal", Channels: exr.XyzChannels, Data: make([]float32, 3*numPixels)},
+			{Name: "albedo", Channels: exr.RgbChannels, Data: make([]float32, 3*numPixels)},
+		}
+		sampleWeight := float32(1.0 / float32(blockReq.AccumulatedSamples+blockReq.SamplesPerPixel))
+		for pixel := 0; pixel < numPixels; pixel++ {
+			for c := 0; c < 3; c++ {
+				layers[0].Data[3*pixel+c] = accumulator[4*pixel+c] * sampleWeight
+				layers[2].Data[3*pixel+c] = aovs[12*pixel+4+c] * sampleWeight
+				layers[3].Data[3*pixel+c] = aovs[12*pixel+8+c] * sampleWeight
+			}
+			layers[1].Data[pixel] = aovs[12*pixel] * sampleWeight
+		}
+
+		if tr.pipeline.CaptureVariance {
+			variance, err := readFrameVariance(tr, numPixels)
+			if err != nil {
+				return 0, err
+			}
+			layers = append(layers, exr.Layer{Name: "variance", Channels: []string{"Y"}, Data: variance})
+		}
+
+		if tr.pipeline.FireflyThreshold > 0 {
+			for index := range accumulator {
+				accumulator[index] *= sampleWeight
+			}
+			mask, err := tracer.DetectFireflies(accumulator, blockReq.FrameW, blockReq.FrameH, tr.pipeline.FireflyThreshold)
+			if err != nil {
+				return 0, err
+			}
+			layers = append(layers, exr.Layer{Name: "firefly", Channels: []string{"Y"}, Data: mask})
+		}
+
+		f, err := os.Create(imgFile)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+
+		return time.Since(start), exr.Write(f, int(blockReq.FrameW), int(blockReq.FrameH), layers)
+	}
+}
+
+// Read the frame variance estimators and return the unbiased luminance
+// variance for each pixel.
+func readFrameVariance(tr *Tracer, numPixels int) ([]float32, error) {
+	state := make([]float32, 4*numPixels)
+	err := tr.resources.buffers.FrameVariance.ReadData(0, 0, 0, state)
+	if err != nil {
+		return nil, err
+	}
+
+	variance := make([]float32, numPixels)
+	for pixel := range variance {
+		welford := tracer.WelfordState{Count: state[4*pixel], Mean: state[4*pixel+1], M2: state[4*pixel+2]}
+		variance[pixel] = welford.Variance()
+	}
+	return variance, nil
+}
+
 // Copy RGBA screen buffer to opengl texture. This function assumes that
 // the caller has enabled the appropriate 2D texture target.
 func CopyFrameBufferToOpenGLTexture() PipelineStage {
@@ -0,0 +1,713 @@
+package opencl
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/material"
+	"github.com/achilleasa/polaris/tracer"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestMonteCarloIntegratorThroughputClamp(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A diffuse floor below a large emissive ceiling. Rays reflected by
+	// the floor hit the ceiling on the first bounce with a throughput
+	// equal to the floor reflectance.
+	ps := input.NewScene()
+	addQuad(ps, types.Vec3{0, -1, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, -1}, "diffuse(reflectance: {0.5, 0.5, 0.5})")
+	addQuad(ps, types.Vec3{0, 9, 0}, types.Vec3{1000, 0, 0}, types.Vec3{0, 0, 1000}, "emissive(radiance: {10, 10, 10})")
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		// Direct hit on the emissive ceiling at depth 0
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 1, 0}},
+		// Ceiling reached after bouncing off the floor at depth 1
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, -1, 0}},
+	}
+
+	specs := []struct {
+		clamp       []float32
+		expRadiance []float32
+	}{
+		{nil, []float32{10, 5}},
+		// Depth 0 is not clamped while the first bounce throughput (0.5)
+		// is clamped to 0.1
+		{[]float32{0, 0.1}, []float32{10, 1}},
+	}
+
+	for specIndex, spec := range specs {
+		blockReq := &tracer.BlockRequest{
+			SamplesPerPixel: 16,
+			NumBounces:      2,
+			// Disable RR and NEE so the floor only gathers light via
+			// bxdf sampling
+			MinBouncesForRR:  2,
+			MinBouncesForNEE: 2,
+			ThroughputClamp:  spec.clamp,
+		}
+		results, err := tr.TraceRays(rays, blockReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for index, res := range results {
+			exp := spec.expRadiance[index]
+			if !types.ApproxEqual(res.Radiance, types.Vec3{exp, exp, exp}, 1e-2*exp) {
+				t.Fatalf("[spec %d, ray %d] expected radiance to be %v; got %v", specIndex, index, exp, res.Radiance)
+			}
+		}
+	}
+}
+
+func TestMonteCarloIntegratorMediumAttenuation(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// Emissive quads facing the ray origin at increasing distances inside
+	// a non-scattering medium.
+	ps := input.NewScene()
+	ps.Medium = &input.Medium{Extinction: 0.25}
+	addQuad(ps, types.Vec3{0, 0, -1}, types.Vec3{0.5, 0, 0}, types.Vec3{0, 0.5, 0}, "emissive(radiance: {1, 1, 1})")
+	addQuad(ps, types.Vec3{4, 0, -4}, types.Vec3{0.5, 0, 0}, types.Vec3{0, 0.5, 0}, "emissive(radiance: {1, 1, 1})")
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+		{Origin: types.Vec3{4, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{SamplesPerPixel: 1, NumBounces: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, dist := range []float32{1, 4} {
+		exp := float32(math.Exp(float64(-0.25 * dist)))
+		if !types.ApproxEqual(results[index].Radiance, types.Vec3{exp, exp, exp}, 1e-3) {
+			t.Errorf("[ray %d] expected radiance of emissive at distance %f to be %f; got %v", index, dist, exp, results[index].Radiance)
+		}
+	}
+}
+
+func TestMonteCarloIntegratorMediumInScatteringOnSingularSurface(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A mirror lit by an area light inside a scattering medium. Singular
+	// surfaces do not sample emissives so any radiance reaching the ray
+	// origin after a single bounce must be in-scattered along the segment
+	// between the ray origin and the mirror.
+	ps := input.NewScene()
+	ps.Medium = &input.Medium{Extinction: 0.5, Albedo: types.Vec3{1, 1, 1}}
+	addQuad(ps, types.Vec3{0, 0, -2}, types.Vec3{1, 0, 0}, types.Vec3{0, 1, 0}, "conductor(specularity: {1, 1, 1})")
+	addQuad(ps, types.Vec3{0, 2, -1}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, 1}, "emissive(radiance: {10, 10, 10})")
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{SamplesPerPixel: 64, NumBounces: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0].Radiance.MaxComponent() <= 0 {
+		t.Fatalf("expected in-scattered radiance along the segment to the mirror; got %v", results[0].Radiance)
+	}
+}
+
+func TestMonteCarloIntegratorAnisotropicConductorLobe(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// Rays hit a floor straight down so the mirror direction points
+	// straight up. Two scenes place a small downward-facing light at the
+	// same angle from the mirror direction; one displaced along the floor
+	// tangent (x) and one along its bi-tangent (z). The reflected radiance
+	// from the light placed along the axis with the larger roughness
+	// should dominate.
+	specs := []struct {
+		roughnessU, roughnessV float32
+		expLargerAlongZ        bool
+	}{
+		{0.05, 0.6, true},
+		{0.6, 0.05, false},
+	}
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 1, 0}, Dir: types.Vec3{0, -1, 0}},
+	}
+	blockReq := &tracer.BlockRequest{
+		SamplesPerPixel: 256,
+		NumBounces:      2,
+		MinBouncesForRR: 2,
+	}
+
+	for specIndex, spec := range specs {
+		var radiance [2]float32
+		for lightIndex, lightCenter := range []types.Vec3{{1, 2, 0}, {0, 2, 1}} {
+			ps := input.NewScene()
+			addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{10, 0, 0}, types.Vec3{0, 0, -10},
+				fmt.Sprintf("anisotropicConductor(specularity: {1, 1, 1}, roughnessU: %f, roughnessV: %f)", spec.roughnessU, spec.roughnessV),
+			)
+			addQuad(ps, lightCenter, types.Vec3{0.1, 0, 0}, types.Vec3{0, 0, 0.1}, "emissive(radiance: {10, 10, 10})")
+			uploadTestScene(t, tr, ps)
+
+			results, err := tr.TraceRays(rays, blockReq)
+			if err != nil {
+				t.Fatal(err)
+			}
+			radiance[lightIndex] = results[0].Radiance.MaxComponent()
+		}
+
+		alongX, alongZ := radiance[0], radiance[1]
+		if spec.expLargerAlongZ && alongZ <= 2*alongX {
+			t.Errorf("[spec %d] expected lobe to be elongated along the bi-tangent; got radiance %f along x and %f along z", specIndex, alongX, alongZ)
+		} else if !spec.expLargerAlongZ && alongX <= 2*alongZ {
+			t.Errorf("[spec %d] expected lobe to be elongated along the tangent; got radiance %f along x and %f along z", specIndex, alongX, alongZ)
+		}
+	}
+}
+
+func TestMonteCarloIntegratorMaterialTransparency(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A black 50% transparent pane in front of an emissive quad. Rays
+	// that pass through the pane reach the emissive while the rest are
+	// absorbed so the radiance reaching the ray origin should be about
+	// half the emitted radiance.
+	ps := input.NewScene()
+	addQuad(ps, types.Vec3{0, 0, -1}, types.Vec3{1, 0, 0}, types.Vec3{0, 1, 0}, "diffuse(reflectance: {0, 0, 0})")
+	ps.Materials[len(ps.Materials)-1].Transparency = 0.5
+	addQuad(ps, types.Vec3{0, 0, -2}, types.Vec3{1, 0, 0}, types.Vec3{0, 1, 0}, "emissive(radiance: {1, 1, 1})")
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{
+		SamplesPerPixel: 1024,
+		NumBounces:      2,
+		MinBouncesForRR: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if passed := results[0].Radiance.MaxComponent(); passed < 0.45 || passed > 0.55 {
+		t.Fatalf("expected roughly half the rays to pass through the surface; got radiance %f", passed)
+	}
+}
+
+func TestMonteCarloIntegratorPointLightPenumbra(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A diffuse floor partially covered by a black occluder whose edge lies
+	// directly below a point light. With a zero radius the shadow edge is
+	// hard. With a radius of 0.5 the light is partially visible from floor
+	// points within 0.5 units of the edge.
+	render := func(radius float32) []float32 {
+		ps := input.NewScene()
+		addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{0, 0, 5}, types.Vec3{5, 0, 0}, "diffuse(reflectance: {0.5, 0.5, 0.5})")
+		addQuad(ps, types.Vec3{-5, 1, 0}, types.Vec3{0, 0, 5}, types.Vec3{5, 0, 0}, "diffuse(reflectance: {0, 0, 0})")
+		ps.PointLights = append(ps.PointLights, &input.PointLight{
+			Position:  types.Vec3{0, 2, 0},
+			Intensity: types.Vec3{10, 10, 10},
+			Radius:    radius,
+		})
+		uploadTestScene(t, tr, ps)
+
+		var rays []tracer.Ray
+		for _, x := range []float32{-0.75, -0.25, 0.25, 0.75} {
+			rays = append(rays, tracer.Ray{Origin: types.Vec3{x, 0.5, 0}, Dir: types.Vec3{0, -1, 0}})
+		}
+		results, err := tr.TraceRays(rays, &tracer.BlockRequest{SamplesPerPixel: 1024, NumBounces: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		radiance := make([]float32, len(results))
+		for index, res := range results {
+			radiance[index] = res.Radiance.MaxComponent()
+		}
+		return radiance
+	}
+
+	hard := render(0)
+	if hard[0] > 1e-4 || hard[1] > 1e-4 {
+		t.Fatalf("expected floor points below the occluder to be fully shadowed by a point light; got %v", hard)
+	}
+	if math.Abs(float64(hard[2]-hard[3])) > 0.1*float64(hard[3]) {
+		t.Fatalf("expected floor points past the occluder edge to be fully lit by a point light; got %v", hard)
+	}
+
+	soft := render(0.5)
+	if soft[0] > 1e-4 {
+		t.Fatalf("expected floor point outside the penumbra to be fully shadowed; got %v", soft)
+	}
+	if !(soft[1] > 0 && soft[1] < soft[2] && soft[2] < soft[3]) {
+		t.Fatalf("expected radiance to increase across the penumbra; got %v", soft)
+	}
+
+	// A sphere light emits the same power as a point light so floor points
+	// that see the whole sphere should receive about the same radiance.
+	if math.Abs(float64(soft[3]-hard[3])) > 0.05*float64(hard[3]) {
+		t.Fatalf("expected fully lit floor point radiance to be about %f; got %f", hard[3], soft[3])
+	}
+}
+
+func TestMonteCarloIntegratorRoughConductorEnergyCompensation(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A white furnace test: a white rough conductor floor lit by a uniform
+	// white background. Single-scatter GGX reflects the directional albedo
+	// E(mu) of the surface while the compensated bxdf should reflect all
+	// incoming energy.
+	ps := input.NewScene()
+	addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{0, 0, 1000}, types.Vec3{1000, 0, 0}, "roughConductor(specularity: {1, 1, 1}, roughness: 1)")
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       compiler.SceneDiffuseMaterialName,
+		Expression: "diffuse(reflectance: {1, 1, 1})",
+		Used:       true,
+	})
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 1, 0}, Dir: types.Vec3{0, -1, 0}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{
+		SamplesPerPixel: 2048,
+		NumBounces:      2,
+		MinBouncesForRR: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Directional albedo for alpha = 1 and mu = 1
+	table := material.NewGGXAlbedoTable(material.GGXAlbedoTableSize)
+	singleScatter := table.Albedo[len(table.Albedo)-1]
+	if singleScatter > 0.9 {
+		t.Fatalf("expected single-scatter GGX to lose energy at roughness 1; got albedo %f", singleScatter)
+	}
+
+	got := results[0].Radiance.MaxComponent()
+	if got <= singleScatter+0.5*(1-singleScatter) {
+		t.Fatalf("expected compensated conductor to reflect more energy than single-scatter GGX (%f); got %f", singleScatter, got)
+	}
+	if math.Abs(float64(got-1)) > 0.05 {
+		t.Fatalf("expected compensated conductor to reflect about 1; got %f", got)
+	}
+}
+
+func TestMonteCarloIntegratorIORTexture(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// The left half of the IOR texture encodes an IOR of 1 and the right
+	// half an IOR of 3.
+	texPath := filepath.Join(t.TempDir(), "ior.png")
+	writeTestTexture(t, texPath, 8, 1, func(x, y int) color.NRGBA {
+		if x < 4 {
+			return color.NRGBA{A: 255}
+		}
+		return color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	})
+
+	// A mirror floor that reflects a uniform white background. At normal
+	// incidence the reflected radiance equals the fresnel reflectance for
+	// the IOR sampled at the hit point: ((n - 1) / (n + 1))^2
+	ps := input.NewScene()
+	addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, -1}, fmt.Sprintf("conductor(specularity: {1, 1, 1}, intIOR: %q)", texPath))
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       compiler.SceneDiffuseMaterialName,
+		Expression: "diffuse(reflectance: {1, 1, 1})",
+		Used:       true,
+	})
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{-0.5, 1, 0}, Dir: types.Vec3{0, -1, 0}},
+		{Origin: types.Vec3{0.5, 1, 0}, Dir: types.Vec3{0, -1, 0}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{
+		SamplesPerPixel: 1,
+		NumBounces:      2,
+		MinBouncesForRR: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for index, ior := range []float32{1, 3} {
+		r0 := (ior - 1) / (ior + 1)
+		exp := r0 * r0
+		if !types.ApproxEqual(results[index].Radiance, types.Vec3{exp, exp, exp}, 1e-2) {
+			t.Errorf("[ray %d] expected reflected radiance for IOR %f at uv %v to be %f; got %v", index, ior, results[index].UV, exp, results[index].Radiance)
+		}
+	}
+}
+
+func TestMonteCarloIntegratorOcclusionRayCount(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A mirror and a diffuse floor lit by an area light
+	ps := input.NewScene()
+	addQuad(ps, types.Vec3{-2, 0, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, -1}, "conductor(specularity: {1, 1, 1})")
+	addQuad(ps, types.Vec3{2, 0, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, -1}, "diffuse(reflectance: {0.5, 0.5, 0.5})")
+	addQuad(ps, types.Vec3{0, 4, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, 1}, "emissive(radiance: {10, 10, 10})")
+	uploadTestScene(t, tr, ps)
+
+	mirrorRay := tracer.Ray{Origin: types.Vec3{-2, 1, 0}, Dir: types.Vec3{0, -1, 0}}
+	diffuseRay := tracer.Ray{Origin: types.Vec3{2, 1, 0}, Dir: types.Vec3{0, -1, 0}}
+
+	specs := []struct {
+		ray              tracer.Ray
+		minBouncesForNEE uint32
+		expOcclusionRays uint32
+	}{
+		// Singular surfaces never cast shadow rays
+		{mirrorRay, 0, 0},
+		// Shadow rays are only cast once the path reaches the minimum bounce
+		{diffuseRay, 1, 0},
+		{diffuseRay, 0, 1},
+	}
+
+	for index, spec := range specs {
+		_, err := tr.TraceRays([]tracer.Ray{spec.ray}, &tracer.BlockRequest{
+			SamplesPerPixel:  1,
+			NumBounces:       1,
+			MinBouncesForRR:  1,
+			MinBouncesForNEE: spec.minBouncesForNEE,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := readCounter(tr.resources, 2); got != spec.expOcclusionRays {
+			t.Errorf("[spec %d] expected shading the hit to emit %d occlusion ray(s); got %d", index, spec.expOcclusionRays, got)
+		}
+	}
+}
+
+func TestMonteCarloIntegratorFlatBaseNormalMap(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// Encode the latlong v coordinate of the background into its red
+	// channel so that the mirror reflection direction can be recovered
+	// from the reflected radiance.
+	dir := t.TempDir()
+	bgPath := filepath.Join(dir, "background.png")
+	writeTestTexture(t, bgPath, 16, 64, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: uint8(4 * y), A: 255}
+	})
+	normalMapPath := filepath.Join(dir, "normal.png")
+	writeTestTexture(t, normalMapPath, 2, 2, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: 160, G: 128, B: 255, A: 255}
+	})
+
+	// Render a mirror floor whose normal is perturbed by a constant
+	// normal map and return the latlong v coordinate of the reflected ray.
+	render := func(flatNormalMap bool, vertexNormal types.Vec3) float32 {
+		ps := input.NewScene()
+		mesh := addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, -1}, fmt.Sprintf("normalMap(conductor(specularity: {1, 1, 1}), %q)", normalMapPath))
+		ps.Materials[0].FlatNormalMap = flatNormalMap
+		for _, prim := range mesh.Primitives {
+			prim.Normals = [3]types.Vec3{vertexNormal, vertexNormal, vertexNormal}
+		}
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       compiler.SceneDiffuseMaterialName,
+			Expression: fmt.Sprintf("diffuse(reflectance: %q)", bgPath),
+			Used:       true,
+		})
+		uploadTestScene(t, tr, ps)
+
+		rays := []tracer.Ray{
+			{Origin: types.Vec3{0, 1, 0}, Dir: types.Vec3{0, -1, 0}},
+		}
+		results, err := tr.TraceRays(rays, &tracer.BlockRequest{
+			SamplesPerPixel: 1,
+			NumBounces:      2,
+			MinBouncesForRR: 2,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results[0].Radiance[0] * 255 / (4 * 64)
+	}
+
+	geometricNormal := types.Vec3{0, 1, 0}
+	tiltedNormal := types.Vec3{0, 1, 0.5}.Normalize()
+
+	exp := render(true, geometricNormal)
+	if exp < 0.1 {
+		t.Fatalf("expected the normal map to tilt the reflected ray away from the surface normal; got latlong v %f", exp)
+	}
+
+	if got := render(true, tiltedNormal); math.Abs(float64(got-exp)) > 1e-3 {
+		t.Errorf("expected a flat base normal map to ignore the vertex normals; got latlong v %f instead of %f", got, exp)
+	}
+
+	if got := render(false, tiltedNormal); math.Abs(float64(got-exp)) < 0.05 {
+		t.Errorf("expected a smooth base normal map to perturb the vertex normals; got latlong v %f", got)
+	}
+}
+
+func TestMonteCarloIntegratorSubsurfaceTerminator(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A subsurface floor partially covered by an occluder whose edge lies
+	// directly below a point light so the floor receives a hard shadow.
+	// Direct light is gathered at the point where light exits the surface
+	// so larger scatter distances should bleed light across the shadow
+	// terminator.
+	render := func(scatterRadius float32) []float32 {
+		ps := input.NewScene()
+		addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{0, 0, 5}, types.Vec3{5, 0, 0},
+			fmt.Sprintf("subsurface(scatterColor: {0.8, 0.8, 0.8}, scatterRadius: {%f, %f, %f})", scatterRadius, scatterRadius, scatterRadius),
+		)
+		addQuad(ps, types.Vec3{-5, 1, 0}, types.Vec3{0, 0, 5}, types.Vec3{5, 0, 0}, "diffuse(reflectance: {0, 0, 0})")
+		ps.PointLights = append(ps.PointLights, &input.PointLight{
+			Position:  types.Vec3{0, 2, 0},
+			Intensity: types.Vec3{10, 10, 10},
+		})
+		uploadTestScene(t, tr, ps)
+
+		var rays []tracer.Ray
+		for _, x := range []float32{-0.2, 0.2, 2} {
+			rays = append(rays, tracer.Ray{Origin: types.Vec3{x, 0.5, 0}, Dir: types.Vec3{0, -1, 0}})
+		}
+		results, err := tr.TraceRays(rays, &tracer.BlockRequest{SamplesPerPixel: 4096, NumBounces: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		radiance := make([]float32, len(results))
+		for index, res := range results {
+			radiance[index] = res.Radiance.MaxComponent()
+		}
+		return radiance
+	}
+
+	// Get the radiance difference across the terminator relative to the
+	// radiance of a fully lit point.
+	falloff := func(radiance []float32) float32 {
+		return (radiance[1] - radiance[0]) / radiance[2]
+	}
+
+	narrow := render(0.02)
+	wide := render(0.5)
+	if narrow[2] <= 0 || wide[2] <= 0 {
+		t.Fatalf("expected fully lit floor points to receive light; got %v and %v", narrow, wide)
+	}
+	if wide[0] <= narrow[0] {
+		t.Errorf("expected a larger scatter distance to bleed more light into the shadow; got %f and %f", narrow[0], wide[0])
+	}
+	if falloff(wide) >= 0.8*falloff(narrow) {
+		t.Errorf("expected a larger scatter distance to soften the terminator falloff; got %f and %f", falloff(narrow), falloff(wide))
+	}
+}
+
+func TestMonteCarloIntegratorIndirectReflectance(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A diffuse floor below a large emissive ceiling. The first ray hits
+	// the floor directly while the second one is deflected onto the floor
+	// by a small mirror so the floor is shaded at bounce 1. Rays reflected
+	// by the floor reach the ceiling with a throughput equal to the floor
+	// reflectance used at that bounce.
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, -1, 0}},
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{1, 0, 0}},
+	}
+
+	specs := []struct {
+		floorExpr   string
+		expRadiance []float32
+	}{
+		{"diffuse(reflectance: {0.5, 0.5, 0.5})", []float32{5, 5}},
+		{"diffuse(reflectance: {0.5, 0.5, 0.5}, indirectReflectance: {0.1, 0.1, 0.1})", []float32{5, 1}},
+	}
+
+	for specIndex, spec := range specs {
+		ps := input.NewScene()
+		addQuad(ps, types.Vec3{0, -1, 0}, types.Vec3{10, 0, 0}, types.Vec3{0, 0, -10}, spec.floorExpr)
+		addQuad(ps, types.Vec3{0, 9, 0}, types.Vec3{1000, 0, 0}, types.Vec3{0, 0, 1000}, "emissive(radiance: {10, 10, 10})")
+		addQuad(ps, types.Vec3{5, 0, 0}, types.Vec3{0, 0, 0.1}, types.Vec3{-0.1, 0.1, 0}, "conductor(specularity: {1, 1, 1})")
+		uploadTestScene(t, tr, ps)
+
+		results, err := tr.TraceRays(rays, &tracer.BlockRequest{
+			SamplesPerPixel: 256,
+			NumBounces:      3,
+			// Disable RR and NEE so the floor only gathers light via
+			// bxdf sampling
+			MinBouncesForRR:  3,
+			MinBouncesForNEE: 3,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for index, res := range results {
+			exp := spec.expRadiance[index]
+			if !types.ApproxEqual(res.Radiance, types.Vec3{exp, exp, exp}, 5e-2*exp) {
+				t.Errorf("[spec %d, ray %d] expected radiance to be %v; got %v", specIndex, index, exp, res.Radiance)
+			}
+		}
+	}
+}
+
+func TestMonteCarloIntegratorNormalMapTangentFrame(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+	fixture := newNormalMapFixture(t)
+
+	// The floor uvs increase along +x so the tangent calculated from the
+	// triangle edges points along +x. The specs that supply a tangent list
+	// override it with a tangent along -z whose bi-tangent is given by
+	// w * cross(normal, tangent) = w * (-1, 0, 0)
+	specs := []struct {
+		normalMap string
+		tangent   *types.Vec4
+		expU      float32
+	}{
+		{fixture.tangentMap, nil, 0.25},
+		{fixture.tangentMap, &types.Vec4{0, 0, -1, 1}, 0.5},
+		{fixture.bitangentMap, &types.Vec4{0, 0, -1, 1}, 0.75},
+		{fixture.bitangentMap, &types.Vec4{0, 0, -1, -1}, 0.25},
+	}
+
+	for index, spec := range specs {
+		ps, _ := fixture.scene(spec.normalMap)
+		sc, _, err := compiler.Compile(ps, compiler.DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spec.tangent == nil {
+			sc.TangentList = nil
+		} else {
+			for vertex := range sc.TangentList {
+				sc.TangentList[vertex] = *spec.tangent
+			}
+		}
+		err = tr.UploadScene(sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if gotU := fixture.reflectedU(tr); math.Abs(float64(gotU-spec.expU)) > 2e-2 {
+			t.Errorf("[spec %d] expected reflected ray latlong u to be %f; got %f", index, spec.expU, gotU)
+		}
+	}
+}
+
+func TestMonteCarloIntegratorImportedTangents(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+	fixture := newNormalMapFixture(t)
+
+	// Tangents supplied by the scene reader (e.g. glTF TANGENT accessors)
+	// take precedence over the tangents calculated from the floor uvs and
+	// their w coordinate selects the bi-tangent direction.
+	specs := []struct {
+		normalMap string
+		tangent   types.Vec4
+		expU      float32
+	}{
+		{fixture.tangentMap, types.Vec4{0, 0, -1, 1}, 0.5},
+		{fixture.bitangentMap, types.Vec4{0, 0, -1, 1}, 0.75},
+		{fixture.bitangentMap, types.Vec4{0, 0, -1, -1}, 0.25},
+	}
+
+	for index, spec := range specs {
+		ps, mesh := fixture.scene(spec.normalMap)
+		for _, prim := range mesh.Primitives {
+			prim.Tangents = [3]types.Vec4{spec.tangent, spec.tangent, spec.tangent}
+			prim.HasTangents = true
+		}
+		uploadTestScene(t, tr, ps)
+
+		if gotU := fixture.reflectedU(tr); math.Abs(float64(gotU-spec.expU)) > 2e-2 {
+			t.Errorf("[spec %d] expected reflected ray latlong u to be %f; got %f", index, spec.expU, gotU)
+		}
+	}
+}
+
+// Textures for testing the tangent frame used by normal maps.
+type normalMapFixture struct {
+	t *testing.T
+
+	// A background whose green channel encodes the latlong u coordinate
+	// so that the azimuth of a reflected ray can be recovered from the
+	// reflected radiance.
+	background string
+
+	// Normal maps that tilt the normal towards the tangent and bi-tangent.
+	tangentMap   string
+	bitangentMap string
+}
+
+func newNormalMapFixture(t *testing.T) *normalMapFixture {
+	dir := t.TempDir()
+	f := &normalMapFixture{
+		t:            t,
+		background:   filepath.Join(dir, "background.png"),
+		tangentMap:   filepath.Join(dir, "tangent.png"),
+		bitangentMap: filepath.Join(dir, "bitangent.png"),
+	}
+
+	writeTestTexture(t, f.background, 16, 64, func(x, y int) color.NRGBA {
+		return color.NRGBA{G: uint8(16 * x), A: 255}
+	})
+	writeTestTexture(t, f.tangentMap, 2, 2, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: 160, G: 128, B: 255, A: 255}
+	})
+	writeTestTexture(t, f.bitangentMap, 2, 2, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: 128, G: 160, B: 255, A: 255}
+	})
+	return f
+}
+
+// Generate a scene with a mirror floor that uses the given normal map. The
+// floor normal points along +y and its uvs increase along +x and -z.
+func (f *normalMapFixture) scene(normalMap string) (*input.Scene, *input.Mesh) {
+	ps := input.NewScene()
+	mesh := addQuad(ps, types.Vec3{0, 0, 0}, types.Vec3{1, 0, 0}, types.Vec3{0, 0, -1}, fmt.Sprintf("normalMap(conductor(specularity: {1, 1, 1}), %q)", normalMap))
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       compiler.SceneDiffuseMaterialName,
+		Expression: fmt.Sprintf("diffuse(reflectance: %q)", f.background),
+		Used:       true,
+	})
+	return ps, mesh
+}
+
+// Trace a ray straight down onto the floor and return the latlong u
+// coordinate of the reflected ray.
+func (f *normalMapFixture) reflectedU(tr *Tracer) float32 {
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{0, 1, 0}, Dir: types.Vec3{0, -1, 0}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{
+		SamplesPerPixel: 1,
+		NumBounces:      2,
+		MinBouncesForRR: 2,
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return results[0].Radiance[1] * 255 / (16 * 16)
+}
@@ -5,6 +5,8 @@ import (
 	"math"
 	"time"
 
+	"github.com/achilleasa/gopencl/v1.2/cl"
+	"github.com/achilleasa/polaris/asset/scene"
 	"github.com/achilleasa/polaris/tracer"
 	"github.com/achilleasa/polaris/tracer/opencl/device"
 	"github.com/achilleasa/polaris/types"
@@ -25,6 +27,17 @@ type deviceResources struct {
 
 	// The set of kernels.
 	kernels []*device.Kernel
+
+	// The dimensions of the uploaded blue-noise texture. Zero dimensions
+	// indicate that primary rays use white noise sample offsets.
+	blueNoiseW uint32
+	blueNoiseH uint32
+
+	// Set to 1 if the uploaded scene stores its vertices in indexed form.
+	indexed uint32
+
+	// Set to 1 if the uploaded scene defines per-vertex tangents.
+	hasTangents uint32
 }
 
 // Using the supplied device as a target, load and compile all defined kernels.
@@ -60,6 +73,34 @@ func (dr *deviceResources) ResizeBuffers(frameW, frameH uint32) error {
 	return dr.buffers.Resize(frameW, frameH)
 }
 
+// Upload the blue-noise texture used for generating primary ray sample offsets.
+// If the texture is nil, a placeholder texel is uploaded instead and primary
+// rays fall back to white noise sample offsets.
+func (dr *deviceResources) UploadBlueNoise(bn *tracer.BlueNoise) error {
+	if bn == nil {
+		dr.blueNoiseW, dr.blueNoiseH = 0, 0
+		return dr.buffers.BlueNoise.AllocateAndWriteData([]types.Vec2{{0, 0}}, cl.MEM_READ_ONLY)
+	}
+
+	dr.blueNoiseW, dr.blueNoiseH = bn.Width, bn.Height
+	return dr.buffers.BlueNoise.AllocateAndWriteData(bn.Data, cl.MEM_READ_ONLY)
+}
+
+// Upload the color lookup table used for grading the tone-mapped output. If
+// the table is nil, a placeholder entry is uploaded instead.
+func (dr *deviceResources) UploadColorLUT(lut *tracer.ColorLUT) error {
+	if lut == nil {
+		return dr.buffers.ColorLUT.AllocateAndWriteData([]types.Vec4{{0, 0, 0, 0}}, cl.MEM_READ_ONLY)
+	}
+
+	// Pad entries to float4 to match the opencl float3 alignment
+	data := make([]types.Vec4, len(lut.Data))
+	for index, entry := range lut.Data {
+		data[index] = entry.Vec4(0)
+	}
+	return dr.buffers.ColorLUT.AllocateAndWriteData(data, cl.MEM_READ_ONLY)
+}
+
 // Release all allocated resources.
 func (dr *deviceResources) Close() {
 	if dr.buffers != nil {
@@ -123,8 +164,128 @@ func (dr *deviceResources) AggregateAccumulator(srcAccumulator *device.Buffer, b
 	)
 }
 
-// Generate primary rays.
-func (dr *deviceResources) GeneratePrimaryRays(blockReq *tracer.BlockRequest, cameraEyePos types.Vec3, cameraFrustrum [4]types.Vec4) (time.Duration, error) {
+// Upload the linear RGBA values of a procedural test pattern for a frame
+// with the given dimensions.
+func (dr *deviceResources) UploadTestPattern(pattern tracer.TestPattern, frameW, frameH uint32) error {
+	data := make([]float32, 4*frameW*frameH)
+	err := pattern.Fill(data, frameW, frameH)
+	if err != nil {
+		return err
+	}
+	return dr.buffers.TestPattern.AllocateAndWriteData(data, cl.MEM_READ_ONLY)
+}
+
+// Add the uploaded test pattern values for the block specified by blockReq
+// into the trace accumulator.
+func (dr *deviceResources) AccumulateTestPattern(blockReq *tracer.BlockRequest) (time.Duration, error) {
+	kernel := dr.kernels[aggregateAccumulator]
+	err := kernel.SetArgs(
+		dr.buffers.TestPattern,
+		dr.buffers.TraceAccumulator,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1DNoWait(
+		int(blockReq.FrameW*blockReq.BlockY),
+		int(blockReq.BlockW*blockReq.BlockH),
+		0,
+	)
+}
+
+// Clear an AOV buffer.
+func (dr *deviceResources) ClearAovs(aovs *device.Buffer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+	kernel := dr.kernels[clearAccumulator]
+	err := kernel.SetArgs(
+		aovs,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// Each AOV sample is made up of 3 float3 values
+	return kernel.Exec1D(0, 3*int(blockReq.FrameW*blockReq.FrameH), 0)
+}
+
+// Aggregate the trace AOV contents from another tracer into this tracer's
+// frame AOV buffer.
+func (dr *deviceResources) AggregateAovs(srcAovs *device.Buffer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+	kernel := dr.kernels[aggregateAccumulator]
+	err := kernel.SetArgs(
+		srcAovs,
+		dr.buffers.FrameAovs,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1DNoWait(
+		3*int(blockReq.FrameW*blockReq.BlockY),
+		3*int(blockReq.BlockW*blockReq.BlockH),
+		0,
+	)
+}
+
+// Clear a variance estimator or snapshot buffer.
+func (dr *deviceResources) ClearVariance(variance *device.Buffer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+	kernel := dr.kernels[clearAccumulator]
+	err := kernel.SetArgs(
+		variance,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1D(0, int(blockReq.FrameW*blockReq.FrameH), 0)
+}
+
+// Update the trace variance estimators with the sample that was added to the
+// trace accumulator by the last integrator pass.
+func (dr *deviceResources) AccumulateVariance(blockReq *tracer.BlockRequest) (time.Duration, error) {
+	kernel := dr.kernels[accumulateVariance]
+	err := kernel.SetArgs(
+		dr.buffers.TraceAccumulator,
+		dr.buffers.TraceSnapshot,
+		dr.buffers.TraceVariance,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1D(
+		int(blockReq.FrameW*blockReq.BlockY),
+		int(blockReq.BlockW*blockReq.BlockH),
+		0,
+	)
+}
+
+// Combine the trace variance estimators from another tracer with this
+// tracer's frame variance estimators.
+func (dr *deviceResources) AggregateVariance(srcVariance *device.Buffer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+	kernel := dr.kernels[aggregateVariance]
+	err := kernel.SetArgs(
+		srcVariance,
+		dr.buffers.FrameVariance,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1DNoWait(
+		int(blockReq.FrameW*blockReq.BlockY),
+		int(blockReq.BlockW*blockReq.BlockH),
+		0,
+	)
+}
+
+// Generate primary rays. The jitter value offsets the sample position of
+// each pixel while the lens attributes control depth of field. For
+// orthographic projections, the frustrum contains the corner ray origin
+// offsets and all rays are parallel to the lens forward axis. For panoramic
+// projections, the frustrum contains the corner coordinates in projection
+// space.
+func (dr *deviceResources) GeneratePrimaryRays(blockReq *tracer.BlockRequest, cameraEyePos types.Vec3, cameraFrustrum [4]types.Vec4, lens thinLens, projection scene.Projection, jitter types.Vec2) (time.Duration, error) {
 	kernel := dr.kernels[generatePrimaryRays]
 
 	texelDims := types.Vec2{
@@ -132,6 +293,12 @@ func (dr *deviceResources) GeneratePrimaryRays(blockReq *tracer.BlockRequest, ca
 		1.0 / float32(blockReq.FrameH),
 	}
 
+	var cropX uint32
+	if blockReq.Crop.IsSet() {
+		cropX = blockReq.Crop.X
+	}
+	rowWidth := blockReq.RowWidth()
+
 	err := kernel.SetArgs(
 		dr.buffers.Rays[0],
 		dr.buffers.RayCounters[0],
@@ -144,22 +311,35 @@ func (dr *deviceResources) GeneratePrimaryRays(blockReq *tracer.BlockRequest, ca
 		texelDims,
 		blockReq.BlockY,
 		blockReq.BlockH,
+		cropX,
+		rowWidth,
 		blockReq.FrameW,
 		blockReq.FrameH,
 		blockReq.Seed,
+		dr.buffers.BlueNoise,
+		dr.blueNoiseW,
+		dr.blueNoiseH,
+		jitter,
+		lens.U,
+		lens.V,
+		lens.Forward,
+		lens.FocalDistance,
+		uint32(projection),
+		lens.Right,
+		lens.Up,
 	)
 	if err != nil {
 		return 0, err
 	}
 
-	return kernel.Exec2D(0, 0, int(blockReq.FrameW), int(blockReq.BlockH), 0, 0)
+	return kernel.Exec2D(0, 0, int(rowWidth), int(blockReq.BlockH), 0, 0)
 }
 
 // Test for ray intersection. This method will update the hit buffer to indicate
 // whether each ray intersects with the scene geometry or not. This method is
 // much faster than an intersection query as it terminates on the first found
 // intersection and does not evaulate intersection data.
-func (dr *deviceResources) RayIntersectionTest(rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+func (dr *deviceResources) RayIntersectionTest(intersectionEpsilon float32, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
 	kernel := dr.kernels[rayIntersectionTest]
 
 	err := kernel.SetArgs(
@@ -168,7 +348,10 @@ func (dr *deviceResources) RayIntersectionTest(rayBufferIndex uint32, numPixels
 		dr.buffers.BvhNodes,
 		dr.buffers.MeshInstances,
 		dr.buffers.Vertices,
+		dr.buffers.Indices,
+		dr.indexed,
 		dr.buffers.HitFlags,
+		intersectionEpsilon,
 	)
 	if err != nil {
 		return 0, err
@@ -179,7 +362,7 @@ func (dr *deviceResources) RayIntersectionTest(rayBufferIndex uint32, numPixels
 
 // Calculate ray intersections and fill out the hit buffer and the intersection
 // buffer with intersection data for the closest ray/triangle intersection.
-func (dr *deviceResources) RayIntersectionQuery(rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+func (dr *deviceResources) RayIntersectionQuery(intersectionEpsilon float32, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
 	kernel := dr.kernels[rayIntersectionQuery]
 
 	err := kernel.SetArgs(
@@ -188,8 +371,11 @@ func (dr *deviceResources) RayIntersectionQuery(rayBufferIndex uint32, numPixels
 		dr.buffers.BvhNodes,
 		dr.buffers.MeshInstances,
 		dr.buffers.Vertices,
+		dr.buffers.Indices,
+		dr.indexed,
 		dr.buffers.HitFlags,
 		dr.buffers.Intersections,
+		intersectionEpsilon,
 	)
 	if err != nil {
 		return 0, err
@@ -201,7 +387,7 @@ func (dr *deviceResources) RayIntersectionQuery(rayBufferIndex uint32, numPixels
 // Calculate ray intersections and fill out the hit buffer and the intersection
 // buffer with intersection data for the closest ray/triangle intersection.
 // This kernel works with ray packets and should only be used for primary rays.
-func (dr *deviceResources) RayPacketIntersectionQuery(rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+func (dr *deviceResources) RayPacketIntersectionQuery(intersectionEpsilon float32, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
 	kernel := dr.kernels[rayPacketIntersectionQuery]
 
 	err := kernel.SetArgs(
@@ -210,8 +396,11 @@ func (dr *deviceResources) RayPacketIntersectionQuery(rayBufferIndex uint32, num
 		dr.buffers.BvhNodes,
 		dr.buffers.MeshInstances,
 		dr.buffers.Vertices,
+		dr.buffers.Indices,
+		dr.indexed,
 		dr.buffers.HitFlags,
 		dr.buffers.Intersections,
+		intersectionEpsilon,
 	)
 	if err != nil {
 		return 0, err
@@ -222,8 +411,9 @@ func (dr *deviceResources) RayPacketIntersectionQuery(rayBufferIndex uint32, num
 
 // Evaluate shading for intersections. For each intersection, this kernel may
 // generate an occlusion ray and a emissive sample as well as an indirect
-// ray to be used for future bounces.
-func (dr *deviceResources) ShadeHits(bounce, minBouncesForRR, randSeed, numEmissives, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+// ray to be used for future bounces. If allDiffuse is set, the kernel assumes
+// that all scene surfaces are diffuse and bypasses the bxdf dispatcher.
+func (dr *deviceResources) ShadeHits(bounce, minBouncesForRR, minBouncesForNEE, randSeed uint32, maxThroughput float32, allDiffuse, hasPrimitiveOpacity bool, medium *scene.Medium, dome *scene.Dome, intersectionEpsilon float32, numEmissives, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
 	kernel := dr.kernels[shadeHits]
 
 	// Clear indirect ray counters
@@ -237,24 +427,47 @@ func (dr *deviceResources) ShadeHits(bounce, minBouncesForRR, randSeed, numEmiss
 		return 0, err
 	}
 
+	var allDiffuseFlag, primitiveOpacityFlag uint32
+	if allDiffuse {
+		allDiffuseFlag = 1
+	}
+	if hasPrimitiveOpacity {
+		primitiveOpacityFlag = 1
+	}
+
 	err = kernel.SetArgs(
 		dr.buffers.Rays[rayBufferIndex],
 		dr.buffers.RayCounters[rayBufferIndex],
 		dr.buffers.Paths,
 		dr.buffers.HitFlags,
 		dr.buffers.Intersections,
+		dr.buffers.MeshInstances,
+		dr.buffers.InstanceAttributes,
 		dr.buffers.Vertices,
 		dr.buffers.Normals,
 		dr.buffers.UV,
+		dr.buffers.Tangents,
+		dr.hasTangents,
+		dr.buffers.Indices,
+		dr.indexed,
 		dr.buffers.MaterialIndices,
 		dr.buffers.MaterialNodes,
 		dr.buffers.EmissivePrimitives,
 		numEmissives,
+		dr.buffers.PrimitiveOpacity,
+		primitiveOpacityFlag,
 		dr.buffers.TextureMetadata,
 		dr.buffers.Textures,
 		bounce,
 		minBouncesForRR,
+		minBouncesForNEE,
 		randSeed,
+		maxThroughput,
+		allDiffuseFlag,
+		medium.Albedo.Vec4(medium.Extinction),
+		medium.G,
+		types.Vec4{dome.Radius, dome.GroundHeight, 0, 0},
+		intersectionEpsilon,
 		// Occlusion rays and emissive samples
 		dr.buffers.Rays[2], // occlusion rays always go to last ray buf
 		dr.buffers.RayCounters[2],
@@ -274,8 +487,9 @@ func (dr *deviceResources) ShadeHits(bounce, minBouncesForRR, randSeed, numEmiss
 
 // Shade primary ray misses by sampling the scene background. This kernel samples
 // the background color or envmap using the ray direction and sets the
-// accumulator to the sampled value.
-func (dr *deviceResources) ShadePrimaryRayMisses(diffuseMatNodeIndex, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+// accumulator to the sampled value. If a dome is defined, the sampled value is
+// attenuated by the medium transmittance along the ray segment to the dome.
+func (dr *deviceResources) ShadePrimaryRayMisses(diffuseMatNodeIndex uint32, dome *scene.Dome, medium *scene.Medium, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
 	kernel := dr.kernels[shadePrimaryRayMisses]
 
 	err := kernel.SetArgs(
@@ -285,6 +499,8 @@ func (dr *deviceResources) ShadePrimaryRayMisses(diffuseMatNodeIndex, rayBufferI
 		dr.buffers.HitFlags,
 		dr.buffers.MaterialNodes,
 		diffuseMatNodeIndex,
+		types.Vec4{dome.Radius, dome.GroundHeight, 0, 0},
+		medium.Extinction,
 		dr.buffers.TextureMetadata,
 		dr.buffers.Textures,
 		dr.buffers.TraceAccumulator,
@@ -299,7 +515,7 @@ func (dr *deviceResources) ShadePrimaryRayMisses(diffuseMatNodeIndex, rayBufferI
 // Shade indirect ray misses by sampling the scene background. The main difference
 // with ShadePrimaryRayMisses is that this kernel multiplies the path throughput
 // with the bg sample and adds that to the accumulator.
-func (dr *deviceResources) ShadeIndirectRayMisses(diffuseMatNodeIndex, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+func (dr *deviceResources) ShadeIndirectRayMisses(diffuseMatNodeIndex uint32, dome *scene.Dome, medium *scene.Medium, rayBufferIndex uint32, numPixels int) (time.Duration, error) {
 	kernel := dr.kernels[shadeIndirectRayMisses]
 
 	err := kernel.SetArgs(
@@ -309,6 +525,8 @@ func (dr *deviceResources) ShadeIndirectRayMisses(diffuseMatNodeIndex, rayBuffer
 		dr.buffers.HitFlags,
 		dr.buffers.MaterialNodes,
 		diffuseMatNodeIndex,
+		types.Vec4{dome.Radius, dome.GroundHeight, 0, 0},
+		medium.Extinction,
 		dr.buffers.TextureMetadata,
 		dr.buffers.Textures,
 		dr.buffers.TraceAccumulator,
@@ -340,6 +558,37 @@ func (dr *deviceResources) AccumulateEmissiveSamples(rayBufferIndex uint32, numP
 	return kernel.Exec1D(0, numPixels, 0)
 }
 
+// Accumulate depth, normal and albedo AOVs for primary ray intersections.
+func (dr *deviceResources) AccumulateAovs(rayBufferIndex uint32, numPixels int) (time.Duration, error) {
+	kernel := dr.kernels[accumulateAovs]
+
+	err := kernel.SetArgs(
+		dr.buffers.Rays[rayBufferIndex],
+		dr.buffers.RayCounters[rayBufferIndex],
+		dr.buffers.Paths,
+		dr.buffers.HitFlags,
+		dr.buffers.Intersections,
+		dr.buffers.MeshInstances,
+		dr.buffers.Vertices,
+		dr.buffers.Normals,
+		dr.buffers.UV,
+		dr.buffers.Tangents,
+		dr.hasTangents,
+		dr.buffers.Indices,
+		dr.indexed,
+		dr.buffers.MaterialIndices,
+		dr.buffers.MaterialNodes,
+		dr.buffers.TextureMetadata,
+		dr.buffers.Textures,
+		dr.buffers.TraceAovs,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1D(0, numPixels, 0)
+}
+
 // Perform tone-mapping using a simple version of Reinhard.
 func (dr *deviceResources) TonemapSimpleReinhard(blockReq *tracer.BlockRequest) (time.Duration, error) {
 	kernel := dr.kernels[tonemapSimpleReinhard]
@@ -359,6 +608,25 @@ func (dr *deviceResources) TonemapSimpleReinhard(blockReq *tracer.BlockRequest)
 	return kernel.Exec1D(0, numPixels, 0)
 }
 
+// Grade the tone-mapped framebuffer using a color lookup table.
+func (dr *deviceResources) ApplyColorLUT(blockReq *tracer.BlockRequest, lut *tracer.ColorLUT) (time.Duration, error) {
+	kernel := dr.kernels[applyColorLUT]
+	numPixels := int(blockReq.FrameW * blockReq.BlockH)
+	err := kernel.SetArgs(
+		dr.buffers.FrameBuffer,
+		dr.buffers.ColorLUT,
+		lut.Dimensions,
+		lut.Size,
+		lut.DomainMin,
+		lut.DomainMax,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return kernel.Exec1D(0, numPixels, 0)
+}
+
 // Clear debug buffer
 func (dr *deviceResources) DebugClearBuffer(blockReq *tracer.BlockRequest) (time.Duration, error) {
 	kernel := dr.kernels[debugClearBuffer]
@@ -437,6 +705,10 @@ func (dr *deviceResources) DebugRayIntersectionNormals(blockReq *tracer.BlockReq
 		dr.buffers.Vertices,
 		dr.buffers.Normals,
 		dr.buffers.UV,
+		dr.buffers.Tangents,
+		dr.hasTangents,
+		dr.buffers.Indices,
+		dr.indexed,
 		dr.buffers.MaterialIndices,
 		dr.buffers.MaterialNodes,
 		dr.buffers.TextureMetadata,
@@ -0,0 +1,188 @@
+package opencl
+
+import (
+	"fmt"
+
+	"github.com/achilleasa/gopencl/v1.2/cl"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/asset/texure"
+	"github.com/achilleasa/polaris/tracer"
+)
+
+// The format of textures that are not resident on the device. This value must
+// match TEX_FMT_NON_RESIDENT in the texture sampler.
+const texFmtNonResident = texture.Udim + 1
+
+// The device representation of the scene texture metadata. It extends the
+// scene texture metadata with a flag that is set by the texture samplers
+// whenever a texture is sampled.
+type deviceTextureMetadata struct {
+	scene.TextureMetadata
+	Sampled uint32
+}
+
+// A tracer.TextureStore implementation that keeps a subset of the scene
+// textures resident on the device. Whenever the resident texture set changes,
+// the data of the resident textures is packed into a new buffer which is
+// uploaded to the device together with the updated texture metadata.
+// Non-resident textures are flagged using the texFmtNonResident format and
+// are sampled as black until they become resident.
+type textureResidency struct {
+	sc *scene.Scene
+
+	// The texture cache is nil if all scene textures fit in the budget.
+	cache    *tracer.TextureCache
+	resident []bool
+	dirty    bool
+
+	// The uploaded texture data and metadata. Device buffers alias these
+	// slices so they must be retained while the buffers are in use.
+	data     []byte
+	metadata []deviceTextureMetadata
+}
+
+// Create a texture residency manager for the scene textures. If the budget is
+// zero or all scene textures fit in the budget, all textures are permanently
+// resident. Otherwise, textures are made resident in index order until the
+// budget is exhausted.
+func newTextureResidency(sc *scene.Scene, budget uint64) (*textureResidency, error) {
+	r := &textureResidency{
+		sc:       sc,
+		resident: make([]bool, len(sc.TextureMetadata)),
+		dirty:    true,
+	}
+
+	var totalSize uint64
+	sizes := make([]uint64, len(sc.TextureMetadata))
+	for texIndex := range sc.TextureMetadata {
+		sizes[texIndex] = sc.TextureMetadata[texIndex].DataSize()
+		if budget != 0 && sizes[texIndex] > budget {
+			return nil, fmt.Errorf("texture %d requires %d bytes which exceeds the texture budget of %d bytes", texIndex, sizes[texIndex], budget)
+		}
+		totalSize += sizes[texIndex]
+	}
+
+	if budget == 0 || totalSize <= budget {
+		for texIndex := range r.resident {
+			r.resident[texIndex] = true
+		}
+		return r, nil
+	}
+
+	r.cache = tracer.NewTextureCache(budget, sizes, r)
+	for texIndex, size := range sizes {
+		if r.cache.ResidentBytes()+size > budget {
+			continue
+		}
+		if _, err := r.cache.Touch(uint32(texIndex)); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// Flag a texture as resident.
+func (r *textureResidency) Load(texIndex uint32) error {
+	r.resident[texIndex] = true
+	r.dirty = true
+	return nil
+}
+
+// Flag a texture as non-resident.
+func (r *textureResidency) Evict(texIndex uint32) error {
+	r.resident[texIndex] = false
+	r.dirty = true
+	return nil
+}
+
+// Upload the resident texture data and the texture metadata to the device.
+func (r *textureResidency) Upload(bs *bufferSet) error {
+	r.metadata = make([]deviceTextureMetadata, len(r.sc.TextureMetadata))
+	if r.cache == nil {
+		r.data = r.sc.TextureData
+		for texIndex, meta := range r.sc.TextureMetadata {
+			r.metadata[texIndex].TextureMetadata = meta
+		}
+	} else {
+		r.data = make([]byte, 0, r.cache.ResidentBytes())
+		for texIndex, meta := range r.sc.TextureMetadata {
+			if !r.resident[texIndex] {
+				meta.Format = texFmtNonResident
+				r.metadata[texIndex].TextureMetadata = meta
+				continue
+			}
+
+			// Keep texture data aligned to the texture format alignment
+			for len(r.data)%meta.Format.Alignment() != 0 {
+				r.data = append(r.data, 0)
+			}
+			r.data = append(r.data, r.sc.TextureData[meta.DataOffset:uint64(meta.DataOffset)+meta.DataSize()]...)
+			meta.DataOffset = uint32(len(r.data)) - uint32(meta.DataSize())
+			r.metadata[texIndex].TextureMetadata = meta
+		}
+	}
+
+	err := bs.Textures.AllocateAndWriteData(r.data, cl.MEM_READ_ONLY)
+	if err != nil {
+		return err
+	}
+
+	// The samplers write the sampled flag to the metadata buffer
+	err = bs.TextureMetadata.AllocateAndWriteData(r.metadata, cl.MEM_READ_WRITE)
+	if err != nil {
+		return err
+	}
+
+	r.dirty = false
+	return nil
+}
+
+// Read back the sampled texture flags, update the texture cache and upload
+// any changes to the resident texture set. Resident textures are touched
+// before non-resident textures so that textures sampled by the last render
+// pass are less likely to be evicted. This method returns the number of
+// loaded textures.
+func (r *textureResidency) Sync(bs *bufferSet) (int, error) {
+	if r.cache == nil || len(r.metadata) == 0 {
+		return 0, nil
+	}
+
+	err := bs.TextureMetadata.ReadData(0, 0, 0, r.metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	var loaded int
+	sampled := false
+	for _, residentPass := range []bool{true, false} {
+		for texIndex := range r.metadata {
+			if r.metadata[texIndex].Sampled == 0 || r.cache.IsResident(uint32(texIndex)) != residentPass {
+				continue
+			}
+
+			sampled = true
+			wasLoaded, err := r.cache.Touch(uint32(texIndex))
+			if err != nil {
+				return loaded, err
+			}
+			if wasLoaded {
+				loaded++
+			}
+		}
+	}
+
+	if r.dirty {
+		return loaded, r.Upload(bs)
+	}
+
+	// Reset the sampled flags for the next render pass
+	if sampled {
+		for texIndex := range r.metadata {
+			r.metadata[texIndex].Sampled = 0
+		}
+		return loaded, bs.TextureMetadata.WriteData(r.metadata, 0)
+	}
+
+	return loaded, nil
+}
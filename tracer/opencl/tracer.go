@@ -2,11 +2,11 @@ package opencl
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"path"
 	"runtime"
 	"sync"
-	"time"
 
 	"github.com/achilleasa/gopencl/v1.2/cl"
 	"github.com/achilleasa/polaris/asset/scene"
@@ -16,6 +16,9 @@ import (
 	"github.com/achilleasa/polaris/types"
 )
 
+// An opencl implementation of the tracer.Backend interface. Tracer instances
+// are wrapped by a tracer.BackendTracer which implements the tracer.Tracer
+// interface.
 type Tracer struct {
 	logger log.Logger
 
@@ -33,25 +36,24 @@ type Tracer struct {
 	// The allocated device resources.
 	resources *deviceResources
 
-	// The tracer id.
-	id string
-
-	// A buffer for asynchronous updates. Updates are grouped by type and
-	// latest updates always overwrite the previous ones.
-	changeBuffer map[tracer.ChangeType]interface{}
-
-	// Statistics for last rendered frame.
-	stats *tracer.Stats
-
 	// The tracer rendering pipeline.
 	pipeline *Pipeline
 
 	// The uploaded optimized scene data.
 	sceneData *scene.Scene
 
+	// The manager for the scene textures that are resident on the device.
+	textures *textureResidency
+
 	// Camera attributes
-	cameraPosition types.Vec3
-	cameraFrustrum scene.Frustrum
+	cameraPosition   types.Vec3
+	cameraFrustrum   scene.Frustrum
+	cameraLens       thinLens
+	cameraProjection scene.Projection
+
+	// The generator for the random values used while tracing the current
+	// request. It is reseeded from each block request.
+	rng *rand.Rand
 }
 
 // Create a new opencl tracer.
@@ -59,25 +61,17 @@ func NewTracer(id string, device *device.Device, ctx *cl.Context, pipeline *Pipe
 	loggerName := fmt.Sprintf("opencl tracer (%s)", device.Name)
 
 	tr := &Tracer{
-		logger:       log.New(loggerName),
-		device:       device,
-		id:           id,
-		changeBuffer: make(map[tracer.ChangeType]interface{}, 0),
-		stats:        &tracer.Stats{},
-		pipeline:     pipeline,
-		ctx:          ctx,
+		logger:   log.New(loggerName),
+		device:   device,
+		pipeline: pipeline,
+		ctx:      ctx,
 	}
 
-	return tr, nil
-}
-
-// Get tracer id.
-func (tr *Tracer) Id() string {
-	return tr.id
+	return tracer.NewBackendTracer(id, tr.flags(), device.Speed, tr), nil
 }
 
 // Get tracer flags.
-func (tr *Tracer) Flags() tracer.Flag {
+func (tr *Tracer) flags() tracer.Flag {
 	flags := tracer.Local
 	if tr.device.Type == device.CpuDevice {
 		flags |= tracer.CpuDevice
@@ -86,11 +80,6 @@ func (tr *Tracer) Flags() tracer.Flag {
 	return flags
 }
 
-// Get the computation speed estimate (in GFlops).
-func (tr *Tracer) Speed() uint32 {
-	return tr.device.Speed
-}
-
 // Initialize tracer
 func (tr *Tracer) Init() error {
 	var err error
@@ -113,6 +102,18 @@ func (tr *Tracer) Init() error {
 		return err
 	}
 
+	err = tr.resources.UploadBlueNoise(tr.pipeline.BlueNoise)
+	if err != nil {
+		tr.cleanup()
+		return err
+	}
+
+	err = tr.resources.UploadColorLUT(tr.pipeline.ColorLUT)
+	if err != nil {
+		tr.cleanup()
+		return err
+	}
+
 	return nil
 }
 
@@ -139,93 +140,95 @@ func (tr *Tracer) cleanup() {
 	}
 
 	tr.sceneData = nil
+	tr.textures = nil
 }
 
-// Retrieve last frame statistics.
-func (tr *Tracer) Stats() *tracer.Stats {
-	return tr.stats
+// Resize the device buffers to fit the frame dimensions.
+func (tr *Tracer) Resize(frameW, frameH uint32) error {
+	return tr.resources.ResizeBuffers(frameW, frameH)
 }
 
-// Update tracer state
-func (tr *Tracer) UpdateState(mode tracer.UpdateMode, changeType tracer.ChangeType, data interface{}) (time.Duration, error) {
-	tr.changeBuffer[changeType] = data
-
-	if mode == tracer.Synchronous {
-		return tr.commitChanges()
+// Upload the optimized scene data to the device.
+func (tr *Tracer) UploadScene(sc *scene.Scene) error {
+	tr.sceneData = sc
+	err := tr.resources.buffers.UploadSceneData(sc)
+	if err != nil {
+		return err
 	}
 
-	return time.Duration(0), nil
-}
-
-// Commit queued state changes.
-func (tr *Tracer) commitChanges() (time.Duration, error) {
-	if len(tr.changeBuffer) == 0 {
-		return 0, nil
+	tr.resources.indexed = 0
+	if sc.IsIndexed() {
+		tr.resources.indexed = 1
 	}
 
-	var err error
-	start := time.Now()
-	for changeType, data := range tr.changeBuffer {
-		switch changeType {
-		case tracer.FrameDimensions:
-			dims := data.([2]uint32)
-			err = tr.resources.ResizeBuffers(dims[0], dims[1])
-		case tracer.SceneData:
-			tr.sceneData = data.(*scene.Scene)
-			err = tr.resources.buffers.UploadSceneData(tr.sceneData)
-		case tracer.CameraData:
-			camera := data.(*scene.Camera)
-			tr.cameraPosition = camera.Position
-			tr.cameraFrustrum = camera.Frustrum
-		default:
-			err = fmt.Errorf("unsupported change type %d", changeType)
-		}
+	tr.resources.hasTangents = 0
+	if len(sc.TangentList) != 0 {
+		tr.resources.hasTangents = 1
+	}
 
-		if err != nil {
-			return time.Since(start), err
-		}
+	tr.textures, err = newTextureResidency(sc, tr.pipeline.TextureBudget)
+	if err != nil {
+		return err
 	}
+	return tr.textures.Upload(tr.resources.buffers)
+}
 
-	tr.changeBuffer = make(map[tracer.ChangeType]interface{}, 0)
-	return time.Since(start), nil
+// Update the camera used by the primary ray generation stage.
+func (tr *Tracer) UploadCamera(camera *scene.Camera) error {
+	tr.cameraPosition = camera.Position
+	tr.cameraFrustrum = camera.Frustrum
+	tr.cameraLens = newThinLens(camera)
+	tr.cameraProjection = camera.Projection
+	return nil
 }
 
-// Process block request.
-func (tr *Tracer) Trace(blockReq *tracer.BlockRequest) (time.Duration, error) {
+// Trace the block request using the tracer pipeline.
+func (tr *Tracer) Render(blockReq *tracer.BlockRequest) error {
 	var err error
-	start := time.Now()
-
-	_, err = tr.commitChanges()
-	if err != nil {
-		return time.Since(start), err
-	}
 
 	if tr.sceneData == nil {
-		return time.Since(start), ErrNoSceneData
+		return ErrNoSceneData
 	}
 
 	// If we have reset our sample counter, reset the accumulator
 	if blockReq.AccumulatedSamples == 0 && tr.pipeline.Reset != nil {
 		_, err = tr.pipeline.Reset(tr, blockReq)
 		if err != nil {
-			return time.Since(start), err
+			return err
 		}
 	}
 
 	_, err = tr.resources.ClearTraceAccumulator(blockReq)
 	if err != nil {
-		return time.Since(start), err
+		return err
 	}
 
+	if tr.pipeline.CaptureAovs {
+		_, err = tr.resources.ClearAovs(tr.resources.buffers.TraceAovs, blockReq)
+		if err != nil {
+			return err
+		}
+	}
+
+	if tr.pipeline.CaptureVariance {
+		for _, buf := range []*device.Buffer{tr.resources.buffers.TraceSnapshot, tr.resources.buffers.TraceVariance} {
+			_, err = tr.resources.ClearVariance(buf, blockReq)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	tr.rng = blockReq.Rand()
 	var sample uint32
 	for sample = 0; sample < blockReq.SamplesPerPixel; sample++ {
-		blockReq.Seed = rand.Uint32()
+		blockReq.Seed = tr.rng.Uint32()
 
 		// Generate primary rays
 		if tr.pipeline.PrimaryRayGenerator != nil {
 			_, err = tr.pipeline.PrimaryRayGenerator(tr, blockReq)
 			if err != nil {
-				return time.Since(start), err
+				return err
 			}
 		}
 
@@ -233,54 +236,327 @@ func (tr *Tracer) Trace(blockReq *tracer.BlockRequest) (time.Duration, error) {
 		if tr.pipeline.Integrator != nil {
 			_, err = tr.pipeline.Integrator(tr, blockReq)
 			if err != nil {
-				return time.Since(start), err
+				return err
+			}
+		}
+
+		if tr.pipeline.CaptureVariance {
+			_, err = tr.resources.AccumulateVariance(blockReq)
+			if err != nil {
+				return err
 			}
 		}
 
 		blockReq.AccumulatedSamples++
 	}
 
-	tr.stats.BlockW = blockReq.BlockW
-	tr.stats.BlockH = blockReq.BlockH
-	tr.stats.RenderTime = time.Since(start)
-	return tr.stats.RenderTime, nil
+	// Stream in any sampled textures that are not resident
+	loaded, err := tr.textures.Sync(tr.resources.buffers)
+	if err != nil {
+		return err
+	}
+	if loaded > 0 {
+		tr.logger.Debugf("streamed in %d texture(s); resident texture set uses %d bytes", loaded, tr.textures.cache.ResidentBytes())
+	}
+
+	return nil
 }
 
 // Run post-process filters and update the framebuffer with the processed output.
-func (tr *Tracer) SyncFramebuffer(blockReq *tracer.BlockRequest) (time.Duration, error) {
-	var err error
-	start := time.Now()
-
+func (tr *Tracer) Readback(blockReq *tracer.BlockRequest) error {
 	if tr.sceneData == nil {
-		return time.Since(start), ErrNoSceneData
+		return ErrNoSceneData
 	}
 
 	// Wait for async kernels to finish
-	err = tr.device.WaitForKernels()
+	err := tr.device.WaitForKernels()
 	if err != nil {
-		return time.Since(start), err
-	}
-
-	if tr.pipeline.PostProcess == nil {
-		return time.Since(start), nil
+		return err
 	}
 
 	for _, stage := range tr.pipeline.PostProcess {
 		_, err = stage(tr, blockReq)
 		if err != nil {
-			return time.Since(start), err
+			return err
 		}
 	}
 
-	return time.Since(start), nil
+	return nil
 }
 
-// Merge accumulator output from another tracer into this tracer's buffer.
-func (tr *Tracer) MergeOutput(other tracer.Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+// Copy the frame accumulator contents averaged over the accumulated samples
+// into a caller-owned buffer and return it. The buffer must contain 4 values
+// for each frame pixel.
+func (tr *Tracer) ReadFrame(blockReq *tracer.BlockRequest, dst []float32) ([]float32, error) {
+	if err := tracer.ValidateFrameBuffer(dst, blockReq.FrameW, blockReq.FrameH); err != nil {
+		return nil, err
+	}
+
+	// Wait for async kernels to finish
+	err := tr.device.WaitForKernels()
+	if err != nil {
+		return nil, err
+	}
+
+	err = tr.resources.buffers.FrameAccumulator.ReadData(0, 0, 4*len(dst), dst)
+	if err != nil {
+		return nil, err
+	}
+
+	sampleWeight := float32(1.0 / float32(blockReq.AccumulatedSamples+blockReq.SamplesPerPixel))
+	for index := range dst {
+		dst[index] *= sampleWeight
+	}
+	return dst, nil
+}
+
+// Merge accumulator output from another opencl backend into this tracer's buffer.
+func (tr *Tracer) Merge(other tracer.Backend, blockReq *tracer.BlockRequest) error {
+	err := tr.MergeAux(other, blockReq)
+	if err != nil {
+		return err
+	}
+
+	_, err = tr.resources.AggregateAccumulator(other.(*Tracer).resources.buffers.TraceAccumulator, blockReq)
+	return err
+}
+
+// Merge the AOV and variance output from another opencl backend into this
+// tracer's buffers.
+func (tr *Tracer) MergeAux(other tracer.Backend, blockReq *tracer.BlockRequest) error {
 	src, isClTracer := other.(*Tracer)
 	if !isClTracer {
-		return 0, fmt.Errorf("merge failed: unsupported tracer instance")
+		return fmt.Errorf("merge failed: unsupported tracer backend")
+	}
+
+	if tr.pipeline.CaptureAovs {
+		_, err := tr.resources.AggregateAovs(src.resources.buffers.TraceAovs, blockReq)
+		if err != nil {
+			return err
+		}
+	}
+
+	if tr.pipeline.CaptureVariance {
+		_, err := tr.resources.AggregateVariance(src.resources.buffers.TraceVariance, blockReq)
+		if err != nil {
+			return err
+		}
 	}
 
-	return tr.resources.AggregateAccumulator(src.resources.buffers.TraceAccumulator, blockReq)
+	return nil
+}
+
+// Copy the trace accumulator samples for the block rows into the supplied
+// buffer.
+func (tr *Tracer) ReadTraceAccumulator(blockReq *tracer.BlockRequest, dst []types.Vec3) error {
+	err := tr.device.WaitForKernels()
+	if err != nil {
+		return err
+	}
+
+	// Accumulator samples are stored as float3 values which are padded to 4 floats
+	offset := int(blockReq.FrameW * blockReq.BlockY)
+	samples := make([]float32, 4*int(blockReq.BlockW*blockReq.BlockH))
+	err = tr.resources.buffers.TraceAccumulator.ReadData(offset*sizeofAccumulatorSample, 0, 4*len(samples), samples)
+	if err != nil {
+		return err
+	}
+
+	for index := 0; index < len(samples)/4; index++ {
+		dst[offset+index] = types.Vec3{samples[4*index], samples[4*index+1], samples[4*index+2]}
+	}
+	return nil
+}
+
+// Add the block rows of the supplied buffer to the frame accumulator. The
+// trace accumulator is used as a staging buffer so its contents are
+// overwritten.
+func (tr *Tracer) AccumulateFrame(blockReq *tracer.BlockRequest, src []types.Vec3) error {
+	err := tr.device.WaitForKernels()
+	if err != nil {
+		return err
+	}
+
+	samples := make([]float32, 4*len(src))
+	for index, sample := range src {
+		copy(samples[4*index:4*index+3], sample[:])
+	}
+	err = tr.resources.buffers.TraceAccumulator.WriteData(samples, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = tr.resources.AggregateAccumulator(tr.resources.buffers.TraceAccumulator, blockReq)
+	return err
+}
+
+// Trace a batch of user-supplied rays, bypassing the camera. The ray batch
+// must fit in the buffers allocated for the current frame dimensions. The
+// rays are first processed by an intersection query and, if a block request
+// with a non-zero sample count is supplied, they are also processed by the
+// pipeline integrator to calculate the radiance along each ray.
+//
+// As this method reuses the trace buffers, the trace accumulator and AOV
+// contents are overwritten.
+func (tr *Tracer) TraceRays(rays []tracer.Ray, blockReq *tracer.BlockRequest) ([]tracer.RayResult, error) {
+	if tr.sceneData == nil {
+		return nil, ErrNoSceneData
+	}
+
+	numRays := len(rays)
+	if numRays == 0 {
+		return []tracer.RayResult{}, nil
+	}
+	if numRays*sizeofPath > tr.resources.buffers.Paths.Size() {
+		return nil, ErrRayBatchTooLarge
+	}
+
+	hostRays := make([]hostRay, numRays)
+	hostPaths := make([]hostPath, numRays)
+	for index, ray := range rays {
+		maxDist := ray.MaxDist
+		if maxDist <= 0 {
+			maxDist = math.MaxFloat32
+		}
+		hostRays[index] = hostRay{
+			Origin: ray.Origin.Vec4(maxDist),
+			Dir:    ray.Dir.Normalize().Vec4(float32(index)),
+		}
+		hostPaths[index] = hostPath{
+			Throughput: types.Vec4{1, 1, 1, 0},
+			PixelIndex: uint32(index),
+		}
+	}
+
+	// Upload ray batch and run intersection query
+	err := tr.uploadRayBatch(hostRays, hostPaths)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tr.resources.RayIntersectionQuery(tr.sceneData.IntersectionEpsilon(), 0, numRays)
+	if err != nil {
+		return nil, err
+	}
+
+	hitFlags := make([]uint32, numRays)
+	err = tr.resources.buffers.HitFlags.ReadData(0, 0, numRays*sizeofHitFlag, hitFlags)
+	if err != nil {
+		return nil, err
+	}
+	intersections := make([]hostIntersection, numRays)
+	err = tr.resources.buffers.Intersections.ReadData(0, 0, numRays*sizeofIntersection, intersections)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]tracer.RayResult, numRays)
+	for index, hit := range hitFlags {
+		if hit == 0 {
+			continue
+		}
+		results[index] = tracer.RayResult{
+			Hit:          true,
+			Distance:     intersections[index].Wuvt[3],
+			MeshInstance: intersections[index].MeshInstance,
+			Primitive:    intersections[index].TriIndex,
+			Barycentric:  intersections[index].Wuvt.Vec3(),
+			UV:           tr.sceneData.InterpolatedUV(intersections[index].TriIndex, intersections[index].Wuvt.Vec3()),
+		}
+	}
+
+	if blockReq == nil || blockReq.SamplesPerPixel == 0 || tr.pipeline.Integrator == nil {
+		return results, nil
+	}
+
+	// Treat the ray batch as a single-row frame and run the integrator
+	batchReq := *blockReq
+	batchReq.FrameW = uint32(numRays)
+	batchReq.FrameH = 1
+	batchReq.BlockX = 0
+	batchReq.BlockY = 0
+	batchReq.BlockW = uint32(numRays)
+	batchReq.BlockH = 1
+
+	_, err = tr.resources.ClearTraceAccumulator(&batchReq)
+	if err != nil {
+		return nil, err
+	}
+
+	tr.rng = batchReq.Rand()
+	var sample uint32
+	for sample = 0; sample < batchReq.SamplesPerPixel; sample++ {
+		// The integrator overwrites the ray and path buffers so we need
+		// to upload the ray batch again for each sample.
+		if sample > 0 {
+			err = tr.uploadRayBatch(hostRays, hostPaths)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		batchReq.Seed = tr.rng.Uint32()
+		_, err = tr.pipeline.Integrator(tr, &batchReq)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accumulator := make([]float32, 4*numRays)
+	err = tr.resources.buffers.TraceAccumulator.ReadData(0, 0, numRays*sizeofAccumulatorSample, accumulator)
+	if err != nil {
+		return nil, err
+	}
+	sampleWeight := 1.0 / float32(batchReq.SamplesPerPixel)
+	for index := range results {
+		results[index].Radiance = types.Vec3{
+			accumulator[4*index+0],
+			accumulator[4*index+1],
+			accumulator[4*index+2],
+		}.Mul(sampleWeight)
+	}
+
+	return results, nil
+}
+
+// Upload a batch of rays and their paths to the primary ray buffers.
+func (tr *Tracer) uploadRayBatch(rays []hostRay, paths []hostPath) error {
+	err := tr.resources.buffers.Rays[0].WriteData(rays, 0)
+	if err != nil {
+		return err
+	}
+	err = tr.resources.buffers.RayCounters[0].WriteData([]int32{int32(len(rays))}, 0)
+	if err != nil {
+		return err
+	}
+	return tr.resources.buffers.Paths.WriteData(paths, 0)
+}
+
+// The thin lens attributes used for generating primary rays with depth of field.
+type thinLens struct {
+	// The lens right and up axes scaled by the aperture radius.
+	U, V types.Vec3
+
+	// The orthonormal camera axes.
+	Right, Up, Forward types.Vec3
+
+	FocalDistance float32
+}
+
+// Setup the thin lens attributes for a camera. Pinhole, orthographic and
+// panoramic cameras are described by zero lens axes.
+func newThinLens(camera *scene.Camera) thinLens {
+	right, up, forward := camera.LensAxes()
+	lensRight, lensUp := right, up
+	if camera.ApertureRadius <= 0 || camera.Projection != scene.ProjectionPerspective {
+		lensRight, lensUp = types.Vec3{}, types.Vec3{}
+	}
+
+	return thinLens{
+		U:             lensRight.Mul(camera.ApertureRadius),
+		V:             lensUp.Mul(camera.ApertureRadius),
+		Right:         right,
+		Up:            up,
+		Forward:       forward,
+		FocalDistance: camera.FocalDistance,
+	}
 }
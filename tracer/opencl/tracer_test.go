@@ -0,0 +1,662 @@
+package opencl
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/achilleasa/polaris/asset/compiler"
+	"github.com/achilleasa/polaris/asset/compiler/input"
+	"github.com/achilleasa/polaris/asset/scene"
+	"github.com/achilleasa/polaris/tracer"
+	"github.com/achilleasa/polaris/tracer/opencl/device"
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestTraceRays(t *testing.T) {
+	devList, err := device.SelectDevices(device.CpuDevice, "CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devList) != 1 {
+		t.Fatalf("expected to get 1 CPU opencl device; got %d; check that openCL drivers are installed", len(devList))
+	}
+
+	tr, err := NewTracer("test", devList[0], nil, DefaultPipeline(NoDebug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	_, err = tr.UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tr.UpdateState(tracer.Synchronous, tracer.SceneData, genQuadScene(t, -5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rays := []tracer.Ray{
+		// Hits quad center
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+		// Hits quad corner region from further away
+		{Origin: types.Vec3{0.5, 0.5, 2}, Dir: types.Vec3{0, 0, -1}},
+		// Points away from the quad
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, 1}},
+		// Quad is further than the max distance
+		{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, -1}, MaxDist: 3},
+		// Misses the quad bounds
+		{Origin: types.Vec3{3, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+	}
+	expHits := []bool{true, true, false, false, false}
+	expDist := []float32{5, 7, 0, 0, 0}
+
+	results, err := tr.(tracer.RayBatchTracer).TraceRays(rays, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(rays) {
+		t.Fatalf("expected to get %d results; got %d", len(rays), len(results))
+	}
+	for index, res := range results {
+		if res.Hit != expHits[index] {
+			t.Fatalf("[ray %d] expected hit to be %t; got %t", index, expHits[index], res.Hit)
+		}
+		if math.Abs(float64(res.Distance-expDist[index])) > 1e-4 {
+			t.Fatalf("[ray %d] expected hit distance to be %f; got %f", index, expDist[index], res.Distance)
+		}
+	}
+}
+
+func TestTraceRaysBatchTooLarge(t *testing.T) {
+	devList, err := device.SelectDevices(device.CpuDevice, "CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devList) != 1 {
+		t.Fatalf("expected to get 1 CPU opencl device; got %d; check that openCL drivers are installed", len(devList))
+	}
+
+	tr, err := NewTracer("test", devList[0], nil, DefaultPipeline(NoDebug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	_, err = tr.UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = tr.UpdateState(tracer.Synchronous, tracer.SceneData, genQuadScene(t, -5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tr.(tracer.RayBatchTracer).TraceRays(make([]tracer.Ray, 2), nil)
+	if err != ErrRayBatchTooLarge {
+		t.Fatalf("expected to get ErrRayBatchTooLarge; got %v", err)
+	}
+}
+
+func TestTraceRaysMediumAttenuatesBackground(t *testing.T) {
+	devList, err := device.SelectDevices(device.CpuDevice, "CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devList) != 1 {
+		t.Fatalf("expected to get 1 CPU opencl device; got %d; check that openCL drivers are installed", len(devList))
+	}
+
+	tr, err := NewTracer("test", devList[0], nil, DefaultPipeline(NoDebug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	_, err = tr.UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{4, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs := []struct {
+		extinction  float32
+		domeRadius  float32
+		expRadiance float32
+	}{
+		{0, 10, 0.5},
+		{0.1, 10, 0.5 * float32(math.Exp(-1))},
+		// Without a dome, the background lies outside the medium
+		{0.1, 0, 0.5},
+	}
+
+	// The ray points away from the quad and samples the background
+	rays := []tracer.Ray{{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{0, 0, 1}}}
+	blockReq := &tracer.BlockRequest{SamplesPerPixel: 1, NumBounces: 1}
+	for index, spec := range specs {
+		ps := genQuadInputScene(-5)
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       compiler.SceneDiffuseMaterialName,
+			Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+			Used:       true,
+		})
+		ps.Medium.Extinction = spec.extinction
+		ps.Dome.Radius = spec.domeRadius
+		sc, _, err := compiler.Compile(ps, compiler.DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tr.UpdateState(tracer.Synchronous, tracer.SceneData, sc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := tr.(tracer.RayBatchTracer).TraceRays(rays, blockReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expRadiance := types.Vec3{spec.expRadiance, spec.expRadiance, spec.expRadiance}
+		if results[0].Hit || !types.ApproxEqual(results[0].Radiance, expRadiance, 1e-4) {
+			t.Fatalf("[spec %d] expected background radiance to be %v; got %v", index, expRadiance, results[0].Radiance)
+		}
+	}
+}
+
+func TestTraceRaysDomeProjectsBackground(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// Encode the latlong uv coordinates into the red (v) and green (u)
+	// channels of the background texture so that they can be recovered
+	// from the background radiance.
+	texPath := filepath.Join(t.TempDir(), "background.png")
+	writeTestTexture(t, texPath, 16, 64, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: uint8(4 * y), G: uint8(16 * x), A: 255}
+	})
+
+	specs := []struct {
+		domeRadius float32
+		ray        tracer.Ray
+		expUV      types.Vec2
+	}{
+		// A downward ray hits the dome ground at (5, -1, 0)
+		{10, tracer.Ray{Origin: types.Vec3{5, 0, 0}, Dir: types.Vec3{0, -1, 0}}, types.Vec2{0.25, float32(math.Acos(-1/math.Sqrt(26)) / math.Pi)}},
+		// Without a dome, the same ray samples the bottom of the sphere
+		{0, tracer.Ray{Origin: types.Vec3{5, 0, 0}, Dir: types.Vec3{0, -1, 0}}, types.Vec2{0.25, 63.0 / 64.0}},
+		// An upward ray from the dome center samples the sky along its direction
+		{10, tracer.Ray{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{1, 1, 0}.Normalize()}, types.Vec2{0.25, 0.25}},
+		{0, tracer.Ray{Origin: types.Vec3{0, 0, 0}, Dir: types.Vec3{1, 1, 0}.Normalize()}, types.Vec2{0.25, 0.25}},
+	}
+
+	for index, spec := range specs {
+		ps := input.NewScene()
+		addQuad(ps, types.Vec3{0, 0, -50}, types.Vec3{0.1, 0, 0}, types.Vec3{0, 0.1, 0}, "diffuse(reflectance: {0.5, 0.5, 0.5})")
+		ps.Materials = append(ps.Materials, &input.Material{
+			Name:       compiler.SceneDiffuseMaterialName,
+			Expression: fmt.Sprintf("diffuse(reflectance: %q)", texPath),
+			Used:       true,
+		})
+		ps.Dome.Radius = spec.domeRadius
+		ps.Dome.GroundHeight = -1
+		uploadTestScene(t, tr, ps)
+
+		results, err := tr.TraceRays([]tracer.Ray{spec.ray}, &tracer.BlockRequest{SamplesPerPixel: 1, NumBounces: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[0].Hit {
+			t.Fatalf("[spec %d] expected ray to miss the scene geometry", index)
+		}
+
+		radiance := results[0].Radiance
+		gotUV := types.Vec2{radiance[1] * 255 / (16 * 16), radiance[0] * 255 / (4 * 64)}
+		if math.Abs(float64(gotUV[0]-spec.expUV[0])) > 1e-2 || math.Abs(float64(gotUV[1]-spec.expUV[1])) > 1e-2 {
+			t.Errorf("[spec %d] expected background uv to be %v; got %v", index, spec.expUV, gotUV)
+		}
+	}
+}
+
+func TestTraceRaysUdimTextureTiles(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	dir := t.TempDir()
+	writeTestTexture(t, filepath.Join(dir, "tile.1001.png"), 2, 2, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: 255, A: 255}
+	})
+	writeTestTexture(t, filepath.Join(dir, "tile.1002.png"), 2, 2, func(x, y int) color.NRGBA {
+		return color.NRGBA{G: 255, A: 255}
+	})
+
+	// Two quads that share a UDIM emissive texture. The uvs of the second
+	// quad are shifted to the [1, 2] range so they map to tile 1002.
+	ps := input.NewScene()
+	matExpr := fmt.Sprintf("emissive(radiance: %q)", filepath.Join(dir, "tile.<UDIM>.png"))
+	addQuad(ps, types.Vec3{-1, 0, -2}, types.Vec3{0.5, 0, 0}, types.Vec3{0, 0.5, 0}, matExpr)
+	mesh := addQuad(ps, types.Vec3{1, 0, -2}, types.Vec3{0.5, 0, 0}, types.Vec3{0, 0.5, 0}, matExpr)
+	for _, prim := range mesh.Primitives {
+		for corner := range prim.UVs {
+			prim.UVs[corner][0]++
+		}
+	}
+	uploadTestScene(t, tr, ps)
+
+	rays := []tracer.Ray{
+		{Origin: types.Vec3{-1, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+		{Origin: types.Vec3{1, 0, 0}, Dir: types.Vec3{0, 0, -1}},
+	}
+	results, err := tr.TraceRays(rays, &tracer.BlockRequest{SamplesPerPixel: 1, NumBounces: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expRadiance := []types.Vec3{{1, 0, 0}, {0, 1, 0}}
+	for index, res := range results {
+		if !res.Hit {
+			t.Fatalf("[ray %d] expected ray to hit the quad", index)
+		}
+		if !types.ApproxEqual(res.Radiance, expRadiance[index], 1e-3) {
+			t.Errorf("[ray %d] expected uv %v to sample tile %d with radiance %v; got %v", index, res.UV, 1001+index, expRadiance[index], res.Radiance)
+		}
+	}
+}
+
+func TestGeneratePrimaryRaysBlueNoiseOffsets(t *testing.T) {
+	tr := newTestTracer(t, 4, 4)
+	defer tr.Close()
+
+	// A tiled 2x2 blue-noise texture with a distinct value per texel
+	bn, err := tracer.NewBlueNoise(2, 2, []types.Vec2{
+		{0.1, 0.7}, {0.6, 0.2},
+		{0.35, 0.9}, {0.85, 0.45},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.resources.UploadBlueNoise(bn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Use an orthographic frustrum that maps the frame texels to
+	// [0, frameW] x [0, frameH] so that each ray origin equals the pixel
+	// coordinates plus the sub-pixel sample offset.
+	frustrum := [4]types.Vec4{
+		{0, 0, 0, 0},
+		{4, 0, 0, 0},
+		{0, 4, 0, 0},
+		{4, 4, 0, 0},
+	}
+	lens := thinLens{Forward: types.Vec3{0, 0, -1}}
+	jitter := types.Vec2{0.25, 0.5}
+	blockReq := &tracer.BlockRequest{FrameW: 4, FrameH: 4, BlockH: 4, Seed: 1}
+
+	_, err = tr.resources.GeneratePrimaryRays(blockReq, types.Vec3{}, frustrum, lens, scene.ProjectionOrthographic, jitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tr.resources.buffers.Rays[0].ReadDataIntoSlice(make([]hostRay, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rays := data.([]hostRay)
+
+	// Map a sample in the [0, 1) range to a tent filter offset
+	tent := func(s float32) float32 {
+		if s < 0.5 {
+			return float32(math.Sqrt(float64(2*s))) - 0.5
+		}
+		return 1.5 - float32(math.Sqrt(float64(2-2*s)))
+	}
+
+	offsets := make([]types.Vec2, 16)
+	for y := uint32(0); y < 4; y++ {
+		for x := uint32(0); x < 4; x++ {
+			index := y*4 + x
+			noise := bn.Data[(y%2)*2+x%2]
+			sample := jitter.Add(noise)
+			sample = types.Vec2{sample[0] - float32(math.Floor(float64(sample[0]))), sample[1] - float32(math.Floor(float64(sample[1])))}
+			expOffset := types.Vec2{tent(sample[0]), tent(sample[1])}
+
+			origin := rays[index].Origin
+			offsets[index] = types.Vec2{origin[0] - float32(x), origin[1] - float32(y)}
+			if math.Abs(float64(offsets[index][0]-expOffset[0])) > 1e-3 || math.Abs(float64(offsets[index][1]-expOffset[1])) > 1e-3 {
+				t.Errorf("[pixel %d, %d] expected sample offset to be %v; got %v", x, y, expOffset, offsets[index])
+			}
+		}
+	}
+
+	// Neighboring pixels should use different offsets while pixels one
+	// tile apart should share the same offset.
+	if offsets[0] == offsets[1] || offsets[0] == offsets[4] {
+		t.Errorf("expected neighboring pixels to use different sample offsets; got %v, %v and %v", offsets[0], offsets[1], offsets[4])
+	}
+	if math.Abs(float64(offsets[0][0]-offsets[2][0])) > 1e-3 || math.Abs(float64(offsets[0][1]-offsets[2][1])) > 1e-3 {
+		t.Errorf("expected pixels one blue-noise tile apart to use the same sample offset; got %v and %v", offsets[0], offsets[2])
+	}
+}
+
+func TestRenderCropWindowMatchesFullFrame(t *testing.T) {
+	tr := newTestTracer(t, 8, 8)
+	defer tr.Close()
+
+	// A grid of emitters with distinct radiance values. Primary rays
+	// either hit an emitter or escape the scene so the radiance of each
+	// pixel only depends on its primary ray.
+	ps := input.NewScene()
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 3; x++ {
+			addQuad(ps, types.Vec3{float32(x - 1), float32(y - 1), -4}, types.Vec3{0.45, 0, 0}, types.Vec3{0, 0.45, 0}, fmt.Sprintf("emissive(radiance: {%d, %d, 1})", x+1, y+1))
+		}
+	}
+	uploadTestScene(t, tr, ps)
+
+	camera := scene.NewCamera(45)
+	camera.SetupProjection(1)
+	if err := tr.UploadCamera(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	// Use a fixed sample position so that both renders trace the same
+	// primary ray for each pixel.
+	tr.pipeline.PrimaryRayGenerator = func(tr *Tracer, blockReq *tracer.BlockRequest) (time.Duration, error) {
+		return tr.resources.GeneratePrimaryRays(blockReq, tr.cameraPosition, tr.cameraFrustrum, tr.cameraLens, tr.cameraProjection, types.Vec2{0.5, 0.5})
+	}
+
+	render := func(crop tracer.CropWindow) []float32 {
+		blockReq := tracer.BlockRequest{
+			FrameW:          8,
+			FrameH:          8,
+			BlockW:          8,
+			BlockH:          8,
+			SamplesPerPixel: 1,
+			NumBounces:      1,
+			MinBouncesForRR: 1,
+			Seed:            1,
+			Crop:            crop,
+		}
+		if crop.IsSet() {
+			blockReq.BlockY = crop.Y
+			blockReq.BlockH = crop.H
+		}
+
+		traceReq := blockReq
+		if err := tr.Render(&traceReq); err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Merge(tr, &blockReq); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := tr.ReadFrame(&blockReq, make([]float32, 4*8*8))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return frame
+	}
+
+	full := render(tracer.CropWindow{})
+	crop := tracer.CropWindow{X: 2, Y: 3, W: 4, H: 3}
+	cropped := render(crop)
+
+	var lit int
+	for y := uint32(0); y < 8; y++ {
+		for x := uint32(0); x < 8; x++ {
+			pixel := 4 * (y*8 + x)
+			got := types.Vec3{cropped[pixel], cropped[pixel+1], cropped[pixel+2]}
+
+			if x < crop.X || x >= crop.X+crop.W || y < crop.Y || y >= crop.Y+crop.H {
+				if got != (types.Vec3{}) {
+					t.Errorf("[pixel %d, %d] expected pixel outside the crop window to be black; got %v", x, y, got)
+				}
+				continue
+			}
+
+			exp := types.Vec3{full[pixel], full[pixel+1], full[pixel+2]}
+			if got.Sub(exp).Len() > 1e-4 {
+				t.Errorf("[pixel %d, %d] expected cropped pixel to match the full frame value %v; got %v", x, y, exp, got)
+			}
+			if exp.MaxComponent() > 0 {
+				lit++
+			}
+		}
+	}
+
+	if lit == 0 {
+		t.Fatal("expected the crop window to contain pixels that see an emitter")
+	}
+}
+
+func TestRenderVarianceAOV(t *testing.T) {
+	tr := newTestTracer(t, 8, 8)
+	defer tr.Close()
+	tr.pipeline.CaptureVariance = true
+
+	// An emitter that covers the left half of the frame. Its vertical edge
+	// crosses the footprint of the pixels in column 4 so their jittered
+	// samples either hit the emitter or escape the scene.
+	ps := input.NewScene()
+	addQuad(ps, types.Vec3{-4.9, 0, -4}, types.Vec3{5.1, 0, 0}, types.Vec3{0, 5, 0}, "emissive(radiance: {1, 1, 1})")
+	uploadTestScene(t, tr, ps)
+
+	camera := scene.NewCamera(45)
+	camera.SetupProjection(1)
+	if err := tr.UploadCamera(camera); err != nil {
+		t.Fatal(err)
+	}
+
+	blockReq := tracer.BlockRequest{
+		FrameW:          8,
+		FrameH:          8,
+		BlockW:          8,
+		BlockH:          8,
+		SamplesPerPixel: 64,
+		NumBounces:      1,
+		MinBouncesForRR: 1,
+		Seed:            1,
+	}
+	traceReq := blockReq
+	if err := tr.Render(&traceReq); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Merge(tr, &blockReq); err != nil {
+		t.Fatal(err)
+	}
+
+	variance, err := readFrameVariance(tr, 8*8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for y := 0; y < 8; y++ {
+		for _, x := range []int{0, 7} {
+			if v := variance[y*8+x]; v > 1e-4 {
+				t.Errorf("[pixel %d, %d] expected flat region to report near-zero variance; got %f", x, y, v)
+			}
+		}
+		if v := variance[y*8+4]; v < 0.05 {
+			t.Errorf("[pixel 4, %d] expected edge pixel to report a higher variance; got %f", y, v)
+		}
+	}
+}
+
+// Compile a scene with a 2x2 quad centered at (0, 0, z) facing the +Z axis.
+func genQuadScene(t *testing.T, z float32) interface{} {
+	sc, _, err := compiler.Compile(genQuadInputScene(z), compiler.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+// Generate a scene with a 2x2 quad centered at (0, 0, z) facing the +Z axis.
+func genQuadInputScene(z float32) *input.Scene {
+	ps := input.NewScene()
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       "diffuse",
+		Expression: "diffuse(reflectance: {0.5, 0.5, 0.5})",
+		Used:       true,
+	})
+
+	mesh := input.NewMesh("quad")
+	for _, vertices := range [][3]types.Vec3{
+		{{-1, -1, z}, {1, -1, z}, {1, 1, z}},
+		{{-1, -1, z}, {1, 1, z}, {-1, 1, z}},
+	} {
+		prim := &input.Primitive{
+			Vertices: vertices,
+			Normals:  [3]types.Vec3{{0, 0, 1}, {0, 0, 1}, {0, 0, 1}},
+		}
+		bbox := [2]types.Vec3{
+			types.MinVec3(types.MinVec3(vertices[0], vertices[1]), vertices[2]),
+			types.MaxVec3(types.MaxVec3(vertices[0], vertices[1]), vertices[2]),
+		}
+		prim.SetBBox(bbox)
+		prim.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+	mesh.MarkBBoxDirty()
+	ps.Meshes = append(ps.Meshes, mesh)
+
+	mi := &input.MeshInstance{
+		MeshIndex: 0,
+		Transform: types.Ident4(),
+	}
+	mi.SetBBox(mesh.BBox())
+	mi.SetCenter(types.Vec3{0, 0, z})
+	ps.MeshInstances = append(ps.MeshInstances, mi)
+	return ps
+}
+
+// Create an initialized opencl tracer backend for the CPU device with buffers
+// allocated for a frame with the given dimensions.
+func newTestTracer(t *testing.T, frameW, frameH uint32) *Tracer {
+	devList, err := device.SelectDevices(device.CpuDevice, "CPU")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devList) != 1 {
+		t.Fatalf("expected to get 1 CPU opencl device; got %d; check that openCL drivers are installed", len(devList))
+	}
+
+	tr, err := NewTracer("test", devList[0], nil, DefaultPipeline(NoDebug))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tr.UpdateState(tracer.Synchronous, tracer.FrameDimensions, [2]uint32{frameW, frameH})
+	if err != nil {
+		tr.Close()
+		t.Fatal(err)
+	}
+
+	return tr.(*tracer.BackendTracer).Backend().(*Tracer)
+}
+
+// Compile a parsed scene and upload it to the tracer.
+func uploadTestScene(t *testing.T, tr *Tracer, ps *input.Scene) *scene.Scene {
+	sc, _, err := compiler.Compile(ps, compiler.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tr.UploadScene(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sc
+}
+
+// Append an instance of a quad that uses a material with the given expression
+// to the scene. The quad is centered at the specified point and spans the u
+// and v half-axes. Its normal points along the cross product of u and v and
+// its uv coordinates span the [0, 1] range along u and v.
+func addQuad(ps *input.Scene, center, u, v types.Vec3, matExpr string) *input.Mesh {
+	matIndex := len(ps.Materials)
+	ps.Materials = append(ps.Materials, &input.Material{
+		Name:       fmt.Sprintf("material-%d", matIndex),
+		Expression: matExpr,
+		Used:       true,
+	})
+
+	corners := [4]types.Vec3{
+		center.Sub(u).Sub(v),
+		center.Add(u).Sub(v),
+		center.Add(u).Add(v),
+		center.Sub(u).Add(v),
+	}
+	uvs := [4]types.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+	normal := u.Cross(v).Normalize()
+
+	mesh := input.NewMesh(fmt.Sprintf("quad-%d", len(ps.Meshes)))
+	for _, tri := range [][3]int{{0, 1, 2}, {0, 2, 3}} {
+		prim := &input.Primitive{MaterialIndex: matIndex}
+		for corner, index := range tri {
+			prim.Vertices[corner] = corners[index]
+			prim.Normals[corner] = normal
+			prim.UVs[corner] = uvs[index]
+		}
+		bbox := [2]types.Vec3{
+			types.MinVec3(types.MinVec3(prim.Vertices[0], prim.Vertices[1]), prim.Vertices[2]),
+			types.MaxVec3(types.MaxVec3(prim.Vertices[0], prim.Vertices[1]), prim.Vertices[2]),
+		}
+		prim.SetBBox(bbox)
+		prim.SetCenter(bbox[0].Add(bbox[1]).Mul(0.5))
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+	mesh.MarkBBoxDirty()
+	ps.Meshes = append(ps.Meshes, mesh)
+
+	mi := &input.MeshInstance{
+		MeshIndex: uint32(len(ps.Meshes) - 1),
+		Transform: types.Ident4(),
+	}
+	mi.SetBBox(mesh.BBox())
+	mi.SetCenter(center)
+	ps.MeshInstances = append(ps.MeshInstances, mi)
+	return mesh
+}
+
+// Write a PNG texture with the given dimensions whose pixel colors are
+// generated by the supplied function.
+func writeTestTexture(t *testing.T, path string, w, h int, pixel func(x, y int) color.NRGBA) {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, pixel(x, y))
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = png.Encode(f, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+package tracer
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// A TileAccumulateFn accumulates the samples of a single tile into the
+// supplied buffer. The buffer is cleared before the function is invoked.
+type TileAccumulateFn func(tileIndex int, accumulator []types.Vec3) error
+
+// A TileReducer collects the partial accumulation buffers produced by
+// concurrent workers for a fixed number of tiles and sums them into a single
+// output buffer. As floating point addition is not associative, the partial
+// buffers are always added in tile index order so that the reduced output is
+// bit-identical regardless of the order in which workers complete their tiles.
+type TileReducer struct {
+	mutex    sync.Mutex
+	bufLen   int
+	partials [][]types.Vec3
+}
+
+// Create a new reducer for the given number of tiles. Each tile contributes a
+// partial buffer with bufLen entries.
+func NewTileReducer(numTiles, bufLen int) *TileReducer {
+	return &TileReducer{
+		bufLen:   bufLen,
+		partials: make([][]types.Vec3, numTiles),
+	}
+}
+
+// Submit the partial accumulation buffer for a tile. It is safe to call this
+// method from multiple goroutines.
+func (r *TileReducer) Submit(tileIndex int, partial []types.Vec3) error {
+	if tileIndex < 0 || tileIndex >= len(r.partials) {
+		return fmt.Errorf("tile reducer: tile index %d out of range [0, %d)", tileIndex, len(r.partials))
+	}
+	if len(partial) != r.bufLen {
+		return fmt.Errorf("tile reducer: expected tile %d buffer to contain %d entries; got %d", tileIndex, r.bufLen, len(partial))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.partials[tileIndex] != nil {
+		return fmt.Errorf("tile reducer: tile %d already submitted", tileIndex)
+	}
+	r.partials[tileIndex] = partial
+	return nil
+}
+
+// Add the submitted partial buffers to the output buffer in tile index order.
+// This method returns an error if any tile has not been submitted yet.
+func (r *TileReducer) Reduce(out []types.Vec3) error {
+	if len(out) != r.bufLen {
+		return fmt.Errorf("tile reducer: expected output buffer to contain %d entries; got %d", r.bufLen, len(out))
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for tileIndex, partial := range r.partials {
+		if partial == nil {
+			return fmt.Errorf("tile reducer: missing buffer for tile %d", tileIndex)
+		}
+	}
+
+	for _, partial := range r.partials {
+		for index, sample := range partial {
+			out[index][0] += sample[0]
+			out[index][1] += sample[1]
+			out[index][2] += sample[2]
+		}
+	}
+
+	return nil
+}
+
+// Accumulate numTiles tiles using a pool of numWorkers goroutines and add
+// their contributions to the output buffer using a TileReducer. The output
+// is identical for any number of workers.
+func ParallelAccumulate(numTiles, numWorkers int, out []types.Vec3, fn TileAccumulateFn) error {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	reducer := NewTileReducer(numTiles, len(out))
+	tileChan := make(chan int, numTiles)
+	for tileIndex := 0; tileIndex < numTiles; tileIndex++ {
+		tileChan <- tileIndex
+	}
+	close(tileChan)
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, numWorkers)
+	wg.Add(numWorkers)
+	for worker := 0; worker < numWorkers; worker++ {
+		go func() {
+			defer wg.Done()
+			for tileIndex := range tileChan {
+				partial := make([]types.Vec3, len(out))
+				err := fn(tileIndex, partial)
+				if err == nil {
+					err = reducer.Submit(tileIndex, partial)
+				}
+				if err != nil {
+					errChan <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errChan)
+
+	if err := <-errChan; err != nil {
+		return err
+	}
+
+	return reducer.Reduce(out)
+}
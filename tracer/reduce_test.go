@@ -0,0 +1,90 @@
+package tracer
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestParallelAccumulateDeterminism(t *testing.T) {
+	numTiles := 16
+	numPixels := 64
+
+	// Each tile traces a sample pass for the entire frame. Radiance values
+	// span several orders of magnitude so that the reduced output depends on
+	// the summation order. Tiles with a lower index take longer to complete
+	// so that workers submit them out of order.
+	renderTile := func(tileIndex int, accumulator []types.Vec3) error {
+		time.Sleep(time.Duration(numTiles-tileIndex) * time.Millisecond)
+		rng := rand.New(rand.NewSource(int64(tileIndex)))
+		for index := range accumulator {
+			scale := float32(1.0)
+			if rng.Float32() < 0.1 {
+				scale = 1e6
+			}
+			accumulator[index] = types.Vec3{rng.Float32(), rng.Float32(), rng.Float32()}.Mul(scale)
+		}
+		return nil
+	}
+
+	out1 := make([]types.Vec3, numPixels)
+	if err := ParallelAccumulate(numTiles, 1, out1, renderTile); err != nil {
+		t.Fatal(err)
+	}
+
+	out4 := make([]types.Vec3, numPixels)
+	if err := ParallelAccumulate(numTiles, 4, out4, renderTile); err != nil {
+		t.Fatal(err)
+	}
+
+	for index := range out1 {
+		if out1[index] != out4[index] {
+			t.Fatalf("expected pixel %d to be identical for 1 and 4 workers; got %v and %v", index, out1[index], out4[index])
+		}
+	}
+
+	// Summing the same tiles in reverse order should yield a different
+	// result; otherwise this test cannot detect order-dependent reductions.
+	reversed := make([]types.Vec3, numPixels)
+	for tileIndex := numTiles - 1; tileIndex >= 0; tileIndex-- {
+		partial := make([]types.Vec3, numPixels)
+		renderTile(tileIndex, partial)
+		for index := range partial {
+			reversed[index] = reversed[index].Add(partial[index])
+		}
+	}
+
+	differs := false
+	for index := range out1 {
+		if out1[index] != reversed[index] {
+			differs = true
+			break
+		}
+	}
+	if !differs {
+		t.Fatal("expected summation order to affect the accumulated output")
+	}
+}
+
+func TestTileReducerErrors(t *testing.T) {
+	reducer := NewTileReducer(2, 1)
+
+	if err := reducer.Submit(2, make([]types.Vec3, 1)); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("expected an out of range error; got %v", err)
+	}
+	if err := reducer.Submit(0, make([]types.Vec3, 2)); err == nil || !strings.Contains(err.Error(), "expected tile 0 buffer to contain 1 entries") {
+		t.Fatalf("expected a buffer size error; got %v", err)
+	}
+	if err := reducer.Submit(0, make([]types.Vec3, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := reducer.Submit(0, make([]types.Vec3, 1)); err == nil || !strings.Contains(err.Error(), "already submitted") {
+		t.Fatalf("expected a duplicate submission error; got %v", err)
+	}
+	if err := reducer.Reduce(make([]types.Vec3, 1)); err == nil || !strings.Contains(err.Error(), "missing buffer for tile 1") {
+		t.Fatalf("expected a missing tile error; got %v", err)
+	}
+}
@@ -7,12 +7,18 @@ type BlockScheduler interface {
 	// Split frame into row blocks of variable height and assign to the pool
 	// of tracers using feedback collected from previous frames.
 	Schedule(tracers []Tracer, frameH uint32) []uint32
+
+	// Discard the feedback collected from previous frames. This must be
+	// called whenever the pool of scheduled tracers changes as previous
+	// assignments are indexed by the position of each tracer in the pool.
+	Reset()
 }
 
 // The naive scheduler distributes blocks to available renderers based on their
 // reported speed estimate.
 type naiveScheduler struct {
 	blockAssignment []uint32
+	frameH          uint32
 }
 
 // Create a new naive scheduler
@@ -22,13 +28,20 @@ func NaiveScheduler() BlockScheduler {
 
 // Split frame into blocks and assign blocks bases on reported tracer speeds.
 func (sch *naiveScheduler) Schedule(tracers []Tracer, frameH uint32) []uint32 {
-	if len(sch.blockAssignment) != len(tracers) {
+	if len(sch.blockAssignment) != len(tracers) || sch.frameH != frameH {
 		sch.blockAssignment = assignBlocksBasedOnSpeed(tracers, frameH)
+		sch.frameH = frameH
 	}
 
 	return sch.blockAssignment
 }
 
+// Discard the cached block assignment.
+func (sch *naiveScheduler) Reset() {
+	sch.blockAssignment = nil
+	sch.frameH = 0
+}
+
 // The perfect scheduler assumes that the volume of tracing work between two
 // subsequent frames is approximately the same.
 type perfectScheduler struct {
@@ -79,6 +92,12 @@ func (sch *perfectScheduler) Schedule(tracers []Tracer, frameH uint32) []uint32
 	return sch.blockAssignment
 }
 
+// Discard the block assignment of the previous frame. The next call to
+// Schedule assigns blocks based on the reported tracer speeds.
+func (sch *perfectScheduler) Reset() {
+	sch.blockAssignment = nil
+}
+
 // Assign blocks to tracers based on reported speed.
 func assignBlocksBasedOnSpeed(tracers []Tracer, frameH uint32) []uint32 {
 	blockAssignment := make([]uint32, len(tracers))
@@ -104,3 +123,34 @@ func assignBlocksBasedOnSpeed(tracers []Tracer, frameH uint32) []uint32 {
 
 	return blockAssignment
 }
+
+// Split a block of rows between the supplied tracers in proportion to their
+// reported speed. Unlike the block schedulers, tracers may be assigned zero
+// rows so that blocks with fewer rows than tracers can still be split. Any
+// rows that are left unassigned due to rounding are assigned to the first
+// tracer. If none of the tracers reports a speed estimate, the rows are
+// split evenly.
+func SplitRowsBySpeed(tracers []Tracer, rows uint32) []uint32 {
+	blockAssignment := make([]uint32, len(tracers))
+	if len(tracers) == 0 {
+		return blockAssignment
+	}
+
+	var speedSum uint64 = 0
+	for _, tr := range tracers {
+		speedSum += uint64(tr.Speed())
+	}
+
+	var assignedRows uint32 = 0
+	for idx, tr := range tracers {
+		if speedSum == 0 {
+			blockAssignment[idx] = rows / uint32(len(tracers))
+		} else {
+			blockAssignment[idx] = uint32(uint64(rows) * uint64(tr.Speed()) / speedSum)
+		}
+		assignedRows += blockAssignment[idx]
+	}
+
+	blockAssignment[0] += rows - assignedRows
+	return blockAssignment
+}
@@ -79,6 +79,27 @@ func TestPerfectScheduler(t *testing.T) {
 	}
 }
 
+func TestSchedulerReset(t *testing.T) {
+	tr1 := makeMockTracer("mock-1", 1)
+	tr2 := makeMockTracer("mock-2", 1)
+	tr3 := makeMockTracer("mock-3", 3)
+
+	for _, sch := range []BlockScheduler{NaiveScheduler(), PerfectScheduler()} {
+		tr1.stats.RenderTime, tr2.stats.RenderTime = time.Duration(1), time.Duration(5)
+		blockAssignment := sch.Schedule([]Tracer{tr1, tr2}, 10)
+		tr1.stats.BlockH, tr2.stats.BlockH = blockAssignment[0], blockAssignment[1]
+		sch.Schedule([]Tracer{tr1, tr2}, 10)
+
+		// After a reset, blocks should be assigned based on the speed of
+		// the new pool of tracers
+		sch.Reset()
+		blockAssignment = sch.Schedule([]Tracer{tr1, tr3}, 8)
+		if blockAssignment[0] != 2 || blockAssignment[1] != 6 {
+			t.Fatalf("expected reset scheduler to assign 2 and 6 rows; got %d and %d", blockAssignment[0], blockAssignment[1])
+		}
+	}
+}
+
 type mockTracer struct {
 	id    string
 	speed uint32
@@ -112,10 +133,20 @@ func (mt *mockTracer) Init() error {
 func (mt *mockTracer) Close() {
 }
 
-func (mt *mockTracer) Enqueue(_ BlockRequest) {
+func (mt *mockTracer) UpdateState(_ UpdateMode, _ ChangeType, _ interface{}) (time.Duration, error) {
+	return 0, nil
+}
+
+func (mt *mockTracer) Trace(_ *BlockRequest) (time.Duration, error) {
+	return 0, nil
+}
+
+func (mt *mockTracer) MergeOutput(_ Tracer, _ *BlockRequest) (time.Duration, error) {
+	return 0, nil
 }
 
-func (mt *mockTracer) Update(_ UpdateType, _ interface{}) {
+func (mt *mockTracer) SyncFramebuffer(_ *BlockRequest) (time.Duration, error) {
+	return 0, nil
 }
 
 func (mt *mockTracer) Stats() *Stats {
@@ -0,0 +1,74 @@
+package tracer
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// SeedPolicy controls how the random seeds used for tracing each frame are
+// selected.
+type SeedPolicy uint8
+
+const (
+	// Use a random seed for each traced pass. Noise is fully animated
+	// and re-rendering a frame produces a different noise pattern.
+	AnimatedSeed SeedPolicy = iota
+
+	// Derive the seed from the frame index and the number of samples
+	// accumulated so far. Re-rendering a frame reproduces the same noise
+	// pattern which improves the temporal stability of denoisers.
+	StaticSeed
+)
+
+// Parse a seed policy from its name.
+func ParseSeedPolicy(name string) (SeedPolicy, error) {
+	switch name {
+	case "animated", "":
+		return AnimatedSeed, nil
+	case "static":
+		return StaticSeed, nil
+	}
+
+	return AnimatedSeed, fmt.Errorf("unsupported seed policy %q; supported values are: static, animated", name)
+}
+
+func (p SeedPolicy) String() string {
+	switch p {
+	case AnimatedSeed:
+		return "animated"
+	case StaticSeed:
+		return "static"
+	}
+
+	return "invalid"
+}
+
+// Get the seed for tracing the pass that follows the specified number of
+// accumulated samples for a particular frame index.
+func (p SeedPolicy) Seed(frameIndex, accumulatedSamples uint32) uint32 {
+	if p != StaticSeed {
+		return rand.Uint32()
+	}
+
+	return mixSeed(uint64(frameIndex)<<32 | uint64(accumulatedSamples))
+}
+
+// Create a random number generator for the request. The generator is seeded
+// using the request seed and the block offset so that tracers processing
+// different blocks of the same frame generate uncorrelated samples. Tracers
+// use this generator to derive all per-sample seeds so the traced noise only
+// depends on the request seed.
+func (r *BlockRequest) Rand() *rand.Rand {
+	return rand.New(rand.NewSource(int64(mixSeed(uint64(r.Seed)<<32 | uint64(r.BlockY)))))
+}
+
+// Scramble the bits of v using the splitmix64 finalizer so that consecutive
+// inputs map to uncorrelated seeds.
+func mixSeed(v uint64) uint32 {
+	v ^= v >> 30
+	v *= 0xbf58476d1ce4e5b9
+	v ^= v >> 27
+	v *= 0x94d049bb133111eb
+	v ^= v >> 31
+	return uint32(v)
+}
@@ -0,0 +1,54 @@
+package tracer
+
+import "testing"
+
+func TestStaticSeedPolicy(t *testing.T) {
+	if StaticSeed.Seed(7, 0) != StaticSeed.Seed(7, 0) {
+		t.Fatal("expected static seed policy to generate the same seed for the same frame index")
+	}
+	if StaticSeed.Seed(7, 0) == StaticSeed.Seed(8, 0) {
+		t.Fatal("expected static seed policy to generate different seeds for different frame indices")
+	}
+	if StaticSeed.Seed(7, 0) == StaticSeed.Seed(7, 1) {
+		t.Fatal("expected static seed policy to generate different seeds for each accumulated pass")
+	}
+}
+
+func TestBlockRequestRand(t *testing.T) {
+	req := &BlockRequest{Seed: StaticSeed.Seed(3, 0)}
+	rng0, rng1 := req.Rand(), req.Rand()
+	for i := 0; i < 16; i++ {
+		if v0, v1 := rng0.Uint32(), rng1.Uint32(); v0 != v1 {
+			t.Fatalf("[value %d] expected generators with the same seed to produce the same values; got %d and %d", i, v0, v1)
+		}
+	}
+
+	// Blocks of the same frame should use different sequences
+	other := *req
+	other.BlockY = 16
+	if req.Rand().Uint32() == other.Rand().Uint32() {
+		t.Fatal("expected generators for different blocks to produce different values")
+	}
+}
+
+func TestParseSeedPolicy(t *testing.T) {
+	specs := map[string]SeedPolicy{
+		"":         AnimatedSeed,
+		"animated": AnimatedSeed,
+		"static":   StaticSeed,
+	}
+
+	for name, exp := range specs {
+		policy, err := ParseSeedPolicy(name)
+		if err != nil {
+			t.Fatalf("[%q] unexpected error: %v", name, err)
+		}
+		if policy != exp {
+			t.Fatalf("[%q] expected policy %s; got %s", name, exp, policy)
+		}
+	}
+
+	if _, err := ParseSeedPolicy("foo"); err == nil {
+		t.Fatal("expected an error for an unsupported seed policy")
+	}
+}
@@ -0,0 +1,108 @@
+package tracer
+
+import (
+	"fmt"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+// The number of cells along each axis of the uv grid test pattern.
+const uvGridCells = 8
+
+// TestPattern selects a procedural image that can be rendered without a
+// scene for verifying the output, tone-mapping and image writing path.
+type TestPattern uint8
+
+const (
+	// Eight vertical bars with white, yellow, cyan, green, magenta,
+	// red, blue and black colors.
+	ColorBars TestPattern = iota
+
+	// A horizontal ramp from black to white.
+	Gradient
+
+	// Encode the pixel uv coordinates as red and green with white lines
+	// separating the cells of an 8x8 grid. The uv origin is the bottom
+	// left frame corner.
+	UVGrid
+)
+
+// The colors of the ColorBars pattern from left to right.
+var colorBars = [8]types.Vec3{
+	{1, 1, 1},
+	{1, 1, 0},
+	{0, 1, 1},
+	{0, 1, 0},
+	{1, 0, 1},
+	{1, 0, 0},
+	{0, 0, 1},
+	{0, 0, 0},
+}
+
+// Parse a test pattern from its name.
+func ParseTestPattern(name string) (TestPattern, error) {
+	switch name {
+	case "bars", "":
+		return ColorBars, nil
+	case "gradient":
+		return Gradient, nil
+	case "uv":
+		return UVGrid, nil
+	}
+
+	return ColorBars, fmt.Errorf("unsupported test pattern %q; supported values are: bars, gradient, uv", name)
+}
+
+func (p TestPattern) String() string {
+	switch p {
+	case ColorBars:
+		return "bars"
+	case Gradient:
+		return "gradient"
+	case UVGrid:
+		return "uv"
+	}
+
+	return "invalid"
+}
+
+// Fill a buffer with the linear RGBA pattern values for a frame with the
+// given dimensions. The buffer must contain 4 values for each frame pixel.
+func (p TestPattern) Fill(buf []float32, frameW, frameH uint32) error {
+	if err := ValidateFrameBuffer(buf, frameW, frameH); err != nil {
+		return err
+	}
+
+	for y := uint32(0); y < frameH; y++ {
+		for x := uint32(0); x < frameW; x++ {
+			var color types.Vec3
+			switch p {
+			case ColorBars:
+				color = colorBars[x*uint32(len(colorBars))/frameW]
+			case Gradient:
+				l := (float32(x) + 0.5) / float32(frameW)
+				color = types.Vec3{l, l, l}
+			case UVGrid:
+				if (x*uvGridCells)%frameW < uvGridCells || (y*uvGridCells)%frameH < uvGridCells {
+					color = types.Vec3{1, 1, 1}
+				} else {
+					color = types.Vec3{
+						(float32(x) + 0.5) / float32(frameW),
+						1 - (float32(y)+0.5)/float32(frameH),
+						0,
+					}
+				}
+			default:
+				return fmt.Errorf("unsupported test pattern %d", p)
+			}
+
+			offset := 4 * (y*frameW + x)
+			buf[offset] = color[0]
+			buf[offset+1] = color[1]
+			buf[offset+2] = color[2]
+			buf[offset+3] = 1
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package tracer
+
+import (
+	"testing"
+
+	"github.com/achilleasa/polaris/types"
+)
+
+func TestColorBarsPattern(t *testing.T) {
+	var frameW, frameH uint32 = 80, 4
+	buf := make([]float32, 4*frameW*frameH)
+	err := ColorBars.Fill(buf, frameW, frameH)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expColors := []types.Vec3{
+		{1, 1, 1},
+		{1, 1, 0},
+		{0, 1, 1},
+		{0, 1, 0},
+		{1, 0, 1},
+		{1, 0, 0},
+		{0, 0, 1},
+		{0, 0, 0},
+	}
+
+	barW := frameW / uint32(len(expColors))
+	for y := uint32(0); y < frameH; y++ {
+		for x := uint32(0); x < frameW; x++ {
+			exp := expColors[x/barW]
+			offset := 4 * (y*frameW + x)
+			got := types.Vec3{buf[offset], buf[offset+1], buf[offset+2]}
+			if got != exp || buf[offset+3] != 1 {
+				t.Fatalf("[pixel %d, %d] expected bar %d color to be %v with alpha 1; got %v with alpha %f", x, y, x/barW, exp, got, buf[offset+3])
+			}
+		}
+	}
+}
+
+func TestTestPatterns(t *testing.T) {
+	var frameW, frameH uint32 = 16, 16
+	buf := make([]float32, 4*frameW*frameH)
+
+	err := Gradient.Fill(buf, frameW, frameH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := uint32(1); x < frameW; x++ {
+		if buf[4*x] <= buf[4*(x-1)] {
+			t.Fatalf("[pixel %d] expected gradient to increase from left to right", x)
+		}
+	}
+
+	err = UVGrid.Fill(buf, frameW, frameH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := []struct {
+		x, y uint32
+		exp  types.Vec3
+	}{
+		// Grid lines
+		{0, 5, types.Vec3{1, 1, 1}},
+		{2, 5, types.Vec3{1, 1, 1}},
+		{5, 8, types.Vec3{1, 1, 1}},
+		// Cell interiors encode uv with the origin at the bottom left corner
+		{1, 15, types.Vec3{1.5 / 16, 0.5 / 16, 0}},
+		{15, 1, types.Vec3{15.5 / 16, 14.5 / 16, 0}},
+	}
+	for specIndex, spec := range specs {
+		offset := 4 * (spec.y*frameW + spec.x)
+		if got := (types.Vec3{buf[offset], buf[offset+1], buf[offset+2]}); got != spec.exp {
+			t.Fatalf("[spec %d] expected uv grid pixel %d, %d to be %v; got %v", specIndex, spec.x, spec.y, spec.exp, got)
+		}
+	}
+
+	if err = ColorBars.Fill(buf[4:], frameW, frameH); err == nil {
+		t.Fatal("expected an error when filling an undersized buffer")
+	}
+}
+
+func TestParseTestPattern(t *testing.T) {
+	specs := map[string]TestPattern{
+		"":         ColorBars,
+		"bars":     ColorBars,
+		"gradient": Gradient,
+		"uv":       UVGrid,
+	}
+
+	for name, exp := range specs {
+		pattern, err := ParseTestPattern(name)
+		if err != nil {
+			t.Fatalf("[%q] unexpected error: %v", name, err)
+		}
+		if pattern != exp {
+			t.Fatalf("[%q] expected pattern %s; got %s", name, exp, pattern)
+		}
+	}
+
+	expError := `unsupported test pattern "foo"; supported values are: bars, gradient, uv`
+	if _, err := ParseTestPattern("foo"); err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
@@ -0,0 +1,110 @@
+package tracer
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// A TextureStore manages the device memory for the textures tracked by a
+// TextureCache.
+type TextureStore interface {
+	// Make the texture with the given index resident.
+	Load(texIndex uint32) error
+
+	// Release the memory used by a resident texture.
+	Evict(texIndex uint32) error
+}
+
+// A TextureCache keeps the most recently sampled textures resident while
+// ensuring that the total size of the resident textures does not exceed a
+// memory budget. When a non-resident texture is requested, the least
+// recently sampled textures are evicted until the requested texture fits
+// in the budget.
+type TextureCache struct {
+	store TextureStore
+
+	// The memory budget in bytes and the size of each texture.
+	budget uint64
+	sizes  []uint64
+
+	// The total size of the resident textures.
+	residentBytes uint64
+
+	// Resident textures ordered from the most to the least recently
+	// sampled one and their list elements indexed by texture index.
+	lru      *list.List
+	resident map[uint32]*list.Element
+}
+
+// Create a new texture cache for a set of textures with the given sizes.
+func NewTextureCache(budget uint64, sizes []uint64, store TextureStore) *TextureCache {
+	return &TextureCache{
+		store:    store,
+		budget:   budget,
+		sizes:    sizes,
+		lru:      list.New(),
+		resident: make(map[uint32]*list.Element),
+	}
+}
+
+// Mark a texture as sampled. If the texture is not resident, it is loaded
+// into the store after evicting enough of the least recently sampled
+// textures to fit it in the budget. This method returns true if the
+// texture had to be loaded.
+func (c *TextureCache) Touch(texIndex uint32) (bool, error) {
+	if elem, exists := c.resident[texIndex]; exists {
+		c.lru.MoveToFront(elem)
+		return false, nil
+	}
+
+	if int(texIndex) >= len(c.sizes) {
+		return false, fmt.Errorf("texture cache: unknown texture %d", texIndex)
+	}
+
+	size := c.sizes[texIndex]
+	if size > c.budget {
+		return false, fmt.Errorf("texture cache: texture %d requires %d bytes which exceeds the budget of %d bytes", texIndex, size, c.budget)
+	}
+
+	for c.residentBytes+size > c.budget {
+		if err := c.evict(c.lru.Back()); err != nil {
+			return false, err
+		}
+	}
+
+	if err := c.store.Load(texIndex); err != nil {
+		return false, err
+	}
+	c.resident[texIndex] = c.lru.PushFront(texIndex)
+	c.residentBytes += size
+	return true, nil
+}
+
+// Evict the texture referenced by a lru list element.
+func (c *TextureCache) evict(elem *list.Element) error {
+	texIndex := elem.Value.(uint32)
+	if err := c.store.Evict(texIndex); err != nil {
+		return err
+	}
+
+	c.lru.Remove(elem)
+	delete(c.resident, texIndex)
+	c.residentBytes -= c.sizes[texIndex]
+	return nil
+}
+
+// Check whether a texture is resident.
+func (c *TextureCache) IsResident(texIndex uint32) bool {
+	_, exists := c.resident[texIndex]
+	return exists
+}
+
+// Get the total size of the resident textures.
+func (c *TextureCache) ResidentBytes() uint64 {
+	return c.residentBytes
+}
+
+// Get the memory budget of the cache.
+func (c *TextureCache) Budget() uint64 {
+	return c.budget
+}
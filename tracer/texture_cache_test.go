@@ -0,0 +1,89 @@
+package tracer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTextureCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	store := &mockTextureStore{}
+	cache := NewTextureCache(100, []uint64{40, 40, 40, 90}, store)
+
+	for _, texIndex := range []uint32{0, 1} {
+		loaded, err := cache.Touch(texIndex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !loaded {
+			t.Fatalf("expected texture %d to be loaded", texIndex)
+		}
+	}
+
+	// Sampling texture 0 again makes texture 1 the least recently used one
+	loaded, err := cache.Touch(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded {
+		t.Fatal("expected resident texture to not be reloaded")
+	}
+
+	// Exceeding the budget should evict texture 1
+	if _, err = cache.Touch(2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(store.evicted, []uint32{1}) {
+		t.Fatalf("expected texture 1 to be evicted; got evicted textures %v", store.evicted)
+	}
+	if !cache.IsResident(0) || cache.IsResident(1) || !cache.IsResident(2) {
+		t.Fatal("expected textures 0 and 2 to be resident")
+	}
+	if cache.ResidentBytes() != 80 {
+		t.Fatalf("expected resident bytes to be 80; got %d", cache.ResidentBytes())
+	}
+
+	// Large textures may evict more than one texture
+	if _, err = cache.Touch(3); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(store.evicted, []uint32{1, 0, 2}) {
+		t.Fatalf("expected textures 0 and 2 to be evicted in LRU order; got evicted textures %v", store.evicted)
+	}
+	if !reflect.DeepEqual(store.loaded, []uint32{0, 1, 2, 3}) {
+		t.Fatalf("expected textures to be loaded in request order; got %v", store.loaded)
+	}
+	if cache.ResidentBytes() != 90 {
+		t.Fatalf("expected resident bytes to be 90; got %d", cache.ResidentBytes())
+	}
+}
+
+func TestTextureCacheRejectsTexturesExceedingBudget(t *testing.T) {
+	cache := NewTextureCache(10, []uint64{20}, &mockTextureStore{})
+
+	_, err := cache.Touch(0)
+	expError := "texture cache: texture 0 requires 20 bytes which exceeds the budget of 10 bytes"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+
+	_, err = cache.Touch(1)
+	expError = "texture cache: unknown texture 1"
+	if err == nil || err.Error() != expError {
+		t.Fatalf("expected error %q; got %v", expError, err)
+	}
+}
+
+type mockTextureStore struct {
+	loaded  []uint32
+	evicted []uint32
+}
+
+func (s *mockTextureStore) Load(texIndex uint32) error {
+	s.loaded = append(s.loaded, texIndex)
+	return nil
+}
+
+func (s *mockTextureStore) Evict(texIndex uint32) error {
+	s.evicted = append(s.evicted, texIndex)
+	return nil
+}
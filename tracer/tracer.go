@@ -1,6 +1,11 @@
 package tracer
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/achilleasa/polaris/types"
+)
 
 // A unit of work that is processed by a tracer.
 type BlockRequest struct {
@@ -14,6 +19,11 @@ type BlockRequest struct {
 	BlockW uint32
 	BlockH uint32
 
+	// An optional crop window. If set, primary rays are only generated
+	// for the window columns of each block row. The window rows are
+	// used by renderers for splitting the window into blocks.
+	Crop CropWindow
+
 	// The number of emitted rays per traced pixel.
 	SamplesPerPixel uint32
 
@@ -23,6 +33,14 @@ type BlockRequest struct {
 	// Number of bounces before applying russian roulette to terminate paths.
 	MinBouncesForRR uint32
 
+	// Number of bounces before performing next-event estimation. Paths
+	// at shallower depths only gather light via bxdf sampling.
+	MinBouncesForNEE uint32
+
+	// Max path throughput component indexed by bounce depth. A zero or
+	// missing entry disables clamping at that depth.
+	ThroughputClamp []float32
+
 	// The exposure value controls HDR -> LDR mapping.
 	Exposure float32
 
@@ -33,6 +51,15 @@ type BlockRequest struct {
 	AccumulatedSamples uint32
 }
 
+// Get the throughput clamp value for the given bounce depth. A zero return
+// value indicates that clamping is disabled.
+func (r *BlockRequest) ThroughputClampAt(bounce uint32) float32 {
+	if int(bounce) >= len(r.ThroughputClamp) || r.ThroughputClamp[bounce] < 0 {
+		return 0
+	}
+	return r.ThroughputClamp[bounce]
+}
+
 // Tracer statistics.
 type Stats struct {
 	// The rendered block dimensions.
@@ -46,6 +73,92 @@ type Stats struct {
 	RenderTime time.Duration
 }
 
+// A user-supplied ray for ray batch queries.
+type Ray struct {
+	Origin types.Vec3
+	Dir    types.Vec3
+
+	// The max distance for intersection queries. A zero value disables
+	// the distance limit.
+	MaxDist float32
+}
+
+// The result of tracing a user-supplied ray.
+type RayResult struct {
+	// Set to true if the ray intersects the scene geometry.
+	Hit bool
+
+	// The distance from the ray origin to the closest intersection.
+	Distance float32
+
+	// The mesh instance and primitive index for the closest intersection.
+	MeshInstance uint32
+	Primitive    uint32
+
+	// The barycentric coordinates (w, u, v) of the intersection point.
+	Barycentric types.Vec3
+
+	// The surface UV at the intersection point.
+	UV types.Vec2
+
+	// The radiance along the ray averaged over the requested number of
+	// samples. It is only calculated if the tracer runs the integrator.
+	Radiance types.Vec3
+}
+
+type RayBatchTracer interface {
+	// Trace a batch of user-supplied rays, bypassing the camera. If the
+	// supplied block request is not nil, its sample count, bounce and
+	// clamping settings are used for running the integrator on the rays.
+	// The block dimensions are ignored.
+	TraceRays([]Ray, *BlockRequest) ([]RayResult, error)
+}
+
+// A FrameReader copies the rendered frame into a caller-owned buffer so that
+// interactive applications can reuse the same buffer across frames.
+type FrameReader interface {
+	// Copy the linear RGBA frame output, averaged over the accumulated
+	// samples, into the supplied buffer and return it. The buffer must
+	// contain 4 values for each frame pixel.
+	ReadFrame(*BlockRequest, []float32) ([]float32, error)
+}
+
+// A HostMerger exposes the accumulated samples of a tracer to the host so
+// that the renderer can combine the output of multiple tracers using a
+// TileReducer. Unlike MergeOutput, which adds each block to the primary
+// tracer as soon as it completes, this allows the blocks to be summed in a
+// fixed order so the merged output does not depend on the tracer scheduling.
+type HostMerger interface {
+	// Copy the trace accumulator samples for the block rows into the
+	// supplied buffer which must contain an entry for each frame pixel.
+	ReadTraceAccumulator(*BlockRequest, []types.Vec3) error
+
+	// Add the block rows of the supplied buffer, which must contain an
+	// entry for each frame pixel, to the frame accumulator.
+	AccumulateFrame(*BlockRequest, []types.Vec3) error
+
+	// Merge any output other than the accumulated samples (e.g. AOVs and
+	// variance estimates) from another tracer into this tracer's buffers.
+	MergeAuxOutput(Tracer, *BlockRequest) error
+}
+
+// Check that a buffer can hold the samples of each pixel of a frame with the
+// given dimensions.
+func ValidateAccumulatorBuffer(buf []types.Vec3, frameW, frameH uint32) error {
+	if expLen := int(frameW) * int(frameH); len(buf) != expLen {
+		return fmt.Errorf("expected accumulator buffer to contain %d entries for a %dx%d frame; got %d", expLen, frameW, frameH, len(buf))
+	}
+	return nil
+}
+
+// Check that a buffer can hold the RGBA output of a frame with the given dimensions.
+func ValidateFrameBuffer(buf []float32, frameW, frameH uint32) error {
+	if expLen := 4 * int(frameW) * int(frameH); len(buf) != expLen {
+		return fmt.Errorf("expected frame buffer to contain %d values for a %dx%d frame; got %d", expLen, frameW, frameH, len(buf))
+	}
+	return nil
+}
+
 type Flag uint8
 
 // Tracer or-able flag list.
@@ -0,0 +1,28 @@
+package tracer
+
+import "testing"
+
+func TestThroughputClampAt(t *testing.T) {
+	req := &BlockRequest{
+		ThroughputClamp: []float32{0, 2, -1},
+	}
+
+	specs := []struct {
+		bounce   uint32
+		expClamp float32
+	}{
+		// A zero clamp value disables clamping at that depth
+		{0, 0},
+		{1, 2},
+		// Negative clamp values also disable clamping
+		{2, 0},
+		// Depths without a clamp entry should not be clamped
+		{3, 0},
+	}
+
+	for _, spec := range specs {
+		if clamp := req.ThroughputClampAt(spec.bounce); clamp != spec.expClamp {
+			t.Fatalf("expected throughput clamp at depth %d to be %v; got %v", spec.bounce, spec.expClamp, clamp)
+		}
+	}
+}
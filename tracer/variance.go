@@ -0,0 +1,55 @@
+package tracer
+
+import "github.com/achilleasa/polaris/types"
+
+// The state of a Welford running variance estimator for a single pixel.
+type WelfordState struct {
+	// The number of samples processed by the estimator.
+	Count float32
+
+	// The running sample mean.
+	Mean float32
+
+	// The running sum of squared differences from the mean.
+	M2 float32
+}
+
+// Update the estimator with a new sample.
+func (s *WelfordState) Add(sample float32) {
+	s.Count++
+	delta := sample - s.Mean
+	s.Mean += delta / s.Count
+	s.M2 += delta * (sample - s.Mean)
+}
+
+// Combine the state of another estimator into this estimator using the
+// parallel variant of Welford's algorithm.
+func (s *WelfordState) Merge(other WelfordState) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 {
+		*s = other
+		return
+	}
+
+	count := s.Count + other.Count
+	delta := other.Mean - s.Mean
+	s.M2 += other.M2 + delta*delta*s.Count*other.Count/count
+	s.Mean += delta * other.Count / count
+	s.Count = count
+}
+
+// Get the unbiased sample variance. Estimators with less than two samples
+// report zero variance.
+func (s WelfordState) Variance() float32 {
+	if s.Count < 2 {
+		return 0
+	}
+	return s.M2 / (s.Count - 1)
+}
+
+// Calculate the luminance of a linear RGB value using the Rec. 709 weights.
+func Luminance(v types.Vec3) float32 {
+	return 0.2126*v[0] + 0.7152*v[1] + 0.0722*v[2]
+}
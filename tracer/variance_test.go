@@ -0,0 +1,69 @@
+package tracer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestWelfordStateVariance(t *testing.T) {
+	// A pixel fully covered by a flat surface sees the same luminance
+	// for every sample while a 50% coverage edge pixel randomly sees
+	// either the surface or the background.
+	rng := rand.New(rand.NewSource(0))
+	var flat, edge WelfordState
+	for sample := 0; sample < 256; sample++ {
+		flat.Add(1)
+		if rng.Float32() < 0.5 {
+			edge.Add(1)
+		} else {
+			edge.Add(0)
+		}
+	}
+
+	if v := flat.Variance(); v > 1e-6 {
+		t.Fatalf("expected flat pixel to report near-zero variance; got %f", v)
+	}
+
+	// A 50% coverage edge pixel has a variance of ~0.25
+	if v := edge.Variance(); v < 0.2 {
+		t.Fatalf("expected edge pixel to report a variance > 0.2; got %f", v)
+	}
+
+	var single WelfordState
+	single.Add(5)
+	if v := single.Variance(); v != 0 {
+		t.Fatalf("expected estimator with a single sample to report zero variance; got %f", v)
+	}
+}
+
+func TestWelfordStateMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]float32, 100)
+	for index := range samples {
+		samples[index] = rng.Float32() * 10
+	}
+
+	// Split samples between two estimators to simulate multiple tracers
+	var all, left, right WelfordState
+	for index, sample := range samples {
+		all.Add(sample)
+		if index < 37 {
+			left.Add(sample)
+		} else {
+			right.Add(sample)
+		}
+	}
+
+	left.Merge(right)
+	if all.Count != left.Count || math.Abs(float64(all.Mean-left.Mean)) > 1e-4 || math.Abs(float64(all.Variance()-left.Variance())) > 1e-3 {
+		t.Fatalf("expected merged state to be %+v; got %+v", all, left)
+	}
+
+	// Merging into an empty estimator should copy the other estimator
+	var empty WelfordState
+	empty.Merge(all)
+	if empty != all {
+		t.Fatalf("expected merged state to be %+v; got %+v", all, empty)
+	}
+}
@@ -57,6 +57,15 @@ func Translate4(translation Vec3) Mat4 {
 	return Mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, translation[0], translation[1], translation[2], 1}
 }
 
+// Create a 4x4 matrix for rotating by angle radians around an axis.
+func Rotate4(angle float32, axis Vec3) Mat4 {
+	axis = axis.Normalize()
+	x, y, z := axis[0], axis[1], axis[2]
+	s, c := float32(math.Sin(float64(angle))), float32(math.Cos(float64(angle)))
+	k := 1 - c
+	return Mat4{x*x*k + c, x*y*k + z*s, x*z*k - y*s, 0, x*y*k - z*s, y*y*k + c, y*z*k + x*s, 0, x*z*k + y*s, y*z*k - x*s, z*z*k + c, 0, 0, 0, 0, 1}
+}
+
 // Multiply a 4x4 matrix with a Vec4. The vector is treated as a 4x1 matrix
 func (m Mat4) Mul4x1(v Vec4) Vec4 {
 	return Vec4{
@@ -160,6 +169,13 @@ func Perspective4(fovy, aspect, near, far float32) Mat4 {
 	return Mat4{float32(f / aspect), 0, 0, 0, 0, float32(f), 0, 0, 0, 0, float32((near + far) / nmf), -1, 0, 0, float32((2. * far * near) / nmf), 0}
 }
 
+// Create an orthographic projection 4x4 matrix
+func Ortho4(left, right, bottom, top, near, far float32) Mat4 {
+	rml, tmb, fmn := right-left, top-bottom, far-near
+
+	return Mat4{2 / rml, 0, 0, 0, 0, 2 / tmb, 0, 0, 0, 0, -2 / fmn, 0, -(right + left) / rml, -(top + bottom) / tmb, -(far + near) / fmn, 1}
+}
+
 // Generates a transform matrix from world space into the specific eye space.
 func LookAtV(eye, center, up Vec3) Mat4 {
 	f := center.Sub(eye).Normalize()
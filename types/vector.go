@@ -74,6 +74,31 @@ func (v Vec2) Sub(v2 Vec2) Vec2 {
 	return Vec2{v[0] - v2[0], v[1] - v2[1]}
 }
 
+// Add a vector.
+func (v Vec2) Add(v2 Vec2) Vec2 {
+	return Vec2{v[0] + v2[0], v[1] + v2[1]}
+}
+
+// Multiply a 2 component vector with a scalar.
+func (v Vec2) Mul(s float32) Vec2 {
+	return Vec2{v[0] * s, v[1] * s}
+}
+
+// Linearly interpolate between two vectors.
+func (v Vec2) Lerp(v2 Vec2, t float32) Vec2 {
+	return Vec2{v[0] + (v2[0]-v[0])*t, v[1] + (v2[1]-v[1])*t}
+}
+
+// Interpolate the 2 component vectors at the corners of a triangle using the
+// barycentric coordinates (w, u, v) of a point inside it. This matches the
+// interpolation performed by the tracer kernels for surface UVs.
+func BarycentricVec2(v0, v1, v2 Vec2, w, u, v float32) Vec2 {
+	return Vec2{
+		w*v0[0] + u*v1[0] + v*v2[0],
+		w*v0[1] + u*v1[1] + v*v2[1],
+	}
+}
+
 // Calculate dot product of 2 vectors
 func (v Vec2) Dot(v2 Vec2) float32 {
 	return v[0]*v2[0] + v[1]*v2[1]
@@ -136,6 +161,11 @@ func MaxVec3(v1, v2 Vec3) Vec3 {
 	return out
 }
 
+// Add a vector.
+func (v Vec4) Add(v2 Vec4) Vec4 {
+	return Vec4{v[0] + v2[0], v[1] + v2[1], v[2] + v2[2], v[3] + v2[3]}
+}
+
 // Subtract a vector.
 func (v Vec4) Sub(v2 Vec4) Vec4 {
 	return Vec4{v[0] - v2[0], v[1] - v2[1], v[2] - v2[2], v[3] - v2[3]}
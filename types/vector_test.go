@@ -0,0 +1,38 @@
+package types
+
+import "testing"
+
+func TestVec2Lerp(t *testing.T) {
+	v := XY(0, 2).Lerp(XY(1, 4), 0.5)
+	exp := XY(0.5, 3)
+	if v != exp {
+		t.Fatalf("expected lerped value to be %v; got %v", exp, v)
+	}
+}
+
+func TestBarycentricVec2(t *testing.T) {
+	uv0, uv1, uv2 := XY(0, 0), XY(1, 0), XY(0.5, 1)
+
+	// Each corner should map to its own UV
+	specs := []struct {
+		w, u, v float32
+		exp     Vec2
+	}{
+		{1, 0, 0, uv0},
+		{0, 1, 0, uv1},
+		{0, 0, 1, uv2},
+	}
+	for index, spec := range specs {
+		if out := BarycentricVec2(uv0, uv1, uv2, spec.w, spec.u, spec.v); out != spec.exp {
+			t.Fatalf("[spec %d] expected interpolated UV to be %v; got %v", index, spec.exp, out)
+		}
+	}
+
+	// At the centroid we should get the average of the three UVs
+	var third float32 = 1.0 / 3.0
+	out := BarycentricVec2(uv0, uv1, uv2, third, third, third)
+	exp := uv0.Add(uv1).Add(uv2).Mul(third)
+	if out.Sub(exp).Dot(out.Sub(exp)) > 1e-10 {
+		t.Fatalf("expected UV at centroid to be %v; got %v", exp, out)
+	}
+}